@@ -2,6 +2,7 @@ package commands
 
 import (
 	"bufio"
+	"flag"
 	"fmt"
 	"os"
 	"strconv"
@@ -9,12 +10,14 @@ import (
 	"syscall"
 
 	"github.com/zulfikawr/warp/cmd/warp/ui"
+	"github.com/zulfikawr/warp/internal/cli"
 	"github.com/zulfikawr/warp/internal/config"
 	"github.com/zulfikawr/warp/internal/errors"
+	uipkg "github.com/zulfikawr/warp/internal/ui"
 )
 
 // Config executes the config command
-func Config(args []string) error {
+func Config(g cli.GlobalOptions, args []string) error {
 	if len(args) == 0 {
 		configHelp()
 		return nil
@@ -26,25 +29,7 @@ func Config(args []string) error {
 		return configInit()
 
 	case "show":
-		cfg, err := config.LoadConfig()
-		if err != nil {
-			return errors.ConfigError("Failed to load configuration", err)
-		}
-		configPath := config.GetConfigPath()
-		fmt.Println(ui.C.Bold + "Current Configuration:" + ui.C.Reset)
-		fmt.Printf("  Config file: %s\n", configPath)
-		fmt.Println()
-		fmt.Printf("  %-20s %v\n", "Default Interface:", cfg.DefaultInterface)
-		fmt.Printf("  %-20s %d\n", "Default Port:", cfg.DefaultPort)
-		fmt.Printf("  %-20s %d bytes\n", "Buffer Size:", cfg.BufferSize)
-		fmt.Printf("  %-20s %d GB\n", "Max Upload Size:", cfg.MaxUploadSize/(1024*1024*1024))
-		fmt.Printf("  %-20s %.1f Mbps\n", "Rate Limit:", cfg.RateLimitMbps)
-		fmt.Printf("  %-20s %d MB\n", "Cache Size:", cfg.CacheSizeMB)
-		fmt.Printf("  %-20s %d MB\n", "Chunk Size:", cfg.ChunkSizeMB)
-		fmt.Printf("  %-20s %d\n", "Parallel Workers:", cfg.ParallelWorkers)
-		fmt.Printf("  %-20s %v\n", "No QR Code:", cfg.NoQR)
-		fmt.Printf("  %-20s %v\n", "No Checksum:", cfg.NoChecksum)
-		fmt.Printf("  %-20s %s\n", "Upload Directory:", cfg.UploadDir)
+		return configShow(args[1:])
 
 	case "edit":
 		editor := os.Getenv("EDITOR")
@@ -85,6 +70,81 @@ func Config(args []string) error {
 	return nil
 }
 
+// configFlags returns the flags of warp config show, which warp config help
+// documents
+func configFlags() (*flag.FlagSet, *bool) {
+	fs := newFlagSet(configDoc)
+	fs.Init("config show", flagErrorHandling)
+	origin := fs.Bool("origin", false, "with show, tag each value with where it came from")
+	return fs, origin
+}
+
+// configShow prints the loaded configuration. With --origin each value is
+// tagged with where it came from; flags are per command and always win.
+func configShow(args []string) error {
+	fs, origin := configFlags()
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return errors.ConfigError("Failed to load configuration", err)
+	}
+	rows := []struct {
+		key, label, value string
+	}{
+		{"default_interface", "Default Interface:", cfg.DefaultInterface},
+		{"default_port", "Default Port:", strconv.Itoa(cfg.DefaultPort)},
+		{"buffer_size", "Buffer Size:", fmt.Sprintf("%d bytes", cfg.BufferSize)},
+		{"max_upload_size", "Max Upload Size:", fmt.Sprintf("%d GB", cfg.MaxUploadSize/(1024*1024*1024))},
+		{"rate_limit_mbps", "Rate Limit:", uipkg.FormatSpeedPref(cfg.RateLimitMbps*1e6/8, uipkg.SpeedBits)},
+		{"cache_size_mb", "Cache Size:", fmt.Sprintf("%d MB", cfg.CacheSizeMB)},
+		{"chunk_size_mb", "Chunk Size:", fmt.Sprintf("%d MB", cfg.ChunkSizeMB)},
+		{"parallel_workers", "Parallel Workers:", strconv.Itoa(cfg.ParallelWorkers)},
+		{"no_qr", "No QR Code:", strconv.FormatBool(cfg.NoQR)},
+		{"no_checksum", "No Checksum:", strconv.FormatBool(cfg.NoChecksum)},
+		{"upload_dir", "Upload Directory:", cfg.UploadDir},
+		{"stdin_spill_mb", "Stdin Spill:", fmt.Sprintf("%d MB", cfg.StdinSpillMB)},
+		{"temp_dir", "Temp Directory:", cfg.TempDir},
+		{"sync_policy", "Sync Policy:", cfg.SyncPolicy},
+		{"preallocate", "Preallocate:", cfg.Preallocate},
+		{"discovery", "Discovery:", cfg.Discovery},
+		{"allow_ips", "Allowed IPs:", strings.Join(cfg.AllowIPs, ", ")},
+		{"deny_ips", "Denied IPs:", strings.Join(cfg.DenyIPs, ", ")},
+		{"low_memory", "Low Memory:", strconv.FormatBool(cfg.LowMemory)},
+		{"notifications", "Notifications:", strconv.FormatBool(cfg.Notifications)},
+		{"quic", "QUIC:", cfg.QUIC},
+		{"brotli", "Brotli:", strconv.FormatBool(cfg.Brotli)},
+		{"max_chunks", "Max Chunks:", strconv.Itoa(cfg.MaxChunks)},
+		{"max_chunk_size_mb", "Max Chunk Size:", fmt.Sprintf("%d MB", cfg.MaxChunkSizeMB)},
+		{"session_idle_minutes", "Session Idle:", fmt.Sprintf("%d min", cfg.SessionIdleMin)},
+		{"language", "Language:", cfg.Language},
+		{"speed_units", "Speed Units:", cfg.SpeedUnits},
+		{"upload_page", "Upload Page:", cfg.UploadPage},
+	}
+
+	fmt.Println(ui.C.Bold + "Current Configuration:" + ui.C.Reset)
+	fmt.Printf("  Config file: %s\n", config.GetConfigPath())
+	fmt.Println()
+	for _, row := range rows {
+		if !*origin {
+			fmt.Printf("  %-20s %s\n", row.label, row.value)
+			continue
+		}
+		source := string(cfg.Origin(row.key))
+		if cfg.Origin(row.key) == config.OriginEnv {
+			source += " " + config.EnvVar(row.key)
+		}
+		fmt.Printf("  %-20s %s %s(%s)%s\n", row.label, row.value, ui.C.Dim, source, ui.C.Reset)
+	}
+	if *origin {
+		fmt.Println()
+		fmt.Println(ui.C.Dim + "Command-line flags override every source above." + ui.C.Reset)
+	}
+	return nil
+}
+
 func configInit() error {
 	configPath := config.GetConfigPath()
 
@@ -231,37 +291,73 @@ func promptYesNo(prompt string, defaultValue bool) bool {
 }
 
 func configHelp() {
-	fmt.Println(ui.C.Bold + ui.C.Green + "warp config" + ui.C.Reset + " - Manage configuration file")
-	fmt.Println()
-	fmt.Println(ui.C.Bold + "Usage:" + ui.C.Reset)
-	fmt.Println("  " + ui.C.Green + "warp config init" + ui.C.Reset + "  Initialize configuration interactively")
-	fmt.Println("  " + ui.C.Green + "warp config show" + ui.C.Reset + "  Display current configuration")
-	fmt.Println("  " + ui.C.Green + "warp config edit" + ui.C.Reset + "  Open config file in $EDITOR")
-	fmt.Println("  " + ui.C.Green + "warp config path" + ui.C.Reset + "  Show config file path")
-	fmt.Println()
-	fmt.Println(ui.C.Bold + "Configuration File:" + ui.C.Reset)
-	fmt.Println("  Location: ~/.config/warp/warp.yaml")
-	fmt.Println("  Format:   YAML")
-	fmt.Println()
-	fmt.Println(ui.C.Bold + "Available Settings:" + ui.C.Reset)
-	fmt.Println("  " + ui.C.Yellow + "default_interface" + ui.C.Reset + "  Network interface to bind to")
-	fmt.Println("  " + ui.C.Yellow + "default_port" + ui.C.Reset + "       Port to use (0 = random)")
-	fmt.Println("  " + ui.C.Yellow + "buffer_size" + ui.C.Reset + "        I/O buffer size in bytes")
-	fmt.Println("  " + ui.C.Yellow + "max_upload_size" + ui.C.Reset + "    Maximum upload size in bytes")
-	fmt.Println("  " + ui.C.Yellow + "rate_limit_mbps" + ui.C.Reset + "    Bandwidth limit in Mbps")
-	fmt.Println("  " + ui.C.Yellow + "cache_size_mb" + ui.C.Reset + "      File cache size in MB")
-	fmt.Println("  " + ui.C.Yellow + "chunk_size_mb" + ui.C.Reset + "      Chunk size for parallel uploads")
-	fmt.Println("  " + ui.C.Yellow + "parallel_workers" + ui.C.Reset + "   Number of parallel upload workers")
-	fmt.Println("  " + ui.C.Yellow + "no_qr" + ui.C.Reset + "              Skip QR code display")
-	fmt.Println("  " + ui.C.Yellow + "no_checksum" + ui.C.Reset + "        Skip SHA256 verification")
-	fmt.Println("  " + ui.C.Yellow + "upload_dir" + ui.C.Reset + "         Default upload directory")
-	fmt.Println()
-	fmt.Println(ui.C.Bold + "Examples:" + ui.C.Reset)
-	fmt.Println("  " + ui.C.Green + "warp config init" + ui.C.Reset + "              " + ui.C.Dim + "# Create config interactively" + ui.C.Reset)
-	fmt.Println("  " + ui.C.Green + "warp config show" + ui.C.Reset + "              " + ui.C.Dim + "# View current settings" + ui.C.Reset)
-	fmt.Println("  " + ui.C.Green + "warp config edit" + ui.C.Reset + "              " + ui.C.Dim + "# Edit configuration" + ui.C.Reset)
-	fmt.Println("  " + ui.C.Green + "warp config path" + ui.C.Reset + "              " + ui.C.Dim + "# Show config location" + ui.C.Reset)
-	fmt.Println()
-	fmt.Println(ui.C.Dim + "Configuration values can also be set via environment variables:" + ui.C.Reset)
-	fmt.Println(ui.C.Dim + "  WARP_RATE_LIMIT_MBPS=10 warp send file.zip" + ui.C.Reset)
+	fs, _ := configFlags()
+	showHelp(configDoc, fs)
+}
+
+var configDoc = &cli.Command{
+	Name:    "config",
+	Summary: "Manage configuration file",
+	Usage: []string{
+		"<init|edit|path>",
+		"show [--origin]",
+	},
+	Sections: []cli.Section{
+		{
+			Title: "Commands",
+			Items: []cli.Item{
+				{Term: "init", Text: "Initialize configuration interactively"},
+				{Term: "show", Text: "Display current configuration"},
+				{Term: "edit", Text: "Open config file in $EDITOR"},
+				{Term: "path", Text: "Show config file path"},
+			},
+		},
+		{
+			Title: "Configuration File",
+			Lines: []string{
+				"Location: ~/.config/warp/warp.yaml",
+				"Format:   YAML",
+			},
+		},
+		{
+			Title: "Available Settings",
+			Items: []cli.Item{
+				{Term: "default_interface", Text: "Network interface to bind to"},
+				{Term: "default_port", Text: "Port to use (0 = random)"},
+				{Term: "buffer_size", Text: "I/O buffer size in bytes"},
+				{Term: "max_upload_size", Text: "Maximum upload size in bytes"},
+				{Term: "rate_limit_mbps", Text: "Bandwidth limit in Mbps"},
+				{Term: "cache_size_mb", Text: "File cache size in MB"},
+				{Term: "chunk_size_mb", Text: "Chunk size for parallel uploads"},
+				{Term: "parallel_workers", Text: "Number of parallel upload workers"},
+				{Term: "no_qr", Text: "Skip QR code display"},
+				{Term: "no_checksum", Text: "Skip SHA256 verification"},
+				{Term: "upload_dir", Text: "Default upload directory"},
+				{Term: "preallocate", Text: "Size chunked uploads up front: off, sparse or full (fallocate)"},
+				{Term: "low_memory", Text: "Small buffers, no cache or compression (auto below 1GB RAM)"},
+				{Term: "notifications", Text: "Desktop notification when a receive or host upload finishes"},
+				{Term: "quic", Text: "HTTP/3 listener: off, auto (TCP port) or a UDP port"},
+				{Term: "brotli", Text: "Offer brotli to browsers downloading a share (false on weak CPUs)"},
+				{Term: "max_chunks", Text: "Most chunks a host accepts for one upload"},
+				{Term: "max_chunk_size_mb", Text: "Largest chunk a host accepts, in MB"},
+				{Term: "session_idle_minutes", Text: "Minutes before a host drops an idle upload session"},
+				{Term: "language", Text: "Language of messages, e.g. id; WARP_LANG and then LANG otherwise"},
+				{Term: "speed_units", Text: "Show speeds as bits (688.0 Mbps) or bytes (82.0 MiB/s)"},
+				{Term: "upload_page", Text: "HTML template served as the host upload page; empty = built in"},
+			},
+		},
+	},
+	Examples: []cli.Example{
+		{Command: "warp config init", Comment: "Create config interactively"},
+		{Command: "warp config show", Comment: "View current settings"},
+		{Command: "warp config show --origin", Comment: "See which come from file, env or defaults"},
+		{Command: "warp config edit", Comment: "Edit configuration"},
+		{Command: "warp config path", Comment: "Show config location"},
+	},
+	Notes: []string{
+		"Every setting can also be set via WARP_<SETTING> environment variables:",
+		"  WARP_RATE_LIMIT_MBPS=10 warp send file.zip",
+		"  WARP_ALLOW_IPS=10.0.0.0/8,192.168.1.5 warp host",
+		"Precedence: flags > environment > config file > defaults",
+	},
 }
@@ -0,0 +1,94 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/zulfikawr/warp/cmd/warp/ui"
+	"github.com/zulfikawr/warp/internal/cli"
+	"github.com/zulfikawr/warp/internal/config"
+	"github.com/zulfikawr/warp/internal/doctor"
+	"github.com/zulfikawr/warp/internal/network"
+)
+
+// Doctor executes the doctor command
+func Doctor(g cli.GlobalOptions, args []string) error {
+	cfg, cfgErr := config.LoadConfig()
+	configResult := doctor.CheckConfig(cfg, cfgErr)
+	if cfg == nil {
+		cfg = config.DefaultConfig()
+	}
+
+	fs := newFlagSet(doctorDoc)
+	iface := fs.String("interface", cfg.DefaultInterface, "network interface to check")
+	fs.StringVar(iface, "i", cfg.DefaultInterface, "")
+	port := fs.Int("port", cfg.DefaultPort, "port to test binding (0 = random)")
+	fs.IntVar(port, "p", cfg.DefaultPort, "")
+	dest := fs.String("dest", cfg.UploadDir, "upload directory to check")
+	fs.StringVar(dest, "d", cfg.UploadDir, "")
+	timeout := fs.Duration("timeout", 2*time.Second, "mDNS loopback timeout")
+	if err := fs.Parse(args); err != nil {
+		return fmt.Errorf("failed to parse flags: %w", err)
+	}
+
+	fmt.Println(ui.C.Bold + "Running warp diagnostics..." + ui.C.Reset)
+	fmt.Println()
+
+	ctx := context.Background()
+	results := []doctor.Result{doctor.CheckInterface(*iface)}
+	ip, _ := network.DiscoverLANIP(*iface)
+	results = append(results,
+		doctor.CheckMDNS(ctx, ip, *timeout),
+		doctor.CheckPortBind(*port),
+	)
+	if fs.NArg() > 0 {
+		results = append(results, doctor.CheckPeer(ctx, nil, fs.Arg(0)))
+	}
+	results = append(results, doctor.CheckDiskSpace(*dest), configResult)
+
+	for _, r := range results {
+		printDoctorResult(r)
+	}
+
+	fmt.Println()
+	if doctor.Failed(results) {
+		return fmt.Errorf("one or more checks failed")
+	}
+	fmt.Println(ui.C.Green + "✓ All checks passed" + ui.C.Reset)
+	return nil
+}
+
+func printDoctorResult(r doctor.Result) {
+	var mark string
+	switch r.Status {
+	case doctor.Pass:
+		mark = ui.C.Green + "✓ pass" + ui.C.Reset
+	case doctor.Warn:
+		mark = ui.C.Yellow + "! warn" + ui.C.Reset
+	default:
+		mark = ui.C.Red + "✗ fail" + ui.C.Reset
+	}
+	fmt.Printf("  %s  %-18s %s\n", mark, r.Name, r.Detail)
+	if r.Status != doctor.Pass {
+		for _, s := range r.Suggestions {
+			fmt.Printf("           %s• %s%s\n", ui.C.Dim, s, ui.C.Reset)
+		}
+	}
+}
+
+var doctorDoc = &cli.Command{
+	Name:    "doctor",
+	Summary: "Diagnose network and environment problems",
+	Usage:   []string{"[flags] [url]"},
+	Description: []string{
+		"Check LAN address discovery, mDNS multicast, port binding, disk space and",
+		"the config file. With a URL, also probe that peer's /health endpoint and",
+		"measure a 1MB throughput sample. Exits non-zero if any check fails.",
+		"Defaults come from the config file.",
+	},
+	Examples: []cli.Example{
+		{Command: "warp doctor", Comment: "Check this machine"},
+		{Command: "warp doctor http://192.168.1.5:41234/d/<token>", Comment: "Also probe a peer"},
+	},
+}
@@ -0,0 +1,112 @@
+package commands
+
+import (
+	stderrors "errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/zulfikawr/warp/cmd/warp/ui"
+	"github.com/zulfikawr/warp/internal/cli"
+	"github.com/zulfikawr/warp/internal/errors"
+)
+
+// verboseFlag documents -v, which cli.Preparse takes out before the
+// FlagSet sees the arguments
+var verboseFlag = cli.Flag{Names: []string{"v", "verbose"}, Usage: "verbose logging (repeat, e.g. -vv, for more detail)"}
+
+// flagErrorHandling is how command FlagSets fail. Tests parse -h with
+// ContinueOnError so they can look at the FlagSet.
+var flagErrorHandling = flag.ExitOnError
+
+// showHelp draws a command's help when its flags are parsed with -h.
+// warp help --man swaps in the man page.
+var showHelp = func(doc *cli.Command, fs *flag.FlagSet) {
+	_ = doc.Render(os.Stdout, fs, helpStyle())
+}
+
+// helpStyle draws help in the terminal colors, plain with --no-color
+func helpStyle() cli.Style {
+	return cli.Style{Bold: ui.C.Bold, Dim: ui.C.Dim, Green: ui.C.Green, Yellow: ui.C.Yellow, Reset: ui.C.Reset}
+}
+
+// newFlagSet returns a FlagSet for the command doc describes, which shows
+// doc with the FlagSet's own flags on -h
+func newFlagSet(doc *cli.Command) *flag.FlagSet {
+	fs := flag.NewFlagSet(doc.Name, flagErrorHandling)
+	fs.Usage = func() { showHelp(doc, fs) }
+	return fs
+}
+
+// helpTopic is a command warp help can show. Each command builds its
+// FlagSet when it runs, so its help is shown by running it with -h.
+type helpTopic struct {
+	doc *cli.Command
+	run func(cli.GlobalOptions, []string) error
+}
+
+var helpTopics = []helpTopic{
+	{sendDoc, Send},
+	{hostDoc, Host},
+	{receiveDoc, Receive},
+	{pushDoc, Push},
+	{searchDoc, Search},
+	{speedtestDoc, Speedtest},
+	{stopDoc, Stop},
+	{topDoc, Top},
+	{pingDoc, Ping},
+	{verifyDoc, Verify},
+	{relayDoc, Relay},
+	{doctorDoc, Doctor},
+	{configDoc, Config},
+}
+
+var helpDoc = &cli.Command{
+	Name:    "help",
+	Summary: "Show the help of a command",
+	Usage:   []string{"[--man] <command>"},
+	Description: []string{
+		"Show the same help as \"warp <command> -h\". With --man, write it as a",
+		"troff man page instead, e.g. to install as warp-send(1).",
+	},
+	Examples: []cli.Example{
+		{Command: "warp help send"},
+		{Command: "warp help --man send | man -l -", Comment: "Read it as a man page"},
+		{Command: "warp help --man host > /usr/local/share/man/man1/warp-host.1"},
+	},
+}
+
+// Help executes the help command
+func Help(g cli.GlobalOptions, args []string) error {
+	fs := newFlagSet(helpDoc)
+	man := fs.Bool("man", false, "write troff for man(1) instead of terminal help")
+	if err := fs.Parse(args); err != nil {
+		return fmt.Errorf("failed to parse flags: %w", err)
+	}
+	if fs.NArg() == 0 {
+		if *man {
+			return errors.NewUserError("--man needs a command", []string{"Example: warp help --man send"}, nil)
+		}
+		ui.PrintUsage()
+		return nil
+	}
+
+	name := fs.Arg(0)
+	names := make([]string, len(helpTopics))
+	for i, topic := range helpTopics {
+		names[i] = topic.doc.Name
+		if topic.doc.Name != name {
+			continue
+		}
+		if *man {
+			showHelp = func(doc *cli.Command, fs *flag.FlagSet) { _ = doc.Man(os.Stdout, fs) }
+		}
+		if err := topic.run(g, []string{"-h"}); !stderrors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return nil
+	}
+	return errors.NewUserError(fmt.Sprintf("Unknown command %q", name),
+		[]string{"Commands: " + strings.Join(names, ", ")}, nil)
+}
@@ -0,0 +1,97 @@
+package commands
+
+import (
+	stderrors "errors"
+	"flag"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/zulfikawr/warp/internal/cli"
+	"github.com/zulfikawr/warp/internal/errors"
+)
+
+// docFlag matches a flag named in prose, e.g. "--origin" or "[-o", but not
+// the hyphens inside words such as 7-apple-velocity
+var docFlag = regexp.MustCompile(`(?:^|[\s\[(])--?([a-z][a-z0-9-]*)`)
+
+// helpOf runs topic with -h and returns the doc and FlagSet it showed
+func helpOf(t *testing.T, topic helpTopic) (*cli.Command, *flag.FlagSet) {
+	t.Helper()
+	var doc *cli.Command
+	var fs *flag.FlagSet
+	showHelp = func(d *cli.Command, f *flag.FlagSet) { doc, fs = d, f }
+	if err := topic.run(cli.GlobalOptions{}, []string{"-h"}); err != nil && !stderrors.Is(err, flag.ErrHelp) {
+		t.Fatalf("%s -h: %v", topic.doc.Name, err)
+	}
+	if doc != topic.doc || fs == nil {
+		t.Fatalf("%s -h did not show its help", topic.doc.Name)
+	}
+	return doc, fs
+}
+
+// docText is the prose of doc that may name flags
+func docText(doc *cli.Command) []string {
+	text := append([]string{}, doc.Usage...)
+	text = append(text, doc.Description...)
+	for _, s := range doc.Sections {
+		for _, it := range s.Items {
+			text = append(text, it.Term, it.Text)
+		}
+		text = append(text, s.Lines...)
+	}
+	for _, ex := range doc.Examples {
+		text = append(text, ex.Command, ex.Comment)
+	}
+	return append(text, doc.Notes...)
+}
+
+func TestHelpMatchesFlags(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	oldShow, oldHandling := showHelp, flagErrorHandling
+	defer func() { showHelp, flagErrorHandling = oldShow, oldHandling }()
+	flagErrorHandling = flag.ContinueOnError
+
+	for _, topic := range helpTopics {
+		t.Run(topic.doc.Name, func(t *testing.T) {
+			doc, fs := helpOf(t, topic)
+
+			known := map[string]bool{"h": true, "help": true}
+			fs.VisitAll(func(f *flag.Flag) { known[f.Name] = true })
+			for _, f := range doc.Extra {
+				for _, name := range f.Names {
+					if fs.Lookup(name) != nil {
+						t.Errorf("extra flag -%s is also in the FlagSet", name)
+					}
+					known[name] = true
+				}
+			}
+			for _, line := range docText(doc) {
+				for _, m := range docFlag.FindAllStringSubmatch(line, -1) {
+					if !known[m[1]] {
+						t.Errorf("help names %q, which %s does not accept: %q", m[1], doc.Title(), line)
+					}
+				}
+			}
+
+			listed := make(map[string]bool)
+			for _, f := range doc.Flags(fs) {
+				for _, name := range f.Names {
+					listed[name] = true
+				}
+			}
+			fs.VisitAll(func(f *flag.Flag) {
+				if !listed[f.Name] {
+					t.Errorf("flag -%s is accepted but not documented", f.Name)
+				}
+			})
+		})
+	}
+}
+
+func TestHelpUnknownCommand(t *testing.T) {
+	err := Help(cli.GlobalOptions{}, []string{"sned"})
+	if !errors.IsUserError(err) || !strings.Contains(err.Error(), "sned") {
+		t.Fatalf("Help(sned) = %v, want a user error naming it", err)
+	}
+}
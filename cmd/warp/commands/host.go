@@ -4,120 +4,316 @@ import (
 	"flag"
 	"fmt"
 	"os"
-	"os/signal"
-	"syscall"
+	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/zulfikawr/warp/cmd/warp/ui"
+	"github.com/zulfikawr/warp/internal/cli"
 	"github.com/zulfikawr/warp/internal/config"
 	"github.com/zulfikawr/warp/internal/crypto"
 	"github.com/zulfikawr/warp/internal/errors"
-	"github.com/zulfikawr/warp/internal/logging"
+	"github.com/zulfikawr/warp/internal/notify"
+	"github.com/zulfikawr/warp/internal/protocol"
 	"github.com/zulfikawr/warp/internal/server"
 	uipkg "github.com/zulfikawr/warp/internal/ui"
 )
 
 // Host executes the host command
-func Host(args []string) error {
+func Host(g cli.GlobalOptions, args []string) error {
 	// Load configuration (config file → env vars)
 	cfg, err := config.LoadConfig()
 	if err != nil {
 		return errors.ConfigError("Failed to load configuration", err)
 	}
 
-	// Count -v flags and filter them out
-	verbosity, filteredArgs := countVerbosity(args)
-
-	fs := flag.NewFlagSet("host", flag.ExitOnError)
-	fs.Usage = hostHelp
+	fs := newFlagSet(hostDoc)
 	// Use config defaults for flags (config → env → flags precedence)
-	iface := fs.String("interface", cfg.DefaultInterface, "network interface")
+	iface := fs.String("interface", cfg.DefaultInterface, "bind to a specific network interface")
 	fs.StringVar(iface, "i", cfg.DefaultInterface, "")
 	dest := fs.String("dest", cfg.UploadDir, "destination directory for uploads")
 	fs.StringVar(dest, "d", cfg.UploadDir, "")
-	noQR := fs.Bool("no-qr", cfg.NoQR, "disable QR")
-	rateLimit := fs.Float64("rate-limit", cfg.RateLimitMbps, "bandwidth limit in Mbps")
-	if err := fs.Parse(filteredArgs); err != nil {
+	destMode := fs.String("dest-mode", "0755", "octal permissions of directories created for uploads")
+	destUnique := fs.Bool("dest-unique", false, "upload into a new <dest>/warp-<token6>/ directory")
+	noQR := fs.Bool("no-qr", cfg.NoQR, "skip printing the QR code")
+	qrInvert := fs.Bool("qr-invert", false, "draw the QR code for a light terminal background")
+	rateLimit := fs.Float64("rate-limit", cfg.RateLimitMbps, "limit upload bandwidth in Mbps (0 = unlimited)")
+	maxTransfers := fs.Int("max-transfers", 0, "max concurrent uploads; extra clients get 503 + Retry-After")
+	quotaPerIP := fs.String("quota-per-ip", "", "bytes each client may upload per --quota-reset, e.g. 10GB; then 429")
+	quotaReset := fs.Duration("quota-reset", server.DefaultQuotaReset, "how often --quota-per-ip usage starts over")
+	preserve := fs.Bool("preserve", false, "keep modification time and mode sent by CLI uploaders")
+	allowAppend := fs.Bool("allow-append", false, "let uploads with X-Append: true (warp push --append) extend an existing file")
+	noSplice := fs.Bool("no-splice", false, "copy raw uploads through a buffer instead of splicing them from the socket to disk (Linux)")
+	asyncVerify := fs.Bool("async-verify", false, "verify full-file checksums in the background (202 + polling)")
+	syncPolicy := fs.String("sync-policy", cfg.SyncPolicy, "fsync uploads: file (before success), chunk (every chunk) or none")
+	scanCmd := fs.String("scan-cmd", "", "run this command on each upload before keeping it; {path} is the file, non-zero exit quarantines it")
+	scanTimeout := fs.Duration("scan-timeout", server.DefaultScanTimeout, "kill a --scan-cmd run that takes longer and quarantine the file")
+	organize := fs.String("organize", "none", "file uploads under <dest>/YYYY-MM-DD/ (date) or <dest>/<client-ip>/ (sender)")
+	progress := fs.String("progress", "auto", "progress display: auto, bar, plain (a line every 5s) or none")
+	basicAuth := fs.String("basic-auth", "", "require HTTP Basic auth (user:pass); browsers prompt for it")
+	discoveryMode := fs.String("discovery", cfg.Discovery, "announce via mdns, broadcast (UDP 8829) or both")
+	short := fs.Bool("short", false, "also serve a short /s/<alias> URL, rate limited per client")
+	quicMode := fs.String("quic", cfg.QUIC, "HTTP/3 listener: off, auto (same port as TCP) or a UDP port")
+	allowIPs := newStringList(cfg.AllowIPs)
+	fs.Var(allowIPs, "allow-ip", "only serve clients in this CIDR or IP (repeatable)")
+	denyIPs := newStringList(cfg.DenyIPs)
+	fs.Var(denyIPs, "deny-ip", "refuse clients in this CIDR or IP (repeatable; wins over --allow-ip)")
+	trustProxy := fs.Bool("trust-proxy", false, "take the client IP from X-Forwarded-For (only behind a reverse proxy)")
+	trustProxyCIDRs := newStringList(nil)
+	fs.Var(trustProxyCIDRs, "trust-proxy-cidr", "take the client IP from X-Forwarded-For only when the connection comes from this CIDR or IP (repeatable)")
+	maxFileSize := fs.Int64("max-file-size", 0, "reject uploads larger than this many MB (0 = no limit)")
+	allowExt := fs.String("allow-ext", "", "only accept these extensions, comma-separated (e.g. jpg,png)")
+	lowMemory := fs.Bool("low-memory", cfg.LowMemory, "small buffers, no compression, one upload worker (auto below 1GB RAM)")
+	notifyDone := fs.Bool("notify", cfg.Notifications, "desktop notification when an upload finishes or fails")
+	expect := newStringList(nil)
+	fs.Var(expect, "expect", "wait for an upload with this name or glob (repeatable)")
+	expectCount := fs.Int("expect-count", 0, "wait for this many matching uploads")
+	completionFile := fs.String("completion-file", "", "write the matching uploads with checksums to this JSON file")
+	pageTemplate := fs.String("page-template", cfg.UploadPage, "serve this HTML template as the upload page instead of the built-in one")
+	exitWhenComplete := fs.Bool("exit-when-complete", false, "stop once the --expect/--expect-count uploads have arrived")
+	if err := fs.Parse(args); err != nil {
 		return fmt.Errorf("failed to parse flags: %w", err)
 	}
 
-	// Set log level based on verbosity
-	if verbosity > 0 {
-		logging.SetLevel(verbosity)
-	}
-
-	// Ensure destination exists
-	if err := os.MkdirAll(*dest, 0o755); err != nil {
-		return errors.PermissionError("create directory", *dest, err)
+	dirMode, err := parseDirMode(*destMode)
+	if err != nil {
+		return err
 	}
-
 	tok, err := crypto.GenerateToken(nil)
 	if err != nil {
 		return fmt.Errorf("failed to generate token: %w", err)
 	}
+	if *destUnique {
+		*dest = filepath.Join(*dest, "warp-"+tok[:6])
+	}
+	if abs, err := filepath.Abs(*dest); err == nil {
+		*dest = abs
+	}
+	// Fail now, not on the first upload, when the destination can't be written
+	if err := server.PrepareUploadDir(*dest, dirMode); err != nil {
+		return errors.PermissionError("write uploads to", *dest, err)
+	}
+
 	srv := &server.Server{
 		InterfaceName: *iface,
 		Token:         tok,
 		HostMode:      true,
 		UploadDir:     *dest,
+		DirMode:       dirMode,
 	}
 
 	// Apply optional configurations
 	srv.RateLimitMbps = *rateLimit
+	srv.MaxTransfers = *maxTransfers
+	if srv.QuotaPerIP, err = parseQuota(*quotaPerIP, *quotaReset); err != nil {
+		return err
+	}
+	srv.QuotaReset = *quotaReset
+	srv.PreserveAttrs = *preserve
+	srv.AsyncVerify = *asyncVerify
+	srv.NoSplice = *noSplice
+	if srv.SyncPolicy, err = server.ParseSyncPolicy(*syncPolicy); err != nil {
+		return errors.NewUserError(err.Error(), []string{"Use --sync-policy file to fsync each upload before reporting success"}, nil)
+	}
+	if srv.Preallocation, err = server.ParsePreallocation(cfg.Preallocate); err != nil {
+		return errors.ConfigError("Invalid preallocate setting", err)
+	}
+	if srv.ScanCmd, err = server.ParseScanCmd(*scanCmd); err != nil {
+		return errors.NewUserError(err.Error(), []string{"Install the scanner or give its full path, e.g. --scan-cmd \"clamscan --no-summary {path}\""}, nil)
+	}
+	if *allowAppend && len(srv.ScanCmd) > 0 {
+		return errors.NewUserError("--allow-append can't be used with --scan-cmd",
+			[]string{"A scan checks whole files, not the pieces appended to them"}, nil)
+	}
+	srv.AllowAppend = *allowAppend
+	if *scanTimeout <= 0 {
+		return errors.NewUserError("--scan-timeout must be positive", []string{"Use --scan-timeout 2m to give each scan two minutes"}, nil)
+	}
+	srv.ScanTimeout = *scanTimeout
+	if srv.Organize, err = server.ParseOrganize(*organize); err != nil {
+		return errors.NewUserError(err.Error(), []string{"Use --organize date to keep one directory per day"}, nil)
+	}
+	srv.Limits = uploadLimits(cfg)
+	srv.MaxFileSize = *maxFileSize << 20
+	if *allowExt != "" {
+		srv.AllowedExtensions = protocol.NormalizeExtensions(strings.Split(*allowExt, ","))
+	}
+	if srv.Renderer, err = progressRenderer(os.Stdout, g.JSON, *progress); err != nil {
+		return err
+	}
+	if srv.BasicAuthUser, srv.BasicAuthPassword, err = parseBasicAuth(*basicAuth); err != nil {
+		return err
+	}
+	if srv.Discovery, err = parseDiscovery(*discoveryMode); err != nil {
+		return err
+	}
+	if srv.QUIC, err = parseQUIC(*quicMode); err != nil {
+		return err
+	}
+	if srv.AllowIPs, srv.DenyIPs, err = parseIPFilter(allowIPs, denyIPs); err != nil {
+		return err
+	}
+	if *pageTemplate != "" {
+		if srv.UploadPage, err = server.LoadPageTemplate(*pageTemplate); err != nil {
+			return errors.NewUserError("Invalid --page-template "+*pageTemplate,
+				[]string{"The page must use {{.UploadPath}} as the upload target and show {{.MaxSize}}", "Fix the line named in the technical details"}, err)
+		}
+	}
+	srv.TrustProxy = *trustProxy
+	if srv.TrustedProxies, err = server.ParseIPList(trustProxyCIDRs.values); err != nil {
+		return errors.NewUserError("Invalid --trust-proxy-cidr value",
+			[]string{"Use the proxy's address or range, e.g. --trust-proxy-cidr 10.0.0.0/8"}, err)
+	}
+	srv.ShortAlias = *short
+	srv.LowMemory = lowMemoryMode(fs, *lowMemory, cfg, "upload workers advertised 1")
 
-	url, err := srv.Start()
+	if *notifyDone {
+		go notifyUploads(srv.Events(), notify.New())
+	}
+	watch, err := parseCompletion(fs, expect, *expectCount, *completionFile, *exitWhenComplete, *dest)
 	if err != nil {
-		return fmt.Errorf("failed to start server: %w", err)
+		return err
+	}
+	var complete chan struct{}
+	if watch != nil {
+		complete = make(chan struct{})
+		srv.OnUpload = watch.Queue
+		go watch.Watch(complete)
 	}
-	defer func() { _ = srv.Shutdown() }()
 
-	fmt.Fprintf(os.Stderr, "Hosting uploads to '%s'\n", *dest)
-	fmt.Fprintf(os.Stderr, "Token: %s\n", tok)
-	if *rateLimit > 0 {
-		fmt.Fprintf(os.Stderr, "Rate limit: %.1f Mbps\n", *rateLimit)
+	show := func(url string) (stop func()) {
+		fmt.Fprintf(os.Stderr, "Hosting uploads to '%s'\n", *dest)
+		fmt.Fprintf(os.Stderr, "Token: %s\n", tok)
+		if *rateLimit > 0 {
+			fmt.Fprintf(os.Stderr, "Rate limit: %s\n", uipkg.FormatSpeed(*rateLimit*1e6/8))
+		}
+		fmt.Fprintf(os.Stderr, "Features: Parallel chunks, SHA256 verification, WebSocket progress\n")
+		if len(srv.ScanCmd) > 0 {
+			fmt.Fprintf(os.Stderr, "Scanning uploads: %s %s(failures go to %s)%s\n", strings.Join(srv.ScanCmd, " "), ui.C.Dim, server.QuarantineDir, ui.C.Reset)
+		}
+		fmt.Fprintf(os.Stderr, "Stop secret: %s %s(warp stop --secret <secret> <url>)%s\n", srv.ManagementSecret, ui.C.Dim, ui.C.Reset)
+
+		if !*noQR {
+			fmt.Fprintln(os.Stderr)
+			fmt.Fprintln(os.Stderr, ui.C.Bold+"Scan QR code to upload from mobile:"+ui.C.Reset)
+			_ = uipkg.PrintQRTo(os.Stdout, url, qrOptions(*qrInvert))
+			if shortURL := srv.ShortURL(); shortURL != "" {
+				fmt.Fprintln(os.Stderr)
+				fmt.Fprintln(os.Stderr, ui.C.Bold+"Or the short URL:"+ui.C.Reset)
+				_ = uipkg.PrintQRTo(os.Stdout, shortURL, qrOptions(*qrInvert))
+			}
+			fmt.Fprintln(os.Stderr)
+			fmt.Fprintln(os.Stderr, ui.C.Dim+"Tip: Drag and drop files in the browser"+ui.C.Reset)
+		}
+
+		fmt.Fprintf(os.Stderr, "\n"+ui.C.Green+"Open this on another device to upload:"+ui.C.Reset+"\n%s\n", url)
+		if shortURL := srv.ShortURL(); shortURL != "" {
+			fmt.Fprintf(os.Stderr, "%s %s(short, rate limited)%s\n", shortURL, ui.C.Dim, ui.C.Reset)
+		}
+		fmt.Fprintf(os.Stderr, "\n"+ui.C.Bold+"Or from a terminal:"+ui.C.Reset+"\n%s\n", curlUpload(url, srv.BasicAuthUser))
+		return nil
+	}
+	opts := runOptions{Started: show}
+	if *exitWhenComplete {
+		opts.Exit = afterGrace(complete, completionGrace)
 	}
-	fmt.Fprintf(os.Stderr, "Features: Parallel chunks, SHA256 verification, WebSocket progress\n")
+	_, err = runServer(srv, opts)
+	return err
+}
 
-	if !*noQR {
-		fmt.Fprintln(os.Stderr)
-		fmt.Fprintln(os.Stderr, ui.C.Bold+"Scan QR code to upload from mobile:"+ui.C.Reset)
-		_ = uipkg.PrintQR(url)
-		fmt.Fprintln(os.Stderr)
-		fmt.Fprintln(os.Stderr, ui.C.Dim+"Tip: Drag and drop files in the browser"+ui.C.Reset)
+// curlUpload is the one-liner that PUTs a file to the share at url; curl
+// appends the file's name to a URL ending in a slash
+func curlUpload(url, user string) string {
+	if user != "" {
+		return fmt.Sprintf("curl -u %s -T <file> %s/", user, url)
 	}
+	return fmt.Sprintf("curl -T <file> %s/", url)
+}
 
-	fmt.Fprintf(os.Stderr, "\n"+ui.C.Green+"Open this on another device to upload:"+ui.C.Reset+"\n%s\n", url)
+// parseCompletion validates --expect, --expect-count, --completion-file and
+// --exit-when-complete. It returns nil when none of them asks for a watcher.
+func parseCompletion(fs *flag.FlagSet, expect *stringList, count int, path string, exit bool, dest string) (*server.CompletionFile, error) {
+	expected := len(expect.values) > 0 || flagSet(fs, "expect-count")
+	if !expected {
+		if path != "" || exit {
+			return nil, errors.NewUserError("--completion-file and --exit-when-complete need something to wait for",
+				[]string{"Add --expect report.pdf or --expect-count 2"}, nil)
+		}
+		return nil, nil
+	}
+	e := server.Expectation{Names: expect.values, Count: count}
+	if err := e.Validate(); err != nil {
+		return nil, errors.NewUserError("Invalid expectation: "+err.Error(),
+			[]string{"Use --expect '*.pdf' to wait for any PDF, or --expect-count 2 for two uploads"}, nil)
+	}
+	if path != "" {
+		if abs, err := filepath.Abs(path); err == nil {
+			path = abs
+		}
+	}
+	return &server.CompletionFile{Path: path, Expect: e, UploadDir: dest}, nil
+}
+
+// completionGrace keeps a host serving after the expected uploads arrived,
+// for the uploaders' closing session-status and verification requests
+const completionGrace = 2 * time.Second
 
-	// Wait for interrupt signal for graceful shutdown
-	sigCh := make(chan os.Signal, 1)
-	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
-	<-sigCh
-	fmt.Println("\nShutting down gracefully...")
+// afterGrace returns a channel closed grace after complete is
+func afterGrace(complete <-chan struct{}, grace time.Duration) <-chan struct{} {
+	exit := make(chan struct{})
+	go func() {
+		<-complete
+		time.Sleep(grace)
+		close(exit)
+	}()
+	return exit
+}
 
-	return nil
+// notifyUploads shows a desktop notification for every upload that finishes
+// or fails, until events is closed. Each runs on its own, so a slow
+// notification daemon never holds up the events behind it.
+func notifyUploads(events <-chan server.Event, n *notify.Notifier) {
+	for ev := range events {
+		if ev.Direction != protocol.DirectionUpload {
+			continue
+		}
+		switch ev.Type {
+		case server.EventTransferCompleted:
+			go n.Completed(ev.Filename, max(ev.Bytes, ev.Total), ev.Duration)
+		case server.EventTransferFailed:
+			go n.Failed(ev.Filename, ev.Err)
+		}
+	}
 }
 
-func hostHelp() {
-	fmt.Println(ui.C.Bold + ui.C.Green + "warp host" + ui.C.Reset + " - Receive uploads into a directory you control")
-	fmt.Println()
-	fmt.Println(ui.C.Bold + "Usage:" + ui.C.Reset)
-	fmt.Println("  " + ui.C.Green + "warp host" + ui.C.Reset + " [flags]")
-	fmt.Println()
-	fmt.Println(ui.C.Bold + "Description:" + ui.C.Reset)
-	fmt.Println("  Start an upload server and receive files from other devices.")
-	fmt.Println("  Uploaded files are saved to the specified directory.")
-	fmt.Println()
-	fmt.Println(ui.C.Bold + "Flags:" + ui.C.Reset)
-	fmt.Println("  " + ui.C.Yellow + "-i, --interface" + ui.C.Reset + "   bind to a specific network interface")
-	fmt.Println("  " + ui.C.Yellow + "-d, --dest" + ui.C.Reset + "        destination directory for uploads (default: .)")
-	fmt.Println("  " + ui.C.Yellow + "--rate-limit" + ui.C.Reset + "      limit upload bandwidth in Mbps (0 = unlimited)")
-	fmt.Println("  " + ui.C.Yellow + "--no-qr" + ui.C.Reset + "           skip printing the QR code")
-	fmt.Println("  " + ui.C.Yellow + "--no-encrypt" + ui.C.Reset + "      disable encryption (not recommended)")
-	fmt.Println("  " + ui.C.Yellow + "-v, --verbose" + ui.C.Reset + "     verbose logging (use -vv or -vvv for more detail)")
-	fmt.Println()
-	fmt.Println(ui.C.Bold + "Examples:" + ui.C.Reset)
-	fmt.Println("  " + ui.C.Green + "warp host" + ui.C.Reset + "                                " + ui.C.Dim + "# Accept uploads to current directory (encrypted)" + ui.C.Reset)
-	fmt.Println("  " + ui.C.Green + "warp host" + ui.C.Reset + " -d ./uploads                   " + ui.C.Dim + "# Save uploads to ./uploads (encrypted)" + ui.C.Reset)
-	fmt.Println("  " + ui.C.Green + "warp host" + ui.C.Reset + " -d ./downloads -i eth0         " + ui.C.Dim + "# Bind to specific interface (encrypted)" + ui.C.Reset)
-	fmt.Println("  " + ui.C.Green + "warp host" + ui.C.Reset + " --rate-limit 50 -d ./uploads   " + ui.C.Dim + "# Limit to 50 Mbps (encrypted)" + ui.C.Reset)
-	fmt.Println("  " + ui.C.Green + "warp host" + ui.C.Reset + " --no-encrypt -d ./public       " + ui.C.Dim + "# Unencrypted uploads" + ui.C.Reset)
+var hostDoc = &cli.Command{
+	Name:    "host",
+	Summary: "Receive uploads into a directory you control",
+	Usage:   []string{"[flags]"},
+	Description: []string{
+		"Start an upload server and receive files from other devices.",
+		"Uploaded files are saved to the specified directory.",
+		"Progress is a live display on a terminal and a line every 5 seconds otherwise.",
+		"With --quota-per-ip, a device that has uploaded that much gets 429 until usage resets.",
+		"Use --qr-invert if the QR code doesn't scan on a light terminal background.",
+		"--expect and --expect-count wait for uploads by name, glob or number; --completion-file",
+		"lists the matching uploads with their SHA256 as JSON, rewritten after each one.",
+		"--allow-append lets 'warp push' add to the end of an existing file, e.g. to ship logs.",
+		"--page-template replaces the upload page with an html/template file of your own; it",
+		"must use {{.UploadPath}} and {{.MaxSize}}, and is checked before the server starts.",
+		"Without warp, 'curl -T <file> <url>/' PUTs a file under its own name.",
+	},
+	Extra: []cli.Flag{verboseFlag, {Names: []string{"json"}, Usage: "print upload progress as JSON lines on stdout"}},
+	Examples: []cli.Example{
+		{Command: "warp host", Comment: "Accept uploads to current directory"},
+		{Command: "warp host -d ./uploads", Comment: "Save uploads to ./uploads"},
+		{Command: "warp host -d ./downloads -i eth0", Comment: "Bind to specific interface"},
+		{Command: "warp host --rate-limit 50 -d ./uploads", Comment: "Limit to 50 Mbps"},
+		{Command: "warp host -d /srv/drop --quota-per-ip 10GB", Comment: "At most 10 GB per device per day"},
+		{Command: "warp host -d /srv/drop --dest-mode 0700 --dest-unique", Comment: "Private directory per session"},
+		{Command: `warp host -d /srv/drop --scan-cmd "clamdscan {path}"`, Comment: "Scan uploads before keeping them"},
+		{Command: "warp host --expect '*.bin' --expect-count 2 --completion-file /tmp/done.json --exit-when-complete", Comment: "Stop once two .bin files arrived"},
+		{Command: "warp host -d /var/log/remote --allow-append", Comment: "Collect logs sent by warp push"},
+		{Command: "warp host --page-template ./dropbox.html", Comment: "Serve a branded upload page"},
+	},
 }
@@ -0,0 +1,212 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/zulfikawr/warp/cmd/warp/ui"
+	"github.com/zulfikawr/warp/internal/cli"
+	"github.com/zulfikawr/warp/internal/client"
+	"github.com/zulfikawr/warp/internal/protocol"
+)
+
+// quicCheckTimeout bounds the UDP path check of a server that offers QUIC
+const quicCheckTimeout = time.Second
+
+// skewWarning is the clock difference worth pointing out; beyond it logs and
+// file timestamps on the two machines stop lining up
+const skewWarning = 2 * time.Second
+
+// pingJSON is the --json summary; durations are in milliseconds
+type pingJSON struct {
+	URL       string  `json:"url"`
+	Sent      int     `json:"sent"`
+	Received  int     `json:"received"`
+	MinMs     float64 `json:"min_ms"`
+	AvgMs     float64 `json:"avg_ms"`
+	MaxMs     float64 `json:"max_ms"`
+	SkewMs    float64 `json:"skew_ms"`
+	Version   string  `json:"version,omitempty"`
+	Mode      string  `json:"mode,omitempty"`
+	Encrypted bool    `json:"encrypted"`
+	PAKE      bool    `json:"pake"`
+	Transport string  `json:"transport"`
+	QUICPath  string  `json:"quic_path,omitempty"` // ok, fragmented or no reply; absent when QUIC isn't offered
+	Warning   string  `json:"warning,omitempty"`
+}
+
+// Ping executes the ping command
+func Ping(g cli.GlobalOptions, args []string) error {
+	fs := newFlagSet(pingDoc)
+	count := fs.Int("count", 5, "number of probes")
+	interval := fs.Duration("interval", time.Second, "time between probes")
+	if err := fs.Parse(args); err != nil {
+		return fmt.Errorf("failed to parse flags: %w", err)
+	}
+
+	if fs.NArg() < 1 {
+		fs.Usage()
+		return fmt.Errorf("share URL or host:port required")
+	}
+	if *count <= 0 {
+		return fmt.Errorf("--count must be positive, got %d", *count)
+	}
+	if *interval < 0 {
+		return fmt.Errorf("--interval cannot be negative, got %s", *interval)
+	}
+
+	p, err := client.NewPinger(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var onProbe func(int, *client.PingReply, error)
+	if !g.JSON {
+		fmt.Printf("%sPinging %s%s\n", ui.C.Cyan, p.URL(), ui.C.Reset)
+		onProbe = func(seq int, reply *client.PingReply, err error) {
+			if err != nil {
+				fmt.Printf("  %d: %s%v%s\n", seq, ui.C.Red, err, ui.C.Reset)
+				return
+			}
+			fmt.Printf("  %d: %s\n", seq, formatLatency(reply.RTT))
+		}
+	}
+	res, err := p.Run(ctx, *count, *interval, onProbe)
+	if err != nil {
+		return err
+	}
+	checkCtx, cancel := context.WithTimeout(ctx, quicCheckTimeout)
+	defer cancel()
+	choice, checkErr := client.SelectTransport(checkCtx, p.Host(), res.QUICPort)
+
+	if g.JSON {
+		out := pingJSON{
+			URL:       res.URL,
+			Sent:      res.Sent,
+			Received:  res.Received,
+			MinMs:     durationMs(res.Min),
+			AvgMs:     durationMs(res.Avg),
+			MaxMs:     durationMs(res.Max),
+			SkewMs:    durationMs(res.Skew),
+			Transport: string(choice.Transport),
+			Warning:   choice.Warning,
+		}
+		if res.QUICPort > 0 && checkErr == nil {
+			out.QUICPath = choice.Path.Verdict.String()
+		}
+		if h := res.Health; h != nil {
+			out.Version, out.Mode, out.Encrypted, out.PAKE = h.Version, h.Mode, h.Encrypted, h.PAKE
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(out)
+	}
+	printPingSummary(res)
+	printTransport(res, choice, checkErr)
+	return nil
+}
+
+// printTransport reports which transport suits the path to the server, and
+// warns when QUIC is offered but loses full-size packets on the way
+func printTransport(res *client.PingResult, choice client.TransportChoice, err error) {
+	label := ui.C.Bold + "Transport:" + ui.C.Reset
+	switch {
+	case res.QUICPort == 0:
+		fmt.Printf("%s TCP %s(server doesn't offer QUIC)%s\n", label, ui.C.Dim, ui.C.Reset)
+	case err != nil:
+		fmt.Printf("%s TCP %s(QUIC path check failed: %v)%s\n", label, ui.C.Dim, err, ui.C.Reset)
+	case choice.Transport == client.TransportQUIC:
+		fmt.Printf("%s %sQUIC%s on UDP %d, %d-byte datagrams pass\n", label, ui.C.Green, ui.C.Reset, res.QUICPort, choice.Path.Largest)
+	case choice.Warning != "":
+		fmt.Printf("%s TCP, QUIC on UDP %d only passes %d-byte datagrams\n", label, res.QUICPort, choice.Path.Largest)
+		fmt.Printf("           %s%s%s\n", ui.C.Yellow, choice.Warning, ui.C.Reset)
+	default:
+		fmt.Printf("%s TCP %s(QUIC on UDP %d did not answer)%s\n", label, ui.C.Dim, res.QUICPort, ui.C.Reset)
+	}
+}
+
+func printPingSummary(res *client.PingResult) {
+	fmt.Println()
+	loss := float64(res.Sent-res.Received) / float64(res.Sent) * 100
+	fmt.Printf("%sReplies:%s   %d of %d (%.0f%% loss)\n", ui.C.Bold, ui.C.Reset, res.Received, res.Sent, loss)
+	fmt.Printf("%sLatency:%s   min %s / avg %s / max %s\n", ui.C.Bold, ui.C.Reset,
+		formatLatency(res.Min), formatLatency(res.Avg), formatLatency(res.Max))
+
+	h := res.Health
+	if h.Version != "" {
+		fmt.Printf("%sServer:%s    warp %s, %s mode\n", ui.C.Bold, ui.C.Reset, h.Version, h.Mode)
+	}
+	if h.Time.IsZero() {
+		fmt.Printf("%sClock:%s     %sunknown (server predates warp ping)%s\n", ui.C.Bold, ui.C.Reset, ui.C.Dim, ui.C.Reset)
+	} else {
+		skew := res.Skew.Round(time.Millisecond)
+		color := ui.C.Green
+		if skew.Abs() >= skewWarning {
+			color = ui.C.Yellow
+		}
+		fmt.Printf("%sClock:%s     %s%s%s skew (server minus local)\n", ui.C.Bold, ui.C.Reset, color, formatSkew(skew), ui.C.Reset)
+	}
+	fmt.Printf("%sSecurity:%s  %s\n", ui.C.Bold, ui.C.Reset, securitySummary(h))
+}
+
+// securitySummary tells the user what the share will ask of them
+func securitySummary(h *protocol.Health) string {
+	switch {
+	case h.Version == "":
+		return "unknown (server predates warp ping)"
+	case h.Encrypted && h.PAKE:
+		return "password required, PAKE code accepted"
+	case h.Encrypted:
+		return "password required"
+	case h.PAKE:
+		return "PAKE code accepted"
+	default:
+		return "no password"
+	}
+}
+
+func formatLatency(d time.Duration) string {
+	if d < time.Millisecond {
+		return d.Round(time.Microsecond).String()
+	}
+	return d.Round(10 * time.Microsecond).String()
+}
+
+func formatSkew(d time.Duration) string {
+	if d >= 0 {
+		return "+" + d.String()
+	}
+	return d.String()
+}
+
+func durationMs(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+var pingDoc = &cli.Command{
+	Name:    "ping",
+	Summary: "Check that a warp server is reachable",
+	Usage:   []string{"[flags] <url|host:port>"},
+	Description: []string{
+		"Probe the /health endpoint of a 'warp send' or 'warp host' server a few",
+		"times and report min/avg/max latency, the server's version and mode, the",
+		"clock skew between the two machines and whether the share needs a password.",
+		"When the server offers QUIC, UDP probes of 1200, 1400 and 1472 bytes check",
+		"that full-size packets reach it; a path that fragments them (PPPoE, VPNs)",
+		"is reported with a warning and TCP is preferred.",
+		"A quick sanity check before a large transfer; exits non-zero when no probe",
+		"is answered. Use 'warp speedtest' to measure throughput.",
+	},
+	Extra: []cli.Flag{{Names: []string{"json"}, Usage: "print the summary as JSON"}},
+	Examples: []cli.Example{
+		{Command: "warp ping http://192.168.1.5:41234/d/<token>"},
+		{Command: "warp ping --count 20 --interval 200ms 192.168.1.5:41234"},
+	},
+}
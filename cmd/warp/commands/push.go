@@ -0,0 +1,243 @@
+package commands
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/zulfikawr/warp/cmd/warp/ui"
+	"github.com/zulfikawr/warp/internal/cli"
+	"github.com/zulfikawr/warp/internal/client"
+	"github.com/zulfikawr/warp/internal/config"
+	"github.com/zulfikawr/warp/internal/errors"
+	uipkg "github.com/zulfikawr/warp/internal/ui"
+)
+
+// Push executes the push command
+func Push(g cli.GlobalOptions, args []string) error {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return errors.ConfigError("Failed to load configuration", err)
+	}
+
+	fs := newFlagSet(pushDoc)
+	manifest := fs.String("manifest", "", "YAML or JSON file listing the files (required)")
+	fs.StringVar(manifest, "m", "", "")
+	result := fs.String("result", "", "write a JSON result with per-file status to this file")
+	failFast := fs.Bool("fail-fast", false, "stop at the first failed file and skip the rest")
+	progress := fs.String("progress", "auto", "progress display: auto, bar, plain (a line every 5s) or none")
+	parallel := fs.Int("parallel", cfg.ParallelWorkers, "chunk uploads in flight across all files")
+	chunkSizeMB := fs.Int("chunk-size", cfg.ChunkSizeMB, "chunk size in MB")
+	noChecksum := fs.Bool("no-checksum", cfg.NoChecksum, "don't ask the host to verify each file's SHA256")
+	startAt := fs.String("start-at", "", "start uploading at HH:MM (today, or tomorrow once it has passed)")
+	startIn := fs.String("start-in", "", "start uploading after a delay, e.g. 45m or 2h")
+	precompute := fs.Bool("precompute", false, "hash every file now and stop if one doesn't match the manifest")
+	appendMode := fs.Bool("append", false, "append each file's new bytes to the host's copy (host needs --allow-append)")
+	confirmSize := fs.String("confirm-size", "1GB", "ask before pushing more than this `size` in total; 0 never asks")
+	confirmFiles := fs.Int("confirm-files", 100, "ask before pushing more than this many files; 0 never asks")
+	yes := fs.Bool("yes", false, "push without asking, whatever the size")
+	fs.BoolVar(yes, "y", false, "")
+	if err := fs.Parse(args); err != nil {
+		return fmt.Errorf("failed to parse flags: %w", err)
+	}
+
+	if *manifest == "" || fs.NArg() < 1 {
+		fs.Usage()
+		return errors.NewUserError("warp push needs --manifest and an upload URL",
+			[]string{"Example: warp push --manifest files.yaml http://192.168.1.7:52314/u/<token>"}, nil)
+	}
+	if *parallel <= 0 {
+		return fmt.Errorf("--parallel must be positive, got %d", *parallel)
+	}
+	if *chunkSizeMB <= 0 {
+		return fmt.Errorf("--chunk-size must be positive, got %d", *chunkSizeMB)
+	}
+	if *confirmFiles < 0 {
+		return fmt.Errorf("--confirm-files cannot be negative, got %d", *confirmFiles)
+	}
+	mode, err := progressMode(*progress)
+	if err != nil {
+		return err
+	}
+	limits := pushLimits{files: *confirmFiles}
+	if *confirmSize != "0" {
+		if limits.size, err = uipkg.ParseBytes(*confirmSize); err != nil || limits.size < 0 {
+			return errors.NewUserError("--confirm-size must be a size such as 1GB or 500MiB, or 0", nil, err)
+		}
+	}
+	start, err := parseStart(*startAt, *startIn)
+	if err != nil {
+		return err
+	}
+	url, err := client.NormalizeUploadURL(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	m, err := client.LoadManifest(*manifest)
+	if err != nil {
+		return errors.NewUserError(err.Error(),
+			[]string{"Each entry needs a path; name and sha256 are optional"}, err)
+	}
+
+	upCfg := client.DefaultUploadConfig()
+	upCfg.ChunkSize = int64(*chunkSizeMB) * 1024 * 1024
+	upCfg.MaxConcurrent = *parallel
+	upCfg.Verify = !*noChecksum
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	p := &client.Pusher{URL: url, Manifest: m, Config: upCfg, Parallel: *parallel, FailFast: *failFast, Append: *appendMode, Out: os.Stderr, Progress: mode}
+	plan, err := p.Plan(ctx)
+	if err != nil {
+		return errors.NewUserError("Push not started: "+err.Error(), nil, err)
+	}
+	if err := confirmPush(plan, limits, *yes, uipkg.IsTerminal(os.Stdin), os.Stdin, os.Stderr); err != nil {
+		return err
+	}
+	if *precompute {
+		fmt.Fprintf(os.Stderr, "Hashing %d files...\n", len(m.Files))
+		if err := p.Precompute(); err != nil {
+			return errors.NewUserError("Push not started: "+err.Error(),
+				[]string{"Fix the files or their manifest checksums and run it again"}, err)
+		}
+	}
+	if !start.IsZero() {
+		if err := waitForStart(ctx, start); err != nil {
+			// Scripts waiting on --result learn that nothing was sent
+			if err := writePushResult(p.Skipped(), *result); err != nil {
+				return err
+			}
+			return errors.NewUserError("Push cancelled before the scheduled start", nil, err)
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "%sPushing %d files to %s%s\n", ui.C.Cyan, len(m.Files), url, ui.C.Reset)
+	res := p.Run(ctx)
+
+	fmt.Fprintf(os.Stderr, "\n%d ok, %d failed, %d skipped in %s\n", res.OK, res.Failed, res.Skipped,
+		uipkg.FormatDuration(time.Duration(res.DurationMS)*time.Millisecond))
+	if err := writePushResult(res, *result); err != nil {
+		return err
+	}
+	if err := res.Err(); err != nil {
+		return errors.NewUserError("Push incomplete: "+err.Error(), nil, err)
+	}
+	return nil
+}
+
+// writePushResult writes res to path for --result; an empty path writes
+// nothing
+func writePushResult(res *client.PushResult, path string) error {
+	if path == "" {
+		return nil
+	}
+	if err := res.WriteFile(path); err != nil {
+		return errors.PermissionError("write result", path, err)
+	}
+	return nil
+}
+
+// pushLimits are the sizes past which a push asks before it starts; 0
+// leaves a limit out
+type pushLimits struct {
+	size  int64
+	files int
+}
+
+// exceeded describes what of plan goes over the limits, such as "250
+// files", or returns ""
+func (l pushLimits) exceeded(plan *client.PushPlan) string {
+	var over []string
+	if l.files > 0 && plan.Files > l.files {
+		over = append(over, fmt.Sprintf("%d files", plan.Files))
+	}
+	if l.size > 0 && plan.TotalSize > l.size {
+		over = append(over, uipkg.FormatBytes(plan.TotalSize))
+	}
+	return strings.Join(over, " and ")
+}
+
+// confirmPush prints the summary of plan to out and, when the push goes over
+// limits, asks on in whether to go ahead, unless yes. Without a terminal to
+// ask on, such a push is refused.
+func confirmPush(plan *client.PushPlan, limits pushLimits, yes, interactive bool, in io.Reader, out io.Writer) error {
+	fmt.Fprintf(out, "%sPush summary%s\n", ui.C.Bold, ui.C.Reset)
+	fmt.Fprintf(out, "  Files:        %d\n", plan.Files)
+	fmt.Fprintf(out, "  Total size:   %s\n", uipkg.FormatBytes(plan.TotalSize))
+	fmt.Fprintf(out, "  Destination:  %s\n", plan.Host)
+	if plan.Estimate > 0 {
+		fmt.Fprintf(out, "  Estimated:    %s at the host's recent upload speed\n", uipkg.FormatEstimate(plan.Estimate))
+	}
+	if len(plan.Problems) > 0 {
+		fmt.Fprintf(out, "  %sWill fail:%s\n", ui.C.Yellow, ui.C.Reset)
+		for _, p := range plan.Problems {
+			fmt.Fprintf(out, "    %s✗ %s: %s%s\n", ui.C.Red, p.Name, p.Reason, ui.C.Reset)
+		}
+	}
+
+	over := limits.exceeded(plan)
+	if over == "" || yes {
+		return nil
+	}
+	if !interactive {
+		return errors.NewUserError(fmt.Sprintf("Push not started: it sends %s, and there is no terminal to confirm it", over),
+			[]string{"Pass --yes to push anyway", "Raise --confirm-size or --confirm-files if this size is expected"}, nil)
+	}
+	fmt.Fprintf(out, "This push sends %s. Start it? [%sy/N%s]: ", over, ui.C.Dim, ui.C.Reset)
+	scanner := bufio.NewScanner(in)
+	scanner.Scan()
+	if answer := strings.TrimSpace(strings.ToLower(scanner.Text())); answer != "y" && answer != "yes" {
+		return errors.NewUserError("Push cancelled", nil, nil)
+	}
+	return nil
+}
+
+var pushDoc = &cli.Command{
+	Name:    "push",
+	Summary: "Upload the files of a manifest to a warp host",
+	Usage:   []string{"--manifest <file> [flags] <upload-url>"},
+	Description: []string{
+		"Upload every file listed in a YAML or JSON manifest to a 'warp host'",
+		"server, several at a time, and check each against the checksum the host",
+		"computes. Entries may rename the file on the host and pin its SHA256; a",
+		"file that doesn't match its pinned checksum is not sent. Failures are",
+		"reported and the rest continue; the exit status is non-zero if any file",
+		"failed. Relative paths are taken from the manifest's directory.",
+		"",
+		"With --append each file is taken to grow, like a log: only the bytes the",
+		"host's copy doesn't have yet are sent and added to its end, so running",
+		"the same push again ships the new tail. The host must allow appending.",
+		"",
+		"A summary of the files, their total size, the host and an estimated",
+		"time is printed first, with any file the host's limits will reject. A",
+		"push of more than --confirm-size or --confirm-files asks before it",
+		"starts; without a terminal it is refused unless --yes is given.",
+		"",
+		"--progress shows each file's upload as it goes. With --parallel above 1,",
+		"auto prints plain lines rather than bars that would draw over each other.",
+	},
+	Sections: []cli.Section{{
+		Title: "Manifest",
+		Lines: []string{
+			"files:",
+			"  - path: dist/app-linux-amd64",
+			"    name: app-linux        # optional, defaults to the base name",
+			"    sha256: 9f86d08...     # optional, checked before sending",
+			"  - path: CHANGELOG.md",
+		},
+	}},
+	Examples: []cli.Example{
+		{Command: "warp push -m release.yaml http://192.168.1.7:52314/u/<token>"},
+		{Command: "warp push -m release.yaml --result push.json --fail-fast 192.168.1.7:52314/u/<token>"},
+		{Command: "warp push -m release.yaml --start-at 18:00 --precompute 192.168.1.7:52314/u/<token>"},
+		{Command: "warp push -m logs.yaml --append 192.168.1.7:52314/u/<token>"},
+		{Command: "warp push -m nightly.yaml --yes 192.168.1.7:52314/u/<token>", Comment: "In CI, where nobody can answer"},
+	},
+}
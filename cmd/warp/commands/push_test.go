@@ -0,0 +1,98 @@
+package commands
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zulfikawr/warp/internal/cli"
+	"github.com/zulfikawr/warp/internal/client"
+)
+
+// Commands take their flag defaults from LoadConfig, so a WARP_ variable
+// applies unless the flag is given. Push refuses a non-positive --parallel
+// before it reads the manifest, which shows the value it ended up with.
+func TestPushFlagsOverrideEnv(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	tests := []struct {
+		name string
+		env  string
+		args []string
+		want string
+	}{
+		{"flag over env", "4", []string{"--parallel", "0"}, "got 0"},
+		{"env without flag", "-2", nil, "got -2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("WARP_PARALLEL_WORKERS", tt.env)
+			args := append([]string{"--manifest", "files.yaml"}, tt.args...)
+			err := Push(cli.GlobalOptions{}, append(args, "http://192.168.1.7:52314/u/tok"))
+			if err == nil || !strings.Contains(err.Error(), "--parallel must be positive, "+tt.want) {
+				t.Errorf("err = %v, want --parallel %s", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfirmPush(t *testing.T) {
+	small := &client.PushPlan{Host: "192.168.1.5:8080", Files: 3, TotalSize: 1 << 20}
+	large := &client.PushPlan{
+		Host:      "192.168.1.5:8080",
+		Files:     250,
+		TotalSize: 3 << 30,
+		Estimate:  90 * time.Second,
+		Problems:  []client.PushProblem{{Name: "setup.exe", Reason: "file type .exe not allowed"}},
+	}
+	limits := pushLimits{size: 1e9, files: 100}
+
+	tests := []struct {
+		name        string
+		plan        *client.PushPlan
+		limits      pushLimits
+		yes         bool
+		interactive bool
+		stdin       string
+		ok          bool
+		asked       bool
+	}{
+		{"under the limits", small, limits, false, false, "", true, false},
+		{"limits off", large, pushLimits{}, false, false, "", true, false},
+		{"--yes", large, limits, true, false, "", true, false},
+		{"no terminal", large, limits, false, false, "y\n", false, false},
+		{"accepted", large, limits, false, true, "y\n", true, true},
+		{"accepted in full", large, limits, false, true, " Yes\n", true, true},
+		{"declined", large, limits, false, true, "n\n", false, true},
+		{"just enter", large, limits, false, true, "\n", false, true},
+		{"stdin closed", large, limits, false, true, "", false, true},
+	}
+	for _, tt := range tests {
+		var out bytes.Buffer
+		err := confirmPush(tt.plan, tt.limits, tt.yes, tt.interactive, strings.NewReader(tt.stdin), &out)
+		if (err == nil) != tt.ok {
+			t.Errorf("%s: err = %v, want ok %v", tt.name, err, tt.ok)
+		}
+		if asked := strings.Contains(out.String(), "Start it?"); asked != tt.asked {
+			t.Errorf("%s: asked = %v, want %v", tt.name, asked, tt.asked)
+		}
+		if !strings.Contains(out.String(), tt.plan.Host) {
+			t.Errorf("%s: summary has no destination:\n%s", tt.name, out.String())
+		}
+	}
+
+	if got := limits.exceeded(&client.PushPlan{Files: 100, TotalSize: 2e9}); got != "1.9 GiB" {
+		t.Errorf("exceeded = %q, want only the size", got)
+	}
+
+	var out bytes.Buffer
+	err := confirmPush(large, limits, false, false, nil, &out)
+	if err == nil || !strings.Contains(err.Error(), "it sends 250 files and 3.0 GiB") {
+		t.Errorf("refusal = %v, want it to name both limits", err)
+	}
+	for _, want := range []string{"Files:        250", "Total size:   3.0 GiB", "Estimated:", "setup.exe: file type .exe not allowed"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("summary lacks %q:\n%s", want, out.String())
+		}
+	}
+}
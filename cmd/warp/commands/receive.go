@@ -1,145 +1,488 @@
 package commands
 
 import (
+	"bufio"
 	"context"
-	"flag"
+	stderrors "errors"
 	"fmt"
+	"net"
+	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/zulfikawr/warp/cmd/warp/ui"
+	"github.com/zulfikawr/warp/internal/cli"
 	"github.com/zulfikawr/warp/internal/client"
 	"github.com/zulfikawr/warp/internal/config"
+	"github.com/zulfikawr/warp/internal/crypto"
 	"github.com/zulfikawr/warp/internal/discovery"
 	"github.com/zulfikawr/warp/internal/errors"
 	"github.com/zulfikawr/warp/internal/logging"
+	"github.com/zulfikawr/warp/internal/notify"
 	"github.com/zulfikawr/warp/internal/protocol"
+	"github.com/zulfikawr/warp/internal/relay"
+	uipkg "github.com/zulfikawr/warp/internal/ui"
 )
 
 // Receive executes the receive command
-func Receive(args []string) error {
+func Receive(g cli.GlobalOptions, args []string) error {
 	// Load configuration (config file → env vars)
 	cfg, err := config.LoadConfig()
 	if err != nil {
 		return errors.ConfigError("Failed to load configuration", err)
 	}
 
-	// Count -v flags and filter them out
-	verbosity, filteredArgs := countVerbosity(args)
-
-	fs := flag.NewFlagSet("receive", flag.ExitOnError)
-	fs.Usage = receiveHelp
-	out := fs.String("output", "", "output path")
+	fs := newFlagSet(receiveDoc)
+	out := fs.String("output", "", "write to a specific file or directory")
 	fs.StringVar(out, "o", "", "")
-	force := fs.Bool("force", false, "overwrite existing")
+	force := fs.Bool("force", false, "overwrite existing files without prompting")
 	fs.BoolVar(force, "f", false, "")
 	// Use config defaults for flags (config → env → flags precedence)
-	workers := fs.Int("workers", cfg.ParallelWorkers, "parallel upload workers")
-	chunkSizeMB := fs.Int("chunk-size", cfg.ChunkSizeMB, "chunk size in MB")
-	noChecksum := fs.Bool("no-checksum", cfg.NoChecksum, "skip checksum verification")
+	workers := fs.Int("workers", cfg.ParallelWorkers, "number of parallel workers; files fetched at once with --mirror")
+	chunkSizeMB := fs.Int("chunk-size", cfg.ChunkSizeMB, "chunk size in MB for parallel uploads")
+	noChecksum := fs.Bool("no-checksum", cfg.NoChecksum, "skip SHA256 checksum verification (faster)")
 	code := fs.String("code", "", "PAKE code for secure transfer")
 	fs.StringVar(code, "c", "", "")
-	if err := fs.Parse(filteredArgs); err != nil {
+	host := fs.String("host", "", "server host:port, used with a bare token argument")
+	token := fs.String("token", "", "transfer token, used with a bare host:port argument")
+	preserve := fs.Bool("preserve", true, "keep the sender's modification time and mode")
+	progress := fs.String("progress", "auto", "progress display: auto, bar, plain (a line every 5s) or none")
+	user := fs.String("user", "", "HTTP Basic auth user for servers started with --basic-auth")
+	password := fs.String("password", "", "HTTP Basic auth password")
+	directory := fs.String("directory", "", "keep receiving every discovered share into a directory")
+	codes := fs.Bool("codes", false, "with --directory, prompt for PAKE codes instead of auto-discovery")
+	extract := fs.Bool("extract", false, "unpack a received zip or tar.gz into --output (or a directory named after it)")
+	keepArchive := fs.Bool("keep-archive", false, "with --extract, keep the archive after unpacking")
+	mirror := fs.String("mirror", "", "fetch a shared directory file by file into this directory, skipping unchanged files")
+	follow := fs.Bool("follow", false, "stream a file the sender is still writing to stdout (or --output) until it stops")
+	discoveryMode := fs.String("discovery", cfg.Discovery, "find servers via mdns, broadcast or both (mDNS, then broadcast if empty)")
+	scan := fs.String("scan", "", "with broadcast discovery, also probe each host of a CIDR (e.g. 10.0.4.0/24)")
+	notifyDone := fs.Bool("notify", cfg.Notifications, "desktop notification when the download finishes or fails")
+	sha256 := fs.String("sha256", "", "`hex` SHA-256 the file must have, checked whatever the server sends")
+	sha256File := fs.String("sha256-file", "", "look the file's SHA-256 up in a sha256sum `file` (\"<hash>  <name>\" lines)")
+	keepOnMismatch := fs.Bool("keep-on-mismatch", false, "keep a file that fails its checksum instead of deleting it")
+	relayAddr := fs.String("relay", "", "reach the sender through this warp relay (host:port); needs --code")
+	yes := fs.Bool("yes", false, "don't ask whether the verification words match the sender's")
+	fs.BoolVar(yes, "y", false, "")
+	if err := fs.Parse(args); err != nil {
 		return fmt.Errorf("failed to parse flags: %w", err)
 	}
 
-	// Set log level based on verbosity
-	if verbosity > 0 {
-		logging.SetLevel(verbosity)
+	// With --json, stdout carries only progress events, and with --follow the
+	// streamed file; messages go to stderr
+	msgOut := os.Stdout
+	if g.JSON || (*follow && *out == "") {
+		msgOut = os.Stderr
 	}
 
 	var url string
 	var key []byte
-	if fs.NArg() > 0 {
-		url = fs.Arg(0)
+	var httpClient *http.Client
+	relayTo := ""
+	if *relayAddr != "" {
+		if fs.NArg() > 0 || *host != "" || *directory != "" || *mirror != "" {
+			return errors.NewUserError("--relay finds the sender by PAKE code and can't be combined with a URL, --host, --directory or --mirror",
+				[]string{"Example: warp receive --relay relay.example.com:9000 --code 3f9a0c21-7-apple-velocity"}, nil)
+		}
+		if relayTo, err = parseRelay(*relayAddr); err != nil {
+			return err
+		}
+		if *code == "" {
+			fmt.Fprint(msgOut, "Enter PAKE code: ")
+			fmt.Scanln(code)
+		}
+		nameplate, pakeCode, err := relay.SplitCode(*code)
+		if err != nil {
+			return errors.NewUserError("Invalid relay code",
+				[]string{"Type the whole code the sender shows next to 'Relay:', nameplate first, e.g. 3f9a0c21-7-apple-velocity"}, err)
+		}
+		*code = pakeCode
+		room := relay.Room(nameplate)
+		httpClient = client.NewRelayClient(func(ctx context.Context) (net.Conn, error) {
+			return relay.Dial(ctx, relayTo, room)
+		})
+	}
+	d := client.NewDownloader(httpClient)
+	d.Preserve = *preserve
+	if d.Renderer, err = progressRenderer(os.Stdout, g.JSON, *progress); err != nil {
+		return err
+	}
+	if *user != "" || *password != "" {
+		d.SetBasicAuth(*user, *password)
+	}
+	mode, err := parseDiscovery(*discoveryMode)
+	if err != nil {
+		return err
+	}
+	browseOpts := discovery.Options{Mode: mode, ScanCIDR: *scan}
+	if err := setExpectedChecksum(d, *sha256, *sha256File); err != nil {
+		return err
+	}
+	d.KeepOnMismatch = *keepOnMismatch
+	checksummed := *sha256 != "" || *sha256File != ""
+	if checksummed && (*directory != "" || *mirror != "" || *follow) {
+		return errors.NewUserError("--sha256 and --sha256-file check a single download and can't be combined with --directory, --mirror or --follow", nil, nil)
+	}
+
+	if *directory != "" {
+		if fs.NArg() > 0 || *host != "" || *out != "" || *code != "" || *extract {
+			return errors.NewUserError("--directory listens for shares and can't be combined with a URL, --output, --code or --extract",
+				[]string{"Use --codes to type PAKE codes one after another"}, nil)
+		}
+		return receiveBatch(d, *directory, *codes, !*yes, browseOpts, msgOut)
+	}
+	if *follow && (*mirror != "" || *extract) {
+		return errors.NewUserError("--follow streams one growing file and can't be combined with --mirror or --extract", nil, nil)
+	}
+	if *mirror != "" {
+		if fs.NArg() == 0 && *host == "" {
+			return errors.NewUserError("--mirror needs the URL of a directory share",
+				[]string{"Example: warp receive --mirror ./dest http://host:port/d/token",
+					"Shares found with a PAKE code are encrypted and only sent as a zip"}, nil)
+		}
+		if *out != "" || *extract {
+			return errors.NewUserError("--mirror writes into its own directory and can't be combined with --output or --extract", nil, nil)
+		}
+	}
+	if fs.NArg() > 0 || *host != "" {
+		url, err = client.NormalizeReceiveURL(fs.Arg(0), *host, *token)
+		if err != nil {
+			return err
+		}
 	} else {
 		pakeCode := *code
 		if pakeCode == "" {
-			fmt.Print("Enter PAKE code: ")
+			fmt.Fprint(msgOut, "Enter PAKE code: ")
 			fmt.Scanln(&pakeCode)
 		}
 		if pakeCode == "" {
 			return fmt.Errorf("receive requires a URL or a PAKE code")
 		}
-
-		fmt.Println("Searching for servers...")
-		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-		defer cancel()
-		services, err := discovery.Browse(ctx, 5*time.Second)
-		if err != nil {
-			return fmt.Errorf("failed to browse for servers: %w", err)
+		// connect confirms the verification words of a handshake with the
+		// sender at baseURL
+		connect := func(name, baseURL string, sharedKey []byte, token string) error {
+			fmt.Fprintf(msgOut, "Connected to %s\n", name)
+			if !confirmAuthString(msgOut, crypto.AuthString(sharedKey), *yes) {
+				return errors.NewUserError("Transfer cancelled: the verification words were not confirmed",
+					[]string{"Compare the words with the sender's screen; if they differ, someone may be intercepting the transfer",
+						"Use --yes to skip the question in scripts"}, nil)
+			}
+			url = baseURL + protocol.PathPrefix + token
+			key = sharedKey
+			return nil
 		}
 
-		d := client.NewDownloader(nil)
-		found := false
-		for _, s := range services {
-			if verbosity > 0 {
-				fmt.Printf("Found service: %s at %s:%d\n", s.Name, s.IP, s.Port)
-			}
-			baseURL := fmt.Sprintf("http://%s:%d", s.IP, s.Port)
+		if relayTo != "" {
+			fmt.Fprintf(msgOut, "Connecting through relay %s...\n", relayTo)
+			baseURL := relay.BaseURL(relayTo)
 			sharedKey, token, err := d.PerformPAKEHandshake(baseURL, pakeCode)
-			if err == nil {
-				// Found it!
-				fmt.Printf("Connected to %s\n", s.Name)
-				url = baseURL + protocol.PathPrefix + token
-				key = sharedKey
-				found = true
-				break
-			} else if verbosity > 0 {
-				fmt.Printf("PAKE handshake failed for %s: %v\n", baseURL, err)
+			if err != nil {
+				return errors.NewUserError("Failed to reach the sender through relay "+relayTo,
+					[]string{"Check that the sender runs 'warp send --relay " + relayTo + "'", "Check that the code is the one the sender shows"}, err)
+			}
+			if err := connect("sender via "+relayTo, baseURL, sharedKey, token); err != nil {
+				return err
+			}
+		} else {
+			fmt.Fprintln(msgOut, "Searching for servers...")
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			services, err := discovery.BrowseWith(ctx, 5*time.Second, browseOpts)
+			if err != nil {
+				return fmt.Errorf("failed to browse for servers: %w", err)
+			}
+
+			found := false
+			for _, s := range services {
+				if g.Verbosity > 0 {
+					fmt.Fprintf(msgOut, "Found service: %s at %s:%d\n", s.Name, s.IP, s.Port)
+				}
+				baseURL := fmt.Sprintf("http://%s:%d", s.IP, s.Port)
+				sharedKey, token, err := d.PerformPAKEHandshake(baseURL, pakeCode)
+				if err == nil {
+					// Found it!
+					if err := connect(s.Name, baseURL, sharedKey, token); err != nil {
+						return err
+					}
+					found = true
+					break
+				} else if g.Verbosity > 0 {
+					fmt.Fprintf(msgOut, "PAKE handshake failed for %s: %s\n", baseURL, logging.Redact(err.Error()))
+				}
+			}
+			if !found {
+				return fmt.Errorf("no server found with the provided code")
 			}
-		}
-		if !found {
-			return fmt.Errorf("no server found with the provided code")
 		}
 	}
 
-	if verbosity > 0 {
-		fmt.Printf("Configuration: workers=%d, chunk-size=%dMB, checksum=%v\n",
+	if g.Verbosity > 0 {
+		fmt.Fprintf(msgOut, "Configuration: workers=%d, chunk-size=%dMB, checksum=%v\n",
 			*workers, *chunkSizeMB, !*noChecksum)
 	}
 
+	// With --extract, --output names the extraction directory; the archive
+	// itself is saved under its own name
+	saveTo := *out
+	if *extract {
+		saveTo = ""
+	}
+
+	var notifier *notify.Notifier
+	if *notifyDone {
+		notifier = notify.New()
+	}
+	if *mirror != "" {
+		return receiveMirror(d, url, *mirror, *workers, notifier, msgOut)
+	}
+	if *follow {
+		return receiveFollow(d, url, *out, *force, key, msgOut)
+	}
+
 	// Note: Workers and chunk-size are for future client-side parallel downloads
 	// Currently used by server-side parallel uploads via HTML client
-	file, err := client.Receive(url, *out, *force, os.Stdout, key)
+	printEstimate(d, url, msgOut)
+	start := time.Now()
+	file, err := d.Receive(url, saveTo, *force, msgOut, key)
 	if err != nil {
-		return err // client.Receive already wraps errors appropriately
+		if stderrors.Is(err, client.ErrFollowed) {
+			err = errors.NewUserError("This share is a file the sender is still writing",
+				[]string{"Receive it with --follow to stream it like tail -f"}, err)
+		}
+		notifier.Failed(receiveName(saveTo, url), err)
+		return err // Receive already wraps errors appropriately
 	}
 	if file == "(stdout)" {
 		// Text was output to stdout, just print newline
 		fmt.Println()
+		return nil
+	}
+	if fi, err := os.Stat(file); err == nil {
+		notifier.Completed(filepath.Base(file), fi.Size(), time.Since(start))
 	}
 	// Removed redundant "Saved to" print since receiver.go now prints it
 
+	if *extract {
+		return extractReceived(d, file, *out, *force, *keepArchive, msgOut)
+	}
 	return nil
 }
 
-func receiveHelp() {
-	fmt.Println(ui.C.Bold + ui.C.Green + "warp receive" + ui.C.Reset + " - Download from a warp URL or PAKE code")
-	fmt.Println()
-	fmt.Println(ui.C.Bold + "Usage:" + ui.C.Reset)
-	fmt.Println("  " + ui.C.Green + "warp receive" + ui.C.Reset + " [flags] <url>")
-	fmt.Println("  " + ui.C.Green + "warp receive" + ui.C.Reset + " --code <code>")
-	fmt.Println()
-	fmt.Println(ui.C.Bold + "Description:" + ui.C.Reset)
-	fmt.Println("  Connect to a warp server and download the shared file or text.")
-	fmt.Println("  If no URL is provided, it will search for servers in the local network.")
-	fmt.Println("  Files are verified with SHA256 checksums automatically.")
-	fmt.Println("  Supports parallel chunk uploads for large files (configurable workers).")
-	fmt.Println("  Text content is printed to stdout by default.")
-	fmt.Println()
-	fmt.Println(ui.C.Bold + "Flags:" + ui.C.Reset)
-	fmt.Println("  " + ui.C.Yellow + "-c, --code" + ui.C.Reset + "        PAKE code for secure transfer")
-	fmt.Println("  " + ui.C.Yellow + "-o, --output" + ui.C.Reset + "      write to a specific file or directory")
-	fmt.Println("  " + ui.C.Yellow + "-f, --force" + ui.C.Reset + "       overwrite existing files without prompting")
-	fmt.Println("  " + ui.C.Yellow + "--workers" + ui.C.Reset + "         number of parallel upload workers (default: 3)")
-	fmt.Println("  " + ui.C.Yellow + "--chunk-size" + ui.C.Reset + "      chunk size in MB for parallel uploads (default: 2)")
-	fmt.Println("  " + ui.C.Yellow + "--no-checksum" + ui.C.Reset + "     skip SHA256 checksum verification (faster)")
-	fmt.Println("  " + ui.C.Yellow + "--decrypt" + ui.C.Reset + "         decrypt transfer with password (prompts if not provided)")
-	fmt.Println("  " + ui.C.Yellow + "-v, --verbose" + ui.C.Reset + "     verbose logging (use -vv or -vvv for more detail)")
-	fmt.Println()
-	fmt.Println(ui.C.Bold + "Examples:" + ui.C.Reset)
-	fmt.Println("  " + ui.C.Green + "warp receive" + ui.C.Reset + " --code 7-apple-velocity           " + ui.C.Dim + "# Secure transfer via code" + ui.C.Reset)
-	fmt.Println("  " + ui.C.Green + "warp receive" + ui.C.Reset + " http://host:port/d/token          " + ui.C.Dim + "# Download via URL" + ui.C.Reset)
-	fmt.Println("  " + ui.C.Green + "warp receive" + ui.C.Reset + " http://host:port/d/token -o file  " + ui.C.Dim + "# Save with custom name" + ui.C.Reset)
+// setExpectedChecksum gives d the checksum from --sha256 or --sha256-file
+func setExpectedChecksum(d *client.Downloader, digest, sumsFile string) error {
+	switch {
+	case digest != "" && sumsFile != "":
+		return errors.NewUserError("--sha256 and --sha256-file can't be used together", nil, nil)
+	case digest != "":
+		sum, err := client.ParseSHA256(digest)
+		if err != nil {
+			return errors.NewUserError("--sha256 must be a SHA-256 digest in hex",
+				[]string{"Copy the 64-character hash from the release page, or use --sha256-file"}, err)
+		}
+		d.SHA256 = sum
+	case sumsFile != "":
+		sums, err := client.LoadSHA256Sums(sumsFile)
+		if err != nil {
+			return errors.NewUserError("Failed to read the checksum file",
+				[]string{"It should hold sha256sum output: one \"<hash>  <name>\" line per file"}, err)
+		}
+		d.SHA256Sums = sums
+	}
+	return nil
+}
+
+// confirmAuthString shows the verification words of a PAKE handshake and,
+// unless skip is set, asks whether they match the sender's screen. Anything
+// but y/yes, including no input at all, is a no.
+func confirmAuthString(out *os.File, words string, skip bool) bool {
+	fmt.Fprintf(out, "Verification words: %s%s%s\n", ui.C.Bold, words, ui.C.Reset)
+	if skip {
+		return true
+	}
+	fmt.Fprintf(out, "Do they match the words on the sender's screen? [%sy/N%s]: ", ui.C.Dim, ui.C.Reset)
+	scanner := bufio.NewScanner(os.Stdin)
+	scanner.Scan()
+	input := strings.TrimSpace(strings.ToLower(scanner.Text()))
+	return input == "y" || input == "yes"
+}
+
+// printEstimate prints how long the download should take at the sender's
+// recent speeds, when the sender has seen any. It never delays the download
+// by more than a moment.
+func printEstimate(d *client.Downloader, url string, msgOut *os.File) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	caps, err := d.Info(ctx, url)
+	if err != nil || caps.EstimatedSeconds <= 0 {
+		return
+	}
+	est := time.Duration(caps.EstimatedSeconds) * time.Second
+	fmt.Fprintf(msgOut, "Estimated time: %s at recent speeds (approximate)\n", uipkg.FormatEstimate(est))
+}
+
+// receiveName names a failed download in its notification: the output path
+// if one was given, otherwise the URL
+func receiveName(output, url string) string {
+	if output != "" {
+		return filepath.Base(output)
+	}
+	return url
+}
+
+// extractReceived unpacks a received archive and removes it unless keep is set.
+// Files that aren't archives are left in place with a note.
+func extractReceived(d *client.Downloader, archive, dest string, force, keep bool, msgOut *os.File) error {
+	if _, err := d.Extract(archive, dest, force, msgOut); err != nil {
+		if stderrors.Is(err, client.ErrNotArchive) {
+			fmt.Fprintf(msgOut, "'%s' is not a zip or tar.gz archive; left as is\n", archive)
+			return nil
+		}
+		return fmt.Errorf("extraction failed (archive kept at %s): %w", archive, err)
+	}
+	if !keep {
+		if err := os.Remove(archive); err != nil {
+			return errors.PermissionError("remove archive", archive, err)
+		}
+	}
+	return nil
+}
+
+// receiveMirror mirrors the directory share at url into dir and lists the
+// files that failed, if any
+func receiveMirror(d *client.Downloader, url, dir string, workers int, notifier *notify.Notifier, msgOut *os.File) error {
+	start := time.Now()
+	results, err := d.Mirror(url, dir, workers, msgOut)
+	if stderrors.Is(err, client.ErrNoListing) {
+		err = errors.NewUserError("This share can't be mirrored", []string{
+			"--mirror works with directory shares without a password, from warp senders that list their files",
+			"Receive it without --mirror to download it as a zip"}, err)
+	}
+	if err != nil {
+		notifier.Failed(filepath.Base(dir), err)
+		return err
+	}
+
+	var failed []client.MirrorResult
+	var bytes int64
+	for _, r := range results {
+		if r.Err != nil {
+			failed = append(failed, r)
+		} else if !r.Skipped {
+			bytes += r.Size
+		}
+	}
+	if len(failed) > 0 {
+		fmt.Fprintf(msgOut, "\n%d of %d files failed:\n", len(failed), len(results))
+		for _, r := range failed {
+			fmt.Fprintf(msgOut, "  %s✗%s %s: %v\n", ui.C.Red, ui.C.Reset, r.Path, r.Err)
+		}
+		err := fmt.Errorf("mirror incomplete: %d of %d files failed", len(failed), len(results))
+		notifier.Failed(filepath.Base(dir), err)
+		return err
+	}
+	notifier.Completed(filepath.Base(dir), bytes, time.Since(start))
+	return nil
+}
+
+// receiveFollow streams a followed share to stdout, or to output, until the
+// sender stops or Ctrl+C
+func receiveFollow(d *client.Downloader, url, output string, force bool, key []byte, msgOut *os.File) error {
+	out := os.Stdout
+	if output != "" {
+		flags := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+		if force {
+			flags = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+		}
+		f, err := os.OpenFile(output, flags, 0o644)
+		if os.IsExist(err) {
+			return errors.NewUserError(fmt.Sprintf("File '%s' already exists", output),
+				[]string{"Use --force or -f to overwrite it"}, err)
+		}
+		if err != nil {
+			return errors.PermissionError("create file", output, err)
+		}
+		defer func() { _ = f.Close() }()
+		out = f
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	fmt.Fprintf(msgOut, "%sFollowing %s (Ctrl+C to stop)%s\n", ui.C.Dim, url, ui.C.Reset)
+	n, err := d.Follow(ctx, url, out, key)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(msgOut, "Stopped following after %s\n", uipkg.FormatBytes(n))
+	return nil
+}
+
+// receiveBatch keeps receiving shares into dir until interrupted
+func receiveBatch(d *client.Downloader, dir string, codes, confirm bool, opts discovery.Options, msgOut *os.File) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return errors.PermissionError("create directory", dir, err)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	b := client.NewBatchReceiver(d, dir, msgOut)
+	b.Progress = msgOut
+	b.Browse = func(ctx context.Context, timeout time.Duration) ([]discovery.Service, error) {
+		return discovery.BrowseWith(ctx, timeout, opts)
+	}
+	if codes {
+		b.ConfirmAuth = confirm
+		fmt.Fprintf(msgOut, "Receiving into '%s'; enter one PAKE code per share\n", dir)
+		return b.RunCodes(ctx, os.Stdin)
+	}
+	fmt.Fprintf(msgOut, "Receiving every share found on the network into '%s' (Ctrl+C to stop)\n", dir)
+	return b.Run(ctx)
+}
+
+var receiveDoc = &cli.Command{
+	Name:    "receive",
+	Summary: "Download from a warp URL or PAKE code",
+	Usage: []string{
+		"[flags] <url>",
+		"--code <code>",
+		"--directory <dir> [--codes]",
+		"--mirror <dir> <url>",
+	},
+	Description: []string{
+		"Connect to a warp server and download the shared file or text.",
+		"The URL may omit the http:// scheme and trailing slashes.",
+		"If no URL is provided, it will search for servers in the local network.",
+		"Files are verified with SHA256 checksums automatically.",
+		"Supports parallel chunk uploads for large files (configurable workers).",
+		"Text content is printed to stdout by default.",
+		"With --directory, keeps receiving shares until Ctrl+C; existing names get a (n) suffix.",
+		"With a PAKE code, shows verification words to compare with the sender's before downloading.",
+		"With --mirror, a shared directory is fetched file by file into <dir> instead of as a zip:",
+		"files already there with the same SHA256 are skipped, the rest verified and replaced.",
+		"Progress is a live bar on a terminal and a line every 5 seconds otherwise (pipes, CI logs).",
+		"With --follow, a file shared with 'warp send --follow' is streamed to stdout like tail -f.",
+		"With --sha256 or --sha256-file, the saved file must also match a checksum you supply,",
+		"whatever the server sends; a mismatch deletes it (unless --keep-on-mismatch) and exits with status 4.",
+		"With --relay, the sender is reached through a 'warp relay' instead of the local network;",
+		"it must have started with the same --relay, and --code is the relay code it",
+		"shows, a nameplate in front of the PAKE code.",
+	},
+	Extra: []cli.Flag{verboseFlag, {Names: []string{"json"}, Usage: "print progress as JSON lines on stdout (messages go to stderr)"}},
+	Examples: []cli.Example{
+		{Command: "warp receive --code 7-apple-velocity", Comment: "Secure transfer via code"},
+		{Command: "warp receive http://host:port/d/token", Comment: "Download via URL"},
+		{Command: "warp receive http://host:port/d/token -o file", Comment: "Save with custom name"},
+		{Command: "warp receive http://host:port/d/token --extract", Comment: "Unzip a shared directory"},
+		{Command: "warp receive --mirror ./dest http://host:port/d/token", Comment: "Sync a shared directory, no zip"},
+		{Command: "warp receive host:port/d/token", Comment: "Scheme is optional"},
+		{Command: "warp receive host:port --token token", Comment: "Host and token separately"},
+		{Command: "warp receive --directory ./inbox", Comment: "Keep receiving shares until Ctrl+C"},
+		{Command: "warp receive --progress none host:port/d/token", Comment: "Print only the final summary"},
+		{Command: "warp receive --follow host:port/d/token | grep ERROR", Comment: "Follow a growing log file"},
+		{Command: "warp receive --sha256-file SHA256SUMS host:port/d/token", Comment: "Check against a published checksum"},
+		{Command: "warp receive --relay relay.example.com:9000 --code 3f9a0c21-7-apple-velocity", Comment: "Receive through a relay"},
+	},
 }
@@ -0,0 +1,71 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/zulfikawr/warp/cmd/warp/ui"
+	"github.com/zulfikawr/warp/internal/cli"
+	"github.com/zulfikawr/warp/internal/errors"
+	"github.com/zulfikawr/warp/internal/relay"
+)
+
+// Relay executes the relay command
+func Relay(g cli.GlobalOptions, args []string) error {
+	fs := newFlagSet(relayDoc)
+	listen := fs.String("listen", fmt.Sprintf(":%d", relay.DefaultPort), "TCP address to accept senders and receivers on")
+	rateLimit := fs.Float64("rate-limit", 0, "limit each sender/receiver pair to this many Mbps (0 = unlimited)")
+	idleTimeout := fs.Duration("idle-timeout", relay.DefaultIdleTimeout, "close pairs and waiting senders with no traffic for this long")
+	pairTimeout := fs.Duration("pair-timeout", relay.DefaultPairTimeout, "how long a receiver waits for its sender")
+	if err := fs.Parse(args); err != nil {
+		return fmt.Errorf("failed to parse flags: %w", err)
+	}
+	if *rateLimit < 0 {
+		return errors.NewUserError("--rate-limit can't be negative", []string{"Use --rate-limit 0 for no limit"}, nil)
+	}
+	if *idleTimeout <= 0 || *pairTimeout <= 0 {
+		return errors.NewUserError("--idle-timeout and --pair-timeout must be positive", []string{"Example: --idle-timeout 10m --pair-timeout 1m"}, nil)
+	}
+
+	ln, err := net.Listen("tcp", *listen)
+	if err != nil {
+		return errors.NewUserError("Failed to listen on "+*listen, []string{"Choose another port with --listen, e.g. --listen :9001"}, err)
+	}
+	srv := &relay.Server{RateLimitMbps: *rateLimit, IdleTimeout: *idleTimeout, PairTimeout: *pairTimeout}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		_ = srv.Close()
+	}()
+
+	fmt.Fprintf(os.Stderr, "Relay listening on %s\n", ln.Addr())
+	fmt.Fprintf(os.Stderr, "%sSenders: warp send --relay <this-host>:%d <path>%s\n", ui.C.Dim, ln.Addr().(*net.TCPAddr).Port, ui.C.Reset)
+	fmt.Fprint(os.Stderr, "\n"+ui.C.Yellow+"Press Ctrl+C to stop the relay"+ui.C.Reset+"\n")
+	return srv.Serve(ln)
+}
+
+var relayDoc = &cli.Command{
+	Name:    "relay",
+	Summary: "Forward transfers between devices that can't reach each other",
+	Usage:   []string{"[flags]"},
+	Description: []string{
+		"Run a rendezvous server on a machine both devices can reach, for networks",
+		"such as isolated client VLANs that keep them apart. A sender pointed at the",
+		"relay waits here in a room derived from a random nameplate it shows in front",
+		"of its PAKE code; the receiver joins it with that code, and the relay forwards",
+		"bytes between them without learning the PAKE code. It stores",
+		"nothing, and transfers through it are always end-to-end encrypted, so it",
+		"can't read them. See 'warp help send' and 'warp help receive'.",
+	},
+	Extra: []cli.Flag{verboseFlag},
+	Examples: []cli.Example{
+		{Command: "warp relay", Comment: "Listen on port 9000"},
+		{Command: "warp relay --listen :9443 --rate-limit 100", Comment: "At most 100 Mbps per transfer"},
+		{Command: "warp relay --idle-timeout 1m", Comment: "Drop quiet pairs sooner"},
+	},
+}
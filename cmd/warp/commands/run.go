@@ -0,0 +1,144 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/zulfikawr/warp/cmd/warp/ui"
+	uipkg "github.com/zulfikawr/warp/internal/ui"
+)
+
+// Shutdown waits for transfers in flight at most drainTimeout, checking
+// every drainPollInterval
+const (
+	drainTimeout      = 30 * time.Second
+	drainPollInterval = 250 * time.Millisecond
+)
+
+// runnableServer is the part of *server.Server that runServer drives
+type runnableServer interface {
+	Start() (string, error)
+	Shutdown() error
+	Done() <-chan struct{}
+	ActiveTransfers() int
+}
+
+// runOptions tunes runServer. The zero value serves until SIGINT or SIGTERM
+// on the real clock.
+type runOptions struct {
+	// Started shows the server once it listens. The func it returns, if
+	// any, runs as soon as the server is told to stop.
+	Started     func(url string) (stop func())
+	ExpireAfter time.Duration   // Stop after this long; 0 = never
+	Exit        <-chan struct{} // Closed to stop, e.g. after a transfer
+
+	// Hooks for tests
+	Signals <-chan os.Signal                     // nil = SIGINT and SIGTERM
+	After   func(time.Duration) <-chan time.Time // nil = time.After
+	Out     io.Writer                            // Shutdown messages; nil = stderr
+}
+
+// stopReason says what ended runServer
+type stopReason int
+
+const (
+	stopSignal  stopReason = iota // SIGINT or SIGTERM
+	stopRemote                    // warp stop, through the stop endpoint
+	stopExpired                   // ExpireAfter passed
+	stopExit                      // Exit was closed
+)
+
+// runServer starts srv and serves until a signal, a remote stop, the expiry
+// or opts.Exit. Transfers in flight then get up to drainTimeout to finish, or
+// until a second signal, before srv shuts down. A remote stop has already
+// begun shutting down and isn't waited on. The error is Start's.
+func runServer(srv runnableServer, opts runOptions) (stopReason, error) {
+	out := opts.Out
+	if out == nil {
+		out = os.Stderr
+	}
+	after := opts.After
+	if after == nil {
+		after = time.After
+	}
+	signals := opts.Signals
+	if signals == nil {
+		ch := make(chan os.Signal, 2)
+		signal.Notify(ch, os.Interrupt, syscall.SIGTERM)
+		defer signal.Stop(ch)
+		signals = ch
+	}
+
+	url, err := srv.Start()
+	if err != nil {
+		return stopSignal, fmt.Errorf("failed to start server: %w", err)
+	}
+	defer func() { _ = srv.Shutdown() }()
+
+	var stopDisplay func()
+	if opts.Started != nil {
+		stopDisplay = opts.Started(url)
+	}
+	var expired <-chan time.Time
+	if opts.ExpireAfter > 0 {
+		expired = after(opts.ExpireAfter)
+	}
+
+	var reason stopReason
+	select {
+	case <-signals:
+		reason = stopSignal
+	case <-srv.Done():
+		reason = stopRemote
+	case <-expired:
+		reason = stopExpired
+	case <-opts.Exit:
+		reason = stopExit
+	}
+	if stopDisplay != nil {
+		stopDisplay()
+	}
+
+	switch reason {
+	case stopRemote:
+		fmt.Fprintln(out, "\nStopped remotely")
+		return reason, nil
+	case stopExpired:
+		fmt.Fprintf(out, "\nExpired after %s, shutting down...\n", uipkg.FormatDuration(opts.ExpireAfter))
+	case stopExit:
+		fmt.Fprintln(out, "\nDone, shutting down...")
+	default:
+		fmt.Fprintln(out, "\nShutting down gracefully...")
+	}
+	drainTransfers(srv, signals, after, out)
+	_ = srv.Shutdown()
+	return reason, nil
+}
+
+// drainTransfers waits for srv's transfers in flight to finish, at most
+// drainTimeout. Another signal, or a remote stop, ends the wait early.
+func drainTransfers(srv runnableServer, signals <-chan os.Signal, after func(time.Duration) <-chan time.Time, out io.Writer) {
+	n := srv.ActiveTransfers()
+	if n == 0 {
+		return
+	}
+	fmt.Fprintf(out, "Waiting for %d transfer(s) to finish %s(Ctrl+C again to stop now)%s\n", n, ui.C.Dim, ui.C.Reset)
+	deadline := after(drainTimeout)
+	for srv.ActiveTransfers() > 0 {
+		select {
+		case <-signals:
+			fmt.Fprintln(out, "Stopping without waiting")
+			return
+		case <-srv.Done():
+			return
+		case <-deadline:
+			fmt.Fprintf(out, "Transfers still running after %s, stopping anyway\n", drainTimeout)
+			return
+		case <-after(drainPollInterval):
+		}
+	}
+}
@@ -0,0 +1,297 @@
+package commands
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeServer records the calls runServer makes
+type fakeServer struct {
+	mu       sync.Mutex
+	calls    []string
+	active   int
+	done     chan struct{}
+	startErr error
+}
+
+func newFakeServer(active int) *fakeServer {
+	return &fakeServer{active: active, done: make(chan struct{})}
+}
+
+func (f *fakeServer) record(call string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, call)
+}
+
+func (f *fakeServer) Start() (string, error) {
+	f.record("start")
+	return "http://192.168.1.7:52314/d/token", f.startErr
+}
+
+func (f *fakeServer) Shutdown() error {
+	f.record("shutdown")
+	return nil
+}
+
+func (f *fakeServer) Done() <-chan struct{} { return f.done }
+
+func (f *fakeServer) ActiveTransfers() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.active
+}
+
+func (f *fakeServer) setActive(n int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.active = n
+}
+
+// recorded returns the calls so far, the repeated Shutdown of the deferred
+// cleanup folded into one
+func (f *fakeServer) recorded() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return slices.Compact(slices.Clone(f.calls))
+}
+
+// timerRequest is one call to the fake clock's After
+type timerRequest struct {
+	d  time.Duration
+	ch chan time.Time
+}
+
+// fakeClock hands every After call to the test, which fires the timers it
+// wants to. A call blocks until the test takes it, so the test always knows
+// what runServer is waiting for.
+type fakeClock struct{ requests chan timerRequest }
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{requests: make(chan timerRequest)}
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	ch := make(chan time.Time, 1)
+	c.requests <- timerRequest{d, ch}
+	return ch
+}
+
+// next returns the next timer runServer starts
+func (c *fakeClock) next(t *testing.T) timerRequest {
+	t.Helper()
+	select {
+	case req := <-c.requests:
+		return req
+	case <-time.After(5 * time.Second):
+		t.Fatal("runServer started no timer")
+		return timerRequest{}
+	}
+}
+
+// harness runs runServer in the background with fake signals and clock
+type harness struct {
+	srv     *fakeServer
+	clock   *fakeClock
+	signals chan os.Signal
+	exit    chan struct{}
+	out     bytes.Buffer
+	result  chan stopReason
+}
+
+func startHarness(t *testing.T, srv *fakeServer, expire time.Duration) *harness {
+	t.Helper()
+	h := &harness{
+		srv:     srv,
+		clock:   newFakeClock(),
+		signals: make(chan os.Signal, 2),
+		exit:    make(chan struct{}),
+		result:  make(chan stopReason, 1),
+	}
+	opts := runOptions{
+		Started: func(string) func() {
+			srv.record("started")
+			return func() { srv.record("display stopped") }
+		},
+		ExpireAfter: expire,
+		Exit:        h.exit,
+		Signals:     h.signals,
+		After:       h.clock.After,
+		Out:         &h.out,
+	}
+	go func() {
+		reason, err := runServer(srv, opts)
+		if err != nil {
+			t.Error(err)
+		}
+		h.result <- reason
+	}()
+	return h
+}
+
+func (h *harness) wait(t *testing.T) stopReason {
+	t.Helper()
+	select {
+	case reason := <-h.result:
+		return reason
+	case <-time.After(5 * time.Second):
+		t.Fatal("runServer did not return")
+		return 0
+	}
+}
+
+// waitStarted blocks until runServer has shown the server
+func (h *harness) waitStarted(t *testing.T) {
+	t.Helper()
+	for range 500 {
+		if slices.Contains(h.srv.recorded(), "started") {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatal("server was never shown")
+}
+
+func TestRunServerSignal(t *testing.T) {
+	h := startHarness(t, newFakeServer(0), 0)
+	h.waitStarted(t)
+	h.signals <- os.Interrupt
+
+	if reason := h.wait(t); reason != stopSignal {
+		t.Errorf("reason = %d, want stopSignal", reason)
+	}
+	want := []string{"start", "started", "display stopped", "shutdown"}
+	if got := h.srv.recorded(); !slices.Equal(got, want) {
+		t.Errorf("calls = %v, want %v", got, want)
+	}
+	if !strings.Contains(h.out.String(), "Shutting down gracefully") {
+		t.Errorf("output = %q", h.out.String())
+	}
+}
+
+func TestRunServerExpiry(t *testing.T) {
+	h := startHarness(t, newFakeServer(0), 10*time.Minute)
+	expiry := h.clock.next(t)
+	if expiry.d != 10*time.Minute {
+		t.Fatalf("expiry timer for %s, want 10m", expiry.d)
+	}
+	if got := h.srv.recorded(); slices.Contains(got, "shutdown") {
+		t.Fatalf("shut down before expiring: %v", got)
+	}
+	expiry.ch <- time.Now()
+
+	if reason := h.wait(t); reason != stopExpired {
+		t.Errorf("reason = %d, want stopExpired", reason)
+	}
+	want := []string{"start", "started", "display stopped", "shutdown"}
+	if got := h.srv.recorded(); !slices.Equal(got, want) {
+		t.Errorf("calls = %v, want %v", got, want)
+	}
+	if !strings.Contains(h.out.String(), "Expired after 10m") {
+		t.Errorf("output = %q", h.out.String())
+	}
+}
+
+func TestRunServerExit(t *testing.T) {
+	h := startHarness(t, newFakeServer(0), 0)
+	h.waitStarted(t)
+	close(h.exit)
+	if reason := h.wait(t); reason != stopExit {
+		t.Errorf("reason = %d, want stopExit", reason)
+	}
+}
+
+func TestRunServerRemoteStopSkipsDrain(t *testing.T) {
+	srv := newFakeServer(3)
+	h := startHarness(t, srv, 0)
+	h.waitStarted(t)
+	close(srv.done)
+
+	if reason := h.wait(t); reason != stopRemote {
+		t.Errorf("reason = %d, want stopRemote", reason)
+	}
+	if strings.Contains(h.out.String(), "Waiting for") {
+		t.Errorf("waited on transfers after a remote stop: %q", h.out.String())
+	}
+}
+
+func TestRunServerDrainsTransfers(t *testing.T) {
+	srv := newFakeServer(2)
+	h := startHarness(t, srv, 0)
+	h.waitStarted(t)
+	h.signals <- os.Interrupt
+
+	if d := h.clock.next(t).d; d != drainTimeout {
+		t.Fatalf("first drain timer for %s, want %s", d, drainTimeout)
+	}
+	// Still busy at the first check
+	poll := h.clock.next(t)
+	if poll.d != drainPollInterval {
+		t.Fatalf("poll timer for %s, want %s", poll.d, drainPollInterval)
+	}
+	poll.ch <- time.Now()
+	poll = h.clock.next(t)
+	if got := srv.recorded(); slices.Contains(got, "shutdown") {
+		t.Fatalf("shut down with transfers in flight: %v", got)
+	}
+
+	srv.setActive(0)
+	poll.ch <- time.Now()
+	if reason := h.wait(t); reason != stopSignal {
+		t.Errorf("reason = %d, want stopSignal", reason)
+	}
+	if got := srv.recorded(); got[len(got)-1] != "shutdown" {
+		t.Errorf("calls = %v, want shutdown last", got)
+	}
+	if !strings.Contains(h.out.String(), "Waiting for 2 transfer(s)") {
+		t.Errorf("output = %q", h.out.String())
+	}
+}
+
+func TestRunServerSecondSignalStopsDrain(t *testing.T) {
+	h := startHarness(t, newFakeServer(1), 0)
+	h.waitStarted(t)
+	h.signals <- os.Interrupt
+	h.clock.next(t) // Drain timeout
+	h.clock.next(t) // First poll
+	h.signals <- os.Interrupt
+
+	if reason := h.wait(t); reason != stopSignal {
+		t.Errorf("reason = %d, want stopSignal", reason)
+	}
+	if !strings.Contains(h.out.String(), "Stopping without waiting") {
+		t.Errorf("output = %q", h.out.String())
+	}
+}
+
+func TestRunServerDrainTimeout(t *testing.T) {
+	h := startHarness(t, newFakeServer(1), 0)
+	h.waitStarted(t)
+	h.signals <- os.Interrupt
+	deadline := h.clock.next(t)
+	h.clock.next(t) // First poll, never fired
+	deadline.ch <- time.Now()
+
+	h.wait(t)
+	if !strings.Contains(h.out.String(), "stopping anyway") {
+		t.Errorf("output = %q", h.out.String())
+	}
+}
+
+func TestRunServerStartError(t *testing.T) {
+	srv := newFakeServer(0)
+	srv.startErr = errors.New("address in use")
+	_, err := runServer(srv, runOptions{Signals: make(chan os.Signal), Out: &bytes.Buffer{}})
+	if err == nil || !strings.Contains(err.Error(), "address in use") {
+		t.Errorf("err = %v", err)
+	}
+	if got := srv.recorded(); !slices.Equal(got, []string{"start"}) {
+		t.Errorf("calls = %v, want only start", got)
+	}
+}
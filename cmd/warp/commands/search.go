@@ -2,27 +2,39 @@ package commands
 
 import (
 	"context"
-	"flag"
 	"fmt"
 	"time"
 
-	"github.com/zulfikawr/warp/cmd/warp/ui"
+	"github.com/zulfikawr/warp/internal/cli"
+	"github.com/zulfikawr/warp/internal/config"
 	"github.com/zulfikawr/warp/internal/discovery"
+	"github.com/zulfikawr/warp/internal/errors"
 )
 
 // Search executes the search command
-func Search(args []string) error {
-	fs := flag.NewFlagSet("search", flag.ExitOnError)
-	fs.Usage = searchHelp
-	timeout := fs.Duration("timeout", 3*time.Second, "discovery timeout")
+func Search(g cli.GlobalOptions, args []string) error {
+	// Load configuration (config file → env vars)
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return errors.ConfigError("Failed to load configuration", err)
+	}
+
+	fs := newFlagSet(searchDoc)
+	timeout := fs.Duration("timeout", 3*time.Second, "duration to wait for discovery")
+	discoveryMode := fs.String("discovery", cfg.Discovery, "search via mdns, broadcast or both")
+	scan := fs.String("scan", "", "with broadcast discovery, also probe each host of a CIDR")
 	if err := fs.Parse(args); err != nil {
 		return fmt.Errorf("failed to parse flags: %w", err)
 	}
+	mode, err := parseDiscovery(*discoveryMode)
+	if err != nil {
+		return err
+	}
 
 	fmt.Println("Searching for warp services on local network...")
 	fmt.Println()
 
-	services, err := discovery.Browse(context.Background(), *timeout)
+	services, err := discovery.BrowseWith(context.Background(), *timeout, discovery.Options{Mode: mode, ScanCIDR: *scan})
 	if err != nil {
 		return fmt.Errorf("service discovery failed: %w", err)
 	}
@@ -52,21 +64,20 @@ func Search(args []string) error {
 	return nil
 }
 
-func searchHelp() {
-	fmt.Println(ui.C.Bold + ui.C.Green + "warp search" + ui.C.Reset + " - Discover nearby warp hosts via mDNS")
-	fmt.Println()
-	fmt.Println(ui.C.Bold + "Usage:" + ui.C.Reset)
-	fmt.Println("  " + ui.C.Green + "warp search" + ui.C.Reset + " [flags]")
-	fmt.Println()
-	fmt.Println(ui.C.Bold + "Description:" + ui.C.Reset)
-	fmt.Println("  Search for warp servers on your local network using mDNS (Bonjour).")
-	fmt.Println("  Displays discovered hosts with their names, modes, and URLs.")
-	fmt.Println()
-	fmt.Println(ui.C.Bold + "Flags:" + ui.C.Reset)
-	fmt.Println("  " + ui.C.Yellow + "--timeout" + ui.C.Reset + "          duration to wait for discovery (default: 3s)")
-	fmt.Println()
-	fmt.Println(ui.C.Bold + "Examples:" + ui.C.Reset)
-	fmt.Println("  " + ui.C.Green + "warp search" + ui.C.Reset + "                        " + ui.C.Dim + "# Search with default 3s timeout" + ui.C.Reset)
-	fmt.Println("  " + ui.C.Green + "warp search" + ui.C.Reset + " --timeout 5s           " + ui.C.Dim + "# Search for 5 seconds" + ui.C.Reset)
-	fmt.Println("  " + ui.C.Green + "warp search" + ui.C.Reset + " --timeout 100ms        " + ui.C.Dim + "# Quick search" + ui.C.Reset)
+var searchDoc = &cli.Command{
+	Name:    "search",
+	Summary: "Discover nearby warp hosts via mDNS or UDP broadcast",
+	Usage:   []string{"[flags]"},
+	Description: []string{
+		"Search for warp servers on your local network using mDNS (Bonjour).",
+		"Where multicast is filtered, --discovery both falls back to a UDP broadcast",
+		"probe answered by servers started with --discovery broadcast or both.",
+		"Displays discovered hosts with their names, modes, and URLs.",
+	},
+	Examples: []cli.Example{
+		{Command: "warp search", Comment: "Search with default 3s timeout"},
+		{Command: "warp search --timeout 5s", Comment: "Search for 5 seconds"},
+		{Command: "warp search --timeout 100ms", Comment: "Quick search"},
+		{Command: "warp search --discovery both", Comment: "Fall back to UDP broadcast"},
+	},
 }
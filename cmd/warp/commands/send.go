@@ -1,53 +1,97 @@
 package commands
 
 import (
-	"flag"
+	"context"
 	"fmt"
-	"io"
+	iofs "io/fs"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"syscall"
+	"time"
 
 	"github.com/zulfikawr/warp/cmd/warp/ui"
+	"github.com/zulfikawr/warp/internal/cli"
 	"github.com/zulfikawr/warp/internal/config"
 	"github.com/zulfikawr/warp/internal/crypto"
 	"github.com/zulfikawr/warp/internal/errors"
-	"github.com/zulfikawr/warp/internal/logging"
+	"github.com/zulfikawr/warp/internal/protocol"
+	"github.com/zulfikawr/warp/internal/relay"
 	"github.com/zulfikawr/warp/internal/server"
 	uipkg "github.com/zulfikawr/warp/internal/ui"
 )
 
+// maxTextArgLength caps --text; larger content should be piped through --stdin
+const maxTextArgLength = 64 * 1024
+
+// downloadStatusInterval is how often the sender's download line refreshes
+const downloadStatusInterval = time.Second
+
 // Send executes the send command
-func Send(args []string) error {
+func Send(g cli.GlobalOptions, args []string) error {
 	// Load configuration (config file → env vars)
 	cfg, err := config.LoadConfig()
 	if err != nil {
 		return errors.ConfigError("Failed to load configuration", err)
 	}
 
-	// Count -v flags and filter them out
-	verbosity, filteredArgs := countVerbosity(args)
-
-	fs := flag.NewFlagSet("send", flag.ExitOnError)
-	fs.Usage = sendHelp
+	fs := newFlagSet(sendDoc)
 	// Use config defaults for flags (config → env → flags precedence)
-	port := fs.Int("port", cfg.DefaultPort, "specific port")
+	port := fs.Int("port", cfg.DefaultPort, "choose a specific port (0 = random)")
 	fs.IntVar(port, "p", cfg.DefaultPort, "")
-	noQR := fs.Bool("no-qr", cfg.NoQR, "disable QR")
-	iface := fs.String("interface", cfg.DefaultInterface, "network interface")
+	noQR := fs.Bool("no-qr", cfg.NoQR, "skip printing the QR code")
+	qrInvert := fs.Bool("qr-invert", false, "draw the QR code for a light terminal background")
+	iface := fs.String("interface", cfg.DefaultInterface, "bind to a specific network interface")
 	fs.StringVar(iface, "i", cfg.DefaultInterface, "")
-	text := fs.String("text", "", "send text instead of file")
-	stdin := fs.Bool("stdin", false, "read from stdin")
-	rateLimit := fs.Float64("rate-limit", cfg.RateLimitMbps, "bandwidth limit in Mbps")
+	text := fs.String("text", "", "send a text `snippet` instead of a file")
+	stdin := fs.Bool("stdin", false, "read text content from stdin")
+	rateLimit := fs.Float64("rate-limit", cfg.RateLimitMbps, "limit download bandwidth in Mbps (0 = unlimited)")
 	cacheSize := fs.Int64("cache-size", cfg.CacheSizeMB, "file cache size in MB")
-	noEncrypt := fs.Bool("no-encrypt", false, "disable PAKE encryption")
-	if err := fs.Parse(filteredArgs); err != nil {
+	maxTransfers := fs.Int("max-transfers", 0, "max concurrent downloads; extra clients get 503 + Retry-After")
+	quotaPerIP := fs.String("quota-per-ip", "", "bytes each client may transfer per --quota-reset, e.g. 10GB; then 429")
+	quotaReset := fs.Duration("quota-reset", server.DefaultQuotaReset, "how often --quota-per-ip usage starts over")
+	noEncrypt := fs.Bool("no-encrypt", false, "disable encryption (not recommended)")
+	progressEndpoint := fs.Bool("progress-endpoint", false, "expose the progress WebSocket at /ws/progress/<token>")
+	inline := fs.Bool("inline", false, "let browsers preview images, video, audio, PDF and plain text")
+	allowReturn := fs.Bool("allow-return", false, "let the recipient upload files back at /u/<token>")
+	returnDir := fs.String("return-dir", "", "where returned files go on exit (default: next to the shared path)")
+	basicAuth := fs.String("basic-auth", "", "require HTTP Basic auth (user:pass); browsers prompt for it")
+	discoveryMode := fs.String("discovery", cfg.Discovery, "announce via mdns, broadcast (UDP 8829) or both")
+	short := fs.Bool("short", false, "also serve a short /s/<alias> URL, rate limited per client")
+	quicMode := fs.String("quic", cfg.QUIC, "HTTP/3 listener: off, auto (same port as TCP) or a UDP port")
+	allowIPs := newStringList(cfg.AllowIPs)
+	fs.Var(allowIPs, "allow-ip", "only serve clients in this CIDR or IP (repeatable)")
+	denyIPs := newStringList(cfg.DenyIPs)
+	fs.Var(denyIPs, "deny-ip", "refuse clients in this CIDR or IP (repeatable; wins over --allow-ip)")
+	lowMemory := fs.Bool("low-memory", cfg.LowMemory, "small buffers, no cache or compression (auto below 1GB RAM)")
+	zipFiles := fs.Bool("zip", false, "share matched files as a zip even when only one matches")
+	archiveOpts := fs.String("archive-opts", "", "how zips are built: symlinks=follow|store|skip, hidden=false, deterministic, mtime")
+	trustProxy := fs.Bool("trust-proxy", false, "take the client IP from X-Forwarded-For (only behind a reverse proxy)")
+	trustProxyCIDRs := newStringList(nil)
+	fs.Var(trustProxyCIDRs, "trust-proxy-cidr", "take the client IP from X-Forwarded-For only when the connection comes from this CIDR or IP (repeatable)")
+	startAt := fs.String("start-at", "", "start serving at HH:MM (today, or tomorrow once it has passed)")
+	startIn := fs.String("start-in", "", "start serving after a delay, e.g. 45m or 2h")
+	precompute := fs.Bool("precompute", false, "compute the file's checksum now rather than on the first download")
+	mtimeGranularity := fs.Duration("mtime-granularity", server.DefaultMtimeGranularity, "recompute checksums taken this soon after a file changed (raise for coarse network filesystems)")
+	follow := fs.Bool("follow", false, "keep streaming a file that is still being written, like tail -f")
+	relayAddr := fs.String("relay", "", "also serve through this warp relay (host:port) for receivers that can't reach this machine")
+	media := fs.Bool("media", false, "also serve an M3U playlist of a directory's audio and video for TVs and VLC")
+	if err := fs.Parse(args); err != nil {
 		return fmt.Errorf("failed to parse flags: %w", err)
 	}
+	start, err := parseStart(*startAt, *startIn)
+	if err != nil {
+		return err
+	}
 
-	// Set log level based on verbosity
-	if verbosity > 0 {
-		logging.SetLevel(verbosity)
+	if *relayAddr != "" {
+		if *noEncrypt {
+			return errors.NewUserError("--relay can't be used with --no-encrypt",
+				[]string{"Transfers through a relay are always end-to-end encrypted, so the relay can't read them"}, nil)
+		}
+		if *relayAddr, err = parseRelay(*relayAddr); err != nil {
+			return err
+		}
 	}
 
 	tok, err := crypto.GenerateToken(nil)
@@ -67,24 +111,34 @@ func Send(args []string) error {
 
 	// Handle text sharing
 	if *text != "" {
+		if len(*text) > maxTextArgLength {
+			return errors.NewUserError(
+				fmt.Sprintf("Text is too long for --text (%s, limit %s)", uipkg.FormatBytes(int64(len(*text))), uipkg.FormatBytes(maxTextArgLength)),
+				[]string{"Pipe the content through --stdin instead, e.g. warp send --stdin < notes.txt"},
+				nil,
+			)
+		}
 		srv = &server.Server{InterfaceName: *iface, Token: tok, PAKECode: pakeCode, TextContent: *text}
 	} else if *stdin {
-		// Read from stdin
-		data, err := io.ReadAll(os.Stdin)
+		// Small input stays in memory; large input is spooled to a temp file
+		content, err := server.ReadStdin(os.Stdin, int64(cfg.StdinSpillMB)*1024*1024, cfg.TempDir)
 		if err != nil {
-			return fmt.Errorf("failed to read from stdin: %w", err)
+			return err
+		}
+		srv = &server.Server{InterfaceName: *iface, Token: tok, PAKECode: pakeCode, TextContent: content.Text}
+		if content.Path != "" {
+			srv.SrcPath = content.Path
+			srv.TempFile = content.Path
+			srv.ServeAsText = content.IsText
 		}
-		srv = &server.Server{InterfaceName: *iface, Token: tok, PAKECode: pakeCode, TextContent: string(data)}
 	} else {
 		// Handle file/directory
 		if fs.NArg() < 1 {
 			return fmt.Errorf("send requires a path, --text, or --stdin")
 		}
-		path := fs.Arg(0)
-
-		// Check if path exists
-		if _, err := os.Stat(path); err != nil {
-			return errors.FileNotFoundError(path, err)
+		path, files, err := resolveSendPaths(fs.Args(), *zipFiles)
+		if err != nil {
+			return err
 		}
 
 		srv = &server.Server{
@@ -93,74 +147,344 @@ func Send(args []string) error {
 			PAKECode:      pakeCode,
 			SrcPath:       path,
 		}
+		if len(files) > 0 {
+			srv.SrcFiles = files
+			srv.ArchiveName = server.ArchiveName(files)
+		}
+		if *follow {
+			if fi, err := os.Stat(path); err != nil || fi.IsDir() || len(files) > 0 {
+				return errors.NewUserError("--follow streams a single growing file, not a directory or several files",
+					[]string{"Example: warp send --follow ./app.log"}, err)
+			}
+			if *precompute {
+				return errors.NewUserError("--precompute can't be used with --follow: a growing file has no final checksum", nil, nil)
+			}
+			srv.Follow = true
+		}
+	}
+	if *media {
+		if fi, err := os.Stat(srv.SrcPath); srv.TextContent != "" || err != nil || (!fi.IsDir() && len(srv.SrcFiles) == 0) {
+			return errors.NewUserError("--media serves a playlist of a directory or several files",
+				[]string{"Example: warp send --media ~/Videos/holiday"}, nil)
+		}
+		srv.Media = true
+	}
+	if srv.Archive, err = parseArchiveOpts(*archiveOpts); err != nil {
+		return err
+	}
+	if *follow && srv.SrcPath == "" {
+		return errors.NewUserError("--follow needs a file path, not --text or --stdin", nil, nil)
 	}
 
 	// Apply optional configurations
 	srv.RateLimitMbps = *rateLimit
+	srv.MaxTransfers = *maxTransfers
+	if srv.QuotaPerIP, err = parseQuota(*quotaPerIP, *quotaReset); err != nil {
+		return err
+	}
+	srv.QuotaReset = *quotaReset
 	srv.MaxCacheSize = *cacheSize * 1024 * 1024 // Convert MB to bytes
-
-	url, err := srv.Start()
-	if err != nil {
-		return fmt.Errorf("failed to start server: %w", err)
+	if srv.LowMemory = lowMemoryMode(fs, *lowMemory, cfg, "file cache off"); srv.LowMemory {
+		srv.MaxCacheSize = 0
+	}
+	if *mtimeGranularity <= 0 {
+		return errors.NewUserError("--mtime-granularity must be positive", []string{"Use --mtime-granularity 10s for a network mount with coarse timestamps"}, nil)
+	}
+	srv.MtimeGranularity = *mtimeGranularity
+	srv.NoBrotli = !cfg.Brotli
+	srv.Limits = uploadLimits(cfg)
+	srv.ProgressEndpoint = *progressEndpoint
+	srv.Inline = *inline
+	if srv.BasicAuthUser, srv.BasicAuthPassword, err = parseBasicAuth(*basicAuth); err != nil {
+		return err
+	}
+	if srv.Discovery, err = parseDiscovery(*discoveryMode); err != nil {
+		return err
+	}
+	if srv.QUIC, err = parseQUIC(*quicMode); err != nil {
+		return err
+	}
+	if srv.AllowIPs, srv.DenyIPs, err = parseIPFilter(allowIPs, denyIPs); err != nil {
+		return err
+	}
+	srv.TrustProxy = *trustProxy
+	if srv.TrustedProxies, err = server.ParseIPList(trustProxyCIDRs.values); err != nil {
+		return errors.NewUserError("Invalid --trust-proxy-cidr value",
+			[]string{"Use the proxy's address or range, e.g. --trust-proxy-cidr 10.0.0.0/8"}, err)
+	}
+	srv.ShortAlias = *short
+	srv.Relay = *relayAddr
+	if srv.Relay != "" {
+		if srv.RelayNameplate, err = relay.NewNameplate(nil); err != nil {
+			return fmt.Errorf("failed to generate relay nameplate: %w", err)
+		}
+	}
+	if *returnDir != "" && !*allowReturn {
+		return errors.NewUserError("--return-dir needs --allow-return", []string{"Add --allow-return to accept files sent back"}, nil)
+	}
+	if *allowReturn {
+		// Uploads land in a private temp dir and move on shutdown
+		if srv.UploadDir, err = os.MkdirTemp(cfg.TempDir, "warp-return-"); err != nil {
+			return fmt.Errorf("failed to create return directory: %w", err)
+		}
+		srv.AllowReturn = true
+		srv.ReturnDir = *returnDir
+		switch {
+		case srv.ReturnDir != "" || srv.SrcPath == "" || srv.TempFile != "":
+		case len(srv.SrcFiles) > 0:
+			srv.ReturnDir = srv.SrcPath
+		default:
+			srv.ReturnDir = filepath.Dir(filepath.Clean(srv.SrcPath))
+		}
 	}
-	defer func() { _ = srv.Shutdown() }()
 
-	// Display server info
-	fmt.Fprintf(os.Stderr, "Server started on :%d\n", srv.Port)
-	fmt.Fprintf(os.Stderr, "PAKE Code: %s%s%s\n", ui.C.Bold, srv.PAKECode, ui.C.Reset)
-	serviceName := fmt.Sprintf("warp-%s._warp._tcp.local.", tok[:6])
-	fmt.Fprintf(os.Stderr, "Service: %s\n", serviceName)
-	fmt.Fprintf(os.Stderr, "Local URL: %s\n", url)
-	fmt.Fprintf(os.Stderr, "Metrics: http://%s:%d/metrics\n", srv.IP.String(), srv.Port)
+	// Undoes the spooled stdin and return dir when the server never starts
+	discard := func() {
+		if srv.TempFile != "" {
+			_ = os.Remove(srv.TempFile)
+		}
+		if srv.AllowReturn {
+			_ = os.Remove(srv.UploadDir)
+		}
+	}
+	if *precompute {
+		if err := srv.WarmChecksum(); err != nil {
+			discard()
+			return fmt.Errorf("failed to compute checksum: %w", err)
+		}
+	}
+	if !start.IsZero() {
+		// Nothing listens until the start, so no one sees a half-open share
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		err := waitForStart(ctx, start)
+		stop()
+		if err != nil {
+			discard()
+			return nil
+		}
+	}
 
-	if !*noQR {
-		fmt.Fprintln(os.Stderr)
-		fmt.Fprintln(os.Stderr, ui.C.Bold+"Scan QR code on another device:"+ui.C.Reset)
-		_ = uipkg.PrintQR(url)
-		fmt.Fprintln(os.Stderr)
-		fmt.Fprintln(os.Stderr, ui.C.Dim+"Tip: Open the URL in any browser to download"+ui.C.Reset)
+	if srv.PAKECode != "" {
+		go showAuthStrings(srv.Events())
 	}
 
-	fmt.Fprint(os.Stderr, "\n"+ui.C.Yellow+"Press Ctrl+C to stop server"+ui.C.Reset+"\n")
+	show := func(url string) (stop func()) {
+		fmt.Fprintf(os.Stderr, "Server started on :%d\n", srv.Port)
+		fmt.Fprintf(os.Stderr, "PAKE Code: %s%s%s\n", ui.C.Bold, srv.PAKECode, ui.C.Reset)
+		serviceName := fmt.Sprintf("warp-%s._warp._tcp.local.", tok[:6])
+		fmt.Fprintf(os.Stderr, "Service: %s\n", serviceName)
+		fmt.Fprintf(os.Stderr, "Local URL: %s\n", url)
+		if shortURL := srv.ShortURL(); shortURL != "" {
+			fmt.Fprintf(os.Stderr, "Short URL: %s %s(rate limited)%s\n", shortURL, ui.C.Dim, ui.C.Reset)
+		}
+		if playlistURL := srv.PlaylistURL(); playlistURL != "" {
+			fmt.Fprintf(os.Stderr, "Playlist: %s %s(open in VLC or a TV's media player)%s\n", playlistURL, ui.C.Dim, ui.C.Reset)
+		}
+		fmt.Fprintf(os.Stderr, "Metrics: http://%s:%d/metrics\n", srv.IP.String(), srv.Port)
+		fmt.Fprintf(os.Stderr, "Stop secret: %s %s(warp stop --secret <secret> <url>)%s\n", srv.ManagementSecret, ui.C.Dim, ui.C.Reset)
+		if srv.Relay != "" {
+			fmt.Fprintf(os.Stderr, "Relay: %s %s(warp receive --relay %s --code %s)%s\n", srv.Relay, ui.C.Dim, srv.Relay, relay.Code(srv.RelayNameplate, srv.PAKECode), ui.C.Reset)
+		}
+		if srv.AllowReturn {
+			fmt.Fprintf(os.Stderr, "Return uploads enabled: http://%s:%d%s%s\n", srv.IP.String(), srv.Port, protocol.UploadPathPrefix, tok)
+		}
+
+		if !*noQR {
+			fmt.Fprintln(os.Stderr)
+			fmt.Fprintln(os.Stderr, ui.C.Bold+"Scan QR code on another device:"+ui.C.Reset)
+			_ = uipkg.PrintQRTo(os.Stdout, url, qrOptions(*qrInvert))
+			if shortURL := srv.ShortURL(); shortURL != "" {
+				fmt.Fprintln(os.Stderr)
+				fmt.Fprintln(os.Stderr, ui.C.Bold+"Or the short URL:"+ui.C.Reset)
+				_ = uipkg.PrintQRTo(os.Stdout, shortURL, qrOptions(*qrInvert))
+			}
+			fmt.Fprintln(os.Stderr)
+			fmt.Fprintln(os.Stderr, ui.C.Dim+"Tip: Open the URL in any browser to download"+ui.C.Reset)
+		}
 
-	// Wait for interrupt signal for graceful shutdown
-	sigCh := make(chan os.Signal, 1)
-	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
-	<-sigCh
-	fmt.Println("\nShutting down gracefully...")
+		fmt.Fprint(os.Stderr, "\n"+ui.C.Yellow+"Press Ctrl+C to stop server"+ui.C.Reset+"\n")
+		return showDownloadStatus(srv)
+	}
+	if _, err := runServer(srv, runOptions{Started: show}); err != nil {
+		discard()
+		return err
+	}
 
+	if srv.AllowReturn {
+		// runServer has shut down, which moved the returned files
+		printReturned(srv)
+	}
 	return nil
 }
 
-func sendHelp() {
-	fmt.Println(ui.C.Bold + ui.C.Green + "warp send" + ui.C.Reset + " - Share a file, directory, or text snippet")
-	fmt.Println()
-	fmt.Println(ui.C.Bold + "Usage:" + ui.C.Reset)
-	fmt.Println("  " + ui.C.Green + "warp send" + ui.C.Reset + " [flags] <path>")
-	fmt.Println("  " + ui.C.Green + "warp send" + ui.C.Reset + " --text <text>")
-	fmt.Println("  " + ui.C.Green + "warp send" + ui.C.Reset + " --stdin < file")
-	fmt.Println()
-	fmt.Println(ui.C.Bold + "Description:" + ui.C.Reset)
-	fmt.Println("  Start a server and share a file, directory, or text with another device.")
-	fmt.Println("  Generates a secure PAKE code for easy transfer and end-to-end encryption.")
-	fmt.Println()
-	fmt.Println(ui.C.Bold + "Flags:" + ui.C.Reset)
-	fmt.Println("  " + ui.C.Yellow + "-p, --port" + ui.C.Reset + "        choose specific port (default: random)")
-	fmt.Println("  " + ui.C.Yellow + "-i, --interface" + ui.C.Reset + "   bind to a specific network interface")
-	fmt.Println("  " + ui.C.Yellow + "--text string" + ui.C.Reset + "     send a text snippet instead of a file")
-	fmt.Println("  " + ui.C.Yellow + "--stdin" + ui.C.Reset + "           read text content from stdin")
-	fmt.Println("  " + ui.C.Yellow + "--rate-limit" + ui.C.Reset + "      limit download bandwidth in Mbps (0 = unlimited)")
-	fmt.Println("  " + ui.C.Yellow + "--cache-size" + ui.C.Reset + "      file cache size in MB (default: 100)")
-	fmt.Println("  " + ui.C.Yellow + "--no-qr" + ui.C.Reset + "           skip printing the QR code")
-	fmt.Println("  " + ui.C.Yellow + "--no-encrypt" + ui.C.Reset + "       disable encryption (not recommended)")
-	fmt.Println("  " + ui.C.Yellow + "-v, --verbose" + ui.C.Reset + "     verbose logging (use -vv or -vvv for more detail)")
-	fmt.Println()
-	fmt.Println(ui.C.Bold + "Examples:" + ui.C.Reset)
-	fmt.Println("  " + ui.C.Green + "warp send" + ui.C.Reset + " ./photo.jpg                    " + ui.C.Dim + "# Share a file (encrypted)" + ui.C.Reset)
-	fmt.Println("  " + ui.C.Green + "warp send" + ui.C.Reset + " ./documents/                   " + ui.C.Dim + "# Share a directory (encrypted)" + ui.C.Reset)
-	fmt.Println("  " + ui.C.Green + "warp send" + ui.C.Reset + " --text \"hello world\"           " + ui.C.Dim + "# Share text (encrypted)" + ui.C.Reset)
-	fmt.Println("  echo \"hello\" | " + ui.C.Green + "warp send" + ui.C.Reset + " --stdin         " + ui.C.Dim + "# Read from stdin (encrypted)" + ui.C.Reset)
-	fmt.Println("  " + ui.C.Green + "warp send" + ui.C.Reset + " -p 8080 ./file.zip             " + ui.C.Dim + "# Use specific port (encrypted)" + ui.C.Reset)
-	fmt.Println("  " + ui.C.Green + "warp send" + ui.C.Reset + " --rate-limit 10 ./video.mp4    " + ui.C.Dim + "# Limit to 10 Mbps (encrypted)" + ui.C.Reset)
-	fmt.Println("  " + ui.C.Green + "warp send" + ui.C.Reset + " --no-encrypt ./public.pdf      " + ui.C.Dim + "# Unencrypted transfer" + ui.C.Reset)
+// showDownloadStatus keeps a line such as "downloads: 3 (last 12m ago)" up to
+// date on an interactive stderr, until the returned func is called
+func showDownloadStatus(srv *server.Server) (stop func()) {
+	r := uipkg.NewRenderer(os.Stderr, false)
+	sr, ok := r.(uipkg.StatusRenderer)
+	if !ok {
+		return func() {}
+	}
+	done, stopped := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(downloadStatusInterval)
+		defer ticker.Stop()
+		for {
+			sr.Status(srv.DownloadActivity().String())
+			select {
+			case <-done:
+				r.Finish(uipkg.Summary{})
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+// showAuthStrings prints the verification words of every receiver that
+// completes the PAKE handshake, until events is closed
+func showAuthStrings(events <-chan server.Event) {
+	for ev := range events {
+		if ev.Type != server.EventPeerVerified {
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "\nReceiver %s connected. Verification words: %s%s%s\n", ev.ClientIP, ui.C.Bold, ev.AuthString, ui.C.Reset)
+		fmt.Fprintln(os.Stderr, ui.C.Dim+"They should match the words on the receiver's screen"+ui.C.Reset)
+	}
+}
+
+// resolveSendPaths works out what the path arguments share. A single existing
+// file or directory is served as it is. Anything else, several arguments or
+// glob patterns (expanded here, since Windows shells don't), becomes a list of
+// files zipped on the fly from their common directory, which is returned as
+// the path. forceZip zips even a lone file.
+func resolveSendPaths(args []string, forceZip bool) (string, []string, error) {
+	var files []string
+	seen := make(map[string]bool)
+	add := func(p string) error {
+		abs, err := filepath.Abs(p)
+		if err != nil {
+			return err
+		}
+		if !seen[abs] {
+			seen[abs] = true
+			files = append(files, abs)
+		}
+		return nil
+	}
+	for _, arg := range args {
+		fi, err := os.Stat(arg)
+		if err != nil {
+			if !server.HasGlobMeta(arg) {
+				return "", nil, errors.FileNotFoundError(arg, err)
+			}
+			matches, err := server.ExpandGlob(arg)
+			if err != nil {
+				return "", nil, err
+			}
+			for _, m := range matches {
+				if err := add(m); err != nil {
+					return "", nil, err
+				}
+			}
+			continue
+		}
+		if len(args) == 1 && (fi.IsDir() || !forceZip) {
+			return arg, nil, nil
+		}
+		if !fi.IsDir() {
+			if err := add(arg); err != nil {
+				return "", nil, err
+			}
+			continue
+		}
+		err = filepath.WalkDir(arg, func(p string, d iofs.DirEntry, err error) error {
+			if err != nil || !d.Type().IsRegular() {
+				return err
+			}
+			return add(p)
+		})
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to read %s: %w", arg, err)
+		}
+	}
+	switch {
+	case len(files) == 0:
+		return "", nil, errors.NewUserError("Nothing to send: the given directories hold no files", nil, nil)
+	case len(files) == 1 && !forceZip:
+		return files[0], nil, nil
+	}
+	return server.CommonDir(files), files, nil
+}
+
+// printReturned lists the files the recipient sent back and where they are
+func printReturned(srv *server.Server) {
+	returned := srv.Returned()
+	if len(returned) == 0 {
+		return
+	}
+	fmt.Fprintln(os.Stderr, ui.C.Bold+"Files sent back:"+ui.C.Reset)
+	leftInTemp := false
+	for _, p := range returned {
+		fmt.Fprintf(os.Stderr, "  %s\n", p)
+		leftInTemp = leftInTemp || filepath.Dir(p) == srv.UploadDir
+	}
+	if leftInTemp {
+		fmt.Fprintln(os.Stderr, ui.C.Dim+"Left in a temp directory; use --return-dir to choose where they go"+ui.C.Reset)
+	}
+}
+
+var sendDoc = &cli.Command{
+	Name:    "send",
+	Summary: "Share a file, directory, or text snippet",
+	Usage: []string{
+		"[flags] <path|pattern>...",
+		"--text <text>",
+		"--stdin < file",
+	},
+	Description: []string{
+		"Start a server and share a file, directory, or text with another device.",
+		"Generates a secure PAKE code for easy transfer and end-to-end encryption.",
+		"Several paths, or a quoted glob pattern (** matches any depth), are shared",
+		"as one zip named after the prefix the file names have in common.",
+		"With --follow, a file that is still being written (such as a log) is streamed",
+		"as it grows until the receiver disconnects or the server stops.",
+		"With --media, a directory's audio and video are also listed in an M3U",
+		"playlist that VLC or a smart TV can stream and seek in. Those streams are",
+		"not encrypted.",
+		"The QR code is drawn as large as the terminal allows, in half blocks when",
+		"full ones don't fit, or replaced by the URL when the terminal is too narrow.",
+		"Use --qr-invert if it doesn't scan on a light background.",
+		"A file's checksum is taken again when it was taken within --mtime-granularity",
+		"of the file's last change, which the filesystem's timestamps may not show.",
+		"Directories and patterns are zipped in sorted order. --archive-opts decides",
+		"whether symlinks are followed (default; loops are skipped), stored or left",
+		"out, whether hidden files are included, and with deterministic, whether",
+		"timestamps are zeroed (unless mtime) so the same tree gives the same zip.",
+		"--relay also serves the share through a 'warp relay' both devices can reach,",
+		"for networks that keep them apart; the relay only forwards encrypted bytes.",
+	},
+	Extra: []cli.Flag{verboseFlag},
+	Examples: []cli.Example{
+		{Command: "warp send ./photo.jpg", Comment: "Share a file (encrypted)"},
+		{Command: "warp send ./documents/", Comment: "Share a directory (encrypted)"},
+		{Command: `warp send "logs/app-2024-*.log"`, Comment: "Share matching files as app-2024.zip"},
+		{Command: `warp send --text "hello world"`, Comment: "Share text (encrypted)"},
+		{Command: `echo "hello" | warp send --stdin`, Comment: "Read from stdin (encrypted)"},
+		{Command: "warp send -p 8080 ./file.zip", Comment: "Use specific port (encrypted)"},
+		{Command: "warp send --rate-limit 10 ./video.mp4", Comment: "Limit to 10 Mbps (encrypted)"},
+		{Command: "warp send --quota-per-ip 10GB ./datasets/", Comment: "At most 10 GB per device per day"},
+		{Command: "warp send --no-encrypt ./public.pdf", Comment: "Unencrypted transfer"},
+		{Command: "warp send --allow-return ./draft.docx", Comment: "Accept an edited copy back"},
+		{Command: "warp send --start-at 18:00 ./big.iso", Comment: "Start serving at 18:00"},
+		{Command: "warp send --follow ./app.log", Comment: "Let receivers follow a growing log"},
+		{Command: "warp send --media ~/Videos/holiday", Comment: "Stream a folder of videos to a TV"},
+		{Command: "warp send --archive-opts deterministic,hidden=false ./site/", Comment: "Same zip for the same files, without dotfiles"},
+		{Command: "warp send --relay relay.example.com:9000 ./report.pdf", Comment: "Reach a receiver on another VLAN"},
+	},
 }
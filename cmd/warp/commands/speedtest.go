@@ -2,29 +2,40 @@ package commands
 
 import (
 	"context"
-	"flag"
 	"fmt"
-	"os"
 	"strings"
 	"time"
 
 	"github.com/zulfikawr/warp/cmd/warp/ui"
+	"github.com/zulfikawr/warp/internal/cli"
+	"github.com/zulfikawr/warp/internal/errors"
 	"github.com/zulfikawr/warp/internal/speedtest"
+	uipkg "github.com/zulfikawr/warp/internal/ui"
 )
 
 // Speedtest executes the speedtest command
-func Speedtest(args []string) error {
-	fs := flag.NewFlagSet("speedtest", flag.ExitOnError)
-	fs.Usage = speedtestHelp
-
-	timeout := fs.Duration("timeout", 30*time.Second, "timeout for speed test")
-
+func Speedtest(g cli.GlobalOptions, args []string) error {
+	fs := newFlagSet(speedtestDoc)
+	timeout := fs.Duration("timeout", 30*time.Second, "timeout for the speed test")
+	duration := fs.Duration("duration", speedtest.DefaultDuration, "how long each of the upload and download tests runs")
+	payloadSize := fs.String("payload-size", "10MiB", "size of each download request and of the repeated upload block")
 	if err := fs.Parse(args); err != nil {
 		return fmt.Errorf("failed to parse flags: %w", err)
 	}
+	if *duration <= speedtest.Warmup {
+		return errors.NewUserError(fmt.Sprintf("--duration must be longer than the %s warmup", speedtest.Warmup), []string{"Example: --duration 10s"}, nil)
+	}
+	payload, err := uipkg.ParseBytes(*payloadSize)
+	if err != nil || payload <= 0 {
+		return errors.NewUserError("--payload-size must be a size such as 10MiB or 100MB", nil, err)
+	}
+	// Both tests have to fit, with room for the latency probes
+	if need := 2**duration + 10*time.Second; !flagSet(fs, "timeout") && *timeout < need {
+		*timeout = need
+	}
 
 	if fs.NArg() < 1 {
-		speedtestHelp()
+		fs.Usage()
 		return fmt.Errorf("target host required")
 	}
 
@@ -39,6 +50,8 @@ func Speedtest(args []string) error {
 
 	// Create speed test instance
 	st := speedtest.New(target)
+	st.Duration = *duration
+	st.PayloadSize = payload
 
 	// Run test with timeout
 	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
@@ -90,7 +103,7 @@ func displayResults(result *speedtest.Result) {
 		}
 
 		duration := speedtest.EstimateTransferTime(sizeMB, speed)
-		sizeStr := formatFileSize(sizeMB)
+		sizeStr := uipkg.FormatBytes(int64(sizeMB*1e6), uipkg.DecimalUnits(), uipkg.Precision(0))
 		durationStr := speedtest.FormatDuration(duration)
 
 		fmt.Printf("  • %s file in ~%s\n", sizeStr, durationStr)
@@ -98,7 +111,7 @@ func displayResults(result *speedtest.Result) {
 }
 
 func formatSpeedWithColor(mbps float64) string {
-	speed := speedtest.FormatSpeed(mbps)
+	speed := uipkg.FormatSpeed(mbps * 1e6 / 8)
 
 	// Pad to align nicely
 	padding := 12 - len(speed)
@@ -154,44 +167,41 @@ func getQualityColor(quality string) string {
 	}
 }
 
-func formatFileSize(mb float64) string {
-	if mb >= 1000 {
-		return fmt.Sprintf("%.0f GB", mb/1000)
-	}
-	return fmt.Sprintf("%.0f MB", mb)
-}
-
-func speedtestHelp() {
-	fmt.Fprintf(os.Stderr, `%sUsage:%s warp speedtest [options] <host>
-
-%sDescription:%s
-  Test network speed (upload/download/latency) to a target host.
-  This helps you understand your network performance and estimate transfer times.
-
-%sArguments:%s
-  <host>               Target host to test (e.g., 192.168.1.100 or example.com:8080)
-
-%sOptions:%s
-  --timeout <duration> Timeout for the speed test (default: 30s)
-  -h, --help          Show this help message
-
-%sExamples:%s
-  warp speedtest 192.168.1.100
-  warp speedtest 192.168.1.100:54321
-  warp speedtest example.com:8080 --timeout 1m
-
-%sOutput:%s
-  The command displays:
-  - Upload speed (Mbps/Gbps)
-  - Download speed (Mbps/Gbps)
-  - Network latency (milliseconds)
-  - Connection quality rating
-  - Estimated transfer times for common file sizes
-`,
-		ui.C.Bold, ui.C.Reset,
-		ui.C.Bold, ui.C.Reset,
-		ui.C.Bold, ui.C.Reset,
-		ui.C.Bold, ui.C.Reset,
-		ui.C.Bold, ui.C.Reset,
-		ui.C.Bold, ui.C.Reset)
+var speedtestDoc = &cli.Command{
+	Name:    "speedtest",
+	Summary: "Measure the network speed to a host",
+	Usage:   []string{"[flags] <host>"},
+	Description: []string{
+		"Test network speed (upload/download/latency) to a target host.",
+		"This helps you understand your network performance and estimate transfer times.",
+		"",
+		"Each of the upload and download tests runs for --duration. The upload streams one",
+		"request for the whole time and the download fetches --payload-size at a time over",
+		"the same connection. The first 500ms of each test is a warmup left out of the",
+		"result, so connection setup and TCP slow start don't drag it down.",
+		"--timeout is raised to fit both tests unless it is given.",
+	},
+	Sections: []cli.Section{
+		{
+			Title: "Arguments",
+			Items: []cli.Item{{Term: "<host>", Text: "target host to test (e.g., 192.168.1.100 or example.com:8080)"}},
+		},
+		{
+			Title: "Output",
+			Lines: []string{
+				"The command displays:",
+				"- Upload speed (Mbps, or MiB/s with speed_units: bytes)",
+				"- Download speed (Mbps, or MiB/s with speed_units: bytes)",
+				"- Network latency (milliseconds)",
+				"- Connection quality rating",
+				"- Estimated transfer times for common file sizes",
+			},
+		},
+	},
+	Examples: []cli.Example{
+		{Command: "warp speedtest 192.168.1.100"},
+		{Command: "warp speedtest 192.168.1.100:54321"},
+		{Command: "warp speedtest example.com:8080 --timeout 1m"},
+		{Command: "warp speedtest --duration 10s --payload-size 100MB 192.168.1.100", Comment: "Longer test for a fast link"},
+	},
 }
@@ -0,0 +1,47 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/zulfikawr/warp/cmd/warp/ui"
+	"github.com/zulfikawr/warp/internal/cli"
+	"github.com/zulfikawr/warp/internal/client"
+)
+
+// Stop executes the stop command
+func Stop(g cli.GlobalOptions, args []string) error {
+	fs := newFlagSet(stopDoc)
+	secret := fs.String("secret", "", "management `secret` printed at startup")
+	if err := fs.Parse(args); err != nil {
+		return fmt.Errorf("failed to parse flags: %w", err)
+	}
+
+	if fs.NArg() < 1 {
+		fs.Usage()
+		return fmt.Errorf("share URL required")
+	}
+	if *secret == "" {
+		fs.Usage()
+		return fmt.Errorf("--secret required")
+	}
+
+	if err := client.Stop(fs.Arg(0), *secret); err != nil {
+		return err
+	}
+	fmt.Println(ui.C.Green + "✓ Server is shutting down" + ui.C.Reset)
+	return nil
+}
+
+var stopDoc = &cli.Command{
+	Name:    "stop",
+	Summary: "Stop a running share remotely",
+	Usage:   []string{"--secret <secret> <url>"},
+	Description: []string{
+		"Gracefully shut down a 'warp send' or 'warp host' server, e.g. one started",
+		"on a headless machine over SSH. The secret is printed when the share starts",
+		"and is different from the share token, so recipients cannot stop it.",
+	},
+	Examples: []cli.Example{
+		{Command: "warp stop --secret 3f9c... http://192.168.1.5:41234/d/<token>"},
+	},
+}
@@ -0,0 +1,88 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/zulfikawr/warp/internal/cli"
+	"github.com/zulfikawr/warp/internal/client"
+	"github.com/zulfikawr/warp/internal/protocol"
+	uipkg "github.com/zulfikawr/warp/internal/ui"
+)
+
+// Top executes the top command
+func Top(g cli.GlobalOptions, args []string) error {
+	fs := newFlagSet(topDoc)
+	interval := fs.Duration("interval", time.Second, "time between polls")
+	user := fs.String("user", "", "HTTP Basic auth user for servers started with --basic-auth")
+	password := fs.String("password", "", "HTTP Basic auth password")
+	if err := fs.Parse(args); err != nil {
+		return fmt.Errorf("failed to parse flags: %w", err)
+	}
+
+	if fs.NArg() < 1 {
+		fs.Usage()
+		return fmt.Errorf("share URL required")
+	}
+	if *interval <= 0 {
+		return fmt.Errorf("--interval must be positive, got %s", *interval)
+	}
+
+	c := client.NewStatsClient(fs.Arg(0))
+	if *user != "" || *password != "" {
+		c.SetBasicAuth(*user, *password)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// The first poll reports a bad URL or an old server before the display starts
+	prev, err := c.Fetch(ctx)
+	if err != nil {
+		return err
+	}
+	r := uipkg.NewRenderer(os.Stdout, g.JSON)
+	r.Start(client.TopState(nil, prev))
+	r.Update(client.TopState(nil, prev))
+
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			r.Finish(uipkg.Summary{})
+			return nil
+		case <-ticker.C:
+		}
+		var cur *protocol.Stats
+		if cur, err = c.Fetch(ctx); err != nil {
+			if ctx.Err() != nil {
+				continue
+			}
+			r.Finish(uipkg.Summary{})
+			return fmt.Errorf("lost connection to the server: %w", err)
+		}
+		r.Update(client.TopState(prev, cur))
+		prev = cur
+	}
+}
+
+var topDoc = &cli.Command{
+	Name:    "top",
+	Summary: "Watch the transfers of a running share",
+	Usage:   []string{"[flags] <url>"},
+	Description: []string{
+		"Poll the stats endpoint of a 'warp send' or 'warp host' server and show",
+		"its active transfers with per-file progress, current throughput and the",
+		"most recent completions. Takes the share or upload URL printed at startup.",
+		"Prometheus scrapers can use /metrics instead, in text or OpenMetrics format.",
+	},
+	Extra: []cli.Flag{{Names: []string{"json"}, Usage: "print each poll as a JSON line"}},
+	Examples: []cli.Example{
+		{Command: "warp top http://192.168.1.5:41234/u/<token>"},
+		{Command: "warp top --interval 5s http://192.168.1.5:41234/d/<token>"},
+	},
+}
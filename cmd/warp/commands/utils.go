@@ -1,18 +1,273 @@
 package commands
 
-// countVerbosity counts how many -v or --verbose flags are in args
-// Returns: verbosity level (0, 1, 2, 3+), filtered args without -v/--verbose
-func countVerbosity(args []string) (int, []string) {
-	verbosity := 0
-	filtered := make([]string, 0, len(args))
-
-	for _, arg := range args {
-		if arg == "-v" || arg == "--verbose" {
-			verbosity++
-		} else {
-			filtered = append(filtered, arg)
+import (
+	"context"
+	stderrors "errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zulfikawr/warp/cmd/warp/ui"
+	"github.com/zulfikawr/warp/internal/archive"
+	"github.com/zulfikawr/warp/internal/client"
+	"github.com/zulfikawr/warp/internal/config"
+	"github.com/zulfikawr/warp/internal/discovery"
+	"github.com/zulfikawr/warp/internal/errors"
+	"github.com/zulfikawr/warp/internal/protocol"
+	"github.com/zulfikawr/warp/internal/relay"
+	"github.com/zulfikawr/warp/internal/schedule"
+	"github.com/zulfikawr/warp/internal/server"
+	uipkg "github.com/zulfikawr/warp/internal/ui"
+)
+
+// Exit statuses other than 0 (success) and 1 (any other error). Scripts rely
+// on these, so they never change meaning.
+const (
+	ExitUsage            = 2 // unknown command or bad global flags
+	ExitChecksumMismatch = 4 // a download, or an upload verified on the host, didn't match its checksum
+)
+
+// ExitCode is the exit status for an error returned by a command
+func ExitCode(err error) int {
+	switch {
+	case err == nil:
+		return 0
+	case stderrors.Is(err, client.ErrChecksumMismatch):
+		return ExitChecksumMismatch
+	}
+	return 1
+}
+
+// parseQuota validates --quota-per-ip and --quota-reset. An empty quota
+// means none.
+func parseQuota(quota string, reset time.Duration) (int64, error) {
+	if reset <= 0 {
+		return 0, errors.NewUserError("--quota-reset must be positive", []string{"Use --quota-reset 168h to reset usage weekly"}, nil)
+	}
+	if quota == "" {
+		return 0, nil
+	}
+	n, err := uipkg.ParseBytes(quota)
+	if err != nil || n <= 0 {
+		return 0, errors.NewUserError("--quota-per-ip must be a size such as 10GB or 500MiB", nil, err)
+	}
+	return n, nil
+}
+
+// parseBasicAuth splits a --basic-auth "user:pass" value. An empty value
+// disables Basic auth.
+func parseBasicAuth(v string) (user, password string, err error) {
+	if v == "" {
+		return "", "", nil
+	}
+	user, password, ok := strings.Cut(v, ":")
+	if !ok || user == "" || password == "" {
+		return "", "", errors.NewUserError("--basic-auth must be in the form user:pass",
+			[]string{"Example: --basic-auth guest:correct-horse"}, nil)
+	}
+	return user, password, nil
+}
+
+// parseDiscovery validates a --discovery value
+func parseDiscovery(v string) (discovery.Mode, error) {
+	mode, err := discovery.ParseMode(v)
+	if err != nil {
+		return "", errors.NewUserError("--discovery must be mdns, broadcast or both",
+			[]string{"Use --discovery both where multicast is filtered (UDP port 8829)"}, err)
+	}
+	return mode, nil
+}
+
+// parseRelay validates a --relay address
+func parseRelay(v string) (string, error) {
+	addr, err := relay.ParseAddr(v)
+	if err != nil {
+		return "", errors.NewUserError("--relay must be host:port, or a host for port 9000",
+			[]string{"Example: --relay relay.example.com:9000"}, err)
+	}
+	return addr, nil
+}
+
+// parseQUIC validates a --quic value
+func parseQUIC(v string) (server.QUICMode, error) {
+	mode, err := server.ParseQUIC(v)
+	if err != nil {
+		return server.QUICMode{}, errors.NewUserError("--quic must be off, auto or a UDP port",
+			[]string{"Use --quic off where UDP is blocked, or --quic 8443 to pick the HTTP/3 port"}, err)
+	}
+	return mode, nil
+}
+
+// parseArchiveOpts validates a --archive-opts value
+func parseArchiveOpts(v string) (archive.Options, error) {
+	opts, err := archive.ParseOptions(v)
+	if err != nil {
+		return archive.Options{}, errors.NewUserError("Invalid --archive-opts value",
+			[]string{"Example: --archive-opts symlinks=store,hidden=false,deterministic"}, err)
+	}
+	return opts, nil
+}
+
+// progressRenderer validates a --progress value and returns a renderer for
+// out. --json takes precedence over it.
+func progressRenderer(out io.Writer, jsonOut bool, v string) (uipkg.Renderer, error) {
+	mode, err := progressMode(v)
+	if err != nil {
+		return nil, err
+	}
+	return uipkg.NewModeRenderer(out, jsonOut, mode), nil
+}
+
+// progressMode parses a --progress value
+func progressMode(v string) (uipkg.ProgressMode, error) {
+	mode, err := uipkg.ParseProgressMode(v)
+	if err != nil {
+		return "", errors.NewUserError("--progress must be auto, bar, plain or none",
+			[]string{"Use --progress plain for CI logs, or --progress none to print only the summary"}, err)
+	}
+	return mode, nil
+}
+
+// uploadLimits returns the upload bounds set in the config, which hosts
+// enforce and advertise in their capabilities
+func uploadLimits(cfg *config.Config) protocol.Limits {
+	limits := protocol.DefaultLimits()
+	limits.MaxTotalSize = cfg.MaxUploadSize
+	limits.MaxChunks = cfg.MaxChunks
+	limits.MaxChunkSize = int64(cfg.MaxChunkSizeMB) << 20
+	limits.MaxSessionIdleTime = time.Duration(cfg.SessionIdleMin) * time.Minute
+	return limits
+}
+
+// parseDirMode validates a --dest-mode value such as 0700
+func parseDirMode(v string) (os.FileMode, error) {
+	mode, err := strconv.ParseUint(v, 8, 32)
+	if err != nil || mode > 0o777 || mode&0o300 != 0o300 {
+		return 0, errors.NewUserError(fmt.Sprintf("--dest-mode must be octal permissions the owner can write and enter, got %q", v),
+			[]string{"Use --dest-mode 0700 to keep uploads private to your user"}, err)
+	}
+	return os.FileMode(mode), nil
+}
+
+// stringList is a repeatable flag that also accepts comma-separated values.
+// Values given on the command line replace the configured defaults.
+type stringList struct {
+	values []string
+	set    bool
+}
+
+func newStringList(defaults []string) *stringList {
+	return &stringList{values: defaults}
+}
+
+func (l *stringList) String() string {
+	if l == nil {
+		return ""
+	}
+	return strings.Join(l.values, ",")
+}
+
+func (l *stringList) Set(v string) error {
+	if !l.set {
+		l.values, l.set = nil, true
+	}
+	for _, part := range strings.Split(v, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			l.values = append(l.values, part)
 		}
 	}
+	return nil
+}
+
+// parseIPFilter validates the --allow-ip and --deny-ip lists
+func parseIPFilter(allow, deny *stringList) (allowed, denied []netip.Prefix, err error) {
+	suggestions := []string{"Use a CIDR such as --allow-ip 10.1.2.0/24 or a single address such as --deny-ip 10.1.2.7"}
+	if allowed, err = server.ParseIPList(allow.values); err != nil {
+		return nil, nil, errors.NewUserError("Invalid --allow-ip value", suggestions, err)
+	}
+	if denied, err = server.ParseIPList(deny.values); err != nil {
+		return nil, nil, errors.NewUserError("Invalid --deny-ip value", suggestions, err)
+	}
+	return allowed, denied, nil
+}
 
-	return verbosity, filtered
+// qrOptions is how send and host draw QR codes: in the largest mode that
+// fits the terminal, with colors unless they are off
+func qrOptions(invert bool) uipkg.QROpts {
+	return uipkg.QROpts{Invert: invert, Color: ui.ColorsEnabled()}
+}
+
+// flagSet reports whether name was given on the command line
+func flagSet(fs *flag.FlagSet, name string) bool {
+	set := false
+	fs.Visit(func(f *flag.Flag) {
+		set = set || f.Name == name
+	})
+	return set
+}
+
+// lowMemoryMode settles low-memory mode: --low-memory when given, else
+// low_memory from the config, else on by itself when the machine has less
+// than config.LowMemoryThreshold of RAM, which is then reported along with
+// what the server tunes down: its buffers, compression and progress updates,
+// and the command's own tuned settings.
+func lowMemoryMode(fs *flag.FlagSet, flagValue bool, cfg *config.Config, tuned ...string) bool {
+	var detected int64
+	if flagSet(fs, "low-memory") {
+		cfg.LowMemory = flagValue
+	} else if total, err := config.TotalMemory(); err == nil && cfg.DetectLowMemory(total) {
+		detected = total
+	}
+	if !cfg.LowMemory {
+		return false
+	}
+	if detected > 0 {
+		fmt.Fprintf(os.Stderr, "%sLow memory detected (%s total), tuned for a small device:%s\n", ui.C.Yellow, uipkg.FormatBytes(detected), ui.C.Reset)
+		changed := append([]string{
+			fmt.Sprintf("I/O buffers at most %s", uipkg.FormatBytes(server.LowMemoryBufferSize)),
+			"compression off",
+			fmt.Sprintf("progress updates at most every %s", server.LowMemoryWebSocketInterval),
+		}, tuned...)
+		for _, c := range changed {
+			fmt.Fprintf(os.Stderr, "  %s\n", c)
+		}
+		fmt.Fprintf(os.Stderr, "%sUse --low-memory=false or low_memory: false in the config to turn this off%s\n", ui.C.Dim, ui.C.Reset)
+	}
+	return true
+}
+
+// parseStart validates --start-at and --start-in. The zero time means start
+// now.
+func parseStart(at, in string) (time.Time, error) {
+	start, err := schedule.Start(at, in, time.Now())
+	if err != nil {
+		return time.Time{}, errors.NewUserError("Invalid --start-at or --start-in: "+err.Error(),
+			[]string{"Use --start-at 18:00 (today, or tomorrow once it has passed) or --start-in 2h"}, err)
+	}
+	return start, nil
+}
+
+// waitForStart prints the planned start and counts down to it on stderr. It
+// returns ctx's error when interrupted first.
+func waitForStart(ctx context.Context, start time.Time) error {
+	fmt.Fprintf(os.Stderr, "%sScheduled to start at %s (in %s)%s\n", ui.C.Cyan,
+		start.Format("Mon Jan 2 15:04:05"), uipkg.FormatDuration(time.Until(start)), ui.C.Reset)
+	tty := uipkg.IsTerminal(os.Stderr)
+	err := schedule.Wait(ctx, start, func(left time.Duration) {
+		if tty {
+			fmt.Fprintf(os.Stderr, "\r%sStarting in %s%s\033[K", ui.C.Dim, uipkg.FormatDuration(left), ui.C.Reset)
+		}
+	})
+	if tty {
+		fmt.Fprint(os.Stderr, "\r\033[K")
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Cancelled before the scheduled start")
+	}
+	return err
 }
@@ -0,0 +1,34 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/zulfikawr/warp/internal/client"
+	warperrors "github.com/zulfikawr/warp/internal/errors"
+)
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"success", nil, 0},
+		{"plain error", errors.New("connection refused"), 1},
+		{"user error", warperrors.NewUserError("bad flag", nil, nil), 1},
+		{"checksum mismatch", client.ErrChecksumMismatch, ExitChecksumMismatch},
+		{"wrapped mismatch", fmt.Errorf("%w (transfer ab12): expected 1234, got 5678", client.ErrChecksumMismatch), ExitChecksumMismatch},
+		{"mismatch in user error", warperrors.NewUserError("download failed", nil, client.ErrChecksumMismatch), ExitChecksumMismatch},
+	}
+	for _, tt := range tests {
+		if got := ExitCode(tt.err); got != tt.want {
+			t.Errorf("%s: ExitCode = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+	// Scripts depend on these numbers
+	if ExitChecksumMismatch != 4 || ExitUsage != 2 {
+		t.Errorf("exit statuses changed: usage %d, checksum %d", ExitUsage, ExitChecksumMismatch)
+	}
+}
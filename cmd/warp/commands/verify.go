@@ -0,0 +1,95 @@
+package commands
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/zulfikawr/warp/cmd/warp/ui"
+	"github.com/zulfikawr/warp/internal/cli"
+	"github.com/zulfikawr/warp/internal/client"
+	"github.com/zulfikawr/warp/internal/errors"
+	uipkg "github.com/zulfikawr/warp/internal/ui"
+)
+
+// verifyInfoTimeout bounds fetching the expected checksum from a share,
+// which may have to hash the file first
+const verifyInfoTimeout = 5 * time.Minute
+
+// Verify executes the verify command
+func Verify(g cli.GlobalOptions, args []string) error {
+	fs := newFlagSet(verifyDoc)
+	algo := fs.String("algo", "sha256", "hash `algorithm`; sha256 is the only one warp shares use")
+	user := fs.String("user", "", "HTTP Basic auth user for servers started with --basic-auth")
+	password := fs.String("password", "", "HTTP Basic auth password")
+	if err := fs.Parse(args); err != nil {
+		return fmt.Errorf("failed to parse flags: %w", err)
+	}
+
+	if fs.NArg() < 2 {
+		fs.Usage()
+		return fmt.Errorf("file and share URL or SHA-256 required")
+	}
+	if *algo != "sha256" {
+		return errors.NewUserError(fmt.Sprintf("unsupported --algo %q", *algo),
+			[]string{"Shares announce SHA-256 checksums only; leave out --algo"}, nil)
+	}
+	path, target := fs.Arg(0), fs.Arg(1)
+
+	want, err := client.ParseSHA256(target)
+	if err != nil {
+		url, uerr := client.NormalizeReceiveURL(target, "", "")
+		if uerr != nil {
+			return errors.NewUserError(fmt.Sprintf("%q is neither a SHA-256 digest nor a share URL", target),
+				[]string{"Pass the 64 hex digits of the checksum, or the URL of the running share"}, nil)
+		}
+		d := client.NewDownloader(nil)
+		if *user != "" || *password != "" {
+			d.SetBasicAuth(*user, *password)
+		}
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		ctx, cancel := context.WithTimeout(ctx, verifyInfoTimeout)
+		defer cancel()
+		if want, err = d.ShareSHA256(ctx, url); err != nil {
+			return fmt.Errorf("failed to get the share's checksum: %w", err)
+		}
+	}
+
+	// The bar goes to stderr, so stdout holds only the verdict
+	var renderer uipkg.Renderer
+	if !g.Quiet && uipkg.IsTerminal(os.Stderr) {
+		renderer = uipkg.NewANSIRenderer(os.Stderr)
+	}
+	got, err := client.VerifyFile(path, want, renderer)
+	if stderrors.Is(err, os.ErrNotExist) {
+		return errors.FileNotFoundError(path, err)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s✓ %s matches%s (sha256 %s)\n", ui.C.Green, path, ui.C.Reset, got)
+	return nil
+}
+
+var verifyDoc = &cli.Command{
+	Name:    "verify",
+	Summary: "Check a file against a share's checksum",
+	Usage:   []string{"[flags] <file> <url|sha256>"},
+	Description: []string{
+		"Hash a local file and compare it with a SHA-256 digest, either given as",
+		"64 hex digits or read from a 'warp send' share that is still running, so a",
+		"received file can be checked again without downloading it. Only single-file",
+		"shares announce a checksum.",
+		"Exits 0 when the file matches, 4 when it doesn't and 1 on any other error,",
+		"such as a missing file or an unreachable share.",
+	},
+	Examples: []cli.Example{
+		{Command: "warp verify report.pdf http://192.168.1.5:41234/d/<token>"},
+		{Command: "warp verify backup.tar 9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"},
+	},
+}
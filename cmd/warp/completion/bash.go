@@ -13,7 +13,7 @@ _warp_completion() {
     
     # Main commands
     if [ $COMP_CWORD -eq 1 ]; then
-        opts="send host receive search config completion"
+        opts="send host receive push search stop top ping verify doctor relay config help completion"
         COMPREPLY=( $(compgen -W "${opts}" -- ${cur}) )
         return 0
     fi
@@ -21,7 +21,7 @@ _warp_completion() {
     # Subcommand completion
     case "${COMP_WORDS[1]}" in
         send)
-            opts="-p --port -i --interface --text --stdin --rate-limit --cache-size --no-qr -h --help"
+            opts="-p --port -i --interface --text --stdin --rate-limit --quota-per-ip --quota-reset --cache-size --inline --allow-return --return-dir --basic-auth --discovery --short --quic --allow-ip --deny-ip --trust-proxy --trust-proxy-cidr --zip --archive-opts --low-memory --start-at --start-in --precompute --mtime-granularity --follow --media --relay --no-qr --qr-invert -h --help"
             COMPREPLY=( $(compgen -W "${opts}" -- ${cur}) )
             # File completion for paths
             if [[ ! ${cur} == -* ]]; then
@@ -29,23 +29,63 @@ _warp_completion() {
             fi
             ;;
         host)
-            opts="-i --interface -d --dest --rate-limit --no-qr -h --help"
+            opts="-i --interface -d --dest --dest-mode --dest-unique --rate-limit --max-transfers --quota-per-ip --quota-reset --max-file-size --allow-ext --preserve --allow-append --no-splice --async-verify --sync-policy --scan-cmd --scan-timeout --organize --json --progress --basic-auth --discovery --short --quic --allow-ip --deny-ip --trust-proxy --trust-proxy-cidr --low-memory --notify --expect --expect-count --completion-file --exit-when-complete --page-template --no-qr --qr-invert -h --help"
             COMPREPLY=( $(compgen -W "${opts}" -- ${cur}) )
             ;;
         receive)
-            opts="-o --output -f --force --workers --chunk-size --no-checksum -h --help"
+            opts="-o --output -f --force --host --token --preserve --json --progress --directory --codes --extract --keep-archive --mirror --follow --discovery --scan --user --password --workers --chunk-size --no-checksum --sha256 --sha256-file --keep-on-mismatch --notify --relay -y --yes -h --help"
             COMPREPLY=( $(compgen -W "${opts}" -- ${cur}) )
             ;;
+        push)
+            opts="-m --manifest --result --fail-fast --progress --parallel --chunk-size --no-checksum --start-at --start-in --precompute --append --confirm-size --confirm-files -y --yes -h --help"
+            COMPREPLY=( $(compgen -W "${opts}" -- ${cur}) )
+            if [[ ${prev} == "-m" || ${prev} == "--manifest" || ${prev} == "--result" ]]; then
+                COMPREPLY=( $(compgen -f -- ${cur}) )
+            fi
+            ;;
         search)
-            opts="--timeout -h --help"
+            opts="--timeout --discovery --scan -h --help"
+            COMPREPLY=( $(compgen -W "${opts}" -- ${cur}) )
+            ;;
+        stop)
+            opts="--secret -h --help"
+            COMPREPLY=( $(compgen -W "${opts}" -- ${cur}) )
+            ;;
+        top)
+            opts="--interval --user --password --json -h --help"
+            COMPREPLY=( $(compgen -W "${opts}" -- ${cur}) )
+            ;;
+        ping)
+            opts="--count --interval --json -h --help"
+            COMPREPLY=( $(compgen -W "${opts}" -- ${cur}) )
+            ;;
+        verify)
+            opts="--algo --user --password -h --help"
+            COMPREPLY=( $(compgen -W "${opts}" -- ${cur}) )
+            if [[ ! ${cur} == -* ]]; then
+                COMPREPLY=( $(compgen -f -- ${cur}) )
+            fi
+            ;;
+        doctor)
+            opts="-i --interface -p --port -d --dest --timeout -h --help"
+            COMPREPLY=( $(compgen -W "${opts}" -- ${cur}) )
+            ;;
+        relay)
+            opts="--listen --rate-limit --idle-timeout --pair-timeout -h --help"
             COMPREPLY=( $(compgen -W "${opts}" -- ${cur}) )
             ;;
         config)
             if [ $COMP_CWORD -eq 2 ]; then
                 opts="show edit path"
                 COMPREPLY=( $(compgen -W "${opts}" -- ${cur}) )
+            elif [ "${COMP_WORDS[2]}" = "show" ]; then
+                COMPREPLY=( $(compgen -W "--origin" -- ${cur}) )
             fi
             ;;
+        help)
+            opts="--man send host receive push search speedtest stop top ping verify doctor relay config"
+            COMPREPLY=( $(compgen -W "${opts}" -- ${cur}) )
+            ;;
         completion)
             if [ $COMP_CWORD -eq 2 ]; then
                 opts="bash zsh fish powershell"
@@ -10,8 +10,16 @@ func Fish() {
 complete -c warp -f -n '__fish_use_subcommand' -a send -d 'Share a file, directory, or text snippet'
 complete -c warp -f -n '__fish_use_subcommand' -a host -d 'Receive uploads into a directory'
 complete -c warp -f -n '__fish_use_subcommand' -a receive -d 'Download from a warp URL'
+complete -c warp -f -n '__fish_use_subcommand' -a push -d 'Upload the files of a manifest to a warp host'
 complete -c warp -f -n '__fish_use_subcommand' -a search -d 'Discover nearby warp hosts'
+complete -c warp -f -n '__fish_use_subcommand' -a stop -d 'Stop a running share remotely'
+complete -c warp -f -n '__fish_use_subcommand' -a top -d 'Watch the transfers of a running share'
+complete -c warp -f -n '__fish_use_subcommand' -a ping -d 'Check that a warp server is reachable'
+complete -c warp -f -n '__fish_use_subcommand' -a verify -d 'Check a file against the checksum of a share'
+complete -c warp -f -n '__fish_use_subcommand' -a doctor -d 'Diagnose network and environment problems'
+complete -c warp -f -n '__fish_use_subcommand' -a relay -d 'Pair senders and receivers that can't reach each other'
 complete -c warp -f -n '__fish_use_subcommand' -a config -d 'Manage configuration file'
+complete -c warp -f -n '__fish_use_subcommand' -a help -d 'Show the help of a command'
 complete -c warp -f -n '__fish_use_subcommand' -a completion -d 'Generate shell completion scripts'
 
 # send command
@@ -20,33 +28,172 @@ complete -c warp -f -n '__fish_seen_subcommand_from send' -s i -l interface -d '
 complete -c warp -f -n '__fish_seen_subcommand_from send' -l text -d 'Send text snippet'
 complete -c warp -f -n '__fish_seen_subcommand_from send' -l stdin -d 'Read from stdin'
 complete -c warp -f -n '__fish_seen_subcommand_from send' -l rate-limit -d 'Bandwidth limit in Mbps'
+complete -c warp -f -n '__fish_seen_subcommand_from send' -l quota-per-ip -d 'Bytes each client may transfer, e.g. 10GB'
+complete -c warp -f -n '__fish_seen_subcommand_from send' -l quota-reset -d 'How often quota usage starts over'
 complete -c warp -f -n '__fish_seen_subcommand_from send' -l cache-size -d 'Cache size in MB'
+complete -c warp -f -n '__fish_seen_subcommand_from send' -l inline -d 'Let browsers preview the file'
+complete -c warp -f -n '__fish_seen_subcommand_from send' -l allow-return -d 'Let the recipient upload files back'
+complete -c warp -n '__fish_seen_subcommand_from send' -l return-dir -r -a '(__fish_complete_directories)' -d 'Where returned files go'
+complete -c warp -f -n '__fish_seen_subcommand_from send' -l basic-auth -d 'Require HTTP Basic auth (user:pass)'
+complete -c warp -f -n '__fish_seen_subcommand_from send' -l discovery -xa 'mdns broadcast both' -d 'How to announce the share'
+complete -c warp -f -n '__fish_seen_subcommand_from send' -l short -d 'Also serve a short /s/ URL'
+complete -c warp -f -n '__fish_seen_subcommand_from send' -l quic -xa 'off auto' -d 'HTTP/3 listener: off, auto or a UDP port'
+complete -c warp -f -n '__fish_seen_subcommand_from send' -l allow-ip -x -d 'Only serve this CIDR or IP'
+complete -c warp -f -n '__fish_seen_subcommand_from send' -l deny-ip -x -d 'Refuse this CIDR or IP'
+complete -c warp -f -n '__fish_seen_subcommand_from send' -l trust-proxy -d 'Trust X-Forwarded-For'
+complete -c warp -f -n '__fish_seen_subcommand_from send' -l trust-proxy-cidr -d 'Trust X-Forwarded-For from proxies in this CIDR'
+complete -c warp -f -n '__fish_seen_subcommand_from send' -l archive-opts -d 'How zips are built (symlinks, hidden, deterministic, mtime)'
+complete -c warp -f -n '__fish_seen_subcommand_from send' -l low-memory -d 'Tune for a small device'
+complete -c warp -f -n '__fish_seen_subcommand_from send' -l zip -d 'Zip matched files even if only one'
+complete -c warp -f -n '__fish_seen_subcommand_from send' -l start-at -x -d 'Start serving at HH:MM'
+complete -c warp -f -n '__fish_seen_subcommand_from send' -l start-in -x -d 'Start serving after a delay'
+complete -c warp -f -n '__fish_seen_subcommand_from send' -l precompute -d 'Compute the checksum now'
+complete -c warp -f -n '__fish_seen_subcommand_from send' -l mtime-granularity -d 'Rehash files changed this recently' -r
+complete -c warp -f -n '__fish_seen_subcommand_from send' -l follow -d 'Stream a growing file like tail -f'
+complete -c warp -f -n '__fish_seen_subcommand_from send' -l media -d 'Serve an M3U playlist of audio and video'
+complete -c warp -f -n '__fish_seen_subcommand_from send' -l relay -d 'Also serve through a warp relay'
 complete -c warp -f -n '__fish_seen_subcommand_from send' -l no-qr -d 'Skip QR code'
+complete -c warp -f -n '__fish_seen_subcommand_from send' -l qr-invert -d 'QR code for a light terminal background'
 complete -c warp -f -n '__fish_seen_subcommand_from send' -s h -l help -d 'Show help'
 
 # host command
 complete -c warp -f -n '__fish_seen_subcommand_from host' -s i -l interface -d 'Network interface'
 complete -c warp -f -n '__fish_seen_subcommand_from host' -s d -l dest -d 'Destination directory'
+complete -c warp -f -n '__fish_seen_subcommand_from host' -l dest-mode -x -d 'Octal mode of created directories'
+complete -c warp -f -n '__fish_seen_subcommand_from host' -l dest-unique -d 'New warp-<token> directory per session'
 complete -c warp -f -n '__fish_seen_subcommand_from host' -l rate-limit -d 'Bandwidth limit in Mbps'
+complete -c warp -f -n '__fish_seen_subcommand_from host' -l max-transfers -d 'Max concurrent transfers'
+complete -c warp -f -n '__fish_seen_subcommand_from host' -l quota-per-ip -d 'Bytes each client may upload, e.g. 10GB'
+complete -c warp -f -n '__fish_seen_subcommand_from host' -l quota-reset -d 'How often quota usage starts over'
+complete -c warp -f -n '__fish_seen_subcommand_from host' -l preserve -d 'Keep uploaded mtime and mode'
+complete -c warp -f -n '__fish_seen_subcommand_from host' -l allow-append -d 'Let push --append extend files'
+complete -c warp -f -n '__fish_seen_subcommand_from host' -l max-file-size -d 'Largest accepted upload in MB'
+complete -c warp -f -n '__fish_seen_subcommand_from host' -l allow-ext -d 'Accepted file extensions'
+complete -c warp -f -n '__fish_seen_subcommand_from host' -l no-splice -d 'Copy raw uploads through a buffer'
+complete -c warp -f -n '__fish_seen_subcommand_from host' -l async-verify -d 'Verify uploads in the background'
+complete -c warp -f -n '__fish_seen_subcommand_from host' -l sync-policy -xa 'file chunk none' -d 'When to fsync uploads'
+complete -c warp -f -n '__fish_seen_subcommand_from host' -l scan-cmd -x -d 'Scan each upload with this command before keeping it'
+complete -c warp -f -n '__fish_seen_subcommand_from host' -l scan-timeout -x -d 'Time limit for one scan'
+complete -c warp -f -n '__fish_seen_subcommand_from host' -l organize -xa 'date sender none' -d 'File uploads into subdirectories'
+complete -c warp -f -n '__fish_seen_subcommand_from host' -l json -d 'Print progress as JSON lines'
+complete -c warp -f -n '__fish_seen_subcommand_from host' -l progress -xa 'auto bar plain none' -d 'Progress display'
+complete -c warp -f -n '__fish_seen_subcommand_from host' -l basic-auth -d 'Require HTTP Basic auth (user:pass)'
+complete -c warp -f -n '__fish_seen_subcommand_from host' -l discovery -xa 'mdns broadcast both' -d 'How to announce the host'
+complete -c warp -f -n '__fish_seen_subcommand_from host' -l short -d 'Also serve a short /s/ URL'
+complete -c warp -f -n '__fish_seen_subcommand_from host' -l quic -xa 'off auto' -d 'HTTP/3 listener: off, auto or a UDP port'
+complete -c warp -f -n '__fish_seen_subcommand_from host' -l allow-ip -x -d 'Only serve this CIDR or IP'
+complete -c warp -f -n '__fish_seen_subcommand_from host' -l deny-ip -x -d 'Refuse this CIDR or IP'
+complete -c warp -f -n '__fish_seen_subcommand_from host' -l trust-proxy -d 'Trust X-Forwarded-For'
+complete -c warp -f -n '__fish_seen_subcommand_from host' -l trust-proxy-cidr -d 'Trust X-Forwarded-For from proxies in this CIDR'
+complete -c warp -f -n '__fish_seen_subcommand_from host' -l low-memory -d 'Tune for a small device'
+complete -c warp -f -n '__fish_seen_subcommand_from host' -l notify -d 'Desktop notification when an upload finishes'
+complete -c warp -f -n '__fish_seen_subcommand_from host' -l expect -x -d 'Wait for an upload with this name or glob'
+complete -c warp -f -n '__fish_seen_subcommand_from host' -l expect-count -x -d 'Wait for this many matching uploads'
+complete -c warp -n '__fish_seen_subcommand_from host' -l completion-file -r -d 'JSON file listing the matching uploads'
+complete -c warp -n '__fish_seen_subcommand_from host' -l page-template -r -d 'HTML template for the upload page'
+complete -c warp -f -n '__fish_seen_subcommand_from host' -l exit-when-complete -d 'Stop once the expected uploads arrived'
 complete -c warp -f -n '__fish_seen_subcommand_from host' -l no-qr -d 'Skip QR code'
+complete -c warp -f -n '__fish_seen_subcommand_from host' -l qr-invert -d 'QR code for a light terminal background'
 complete -c warp -f -n '__fish_seen_subcommand_from host' -s h -l help -d 'Show help'
 
 # receive command
 complete -c warp -f -n '__fish_seen_subcommand_from receive' -s o -l output -d 'Output file'
 complete -c warp -f -n '__fish_seen_subcommand_from receive' -s f -l force -d 'Force overwrite'
+complete -c warp -f -n '__fish_seen_subcommand_from receive' -l host -d 'Server host:port'
+complete -c warp -f -n '__fish_seen_subcommand_from receive' -l token -d 'Transfer token'
 complete -c warp -f -n '__fish_seen_subcommand_from receive' -l workers -d 'Parallel workers'
 complete -c warp -f -n '__fish_seen_subcommand_from receive' -l chunk-size -d 'Chunk size in MB'
 complete -c warp -f -n '__fish_seen_subcommand_from receive' -l no-checksum -d 'Skip checksum'
+complete -c warp -f -n '__fish_seen_subcommand_from receive' -l preserve -d 'Keep mtime and mode'
+complete -c warp -f -n '__fish_seen_subcommand_from receive' -l json -d 'Print progress as JSON lines'
+complete -c warp -f -n '__fish_seen_subcommand_from receive' -l progress -xa 'auto bar plain none' -d 'Progress display'
+complete -c warp -f -n '__fish_seen_subcommand_from receive' -l directory -d 'Keep receiving into directory'
+complete -c warp -f -n '__fish_seen_subcommand_from receive' -l codes -d 'Prompt for PAKE codes in batch mode'
+complete -c warp -f -n '__fish_seen_subcommand_from receive' -l extract -d 'Unpack a received archive'
+complete -c warp -f -n '__fish_seen_subcommand_from receive' -l keep-archive -d 'Keep the archive after --extract'
+complete -c warp -f -n '__fish_seen_subcommand_from receive' -l mirror -d 'Fetch a shared directory file by file'
+complete -c warp -f -n '__fish_seen_subcommand_from receive' -l follow -d 'Stream a growing file to stdout'
+complete -c warp -f -n '__fish_seen_subcommand_from receive' -l discovery -xa 'mdns broadcast both' -d 'How to find servers'
+complete -c warp -f -n '__fish_seen_subcommand_from receive' -l scan -d 'Also probe every host of a CIDR'
+complete -c warp -f -n '__fish_seen_subcommand_from receive' -l user -d 'HTTP Basic auth user'
+complete -c warp -f -n '__fish_seen_subcommand_from receive' -l password -d 'HTTP Basic auth password'
+complete -c warp -f -n '__fish_seen_subcommand_from receive' -l sha256 -d 'SHA-256 the file must have'
+complete -c warp -n '__fish_seen_subcommand_from receive' -l sha256-file -r -d 'Look the SHA-256 up in a sha256sum file'
+complete -c warp -f -n '__fish_seen_subcommand_from receive' -l keep-on-mismatch -d 'Keep a file that fails its checksum'
+complete -c warp -f -n '__fish_seen_subcommand_from receive' -l notify -d 'Desktop notification when the download finishes'
+complete -c warp -f -n '__fish_seen_subcommand_from receive' -l relay -d 'Download through a warp relay'
+complete -c warp -f -n '__fish_seen_subcommand_from receive' -s y -l yes -d 'Skip confirming the verification words'
 complete -c warp -f -n '__fish_seen_subcommand_from receive' -s h -l help -d 'Show help'
 
 # search command
 complete -c warp -f -n '__fish_seen_subcommand_from search' -l timeout -d 'Discovery timeout'
+complete -c warp -f -n '__fish_seen_subcommand_from search' -l discovery -xa 'mdns broadcast both' -d 'How to find servers'
+complete -c warp -f -n '__fish_seen_subcommand_from search' -l scan -d 'Also probe every host of a CIDR'
 complete -c warp -f -n '__fish_seen_subcommand_from search' -s h -l help -d 'Show help'
 
+# stop command
+complete -c warp -f -n '__fish_seen_subcommand_from stop' -l secret -d 'Management secret'
+complete -c warp -f -n '__fish_seen_subcommand_from stop' -s h -l help -d 'Show help'
+
+# push command
+complete -c warp -n '__fish_seen_subcommand_from push' -s m -l manifest -r -d 'YAML or JSON manifest'
+complete -c warp -n '__fish_seen_subcommand_from push' -l result -r -d 'Write a JSON result to this file'
+complete -c warp -f -n '__fish_seen_subcommand_from push' -l fail-fast -d 'Stop at the first failed file'
+complete -c warp -f -n '__fish_seen_subcommand_from push' -l progress -xa 'auto bar plain none' -d 'Progress display'
+complete -c warp -f -n '__fish_seen_subcommand_from push' -l parallel -d 'Chunk uploads in flight'
+complete -c warp -f -n '__fish_seen_subcommand_from push' -l chunk-size -d 'Chunk size in MB'
+complete -c warp -f -n '__fish_seen_subcommand_from push' -l no-checksum -d 'Skip host checksum verification'
+complete -c warp -f -n '__fish_seen_subcommand_from push' -l start-at -x -d 'Start uploading at HH:MM'
+complete -c warp -f -n '__fish_seen_subcommand_from push' -l start-in -x -d 'Start uploading after a delay'
+complete -c warp -f -n '__fish_seen_subcommand_from push' -l precompute -d 'Hash every file now'
+complete -c warp -f -n '__fish_seen_subcommand_from push' -l append -d 'Append new bytes to the host copy'
+complete -c warp -f -n '__fish_seen_subcommand_from push' -l confirm-size -x -d 'Ask before pushing more than this size'
+complete -c warp -f -n '__fish_seen_subcommand_from push' -l confirm-files -x -d 'Ask before pushing more files than this'
+complete -c warp -f -n '__fish_seen_subcommand_from push' -s y -l yes -d 'Push without asking'
+complete -c warp -f -n '__fish_seen_subcommand_from push' -s h -l help -d 'Show help'
+
+# top command
+complete -c warp -f -n '__fish_seen_subcommand_from top' -l interval -d 'Time between polls'
+complete -c warp -f -n '__fish_seen_subcommand_from top' -l user -d 'HTTP Basic auth user'
+complete -c warp -f -n '__fish_seen_subcommand_from top' -l password -d 'HTTP Basic auth password'
+complete -c warp -f -n '__fish_seen_subcommand_from top' -l json -d 'Print each poll as a JSON line'
+complete -c warp -f -n '__fish_seen_subcommand_from top' -s h -l help -d 'Show help'
+
+# ping command
+complete -c warp -f -n '__fish_seen_subcommand_from ping' -l count -d 'Number of probes'
+complete -c warp -f -n '__fish_seen_subcommand_from ping' -l interval -d 'Time between probes'
+complete -c warp -f -n '__fish_seen_subcommand_from ping' -l json -d 'Print the summary as JSON'
+complete -c warp -f -n '__fish_seen_subcommand_from ping' -s h -l help -d 'Show help'
+
+# verify command
+complete -c warp -f -n '__fish_seen_subcommand_from verify' -l algo -x -a 'sha256' -d 'Hash algorithm'
+complete -c warp -f -n '__fish_seen_subcommand_from verify' -l user -d 'HTTP Basic auth user'
+complete -c warp -f -n '__fish_seen_subcommand_from verify' -l password -d 'HTTP Basic auth password'
+complete -c warp -f -n '__fish_seen_subcommand_from verify' -s h -l help -d 'Show help'
+
+# doctor command
+complete -c warp -f -n '__fish_seen_subcommand_from doctor' -s i -l interface -d 'Network interface'
+complete -c warp -f -n '__fish_seen_subcommand_from doctor' -s p -l port -d 'Port to test'
+complete -c warp -f -n '__fish_seen_subcommand_from doctor' -s d -l dest -d 'Upload directory'
+complete -c warp -f -n '__fish_seen_subcommand_from doctor' -l timeout -d 'mDNS loopback timeout'
+complete -c warp -f -n '__fish_seen_subcommand_from doctor' -s h -l help -d 'Show help'
+
+# relay command
+complete -c warp -f -n '__fish_seen_subcommand_from relay' -l listen -d 'Address to listen on'
+complete -c warp -f -n '__fish_seen_subcommand_from relay' -l rate-limit -d 'Bandwidth limit per pair in Mbps'
+complete -c warp -f -n '__fish_seen_subcommand_from relay' -l idle-timeout -d 'Close pairs idle this long'
+complete -c warp -f -n '__fish_seen_subcommand_from relay' -l pair-timeout -d 'How long a receiver waits for the sender'
+complete -c warp -f -n '__fish_seen_subcommand_from relay' -s h -l help -d 'Show help'
+
 # config command
 complete -c warp -f -n '__fish_seen_subcommand_from config' -a 'show' -d 'Display current configuration'
 complete -c warp -f -n '__fish_seen_subcommand_from config' -a 'edit' -d 'Open config file in editor'
 complete -c warp -f -n '__fish_seen_subcommand_from config' -a 'path' -d 'Show config file path'
+complete -c warp -f -n '__fish_seen_subcommand_from show' -l origin -d 'Show where each value came from'
+
+# help command
+complete -c warp -f -n '__fish_seen_subcommand_from help' -l man -d 'Write a troff man page'
+complete -c warp -f -n '__fish_seen_subcommand_from help' -a 'send host receive push search speedtest stop top ping verify doctor relay config'
 
 # completion command
 complete -c warp -f -n '__fish_seen_subcommand_from completion' -a 'bash' -d 'Bash completion'
@@ -13,8 +13,16 @@ Register-ArgumentCompleter -Native -CommandName warp -ScriptBlock {
         [System.Management.Automation.CompletionResult]::new('send', 'send', [System.Management.Automation.CompletionResultType]::ParameterValue, 'Share a file')
         [System.Management.Automation.CompletionResult]::new('host', 'host', [System.Management.Automation.CompletionResultType]::ParameterValue, 'Receive uploads')
         [System.Management.Automation.CompletionResult]::new('receive', 'receive', [System.Management.Automation.CompletionResultType]::ParameterValue, 'Download from URL')
+        [System.Management.Automation.CompletionResult]::new('push', 'push', [System.Management.Automation.CompletionResultType]::ParameterValue, 'Upload a manifest')
         [System.Management.Automation.CompletionResult]::new('search', 'search', [System.Management.Automation.CompletionResultType]::ParameterValue, 'Discover hosts')
+        [System.Management.Automation.CompletionResult]::new('stop', 'stop', [System.Management.Automation.CompletionResultType]::ParameterValue, 'Stop a share')
+        [System.Management.Automation.CompletionResult]::new('top', 'top', [System.Management.Automation.CompletionResultType]::ParameterValue, 'Watch transfers')
+        [System.Management.Automation.CompletionResult]::new('ping', 'ping', [System.Management.Automation.CompletionResultType]::ParameterValue, 'Check reachability')
+        [System.Management.Automation.CompletionResult]::new('verify', 'verify', [System.Management.Automation.CompletionResultType]::ParameterValue, 'Check a file')
+        [System.Management.Automation.CompletionResult]::new('doctor', 'doctor', [System.Management.Automation.CompletionResultType]::ParameterValue, 'Diagnose problems')
+        [System.Management.Automation.CompletionResult]::new('relay', 'relay', [System.Management.Automation.CompletionResultType]::ParameterValue, 'Run a relay')
         [System.Management.Automation.CompletionResult]::new('config', 'config', [System.Management.Automation.CompletionResultType]::ParameterValue, 'Manage config')
+        [System.Management.Automation.CompletionResult]::new('help', 'help', [System.Management.Automation.CompletionResultType]::ParameterValue, 'Show command help')
         [System.Management.Automation.CompletionResult]::new('completion', 'completion', [System.Management.Automation.CompletionResultType]::ParameterValue, 'Generate completion')
     )
 
@@ -20,8 +20,16 @@ _warp() {
                 'send:Share a file, directory, or text snippet'
                 'host:Receive uploads into a directory'
                 'receive:Download from a warp URL'
+                'push:Upload the files of a manifest to a warp host'
                 'search:Discover nearby warp hosts'
+                'stop:Stop a running share remotely'
+                'top:Watch the transfers of a running share'
+                'ping:Check that a warp server is reachable'
+                'verify:Check a file against the checksum of a share'
+                'doctor:Diagnose network and environment problems'
+                'relay:Pair senders and receivers that can'"'"'t reach each other'
                 'config:Manage configuration file'
+                'help:Show the help of a command'
                 'completion:Generate shell completion scripts'
             )
             _describe 'command' commands
@@ -35,8 +43,32 @@ _warp() {
                         '--text[Send text snippet]' \
                         '--stdin[Read from stdin]' \
                         '--rate-limit[Bandwidth limit in Mbps]' \
+                        '--quota-per-ip[Bytes each client may transfer, e.g. 10GB]:size:' \
+                        '--quota-reset[How often quota usage starts over]:duration:' \
                         '--cache-size[Cache size in MB]' \
+                        '--inline[Let browsers preview the file]' \
+                        '--allow-return[Let the recipient upload files back]' \
+                        '--return-dir[Where returned files go]:directory:_files -/' \
+                        '--basic-auth[Require HTTP Basic auth (user\:pass)]' \
+                        '--discovery[How to announce]:mode:(mdns broadcast both)' \
+                        '--short[Also serve a short /s/ URL]' \
+                        '--quic[HTTP/3 listener: off, auto or a UDP port]:mode:(off auto)' \
+                        '*--allow-ip[Only serve this CIDR or IP]:cidr:' \
+                        '*--deny-ip[Refuse this CIDR or IP]:cidr:' \
+                        '--trust-proxy[Trust X-Forwarded-For]' \
+                        '*--trust-proxy-cidr[Trust X-Forwarded-For from proxies in this CIDR]:cidr:' \
+                        '--low-memory[Tune for a small device]' \
+                        '--zip[Zip matched files even if only one]' \
+                        '--archive-opts[How zips are built]:options:(symlinks=follow symlinks=store symlinks=skip hidden=false deterministic mtime)' \
+                        '--start-at[Start serving at HH\:MM]:time:' \
+                        '--start-in[Start serving after a delay]:duration:' \
+                        '--precompute[Compute the checksum now]' \
+                        '--mtime-granularity[Rehash files changed this recently]:duration:' \
+                        '--follow[Stream a growing file like tail -f]' \
+                        '--media[Serve an M3U playlist of audio and video]' \
+                        '--relay[Also serve through a warp relay]:address:' \
                         '--no-qr[Skip QR code]' \
+                        '--qr-invert[QR code for a light terminal background]' \
                         {-h,--help}'[Show help]' \
                         '*:file:_files'
                     ;;
@@ -44,22 +76,141 @@ _warp() {
                     _arguments \
                         {-i,--interface}'[Network interface]' \
                         {-d,--dest}'[Destination directory]' \
+                        '--dest-mode[Octal mode of created directories]:mode:' \
+                        '--dest-unique[New warp-<token> directory per session]' \
                         '--rate-limit[Bandwidth limit in Mbps]' \
+                        '--max-transfers[Max concurrent transfers]' \
+                        '--quota-per-ip[Bytes each client may upload, e.g. 10GB]:size:' \
+                        '--quota-reset[How often quota usage starts over]:duration:' \
+                        '--max-file-size[Largest accepted upload in MB]' \
+                        '--allow-ext[Accepted file extensions]' \
+                        '--preserve[Keep uploaded mtime and mode]' \
+                        '--allow-append[Let push --append extend files]' \
+                        '--no-splice[Copy raw uploads through a buffer]' \
+                        '--async-verify[Verify uploads in the background]' \
+                        '--sync-policy[When to fsync uploads]:policy:(file chunk none)' \
+                        '--scan-cmd[Scan each upload with this command before keeping it]:command:_command_names' \
+                        '--scan-timeout[Time limit for one scan]:duration:' \
+                        '--organize[File uploads into subdirectories]:mode:(date sender none)' \
+                        '--json[Print progress as JSON lines]' \
+                        '--progress[Progress display]:mode:(auto bar plain none)' \
+                        '--basic-auth[Require HTTP Basic auth (user\:pass)]' \
+                        '--discovery[How to announce]:mode:(mdns broadcast both)' \
+                        '--short[Also serve a short /s/ URL]' \
+                        '--quic[HTTP/3 listener: off, auto or a UDP port]:mode:(off auto)' \
+                        '*--allow-ip[Only serve this CIDR or IP]:cidr:' \
+                        '*--deny-ip[Refuse this CIDR or IP]:cidr:' \
+                        '--trust-proxy[Trust X-Forwarded-For]' \
+                        '*--trust-proxy-cidr[Trust X-Forwarded-For from proxies in this CIDR]:cidr:' \
+                        '--low-memory[Tune for a small device]' \
+                        '--notify[Desktop notification when an upload finishes]' \
+                        '*--expect[Wait for an upload with this name or glob]:pattern:' \
+                        '--expect-count[Wait for this many matching uploads]:count:' \
+                        '--completion-file[JSON file listing the matching uploads]:file:_files' \
+                        '--page-template[HTML template for the upload page]:file:_files' \
+                        '--exit-when-complete[Stop once the expected uploads arrived]' \
                         '--no-qr[Skip QR code]' \
+                        '--qr-invert[QR code for a light terminal background]' \
                         {-h,--help}'[Show help]'
                     ;;
                 receive)
                     _arguments \
                         {-o,--output}'[Output file]' \
                         {-f,--force}'[Force overwrite]' \
+                        '--host[Server host:port]' \
+                        '--token[Transfer token]' \
                         '--workers[Parallel workers]' \
                         '--chunk-size[Chunk size in MB]' \
                         '--no-checksum[Skip checksum]' \
+                        '--preserve[Keep mtime and mode]' \
+                        '--json[Print progress as JSON lines]' \
+                        '--progress[Progress display]:mode:(auto bar plain none)' \
+                        '--directory[Keep receiving into directory]:directory:_files -/' \
+                        '--codes[Prompt for PAKE codes in batch mode]' \
+                        '--extract[Unpack a received archive]' \
+                        '--keep-archive[Keep the archive after --extract]' \
+                        '--mirror[Fetch a shared directory file by file]:directory:_files -/' \
+                        '--follow[Stream a growing file to stdout]' \
+                        '--discovery[How to find servers]:mode:(mdns broadcast both)' \
+                        '--scan[Also probe every host of a CIDR]:cidr:' \
+                        '--user[HTTP Basic auth user]' \
+                        '--password[HTTP Basic auth password]' \
+                        '--sha256[SHA-256 the file must have]:hex:' \
+                        '--sha256-file[Look the SHA-256 up in a sha256sum file]:file:_files' \
+                        '--keep-on-mismatch[Keep a file that fails its checksum]' \
+                        '--notify[Desktop notification when the download finishes]' \
+                        '--relay[Download through a warp relay]:address:' \
+                        {-y,--yes}'[Skip confirming the verification words]' \
                         {-h,--help}'[Show help]'
                     ;;
                 search)
                     _arguments \
                         '--timeout[Discovery timeout]' \
+                        '--discovery[How to find servers]:mode:(mdns broadcast both)' \
+                        '--scan[Also probe every host of a CIDR]:cidr:' \
+                        {-h,--help}'[Show help]'
+                    ;;
+                stop)
+                    _arguments \
+                        '--secret[Management secret]' \
+                        {-h,--help}'[Show help]'
+                    ;;
+                top)
+                    _arguments \
+                        '--interval[Time between polls]:duration:' \
+                        '--user[HTTP Basic auth user]:user:' \
+                        '--password[HTTP Basic auth password]:password:' \
+                        '--json[Print each poll as a JSON line]' \
+                        {-h,--help}'[Show help]'
+                    ;;
+                push)
+                    _arguments \
+                        {-m,--manifest}'[YAML or JSON manifest]:file:_files' \
+                        '--result[Write a JSON result to this file]:file:_files' \
+                        '--fail-fast[Stop at the first failed file]' \
+                        '--progress[Progress display]:mode:(auto bar plain none)' \
+                        '--parallel[Chunk uploads in flight]:count:' \
+                        '--chunk-size[Chunk size in MB]:size:' \
+                        '--no-checksum[Skip host checksum verification]' \
+                        '--start-at[Start uploading at HH\:MM]:time:' \
+                        '--start-in[Start uploading after a delay]:duration:' \
+                        '--precompute[Hash every file now]' \
+                        '--append[Append new bytes to the host copy]' \
+                        '--confirm-size[Ask before pushing more than this size]:size:' \
+                        '--confirm-files[Ask before pushing more files than this]:count:' \
+                        {-y,--yes}'[Push without asking]' \
+                        {-h,--help}'[Show help]'
+                    ;;
+                ping)
+                    _arguments \
+                        '--count[Number of probes]:count:' \
+                        '--interval[Time between probes]:duration:' \
+                        '--json[Print the summary as JSON]' \
+                        {-h,--help}'[Show help]'
+                    ;;
+                verify)
+                    _arguments \
+                        '--algo[Hash algorithm]:algorithm:(sha256)' \
+                        '--user[HTTP Basic auth user]:user:' \
+                        '--password[HTTP Basic auth password]:password:' \
+                        {-h,--help}'[Show help]' \
+                        '1:file:_files' \
+                        '2:url or sha256:'
+                    ;;
+                doctor)
+                    _arguments \
+                        {-i,--interface}'[Network interface]' \
+                        {-p,--port}'[Port to test]' \
+                        {-d,--dest}'[Upload directory]:directory:_files -/' \
+                        '--timeout[mDNS loopback timeout]' \
+                        {-h,--help}'[Show help]'
+                    ;;
+                relay)
+                    _arguments \
+                        '--listen[Address to listen on]:address:' \
+                        '--rate-limit[Bandwidth limit per pair in Mbps]:mbps:' \
+                        '--idle-timeout[Close pairs idle this long]:duration:' \
+                        '--pair-timeout[How long a receiver waits for the sender]:duration:' \
                         {-h,--help}'[Show help]'
                     ;;
                 config)
@@ -70,6 +221,11 @@ _warp() {
                     )
                     _describe 'config command' config_commands
                     ;;
+                help)
+                    _arguments \
+                        '--man[Write a troff man page]' \
+                        '1:command:(send host receive push search speedtest stop top ping verify doctor relay config)'
+                    ;;
                 completion)
                     local shells=(
                         'bash:Bash completion'
@@ -4,77 +4,130 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"runtime/pprof"
 
 	"github.com/zulfikawr/warp/cmd/warp/commands"
 	"github.com/zulfikawr/warp/cmd/warp/completion"
 	"github.com/zulfikawr/warp/cmd/warp/ui"
+	"github.com/zulfikawr/warp/internal/cli"
+	"github.com/zulfikawr/warp/internal/config"
 	"github.com/zulfikawr/warp/internal/errors"
+	"github.com/zulfikawr/warp/internal/i18n"
+	"github.com/zulfikawr/warp/internal/logging"
+	uipkg "github.com/zulfikawr/warp/internal/ui"
 )
 
-// filterGlobalFlags removes global flags that subcommands don't recognize
-func filterGlobalFlags(args []string) []string {
-	out := make([]string, 0, len(args))
-	for _, a := range args {
-		if a == "--no-color" {
-			continue
-		}
-		out = append(out, a)
-	}
-	return out
+// subcommands maps each command name to its entry point
+var subcommands = map[string]func(cli.GlobalOptions, []string) error{
+	"send":      commands.Send,
+	"host":      commands.Host,
+	"receive":   commands.Receive,
+	"push":      commands.Push,
+	"search":    commands.Search,
+	"config":    commands.Config,
+	"speedtest": commands.Speedtest,
+	"doctor":    commands.Doctor,
+	"stop":      commands.Stop,
+	"ping":      commands.Ping,
+	"verify":    commands.Verify,
+	"top":       commands.Top,
+	"relay":     commands.Relay,
+	"help":      commands.Help,
+	"completion": func(_ cli.GlobalOptions, args []string) error {
+		return completion.Generate(args)
+	},
 }
 
+// jsonCommands are the commands with machine-readable output for --json
+var jsonCommands = map[string]bool{"receive": true, "host": true, "ping": true, "top": true}
+
 func main() {
 	log.SetFlags(0)
 
-	// Determine color usage from env and global flag
-	enableColors := os.Getenv("NO_COLOR") == ""
-	for _, a := range os.Args[1:] {
-		if a == "--no-color" {
-			enableColors = false
-			break
-		}
+	g, args, err := cli.Preparse(os.Args[1:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warp: %v\n", err)
+		os.Exit(commands.ExitUsage)
 	}
-	ui.SetColorsEnabled(enableColors)
 
-	if len(os.Args) < 2 {
+	ui.SetColorsEnabled(os.Getenv("NO_COLOR") == "" && !g.NoColor)
+	// Debugging aid: keep share tokens whole in logs and errors
+	logging.SetFullURLs(g.LogFullURLs)
+	config.SetPath(g.ConfigPath)
+	setDisplay()
+
+	if len(args) == 0 {
 		ui.PrintUsage()
-		os.Exit(2)
+		os.Exit(commands.ExitUsage)
 	}
-
-	var err error
-	sub := os.Args[1]
-	switch sub {
-	case "send":
-		err = commands.Send(filterGlobalFlags(os.Args[2:]))
-	case "host":
-		err = commands.Host(filterGlobalFlags(os.Args[2:]))
-	case "receive":
-		err = commands.Receive(filterGlobalFlags(os.Args[2:]))
-	case "search":
-		err = commands.Search(filterGlobalFlags(os.Args[2:]))
-	case "config":
-		err = commands.Config(filterGlobalFlags(os.Args[2:]))
-	case "speedtest":
-		err = commands.Speedtest(filterGlobalFlags(os.Args[2:]))
-	case "completion":
-		err = completion.Generate(filterGlobalFlags(os.Args[2:]))
-	case "-h", "--help":
+	sub := args[0]
+	if sub == "-h" || sub == "--help" {
 		ui.PrintUsage()
 		return
-	default:
+	}
+	run, ok := subcommands[sub]
+	if !ok {
 		ui.PrintUsage()
-		os.Exit(2)
+		os.Exit(commands.ExitUsage)
 	}
 
-	// Handle errors in one place
+	switch {
+	case g.Quiet && g.Verbosity > 0:
+		err = errors.NewUserError("--quiet and --verbose can't be used together", nil, nil)
+	case g.JSON && !jsonCommands[sub]:
+		err = errors.NewUserError(fmt.Sprintf("warp %s has no JSON output", sub),
+			[]string{"--json works with receive, host, ping and top"}, nil)
+	default:
+		if g.Quiet {
+			logging.SetLevel(-1)
+		} else if g.Verbosity > 0 {
+			logging.SetLevel(g.Verbosity)
+		}
+		err = runProfiled(g.Profile, func() error { return run(g, args[1:]) })
+	}
+
+	// Handle errors in one place. Transport errors quote the request URL, so
+	// tokens are shortened to host:port plus a prefix.
 	if err != nil {
 		// Format user-friendly errors nicely
 		if errors.IsUserError(err) {
-			fmt.Fprintf(os.Stderr, "%s%s%s\n", ui.C.Red, err.Error(), ui.C.Reset)
+			fmt.Fprintf(os.Stderr, "%s%s%s\n", ui.C.Red, logging.Redact(err.Error()), ui.C.Reset)
 		} else {
 			// For non-user errors, just show the error
-			fmt.Fprintf(os.Stderr, "%sError: %v%s\n", ui.C.Red, err, ui.C.Reset)
+			fmt.Fprintf(os.Stderr, "%s%s%s\n", ui.C.Red, i18n.T("error.prefix", logging.Redact(err.Error())), ui.C.Reset)
+		}
+		os.Exit(commands.ExitCode(err))
+	}
+}
+
+// setDisplay picks the language of messages from WARP_LANG, the config
+// file's language and the system locale, and the units of speeds from the
+// config file's speed_units. A config file that doesn't load is left for the
+// command to report.
+func setDisplay() {
+	var configured string
+	if cfg, err := config.LoadConfig(); err == nil {
+		configured = cfg.Language
+		if units, err := uipkg.ParseSpeedUnits(cfg.SpeedUnits); err == nil {
+			uipkg.SetSpeedUnits(units)
 		}
-		os.Exit(1)
 	}
+	i18n.SetLocale(i18n.Detect(configured))
+}
+
+// runProfiled runs fn, writing a CPU profile of it to path when path is set
+func runProfiled(path string, fn func() error) error {
+	if path == "" {
+		return fn()
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("cannot create profile: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+	if err := pprof.StartCPUProfile(f); err != nil {
+		return fmt.Errorf("cannot start profile: %w", err)
+	}
+	defer pprof.StopCPUProfile()
+	return fn()
 }
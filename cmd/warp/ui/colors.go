@@ -38,3 +38,8 @@ func SetColorsEnabled(enabled bool) {
 		Cyan:    "\033[36m",
 	}
 }
+
+// ColorsEnabled reports whether color output is on
+func ColorsEnabled() bool {
+	return C.Reset != ""
+}
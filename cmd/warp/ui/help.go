@@ -1,6 +1,10 @@
 package ui
 
-import "fmt"
+import (
+	"fmt"
+
+	"github.com/zulfikawr/warp/internal/i18n"
+)
 
 // PrintUsage displays the main help text with ASCII art and command overview
 func PrintUsage() {
@@ -13,20 +17,28 @@ func PrintUsage() {
 	fmt.Println(C.Dim + "a quick file and text transfer with SHA256 verification" + C.Reset)
 	fmt.Println()
 
-	fmt.Println(C.Bold + "Usage:" + C.Reset)
+	fmt.Println(C.Bold + i18n.T("help.usage") + ":" + C.Reset)
 	fmt.Println("  " + C.Green + "warp send" + C.Reset + " [flags] <path>")
 	fmt.Println("  " + C.Green + "warp send" + C.Reset + " --text <text>")
 	fmt.Println("  " + C.Green + "warp send" + C.Reset + " --stdin < file")
 	fmt.Println("  " + C.Green + "warp host" + C.Reset + " [flags]")
 	fmt.Println("  " + C.Green + "warp receive" + C.Reset + " [flags] <url>")
 	fmt.Println("  " + C.Green + "warp receive" + C.Reset + " --code <code>")
+	fmt.Println("  " + C.Green + "warp push" + C.Reset + " --manifest <file> <url>")
 	fmt.Println("  " + C.Green + "warp search" + C.Reset + " [flags]")
 	fmt.Println("  " + C.Green + "warp speedtest" + C.Reset + " [flags] <host>")
+	fmt.Println("  " + C.Green + "warp stop" + C.Reset + " --secret <secret> <url>")
+	fmt.Println("  " + C.Green + "warp top" + C.Reset + " [flags] <url>")
+	fmt.Println("  " + C.Green + "warp ping" + C.Reset + " [flags] <url>")
+	fmt.Println("  " + C.Green + "warp verify" + C.Reset + " [flags] <file> <url|sha256>")
+	fmt.Println("  " + C.Green + "warp doctor" + C.Reset + " [flags] [url]")
+	fmt.Println("  " + C.Green + "warp relay" + C.Reset + " [--listen addr]")
 	fmt.Println("  " + C.Green + "warp config" + C.Reset + " [show|edit|path]")
 	fmt.Println("  " + C.Green + "warp completion" + C.Reset + " [bash|zsh|fish|powershell]")
+	fmt.Println("  " + C.Green + "warp help" + C.Reset + " [--man] <command>")
 	fmt.Println()
 
-	fmt.Println(C.Bold + "Commands:" + C.Reset)
+	fmt.Println(C.Bold + i18n.T("help.commands") + ":" + C.Reset)
 	fmt.Println("  " + C.Magenta + "send" + C.Reset + "  Share a file, directory, or text snippet")
 	fmt.Println("\t" + C.Yellow + "-p, --port" + C.Reset + "        choose specific port (default random)")
 	fmt.Println("\t" + C.Yellow + "-i, --interface" + C.Reset + "   bind to a specific network interface")
@@ -35,12 +47,14 @@ func PrintUsage() {
 	fmt.Println("\t" + C.Yellow + "--rate-limit" + C.Reset + "      limit bandwidth in Mbps (e.g., 10)")
 	fmt.Println("\t" + C.Yellow + "--cache-size" + C.Reset + "      file cache size in MB (default 100)")
 	fmt.Println("\t" + C.Yellow + "--no-qr" + C.Reset + "           skip printing the QR code")
+	fmt.Println("\t" + C.Yellow + "--qr-invert" + C.Reset + "       QR code for a light terminal background")
 	fmt.Println()
 	fmt.Println("  " + C.Magenta + "host" + C.Reset + "  Receive uploads into a directory you control")
 	fmt.Println("\t" + C.Yellow + "-i, --interface" + C.Reset + "   bind to a specific network interface")
 	fmt.Println("\t" + C.Yellow + "-d, --dest" + C.Reset + "        destination directory for uploads (default .)")
 	fmt.Println("\t" + C.Yellow + "--rate-limit" + C.Reset + "      limit bandwidth in Mbps (e.g., 10)")
 	fmt.Println("\t" + C.Yellow + "--no-qr" + C.Reset + "           skip printing the QR code")
+	fmt.Println("\t" + C.Yellow + "--qr-invert" + C.Reset + "       QR code for a light terminal background")
 	fmt.Println()
 	fmt.Println("  " + C.Magenta + "receive" + C.Reset + "  Download from a warp URL or PAKE code")
 	fmt.Println("\t" + C.Yellow + "-c, --code" + C.Reset + "        PAKE code for secure transfer")
@@ -49,7 +63,11 @@ func PrintUsage() {
 	fmt.Println("\t" + C.Yellow + "--workers" + C.Reset + "         parallel upload workers (default 3)")
 	fmt.Println("\t" + C.Yellow + "--chunk-size" + C.Reset + "      chunk size in MB (default 2)")
 	fmt.Println("\t" + C.Yellow + "--no-checksum" + C.Reset + "     skip SHA256 verification")
-	fmt.Println("\t" + C.Yellow + "--from-clipboard" + C.Reset + "  scan QR code from clipboard")
+	fmt.Println()
+	fmt.Println("  " + C.Magenta + "push" + C.Reset + "   Upload the files of a manifest to a warp host")
+	fmt.Println("\t" + C.Yellow + "-m, --manifest" + C.Reset + "    YAML or JSON file listing the files")
+	fmt.Println("\t" + C.Yellow + "--result" + C.Reset + "          write a JSON result to this file")
+	fmt.Println("\t" + C.Yellow + "--fail-fast" + C.Reset + "       stop at the first failed file")
 	fmt.Println()
 	fmt.Println("  " + C.Magenta + "search" + C.Reset + "   Discover nearby warp hosts via mDNS")
 	fmt.Println("\t" + C.Yellow + "--timeout" + C.Reset + "          duration to wait for discovery (default 3s)")
@@ -57,6 +75,30 @@ func PrintUsage() {
 	fmt.Println("  " + C.Magenta + "speedtest" + C.Reset + "   Test network speed to a target host")
 	fmt.Println("\t" + C.Yellow + "--timeout" + C.Reset + "          timeout for speed test (default 30s)")
 	fmt.Println()
+	fmt.Println("  " + C.Magenta + "stop" + C.Reset + "   Stop a running share remotely")
+	fmt.Println("\t" + C.Yellow + "--secret" + C.Reset + "          management secret printed at startup")
+	fmt.Println()
+	fmt.Println("  " + C.Magenta + "top" + C.Reset + "   Watch the transfers of a running share")
+	fmt.Println("\t" + C.Yellow + "--interval" + C.Reset + "        time between polls (default 1s)")
+	fmt.Println()
+	fmt.Println("  " + C.Magenta + "ping" + C.Reset + "   Check that a warp server is reachable")
+	fmt.Println("\t" + C.Yellow + "--count" + C.Reset + "           number of probes (default 5)")
+	fmt.Println("\t" + C.Yellow + "--interval" + C.Reset + "        time between probes (default 1s)")
+	fmt.Println("\t" + C.Yellow + "--json" + C.Reset + "            print the summary as JSON")
+	fmt.Println()
+	fmt.Println("  " + C.Magenta + "verify" + C.Reset + "   Check a file against a share's checksum")
+	fmt.Println("\t" + C.Yellow + "--algo" + C.Reset + "            hash algorithm (default sha256)")
+	fmt.Println()
+	fmt.Println("  " + C.Magenta + "doctor" + C.Reset + "   Diagnose network and environment problems")
+	fmt.Println("\t" + C.Yellow + "-i, --interface" + C.Reset + "   network interface to check")
+	fmt.Println("\t" + C.Yellow + "-p, --port" + C.Reset + "        port to test binding")
+	fmt.Println("\t" + C.Yellow + "-d, --dest" + C.Reset + "        upload directory to check")
+	fmt.Println()
+	fmt.Println("  " + C.Magenta + "relay" + C.Reset + "   Pair senders and receivers that can't reach each other")
+	fmt.Println("\t" + C.Yellow + "--listen" + C.Reset + "          address to listen on (default :9000)")
+	fmt.Println("\t" + C.Yellow + "--rate-limit" + C.Reset + "      limit bandwidth per pair in Mbps")
+	fmt.Println("\t" + C.Yellow + "--idle-timeout" + C.Reset + "    close pairs idle this long (default 5m)")
+	fmt.Println()
 	fmt.Println("  " + C.Magenta + "config" + C.Reset + "   Manage configuration file")
 	fmt.Println("\t" + C.Yellow + "init" + C.Reset + "              create config interactively")
 	fmt.Println("\t" + C.Yellow + "show" + C.Reset + "              display current configuration")
@@ -70,7 +112,18 @@ func PrintUsage() {
 	fmt.Println("\t" + C.Yellow + "powershell" + C.Reset + "        generate powershell completion")
 	fmt.Println()
 
-	fmt.Println(C.Bold + "Examples:" + C.Reset)
+	fmt.Println(C.Bold + i18n.T("help.global_flags") + ":" + C.Reset)
+	fmt.Println("\t" + C.Yellow + "--no-color" + C.Reset + "        disable colored output")
+	fmt.Println("\t" + C.Yellow + "-q, --quiet" + C.Reset + "       log errors only")
+	fmt.Println("\t" + C.Yellow + "-v, --verbose" + C.Reset + "     verbose logging (-vv or -v=2 for more detail)")
+	fmt.Println("\t" + C.Yellow + "--json" + C.Reset + "            machine-readable output (receive, host, ping, top)")
+	fmt.Println("\t" + C.Yellow + "--config file" + C.Reset + "     read this config file instead of searching")
+	fmt.Println("\t" + C.Yellow + "--profile file" + C.Reset + "    write a CPU profile for go tool pprof (debugging)")
+	fmt.Println("\t" + C.Yellow + "--log-full-urls" + C.Reset + "   keep share tokens whole in logs and errors (debugging)")
+	fmt.Println(C.Dim + "\tGlobal flags may appear before or after the command." + C.Reset)
+	fmt.Println()
+
+	fmt.Println(C.Bold + i18n.T("help.examples") + ":" + C.Reset)
 	fmt.Println("  " + C.Green + "warp send" + C.Reset + " ./photo.jpg " + C.Dim + "		    # Share a file" + C.Reset)
 	fmt.Println("  " + C.Green + "warp send" + C.Reset + " --text \"hello\" " + C.Dim + "	            # Share text" + C.Reset)
 	fmt.Println("  " + C.Green + "warp host" + C.Reset + " -d uploads " + C.Dim + "		            # Save uploads to dir" + C.Reset)
@@ -79,5 +132,6 @@ func PrintUsage() {
 	fmt.Println("  " + C.Green + "warp receive" + C.Reset + " --code 7-apple-velocity " + C.Dim + "     # Secure transfer" + C.Reset)
 	fmt.Println("  " + C.Green + "warp receive" + C.Reset + " http://hostname:port/<token> " + C.Dim + "# Download" + C.Reset)
 	fmt.Println()
-	fmt.Println(C.Dim + "Use \"warp <command> -h\" for command-specific help." + C.Reset)
+	fmt.Println(C.Dim + "Use \"warp help <command>\" or \"warp <command> -h\" for command-specific help," + C.Reset)
+	fmt.Println(C.Dim + "and \"warp help --man <command>\" for a man page." + C.Reset)
 }
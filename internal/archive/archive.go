@@ -0,0 +1,342 @@
+// Package archive streams zip and tar archives of a directory or a list of
+// files. Entries are always in sorted path order; Options decide what happens
+// to symlinks and hidden files, and whether the output depends on anything
+// but the files' names, contents and modes.
+package archive
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SymlinkPolicy is what an archive does with a symlink
+type SymlinkPolicy int
+
+const (
+	// SymlinksFollow archives what the link points to. Links that lead
+	// outside the archived directory or into one of their own parent
+	// directories are skipped with a warning.
+	SymlinksFollow SymlinkPolicy = iota
+	// SymlinksStore archives the link itself, pointing where it points
+	SymlinksStore
+	// SymlinksSkip leaves links out
+	SymlinksSkip
+)
+
+// String returns the name ParseSymlinkPolicy accepts
+func (p SymlinkPolicy) String() string {
+	switch p {
+	case SymlinksStore:
+		return "store"
+	case SymlinksSkip:
+		return "skip"
+	}
+	return "follow"
+}
+
+// ParseSymlinkPolicy parses "follow", "store" or "skip"
+func ParseSymlinkPolicy(s string) (SymlinkPolicy, error) {
+	switch s {
+	case "follow":
+		return SymlinksFollow, nil
+	case "store":
+		return SymlinksStore, nil
+	case "skip":
+		return SymlinksSkip, nil
+	}
+	return 0, fmt.Errorf("invalid symlink policy %q: use follow, store or skip", s)
+}
+
+// ErrSymlinkLoop is passed to Options.Warn for a followed link that leads
+// back into a directory it is in
+var ErrSymlinkLoop = errors.New("symlink loop")
+
+// ErrSymlinkOutside is passed to Options.Warn for a followed link whose
+// target is outside the directory being archived
+var ErrSymlinkOutside = errors.New("symlink leads outside the archived directory")
+
+// Epoch is the timestamp of every entry of a Deterministic archive without
+// KeepModTimes: the earliest time a zip can store
+var Epoch = time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// Options control what goes into an archive. The zero value follows
+// symlinks, includes hidden files and keeps modification times.
+type Options struct {
+	Symlinks SymlinkPolicy
+	// SkipHidden leaves out files and directories whose names start with a
+	// dot, except the root itself
+	SkipHidden bool
+	// Deterministic makes the archive depend only on the files' names,
+	// contents and modes: timestamps are Epoch unless KeepModTimes, and
+	// tar entries carry no owner
+	Deterministic bool
+	KeepModTimes  bool
+	// Progress, if set, is called once with the totals before the first
+	// entry and then before each entry
+	Progress func(Progress)
+	// Warn, if set, is told about entries left out because of an error
+	Warn func(path string, err error)
+}
+
+// Progress is how far an archive has got
+type Progress struct {
+	Files, TotalFiles int
+	Bytes, TotalBytes int64
+	Current           string // Name of the entry about to be written; "" at the start
+}
+
+// ParseOptions parses a comma-separated list of settings, as taken by
+// send --archive-opts: symlinks=follow|store|skip, hidden=true|false,
+// deterministic[=true|false] and mtime[=true|false]. A setting without a
+// value is true; settings left out keep their zero value.
+func ParseOptions(s string) (Options, error) {
+	var o Options
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		key, value, hasValue := strings.Cut(part, "=")
+		if key == "symlinks" {
+			p, err := ParseSymlinkPolicy(value)
+			if err != nil {
+				return Options{}, err
+			}
+			o.Symlinks = p
+			continue
+		}
+		on := true
+		if hasValue {
+			var err error
+			if on, err = strconv.ParseBool(value); err != nil {
+				return Options{}, fmt.Errorf("invalid value %q for %s: use true or false", value, key)
+			}
+		}
+		switch key {
+		case "hidden":
+			o.SkipHidden = !on
+		case "deterministic":
+			o.Deterministic = on
+		case "mtime":
+			o.KeepModTimes = on
+		default:
+			return Options{}, fmt.Errorf("unknown archive option %q: use symlinks, hidden, deterministic or mtime", key)
+		}
+	}
+	return o, nil
+}
+
+// entry is one file of an archive
+type entry struct {
+	path string      // On disk
+	name string      // In the archive, slash-separated
+	info fs.FileInfo // Of the link itself when it is stored, else of the file
+	link string      // Target of a stored symlink
+}
+
+// modTime is the timestamp an entry gets under o
+func (o Options) modTime(info fs.FileInfo) time.Time {
+	if o.Deterministic && !o.KeepModTimes {
+		return Epoch
+	}
+	return info.ModTime()
+}
+
+func (o Options) warn(path string, err error) {
+	if o.Warn != nil {
+		o.Warn(path, err)
+	}
+}
+
+// List returns the slash-separated names of the entries an archive of root
+// would hold, in order
+func List(root string, opts Options) ([]string, error) {
+	entries, err := walk(root, opts)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(entries))
+	for i, e := range entries {
+		names[i] = e.name
+	}
+	return names, nil
+}
+
+// walk collects the entries under root in sorted order
+func walk(root string, opts Options) ([]entry, error) {
+	info, err := os.Stat(root)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", root)
+	}
+	// Links are checked against where root really is
+	resolved, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return nil, err
+	}
+	var out []entry
+	err = walkDir(root, "", resolved, []fs.FileInfo{info}, opts, &out)
+	return out, err
+}
+
+// walkDir adds the entries of dir, named under prefix. Followed links must
+// stay within root, a resolved path; parents are the directories walked into
+// so far, for spotting symlink loops.
+func walkDir(dir, prefix, root string, parents []fs.FileInfo, opts Options, out *[]entry) error {
+	children, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, d := range children {
+		if opts.SkipHidden && strings.HasPrefix(d.Name(), ".") {
+			continue
+		}
+		p := filepath.Join(dir, d.Name())
+		name := path.Join(prefix, d.Name())
+		if d.Type()&fs.ModeSymlink != 0 {
+			if err := addSymlink(p, name, root, parents, opts, out); err != nil {
+				return err
+			}
+			continue
+		}
+		info, err := d.Info()
+		if err != nil {
+			opts.warn(name, err)
+			continue
+		}
+		switch {
+		case info.IsDir():
+			if err := walkDir(p, name, root, append(parents, info), opts, out); err != nil {
+				return err
+			}
+		case info.Mode().IsRegular():
+			*out = append(*out, entry{path: p, name: name, info: info})
+		}
+		// Devices, sockets and pipes have nothing to archive
+	}
+	return nil
+}
+
+// addSymlink adds the link at p as opts.Symlinks says. A followed link must
+// lead within root; with no root, for a link named on its own, it may lead
+// anywhere and a directory it leads to becomes the root of its entries.
+func addSymlink(p, name, root string, parents []fs.FileInfo, opts Options, out *[]entry) error {
+	switch opts.Symlinks {
+	case SymlinksSkip:
+		return nil
+	case SymlinksStore:
+		info, err := os.Lstat(p)
+		if err != nil {
+			opts.warn(name, err)
+			return nil
+		}
+		target, err := os.Readlink(p)
+		if err != nil {
+			opts.warn(name, err)
+			return nil
+		}
+		*out = append(*out, entry{path: p, name: name, info: info, link: filepath.ToSlash(target)})
+		return nil
+	}
+
+	target, err := filepath.EvalSymlinks(p)
+	if err != nil {
+		// Dangling
+		opts.warn(name, err)
+		return nil
+	}
+	switch {
+	case root == "":
+		root = target
+	case !within(root, target):
+		opts.warn(name, ErrSymlinkOutside)
+		return nil
+	}
+	info, err := os.Stat(target)
+	if err != nil {
+		opts.warn(name, err)
+		return nil
+	}
+	switch {
+	case info.IsDir():
+		for _, parent := range parents {
+			if os.SameFile(parent, info) {
+				opts.warn(name, ErrSymlinkLoop)
+				return nil
+			}
+		}
+		return walkDir(p, name, root, append(parents, info), opts, out)
+	case info.Mode().IsRegular():
+		*out = append(*out, entry{path: p, name: name, info: info})
+	}
+	return nil
+}
+
+// within reports whether path is root or below it
+func within(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// files collects the entries for a list of files, named relative to base.
+// Hidden names aren't skipped: the files were chosen one by one.
+func files(base string, paths []string, opts Options) ([]entry, error) {
+	out := make([]entry, 0, len(paths))
+	for _, p := range paths {
+		rel, err := filepath.Rel(base, p)
+		if err != nil {
+			return nil, err
+		}
+		name := filepath.ToSlash(rel)
+		info, err := os.Lstat(p)
+		if err != nil {
+			return nil, err
+		}
+		if info.Mode()&fs.ModeSymlink != 0 {
+			if err := addSymlink(p, name, "", nil, opts, &out); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if info.Mode().IsRegular() {
+			out = append(out, entry{path: p, name: name, info: info})
+		}
+	}
+	return out, nil
+}
+
+// stream writes entries with add, reporting progress
+func stream(entries []entry, opts Options, add func(entry) error) error {
+	p := Progress{TotalFiles: len(entries)}
+	for _, e := range entries {
+		if e.link == "" {
+			p.TotalBytes += e.info.Size()
+		}
+	}
+	if opts.Progress != nil {
+		opts.Progress(p)
+	}
+	for _, e := range entries {
+		if opts.Progress != nil {
+			p.Current = e.name
+			opts.Progress(p)
+		}
+		if err := add(e); err != nil {
+			return err
+		}
+		p.Files++
+		if e.link == "" {
+			p.Bytes += e.info.Size()
+		}
+	}
+	return nil
+}
@@ -0,0 +1,308 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// tree builds a directory with nested files, a hidden file and directory, a
+// symlink to a file, one to a directory and one back to the root
+func tree(t *testing.T) string {
+	t.Helper()
+	root := t.TempDir()
+	for name, body := range map[string]string{
+		"b.txt":        "bravo",
+		"a/one.txt":    "one",
+		"a/two.txt":    "two",
+		".env":         "SECRET=1",
+		".git/HEAD":    "ref",
+		"z/deep/x.bin": "x",
+	} {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(body), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for link, target := range map[string]string{
+		"link.txt": "b.txt",
+		"linkdir":  "a",
+		"z/loop":   "..",
+		"dangling": "missing",
+	} {
+		if err := os.Symlink(target, filepath.Join(root, link)); err != nil {
+			t.Skipf("symlinks unavailable: %v", err)
+		}
+	}
+	return root
+}
+
+// zipNames lists a zip's entries with their contents
+func zipNames(t *testing.T, data []byte) map[string]string {
+	t.Helper()
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := make(map[string]string)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(rc)
+		_ = rc.Close()
+		if f.Mode()&os.ModeSymlink != 0 {
+			out[f.Name] = "-> " + string(body)
+			continue
+		}
+		out[f.Name] = string(body)
+	}
+	return out
+}
+
+func TestDeterministicZip(t *testing.T) {
+	root := tree(t)
+	opts := Options{Deterministic: true}
+	var first bytes.Buffer
+	if err := Zip(&first, root, opts); err != nil {
+		t.Fatal(err)
+	}
+	// Timestamps move, the archive doesn't
+	later := time.Now().Add(time.Hour)
+	_ = os.Chtimes(filepath.Join(root, "b.txt"), later, later)
+	var second bytes.Buffer
+	if err := Zip(&second, root, opts); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(first.Bytes(), second.Bytes()) {
+		t.Error("two deterministic zips of the same tree differ")
+	}
+	zr, _ := zip.NewReader(bytes.NewReader(first.Bytes()), int64(first.Len()))
+	for _, f := range zr.File {
+		if !f.Modified.Equal(Epoch) {
+			t.Errorf("%s modified %v, want %v", f.Name, f.Modified, Epoch)
+		}
+	}
+
+	// With mtime, the timestamps are the files'
+	var kept bytes.Buffer
+	if err := Zip(&kept, root, Options{Deterministic: true, KeepModTimes: true}); err != nil {
+		t.Fatal(err)
+	}
+	zr, _ = zip.NewReader(bytes.NewReader(kept.Bytes()), int64(kept.Len()))
+	for _, f := range zr.File {
+		if f.Name == "b.txt" && f.Modified.Unix() != later.Unix() {
+			t.Errorf("b.txt modified %v, want %v", f.Modified, later)
+		}
+	}
+}
+
+func TestDeterministicTar(t *testing.T) {
+	root := tree(t)
+	opts := Options{Deterministic: true, Symlinks: SymlinksStore}
+	var first, second bytes.Buffer
+	if err := Tar(&first, root, opts); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Hour)
+	_ = os.Chtimes(filepath.Join(root, "a/one.txt"), later, later)
+	if err := Tar(&second, root, opts); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(first.Bytes(), second.Bytes()) {
+		t.Error("two deterministic tars of the same tree differ")
+	}
+	tr := tar.NewReader(&first)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hdr.Uname != "" || hdr.Uid != 0 || !hdr.ModTime.Equal(Epoch) {
+			t.Errorf("%s: owner %q/%d, time %v", hdr.Name, hdr.Uname, hdr.Uid, hdr.ModTime)
+		}
+		if hdr.Name == "link.txt" && (hdr.Typeflag != tar.TypeSymlink || hdr.Linkname != "b.txt") {
+			t.Errorf("link.txt stored as type %c -> %q", hdr.Typeflag, hdr.Linkname)
+		}
+	}
+}
+
+func TestSymlinkPolicies(t *testing.T) {
+	root := tree(t)
+	regular := map[string]string{
+		".env":         "SECRET=1",
+		".git/HEAD":    "ref",
+		"a/one.txt":    "one",
+		"a/two.txt":    "two",
+		"b.txt":        "bravo",
+		"z/deep/x.bin": "x",
+	}
+	with := func(extra map[string]string) map[string]string {
+		m := make(map[string]string)
+		for k, v := range regular {
+			m[k] = v
+		}
+		for k, v := range extra {
+			m[k] = v
+		}
+		return m
+	}
+	tests := []struct {
+		policy SymlinkPolicy
+		want   map[string]string
+		warned []string
+	}{
+		{SymlinksFollow, with(map[string]string{
+			"link.txt":        "bravo",
+			"linkdir/one.txt": "one",
+			"linkdir/two.txt": "two",
+		}), []string{"dangling", "z/loop"}},
+		{SymlinksStore, with(map[string]string{
+			"dangling": "-> missing",
+			"link.txt": "-> b.txt",
+			"linkdir":  "-> a",
+			"z/loop":   "-> ..",
+		}), nil},
+		{SymlinksSkip, regular, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy.String(), func(t *testing.T) {
+			var warned []string
+			var loops int
+			opts := Options{Symlinks: tt.policy, Warn: func(path string, err error) {
+				warned = append(warned, path)
+				if errors.Is(err, ErrSymlinkLoop) {
+					loops++
+				}
+			}}
+			var buf bytes.Buffer
+			if err := Zip(&buf, root, opts); err != nil {
+				t.Fatal(err)
+			}
+			if got := zipNames(t, buf.Bytes()); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("entries = %v, want %v", got, tt.want)
+			}
+			if !reflect.DeepEqual(warned, tt.warned) {
+				t.Errorf("warned about %v, want %v", warned, tt.warned)
+			}
+			if tt.policy == SymlinksFollow && loops != 1 {
+				t.Errorf("%d loops reported, want 1", loops)
+			}
+		})
+	}
+}
+
+func TestSymlinkOutsideRoot(t *testing.T) {
+	root := tree(t)
+	outside := t.TempDir()
+	if err := os.WriteFile(filepath.Join(outside, "id_rsa"), []byte("key"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	for link, target := range map[string]string{"home": outside, "a/key": filepath.Join(outside, "id_rsa")} {
+		if err := os.Symlink(target, filepath.Join(root, filepath.FromSlash(link))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var outsideLinks []string
+	opts := Options{Warn: func(path string, err error) {
+		if errors.Is(err, ErrSymlinkOutside) {
+			outsideLinks = append(outsideLinks, path)
+		}
+	}}
+	names, err := List(root, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range names {
+		if path.Base(name) == "key" || strings.HasPrefix(name, "home/") {
+			t.Errorf("followed %s outside the root", name)
+		}
+	}
+	// linkdir leads to a, so a/key turns up twice
+	if want := []string{"a/key", "home", "linkdir/key"}; !reflect.DeepEqual(outsideLinks, want) {
+		t.Errorf("warned about %v, want %v", outsideLinks, want)
+	}
+
+	// A link named on its own is followed wherever it leads
+	var buf bytes.Buffer
+	if err := ZipFiles(&buf, root, []string{filepath.Join(root, "home")}, Options{}); err != nil {
+		t.Fatal(err)
+	}
+	if got := zipNames(t, buf.Bytes()); got["home/id_rsa"] != "key" {
+		t.Errorf("named link: entries = %v", got)
+	}
+}
+
+func TestListOrderAndHidden(t *testing.T) {
+	root := tree(t)
+	got, err := List(root, Options{Symlinks: SymlinksSkip, SkipHidden: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"a/one.txt", "a/two.txt", "b.txt", "z/deep/x.bin"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("List = %v, want %v", got, want)
+	}
+
+	// A hidden root is still archived
+	got, err = List(filepath.Join(root, ".git"), Options{SkipHidden: true})
+	if err != nil || !reflect.DeepEqual(got, []string{"HEAD"}) {
+		t.Errorf("List(.git) = %v, %v", got, err)
+	}
+}
+
+func TestZipFilesProgress(t *testing.T) {
+	root := tree(t)
+	paths := []string{filepath.Join(root, "b.txt"), filepath.Join(root, "a", "one.txt"), filepath.Join(root, "link.txt")}
+	var seen []Progress
+	opts := Options{Progress: func(p Progress) { seen = append(seen, p) }}
+	var buf bytes.Buffer
+	if err := ZipFiles(&buf, root, paths, opts); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"b.txt": "bravo", "a/one.txt": "one", "link.txt": "bravo"}
+	if got := zipNames(t, buf.Bytes()); !reflect.DeepEqual(got, want) {
+		t.Errorf("entries = %v, want %v", got, want)
+	}
+	wantProgress := []Progress{
+		{TotalFiles: 3, TotalBytes: 13},
+		{TotalFiles: 3, TotalBytes: 13, Current: "b.txt"},
+		{Files: 1, Bytes: 5, TotalFiles: 3, TotalBytes: 13, Current: "a/one.txt"},
+		{Files: 2, Bytes: 8, TotalFiles: 3, TotalBytes: 13, Current: "link.txt"},
+	}
+	if !reflect.DeepEqual(seen, wantProgress) {
+		t.Errorf("progress = %+v, want %+v", seen, wantProgress)
+	}
+}
+
+func TestParseOptions(t *testing.T) {
+	got, err := ParseOptions(" symlinks=store, hidden=false,deterministic,mtime=true ")
+	want := Options{Symlinks: SymlinksStore, SkipHidden: true, Deterministic: true, KeepModTimes: true}
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseOptions = %+v, %v; want %+v", got, err, want)
+	}
+	if got, err := ParseOptions(""); err != nil || !reflect.DeepEqual(got, Options{}) {
+		t.Errorf("ParseOptions(\"\") = %+v, %v", got, err)
+	}
+	for _, bad := range []string{"symlinks=copy", "hidden=maybe", "compress", "symlinks"} {
+		if _, err := ParseOptions(bad); err == nil {
+			t.Errorf("ParseOptions(%q) succeeded", bad)
+		}
+	}
+}
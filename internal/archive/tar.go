@@ -0,0 +1,67 @@
+package archive
+
+import (
+	"archive/tar"
+	"io"
+	"os"
+	"time"
+)
+
+// Tar streams an uncompressed tar of the directory root to w
+func Tar(w io.Writer, root string, opts Options) error {
+	entries, err := walk(root, opts)
+	if err != nil {
+		return err
+	}
+	return writeTar(w, entries, opts)
+}
+
+// TarFiles streams an uncompressed tar of files to w, each named by its path
+// relative to base
+func TarFiles(w io.Writer, base string, paths []string, opts Options) error {
+	entries, err := files(base, paths, opts)
+	if err != nil {
+		return err
+	}
+	return writeTar(w, entries, opts)
+}
+
+func writeTar(w io.Writer, entries []entry, opts Options) error {
+	tw := tar.NewWriter(w)
+	if err := stream(entries, opts, func(e entry) error { return addTar(tw, e, opts) }); err != nil {
+		_ = tw.Close()
+		return err
+	}
+	return tw.Close()
+}
+
+func addTar(tw *tar.Writer, e entry, opts Options) error {
+	hdr, err := tar.FileInfoHeader(e.info, e.link)
+	if err != nil {
+		return err
+	}
+	hdr.Name = e.name
+	hdr.ModTime = opts.modTime(e.info)
+	if opts.Deterministic {
+		hdr.Uid, hdr.Gid, hdr.Uname, hdr.Gname = 0, 0, "", ""
+		hdr.AccessTime, hdr.ChangeTime = time.Time{}, time.Time{}
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	if e.link != "" {
+		return nil
+	}
+	file, err := os.Open(e.path)
+	if err != nil {
+		return err
+	}
+	// The header promised the size seen by the walk: a file that grew since
+	// is cut there, one that shrank fails the archive
+	_, copyErr := io.CopyN(tw, file, hdr.Size)
+	closeErr := file.Close()
+	if copyErr != nil {
+		return copyErr
+	}
+	return closeErr
+}
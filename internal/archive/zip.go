@@ -0,0 +1,69 @@
+package archive
+
+import (
+	"archive/zip"
+	"io"
+	"os"
+)
+
+// Zip streams a deflated zip of the directory root to w
+func Zip(w io.Writer, root string, opts Options) error {
+	entries, err := walk(root, opts)
+	if err != nil {
+		return err
+	}
+	return writeZip(w, entries, opts)
+}
+
+// ZipFiles streams a deflated zip of files to w, each named by its path
+// relative to base
+func ZipFiles(w io.Writer, base string, paths []string, opts Options) error {
+	entries, err := files(base, paths, opts)
+	if err != nil {
+		return err
+	}
+	return writeZip(w, entries, opts)
+}
+
+func writeZip(w io.Writer, entries []entry, opts Options) error {
+	zw := zip.NewWriter(w)
+	if err := stream(entries, opts, func(e entry) error { return addZip(zw, e, opts) }); err != nil {
+		_ = zw.Close()
+		return err
+	}
+	return zw.Close()
+}
+
+// addZip writes e to zw. A stored symlink holds its target, as Info-ZIP
+// stores them.
+func addZip(zw *zip.Writer, e entry, opts Options) error {
+	fh, err := zip.FileInfoHeader(e.info)
+	if err != nil {
+		return err
+	}
+	fh.Name = e.name
+	fh.Modified = opts.modTime(e.info)
+	fh.Method = zip.Deflate
+	if e.link != "" {
+		fh.Method = zip.Store
+	}
+	f, err := zw.CreateHeader(fh)
+	if err != nil {
+		return err
+	}
+	if e.link != "" {
+		_, err := io.WriteString(f, e.link)
+		return err
+	}
+	file, err := os.Open(e.path)
+	if err != nil {
+		return err
+	}
+	// Closed right away so large trees don't run out of file handles
+	_, copyErr := io.Copy(f, file)
+	closeErr := file.Close()
+	if copyErr != nil {
+		return copyErr
+	}
+	return closeErr
+}
@@ -0,0 +1,157 @@
+// Package cli renders command help from a command's FlagSet plus the prose
+// written for it, so the flags a command documents are always the flags it
+// accepts. Preparse takes the global flags out of the arguments before any
+// FlagSet sees them.
+package cli
+
+import (
+	"flag"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/zulfikawr/warp/internal/i18n"
+)
+
+// Command is the hand-written part of a command's help. Its flags are not
+// listed here: they come from the FlagSet, usage strings included.
+type Command struct {
+	Name        string   // e.g. "send"; shown as "warp send"
+	Summary     string   // One line, after the name
+	Usage       []string // Argument forms, each following "warp <name>"
+	Description []string // Lines of prose; "" starts a new paragraph
+	Extra       []Flag   // Flags handled before the FlagSet sees the arguments, e.g. -v
+	Sections    []Section
+	Examples    []Example
+	Notes       []string // Closing lines, dimmed on a terminal
+}
+
+// Section is a titled block after the flags, e.g. a manifest format. Items
+// are laid out like flags, Lines as they are.
+type Section struct {
+	Title string
+	Items []Item
+	Lines []string
+}
+
+// Item is a term and its description
+type Item struct {
+	Term, Text string
+}
+
+// Example is a command line and, optionally, what it does. Command is the
+// whole line, so it can start with a pipe into warp.
+type Example struct {
+	Command, Comment string
+}
+
+// Flag is one documented flag with all of its names
+type Flag struct {
+	Names   []string // Without dashes, short names first
+	Arg     string   // Placeholder for the value, from a `quoted` word in the usage
+	Usage   string
+	Default string // Empty when the default is the zero value
+}
+
+// Title returns the command as typed, "warp send"
+func (c *Command) Title() string {
+	return "warp " + c.Name
+}
+
+// Flags returns the documented flags of fs followed by c.Extra. Flags that
+// share a variable, like -o and --output, are merged into one entry, which
+// takes its usage from the name that has one. A flag no name of which has a
+// usage is left out.
+func (c *Command) Flags(fs *flag.FlagSet) []Flag {
+	var groups [][]*flag.Flag
+	index := make(map[any]int)
+	fs.VisitAll(func(f *flag.Flag) {
+		var key any = f.Name
+		if reflect.TypeOf(f.Value).Comparable() {
+			key = f.Value
+		}
+		i, ok := index[key]
+		if !ok {
+			i = len(groups)
+			index[key] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], f)
+	})
+
+	var flags []Flag
+	for _, group := range groups {
+		if doc, ok := documentFlag(group); ok {
+			flags = append(flags, doc)
+		}
+	}
+	sort.Slice(flags, func(i, j int) bool {
+		return flags[i].Names[len(flags[i].Names)-1] < flags[j].Names[len(flags[j].Names)-1]
+	})
+	return append(flags, c.Extra...)
+}
+
+// documentFlag merges the names that share one variable
+func documentFlag(group []*flag.Flag) (Flag, bool) {
+	var doc Flag
+	var primary *flag.Flag
+	for _, f := range group {
+		doc.Names = append(doc.Names, f.Name)
+		if primary == nil && f.Usage != "" {
+			primary = f
+		}
+	}
+	if primary == nil {
+		return Flag{}, false
+	}
+	sort.Slice(doc.Names, func(i, j int) bool {
+		a, b := doc.Names[i], doc.Names[j]
+		if len(a) == 1 || len(b) == 1 {
+			return len(a) < len(b)
+		}
+		return a < b
+	})
+	arg, usage := flag.UnquoteUsage(primary)
+	if strings.Contains(primary.Usage, "`") {
+		doc.Arg = arg
+	}
+	doc.Usage = usage
+	if !isZeroDefault(primary.DefValue) {
+		doc.Default = primary.DefValue
+	}
+	return doc, true
+}
+
+// isZeroDefault reports whether a flag's default is not worth showing
+func isZeroDefault(v string) bool {
+	switch v {
+	case "", "0", "false", "0s":
+		return true
+	}
+	return false
+}
+
+// Spelling returns the flag as it is typed, e.g. "-p, --port"
+func (f Flag) Spelling() string {
+	names := make([]string, len(f.Names))
+	for i, name := range f.Names {
+		if len(name) == 1 {
+			names[i] = "-" + name
+		} else {
+			names[i] = "--" + name
+		}
+	}
+	s := strings.Join(names, ", ")
+	if f.Arg != "" {
+		s += " " + f.Arg
+	}
+	return s
+}
+
+// Text returns the usage with the default appended
+func (f Flag) Text() string {
+	if f.Default == "" {
+		return f.Usage
+	}
+	return f.Usage + " " + i18n.T("help.default", f.Default)
+}
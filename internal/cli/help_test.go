@@ -0,0 +1,105 @@
+package cli
+
+import (
+	"bytes"
+	"flag"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testCommand() (*Command, *flag.FlagSet) {
+	fs := flag.NewFlagSet("send", flag.ContinueOnError)
+	port := fs.Int("port", 0, "choose a specific port (default: random)")
+	fs.IntVar(port, "p", 0, "")
+	fs.String("text", "", "send a `string` instead of a file")
+	fs.Bool("preserve", true, "keep modification times")
+	fs.Duration("timeout", 3*time.Second, "how long to wait")
+	fs.Bool("internal", false, "")
+	cmd := &Command{
+		Name:        "send",
+		Summary:     "Share a file",
+		Usage:       []string{"[flags] <path>"},
+		Description: []string{"Start a server.", "", ".dotfiles are shared too."},
+		Extra:       []Flag{{Names: []string{"v", "verbose"}, Usage: "verbose logging"}},
+		Sections:    []Section{{Title: "Manifest", Lines: []string{"files:"}}},
+		Examples: []Example{
+			{Command: "warp send ./photo.jpg", Comment: "Share a file"},
+			{Command: `echo "hi" | warp send --text -`, Comment: "From a pipe"},
+		},
+	}
+	return cmd, fs
+}
+
+func TestFlags(t *testing.T) {
+	cmd, fs := testCommand()
+	var got []string
+	for _, f := range cmd.Flags(fs) {
+		got = append(got, f.Spelling()+" | "+f.Text())
+	}
+	want := []string{
+		"-p, --port | choose a specific port (default: random)",
+		"--preserve | keep modification times (default: true)",
+		"--text string | send a string instead of a file",
+		"--timeout | how long to wait (default: 3s)",
+		"-v, --verbose | verbose logging",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("flags:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestRender(t *testing.T) {
+	cmd, fs := testCommand()
+	var buf bytes.Buffer
+	if err := cmd.Render(&buf, fs, Style{}); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"warp send - Share a file\n",
+		"Usage:\n  warp send [flags] <path>\n",
+		"  -p, --port        choose a specific port (default: random)\n",
+		"  --text string     send a string instead of a file\n",
+		"Manifest:\n  files:\n",
+		"  warp send ./photo.jpg          # Share a file\n",
+		"  echo \"hi\" | warp send --text - # From a pipe\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("help is missing %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "internal") {
+		t.Error("flag without a usage was documented")
+	}
+
+	buf.Reset()
+	st := Style{Bold: "<b>", Dim: "<d>", Green: "<g>", Yellow: "<y>", Reset: "</>"}
+	if err := cmd.Render(&buf, fs, st); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "  <y>-p, --port</>        choose") {
+		t.Errorf("styled flags not aligned like plain ones:\n%s", buf.String())
+	}
+}
+
+func TestMan(t *testing.T) {
+	cmd, fs := testCommand()
+	var buf bytes.Buffer
+	if err := cmd.Man(&buf, fs); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		`.TH "WARP-SEND" "1"`,
+		"\n.SH NAME\nwarp\\-send \\- Share a file\n",
+		"\n.SH OPTIONS\n.TP\n\\fB\\-p, \\-\\-port\\fR\nchoose a specific port (default: random)\n",
+		"\nStart a server.\n.PP\n\\&.dotfiles are shared too.\n",
+		"\n.SH \"MANIFEST\"\n.PP\n.nf\nfiles:\n.fi\n",
+		"\n.SH EXAMPLES\n.TP\n\\fBwarp send ./photo.jpg\\fR\nShare a file\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("man page is missing %q:\n%s", want, out)
+		}
+	}
+}
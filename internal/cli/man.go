@@ -0,0 +1,101 @@
+package cli
+
+import (
+	"flag"
+	"io"
+	"strings"
+)
+
+// Man writes c as a troff man page in section 1, as warp-<name>(1)
+func (c *Command) Man(w io.Writer, fs *flag.FlagSet) error {
+	p := &printer{w: w}
+	page := "warp-" + c.Name
+	p.linef(`.TH "%s" "1" "" "warp" "warp manual"`, strings.ToUpper(page))
+
+	p.linef(".SH NAME")
+	p.linef(`%s \- %s`, roff(page), roff(c.Summary))
+
+	p.linef(".SH SYNOPSIS")
+	for i, u := range c.Usage {
+		if i > 0 {
+			p.linef(".br")
+		}
+		p.linef(`\fB%s\fR %s`, roff(c.Title()), roff(u))
+	}
+
+	if len(c.Description) > 0 {
+		p.linef(".SH DESCRIPTION")
+		for _, line := range c.Description {
+			if line == "" {
+				p.linef(".PP")
+			} else {
+				p.linef("%s", roffLine(line))
+			}
+		}
+	}
+
+	if flags := c.Flags(fs); len(flags) > 0 {
+		p.linef(".SH OPTIONS")
+		for _, f := range flags {
+			p.linef(".TP")
+			p.linef(`\fB%s\fR`, roff(f.Spelling()))
+			p.linef("%s", roffLine(f.Text()))
+		}
+	}
+
+	for _, s := range c.Sections {
+		p.linef(`.SH "%s"`, roff(strings.ToUpper(s.Title)))
+		for _, it := range s.Items {
+			p.linef(".TP")
+			p.linef(`\fB%s\fR`, roff(it.Term))
+			p.linef("%s", roffLine(it.Text))
+		}
+		if len(s.Lines) > 0 {
+			p.linef(".PP")
+			p.linef(".nf")
+			for _, line := range s.Lines {
+				p.linef("%s", roffLine(line))
+			}
+			p.linef(".fi")
+		}
+	}
+
+	if len(c.Examples) > 0 {
+		p.linef(".SH EXAMPLES")
+		for _, ex := range c.Examples {
+			p.linef(".TP")
+			p.linef(`\fB%s\fR`, roff(ex.Command))
+			if ex.Comment != "" {
+				p.linef("%s", roffLine(ex.Comment))
+			}
+		}
+	}
+
+	if len(c.Notes) > 0 {
+		p.linef(".SH NOTES")
+		p.linef(".nf")
+		for _, line := range c.Notes {
+			p.linef("%s", roffLine(line))
+		}
+		p.linef(".fi")
+	}
+	return p.err
+}
+
+// roffEscaper escapes text for troff: backslashes would start escapes and
+// plain hyphens may be set as typographic ones, which breaks copying flags
+var roffEscaper = strings.NewReplacer(`\`, `\e`, "-", `\-`)
+
+func roff(s string) string {
+	return roffEscaper.Replace(s)
+}
+
+// roffLine escapes a line of text, guarding a leading . or ' that troff
+// would read as a request
+func roffLine(s string) string {
+	s = roff(s)
+	if strings.HasPrefix(s, ".") || strings.HasPrefix(s, "'") {
+		return `\&` + s
+	}
+	return s
+}
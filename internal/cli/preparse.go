@@ -0,0 +1,143 @@
+package cli
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// GlobalOptions are the flags every command accepts. Preparse takes them out
+// of the arguments once, before the command's FlagSet sees the rest.
+type GlobalOptions struct {
+	NoColor     bool   // --no-color
+	LogFullURLs bool   // --log-full-urls: keep share tokens whole in logs
+	JSON        bool   // --json: machine-readable output, where a command has it
+	Quiet       bool   // -q, --quiet: log errors only
+	Verbosity   int    // -v, --verbose, repeated (-vv) or given (-v=2)
+	Profile     string // --profile: write a CPU profile to this file
+	ConfigPath  string // --config: read this config file instead of searching
+}
+
+// globalBools are the boolean global flags, by long name
+var globalBools = map[string]func(*GlobalOptions, bool){
+	"no-color":      func(o *GlobalOptions, v bool) { o.NoColor = v },
+	"log-full-urls": func(o *GlobalOptions, v bool) { o.LogFullURLs = v },
+	"json":          func(o *GlobalOptions, v bool) { o.JSON = v },
+	"quiet":         func(o *GlobalOptions, v bool) { o.Quiet = v },
+}
+
+// globalValues are the global flags that take a value, by long name
+var globalValues = map[string]func(*GlobalOptions, string){
+	"profile": func(o *GlobalOptions, v string) { o.Profile = v },
+	"config":  func(o *GlobalOptions, v string) { o.ConfigPath = v },
+}
+
+// globalShorts are the one-letter global flags, which may be combined as
+// in -vv or -qv
+var globalShorts = map[byte]string{'v': "verbose", 'q': "quiet"}
+
+// GlobalFlags documents the flags Preparse takes, for the usage screen
+var GlobalFlags = []Flag{
+	{Names: []string{"no-color"}, Usage: "disable colored output"},
+	{Names: []string{"q", "quiet"}, Usage: "log errors only"},
+	{Names: []string{"v", "verbose"}, Usage: "verbose logging (repeat, e.g. -vv, or -v=2 for more detail)"},
+	{Names: []string{"json"}, Usage: "machine-readable output (receive, host, ping, top)"},
+	{Names: []string{"config"}, Arg: "file", Usage: "read this config file instead of searching for warp.yaml"},
+	{Names: []string{"profile"}, Arg: "file", Usage: "write a CPU profile for go tool pprof (debugging)"},
+	{Names: []string{"log-full-urls"}, Usage: "keep share tokens whole in logs and errors (debugging)"},
+}
+
+// Preparse takes the global flags out of args, wherever they appear, and
+// returns them with the remaining arguments in order. Flags may use one or
+// two dashes, booleans take =true or =false, value flags take "=value" or
+// the next argument, and one-letter flags combine (-vv, -qv). Everything
+// after "--" is left alone.
+func Preparse(args []string) (GlobalOptions, []string, error) {
+	var opts GlobalOptions
+	rest := make([]string, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			rest = append(rest, args[i:]...)
+			break
+		}
+		if len(arg) < 2 || arg[0] != '-' {
+			rest = append(rest, arg)
+			continue
+		}
+		name, value, hasValue := strings.Cut(strings.TrimPrefix(arg[1:], "-"), "=")
+		if len(name) == 1 {
+			if long, ok := globalShorts[name[0]]; ok {
+				name = long
+			}
+		}
+
+		if set, ok := globalBools[name]; ok {
+			v := true
+			if hasValue {
+				b, err := strconv.ParseBool(value)
+				if err != nil {
+					return opts, nil, fmt.Errorf("invalid value %q for --%s: want true or false", value, name)
+				}
+				v = b
+			}
+			set(&opts, v)
+			continue
+		}
+		if set, ok := globalValues[name]; ok {
+			if !hasValue {
+				if i+1 >= len(args) {
+					return opts, nil, fmt.Errorf("--%s needs a value", name)
+				}
+				i++
+				value = args[i]
+			}
+			if value == "" {
+				return opts, nil, fmt.Errorf("--%s needs a value", name)
+			}
+			set(&opts, value)
+			continue
+		}
+		if name == "verbose" {
+			if !hasValue {
+				opts.Verbosity++
+				continue
+			}
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				return opts, nil, fmt.Errorf("invalid value %q for --verbose: want a level such as 2", value)
+			}
+			opts.Verbosity = n
+			continue
+		}
+		if shorts, ok := combinedShorts(arg); ok {
+			for _, long := range shorts {
+				if long == "verbose" {
+					opts.Verbosity++
+				} else {
+					globalBools[long](&opts, true)
+				}
+			}
+			continue
+		}
+		rest = append(rest, arg)
+	}
+	return opts, rest, nil
+}
+
+// combinedShorts reads a single-dash run of global one-letter flags such as
+// -vvv or -qv. Any other letter means the argument belongs to the command.
+func combinedShorts(arg string) ([]string, bool) {
+	if strings.HasPrefix(arg, "--") || strings.Contains(arg, "=") {
+		return nil, false
+	}
+	longs := make([]string, 0, len(arg)-1)
+	for i := 1; i < len(arg); i++ {
+		long, ok := globalShorts[arg[i]]
+		if !ok {
+			return nil, false
+		}
+		longs = append(longs, long)
+	}
+	return longs, true
+}
@@ -0,0 +1,96 @@
+package cli
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPreparse(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want GlobalOptions
+		rest []string
+	}{
+		{"no flags", []string{"send", "a.txt"}, GlobalOptions{}, []string{"send", "a.txt"}},
+		{"before command", []string{"--no-color", "send", "a.txt"}, GlobalOptions{NoColor: true}, []string{"send", "a.txt"}},
+		{"after positional", []string{"send", "a.txt", "--json", "-v"}, GlobalOptions{JSON: true, Verbosity: 1}, []string{"send", "a.txt"}},
+		{"single dash long", []string{"receive", "-json", "-quiet"}, GlobalOptions{JSON: true, Quiet: true}, []string{"receive"}},
+		{"bool equals false", []string{"--no-color=false", "send"}, GlobalOptions{}, []string{"send"}},
+		{"bool equals true", []string{"send", "--log-full-urls=true"}, GlobalOptions{LogFullURLs: true}, []string{"send"}},
+		{"last bool wins", []string{"--no-color", "send", "--no-color=0"}, GlobalOptions{}, []string{"send"}},
+		{"repeated v", []string{"-v", "send", "-v"}, GlobalOptions{Verbosity: 2}, []string{"send"}},
+		{"combined vv", []string{"send", "-vvv"}, GlobalOptions{Verbosity: 3}, []string{"send"}},
+		{"combined qv", []string{"-qv", "send"}, GlobalOptions{Quiet: true, Verbosity: 1}, []string{"send"}},
+		{"v equals level", []string{"send", "-v=2"}, GlobalOptions{Verbosity: 2}, []string{"send"}},
+		{"verbose equals level", []string{"send", "--verbose=0"}, GlobalOptions{}, []string{"send"}},
+		{"long verbose", []string{"--verbose", "--verbose", "host"}, GlobalOptions{Verbosity: 2}, []string{"host"}},
+		{"config next arg", []string{"--config", "warp.yaml", "send", "x"}, GlobalOptions{ConfigPath: "warp.yaml"}, []string{"send", "x"}},
+		{"config equals", []string{"send", "x", "--config=/etc/warp.yaml"}, GlobalOptions{ConfigPath: "/etc/warp.yaml"}, []string{"send", "x"}},
+		{"profile", []string{"send", "-profile", "cpu.out", "x"}, GlobalOptions{Profile: "cpu.out"}, []string{"send", "x"}},
+		{"value looks like flag", []string{"--config", "-v", "send"}, GlobalOptions{ConfigPath: "-v"}, []string{"send"}},
+		{"command flags kept", []string{"send", "-p", "8080", "--text=hi", "-f"}, GlobalOptions{}, []string{"send", "-p", "8080", "--text=hi", "-f"}},
+		{"mixed shorts kept", []string{"receive", "-vf"}, GlobalOptions{}, []string{"receive", "-vf"}},
+		{"double dash", []string{"send", "-v", "--", "--json", "-v"}, GlobalOptions{Verbosity: 1}, []string{"send", "--", "--json", "-v"}},
+		{"lone dash", []string{"send", "--text", "-", "-q"}, GlobalOptions{Quiet: true}, []string{"send", "--text", "-"}},
+		{"empty", nil, GlobalOptions{}, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, rest, err := Preparse(tt.args)
+			if err != nil {
+				t.Fatalf("Preparse(%q): %v", tt.args, err)
+			}
+			if got != tt.want {
+				t.Errorf("options = %+v, want %+v", got, tt.want)
+			}
+			if !reflect.DeepEqual(rest, tt.rest) {
+				t.Errorf("rest = %q, want %q", rest, tt.rest)
+			}
+		})
+	}
+}
+
+func TestPreparseErrors(t *testing.T) {
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"send", "--config"}, "--config needs a value"},
+		{[]string{"send", "--profile="}, "--profile needs a value"},
+		{[]string{"--no-color=maybe", "send"}, `invalid value "maybe" for --no-color`},
+		{[]string{"send", "-v=loud"}, `invalid value "loud" for --verbose`},
+		{[]string{"send", "--verbose=-1"}, `invalid value "-1" for --verbose`},
+	}
+	for _, tt := range tests {
+		_, _, err := Preparse(tt.args)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Preparse(%q) error = %v, want %q", tt.args, err, tt.want)
+		}
+	}
+}
+
+func TestGlobalFlagsDocumented(t *testing.T) {
+	documented := map[string]bool{}
+	for _, f := range GlobalFlags {
+		for _, n := range f.Names {
+			documented[n] = true
+		}
+	}
+	for name := range globalBools {
+		if !documented[name] {
+			t.Errorf("--%s is not in GlobalFlags", name)
+		}
+	}
+	for name := range globalValues {
+		if !documented[name] {
+			t.Errorf("--%s is not in GlobalFlags", name)
+		}
+	}
+	for short, long := range globalShorts {
+		if !documented[string(short)] || !documented[long] {
+			t.Errorf("-%c, --%s is not in GlobalFlags", short, long)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/zulfikawr/warp/internal/i18n"
+)
+
+// flagColumn is where flag descriptions start; longer flags push theirs one
+// space past the flag
+const flagColumn = 18
+
+// Style holds the escape codes help is drawn with. The zero Style renders
+// plain text.
+type Style struct {
+	Bold, Dim, Green, Yellow, Reset string
+}
+
+// Render writes the terminal help for c, listing the flags of fs
+func (c *Command) Render(w io.Writer, fs *flag.FlagSet, st Style) error {
+	p := &printer{w: w}
+	p.linef("%s%s%s%s - %s", st.Bold, st.Green, c.Title(), st.Reset, c.Summary)
+
+	p.heading(st, i18n.T("help.usage"))
+	for _, u := range c.Usage {
+		p.linef("  %s%s%s %s", st.Green, c.Title(), st.Reset, u)
+	}
+
+	if len(c.Description) > 0 {
+		p.heading(st, i18n.T("help.description"))
+		for _, line := range c.Description {
+			if line == "" {
+				p.linef("")
+			} else {
+				p.linef("  %s", line)
+			}
+		}
+	}
+
+	if flags := c.Flags(fs); len(flags) > 0 {
+		p.heading(st, i18n.T("help.flags"))
+		for _, f := range flags {
+			p.item(st, f.Spelling(), f.Text())
+		}
+	}
+
+	for _, s := range c.Sections {
+		p.heading(st, s.Title)
+		for _, it := range s.Items {
+			p.item(st, it.Term, it.Text)
+		}
+		for _, line := range s.Lines {
+			p.linef("  %s", line)
+		}
+	}
+
+	if len(c.Examples) > 0 {
+		p.heading(st, i18n.T("help.examples"))
+		width := 0
+		for _, ex := range c.Examples {
+			if ex.Comment != "" {
+				width = max(width, len(ex.Command))
+			}
+		}
+		for _, ex := range c.Examples {
+			line := strings.Replace(ex.Command, c.Title(), st.Green+c.Title()+st.Reset, 1)
+			if ex.Comment != "" {
+				line += strings.Repeat(" ", width-len(ex.Command)+1) + st.Dim + "# " + ex.Comment + st.Reset
+			}
+			p.linef("  %s", line)
+		}
+	}
+
+	if len(c.Notes) > 0 {
+		p.linef("")
+		for _, line := range c.Notes {
+			p.linef("%s%s%s", st.Dim, line, st.Reset)
+		}
+	}
+	return p.err
+}
+
+// printer writes lines and keeps the first error
+type printer struct {
+	w   io.Writer
+	err error
+}
+
+func (p *printer) linef(format string, args ...any) {
+	if p.err == nil {
+		_, p.err = fmt.Fprintf(p.w, format+"\n", args...)
+	}
+}
+
+func (p *printer) heading(st Style, title string) {
+	p.linef("")
+	p.linef("%s%s:%s", st.Bold, title, st.Reset)
+}
+
+// item writes a term and its text in two columns
+func (p *printer) item(st Style, term, text string) {
+	pad := max(flagColumn-len(term), 1)
+	p.linef("  %s%s%s%s%s", st.Yellow, term, st.Reset, strings.Repeat(" ", pad), text)
+}
@@ -0,0 +1,115 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+
+	"github.com/zulfikawr/warp/internal/protocol"
+)
+
+// AppendResult is the outcome of an AppendFile
+type AppendResult struct {
+	Offset   int64 // Size of the host's file before the append
+	Sent     int64 // Bytes appended
+	FileSize int64 // Size of the host's file after the append
+}
+
+// AppendOffsetError is a 409 to an append: the host's file wasn't the size
+// the client said it expected
+type AppendOffsetError struct {
+	Expected int64
+	Size     int64 // The host's file size
+}
+
+func (e *AppendOffsetError) Error() string {
+	return fmt.Sprintf("append offset mismatch: expected %d bytes on the host, it has %d", e.Expected, e.Size)
+}
+
+// AppendFile sends the part of the file at path that the host's file called
+// name doesn't have yet, for a host started with --allow-append. The host's
+// file is taken to be an earlier copy of the local one: its size is asked for
+// first, then the local bytes past it are appended with that size as
+// X-Append-Offset, so nothing is sent twice and a gap is refused.
+func AppendFile(ctx context.Context, uploadURL, path, name string) (AppendResult, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return AppendResult{}, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+	fi, err := f.Stat()
+	if err != nil {
+		return AppendResult{}, fmt.Errorf("failed to stat file: %w", err)
+	}
+	size := fi.Size()
+	hc := defaultHTTPClient()
+
+	// An empty append expecting an empty file reveals the size in its 409,
+	// and the host creates no file for it
+	offset := int64(0)
+	var conflict *AppendOffsetError
+	if _, err := sendAppend(ctx, hc, uploadURL, name, 0, http.NoBody, 0); errors.As(err, &conflict) {
+		offset = conflict.Size
+	} else if err != nil {
+		return AppendResult{}, err
+	}
+	if offset > size {
+		return AppendResult{Offset: offset, FileSize: offset}, fmt.Errorf(
+			"the host's %s has %d bytes, more than the %d here: the local file was truncated or rotated", name, offset, size)
+	}
+	if offset == size {
+		return AppendResult{Offset: offset, FileSize: offset}, nil
+	}
+
+	fileSize, err := sendAppend(ctx, hc, uploadURL, name, offset, io.NewSectionReader(f, offset, size-offset), size-offset)
+	if err != nil {
+		return AppendResult{Offset: offset}, err
+	}
+	return AppendResult{Offset: offset, Sent: size - offset, FileSize: fileSize}, nil
+}
+
+// sendAppend appends n bytes of body to the host's file called name, which
+// must be offset bytes long, and returns its new size
+func sendAppend(ctx context.Context, hc *http.Client, uploadURL, name string, offset int64, body io.Reader, n int64) (int64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, uploadURL, body)
+	if err != nil {
+		return 0, fmt.Errorf("create request: %w", err)
+	}
+	req.ContentLength = n
+	req.Header.Set("X-File-Name", url.QueryEscape(name))
+	req.Header.Set(protocol.AppendHeader, "true")
+	req.Header.Set(protocol.AppendOffsetHeader, strconv.FormatInt(offset, 10))
+	req.Header.Set("Content-Type", "application/octet-stream")
+
+	resp, err := hc.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("send request: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		var result struct {
+			FileSize int64 `json:"file_size"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+			return 0, fmt.Errorf("read append response: %w", err)
+		}
+		return result.FileSize, nil
+	case http.StatusConflict:
+		var result struct {
+			Size int64 `json:"size"`
+		}
+		if err := json.NewDecoder(io.LimitReader(resp.Body, 1024)).Decode(&result); err != nil {
+			return 0, fmt.Errorf("read append conflict: %w", err)
+		}
+		return 0, &AppendOffsetError{Expected: offset, Size: result.Size}
+	}
+	return 0, statusError(resp)
+}
@@ -0,0 +1,105 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/zulfikawr/warp/internal/protocol"
+)
+
+// appendHost keeps one appended file in memory and counts the bytes sent
+type appendHost struct {
+	mu   sync.Mutex
+	data []byte
+	sent int
+}
+
+func (h *appendHost) serve(w http.ResponseWriter, r *http.Request) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if r.Header.Get(protocol.AppendHeader) != "true" {
+		http.Error(w, "not an append", http.StatusBadRequest)
+		return
+	}
+	if off, err := strconv.ParseInt(r.Header.Get(protocol.AppendOffsetHeader), 10, 64); err != nil || off != int64(len(h.data)) {
+		w.WriteHeader(http.StatusConflict)
+		_ = json.NewEncoder(w).Encode(map[string]any{"error": "offset mismatch", "size": len(h.data)})
+		return
+	}
+	body, _ := io.ReadAll(r.Body)
+	h.data = append(h.data, body...)
+	h.sent += len(body)
+	_ = json.NewEncoder(w).Encode(map[string]any{"success": true, "size": len(body), "file_size": len(h.data)})
+}
+
+func TestAppendFileSendsTail(t *testing.T) {
+	h := &appendHost{}
+	ts := httptest.NewServer(http.HandlerFunc(h.serve))
+	defer ts.Close()
+	path := filepath.Join(t.TempDir(), "app.log")
+	write := func(s string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(s), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ctx := context.Background()
+
+	write("one\n")
+	res, err := AppendFile(ctx, ts.URL, path, "app.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != (AppendResult{Offset: 0, Sent: 4, FileSize: 4}) {
+		t.Errorf("first append = %+v", res)
+	}
+
+	write("one\ntwo\n")
+	if res, err = AppendFile(ctx, ts.URL, path, "app.log"); err != nil {
+		t.Fatal(err)
+	}
+	if res != (AppendResult{Offset: 4, Sent: 4, FileSize: 8}) {
+		t.Errorf("second append = %+v", res)
+	}
+	if string(h.data) != "one\ntwo\n" || h.sent != 8 {
+		t.Errorf("host has %q after %d bytes sent", h.data, h.sent)
+	}
+
+	// Nothing new: nothing sent
+	if res, err = AppendFile(ctx, ts.URL, path, "app.log"); err != nil || res.Sent != 0 || h.sent != 8 {
+		t.Errorf("unchanged file: %+v, %v, %d bytes sent in all", res, err, h.sent)
+	}
+
+	// A rotated log is shorter than what the host has
+	write("new\n")
+	if _, err = AppendFile(ctx, ts.URL, path, "app.log"); err == nil || !strings.Contains(err.Error(), "rotated") {
+		t.Errorf("rotated file: error = %v", err)
+	}
+	if string(h.data) != "one\ntwo\n" {
+		t.Errorf("host has %q after the rotated file", h.data)
+	}
+}
+
+func TestAppendFileRefused(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "appending is not enabled on this host (start it with --allow-append)", http.StatusBadRequest)
+	}))
+	defer ts.Close()
+	path := filepath.Join(t.TempDir(), "app.log")
+	if err := os.WriteFile(path, []byte("data"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	_, err := AppendFile(context.Background(), ts.URL, path, "app.log")
+	if err == nil || !strings.Contains(err.Error(), "--allow-append") {
+		t.Errorf("error = %v, want the host's explanation", err)
+	}
+}
@@ -0,0 +1,212 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/zulfikawr/warp/internal/crypto"
+	"github.com/zulfikawr/warp/internal/discovery"
+	"github.com/zulfikawr/warp/internal/protocol"
+	"github.com/zulfikawr/warp/internal/ui"
+)
+
+const (
+	// defaultBatchInterval is the pause between mDNS browse rounds
+	defaultBatchInterval = 2 * time.Second
+	// defaultBatchBrowseTimeout is how long each browse round listens
+	defaultBatchBrowseTimeout = 3 * time.Second
+)
+
+// BatchReceiver downloads a stream of shares into one directory until its
+// context is cancelled. Each share is fetched at most once.
+type BatchReceiver struct {
+	Downloader    *Downloader
+	Dir           string
+	Out           io.Writer // One summary line per share
+	Progress      io.Writer // Per-transfer progress; nil disables it
+	Interval      time.Duration
+	BrowseTimeout time.Duration
+	// Browse and Handshake default to mDNS discovery and the Downloader's PAKE
+	// handshake; tests replace them
+	Browse    func(ctx context.Context, timeout time.Duration) ([]discovery.Service, error)
+	Handshake func(baseURL, code string) ([]byte, string, error)
+	// ConfirmAuth makes RunCodes ask, on the next input line, whether the
+	// verification words match the sender's before downloading
+	ConfirmAuth bool
+
+	fetched map[string]bool // share URL -> already attempted
+}
+
+// NewBatchReceiver returns a BatchReceiver saving into dir with d
+func NewBatchReceiver(d *Downloader, dir string, out io.Writer) *BatchReceiver {
+	return &BatchReceiver{
+		Downloader:    d,
+		Dir:           dir,
+		Out:           out,
+		Interval:      defaultBatchInterval,
+		BrowseTimeout: defaultBatchBrowseTimeout,
+		Browse:        discovery.Browse,
+		Handshake:     d.PerformPAKEHandshake,
+		fetched:       make(map[string]bool),
+	}
+}
+
+// Run browses for send-mode shares and downloads each new one until ctx is
+// cancelled
+func (b *BatchReceiver) Run(ctx context.Context) error {
+	for {
+		services, err := b.Browse(ctx, b.BrowseTimeout)
+		if err != nil && ctx.Err() == nil {
+			return fmt.Errorf("failed to browse for servers: %w", err)
+		}
+		for _, svc := range services {
+			if ctx.Err() != nil {
+				break
+			}
+			if svc.Mode != "send" || svc.Token == "" {
+				continue
+			}
+			b.fetch(svc.Name, fmt.Sprintf("http://%s:%d%s%s", svc.IP, svc.Port, protocol.PathPrefix, svc.Token), nil)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(b.Interval):
+		}
+	}
+}
+
+// RunCodes reads PAKE codes from codes, one per line, and downloads the share
+// each one unlocks. It returns at EOF or when ctx is cancelled.
+func (b *BatchReceiver) RunCodes(ctx context.Context, codes io.Reader) error {
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		sc := bufio.NewScanner(codes)
+		for sc.Scan() {
+			lines <- strings.TrimSpace(sc.Text())
+		}
+	}()
+
+	for {
+		b.printf("Enter PAKE code (Ctrl+C to stop): ")
+		var code string
+		select {
+		case <-ctx.Done():
+			b.printf("\n")
+			return nil
+		case line, ok := <-lines:
+			if !ok {
+				b.printf("\n")
+				return nil
+			}
+			code = line
+		}
+		if code == "" {
+			continue
+		}
+		var confirm func() bool
+		if b.ConfirmAuth {
+			confirm = func() bool {
+				b.printf("Do they match the words on the sender's screen? [y/N]: ")
+				select {
+				case <-ctx.Done():
+					return false
+				case line := <-lines:
+					line = strings.ToLower(line)
+					return line == "y" || line == "yes"
+				}
+			}
+		}
+		if err := b.receiveCode(ctx, code, confirm); err != nil {
+			b.printf("%s✗ %v%s\n", ui.Colors.Red, err, ui.Colors.Reset)
+		}
+	}
+}
+
+// receiveCode finds the server holding code and downloads its share. The
+// verification words are shown first; when confirm is set, the download only
+// goes ahead if it returns true.
+func (b *BatchReceiver) receiveCode(ctx context.Context, code string, confirm func() bool) error {
+	services, err := b.Browse(ctx, b.BrowseTimeout)
+	if err != nil {
+		return fmt.Errorf("failed to browse for servers: %w", err)
+	}
+	for _, svc := range services {
+		if svc.Mode != "send" {
+			continue
+		}
+		baseURL := fmt.Sprintf("http://%s:%d", svc.IP, svc.Port)
+		key, token, err := b.Handshake(baseURL, code)
+		if err != nil {
+			continue
+		}
+		b.printf("Verification words: %s%s%s\n", ui.Colors.Bold, crypto.AuthString(key), ui.Colors.Reset)
+		if confirm != nil && !confirm() {
+			return fmt.Errorf("verification words not confirmed; nothing downloaded from %s", svc.Name)
+		}
+		b.fetch(svc.Name, baseURL+protocol.PathPrefix+token, key)
+		return nil
+	}
+	return fmt.Errorf("no server found with code %s", code)
+}
+
+// fetch downloads url into the batch directory unless it was already
+// attempted, and prints a one-line summary
+func (b *BatchReceiver) fetch(source, url string, key []byte) {
+	if b.fetched[url] {
+		return
+	}
+	b.fetched[url] = true
+
+	d := *b.Downloader
+	d.OutputDir = b.Dir
+	if r := d.renderer(b.Progress); r != nil {
+		d.Renderer = progressOnly{r}
+	}
+
+	start := time.Now()
+	saved, err := d.Receive(url, "", false, b.Progress, key)
+	if err != nil {
+		b.printf("%s✗ %s: %v%s\n", ui.Colors.Red, source, firstLine(err.Error()), ui.Colors.Reset)
+		return
+	}
+	size := "text"
+	if fi, err := os.Stat(saved); err == nil {
+		size = ui.FormatBytes(fi.Size())
+		saved = filepath.Base(saved)
+	}
+	b.printf("%s✓%s %s  %s  %s  from %s\n", ui.Colors.Green, ui.Colors.Reset,
+		saved, size, ui.FormatDuration(time.Since(start)), source)
+}
+
+func (b *BatchReceiver) printf(format string, args ...any) {
+	if b.Out != nil {
+		_, _ = fmt.Fprintf(b.Out, format, args...)
+	}
+}
+
+// progressOnly forwards progress but replaces the per-transfer summary block,
+// since batch mode prints its own one-line summary
+type progressOnly struct {
+	ui.Renderer
+}
+
+func (p progressOnly) Finish(ui.Summary) {
+	p.Renderer.Finish(ui.Summary{})
+}
+
+// firstLine trims multi-line error hints down to the headline
+func firstLine(s string) string {
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		return s[:i]
+	}
+	return s
+}
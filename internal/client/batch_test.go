@@ -0,0 +1,187 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/zulfikawr/warp/internal/crypto"
+	"github.com/zulfikawr/warp/internal/discovery"
+	"github.com/zulfikawr/warp/internal/protocol"
+)
+
+// shareServer serves filename with body under /d/<token> and counts downloads
+func shareServer(t *testing.T, token, filename, body string) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var hits atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != protocol.PathPrefix+token {
+			http.NotFound(w, r)
+			return
+		}
+		hits.Add(1)
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+		_, _ = w.Write([]byte(body))
+	}))
+	t.Cleanup(ts.Close)
+	return ts, &hits
+}
+
+// serviceFor describes ts as a discovered share
+func serviceFor(t *testing.T, ts *httptest.Server, name, mode, token string) discovery.Service {
+	t.Helper()
+	host, portStr, err := net.SplitHostPort(strings.TrimPrefix(ts.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	port, _ := strconv.Atoi(portStr)
+	return discovery.Service{Name: name, Mode: mode, Token: token, IP: net.ParseIP(host), Port: port}
+}
+
+func TestBatchReceiverDiscoversShares(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("existing"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tsA, hitsA := shareServer(t, "tokenA", "notes.txt", "from A")
+	tsB, hitsB := shareServer(t, "tokenB", "notes.txt", "from B")
+	tsC, hitsC := shareServer(t, "tokenC", "../escape.bin", "from C")
+	hostSvc, hostHits := shareServer(t, "tokenH", "upload.bin", "host")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	rounds := [][]discovery.Service{
+		{serviceFor(t, tsA, "alice", "send", "tokenA"), serviceFor(t, hostSvc, "host", "host", "tokenH")},
+		{serviceFor(t, tsA, "alice", "send", "tokenA"), serviceFor(t, tsB, "bob", "send", "tokenB")},
+		{serviceFor(t, tsB, "bob", "send", "tokenB"), serviceFor(t, tsC, "carol", "send", "tokenC")},
+	}
+	browses := 0
+	out := &bytes.Buffer{}
+	b := NewBatchReceiver(NewDownloader(nil), dir, out)
+	b.Interval = time.Millisecond
+	b.Browse = func(context.Context, time.Duration) ([]discovery.Service, error) {
+		if browses == len(rounds) {
+			cancel()
+			return nil, nil
+		}
+		browses++
+		return rounds[browses-1], nil
+	}
+
+	if err := b.Run(ctx); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	if hitsA.Load() != 2 || hitsB.Load() != 2 || hitsC.Load() != 2 {
+		t.Errorf("each share should be fetched once (2 requests each), got A=%d B=%d C=%d", hitsA.Load(), hitsB.Load(), hitsC.Load())
+	}
+	if hostHits.Load() != 0 {
+		t.Errorf("host-mode services must not be downloaded")
+	}
+
+	want := map[string]string{
+		"notes.txt":     "existing",
+		"notes (1).txt": "from A",
+		"notes (2).txt": "from B",
+		"escape.bin":    "from C",
+	}
+	for name, body := range want {
+		got, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if string(got) != body {
+			t.Errorf("%s = %q, want %q", name, got, body)
+		}
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("want one summary line per share, got:\n%s", out.String())
+	}
+	if !strings.Contains(lines[0], "notes (1).txt") || !strings.Contains(lines[0], "from alice") {
+		t.Errorf("unexpected summary line %q", lines[0])
+	}
+}
+
+func TestBatchReceiverCodes(t *testing.T) {
+	dir := t.TempDir()
+	ts, hits := shareServer(t, "tokenP", "secret.bin", "payload")
+	svc := serviceFor(t, ts, "alice", "send", "ignored")
+
+	out := &bytes.Buffer{}
+	b := NewBatchReceiver(NewDownloader(nil), dir, out)
+	b.Browse = func(context.Context, time.Duration) ([]discovery.Service, error) {
+		return []discovery.Service{svc}, nil
+	}
+	b.Handshake = func(baseURL, code string) ([]byte, string, error) {
+		if code != "7-apple-velocity" {
+			return nil, "", fmt.Errorf("wrong code")
+		}
+		return nil, "tokenP", nil
+	}
+
+	codes := strings.NewReader("7-apple-velocity\n\n1-wrong-code\n7-apple-velocity\n")
+	if err := b.RunCodes(context.Background(), codes); err != nil {
+		t.Fatalf("RunCodes: %v", err)
+	}
+
+	if got, err := os.ReadFile(filepath.Join(dir, "secret.bin")); err != nil || string(got) != "payload" {
+		t.Fatalf("secret.bin = %q, %v", got, err)
+	}
+	if hits.Load() != 2 {
+		t.Errorf("repeated code should not download again, got %d requests", hits.Load())
+	}
+	if !strings.Contains(out.String(), "no server found with code 1-wrong-code") {
+		t.Errorf("missing failure line for wrong code:\n%s", out.String())
+	}
+}
+
+func TestBatchReceiverCodesConfirmAuth(t *testing.T) {
+	dir := t.TempDir()
+	ts, hits := shareServer(t, "tokenP", "secret.bin", "payload")
+	svc := serviceFor(t, ts, "alice", "send", "ignored")
+
+	out := &bytes.Buffer{}
+	b := NewBatchReceiver(NewDownloader(nil), dir, out)
+	b.ConfirmAuth = true
+	b.Browse = func(context.Context, time.Duration) ([]discovery.Service, error) {
+		return []discovery.Service{svc}, nil
+	}
+	// The share isn't encrypted, so the handshake hands back no key
+	b.Handshake = func(baseURL, code string) ([]byte, string, error) {
+		return nil, "tokenP", nil
+	}
+
+	// Rejected words download nothing; the same code confirmed goes through
+	codes := strings.NewReader("7-apple-velocity\nn\n7-apple-velocity\nyes\n")
+	if err := b.RunCodes(context.Background(), codes); err != nil {
+		t.Fatalf("RunCodes: %v", err)
+	}
+
+	if got, err := os.ReadFile(filepath.Join(dir, "secret.bin")); err != nil || string(got) != "payload" {
+		t.Fatalf("secret.bin = %q, %v", got, err)
+	}
+	if hits.Load() != 2 {
+		t.Errorf("only the confirmed code should download, got %d requests", hits.Load())
+	}
+	if !strings.Contains(out.String(), crypto.AuthString(nil)) {
+		t.Errorf("verification words not shown:\n%s", out.String())
+	}
+	if !strings.Contains(out.String(), "verification words not confirmed") {
+		t.Errorf("missing line for the rejected words:\n%s", out.String())
+	}
+}
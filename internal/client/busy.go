@@ -0,0 +1,74 @@
+package client
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// maxBusyWait bounds how long the receiver waits on a server at its transfer limit
+const maxBusyWait = 2 * time.Minute
+
+// defaultBusyRetry is used when a 503 carries no usable Retry-After
+const defaultBusyRetry = 1 * time.Second
+
+// getWithBusyRetry issues a GET with the given Range (if any), retrying while the
+// server answers 503 or 429 with Retry-After, up to maxBusyWait in total
+func (d *Downloader) getWithBusyRetry(url, rangeHeader string, progress io.Writer) (*http.Response, error) {
+	resp, _, err := d.getTimedWithBusyRetry(url, rangeHeader, progress)
+	return resp, err
+}
+
+// getTimedWithBusyRetry is getWithBusyRetry that also returns when the request
+// that got the response was sent, so time spent waiting out a busy server
+// isn't counted as the server's
+func (d *Downloader) getTimedWithBusyRetry(url, rangeHeader string, progress io.Writer) (*http.Response, time.Time, error) {
+	deadline := time.Now().Add(maxBusyWait)
+	for {
+		req, err := http.NewRequest("GET", url, nil)
+		if err != nil {
+			return nil, time.Time{}, fmt.Errorf("failed to create request: %w", err)
+		}
+		if rangeHeader != "" {
+			req.Header.Set("Range", rangeHeader)
+		}
+		sent := time.Now()
+		resp, err := d.client.Do(req)
+		if err != nil {
+			return nil, time.Time{}, err
+		}
+		busy := resp.StatusCode == http.StatusServiceUnavailable || resp.StatusCode == http.StatusTooManyRequests
+		if !busy || resp.Header.Get("Retry-After") == "" {
+			return resp, sent, nil
+		}
+
+		wait := parseRetryAfter(resp.Header.Get("Retry-After"))
+		if time.Now().Add(wait).After(deadline) {
+			return resp, sent, nil
+		}
+		_ = resp.Body.Close()
+		if progress != nil {
+			reason := "Server busy"
+			if resp.StatusCode == http.StatusTooManyRequests {
+				reason = "Rate limited"
+			}
+			_, _ = fmt.Fprintf(progress, "%s, retrying in %s...\n", reason, wait)
+		}
+		time.Sleep(wait)
+	}
+}
+
+// parseRetryAfter reads a Retry-After value in seconds or as an HTTP date
+func parseRetryAfter(v string) time.Duration {
+	if secs, err := strconv.Atoi(v); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d.Round(time.Second)
+		}
+	}
+	return defaultBusyRetry
+}
@@ -0,0 +1,138 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/zulfikawr/warp/internal/protocol"
+	"github.com/zulfikawr/warp/internal/ui"
+)
+
+// ErrUploadRejected is returned before any chunk is sent when the host's
+// advertised limits rule the file out
+var ErrUploadRejected = errors.New("upload rejected by host")
+
+// fetchCapabilities reads the host's manifest once per upload. Hosts that
+// predate the capabilities document (404, or a manifest without a version)
+// yield nil, and the upload keeps its configured defaults.
+func fetchCapabilities(ctx context.Context, c *http.Client, uploadURL string) (*protocol.Capabilities, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(uploadURL, "/")+protocol.ManifestPathSuffix, nil)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	resp, err := c.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		// Let the chunk uploads report the connection problem with retries
+		return nil, nil
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized:
+		return nil, fmt.Errorf("%w: authentication required (Basic auth credentials missing or wrong)", ErrUploadRejected)
+	case resp.StatusCode != http.StatusOK:
+		return nil, nil
+	}
+
+	var caps protocol.Capabilities
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 64*1024)).Decode(&caps); err != nil || caps.Version == "" {
+		return nil, nil
+	}
+	return &caps, nil
+}
+
+// Info reads the sender's /info document for the share at shareURL: its
+// name, size, features and a time estimate. Senders that predate it yield an
+// error.
+func (d *Downloader) Info(ctx context.Context, shareURL string) (*protocol.Capabilities, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(shareURL, "/")+protocol.InfoPathSuffix, nil)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return nil, statusError(resp)
+	}
+	var caps protocol.Capabilities
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 64*1024)).Decode(&caps); err != nil {
+		return nil, fmt.Errorf("invalid info response: %w", err)
+	}
+	return &caps, nil
+}
+
+// adaptConfig fits cfg to the host's capabilities for uploading a file called
+// name of size bytes. It adopts the host's chunk size, never runs more workers
+// than the host suggests or allows, and fails on any limit the file breaks.
+// A nil caps leaves cfg unchanged.
+func adaptConfig(cfg UploadConfig, caps *protocol.Capabilities, name string, size int64) (UploadConfig, error) {
+	encrypted := caps != nil && caps.Has(protocol.FeatureEncryptedChunks)
+	if cfg.Key != nil && !encrypted {
+		return cfg, fmt.Errorf("%w: the host doesn't accept encrypted chunks", ErrUploadRejected)
+	}
+	if caps == nil {
+		return cfg, nil
+	}
+
+	limits := caps.Limits
+	if limits.MaxFileSize > 0 && size > limits.MaxFileSize {
+		return cfg, fmt.Errorf("%w: %s is %s, over the %s file size limit",
+			ErrUploadRejected, name, ui.FormatBytes(size), ui.FormatBytes(limits.MaxFileSize))
+	}
+	if err := limits.ValidateTotalSize(size); err != nil {
+		return cfg, fmt.Errorf("%w: %s is %s, over the %s upload limit",
+			ErrUploadRejected, name, ui.FormatBytes(size), ui.FormatBytes(limits.MaxTotalSize))
+	}
+	if !limits.ExtensionAllowed(name) {
+		return cfg, fmt.Errorf("%w: %s has a file type the host does not accept (allowed: %s)",
+			ErrUploadRejected, name, strings.Join(limits.AllowedExtensions, ", "))
+	}
+	if caps.FreeSpace > 0 && size > caps.FreeSpace {
+		return cfg, fmt.Errorf("%w: %s is %s but the host has only %s free",
+			ErrUploadRejected, name, ui.FormatBytes(size), ui.FormatBytes(caps.FreeSpace))
+	}
+
+	if caps.ChunkSize > 0 {
+		cfg.ChunkSize = caps.ChunkSize
+	}
+	if limits.MaxChunkSize > 0 && cfg.ChunkSize > limits.MaxChunkSize {
+		cfg.ChunkSize = limits.MaxChunkSize
+	}
+	// Larger chunks for a file that would otherwise need more than the host
+	// accepts in one upload
+	if limits.MaxChunks > 0 {
+		if need := (size + int64(limits.MaxChunks) - 1) / int64(limits.MaxChunks); cfg.ChunkSize < need {
+			cfg.ChunkSize = need
+		}
+		if limits.MaxChunkSize > 0 && cfg.ChunkSize > limits.MaxChunkSize {
+			return cfg, fmt.Errorf("%w: %s is %s, more than %d chunks of at most %s",
+				ErrUploadRejected, name, ui.FormatBytes(size), limits.MaxChunks, ui.FormatBytes(limits.MaxChunkSize))
+		}
+	}
+	for _, limit := range []int{caps.MaxConcurrent, limits.MaxConcurrent} {
+		if limit > 0 && cfg.MaxConcurrent > limit {
+			cfg.MaxConcurrent = limit
+		}
+	}
+	if !caps.Has(protocol.FeatureParallelChunks) {
+		cfg.MaxConcurrent = 1
+	}
+	// A sealed upload doesn't send the file's checksum in the clear; every
+	// chunk is authenticated instead
+	if !caps.Has(protocol.FeatureVerify) || cfg.Key != nil {
+		cfg.Verify = false
+	}
+	cfg.sessionStatus = caps.Has(protocol.FeatureSessionStatus)
+	return cfg, nil
+}
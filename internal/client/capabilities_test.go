@@ -0,0 +1,177 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/zulfikawr/warp/internal/protocol"
+)
+
+func TestAdaptConfig(t *testing.T) {
+	base := UploadConfig{ChunkSize: 2 << 20, MaxConcurrent: 4, Verify: true}
+	allFeatures := []string{protocol.FeatureParallelChunks, protocol.FeatureRawStream, protocol.FeatureVerify}
+
+	tests := []struct {
+		name        string
+		caps        *protocol.Capabilities
+		file        string
+		size        int64
+		wantChunk   int64
+		wantWorkers int
+		wantVerify  bool
+		wantErr     string
+	}{
+		{"legacy host keeps defaults", nil, "a.bin", 10 << 20, 2 << 20, 4, true, ""},
+		{
+			"adopts chunk size and worker hint",
+			&protocol.Capabilities{Version: "1.1.0", ChunkSize: 8 << 20, MaxConcurrent: 2, Features: allFeatures},
+			"a.bin", 10 << 20, 8 << 20, 2, true, "",
+		},
+		{
+			"never more workers than transfer slots",
+			&protocol.Capabilities{Version: "1.1.0", MaxConcurrent: 3, Features: allFeatures, Limits: protocol.Limits{MaxConcurrent: 1}},
+			"a.bin", 10 << 20, 2 << 20, 1, true, "",
+		},
+		{
+			"no parallel chunks or verify",
+			&protocol.Capabilities{Version: "1.1.0", MaxConcurrent: 3, Features: []string{protocol.FeatureRawStream}},
+			"a.bin", 10 << 20, 2 << 20, 1, false, "",
+		},
+		{
+			"file over size limit",
+			&protocol.Capabilities{Version: "1.1.0", Features: allFeatures, Limits: protocol.Limits{MaxFileSize: 1 << 20}},
+			"a.bin", 10 << 20, 0, 0, false, "over the 1.0 MiB file size limit",
+		},
+		{
+			"extension not allowed",
+			&protocol.Capabilities{Version: "1.1.0", Features: allFeatures, Limits: protocol.Limits{AllowedExtensions: []string{".jpg", ".png"}}},
+			"a.BIN", 1, 0, 0, false, "allowed: .jpg, .png",
+		},
+		{
+			"allowed extension is case-insensitive",
+			&protocol.Capabilities{Version: "1.1.0", Features: allFeatures, Limits: protocol.Limits{AllowedExtensions: []string{".jpg"}}},
+			"IMG_01.JPG", 1, 2 << 20, 4, true, "",
+		},
+		{
+			"chunk size capped at the host's maximum",
+			&protocol.Capabilities{Version: "1.1.0", ChunkSize: 8 << 20, Features: allFeatures, Limits: protocol.Limits{MaxChunkSize: 4 << 20}},
+			"a.bin", 10 << 20, 4 << 20, 4, true, "",
+		},
+		{
+			"chunks grow to fit the chunk count",
+			&protocol.Capabilities{Version: "1.1.0", Features: allFeatures, Limits: protocol.Limits{MaxChunks: 4, MaxChunkSize: 4 << 20}},
+			"a.bin", 10 << 20, 10 << 20 / 4, 4, true, "",
+		},
+		{
+			"too many chunks even at the maximum size",
+			&protocol.Capabilities{Version: "1.1.0", Features: allFeatures, Limits: protocol.Limits{MaxChunks: 2, MaxChunkSize: 4 << 20}},
+			"a.bin", 10 << 20, 0, 0, false, "more than 2 chunks of at most 4.0 MiB",
+		},
+		{
+			"over the upload size limit",
+			&protocol.Capabilities{Version: "1.1.0", Features: allFeatures, Limits: protocol.Limits{MaxTotalSize: 1 << 20}},
+			"a.bin", 10 << 20, 0, 0, false, "over the 1.0 MiB upload limit",
+		},
+		{
+			"not enough free space",
+			&protocol.Capabilities{Version: "1.1.0", Features: allFeatures, FreeSpace: 5 << 20},
+			"a.bin", 10 << 20, 0, 0, false, "only 5.0 MiB free",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := adaptConfig(base, tt.caps, tt.file, tt.size)
+			if tt.wantErr != "" {
+				if !errors.Is(err, ErrUploadRejected) || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want ErrUploadRejected containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.ChunkSize != tt.wantChunk || got.MaxConcurrent != tt.wantWorkers || got.Verify != tt.wantVerify {
+				t.Errorf("chunk=%d workers=%d verify=%v, want %d/%d/%v",
+					got.ChunkSize, got.MaxConcurrent, got.Verify, tt.wantChunk, tt.wantWorkers, tt.wantVerify)
+			}
+		})
+	}
+}
+
+func TestUploadFailsFastOnHostLimits(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "movie.mkv")
+	if err := os.WriteFile(path, make([]byte, 4096), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var chunks atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, protocol.ManifestPathSuffix) {
+			_ = json.NewEncoder(w).Encode(protocol.Capabilities{
+				Version:  "1.1.0",
+				Features: []string{protocol.FeatureParallelChunks},
+				Limits:   protocol.Limits{AllowedExtensions: []string{".jpg"}},
+			})
+			return
+		}
+		chunks.Add(1)
+		_, _ = w.Write([]byte(`{"success":true}`))
+	}))
+	defer ts.Close()
+
+	cfg := &UploadConfig{ChunkSize: 1024, MaxConcurrent: 2, RetryDelay: time.Millisecond}
+	err := ParallelUpload(context.Background(), ts.URL+"/u/token", path, cfg, nil)
+	if !errors.Is(err, ErrUploadRejected) {
+		t.Fatalf("err = %v, want ErrUploadRejected", err)
+	}
+	if chunks.Load() != 0 {
+		t.Errorf("%d chunks sent before the limit check", chunks.Load())
+	}
+}
+
+func TestUploadReplansChunksFromManifest(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.bin")
+	if err := os.WriteFile(path, make([]byte, 256<<10), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var chunks atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			_ = json.NewEncoder(w).Encode(protocol.Capabilities{
+				Version:       "1.1.0",
+				ChunkSize:     64 << 10,
+				MaxConcurrent: 2,
+				Features:      []string{protocol.FeatureParallelChunks},
+			})
+			return
+		}
+		chunks.Add(1)
+		_, _ = w.Write([]byte(`{"success":true}`))
+	}))
+	defer ts.Close()
+
+	cfg := &UploadConfig{ChunkSize: 1 << 20, MaxConcurrent: 4, Verify: true}
+	session, err := NewUploadSession(ts.URL+"/u/token", path, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := session.Upload(context.Background()); err != nil {
+		t.Fatalf("Upload: %v", err)
+	}
+	if chunks.Load() != 4 {
+		t.Errorf("sent %d chunks, want 4 of the host's 64KB", chunks.Load())
+	}
+	if session.Config.MaxConcurrent != 2 || session.Config.Verify {
+		t.Errorf("config not adapted: %+v", session.Config)
+	}
+}
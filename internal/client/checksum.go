@@ -0,0 +1,126 @@
+package client
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/zulfikawr/warp/internal/ui"
+)
+
+// ErrChecksumMismatch means the downloaded bytes don't have the expected
+// SHA-256, whether the server sent it or the user supplied it
+var ErrChecksumMismatch = errors.New("checksum verification failed")
+
+// ParseSHA256 checks that s is a SHA-256 digest in hex and lower-cases it
+func ParseSHA256(s string) (string, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if b, err := hex.DecodeString(s); err != nil || len(b) != 32 {
+		return "", fmt.Errorf("%q is not a SHA-256 digest (64 hex digits)", s)
+	}
+	return s, nil
+}
+
+// SHA256Sums maps file names to their SHA-256 digests, as listed by
+// sha256sum
+type SHA256Sums map[string]string
+
+// ParseSHA256Sums reads the output of sha256sum: one "<hash>  <name>" line
+// per file, with "*" before the name for binary mode. Blank lines and lines
+// starting with # are skipped.
+func ParseSHA256Sums(r io.Reader) (SHA256Sums, error) {
+	sums := SHA256Sums{}
+	sc := bufio.NewScanner(r)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		digest, name, ok := strings.Cut(line, " ")
+		name = strings.TrimPrefix(strings.TrimLeft(name, " "), "*")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("line %d: want \"<hash>  <name>\"", n)
+		}
+		digest, err := ParseSHA256(digest)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		sums[strings.TrimPrefix(name, "./")] = digest
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if len(sums) == 0 {
+		return nil, fmt.Errorf("no checksums listed")
+	}
+	return sums, nil
+}
+
+// LoadSHA256Sums reads a sha256sum file from disk
+func LoadSHA256Sums(file string) (SHA256Sums, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+	sums, err := ParseSHA256Sums(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	return sums, nil
+}
+
+// Lookup returns the digest listed for name, or failing that for the one
+// entry whose base name is name. Release pages often list files under a
+// directory the download doesn't keep.
+func (s SHA256Sums) Lookup(name string) (string, bool) {
+	if digest, ok := s[name]; ok {
+		return digest, true
+	}
+	var found string
+	for listed, digest := range s {
+		if path.Base(listed) != name {
+			continue
+		}
+		if found != "" && found != digest {
+			return "", false
+		}
+		found = digest
+	}
+	return found, found != ""
+}
+
+// HashFile returns the SHA-256 and size of the file at path. Files can be
+// large enough for hashing to take minutes, so a non-nil renderer is shown
+// the progress and finished when the file has been read.
+func HashFile(path string, renderer ui.Renderer) (string, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer func() { _ = f.Close() }()
+	fi, err := f.Stat()
+	if err != nil {
+		return "", 0, err
+	}
+	if !fi.Mode().IsRegular() {
+		return "", 0, fmt.Errorf("%s is not a regular file", path)
+	}
+	var r io.Reader = f
+	if renderer != nil {
+		r = &ui.ProgressReader{R: f, Total: fi.Size(), Renderer: renderer, Name: fi.Name()}
+		defer renderer.Finish(ui.Summary{})
+	}
+	h := sha256.New()
+	n, err := io.CopyBuffer(h, r, make([]byte, 1<<20))
+	if err != nil {
+		return "", 0, fmt.Errorf("hash %s: %w", path, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), n, nil
+}
@@ -0,0 +1,167 @@
+package client
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/zulfikawr/warp/internal/protocol"
+)
+
+const (
+	sumA = "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+	sumB = "60303ae22b998861bce3b28f33eec1be758a213c86c93c076dbe9f558c11c752"
+)
+
+func TestParseSHA256Sums(t *testing.T) {
+	input := "# release v1.2\n" +
+		sumA + "  warp-linux-amd64\n" +
+		"\n" +
+		strings.ToUpper(sumB) + " *dist/warp-darwin-arm64\n" +
+		sumA + "  ./docs/README.md\n"
+	sums, err := ParseSHA256Sums(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		want string
+		ok   bool
+	}{
+		{"warp-linux-amd64", sumA, true},
+		{"dist/warp-darwin-arm64", sumB, true},
+		{"warp-darwin-arm64", sumB, true}, // by base name, lower-cased
+		{"docs/README.md", sumA, true},    // leading ./ dropped
+		{"README.md", sumA, true},
+		{"warp-windows.exe", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := sums.Lookup(tt.name)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("Lookup(%q) = %q, %v; want %q, %v", tt.name, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestSHA256SumsAmbiguousBaseName(t *testing.T) {
+	sums, err := ParseSHA256Sums(strings.NewReader(sumA + "  a/app\n" + sumB + "  b/app\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := sums.Lookup("app"); ok {
+		t.Errorf("Lookup(app) = %q, want no match for two different files", got)
+	}
+	if got, _ := sums.Lookup("b/app"); got != sumB {
+		t.Errorf("Lookup(b/app) = %q, want %q", got, sumB)
+	}
+}
+
+func TestParseSHA256SumsErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"", "no checksums listed"},
+		{"# only a comment\n", "no checksums listed"},
+		{sumA + "\n", "line 1"},
+		{sumA + "  ok\nnothex  bad\n", "line 2"},
+		{sumA[:40] + "  short\n", "not a SHA-256 digest"},
+	}
+	for _, tt := range tests {
+		_, err := ParseSHA256Sums(strings.NewReader(tt.input))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("ParseSHA256Sums(%q) error = %v, want %q", tt.input, err, tt.want)
+		}
+	}
+}
+
+func TestParseSHA256(t *testing.T) {
+	if got, err := ParseSHA256(" " + strings.ToUpper(sumA) + "\n"); err != nil || got != sumA {
+		t.Errorf("ParseSHA256 = %q, %v", got, err)
+	}
+	for _, bad := range []string{"", "xyz", sumA + "00", sumA[:63]} {
+		if _, err := ParseSHA256(bad); err == nil {
+			t.Errorf("ParseSHA256(%q) accepted", bad)
+		}
+	}
+}
+
+// checksumServer serves body as report.bin, with a checksum header if
+// header is set
+func checksumServer(t *testing.T, body, header string) string {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Disposition", `attachment; filename="report.bin"`)
+		if header != "" {
+			w.Header().Set(protocol.ContentSHA256Header, header)
+		}
+		_, _ = w.Write([]byte(body))
+	}))
+	t.Cleanup(ts.Close)
+	return ts.URL
+}
+
+func TestReceiveSuppliedChecksum(t *testing.T) {
+	body := "release build"
+	// The server vouches for the file it sends; only the supplied
+	// checksum shows it isn't the one expected
+	url := checksumServer(t, body, sha256Hex(body))
+
+	t.Run("match", func(t *testing.T) {
+		d := NewDownloader(nil)
+		d.SHA256 = sha256Hex(body)
+		out := filepath.Join(t.TempDir(), "report.bin")
+		if _, err := d.Receive(url, out, false, io.Discard, nil); err != nil {
+			t.Fatalf("Receive: %v", err)
+		}
+	})
+	t.Run("mismatch deletes", func(t *testing.T) {
+		d := NewDownloader(nil)
+		d.SHA256 = sumA
+		out := filepath.Join(t.TempDir(), "report.bin")
+		_, err := d.Receive(url, out, false, io.Discard, nil)
+		if !errors.Is(err, ErrChecksumMismatch) || !strings.Contains(err.Error(), "(supplied)") {
+			t.Fatalf("Receive = %v, want a supplied checksum mismatch", err)
+		}
+		if _, err := os.Stat(out); !os.IsNotExist(err) {
+			t.Errorf("mismatched file was kept: %v", err)
+		}
+	})
+	t.Run("mismatch kept", func(t *testing.T) {
+		d := NewDownloader(nil)
+		d.SHA256 = sumA
+		d.KeepOnMismatch = true
+		out := filepath.Join(t.TempDir(), "report.bin")
+		_, err := d.Receive(url, out, false, io.Discard, nil)
+		if !errors.Is(err, ErrChecksumMismatch) {
+			t.Fatalf("Receive = %v, want a checksum mismatch", err)
+		}
+		if b, err := os.ReadFile(out); err != nil || string(b) != body {
+			t.Errorf("kept file = %q, %v", b, err)
+		}
+	})
+}
+
+func TestReceiveChecksumFromSums(t *testing.T) {
+	body := "no header here"
+	url := checksumServer(t, body, "")
+
+	d := NewDownloader(nil)
+	d.SHA256Sums = SHA256Sums{"dist/report.bin": sha256Hex(body)}
+	if _, err := d.Receive(url, filepath.Join(t.TempDir(), "report.bin"), false, io.Discard, nil); err != nil {
+		t.Fatalf("Receive: %v", err)
+	}
+
+	d.SHA256Sums = SHA256Sums{"other.bin": sumA}
+	out := filepath.Join(t.TempDir(), "report.bin")
+	if _, err := d.Receive(url, out, false, io.Discard, nil); err == nil || !strings.Contains(err.Error(), "no checksum listed for report.bin") {
+		t.Fatalf("Receive = %v, want an unlisted file refused", err)
+	}
+	if _, err := os.Stat(out); !os.IsNotExist(err) {
+		t.Errorf("unlisted file was downloaded: %v", err)
+	}
+}
@@ -1,8 +1,16 @@
 package client
 
 import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
 	"net/http"
+	"sync"
 	"time"
+
+	"github.com/zulfikawr/warp/internal/protocol"
 )
 
 // defaultHTTPClient returns an HTTP client with optimized connection pooling and HTTP/2 support.
@@ -22,23 +30,97 @@ func defaultHTTPClient() *http.Client {
 	}
 
 	return &http.Client{
-		Transport: &acceptEncodingTransport{base},
+		Transport: &warpTransport{base},
 		Timeout:   5 * time.Minute,
 	}
 }
 
-// acceptEncodingTransport injects Accept-Encoding headers for zstd and gzip
-type acceptEncodingTransport struct {
+// NewRelayClient returns an HTTP client for a share reached through a relay.
+// Every connection comes from dial, whatever the URL's host, and carries
+// HTTP/2 over TLS so one connection serves all requests. The sender's
+// certificate is self-signed, so no CA can vouch for it: the first
+// connection pins it, later ones must present the same one, and the PAKE
+// handshake then checks it is the sender's (see PerformPAKEHandshake).
+func NewRelayClient(dial func(ctx context.Context) (net.Conn, error)) *http.Client {
+	c := defaultHTTPClient()
+	base := c.Transport.(*warpTransport).base.(*http.Transport)
+	base.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+		return dial(ctx)
+	}
+	pin := &certPin{}
+	// Chain verification is skipped in favour of the pin
+	base.TLSClientConfig = &tls.Config{InsecureSkipVerify: true, VerifyConnection: pin.verify}
+	base.MaxIdleConnsPerHost = 1
+	return c
+}
+
+// certPin holds the certificate of a relay client's first TLS connection
+type certPin struct {
+	mu  sync.Mutex
+	der []byte
+}
+
+// verify pins the peer's certificate, or checks it against the pinned one
+func (p *certPin) verify(cs tls.ConnectionState) error {
+	if len(cs.PeerCertificates) == 0 {
+		return errors.New("the sender presented no certificate")
+	}
+	raw := cs.PeerCertificates[0].Raw
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.der == nil {
+		p.der = bytes.Clone(raw)
+		return nil
+	}
+	if !bytes.Equal(p.der, raw) {
+		return errors.New("the sender's certificate changed between connections; the relay may be intercepting them")
+	}
+	return nil
+}
+
+// warpTransport injects Accept-Encoding headers for zstd and gzip and identifies
+// the client to the server with a User-Agent and X-Warp-Version
+type warpTransport struct {
 	base http.RoundTripper
 }
 
-func (t *acceptEncodingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+func (t *warpTransport) RoundTrip(req *http.Request) (*http.Response, error) {
 	if req.Header.Get("Accept-Encoding") == "" {
 		req.Header.Set("Accept-Encoding", "zstd, gzip")
 	}
+	if req.Header.Get("User-Agent") == "" {
+		req.Header.Set("User-Agent", protocol.UserAgent())
+	}
+	req.Header.Set(protocol.VersionHeader, protocol.Version)
 	base := t.base
 	if base == nil {
 		base = http.DefaultTransport
 	}
 	return base.RoundTrip(req)
 }
+
+// basicAuthTransport adds HTTP Basic credentials to every request that
+// doesn't already carry an Authorization header
+type basicAuthTransport struct {
+	base           http.RoundTripper
+	user, password string
+}
+
+func (t *basicAuthTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("Authorization") == "" {
+		req = req.Clone(req.Context())
+		req.SetBasicAuth(t.user, t.password)
+	}
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return base.RoundTrip(req)
+}
+
+// withBasicAuth returns a copy of c that sends the given Basic credentials
+func withBasicAuth(c *http.Client, user, password string) *http.Client {
+	authed := *c
+	authed.Transport = &basicAuthTransport{base: c.Transport, user: user, password: password}
+	return &authed
+}
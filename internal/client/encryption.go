@@ -0,0 +1,83 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/zulfikawr/warp/internal/protocol"
+)
+
+// ErrNotEncrypted means the receiver holds a key but the server sent the share
+// in the clear, e.g. because it restarted without PAKE or something on the
+// way stripped the encryption
+var ErrNotEncrypted = errors.New("server did not offer an encrypted stream")
+
+// ErrNoKey means the server sent an encrypted stream to a receiver without a
+// key to decrypt it
+var ErrNoKey = errors.New("server sent an encrypted stream, but no key was given")
+
+// encryptionMismatch compares the encryption header of a download with
+// whether the receiver holds a key. Either mismatch makes the body worthless:
+// "decrypting" plaintext yields garbage, and ciphertext can't be read.
+func encryptionMismatch(h http.Header, key []byte) error {
+	encrypted := h.Get(protocol.EncryptionHeader) == "true"
+	switch {
+	case key != nil && !encrypted:
+		return ErrNotEncrypted
+	case key == nil && encrypted:
+		return ErrNoKey
+	}
+	return nil
+}
+
+// encryptionError adds the transfer ID and what to do next to a mismatch
+func encryptionError(err error, transferID string) error {
+	if errors.Is(err, ErrNoKey) {
+		return fmt.Errorf("%w%s\n\nTip: Receive with --code and the sender's PAKE code instead of the URL", err, transferSuffix(transferID))
+	}
+	return fmt.Errorf("%w%s\n\nTip: Nothing was saved. The sender may have restarted without a PAKE code; ask them to share again", err, transferSuffix(transferID))
+}
+
+// checkEncryption fails unless the server encrypts the download exactly when
+// the receiver holds a key. With a key, the share's encrypt-info endpoint must
+// agree with the header as well.
+func (d *Downloader) checkEncryption(resp *http.Response, key []byte) error {
+	transferID := resp.Header.Get(protocol.TransferIDHeader)
+	if err := encryptionMismatch(resp.Header, key); err != nil {
+		return encryptionError(err, transferID)
+	}
+	if key == nil {
+		return nil
+	}
+	encrypted, err := d.encryptInfo(resp.Request.URL)
+	if err != nil {
+		return fmt.Errorf("failed to confirm the share is encrypted: %w", err)
+	}
+	if !encrypted {
+		return encryptionError(ErrNotEncrypted, transferID)
+	}
+	return nil
+}
+
+// encryptInfo asks the server of shareURL whether it encrypts its share
+func (d *Downloader) encryptInfo(shareURL *url.URL) (bool, error) {
+	resp, err := d.client.Get(shareURL.Scheme + "://" + shareURL.Host + protocol.EncryptInfoPath)
+	if err != nil {
+		return false, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	var info struct {
+		Encrypted bool `json:"encrypted"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 64*1024)).Decode(&info); err != nil {
+		return false, fmt.Errorf("invalid encrypt-info response: %w", err)
+	}
+	return info.Encrypted, nil
+}
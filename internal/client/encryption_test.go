@@ -0,0 +1,100 @@
+package client
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/zulfikawr/warp/internal/crypto"
+	"github.com/zulfikawr/warp/internal/protocol"
+)
+
+// encryptedShare serves plain as a file share, encrypted with key unless key
+// is nil, and answers encrypt-info with infoEncrypted
+func encryptedShare(t *testing.T, plain []byte, key []byte, infoEncrypted bool) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == protocol.EncryptInfoPath {
+			_, _ = fmt.Fprintf(w, `{"encrypted":%v}`, infoEncrypted)
+			return
+		}
+		w.Header().Set("Content-Disposition", `attachment; filename="secret.bin"`)
+		var body io.Reader = bytes.NewReader(plain)
+		if key != nil {
+			er, err := crypto.NewEncryptReader(body, key)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			body = er
+			w.Header().Set(protocol.EncryptionHeader, "true")
+		}
+		_, _ = io.Copy(w, body)
+	}))
+}
+
+func TestReceiveEncryptionExpectation(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, 32)
+	plain := []byte("the launch codes")
+	tests := []struct {
+		name      string
+		encrypted bool // server encrypts the download
+		hasKey    bool // receiver agreed a key
+		wantErr   error
+	}{
+		{"encrypted with key", true, true, nil},
+		{"plain without key", false, false, nil},
+		{"plain with key", false, true, ErrNotEncrypted},
+		{"encrypted without key", true, false, ErrNoKey},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var serverKey, clientKey []byte
+			if tt.encrypted {
+				serverKey = key
+			}
+			if tt.hasKey {
+				clientKey = key
+			}
+			ts := encryptedShare(t, plain, serverKey, tt.encrypted)
+			defer ts.Close()
+
+			out := filepath.Join(t.TempDir(), "secret.bin")
+			_, err := NewDownloader(nil).Receive(ts.URL+"/d/token", out, true, io.Discard, clientKey)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Receive error = %v, want %v", err, tt.wantErr)
+			}
+			got, readErr := os.ReadFile(out)
+			if tt.wantErr != nil {
+				if readErr == nil {
+					t.Fatalf("wrote %d bytes despite the mismatch", len(got))
+				}
+				return
+			}
+			if !bytes.Equal(got, plain) {
+				t.Fatalf("content = %q, want %q", got, plain)
+			}
+		})
+	}
+}
+
+func TestReceiveEncryptInfoMustAgree(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, 32)
+	// The header says encrypted but the server itself says otherwise
+	ts := encryptedShare(t, []byte("data"), key, false)
+	defer ts.Close()
+
+	out := filepath.Join(t.TempDir(), "secret.bin")
+	if _, err := NewDownloader(nil).Receive(ts.URL+"/d/token", out, true, io.Discard, key); !errors.Is(err, ErrNotEncrypted) {
+		t.Fatalf("Receive error = %v, want %v", err, ErrNotEncrypted)
+	}
+	if _, err := os.Stat(out); err == nil {
+		t.Fatal("file written despite encrypt-info disagreeing")
+	}
+}
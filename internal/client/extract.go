@@ -0,0 +1,349 @@
+package client
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/zulfikawr/warp/internal/platform"
+	"github.com/zulfikawr/warp/internal/protocol"
+	"github.com/zulfikawr/warp/internal/ui"
+)
+
+// ErrNotArchive is returned by Extract for files that are neither zip nor tar.gz
+var ErrNotArchive = errors.New("not a zip or tar.gz archive")
+
+// Archive formats recognised by their leading magic bytes
+const (
+	archiveZip   = "zip"
+	archiveTarGz = "tar.gz"
+)
+
+// archiveEntry is one file or directory inside an archive
+type archiveEntry struct {
+	name    string // Slash-separated path from the archive
+	target  string // Validated destination on disk
+	mode    os.FileMode
+	modTime time.Time
+	size    int64
+	open    func() (io.ReadCloser, error) // zip only; tar entries are streamed
+}
+
+// ExtractResult describes a finished extraction
+type ExtractResult struct {
+	Dir   string
+	Files int
+	Bytes int64
+}
+
+// Extract unpacks the zip or tar.gz archive into dest, or into a directory
+// named after the archive when dest is empty. Every entry is checked before
+// anything is written: absolute paths and ".." components are rejected and
+// the total size must fit in the free disk space. Existing files are only
+// overwritten with force. Modes and modification times are taken from the
+// archive; symlinks and other special entries are skipped.
+func (d *Downloader) Extract(archive, dest string, force bool, progress io.Writer) (*ExtractResult, error) {
+	kind, err := sniffArchive(archive)
+	if err != nil {
+		return nil, err
+	}
+	if dest == "" {
+		dest = archiveDir(archive)
+	}
+
+	var entries []archiveEntry
+	var closeArchive func() error
+	switch kind {
+	case archiveZip:
+		entries, closeArchive, err = zipEntries(archive)
+	case archiveTarGz:
+		entries, err = tarEntries(archive)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archive %s: %w", archive, err)
+	}
+	if closeArchive != nil {
+		defer func() { _ = closeArchive() }()
+	}
+
+	res := &ExtractResult{Dir: dest}
+	for i := range entries {
+		if entries[i].target, err = extractTarget(dest, entries[i].name); err != nil {
+			return nil, err
+		}
+		if entries[i].mode.IsRegular() {
+			res.Bytes += entries[i].size
+		}
+	}
+	// Where the free space is unknown, write errors stop the extraction instead
+	if free, err := platform.Current.DiskFree(existingAncestor(dest)); err == nil && res.Bytes > free {
+		return nil, fmt.Errorf("archive expands to %s but only %s is free in %s", ui.FormatBytes(res.Bytes), ui.FormatBytes(free), dest)
+	}
+	if err := os.MkdirAll(dest, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", dest, err)
+	}
+
+	x := &extractor{force: force, total: res.Bytes, name: "Extracting " + filepath.Base(archive)}
+	if x.renderer = d.renderer(progress); x.renderer != nil {
+		x.start = time.Now()
+		x.renderer.Start(ui.TransferState{Name: x.name, Total: x.total})
+	}
+
+	if kind == archiveZip {
+		err = x.extractZip(entries)
+	} else {
+		err = x.extractTarGz(archive, entries)
+	}
+	if err != nil {
+		if x.renderer != nil {
+			x.renderer.Finish(ui.Summary{})
+		}
+		return nil, err
+	}
+
+	// Directory times last, deepest first, since writing files inside bumps them
+	for i := len(entries) - 1; i >= 0; i-- {
+		if e := entries[i]; e.mode.IsDir() {
+			_ = protocol.FileAttrs{ModTime: e.modTime, Mode: e.mode.Perm()}.Apply(e.target)
+		}
+	}
+
+	res.Files = x.files
+	if x.renderer != nil {
+		x.renderer.Finish(ui.Summary{Title: "Extraction Complete", Fields: []ui.Field{
+			{Label: "Archive", Value: archive},
+			{Label: "Files", Value: fmt.Sprintf("%d", res.Files)},
+			{Label: "Size", Value: ui.FormatBytes(res.Bytes)},
+			{Label: "Time", Value: fmt.Sprintf("%.1fs", time.Since(x.start).Seconds())},
+			{Label: "Extracted to", Value: dest},
+		}})
+	}
+	return res, nil
+}
+
+// extractor writes validated entries and reports progress across all of them
+type extractor struct {
+	force    bool
+	renderer ui.Renderer
+	name     string
+	start    time.Time
+	total    int64
+	done     int64
+	files    int
+}
+
+func (x *extractor) extractZip(entries []archiveEntry) error {
+	for _, e := range entries {
+		if e.mode.IsDir() {
+			if err := os.MkdirAll(e.target, 0o755); err != nil {
+				return fmt.Errorf("failed to create %s: %w", e.target, err)
+			}
+			continue
+		}
+		if !e.mode.IsRegular() {
+			continue
+		}
+		rc, err := e.open()
+		if err != nil {
+			return fmt.Errorf("failed to read %s from archive: %w", e.name, err)
+		}
+		err = x.writeFile(e, rc)
+		_ = rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (x *extractor) extractTarGz(archive string, entries []archiveEntry) error {
+	f, err := os.Open(archive)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	tr := tar.NewReader(gz)
+	for _, e := range entries {
+		// entries were listed from this same archive, so headers line up
+		if _, err := tr.Next(); err != nil {
+			return fmt.Errorf("failed to read %s from archive: %w", e.name, err)
+		}
+		switch {
+		case e.mode.IsDir():
+			if err := os.MkdirAll(e.target, 0o755); err != nil {
+				return fmt.Errorf("failed to create %s: %w", e.target, err)
+			}
+		case e.mode.IsRegular():
+			if err := x.writeFile(e, tr); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// writeFile copies one regular entry to its target and applies its attributes
+func (x *extractor) writeFile(e archiveEntry, r io.Reader) error {
+	if err := os.MkdirAll(filepath.Dir(e.target), 0o755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", filepath.Dir(e.target), err)
+	}
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if !x.force {
+		flags |= os.O_EXCL
+	}
+	out, err := os.OpenFile(e.target, flags, 0o600)
+	if errors.Is(err, os.ErrExist) {
+		return fmt.Errorf("%s already exists\n\nUse --force or -f to overwrite", e.target)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", e.target, err)
+	}
+
+	if x.renderer != nil {
+		r = &ui.ProgressReader{R: r, Total: x.total, Current: x.done, Renderer: x.renderer, Name: x.name, StartTime: x.start}
+	}
+	n, err := io.CopyBuffer(out, r, make([]byte, protocol.GetOptimalBufferSize(e.size)))
+	cerr := out.Close()
+	x.done += n
+	if err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to extract %s: %w", e.name, err)
+	}
+
+	x.files++
+	mode := e.mode.Perm()
+	if mode == 0 {
+		mode = 0o644
+	}
+	if err := (protocol.FileAttrs{ModTime: e.modTime, Mode: mode}).Apply(e.target); err != nil {
+		return fmt.Errorf("%s: %w", e.target, err)
+	}
+	return nil
+}
+
+// sniffArchive identifies archive by its magic bytes
+func sniffArchive(archive string) (string, error) {
+	f, err := os.Open(archive)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = f.Close() }()
+	magic := make([]byte, 4)
+	n, _ := io.ReadFull(f, magic)
+	magic = magic[:n]
+	switch {
+	case bytes.HasPrefix(magic, []byte("PK\x03\x04")), bytes.HasPrefix(magic, []byte("PK\x05\x06")):
+		return archiveZip, nil
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		return archiveTarGz, nil
+	}
+	return "", fmt.Errorf("%s: %w", archive, ErrNotArchive)
+}
+
+// zipEntries lists the entries of a zip archive; the returned func closes it
+func zipEntries(archive string) ([]archiveEntry, func() error, error) {
+	zr, err := zip.OpenReader(archive)
+	if err != nil {
+		return nil, nil, err
+	}
+	entries := make([]archiveEntry, 0, len(zr.File))
+	for _, f := range zr.File {
+		entries = append(entries, archiveEntry{
+			name:    f.Name,
+			mode:    f.Mode(),
+			modTime: f.Modified,
+			size:    int64(f.UncompressedSize64),
+			open:    f.Open,
+		})
+	}
+	return entries, zr.Close, nil
+}
+
+// tarEntries lists the entries of a gzip-compressed tar archive
+func tarEntries(archive string) ([]archiveEntry, error) {
+	f, err := os.Open(archive)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	tr := tar.NewReader(gz)
+	var entries []archiveEntry
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		fi := hdr.FileInfo()
+		entries = append(entries, archiveEntry{
+			name:    hdr.Name,
+			mode:    fi.Mode(),
+			modTime: hdr.ModTime,
+			size:    hdr.Size,
+		})
+	}
+}
+
+// extractTarget joins an archive entry name onto dest, rejecting names that
+// are absolute or climb out with ".."
+func extractTarget(dest, name string) (string, error) {
+	clean := strings.ReplaceAll(name, `\`, "/")
+	if clean == "" || path.IsAbs(clean) || filepath.IsAbs(clean) || filepath.VolumeName(clean) != "" {
+		return "", fmt.Errorf("unsafe path %q: absolute paths are not allowed", name)
+	}
+	if slices.Contains(strings.Split(clean, "/"), "..") {
+		return "", fmt.Errorf("unsafe path %q: \"..\" is not allowed", name)
+	}
+	return filepath.Join(dest, filepath.FromSlash(clean)), nil
+}
+
+// archiveDir is the default extraction directory: the archive path without
+// its extension
+func archiveDir(archive string) string {
+	for _, ext := range []string{".tar.gz", ".tgz", ".zip"} {
+		if base, ok := strings.CutSuffix(archive, ext); ok && base != "" {
+			return base
+		}
+	}
+	if ext := filepath.Ext(archive); ext != "" {
+		return strings.TrimSuffix(archive, ext)
+	}
+	return archive + "-extracted"
+}
+
+// existingAncestor returns p or its closest parent that exists, for free
+// space checks before the destination is created
+func existingAncestor(p string) string {
+	for {
+		if _, err := os.Stat(p); err == nil {
+			return p
+		}
+		parent := filepath.Dir(p)
+		if parent == p {
+			return p
+		}
+		p = parent
+	}
+}
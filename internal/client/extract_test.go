@@ -0,0 +1,175 @@
+package client
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zulfikawr/warp/internal/ui"
+)
+
+type testEntry struct {
+	name string
+	body string
+	mode os.FileMode
+}
+
+var archiveTime = time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func writeZip(t *testing.T, path string, entries []testEntry) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(f)
+	for _, e := range entries {
+		fh := &zip.FileHeader{Name: e.name, Method: zip.Deflate, Modified: archiveTime}
+		fh.SetMode(e.mode)
+		w, err := zw.CreateHeader(fh)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = w.Write([]byte(e.body))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	_ = f.Close()
+}
+
+func writeTarGz(t *testing.T, path string, entries []testEntry) {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, e := range entries {
+		hdr := &tar.Header{Name: e.name, Mode: int64(e.mode.Perm()), Size: int64(len(e.body)), ModTime: archiveTime, Typeflag: tar.TypeReg}
+		if e.mode.IsDir() {
+			hdr.Typeflag = tar.TypeDir
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		_, _ = tw.Write([]byte(e.body))
+	}
+	_ = tw.Close()
+	_ = gz.Close()
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExtractArchives(t *testing.T) {
+	entries := []testEntry{
+		{"docs/", "", os.ModeDir | 0o755},
+		{"docs/readme.txt", "hello", 0o644},
+		{"bin/run.sh", "#!/bin/sh\n", 0o755},
+	}
+	for _, tt := range []struct {
+		name  string
+		file  string
+		write func(*testing.T, string, []testEntry)
+	}{
+		{"zip", "project.zip", writeZip},
+		{"tar.gz", "project.tar.gz", writeTarGz},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			archive := filepath.Join(dir, tt.file)
+			tt.write(t, archive, entries)
+
+			out := &bytes.Buffer{}
+			d := NewDownloader(nil)
+			d.Renderer = ui.NewJSONRenderer(out)
+			res, err := d.Extract(archive, "", false, nil)
+			if err != nil {
+				t.Fatalf("Extract: %v", err)
+			}
+			if want := filepath.Join(dir, "project"); res.Dir != want || res.Files != 2 {
+				t.Errorf("result = %+v, want 2 files in %s", res, want)
+			}
+
+			got, err := os.ReadFile(filepath.Join(res.Dir, "docs", "readme.txt"))
+			if err != nil || string(got) != "hello" {
+				t.Fatalf("readme.txt = %q, %v", got, err)
+			}
+			fi, err := os.Stat(filepath.Join(res.Dir, "bin", "run.sh"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fi.Mode().Perm() != 0o755 {
+				t.Errorf("run.sh mode = %v, want 0755", fi.Mode().Perm())
+			}
+			if !fi.ModTime().Equal(archiveTime) {
+				t.Errorf("run.sh mtime = %v, want %v", fi.ModTime(), archiveTime)
+			}
+			if !strings.Contains(out.String(), `"title":"Extraction Complete"`) {
+				t.Errorf("no finish event from the renderer:\n%s", out.String())
+			}
+		})
+	}
+}
+
+func TestExtractRejectsUnsafePaths(t *testing.T) {
+	for _, name := range []string{"../evil", "docs/../../evil", "/etc/evil", `..\evil`} {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			archive := filepath.Join(dir, "bad.zip")
+			writeZip(t, archive, []testEntry{{"ok.txt", "fine", 0o644}, {name, "pwned", 0o644}})
+
+			dest := filepath.Join(dir, "out")
+			_, err := NewDownloader(nil).Extract(archive, dest, false, nil)
+			if err == nil || !strings.Contains(err.Error(), "unsafe path") {
+				t.Fatalf("err = %v, want unsafe path rejection", err)
+			}
+			if _, err := os.Stat(filepath.Join(dir, "evil")); err == nil {
+				t.Error("entry escaped the destination")
+			}
+			if _, err := os.Stat(dest); err == nil {
+				t.Error("nothing should be written when any entry is unsafe")
+			}
+		})
+	}
+}
+
+func TestExtractExistingFiles(t *testing.T) {
+	dir := t.TempDir()
+	archive := filepath.Join(dir, "a.zip")
+	writeZip(t, archive, []testEntry{{"note.txt", "new", 0o644}})
+	dest := filepath.Join(dir, "out")
+	if err := os.MkdirAll(dest, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dest, "note.txt"), []byte("old"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	d := NewDownloader(nil)
+	if _, err := d.Extract(archive, dest, false, nil); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Fatalf("err = %v, want refusal to overwrite", err)
+	}
+	if _, err := d.Extract(archive, dest, true, nil); err != nil {
+		t.Fatalf("Extract with force: %v", err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(dest, "note.txt")); string(got) != "new" {
+		t.Errorf("note.txt = %q, want overwritten", got)
+	}
+}
+
+func TestExtractNotArchive(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "plain.txt")
+	if err := os.WriteFile(path, []byte("just text"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewDownloader(nil).Extract(path, "", false, nil); !errors.Is(err, ErrNotArchive) {
+		t.Fatalf("err = %v, want ErrNotArchive", err)
+	}
+}
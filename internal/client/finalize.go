@@ -0,0 +1,139 @@
+package client
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/zulfikawr/warp/internal/protocol"
+)
+
+// verifyPollInterval is how often the uploader polls an async verification job
+const verifyPollInterval = 500 * time.Millisecond
+
+// verifyResult mirrors the host's verification job state
+type verifyResult struct {
+	ID          string `json:"job_id"`
+	Status      string `json:"status"` // pending, pass or fail
+	Quarantined string `json:"quarantined"`
+	Error       string `json:"error"`
+}
+
+// hashFile computes the SHA256 of the session's file without disturbing chunk reads
+func (s *UploadSession) hashFile() (string, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, io.NewSectionReader(s.File, 0, s.TotalSize)); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// finalize asks the host to verify the assembled file against checksum. A 202
+// answer means the host verifies in the background; poll until it decides.
+func (s *UploadSession) finalize(ctx context.Context, checksum string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(s.URL, "/")+protocol.FinalizePathSuffix, nil)
+	if err != nil {
+		return fmt.Errorf("create finalize request: %w", err)
+	}
+	req.Header.Set("X-Upload-Session", s.SessionID)
+	req.Header.Set(protocol.ContentSHA256Header, checksum)
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("finalize: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	var result verifyResult
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusUnprocessableEntity:
+		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+			return fmt.Errorf("finalize: invalid response: %w", err)
+		}
+	case http.StatusAccepted:
+		if s.renderer != nil {
+			state := s.progressState()
+			state.Detail = "Verifying checksum on host..."
+			s.renderer.Update(state)
+		}
+		statusURL, err := resolveReference(s.URL, resp.Header.Get("Location"))
+		if err != nil {
+			return fmt.Errorf("finalize: %w", err)
+		}
+		if result, err = s.pollVerification(ctx, statusURL); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("finalize: %w", statusError(resp))
+	}
+
+	if result.Status != "pass" {
+		msg := ""
+		if result.Error != "" {
+			msg += ": " + result.Error
+		}
+		if result.Quarantined != "" {
+			msg += fmt.Sprintf(" (file quarantined as %s)", result.Quarantined)
+		}
+		return fmt.Errorf("%w on host%s", ErrChecksumMismatch, msg)
+	}
+	return nil
+}
+
+// pollVerification polls statusURL until the job leaves the pending state
+func (s *UploadSession) pollVerification(ctx context.Context, statusURL string) (verifyResult, error) {
+	ticker := time.NewTicker(verifyPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return verifyResult{}, ctx.Err()
+		case <-ticker.C:
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, statusURL, nil)
+		if err != nil {
+			return verifyResult{}, fmt.Errorf("create verify request: %w", err)
+		}
+		resp, err := s.Client.Do(req)
+		if err != nil {
+			return verifyResult{}, fmt.Errorf("poll verification: %w", err)
+		}
+		var result verifyResult
+		status := resp.StatusCode
+		decodeErr := json.NewDecoder(resp.Body).Decode(&result)
+		_ = resp.Body.Close()
+		if status != http.StatusOK {
+			return verifyResult{}, fmt.Errorf("poll verification: server returned %d", status)
+		}
+		if decodeErr != nil {
+			return verifyResult{}, fmt.Errorf("poll verification: invalid response: %w", decodeErr)
+		}
+		if result.Status != "pending" {
+			return result, nil
+		}
+	}
+}
+
+// resolveReference resolves ref (e.g. a Location header) against base
+func resolveReference(base, ref string) (string, error) {
+	if ref == "" {
+		return "", fmt.Errorf("missing Location header")
+	}
+	b, err := url.Parse(base)
+	if err != nil {
+		return "", err
+	}
+	r, err := url.Parse(ref)
+	if err != nil {
+		return "", err
+	}
+	return b.ResolveReference(r).String(), nil
+}
@@ -0,0 +1,61 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/zulfikawr/warp/internal/crypto"
+	"github.com/zulfikawr/warp/internal/protocol"
+)
+
+// ErrFollowed means the share is a file the sender is still writing, which
+// only Follow can receive
+var ErrFollowed = errors.New("the sender is streaming a file that is still growing")
+
+// Follow streams a share served with send --follow to out, like tail -f,
+// until the sender stops or ctx is done, and returns the bytes written. A
+// share that isn't followed is written out whole.
+func (d *Downloader) Follow(ctx context.Context, url string, out io.Writer, key []byte) (int64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create request: %w", err)
+	}
+	// The stream has no end, so the client's overall timeout can't apply
+	c := *d.client
+	c.Timeout = 0
+	resp, err := c.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("connection failed: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	transferID := resp.Header.Get(protocol.TransferIDHeader)
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("server returned error: HTTP %d%s", resp.StatusCode, transferSuffix(transferID))
+	}
+	if err := d.checkEncryption(resp, key); err != nil {
+		return 0, err
+	}
+
+	body, err := decodeBody(resp)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = body.Close() }()
+	var src io.Reader = body
+	if key != nil {
+		dr, err := crypto.NewDecryptReader(body, key)
+		if err != nil {
+			return 0, fmt.Errorf("failed to create decrypt reader: %w", err)
+		}
+		src = dr
+	}
+
+	n, err := io.Copy(out, src)
+	if err != nil && ctx.Err() == nil {
+		return n, fmt.Errorf("stream interrupted%s: %w", transferSuffix(transferID), err)
+	}
+	return n, nil
+}
@@ -0,0 +1,61 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/zulfikawr/warp/internal/protocol"
+)
+
+// fakeFollowSender sends one line, then holds the stream open like a sender
+// waiting for its file to grow
+func fakeFollowSender(t *testing.T) string {
+	t.Helper()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(protocol.FollowHeader, "1")
+		w.Header().Set("Content-Disposition", `attachment; filename="app.log"`)
+		_, _ = io.WriteString(w, "line one\n")
+		_ = http.NewResponseController(w).Flush()
+		<-r.Context().Done()
+	}))
+	t.Cleanup(ts.Close)
+	return ts.URL + "/d/tok"
+}
+
+func TestFollowStopsOnCancel(t *testing.T) {
+	url := fakeFollowSender(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	var out bytes.Buffer
+	n, err := NewDownloader(nil).Follow(ctx, url, &out, nil)
+	if err != nil {
+		t.Fatalf("Follow returned %v after being stopped", err)
+	}
+	if out.String() != "line one\n" || n != int64(out.Len()) {
+		t.Errorf("Follow wrote %q (n=%d)", out.String(), n)
+	}
+}
+
+func TestReceiveRejectsFollowedShare(t *testing.T) {
+	url := fakeFollowSender(t)
+	done := make(chan error, 1)
+	go func() {
+		_, err := NewDownloader(nil).Receive(url, filepath.Join(t.TempDir(), "app.log"), false, io.Discard, nil)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if !errors.Is(err, ErrFollowed) {
+			t.Errorf("Receive = %v, want ErrFollowed", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Receive waited on a stream that never ends")
+	}
+}
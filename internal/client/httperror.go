@@ -0,0 +1,170 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/zulfikawr/warp/internal/errors"
+)
+
+var (
+	// ErrServerBusy means the server is at its transfer limit (503)
+	ErrServerBusy = stderrors.New("server busy")
+
+	// ErrInsufficientStorage means the host has no disk space left for the
+	// upload (507)
+	ErrInsufficientStorage = stderrors.New("insufficient storage on the host")
+
+	// ErrForbidden means the server refuses this client outright (403), e.g.
+	// because of --allow-ip/--deny-ip
+	ErrForbidden = stderrors.New("forbidden")
+)
+
+// ErrRateLimited is a 429: the client went over a rate limit or its transfer
+// quota
+type ErrRateLimited struct {
+	RetryAfter time.Duration // When to try again; 0 if the server didn't say
+	Message    string        // The server's explanation, if any
+}
+
+func (e *ErrRateLimited) Error() string {
+	msg := "rate limited (HTTP 429)"
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	if e.RetryAfter > 0 {
+		msg += fmt.Sprintf(", retry in %s", e.RetryAfter)
+	}
+	return msg
+}
+
+// StatusError is a response with an unexpected status. It unwraps to
+// ErrServerBusy, ErrInsufficientStorage, ErrForbidden or ErrChecksumMismatch
+// when the status means one of them.
+type StatusError struct {
+	StatusCode int
+	Message    string        // The server's explanation, if any
+	RetryAfter time.Duration // From Retry-After; 0 when absent
+	kind       error
+}
+
+func (e *StatusError) Error() string {
+	msg := fmt.Sprintf("HTTP %d", e.StatusCode)
+	if e.kind != nil {
+		msg = fmt.Sprintf("%s (HTTP %d)", e.kind, e.StatusCode)
+	}
+	if e.Message != "" && (e.kind == nil || e.Message != e.kind.Error()) {
+		msg += ": " + e.Message
+	}
+	return msg
+}
+
+func (e *StatusError) Unwrap() error {
+	return e.kind
+}
+
+// statusError turns a failed response into a typed error. It reads the
+// Retry-After header and up to 1 KB of the body, whose "error" field is the
+// message when the body is JSON. The caller still closes the body.
+func statusError(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	message := strings.TrimSpace(string(body))
+	var structured struct {
+		Status string `json:"status"`
+		Error  string `json:"error"`
+	}
+	isJSON := json.Unmarshal(body, &structured) == nil
+	if isJSON {
+		message = structured.Error
+	}
+	wait := time.Duration(0)
+	if v := resp.Header.Get("Retry-After"); v != "" {
+		wait = parseRetryAfter(v)
+	}
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return &ErrRateLimited{RetryAfter: wait, Message: message}
+	}
+	err := &StatusError{StatusCode: resp.StatusCode, Message: message, RetryAfter: wait}
+	switch resp.StatusCode {
+	case http.StatusServiceUnavailable:
+		err.kind = ErrServerBusy
+	case http.StatusInsufficientStorage:
+		err.kind = ErrInsufficientStorage
+	case http.StatusForbidden:
+		err.kind = ErrForbidden
+	case http.StatusUnprocessableEntity:
+		// Failed verifications say so; scan rejections don't
+		if isJSON && structured.Status == "fail" {
+			err.kind = ErrChecksumMismatch
+		}
+	}
+	return err
+}
+
+// retryAfter returns how long err asks the client to wait before trying again
+func retryAfter(err error) (time.Duration, bool) {
+	var limited *ErrRateLimited
+	if stderrors.As(err, &limited) && limited.RetryAfter > 0 {
+		return limited.RetryAfter, true
+	}
+	var status *StatusError
+	if stderrors.As(err, &status) && status.RetryAfter > 0 {
+		return status.RetryAfter, true
+	}
+	return 0, false
+}
+
+// permanent reports whether sending the same request again can't succeed
+func permanent(err error) bool {
+	return stderrors.Is(err, ErrForbidden) || stderrors.Is(err, ErrInsufficientStorage)
+}
+
+// waitRetryAfter waits as long as err asks, if it asks and the wait fits in
+// what is left of maxBusyWait after *waited, and reports whether it did. Such
+// waits aren't failed attempts, so they don't use up RetryAttempts.
+func waitRetryAfter(ctx context.Context, err error, waited *time.Duration) (bool, error) {
+	wait, ok := retryAfter(err)
+	if !ok || *waited+wait > maxBusyWait {
+		return false, nil
+	}
+	*waited += wait
+	select {
+	case <-ctx.Done():
+		return false, ctx.Err()
+	case <-time.After(wait):
+		return true, nil
+	}
+}
+
+// receiveError explains a refused download along with what to do about it
+func receiveError(err error, transferID string) error {
+	suffix := transferSuffix(transferID)
+	var limited *ErrRateLimited
+	switch {
+	case stderrors.As(err, &limited):
+		hint := "Wait a while and try again"
+		if limited.RetryAfter > 0 {
+			hint = fmt.Sprintf("Try again in %s", limited.RetryAfter)
+		}
+		return errors.NewUserError("Too many requests: the server is limiting this client"+suffix,
+			[]string{hint, "The sender may have set a per-client transfer quota (--quota-per-ip)"}, err)
+	case stderrors.Is(err, ErrServerBusy):
+		return errors.NewUserError("Server busy"+suffix,
+			[]string{"Too many transfers are in progress, try again later"}, err)
+	case stderrors.Is(err, ErrForbidden):
+		return errors.NewUserError("Access denied"+suffix,
+			[]string{"The sender may only let some addresses in (--allow-ip/--deny-ip)",
+				"Check that the URL and its token were copied completely"}, err)
+	case stderrors.Is(err, ErrInsufficientStorage):
+		return errors.NewUserError("The server is out of disk space"+suffix,
+			[]string{"Ask the sender to free some space and share again"}, err)
+	}
+	return fmt.Errorf("server returned error: %w%s\n\nTip: Check if the server is still running", err, suffix)
+}
@@ -0,0 +1,196 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestStatusError(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      int
+		retryAfter  string
+		contentType string
+		body        string
+		wantKind    error // nil: no sentinel
+		wantLimited bool
+		wantWait    time.Duration
+		wantMessage string
+		permanent   bool
+	}{
+		{"rate limited", 429, "30", "text/plain", "too many requests\n", nil, true, 30 * time.Second, "too many requests", false},
+		{"quota exceeded", 429, "3600", "application/json", `{"error":"transfer quota exceeded: 1.0 KiB of 1000 B used","quota":1000,"used":1024}`, nil, true, time.Hour, "transfer quota exceeded: 1.0 KiB of 1000 B used", false},
+		{"rate limited without Retry-After", 429, "", "text/plain", "Too many attempts", nil, true, 0, "Too many attempts", false},
+		{"busy", 503, "5", "text/plain", "server busy\n", ErrServerBusy, false, 5 * time.Second, "server busy", false},
+		{"disk full", 507, "", "text/plain", "insufficient disk space\n", ErrInsufficientStorage, false, 0, "insufficient disk space", true},
+		{"forbidden", 403, "", "text/plain", "forbidden\n", ErrForbidden, false, 0, "forbidden", true},
+		{"verification failed", 422, "", "application/json", `{"status":"fail","error":"sha256 mismatch"}`, ErrChecksumMismatch, false, 0, "sha256 mismatch", false},
+		{"scan rejected", 422, "", "application/json", `{"success":false,"filename":"a.exe","error":"rejected by scan"}`, nil, false, 0, "rejected by scan", false},
+		{"internal error", 500, "", "text/plain", "write error\n", nil, false, 0, "write error", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{StatusCode: tt.status, Header: http.Header{}, Body: io.NopCloser(strings.NewReader(tt.body))}
+			resp.Header.Set("Content-Type", tt.contentType)
+			if tt.retryAfter != "" {
+				resp.Header.Set("Retry-After", tt.retryAfter)
+			}
+			err := statusError(resp)
+
+			var limited *ErrRateLimited
+			if got := errors.As(err, &limited); got != tt.wantLimited {
+				t.Fatalf("%v: rate limited = %v, want %v", err, got, tt.wantLimited)
+			}
+			if tt.wantLimited && limited.Message != tt.wantMessage {
+				t.Errorf("message = %q, want %q", limited.Message, tt.wantMessage)
+			}
+			var status *StatusError
+			if errors.As(err, &status) {
+				if status.StatusCode != tt.status || status.Message != tt.wantMessage {
+					t.Errorf("status error = %d %q, want %d %q", status.StatusCode, status.Message, tt.status, tt.wantMessage)
+				}
+				if status.Unwrap() != tt.wantKind {
+					t.Errorf("%v unwraps to %v, want %v", err, status.Unwrap(), tt.wantKind)
+				}
+			}
+			wait, ok := retryAfter(err)
+			if wait != tt.wantWait || ok != (tt.wantWait > 0) {
+				t.Errorf("retryAfter = %s, %v, want %s", wait, ok, tt.wantWait)
+			}
+			if permanent(err) != tt.permanent {
+				t.Errorf("permanent = %v, want %v", !tt.permanent, tt.permanent)
+			}
+		})
+	}
+}
+
+// chunkServer answers the first failures chunk requests with fail and
+// accepts the rest, counting them all
+func chunkServer(t *testing.T, failures int64, fail func(w http.ResponseWriter)) (*httptest.Server, *atomic.Int64) {
+	t.Helper()
+	var requests atomic.Int64
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Chunk-Id") == "" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = io.Copy(io.Discard, r.Body)
+		if requests.Add(1) <= failures {
+			fail(w)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"success":true}`))
+	}))
+	t.Cleanup(ts.Close)
+	return ts, &requests
+}
+
+func TestUploadRetryBehavior(t *testing.T) {
+	testFile := filepath.Join(t.TempDir(), "retry.bin")
+	if err := os.WriteFile(testFile, []byte("chunk data"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	config := func() *UploadConfig {
+		return &UploadConfig{ChunkSize: 1024, MaxConcurrent: 1, RetryAttempts: 1, RetryDelay: time.Millisecond}
+	}
+	tests := []struct {
+		name         string
+		failures     int64
+		fail         func(w http.ResponseWriter)
+		wantErr      error // nil: the upload succeeds
+		wantRequests int64
+	}{
+		{
+			// Two waits on Retry-After with a single attempt to spare
+			name: "rate limited waits without using attempts", failures: 2,
+			fail: func(w http.ResponseWriter) {
+				w.Header().Set("Retry-After", "1")
+				http.Error(w, "too many requests", http.StatusTooManyRequests)
+			},
+			wantRequests: 3,
+		},
+		{
+			name: "busy waits without using attempts", failures: 2,
+			fail: func(w http.ResponseWriter) {
+				w.Header().Set("Retry-After", "1")
+				http.Error(w, "server busy", http.StatusServiceUnavailable)
+			},
+			wantRequests: 3,
+		},
+		{
+			name: "disk full is not retried", failures: 10,
+			fail: func(w http.ResponseWriter) {
+				http.Error(w, "insufficient disk space", http.StatusInsufficientStorage)
+			},
+			wantErr: ErrInsufficientStorage, wantRequests: 1,
+		},
+		{
+			name: "forbidden is not retried", failures: 10,
+			fail: func(w http.ResponseWriter) {
+				http.Error(w, "forbidden", http.StatusForbidden)
+			},
+			wantErr: ErrForbidden, wantRequests: 1,
+		},
+		{
+			name: "errors use up attempts", failures: 10,
+			fail: func(w http.ResponseWriter) {
+				http.Error(w, "write error", http.StatusInternalServerError)
+			},
+			wantErr: &StatusError{}, wantRequests: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts, requests := chunkServer(t, tt.failures, tt.fail)
+			err := ParallelUpload(context.Background(), ts.URL, testFile, config(), nil)
+			var status *StatusError
+			switch want := tt.wantErr.(type) {
+			case nil:
+				if err != nil {
+					t.Fatalf("upload failed: %v", err)
+				}
+			case *StatusError:
+				if !errors.As(err, &status) || status.StatusCode != http.StatusInternalServerError {
+					t.Fatalf("error = %v, want HTTP 500", err)
+				}
+			default:
+				if !errors.Is(err, want) {
+					t.Fatalf("error = %v, want %v", err, want)
+				}
+			}
+			if got := requests.Load(); got != tt.wantRequests {
+				t.Errorf("chunk requests = %d, want %d", got, tt.wantRequests)
+			}
+		})
+	}
+}
+
+func TestReceiveRateLimitedSuggestsWaiting(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Longer than the receiver waits on its own
+		w.Header().Set("Retry-After", "3600")
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusTooManyRequests)
+		_, _ = w.Write([]byte(`{"error":"transfer quota exceeded"}`))
+	}))
+	defer ts.Close()
+
+	_, err := NewDownloader(nil).Receive(ts.URL, filepath.Join(t.TempDir(), "out"), true, io.Discard, nil)
+	var limited *ErrRateLimited
+	if !errors.As(err, &limited) || limited.RetryAfter != time.Hour {
+		t.Fatalf("error = %v, want rate limited for 1h", err)
+	}
+	if !strings.Contains(err.Error(), "Try again in 1h0m0s") || !strings.Contains(err.Error(), "--quota-per-ip") {
+		t.Errorf("error lacks suggestions:\n%s", err)
+	}
+}
@@ -0,0 +1,92 @@
+package client
+
+import (
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// Manifest lists the files warp push uploads, in order
+type Manifest struct {
+	Files []ManifestFile `mapstructure:"files"`
+}
+
+// ManifestFile is one file of a Manifest
+type ManifestFile struct {
+	Path   string `mapstructure:"path"`   // Local file; relative paths start at the manifest's directory
+	Name   string `mapstructure:"name"`   // Name on the host; Path's base name when empty
+	SHA256 string `mapstructure:"sha256"` // Expected checksum, checked before sending; optional
+}
+
+// TargetName is the name the file is saved under on the host
+func (f ManifestFile) TargetName() string {
+	if f.Name != "" {
+		return f.Name
+	}
+	return filepath.Base(f.Path)
+}
+
+// LoadManifest reads a YAML or JSON manifest (by extension) and validates
+// it. Relative paths are resolved against the manifest's directory, so a
+// manifest works the same from any working directory. Checksums are
+// lower-cased.
+//
+//	files:
+//	  - path: dist/app-linux-amd64
+//	    name: app-linux
+//	    sha256: 9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08
+func LoadManifest(path string) (*Manifest, error) {
+	v := viper.New()
+	v.SetConfigFile(path)
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml", ".json":
+	default:
+		return nil, fmt.Errorf("manifest %s: want a .yaml, .yml or .json file", path)
+	}
+	if err := v.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("read manifest: %w", err)
+	}
+	var m Manifest
+	if err := v.Unmarshal(&m); err != nil {
+		return nil, fmt.Errorf("parse manifest %s: %w", path, err)
+	}
+	if err := m.resolve(filepath.Dir(path)); err != nil {
+		return nil, fmt.Errorf("manifest %s: %w", path, err)
+	}
+	return &m, nil
+}
+
+// resolve validates the entries and makes relative paths relative to dir
+func (m *Manifest) resolve(dir string) error {
+	if len(m.Files) == 0 {
+		return fmt.Errorf("no files listed")
+	}
+	names := make(map[string]int, len(m.Files))
+	for i := range m.Files {
+		f := &m.Files[i]
+		if f.Path == "" {
+			return fmt.Errorf("file %d: missing path", i+1)
+		}
+		if !filepath.IsAbs(f.Path) {
+			f.Path = filepath.Join(dir, f.Path)
+		}
+		if f.Name != "" && (strings.ContainsAny(f.Name, `/\`) || f.Name == "." || f.Name == "..") {
+			return fmt.Errorf("file %d: name %q must be a plain file name", i+1, f.Name)
+		}
+		if f.SHA256 != "" {
+			f.SHA256 = strings.ToLower(f.SHA256)
+			if b, err := hex.DecodeString(f.SHA256); err != nil || len(b) != 32 {
+				return fmt.Errorf("file %d: sha256 %q is not 64 hex digits", i+1, f.SHA256)
+			}
+		}
+		name := f.TargetName()
+		if prev, ok := names[name]; ok {
+			return fmt.Errorf("files %d and %d are both named %q on the host", prev, i+1, name)
+		}
+		names[name] = i + 1
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package client
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeManifest(t *testing.T, name, body string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(body), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadManifest(t *testing.T) {
+	const sum = "9F86D081884C7D659A2FEAA0C55AD015A3BF4F1B2B0B822CD15D6C15B0F00A08"
+	for _, tt := range []struct{ file, body string }{
+		{"files.yaml", `
+files:
+  - path: dist/app-linux
+    name: app
+    sha256: ` + sum + `
+  - path: /abs/notes.txt
+`},
+		{"files.json", `{"files": [
+  {"path": "dist/app-linux", "name": "app", "sha256": "` + sum + `"},
+  {"path": "/abs/notes.txt"}
+]}`},
+	} {
+		t.Run(tt.file, func(t *testing.T) {
+			path := writeManifest(t, tt.file, tt.body)
+			m, err := LoadManifest(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(m.Files) != 2 {
+				t.Fatalf("got %d files, want 2", len(m.Files))
+			}
+			first := m.Files[0]
+			if want := filepath.Join(filepath.Dir(path), "dist", "app-linux"); first.Path != want {
+				t.Errorf("relative path resolved to %q, want %q", first.Path, want)
+			}
+			if first.TargetName() != "app" || first.SHA256 != strings.ToLower(sum) {
+				t.Errorf("first entry = %+v", first)
+			}
+			second := m.Files[1]
+			want := "/abs/notes.txt"
+			if !filepath.IsAbs(want) { // Windows wants a drive letter
+				want = filepath.Join(filepath.Dir(path), want)
+			}
+			if second.Path != want {
+				t.Errorf("absolute path = %q, want %q", second.Path, want)
+			}
+			if second.TargetName() != "notes.txt" {
+				t.Errorf("default name = %q, want the base name", second.TargetName())
+			}
+		})
+	}
+}
+
+func TestLoadManifestErrors(t *testing.T) {
+	tests := []struct {
+		name, file, body, err string
+	}{
+		{"no files", "m.yaml", "files: []\n", "no files"},
+		{"missing path", "m.yaml", "files:\n  - name: x\n", "missing path"},
+		{"short checksum", "m.yaml", "files:\n  - path: a\n    sha256: abc\n", "64 hex digits"},
+		{"duplicate names", "m.yaml", "files:\n  - path: a/x\n  - path: b/x\n", `both named "x"`},
+		{"name with directory", "m.yaml", "files:\n  - path: a\n    name: sub/a\n", "plain file name"},
+		{"unknown format", "m.txt", "files: []\n", ".yaml, .yml or .json"},
+		{"invalid yaml", "m.yaml", "files: [\n", "read manifest"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadManifest(writeManifest(t, tt.file, tt.body))
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("got %v, want error containing %q", err, tt.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,216 @@
+package client
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zulfikawr/warp/internal/protocol"
+	"github.com/zulfikawr/warp/internal/ui"
+)
+
+// ErrNoListing is returned by Mirror when the share doesn't list its files:
+// a single file, text, a password-protected share or an older sender
+var ErrNoListing = errors.New("the sender doesn't list this share's files")
+
+// MirrorResult is what happened to one file of a mirrored directory share
+type MirrorResult struct {
+	Path    string // Slash-separated, as listed by the sender
+	Size    int64
+	Skipped bool  // Already in place with the listed SHA256
+	Err     error // Why the file could not be mirrored; nil on success
+}
+
+// Mirror recreates the directory share at shareURL under dest file by file,
+// without a zip in between. It fetches the share's listing, skips files that
+// are already in place with the listed SHA256 and downloads the rest, workers
+// at a time. Each download is verified against the listing before it
+// replaces what was there. The error is for a mirror that couldn't start;
+// failures of single files are in their results.
+func (d *Downloader) Mirror(shareURL, dest string, workers int, progress io.Writer) ([]MirrorResult, error) {
+	base := strings.TrimSuffix(shareURL, "/")
+	listing, err := d.fetchListing(base, progress)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dest, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", dest, err)
+	}
+
+	results := make([]MirrorResult, len(listing.Files))
+	var total int64
+	for i, e := range listing.Files {
+		results[i] = MirrorResult{Path: e.Path, Size: e.Size}
+		total += e.Size
+	}
+
+	name := "Mirroring " + listing.Name
+	renderer := d.renderer(progress)
+	start := time.Now()
+	if renderer != nil {
+		renderer.Start(ui.TransferState{Name: name, Total: total})
+	}
+
+	var mu sync.Mutex
+	var done int64
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for range max(workers, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				e := listing.Files[i]
+				skipped, err := d.mirrorFile(base, dest, e)
+				mu.Lock()
+				results[i].Skipped, results[i].Err = skipped, err
+				done += e.Size
+				if renderer != nil {
+					renderer.Update(ui.TransferState{Name: name, Current: done, Total: total, Elapsed: time.Since(start)})
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for i := range listing.Files {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	if renderer != nil {
+		var fetched, skipped, failed int
+		var bytes int64
+		for _, r := range results {
+			switch {
+			case r.Err != nil:
+				failed++
+			case r.Skipped:
+				skipped++
+			default:
+				fetched++
+				bytes += r.Size
+			}
+		}
+		sum := ui.Summary{Title: "Mirror Complete", Fields: []ui.Field{
+			{Label: "Downloaded", Value: fmt.Sprintf("%d files (%s)", fetched, ui.FormatBytes(bytes))},
+			{Label: "Unchanged", Value: fmt.Sprintf("%d files", skipped)},
+			{Label: "Failed", Value: fmt.Sprintf("%d files", failed)},
+			{Label: "Time", Value: fmt.Sprintf("%.1fs", time.Since(start).Seconds())},
+			{Label: "Saved to", Value: dest},
+		}}
+		if failed > 0 {
+			sum.Title = "Mirror Incomplete"
+		}
+		renderer.Finish(sum)
+	}
+	return results, nil
+}
+
+// fetchListing gets the file list of the share at base
+func (d *Downloader) fetchListing(base string, progress io.Writer) (*protocol.Listing, error) {
+	resp, err := d.getWithBusyRetry(base+protocol.ListPathSuffix, "", progress)
+	if err != nil {
+		return nil, fmt.Errorf("connection failed: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	transferID := resp.Header.Get(protocol.TransferIDHeader)
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, ErrNoListing
+	case http.StatusUnauthorized:
+		return nil, fmt.Errorf("authentication required (HTTP 401)%s\n\nTip: Pass the credentials the sender chose with --user and --password", transferSuffix(transferID))
+	default:
+		return nil, fmt.Errorf("server returned error: HTTP %d%s", resp.StatusCode, transferSuffix(transferID))
+	}
+	var listing protocol.Listing
+	if err := json.NewDecoder(resp.Body).Decode(&listing); err != nil {
+		return nil, fmt.Errorf("invalid file listing: %w", err)
+	}
+	return &listing, nil
+}
+
+// mirrorFile brings the file e of the share at base into dest, reporting
+// whether it was already there
+func (d *Downloader) mirrorFile(base, dest string, e protocol.ListingEntry) (skipped bool, err error) {
+	target, err := extractTarget(dest, e.Path)
+	if err != nil {
+		return false, err
+	}
+	if sameFile(target, e) {
+		return true, nil
+	}
+
+	resp, err := d.getWithBusyRetry(base+protocol.FilePathSuffix+"?path="+url.QueryEscape(e.Path), "", nil)
+	if err != nil {
+		return false, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("server returned error: HTTP %d%s", resp.StatusCode, transferSuffix(resp.Header.Get(protocol.TransferIDHeader)))
+	}
+
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return false, fmt.Errorf("failed to create %s: %w", filepath.Dir(target), err)
+	}
+	// Written next to the target and renamed over it once verified, so a
+	// failed download never replaces what was there
+	tmp, err := os.CreateTemp(filepath.Dir(target), ".warp-mirror-*")
+	if err != nil {
+		return false, fmt.Errorf("failed to create file: %w", err)
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+	hash := sha256.New()
+	buf := make([]byte, protocol.GetOptimalBufferSize(e.Size))
+	_, err = io.CopyBuffer(io.MultiWriter(tmp, hash), resp.Body, buf)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to write file data: %w", err)
+	}
+	if got := hex.EncodeToString(hash.Sum(nil)); got != e.SHA256 {
+		return false, fmt.Errorf("checksum verification failed: expected %s, got %s", abbrev(e.SHA256), abbrev(got))
+	}
+
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return false, err
+	}
+	if d.Preserve {
+		// Best effort: the file is verified either way
+		_ = protocol.FileAttrsFromHeader(resp.Header).Apply(tmp.Name())
+	}
+	if err := os.Rename(tmp.Name(), target); err != nil {
+		return false, fmt.Errorf("failed to save %s: %w", target, err)
+	}
+	return false, nil
+}
+
+// sameFile reports whether the file at path already has e's size and SHA256
+func sameFile(path string, e protocol.ListingEntry) bool {
+	fi, err := os.Stat(path)
+	if err != nil || !fi.Mode().IsRegular() || fi.Size() != e.Size {
+		return false
+	}
+	sum, _, err := HashFile(path, nil)
+	return err == nil && sum == e.SHA256
+}
+
+// abbrev shortens a checksum for error messages
+func abbrev(sum string) string {
+	if len(sum) > 16 {
+		return sum[:16] + "..."
+	}
+	return sum
+}
@@ -0,0 +1,110 @@
+package client
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/zulfikawr/warp/internal/protocol"
+)
+
+func hexSum(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// fakeMirrorSender lists files and serves bodies, which may not match
+// the listed content
+func fakeMirrorSender(t *testing.T, files []protocol.ListingEntry, bodies map[string]string) string {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/d/tok"+protocol.ListPathSuffix, func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(protocol.Listing{Name: "share", Files: files})
+	})
+	mux.HandleFunc("/d/tok"+protocol.FilePathSuffix, func(w http.ResponseWriter, r *http.Request) {
+		body, ok := bodies[r.URL.Query().Get("path")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = io.WriteString(w, body)
+	})
+	ts := httptest.NewServer(mux)
+	t.Cleanup(ts.Close)
+	return ts.URL + "/d/tok"
+}
+
+func TestMirrorReportsFailuresPerFile(t *testing.T) {
+	files := []protocol.ListingEntry{
+		{Path: "ok/a.txt", Size: 5, SHA256: hexSum("alpha")},
+		{Path: "corrupt.txt", Size: 5, SHA256: hexSum("bravo")},
+		{Path: "../escape.txt", Size: 5, SHA256: hexSum("gamma")},
+		{Path: "gone.txt", Size: 5, SHA256: hexSum("delta")},
+	}
+	shareURL := fakeMirrorSender(t, files, map[string]string{
+		"ok/a.txt":      "alpha",
+		"corrupt.txt":   "brav0",
+		"../escape.txt": "gamma",
+	})
+	parent := t.TempDir()
+	dest := filepath.Join(parent, "dest")
+	if err := os.MkdirAll(dest, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dest, "corrupt.txt"), []byte("old"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := NewDownloader(nil).Mirror(shareURL, dest, 2, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantErr := map[string]string{
+		"corrupt.txt":   "checksum verification failed",
+		"../escape.txt": "unsafe path",
+		"gone.txt":      "HTTP 404",
+	}
+	for _, r := range results {
+		want := wantErr[r.Path]
+		switch {
+		case want == "" && r.Err != nil:
+			t.Errorf("%s: %v", r.Path, r.Err)
+		case want != "" && (r.Err == nil || !strings.Contains(r.Err.Error(), want)):
+			t.Errorf("%s: err = %v, want %q", r.Path, r.Err, want)
+		}
+	}
+
+	if b, _ := os.ReadFile(filepath.Join(dest, "ok", "a.txt")); string(b) != "alpha" {
+		t.Errorf("ok/a.txt = %q", b)
+	}
+	// A failed download leaves the old copy alone and no temporary file behind
+	if b, _ := os.ReadFile(filepath.Join(dest, "corrupt.txt")); string(b) != "old" {
+		t.Errorf("corrupt.txt = %q, want the old copy kept", b)
+	}
+	if _, err := os.Stat(filepath.Join(parent, "escape.txt")); !os.IsNotExist(err) {
+		t.Errorf("escape.txt was written outside dest: %v", err)
+	}
+	entries, _ := os.ReadDir(dest)
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), ".warp-mirror-") {
+			t.Errorf("temporary file %s left behind", e.Name())
+		}
+	}
+}
+
+func TestMirrorWithoutListing(t *testing.T) {
+	ts := httptest.NewServer(http.NotFoundHandler())
+	defer ts.Close()
+	_, err := NewDownloader(nil).Mirror(ts.URL+"/d/tok", t.TempDir(), 1, nil)
+	if !errors.Is(err, ErrNoListing) {
+		t.Fatalf("err = %v, want ErrNoListing", err)
+	}
+}
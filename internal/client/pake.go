@@ -23,8 +23,9 @@ type pakeVerifyRequest struct {
 }
 
 type pakeVerifyResponse struct {
-	Confirmation []byte `json:"confirmation"`
-	Token        string `json:"token"`
+	Confirmation     []byte `json:"confirmation"`
+	Token            string `json:"token"`
+	CertConfirmation []byte `json:"cert_confirmation,omitempty"`
 }
 
 // PerformPAKEHandshake performs the PAKE handshake with the server at baseURL.
@@ -91,5 +92,17 @@ func (d *Downloader) PerformPAKEHandshake(baseURL string, code string) ([]byte,
 		return nil, "", fmt.Errorf("server PAKE confirmation failed: %w", err)
 	}
 
+	// Over TLS, as through a relay, the sender vouches for the certificate
+	// this connection presented. A relay that terminated the TLS itself
+	// can't forge that without the key.
+	if resp.TLS != nil {
+		if len(resp.TLS.PeerCertificates) == 0 {
+			return nil, "", fmt.Errorf("server presented no TLS certificate")
+		}
+		if err := crypto.VerifyCertConfirmation(key, resp.TLS.PeerCertificates[0].Raw, verifyResp.CertConfirmation); err != nil {
+			return nil, "", fmt.Errorf("%w; the connection may be intercepted", err)
+		}
+	}
+
 	return key, verifyResp.Token, nil
 }
@@ -0,0 +1,160 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/zulfikawr/warp/internal/errors"
+	"github.com/zulfikawr/warp/internal/protocol"
+)
+
+// PingReply is one answered probe of /health
+type PingReply struct {
+	RTT      time.Duration
+	Skew     time.Duration // Server clock minus local clock, positive when the server is ahead
+	Health   protocol.Health
+	QUICPort int // UDP port of the server's HTTP/3 listener; 0 = none
+}
+
+// PingResult summarizes a warp ping run. Latencies cover answered probes only.
+type PingResult struct {
+	URL           string
+	Sent          int
+	Received      int
+	Min, Avg, Max time.Duration
+	Skew          time.Duration    // Taken from the fastest reply, the tightest bound
+	Health        *protocol.Health // From the last reply; nil when none came back
+	QUICPort      int              // From the last reply; 0 when QUIC isn't served
+}
+
+// Pinger probes the /health endpoint of a warp server
+type Pinger struct {
+	client    *http.Client
+	healthURL string
+	host      string
+}
+
+// NewPinger accepts a share URL, an upload URL or a bare host:port
+func NewPinger(target string) (*Pinger, error) {
+	raw := strings.TrimSpace(target)
+	if !strings.Contains(raw, "://") {
+		raw = "http://" + raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, errors.InvalidURLError(target, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, errors.InvalidURLError(target, fmt.Errorf("unsupported scheme %q", u.Scheme))
+	}
+	if u.Hostname() == "" {
+		return nil, errors.InvalidURLError(target, fmt.Errorf("missing host"))
+	}
+	c := defaultHTTPClient()
+	c.Timeout = 5 * time.Second
+	return &Pinger{
+		client:    c,
+		healthURL: u.Scheme + "://" + u.Host + protocol.HealthPath,
+		host:      u.Hostname(),
+	}, nil
+}
+
+// URL is the health endpoint being probed
+func (p *Pinger) URL() string {
+	return p.healthURL
+}
+
+// Host is the server's host name or address
+func (p *Pinger) Host() string {
+	return p.host
+}
+
+// Ping sends one probe. The skew assumes the server read its clock halfway
+// through the round trip.
+func (p *Pinger) Ping(ctx context.Context) (*PingReply, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.healthURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL: %w", err)
+	}
+	start := time.Now()
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("connection failed: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("server returned error: HTTP %d", resp.StatusCode)
+	}
+	var h protocol.Health
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<16)).Decode(&h); err != nil {
+		return nil, fmt.Errorf("invalid health response: %w", err)
+	}
+	rtt := time.Since(start)
+
+	reply := &PingReply{RTT: rtt, Health: h, QUICPort: QUICPort(resp.Header)}
+	// Servers that predate warp ping send no time
+	if !h.Time.IsZero() {
+		reply.Skew = h.Time.Sub(start.Add(rtt / 2))
+	}
+	return reply, nil
+}
+
+// Run sends count probes, interval apart, and calls onProbe after each with
+// its sequence number and either the reply or the error. Cancelling ctx ends
+// the run early with what was gathered so far. It fails only when no probe
+// was answered.
+func (p *Pinger) Run(ctx context.Context, count int, interval time.Duration, onProbe func(seq int, reply *PingReply, err error)) (*PingResult, error) {
+	res := &PingResult{URL: p.healthURL}
+	var total time.Duration
+	var lastErr error
+probes:
+	for seq := 1; seq <= count; seq++ {
+		if seq > 1 {
+			select {
+			case <-ctx.Done():
+				break probes
+			case <-time.After(interval):
+			}
+		}
+		reply, err := p.Ping(ctx)
+		if ctx.Err() != nil {
+			break
+		}
+		res.Sent++
+		if onProbe != nil {
+			onProbe(seq, reply, err)
+		}
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if res.Received == 0 || reply.RTT < res.Min {
+			res.Min = reply.RTT
+			res.Skew = reply.Skew
+		}
+		res.Max = max(res.Max, reply.RTT)
+		total += reply.RTT
+		res.Received++
+		res.Health = &reply.Health
+		res.QUICPort = reply.QUICPort
+	}
+	if res.Received == 0 {
+		return res, errors.NewUserError(
+			fmt.Sprintf("No reply from %s", p.healthURL),
+			[]string{
+				"Check that the server is still running",
+				"Ensure both devices are on the same network",
+				"Check that a firewall is not dropping the port",
+			},
+			lastErr,
+		)
+	}
+	res.Avg = total / time.Duration(res.Received)
+	return res, nil
+}
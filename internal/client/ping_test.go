@@ -0,0 +1,118 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/zulfikawr/warp/internal/protocol"
+)
+
+// healthServer answers /health after the next delay from delays, with its
+// clock running ahead by skew
+func healthServer(t *testing.T, delays []time.Duration, skew time.Duration) *httptest.Server {
+	t.Helper()
+	var calls atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != protocol.HealthPath {
+			http.NotFound(w, r)
+			return
+		}
+		n := int(calls.Add(1)) - 1
+		time.Sleep(delays[n%len(delays)])
+		_ = json.NewEncoder(w).Encode(protocol.Health{
+			Status:    "ok",
+			Version:   "9.9.9",
+			Mode:      "send",
+			Time:      time.Now().Add(skew),
+			Encrypted: true,
+		})
+	}))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func TestPingReportsLatencyAndSkew(t *testing.T) {
+	delays := []time.Duration{20 * time.Millisecond, 60 * time.Millisecond, 40 * time.Millisecond}
+	ts := healthServer(t, delays, 3*time.Second)
+
+	p, err := NewPinger(ts.URL + "/d/sometoken")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var probes int
+	res, err := p.Run(context.Background(), 3, 0, func(seq int, reply *PingReply, err error) {
+		probes++
+		if seq != probes || err != nil || reply == nil {
+			t.Errorf("probe %d: seq %d, reply %v, err %v", probes, seq, reply, err)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Sent != 3 || res.Received != 3 {
+		t.Errorf("sent %d received %d, want 3 and 3", res.Sent, res.Received)
+	}
+	if res.Min < 20*time.Millisecond || res.Max < 60*time.Millisecond || res.Min > res.Avg || res.Avg > res.Max {
+		t.Errorf("min/avg/max = %s/%s/%s, want at least 20ms and 60ms, in order", res.Min, res.Avg, res.Max)
+	}
+	// The server clock reads halfway through the fastest probe's sleep, so
+	// the estimate is off by at most half that probe's round trip
+	if d := res.Skew - 3*time.Second; d.Abs() > res.Min {
+		t.Errorf("skew = %s, want about 3s", res.Skew)
+	}
+	if h := res.Health; h == nil || h.Version != "9.9.9" || h.Mode != "send" || !h.Encrypted || h.PAKE {
+		t.Errorf("health = %+v", res.Health)
+	}
+}
+
+func TestPingUnreachable(t *testing.T) {
+	ts := httptest.NewServer(http.NotFoundHandler())
+	addr := ts.Listener.Addr().String()
+	ts.Close()
+
+	p, err := NewPinger(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var failures int
+	res, err := p.Run(context.Background(), 2, 0, func(_ int, reply *PingReply, err error) {
+		if err != nil {
+			failures++
+		}
+	})
+	if err == nil {
+		t.Fatal("ping of a closed port succeeded")
+	}
+	if failures != 2 || res.Sent != 2 || res.Received != 0 {
+		t.Errorf("%d failures, sent %d received %d, want 2, 2 and 0", failures, res.Sent, res.Received)
+	}
+}
+
+func TestNewPingerURLs(t *testing.T) {
+	tests := []struct {
+		target, want string
+		wantErr      bool
+	}{
+		{"http://192.168.1.5:41234/d/abc", "http://192.168.1.5:41234/health", false},
+		{"192.168.1.5:41234/u/abc", "http://192.168.1.5:41234/health", false},
+		{"192.168.1.5:41234", "http://192.168.1.5:41234/health", false},
+		{"https://box.local:8443", "https://box.local:8443/health", false},
+		{"ftp://192.168.1.5:21", "", true},
+		{"http://", "", true},
+	}
+	for _, tt := range tests {
+		p, err := NewPinger(tt.target)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("NewPinger(%q) err = %v, wantErr %v", tt.target, err, tt.wantErr)
+			continue
+		}
+		if err == nil && p.URL() != tt.want {
+			t.Errorf("NewPinger(%q) probes %s, want %s", tt.target, p.URL(), tt.want)
+		}
+	}
+}
@@ -0,0 +1,374 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zulfikawr/warp/internal/ui"
+)
+
+// Per-file outcomes in a PushResult
+const (
+	PushOK      = "ok"
+	PushFailed  = "failed"
+	PushSkipped = "skipped" // Not attempted after a --fail-fast stop or a cancelled start
+)
+
+// PushFileResult is the outcome of one manifest file
+type PushFileResult struct {
+	Path       string `json:"path"`
+	Name       string `json:"name"`
+	Size       int64  `json:"size"`
+	SHA256     string `json:"sha256,omitempty"`
+	Status     string `json:"status"`
+	Verified   bool   `json:"verified"` // The host confirmed SHA256 after assembling the file
+	DurationMS int64  `json:"duration_ms"`
+	Error      string `json:"error,omitempty"`
+}
+
+// PushResult is the machine-readable outcome of a push, written by --result
+type PushResult struct {
+	URL        string           `json:"url"`
+	Started    time.Time        `json:"started"`
+	DurationMS int64            `json:"duration_ms"`
+	OK         int              `json:"ok"`
+	Failed     int              `json:"failed"`
+	Skipped    int              `json:"skipped"`
+	Files      []PushFileResult `json:"files"`
+}
+
+// Err summarizes the files that didn't make it, or returns nil
+func (r *PushResult) Err() error {
+	if r.Failed == 0 && r.Skipped == 0 {
+		return nil
+	}
+	return fmt.Errorf("%d of %d files failed, %d skipped", r.Failed, len(r.Files), r.Skipped)
+}
+
+// WriteFile writes the result as indented JSON. The file is replaced in one
+// rename, so a reader never sees half a result.
+func (r *PushResult) WriteFile(path string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".warp-result-*")
+	if err != nil {
+		return fmt.Errorf("write result: %w", err)
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("write result: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("write result: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("write result: %w", err)
+	}
+	return nil
+}
+
+// Pusher uploads every file of a Manifest to one host-mode URL
+type Pusher struct {
+	URL      string
+	Manifest *Manifest
+	Config   *UploadConfig   // Per-file settings; DefaultUploadConfig when nil
+	Parallel int             // Chunk uploads in flight across all files; Config.MaxConcurrent when 0
+	FailFast bool            // Stop at the first failed file; the rest are skipped
+	Append   bool            // Append each file's new bytes to the host's copy instead of uploading it anew (push --append)
+	Out      io.Writer       // One summary line per file; nil disables them
+	Progress ui.ProgressMode // Each file's live progress on Out; none when empty
+
+	outMu  sync.Mutex
+	hashMu sync.Mutex
+	hashed map[string]hashedFile // path -> checksum taken by Precompute
+}
+
+// hashedFile is a checksum with the size and modification time it was taken at
+type hashedFile struct {
+	sum     string
+	size    int64
+	modTime time.Time
+}
+
+// Precompute hashes every file and checks it against its manifest checksum
+// now, so a scheduled push finds a bad file before its start time. Uploads
+// later reuse the checksums of files that haven't changed since.
+func (p *Pusher) Precompute() error {
+	var errs []error
+	for _, f := range p.Manifest.Files {
+		sum, _, err := p.hash(f.Path)
+		if err == nil && f.SHA256 != "" && f.SHA256 != sum {
+			err = fmt.Errorf("checksum mismatch: manifest has %s, file is %s", f.SHA256, sum)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", f.TargetName(), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// hash returns the checksum and size of the file at path, reusing the one
+// Precompute took if the file's size and modification time still match
+func (p *Pusher) hash(path string) (string, int64, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return "", 0, err
+	}
+	p.hashMu.Lock()
+	h, ok := p.hashed[path]
+	p.hashMu.Unlock()
+	if ok && h.size == fi.Size() && h.modTime.Equal(fi.ModTime()) {
+		return h.sum, h.size, nil
+	}
+
+	sum, size, err := HashFile(path, nil)
+	if err != nil {
+		return "", 0, err
+	}
+	p.hashMu.Lock()
+	defer p.hashMu.Unlock()
+	if p.hashed == nil {
+		p.hashed = make(map[string]hashedFile)
+	}
+	p.hashed[path] = hashedFile{sum: sum, size: size, modTime: fi.ModTime()}
+	return sum, size, nil
+}
+
+// PushPlan is what a push is about to send, shown before it starts
+type PushPlan struct {
+	Host      string // host:port of the upload URL
+	Files     int
+	TotalSize int64
+	// Estimate is how long the upload would take at the host's recent
+	// upload speed; 0 when the host has no history
+	Estimate time.Duration
+	// Problems are the files that would fail: unreadable, or ruled out by
+	// the host's limits
+	Problems []PushProblem
+}
+
+// PushProblem is a file a push can already tell will fail
+type PushProblem struct {
+	Name   string
+	Reason string
+}
+
+// Plan adds up the manifest's files and checks them against the host's
+// capabilities, without sending anything. A host that can't be reached or
+// predates the capabilities document gives no estimate and flags nothing.
+func (p *Pusher) Plan(ctx context.Context) (*PushPlan, error) {
+	u, err := url.Parse(p.URL)
+	if err != nil {
+		return nil, err
+	}
+	plan := &PushPlan{Host: u.Host, Files: len(p.Manifest.Files)}
+	caps, err := fetchCapabilities(ctx, defaultHTTPClient(), p.URL)
+	if err != nil {
+		return nil, err
+	}
+	cfg := DefaultUploadConfig()
+	if p.Config != nil {
+		cfg = p.Config
+	}
+	for _, f := range p.Manifest.Files {
+		name := f.TargetName()
+		fi, err := os.Stat(f.Path)
+		if err == nil && !fi.Mode().IsRegular() {
+			err = fmt.Errorf("%s is not a regular file", f.Path)
+		}
+		if err != nil {
+			plan.Problems = append(plan.Problems, PushProblem{name, err.Error()})
+			continue
+		}
+		plan.TotalSize += fi.Size()
+		// An append sends only what the host lacks, under other rules
+		if p.Append {
+			continue
+		}
+		if _, err := adaptConfig(*cfg, caps, name, fi.Size()); err != nil {
+			plan.Problems = append(plan.Problems, PushProblem{name, strings.TrimPrefix(err.Error(), ErrUploadRejected.Error()+": ")})
+		}
+	}
+	if caps != nil && caps.RecentSpeed > 0 {
+		plan.Estimate = time.Duration(float64(plan.TotalSize) / float64(caps.RecentSpeed) * float64(time.Second))
+	}
+	return plan, nil
+}
+
+// Run uploads the manifest's files, up to Parallel at a time, and reports
+// each one. A failed file doesn't stop the others unless FailFast is set.
+func (p *Pusher) Run(ctx context.Context) *PushResult {
+	cfg := DefaultUploadConfig()
+	if p.Config != nil {
+		cfg = p.Config
+	}
+	parallel := p.Parallel
+	if parallel <= 0 {
+		parallel = max(cfg.MaxConcurrent, 1)
+	}
+	shared := *cfg
+	shared.slots = make(chan struct{}, parallel)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	res := &PushResult{URL: p.URL, Started: time.Now(), Files: make([]PushFileResult, len(p.Manifest.Files))}
+	files := make(chan struct{}, parallel)
+	var wg sync.WaitGroup
+	for i, f := range p.Manifest.Files {
+		select {
+		case files <- struct{}{}:
+			if ctx.Err() == nil {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					defer func() { <-files }()
+					r := p.pushFile(ctx, f, shared)
+					if r.Status == PushFailed && p.FailFast {
+						cancel()
+					}
+					res.Files[i] = r
+				}()
+				continue
+			}
+			<-files
+		case <-ctx.Done():
+		}
+		res.Files[i] = PushFileResult{Path: f.Path, Name: f.TargetName(), Status: PushSkipped}
+	}
+	wg.Wait()
+
+	for _, r := range res.Files {
+		switch r.Status {
+		case PushOK:
+			res.OK++
+		case PushFailed:
+			res.Failed++
+		default:
+			res.Skipped++
+		}
+	}
+	res.DurationMS = time.Since(res.Started).Milliseconds()
+	return res
+}
+
+// Skipped reports every file as skipped, for a push cancelled before Run
+func (p *Pusher) Skipped() *PushResult {
+	res := &PushResult{URL: p.URL, Started: time.Now(), Skipped: len(p.Manifest.Files), Files: make([]PushFileResult, len(p.Manifest.Files))}
+	for i, f := range p.Manifest.Files {
+		res.Files[i] = PushFileResult{Path: f.Path, Name: f.TargetName(), Status: PushSkipped}
+	}
+	return res
+}
+
+// pushFile checks one file against the manifest and uploads it
+func (p *Pusher) pushFile(ctx context.Context, f ManifestFile, cfg UploadConfig) PushFileResult {
+	start := time.Now()
+	r := PushFileResult{Path: f.Path, Name: f.TargetName()}
+	fail := func(err error) PushFileResult {
+		r.DurationMS = time.Since(start).Milliseconds()
+		r.Status = PushFailed
+		if ctx.Err() != nil && errors.Is(err, context.Canceled) {
+			// Another file failed under FailFast and cancelled this one
+			r.Status = PushSkipped
+		}
+		r.Error = err.Error()
+		p.printf("%s✗ %s: %v%s\n", ui.Colors.Red, r.Name, firstLine(r.Error), ui.Colors.Reset)
+		return r
+	}
+
+	if p.Append {
+		return p.appendFile(ctx, f, r, start, fail)
+	}
+
+	sum, size, err := p.hash(f.Path)
+	if err != nil {
+		return fail(err)
+	}
+	r.Size, r.SHA256 = size, sum
+	if f.SHA256 != "" && f.SHA256 != sum {
+		return fail(fmt.Errorf("checksum mismatch before sending: manifest has %s, file is %s", f.SHA256, sum))
+	}
+
+	cfg.Renderer = p.renderer()
+	s, err := NewUploadSession(p.URL, f.Path, &cfg)
+	if err != nil {
+		return fail(err)
+	}
+	s.Name = r.Name
+	s.Checksum = sum
+	if err := s.Upload(ctx); err != nil {
+		return fail(err)
+	}
+	r.Verified = s.Verified()
+	r.Status = PushOK
+	r.DurationMS = time.Since(start).Milliseconds()
+
+	check := "not verified by host"
+	if r.Verified {
+		check = "verified"
+	}
+	p.printf("%s✓%s %s  %s  %s  %s\n", ui.Colors.Green, ui.Colors.Reset,
+		r.Name, ui.FormatBytes(size), ui.FormatDuration(time.Since(start)), check)
+	return r
+}
+
+// renderer shows one file's progress on Out as Progress asks, leaving its
+// summary to the line pushFile prints; nil when there is none to show
+func (p *Pusher) renderer() ui.Renderer {
+	mode := p.Progress
+	if p.Out == nil || mode == "" || mode == ui.ProgressNone {
+		return nil
+	}
+	if mode == ui.ProgressAuto && p.Parallel != 1 {
+		// Bars of files sent side by side would redraw over each other
+		mode = ui.ProgressPlain
+	}
+	return progressOnly{ui.NewModeRenderer(p.Out, false, mode)}
+}
+
+// appendFile sends what the host's copy of f lacks, see AppendFile. A pinned
+// checksum is checked against the whole local file first.
+func (p *Pusher) appendFile(ctx context.Context, f ManifestFile, r PushFileResult, start time.Time, fail func(error) PushFileResult) PushFileResult {
+	if f.SHA256 != "" {
+		sum, _, err := p.hash(f.Path)
+		if err != nil {
+			return fail(err)
+		}
+		if f.SHA256 != sum {
+			return fail(fmt.Errorf("checksum mismatch before sending: manifest has %s, file is %s", f.SHA256, sum))
+		}
+		r.SHA256 = sum
+	}
+	res, err := AppendFile(ctx, p.URL, f.Path, r.Name)
+	if err != nil {
+		return fail(err)
+	}
+	r.Size = res.FileSize
+	r.Status = PushOK
+	r.DurationMS = time.Since(start).Milliseconds()
+	p.printf("%s✓%s %s  +%s  %s now  %s\n", ui.Colors.Green, ui.Colors.Reset,
+		r.Name, ui.FormatBytes(res.Sent), ui.FormatBytes(res.FileSize), ui.FormatDuration(time.Since(start)))
+	return r
+}
+
+func (p *Pusher) printf(format string, args ...any) {
+	if p.Out == nil {
+		return
+	}
+	p.outMu.Lock()
+	defer p.outMu.Unlock()
+	_, _ = fmt.Fprintf(p.Out, format, args...)
+}
@@ -0,0 +1,332 @@
+package client
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zulfikawr/warp/internal/protocol"
+	"github.com/zulfikawr/warp/internal/ui"
+)
+
+// pushHost is a minimal host that assembles chunk uploads in memory and
+// checks finalize requests against what arrived
+type pushHost struct {
+	mu       sync.Mutex
+	files    map[string][]byte // name -> contents
+	sessions map[string]string // session -> name
+}
+
+func newPushHost(t *testing.T) (*pushHost, *httptest.Server) {
+	h := &pushHost{files: map[string][]byte{}, sessions: map[string]string{}}
+	ts := httptest.NewServer(http.HandlerFunc(h.serve))
+	t.Cleanup(ts.Close)
+	return h, ts
+}
+
+func (h *pushHost) serve(w http.ResponseWriter, r *http.Request) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if strings.HasSuffix(r.URL.Path, protocol.FinalizePathSuffix) {
+		sum := sha256.Sum256(h.files[h.sessions[r.Header.Get("X-Upload-Session")]])
+		status, code := "pass", http.StatusOK
+		if hex.EncodeToString(sum[:]) != r.Header.Get(protocol.ContentSHA256Header) {
+			status, code = "fail", http.StatusUnprocessableEntity
+		}
+		w.WriteHeader(code)
+		_ = json.NewEncoder(w).Encode(verifyResult{Status: status})
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.NotFound(w, r)
+		return
+	}
+	name, _ := url.QueryUnescape(r.Header.Get("X-File-Name"))
+	offset, _ := strconv.ParseInt(r.Header.Get("X-Upload-Offset"), 10, 64)
+	total, _ := strconv.ParseInt(r.Header.Get("X-Upload-Total"), 10, 64)
+	buf, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if h.files[name] == nil {
+		h.files[name] = make([]byte, total)
+	}
+	copy(h.files[name][offset:], buf)
+	h.sessions[r.Header.Get("X-Upload-Session")] = name
+	_, _ = w.Write([]byte(`{"success":true}`))
+}
+
+func (h *pushHost) file(name string) ([]byte, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	b, ok := h.files[name]
+	return b, ok
+}
+
+func pushConfig() *UploadConfig {
+	return &UploadConfig{ChunkSize: 1024, MaxConcurrent: 2, RetryAttempts: 0, RetryDelay: 10 * time.Millisecond, Verify: true}
+}
+
+// pushFiles writes name -> content files into a temp dir and returns a
+// manifest listing them in the given order
+func pushFiles(t *testing.T, order []string, content map[string]string) *Manifest {
+	t.Helper()
+	dir := t.TempDir()
+	m := &Manifest{}
+	for _, name := range order {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content[name]), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		m.Files = append(m.Files, ManifestFile{Path: path})
+	}
+	return m
+}
+
+func sha256Hex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestPusherContinuesPastFailures(t *testing.T) {
+	host, ts := newPushHost(t)
+	content := map[string]string{
+		"a.bin": strings.Repeat("a", 5000),
+		"b.bin": "tampered",
+		"c.bin": strings.Repeat("c", 1500),
+	}
+	m := pushFiles(t, []string{"a.bin", "b.bin", "c.bin"}, content)
+	m.Files[0].Name = "renamed.bin"
+	m.Files[0].SHA256 = sha256Hex(content["a.bin"])
+	m.Files[1].SHA256 = sha256Hex("original")
+
+	p := &Pusher{URL: ts.URL + "/u/tok", Manifest: m, Config: pushConfig(), Parallel: 3}
+	res := p.Run(context.Background())
+
+	if res.OK != 2 || res.Failed != 1 || res.Skipped != 0 || res.Err() == nil {
+		t.Fatalf("ok/failed/skipped = %d/%d/%d, err %v", res.OK, res.Failed, res.Skipped, res.Err())
+	}
+	if r := res.Files[1]; r.Status != PushFailed || !strings.Contains(r.Error, "checksum mismatch before sending") {
+		t.Errorf("b.bin = %+v, want a pre-send checksum failure", r)
+	}
+	if _, sent := host.file("b.bin"); sent {
+		t.Error("a file failing its manifest checksum was uploaded")
+	}
+	for _, tt := range []struct {
+		result      PushFileResult
+		name, local string
+	}{
+		{res.Files[0], "renamed.bin", "a.bin"},
+		{res.Files[2], "c.bin", "c.bin"},
+	} {
+		if r := tt.result; r.Status != PushOK || !r.Verified || r.Name != tt.name {
+			t.Errorf("%s = %+v, want ok and verified", tt.name, r)
+		}
+		if got, _ := host.file(tt.name); string(got) != content[tt.local] {
+			t.Errorf("host has %d bytes for %s, want %s", len(got), tt.name, tt.local)
+		}
+	}
+}
+
+func TestPusherFailFast(t *testing.T) {
+	host, ts := newPushHost(t)
+	content := map[string]string{"a.bin": "one", "b.bin": "two", "c.bin": "three"}
+	m := pushFiles(t, []string{"a.bin", "b.bin", "c.bin"}, content)
+	m.Files[0].SHA256 = sha256Hex("not one")
+
+	p := &Pusher{URL: ts.URL + "/u/tok", Manifest: m, Config: pushConfig(), Parallel: 1, FailFast: true}
+	res := p.Run(context.Background())
+
+	if res.Failed != 1 || res.Skipped != 2 || res.OK != 0 {
+		t.Fatalf("ok/failed/skipped = %d/%d/%d, want 0/1/2", res.OK, res.Failed, res.Skipped)
+	}
+	for _, name := range []string{"b.bin", "c.bin"} {
+		if _, sent := host.file(name); sent {
+			t.Errorf("%s was uploaded after --fail-fast stopped the push", name)
+		}
+	}
+}
+
+func TestPusherSkipped(t *testing.T) {
+	m := pushFiles(t, []string{"a.bin", "b.bin"}, map[string]string{"a.bin": "one", "b.bin": "two"})
+	res := (&Pusher{URL: "http://host/u/tok", Manifest: m}).Skipped()
+	if res.Skipped != 2 || res.OK != 0 || res.Failed != 0 || res.Err() == nil {
+		t.Fatalf("ok/failed/skipped = %d/%d/%d, err %v", res.OK, res.Failed, res.Skipped, res.Err())
+	}
+	for _, f := range res.Files {
+		if f.Status != PushSkipped || f.Name == "" {
+			t.Errorf("file = %+v", f)
+		}
+	}
+}
+
+func TestPusherRenderer(t *testing.T) {
+	var out strings.Builder
+	tests := []struct {
+		name string
+		p    *Pusher
+		want string // %T of the wrapped renderer, "" for none
+	}{
+		{"unset", &Pusher{Out: &out}, ""},
+		{"none", &Pusher{Out: &out, Progress: ui.ProgressNone}, ""},
+		{"no output", &Pusher{Progress: ui.ProgressBar}, ""},
+		{"bar", &Pusher{Out: &out, Parallel: 3, Progress: ui.ProgressBar}, "*ui.ANSIRenderer"},
+		{"auto side by side", &Pusher{Out: &out, Parallel: 3, Progress: ui.ProgressAuto}, "*ui.PlainRenderer"},
+		{"plain", &Pusher{Out: &out, Parallel: 1, Progress: ui.ProgressPlain}, "*ui.PlainRenderer"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ""
+			if r, ok := tt.p.renderer().(progressOnly); ok {
+				got = fmt.Sprintf("%T", r.Renderer)
+			}
+			if got != tt.want {
+				t.Errorf("renderer %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPushResultWriteFile(t *testing.T) {
+	res := &PushResult{
+		URL:     "http://192.168.1.7:52314/u/tok",
+		Started: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+		OK:      1, Failed: 1,
+		Files: []PushFileResult{
+			{Path: "/a", Name: "a", Size: 3, SHA256: sha256Hex("one"), Status: PushOK, Verified: true},
+			{Path: "/b", Name: "b", Status: PushFailed, Error: "boom"},
+		},
+	}
+	path := filepath.Join(t.TempDir(), "out.json")
+	if err := res.WriteFile(path); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]any
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("result is not JSON: %v\n%s", err, data)
+	}
+	files := got["files"].([]any)
+	if got["ok"] != 1.0 || got["failed"] != 1.0 || len(files) != 2 {
+		t.Fatalf("result = %s", data)
+	}
+	first, second := files[0].(map[string]any), files[1].(map[string]any)
+	if first["status"] != "ok" || first["verified"] != true || first["sha256"] != sha256Hex("one") {
+		t.Errorf("first file = %v", first)
+	}
+	if second["status"] != "failed" || second["error"] != "boom" {
+		t.Errorf("second file = %v", second)
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(path)); len(entries) != 1 {
+		t.Errorf("temp files left behind: %v", entries)
+	}
+	if !strings.Contains(res.Err().Error(), "1 of 2 files failed") {
+		t.Errorf("Err() = %v", res.Err())
+	}
+}
+
+func TestPusherPrecompute(t *testing.T) {
+	host, ts := newPushHost(t)
+	content := map[string]string{"a.bin": "one", "b.bin": "two"}
+	m := pushFiles(t, []string{"a.bin", "b.bin"}, content)
+	m.Files[1].SHA256 = sha256Hex("not two")
+
+	p := &Pusher{URL: ts.URL + "/u/tok", Manifest: m, Config: pushConfig()}
+	err := p.Precompute()
+	if err == nil || !strings.Contains(err.Error(), "b.bin: checksum mismatch") || strings.Contains(err.Error(), "a.bin") {
+		t.Fatalf("Precompute() = %v, want only b.bin's mismatch", err)
+	}
+
+	// A file changed after Precompute is hashed again before it's sent
+	m.Files[1].SHA256 = ""
+	later := time.Now().Add(time.Minute)
+	if err := os.WriteFile(m.Files[0].Path, []byte("uno"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(m.Files[0].Path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	res := p.Run(context.Background())
+	if res.OK != 2 {
+		t.Fatalf("ok = %d, want 2: %+v", res.OK, res.Files)
+	}
+	if r := res.Files[0]; r.SHA256 != sha256Hex("uno") || !r.Verified {
+		t.Errorf("a.bin = %+v, want the checksum of its new contents", r)
+	}
+	if got, _ := host.file("a.bin"); string(got) != "uno" {
+		t.Errorf("host has %q for a.bin", got)
+	}
+}
+
+func TestPusherPlan(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, protocol.ManifestPathSuffix) {
+			http.NotFound(w, r)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(protocol.Capabilities{
+			Version:     "1",
+			Mode:        "host",
+			Features:    []string{protocol.FeatureParallelChunks},
+			Limits:      protocol.Limits{MaxFileSize: 100, AllowedExtensions: []string{".txt", ".bin"}},
+			RecentSpeed: 10,
+		})
+	}))
+	defer ts.Close()
+
+	m := pushFiles(t, []string{"a.txt", "big.bin", "c.exe"}, map[string]string{
+		"a.txt":   "hello",
+		"big.bin": strings.Repeat("x", 150),
+		"c.exe":   "MZ",
+	})
+	m.Files = append(m.Files, ManifestFile{Path: filepath.Join(t.TempDir(), "gone.txt")})
+	p := &Pusher{URL: ts.URL + "/u/tok", Manifest: m, Config: pushConfig()}
+
+	plan, err := p.Plan(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := strings.TrimPrefix(ts.URL, "http://"); plan.Host != want {
+		t.Errorf("host = %q, want %q", plan.Host, want)
+	}
+	if plan.Files != 4 || plan.TotalSize != 157 {
+		t.Errorf("%d files of %d bytes, want 4 of 157", plan.Files, plan.TotalSize)
+	}
+	if plan.Estimate != 15700*time.Millisecond {
+		t.Errorf("estimate = %s, want 15.7s at 10 B/s", plan.Estimate)
+	}
+	var flagged []string
+	for _, pr := range plan.Problems {
+		flagged = append(flagged, pr.Name)
+		if strings.HasPrefix(pr.Reason, ErrUploadRejected.Error()) {
+			t.Errorf("%s: reason %q repeats the rejection prefix", pr.Name, pr.Reason)
+		}
+	}
+	if got := strings.Join(flagged, " "); got != "big.bin c.exe gone.txt" {
+		t.Errorf("flagged %q, want the oversized, disallowed and missing files", got)
+	}
+
+	// A host that can't be asked leaves only the missing file to flag
+	p.URL = "http://127.0.0.1:1/u/tok"
+	plan, err = p.Plan(context.Background())
+	if err != nil || plan.Estimate != 0 || len(plan.Problems) != 1 {
+		t.Errorf("unreachable host: %+v, %v", plan, err)
+	}
+}
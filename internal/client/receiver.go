@@ -4,25 +4,56 @@ import (
 	"compress/gzip"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"hash"
 	"io"
 	"net/http"
 	"os"
 	"path"
+	"path/filepath"
 	"strings"
 	"time"
 
 	"github.com/klauspost/compress/zstd"
 
 	"github.com/zulfikawr/warp/internal/crypto"
+	"github.com/zulfikawr/warp/internal/i18n"
 	"github.com/zulfikawr/warp/internal/metrics"
+	"github.com/zulfikawr/warp/internal/naming"
 	"github.com/zulfikawr/warp/internal/protocol"
 	"github.com/zulfikawr/warp/internal/ui"
 )
 
+// ErrSourceChanged means the sender's file changed or disappeared while it
+// was being served, so the download was refused or cut short
+var ErrSourceChanged = errors.New("transfer ended early — the source file may have changed on the sender")
+
 // Downloader handles file downloads with configurable HTTP client
 type Downloader struct {
 	client *http.Client
+	// Preserve applies the sender's modification time and mode (X-File-Mtime,
+	// X-File-Mode) to the saved file after it has been verified
+	Preserve bool
+	// Renderer displays progress and the final summary. When nil, one is
+	// chosen for the progress writer passed to Receive.
+	Renderer ui.Renderer
+	// OutputDir, when set, is where files go if Receive gets no output path;
+	// otherwise they go in the working directory. Names that already exist
+	// there get a " (n)" suffix instead of being overwritten, like uploads on
+	// the host. Outside OutputDir, an unfinished download of the same file is
+	// resumed instead.
+	OutputDir string
+	// SHA256 is a digest the saved file must have, supplied by the user. It
+	// is checked whatever the server sends, since a sender that could change
+	// the file could change its checksum header too.
+	SHA256 string
+	// SHA256Sums supplies SHA256 by the name of the file, when SHA256 is
+	// empty. A file it doesn't list is refused before downloading.
+	SHA256Sums SHA256Sums
+	// KeepOnMismatch leaves a file that failed verification in place
+	// instead of deleting it
+	KeepOnMismatch bool
 }
 
 // NewDownloader creates a new Downloader with the given HTTP client
@@ -34,6 +65,12 @@ func NewDownloader(client *http.Client) *Downloader {
 	return &Downloader{client: client}
 }
 
+// SetBasicAuth makes every request carry HTTP Basic credentials, for servers
+// started with --basic-auth
+func (d *Downloader) SetBasicAuth(user, password string) {
+	d.client = withBasicAuth(d.client, user, password)
+}
+
 // readCloserAdapter adapts an io.Reader and a close func to an io.ReadCloser
 type readCloserAdapter struct {
 	r io.Reader
@@ -49,45 +86,77 @@ func (a *readCloserAdapter) Close() error {
 	return nil
 }
 
-// Receive downloads from url to outputPath. If outputPath is empty, derive from headers or URL.
+// teeBody is a response body whose reads are copied elsewhere
+type teeBody struct {
+	io.Reader
+	io.Closer
+}
+
+// firstByteBody is a response body that records when its first byte arrived
+type firstByteBody struct {
+	io.ReadCloser
+	at time.Time
+}
+
+func (b *firstByteBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 && b.at.IsZero() {
+		b.at = time.Now()
+	}
+	return n, err
+}
+
+// Receive downloads from url to outputPath. If outputPath is empty, derive from headers or URL,
+// picking a free " (n)" name when that one is taken; an outputPath that is a directory gets the
+// derived name inside it. Missing parent directories are created.
 // For text content (Content-Type: text/plain), outputs to stdout instead of saving to a file.
 // Supports resumable downloads via HTTP Range headers if the file already partially exists.
 func (d *Downloader) Receive(url string, outputPath string, force bool, progress io.Writer, key []byte) (string, error) {
 	// First, make a HEAD request or GET to determine filename and check for existing partial file
 	var startByte int64 = 0
 
-	// Try initial request to get headers
-	resp, err := d.client.Get(url)
+	// Try initial request to get headers. The time to first byte counts from
+	// when it was sent, past any wait on a busy server: the sender may hash
+	// the file before answering.
+	resp, requested, err := d.getTimedWithBusyRetry(url, "", progress)
 	if err != nil {
 		return "", fmt.Errorf("connection failed: %w\n\nPossible solutions:\n  • Check if the server is running\n  • Verify the URL is correct\n  • Make sure you're on the same network\n  • Try: warp search (to find available servers)", err)
 	}
 
+	transferID := resp.Header.Get(protocol.TransferIDHeader)
+
 	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		statusErr := statusError(resp)
 		_ = resp.Body.Close()
+		if resp.StatusCode == http.StatusUnauthorized {
+			return "", fmt.Errorf("authentication required (HTTP 401)%s\n\nTip: Pass the credentials the sender chose with --user and --password", transferSuffix(transferID))
+		}
+		if resp.StatusCode == http.StatusConflict {
+			return "", fmt.Errorf("%w%s", ErrSourceChanged, transferSuffix(transferID))
+		}
 		if resp.StatusCode == 404 {
-			return "", fmt.Errorf("file not found (HTTP 404)\n\nPossible solutions:\n  • The file may have expired\n  • Check if the URL is correct\n  • Try: warp search (to find available servers)")
+			return "", fmt.Errorf("file not found (HTTP 404)%s\n\nPossible solutions:\n  • The file may have expired\n  • Check if the URL is correct\n  • Try: warp search (to find available servers)", transferSuffix(transferID))
 		}
-		return "", fmt.Errorf("server returned error: HTTP %d\n\nTip: Check if the server is still running", resp.StatusCode)
+		return "", receiveError(statusErr, transferID)
+	}
+	warnClockSkew(progress, resp.Header, time.Now())
+	if resp.Header.Get(protocol.FollowHeader) != "" {
+		// It never ends, so it can't be saved and verified like a file
+		_ = resp.Body.Close()
+		return "", fmt.Errorf("%w%s", ErrFollowed, transferSuffix(transferID))
+	}
+	// Before anything is written: a key must meet an encrypted stream, and an
+	// encrypted stream a key
+	if err := d.checkEncryption(resp, key); err != nil {
+		_ = resp.Body.Close()
+		return "", err
 	}
 
 	// Handle Content-Encoding (zstd/gzip) before decryption
-	var bodyReader io.ReadCloser = resp.Body
-	enc := strings.ToLower(resp.Header.Get("Content-Encoding"))
-	if enc == "zstd" {
-		zr, err := zstd.NewReader(resp.Body)
-		if err != nil {
-			_ = resp.Body.Close()
-			return "", fmt.Errorf("failed to create zstd reader: %w", err)
-		}
-		// zstd.Decoder Close() signature doesn't match io.ReadCloser, adapt it
-		bodyReader = &readCloserAdapter{r: zr, c: zr.Close}
-	} else if enc == "gzip" {
-		gr, err := gzip.NewReader(resp.Body)
-		if err != nil {
-			_ = resp.Body.Close()
-			return "", fmt.Errorf("failed to create gzip reader: %w", err)
-		}
-		bodyReader = gr
+	bodyReader, err := decodeBody(resp)
+	if err != nil {
+		_ = resp.Body.Close()
+		return "", err
 	}
 
 	if key != nil {
@@ -105,12 +174,21 @@ func (d *Downloader) Receive(url string, outputPath string, force bool, progress
 	isTextContent := strings.HasPrefix(contentType, "text/plain") && disposition == ""
 
 	if isTextContent {
+		if d.SHA256 == "" && d.SHA256Sums != nil {
+			_ = bodyReader.Close()
+			return "", fmt.Errorf("the share is text, with no file name to look up in the checksum list")
+		}
 		// Output text to stdout
-		_, err := io.Copy(os.Stdout, bodyReader)
+		hash := sha256.New()
+		_, err := io.Copy(io.MultiWriter(os.Stdout, hash), bodyReader)
 		_ = bodyReader.Close()
 		if err != nil {
 			return "", fmt.Errorf("failed to output text to stdout: %w", err)
 		}
+		if actual := hex.EncodeToString(hash.Sum(nil)); d.SHA256 != "" && actual != d.SHA256 {
+			metrics.ChecksumVerifications.WithLabelValues("mismatch").Inc()
+			return "", fmt.Errorf("%w%s: expected %s (supplied), got %s", ErrChecksumMismatch, transferSuffix(transferID), d.SHA256[:16]+"...", actual[:16]+"...")
+		}
 		return "(stdout)", nil
 	}
 
@@ -121,62 +199,104 @@ func (d *Downloader) Receive(url string, outputPath string, force bool, progress
 			name = "download.bin"
 		}
 	}
-	if outputPath == "" {
-		outputPath = name
+	// A path the user gave is used as given; one derived from the share's
+	// name moves aside for files already there
+	derived := outputPath == ""
+	if derived {
+		outputPath = filepath.Join(d.OutputDir, safeBaseName(name))
+	} else if fi, err := os.Stat(outputPath); err == nil && fi.IsDir() {
+		outputPath = filepath.Join(outputPath, safeBaseName(name))
+	}
+
+	wantChecksum := d.SHA256
+	if wantChecksum == "" && d.SHA256Sums != nil {
+		var ok bool
+		if wantChecksum, ok = d.SHA256Sums.Lookup(name); !ok {
+			_ = resp.Body.Close()
+			return "", fmt.Errorf("no checksum listed for %s", name)
+		}
 	}
 
 	totalSize := resp.ContentLength
+	canResume := acceptsRanges(resp.Header)
 	_ = resp.Body.Close()
 
 	// Display download header
 	if progress != nil {
-		sizeStr := formatSize(totalSize)
+		sizeStr := ui.FormatBytes(totalSize)
 		_, _ = fmt.Fprintf(progress, "Downloading: %s (%s)\n", name, sizeStr)
 	}
 
 	// Check if file already exists and can be resumed
 	var f *os.File
+	existing := int64(-1)
 	if fi, err := os.Stat(outputPath); err == nil {
-		if !force && fi.Size() > 0 && fi.Size() < totalSize {
-			// File exists and is incomplete - try to resume
-			startByte = fi.Size()
-			f, err = os.OpenFile(outputPath, os.O_WRONLY|os.O_APPEND, 0o600)
-			if err != nil {
-				return "", fmt.Errorf("failed to open file for resume: %w", err)
-			}
-		} else if !force {
-			return "", fmt.Errorf("%s⚠️  File '%s' already exists%s\n\nUse --force or -f to overwrite", ui.Colors.Yellow, outputPath, ui.Colors.Reset)
-		} else {
-			// Force overwrite
-			f, err = os.Create(outputPath)
-			if err != nil {
-				return "", fmt.Errorf("failed to create file: %w", err)
+		existing = fi.Size()
+	}
+	action := decideResume(existing, totalSize, canResume, force)
+	if derived && existing >= 0 && !force && (d.OutputDir != "" || !resumable(outputPath, action)) {
+		taken := outputPath
+		outputPath = naming.Unique(filepath.Dir(taken), filepath.Base(taken))
+		existing, action = -1, resumeCreate
+		if progress != nil {
+			_, _ = fmt.Fprintf(progress, "%s already exists, saving as %s\n", filepath.Base(taken), filepath.Base(outputPath))
+		}
+	}
+	restartNotice := "server does not support resume — restarting download"
+	if action == resumeRange {
+		// Appending to a partial copy of a file that has since changed would
+		// only fail the checksum at the very end
+		reason, err := d.stalePartial(url, outputPath, existing, totalSize, resp.Header)
+		if err != nil {
+			return "", fmt.Errorf("failed to check partial file: %w", err)
+		}
+		if reason != "" {
+			action = resumeRestart
+			restartNotice = fmt.Sprintf("partial file no longer matches the server's copy (%s) — restarting download", reason)
+		}
+	}
+	switch action {
+	case resumeRange:
+		// File exists and is incomplete - try to resume
+		startByte = existing
+		f, err = os.OpenFile(outputPath, os.O_WRONLY|os.O_APPEND, 0o600)
+		if err != nil {
+			return "", fmt.Errorf("failed to open file for resume: %w", err)
+		}
+	case resumeRefuse:
+		return "", fmt.Errorf("%s⚠️  File '%s' already exists%s\n\nUse --force or -f to overwrite", ui.Colors.Yellow, outputPath, ui.Colors.Reset)
+	default:
+		if action == resumeRestart && progress != nil {
+			_, _ = fmt.Fprintln(progress, restartNotice)
+		}
+		if dir := filepath.Dir(outputPath); dir != "." {
+			if err := os.MkdirAll(dir, 0o755); err != nil {
+				return "", fmt.Errorf("failed to create directory: %w", err)
 			}
 		}
-	} else {
-		// File doesn't exist - create new
 		f, err = os.Create(outputPath)
 		if err != nil {
 			return "", fmt.Errorf("failed to create file: %w", err)
 		}
 	}
 	defer func() { _ = f.Close() }()
+	if !canResume {
+		removeResumeSidecar(outputPath)
+	} else if startByte == 0 {
+		// Lets a later resume tell whether the server still has this file
+		_ = writeResumeSidecar(outputPath, resp.Header, totalSize)
+	}
 
 	// Make the actual download request with Range header if resuming
 	var downloadResp *http.Response
 	if startByte > 0 {
-		req, err := http.NewRequest("GET", url, nil)
-		if err != nil {
-			return "", fmt.Errorf("failed to create request: %w", err)
-		}
-		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", startByte))
-		downloadResp, err = d.client.Do(req)
+		downloadResp, err = d.getWithBusyRetry(url, fmt.Sprintf("bytes=%d-", startByte), progress)
 		if err != nil {
 			return "", fmt.Errorf("failed to execute resume request: %w", err)
 		}
 
 		if downloadResp.StatusCode != http.StatusPartialContent {
-			// Server doesn't support resume, start over
+			// Advertised ranges but ignored this one, start over
 			_ = f.Close()
 			f, err = os.Create(outputPath)
 			if err != nil {
@@ -186,22 +306,52 @@ func (d *Downloader) Receive(url string, outputPath string, force bool, progress
 			defer func() { _ = f.Close() }()
 			startByte = 0
 			_ = downloadResp.Body.Close()
-			downloadResp, err = d.client.Get(url)
+			downloadResp, err = d.getWithBusyRetry(url, "", progress)
 			if err != nil {
 				return "", fmt.Errorf("failed to restart download: %w", err)
 			}
 		}
 	} else {
-		downloadResp, err = d.client.Get(url)
+		downloadResp, err = d.getWithBusyRetry(url, "", progress)
 		if err != nil {
 			return "", fmt.Errorf("failed to start download: %w", err)
 		}
 	}
 	defer func() { _ = downloadResp.Body.Close() }()
+	if id := downloadResp.Header.Get(protocol.TransferIDHeader); id != "" {
+		transferID = id
+	}
+	if downloadResp.StatusCode == http.StatusConflict {
+		return "", fmt.Errorf("%w%s", ErrSourceChanged, transferSuffix(transferID))
+	}
+	if downloadResp.StatusCode != http.StatusOK && downloadResp.StatusCode != http.StatusPartialContent {
+		return "", receiveError(statusError(downloadResp), transferID)
+	}
+	if err := encryptionMismatch(downloadResp.Header, key); err != nil {
+		return "", encryptionError(err, transferID)
+	}
+
+	// Directory zips are generated on the fly, so their checksum comes as a
+	// trailer over the body as sent, before it is decoded
+	var wireHash hash.Hash
+	if _, ok := downloadResp.Trailer[http.CanonicalHeaderKey(protocol.ContentSHA256Header)]; ok && downloadResp.Header.Get(protocol.ContentSHA256Header) == "" {
+		wireHash = sha256.New()
+		downloadResp.Body = teeBody{io.TeeReader(downloadResp.Body, wireHash), downloadResp.Body}
+	}
+
+	firstByte := &firstByteBody{ReadCloser: downloadResp.Body}
+	downloadResp.Body = firstByte
 
-	var src io.Reader = downloadResp.Body
+	// Directory zips arrive zstd/gzip-encoded; store the zip itself
+	body, err := decodeBody(downloadResp)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = body.Close() }()
+
+	var src io.Reader = body
 	if key != nil {
-		dr, err := crypto.NewDecryptReader(downloadResp.Body, key)
+		dr, err := crypto.NewDecryptReader(body, key)
 		if err != nil {
 			return "", fmt.Errorf("failed to create decrypt reader: %w", err)
 		}
@@ -209,79 +359,178 @@ func (d *Downloader) Receive(url string, outputPath string, force bool, progress
 	}
 
 	var startTime time.Time
-	if progress != nil {
-		// Use the improved progress reader with ETA calculation
+	renderer := d.renderer(progress)
+	if renderer != nil {
 		startTime = time.Now()
 		src = &ui.ProgressReader{
 			R:         src,
 			Total:     totalSize,
 			Current:   startByte,
-			Out:       progress,
+			Renderer:  renderer,
+			Name:      name,
 			StartTime: startTime,
 		}
+		renderer.Start(ui.TransferState{Name: name, Current: startByte, Total: totalSize})
 	}
 
-	// Use adaptive buffer sizing based on file size
+	// The body comes through the client transport's buffered reader, which
+	// has no path to the file that skips user space, and every byte is
+	// hashed on the way anyway, so copy through a buffer sized for the file
 	bufferSize := protocol.GetOptimalBufferSize(totalSize)
 	buf := make([]byte, bufferSize)
 
-	// Compute checksum while downloading
+	// Compute checksum while downloading. A 206 carries no checksum, so a
+	// resumed file is checked against the one from the first response, with
+	// the bytes already on disk hashed first.
 	hash := sha256.New()
+	expectedChecksum := downloadResp.Header.Get(protocol.ContentSHA256Header)
+	if expectedChecksum == "" && startByte > 0 {
+		expectedChecksum = resp.Header.Get(protocol.ContentSHA256Header)
+	}
+	if startByte > 0 && (expectedChecksum != "" || wantChecksum != "") {
+		if err := hashPrefix(hash, outputPath, startByte); err != nil {
+			return "", err
+		}
+	}
 	teeReader := io.TeeReader(src, hash)
 
 	if _, err := io.CopyBuffer(f, teeReader, buf); err != nil {
-		return "", fmt.Errorf("failed to write file data: %w", err)
+		// The body stopped short of its Content-Length: the server cuts it off
+		// when the file shrinks or vanishes under it
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return "", fmt.Errorf("%w%s", ErrSourceChanged, transferSuffix(transferID))
+		}
+		return "", fmt.Errorf("failed to write file data%s: %w", transferSuffix(transferID), err)
 	}
 
-	// Print completion message
-	if progress != nil {
-		_, _ = fmt.Fprintf(progress, "\n%s✓ Download complete%s\n", ui.Colors.Green, ui.Colors.Reset)
+	actualChecksum := hex.EncodeToString(hash.Sum(nil))
+	// The user's checksum is of the file as saved, not as sent
+	if wantChecksum != "" && actualChecksum != wantChecksum {
+		metrics.ChecksumVerifications.WithLabelValues("mismatch").Inc()
+		return "", d.rejectFile(outputPath, fmt.Errorf("%w%s: expected %s (supplied), got %s", ErrChecksumMismatch, transferSuffix(transferID), wantChecksum[:16]+"...", actualChecksum[:16]+"..."))
+	}
+	if wireHash != nil {
+		// Trailers are only filled in once the body has been read to the end,
+		// past whatever the decoder left unread. None arrives when something
+		// on the way drops trailers, and then there's nothing to check.
+		if _, err := io.Copy(io.Discard, downloadResp.Body); err != nil {
+			return "", fmt.Errorf("failed to read download%s: %w", transferSuffix(transferID), err)
+		}
+		expectedChecksum = downloadResp.Trailer.Get(protocol.ContentSHA256Header)
+		actualChecksum = hex.EncodeToString(wireHash.Sum(nil))
 	}
 
 	// Verify checksum if server provided one
-	expectedChecksum := downloadResp.Header.Get("X-Content-SHA256")
 	if expectedChecksum != "" {
-		actualChecksum := hex.EncodeToString(hash.Sum(nil))
 		if actualChecksum != expectedChecksum {
 			metrics.ChecksumVerifications.WithLabelValues("mismatch").Inc()
-			_ = os.Remove(outputPath) // Delete corrupted file
-			return "", fmt.Errorf("checksum verification failed: expected %s, got %s", expectedChecksum[:16]+"...", actualChecksum[:16]+"...")
+			return "", d.rejectFile(outputPath, fmt.Errorf("%w%s: expected %s, got %s", ErrChecksumMismatch, transferSuffix(transferID), expectedChecksum[:16]+"...", actualChecksum[:16]+"..."))
 		}
 		metrics.ChecksumVerifications.WithLabelValues("match").Inc()
-		if progress != nil {
-			_, _ = fmt.Fprintf(progress, "%s✓ Checksum verified%s\n", ui.Colors.Green, ui.Colors.Reset)
-		}
+	} else if wantChecksum != "" {
+		metrics.ChecksumVerifications.WithLabelValues("match").Inc()
 	}
 
-	// Print saved location
-	if progress != nil {
-		_, _ = fmt.Fprintf(progress, "\n%s━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━%s\n", ui.Colors.Dim, ui.Colors.Reset)
-		_, _ = fmt.Fprintf(progress, "%s✓ Transfer Complete%s\n\n", ui.Colors.Green, ui.Colors.Reset)
-		_, _ = fmt.Fprintf(progress, "%sSummary:%s\n", ui.Colors.Dim, ui.Colors.Reset)
-		_, _ = fmt.Fprintf(progress, "  File:         %s\n", outputPath)
-		_, _ = fmt.Fprintf(progress, "  Size:         %s\n", formatSize(totalSize))
-
-		// Calculate transfer stats
-		if !startTime.IsZero() {
-			elapsed := time.Since(startTime)
-			if elapsed.Seconds() > 0 {
-				avgSpeed := float64(totalSize) / elapsed.Seconds()
-				speedStr := ui.FormatSpeed(avgSpeed)
-				_, _ = fmt.Fprintf(progress, "  Time:         %.1fs\n", elapsed.Seconds())
-				_, _ = fmt.Fprintf(progress, "  Avg Speed:    %s\n", speedStr)
-			}
-		}
+	removeResumeSidecar(outputPath)
+
+	var attrErr error
+	if d.Preserve {
+		attrErr = protocol.FileAttrsFromHeader(downloadResp.Header).Apply(outputPath)
+	}
 
-		_, _ = fmt.Fprintf(progress, "  Saved to:     %s\n", outputPath)
-		if expectedChecksum != "" {
-			_, _ = fmt.Fprintf(progress, "  Checksum:     %sVerified%s\n", ui.Colors.Green, ui.Colors.Reset)
+	if renderer != nil {
+		summary := ui.Summary{Title: "Transfer Complete", Fields: []ui.Field{
+			{Label: "File", Value: outputPath},
+			{Label: "Size", Value: ui.FormatBytes(totalSize)},
+		}}
+		if elapsed := time.Since(startTime); elapsed > 0 {
+			summary.Fields = append(summary.Fields,
+				ui.Field{Label: "Time", Value: fmt.Sprintf("%.1fs", elapsed.Seconds())},
+				ui.Field{Label: "Avg Speed", Value: ui.FormatSpeed(float64(totalSize) / elapsed.Seconds())})
+		}
+		var slowStart bool
+		if !firstByte.at.IsZero() {
+			ttfb, transfer := firstByte.at.Sub(requested), time.Since(firstByte.at)
+			summary.Fields = append(summary.Fields, ui.Field{Label: "Timing", Value: ui.FormatTiming(ttfb, transfer)})
+			slowStart = ui.SlowStart(ttfb, transfer)
+		}
+		summary.Fields = append(summary.Fields, ui.Field{Label: "Saved to", Value: outputPath})
+		if transferID != "" {
+			summary.Fields = append(summary.Fields, ui.Field{Label: "Transfer ID", Value: transferID})
+		}
+		switch {
+		case wantChecksum != "":
+			summary.Fields = append(summary.Fields, ui.Field{Label: "Checksum", Value: "Verified (supplied)"})
+		case expectedChecksum != "":
+			summary.Fields = append(summary.Fields, ui.Field{Label: "Checksum", Value: "Verified"})
 		}
-		_, _ = fmt.Fprintf(progress, "%s━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━%s\n", ui.Colors.Dim, ui.Colors.Reset)
+		if slowStart {
+			summary.Fields = append(summary.Fields, ui.Field{Label: "Hint", Value: i18n.T("hint.precompute")})
+		}
+		renderer.Finish(summary)
+	}
+	if attrErr != nil && progress != nil {
+		_, _ = fmt.Fprintf(progress, "%s! Could not preserve file attributes: %v%s\n", ui.Colors.Yellow, attrErr, ui.Colors.Reset)
 	}
 
 	return outputPath, nil
 }
 
+// rejectFile deletes a download that failed verification, unless
+// KeepOnMismatch is set, and returns err saying which it did
+func (d *Downloader) rejectFile(outputPath string, err error) error {
+	removeResumeSidecar(outputPath)
+	if d.KeepOnMismatch {
+		return fmt.Errorf("%w; file kept at %s", err, outputPath)
+	}
+	_ = os.Remove(outputPath) // Delete corrupted file
+	return err
+}
+
+// hashPrefix feeds the first n bytes of the file at path to h
+func hashPrefix(h io.Writer, path string, n int64) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to read partial file: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+	if _, err := io.CopyN(h, f, n); err != nil {
+		return fmt.Errorf("failed to read partial file: %w", err)
+	}
+	return nil
+}
+
+// decodeBody undoes the response's Content-Encoding (zstd or gzip)
+func decodeBody(resp *http.Response) (io.ReadCloser, error) {
+	switch strings.ToLower(resp.Header.Get("Content-Encoding")) {
+	case "zstd":
+		zr, err := zstd.NewReader(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create zstd reader: %w", err)
+		}
+		// zstd.Decoder Close() signature doesn't match io.ReadCloser, adapt it
+		return &readCloserAdapter{r: zr, c: zr.Close}, nil
+	case "gzip":
+		gr, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create gzip reader: %w", err)
+		}
+		return gr, nil
+	}
+	return resp.Body, nil
+}
+
+// renderer returns the configured renderer, or picks one for progress
+func (d *Downloader) renderer(progress io.Writer) ui.Renderer {
+	if d.Renderer != nil {
+		return d.Renderer
+	}
+	if progress == nil {
+		return nil
+	}
+	return ui.NewRenderer(progress, false)
+}
+
 // Package-level Receive function for backward compatibility
 // Uses default HTTP client with optimized settings
 var defaultDownloader = NewDownloader(nil)
@@ -311,21 +560,20 @@ func filenameFromResponse(resp *http.Response) string {
 	return ""
 }
 
-// formatSize formats bytes into a human-readable string with appropriate units
-func formatSize(bytes int64) string {
-	const unit = 1024
-	if bytes < unit {
-		return fmt.Sprintf("%d B", bytes)
+// safeBaseName reduces a sender-supplied name to a plain file name
+func safeBaseName(name string) string {
+	name = filepath.Base(filepath.Clean("/" + strings.ReplaceAll(name, "\\", "/")))
+	if name == "/" || name == "." || name == ".." {
+		return "download.bin"
 	}
+	return name
+}
 
-	div := int64(unit)
-	exp := 0
-	units := []string{"KB", "MB", "GB", "TB"}
-
-	for bytes >= div*unit && exp < len(units)-1 {
-		div *= unit
-		exp++
+// transferSuffix formats a transfer ID for inclusion in error messages so a
+// failure can be matched with the sender's log lines
+func transferSuffix(id string) string {
+	if id == "" {
+		return ""
 	}
-
-	return fmt.Sprintf("%.1f %s", float64(bytes)/float64(div), units[exp])
+	return fmt.Sprintf(" (transfer %s)", id)
 }
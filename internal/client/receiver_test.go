@@ -1,11 +1,24 @@
 package client
 
 import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/zulfikawr/warp/internal/protocol"
+	"github.com/zulfikawr/warp/internal/ui"
 )
 
 func TestReceiveCreatesFile(t *testing.T) {
@@ -29,3 +42,461 @@ func TestReceiveCreatesFile(t *testing.T) {
 		t.Fatalf("content = %q, want %q", string(b), "data")
 	}
 }
+
+func TestReceiveSavesInlineTextAsFile(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("Content-Disposition", "inline; filename=\"notes.txt\"")
+		_, _ = w.Write([]byte("data"))
+	}))
+	defer ts.Close()
+
+	out, err := Receive(ts.URL, "", true, io.Discard, nil)
+	if err != nil {
+		t.Fatalf("Receive error: %v", err)
+	}
+	defer func() { _ = os.Remove(out) }()
+	if filepath.Base(out) != "notes.txt" {
+		t.Fatalf("saved as %q, want notes.txt", out)
+	}
+	if b, err := os.ReadFile(out); err != nil || string(b) != "data" {
+		t.Fatalf("content = %q (%v), want %q", b, err, "data")
+	}
+}
+
+func TestReceiveSendsUserAgent(t *testing.T) {
+	var gotUA, gotVersion string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotUA = r.Header.Get("User-Agent")
+		gotVersion = r.Header.Get(protocol.VersionHeader)
+		w.Header().Set("Content-Disposition", "attachment; filename=\"ua.txt\"")
+		_, _ = w.Write([]byte("data"))
+	}))
+	defer ts.Close()
+
+	out, err := Receive(ts.URL, filepath.Join(t.TempDir(), "ua.txt"), true, io.Discard, nil)
+	if err != nil {
+		t.Fatalf("Receive error: %v", err)
+	}
+	_ = os.Remove(out)
+
+	if gotUA != protocol.UserAgent() {
+		t.Errorf("User-Agent = %q, want %q", gotUA, protocol.UserAgent())
+	}
+	if !strings.HasPrefix(gotUA, "warp/"+protocol.Version+" (") {
+		t.Errorf("User-Agent %q has unexpected format", gotUA)
+	}
+	if gotVersion != protocol.Version {
+		t.Errorf("%s = %q, want %q", protocol.VersionHeader, gotVersion, protocol.Version)
+	}
+}
+
+func TestReceiveRetriesWhenBusy(t *testing.T) {
+	var calls int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "server busy", http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Disposition", "attachment; filename=\"busy.txt\"")
+		_, _ = w.Write([]byte("data"))
+	}))
+	defer ts.Close()
+
+	var progress strings.Builder
+	out, err := Receive(ts.URL, filepath.Join(t.TempDir(), "busy.txt"), true, &progress, nil)
+	if err != nil {
+		t.Fatalf("Receive error: %v", err)
+	}
+	got, _ := os.ReadFile(out)
+	if string(got) != "data" {
+		t.Errorf("content = %q, want %q", got, "data")
+	}
+	if !strings.Contains(progress.String(), "Server busy") {
+		t.Error("expected busy notice in progress output")
+	}
+}
+
+func TestBusyWaitIsNotTimed(t *testing.T) {
+	var calls int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "server busy", http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte("data"))
+	}))
+	defer ts.Close()
+
+	start := time.Now()
+	resp, sent, err := NewDownloader(ts.Client()).getTimedWithBusyRetry(ts.URL, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	// The request that got the file went out after the Retry-After wait
+	if waited := sent.Sub(start); waited < time.Second {
+		t.Errorf("request timed from %v after the start, want after the 1s wait", waited)
+	}
+}
+
+func TestReceiveWithBasicAuth(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "guest" || pass != "pw" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="warp"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Disposition", "attachment; filename=\"auth.txt\"")
+		_, _ = w.Write([]byte("data"))
+	}))
+	defer ts.Close()
+	out := filepath.Join(t.TempDir(), "auth.txt")
+
+	d := NewDownloader(nil)
+	if _, err := d.Receive(ts.URL, out, true, io.Discard, nil); err == nil || !strings.Contains(err.Error(), "HTTP 401") {
+		t.Fatalf("want 401 error without credentials, got %v", err)
+	}
+
+	d.SetBasicAuth("guest", "pw")
+	if _, err := d.Receive(ts.URL, out, true, io.Discard, nil); err != nil {
+		t.Fatalf("Receive with credentials: %v", err)
+	}
+	if b, _ := os.ReadFile(out); string(b) != "data" {
+		t.Fatalf("content = %q", b)
+	}
+}
+
+func TestReceiveShortBodyReportsSourceChanged(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Disposition", "attachment; filename=\"short.bin\"")
+		w.Header().Set("Content-Length", "100")
+		_, _ = w.Write(make([]byte, 40))
+	}))
+	defer ts.Close()
+
+	_, err := Receive(ts.URL, filepath.Join(t.TempDir(), "short.bin"), true, io.Discard, nil)
+	if !errors.Is(err, ErrSourceChanged) {
+		t.Fatalf("Receive error = %v, want ErrSourceChanged", err)
+	}
+}
+
+func TestReceiveConflictReportsSourceChanged(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "source file changed during transfer", http.StatusConflict)
+	}))
+	defer ts.Close()
+
+	_, err := Receive(ts.URL, filepath.Join(t.TempDir(), "gone.bin"), true, io.Discard, nil)
+	if !errors.Is(err, ErrSourceChanged) {
+		t.Fatalf("Receive error = %v, want ErrSourceChanged", err)
+	}
+}
+
+func TestDecideResume(t *testing.T) {
+	tests := []struct {
+		name      string
+		existing  int64
+		total     int64
+		canResume bool
+		force     bool
+		want      resumeAction
+	}{
+		{"no file", -1, 100, true, false, resumeCreate},
+		{"force", 40, 100, true, true, resumeCreate},
+		{"partial with ranges", 40, 100, true, false, resumeRange},
+		{"partial without ranges", 40, 100, false, false, resumeRestart},
+		{"complete", 100, 100, true, false, resumeRefuse},
+		{"empty", 0, 100, true, false, resumeRefuse},
+		{"unknown size", 40, -1, true, false, resumeRefuse},
+	}
+	for _, tt := range tests {
+		if got := decideResume(tt.existing, tt.total, tt.canResume, tt.force); got != tt.want {
+			t.Errorf("%s: decideResume = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestReceiveResumeFollowsAcceptRanges(t *testing.T) {
+	data := []byte(strings.Repeat("0123456789", 10))
+	for _, ranges := range []bool{true, false} {
+		var gotRange []string
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			gotRange = append(gotRange, r.Header.Get("Range"))
+			w.Header().Set("Content-Disposition", "attachment; filename=\"data.bin\"")
+			if !ranges {
+				_, _ = w.Write(data)
+				return
+			}
+			w.Header().Set("Accept-Ranges", "bytes")
+			var start int
+			if rh := r.Header.Get("Range"); rh != "" {
+				_, _ = fmt.Sscanf(rh, "bytes=%d-", &start)
+				w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, len(data)-1, len(data)))
+				w.WriteHeader(http.StatusPartialContent)
+			}
+			_, _ = w.Write(data[start:])
+		}))
+
+		out := filepath.Join(t.TempDir(), "data.bin")
+		if err := os.WriteFile(out, data[:40], 0o644); err != nil {
+			t.Fatal(err)
+		}
+		var progress strings.Builder
+		if _, err := Receive(ts.URL, out, false, &progress, nil); err != nil {
+			t.Fatalf("ranges=%v: Receive error: %v", ranges, err)
+		}
+		ts.Close()
+
+		if b, _ := os.ReadFile(out); string(b) != string(data) {
+			t.Errorf("ranges=%v: content = %q", ranges, b)
+		}
+		restarted := strings.Contains(progress.String(), "server does not support resume")
+		if restarted == ranges {
+			t.Errorf("ranges=%v: restart notice printed = %v", ranges, restarted)
+		}
+		// Without a sidecar the partial file's prefix is checked first
+		want := []string{"", "bytes=0-39", "bytes=40-"}
+		if !ranges {
+			want = []string{"", ""}
+		}
+		if strings.Join(gotRange, ",") != strings.Join(want, ",") {
+			t.Errorf("ranges=%v: Range headers = %q, want %q", ranges, gotRange, want)
+		}
+	}
+}
+
+func TestReceiveEmptyFile(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Disposition", "attachment; filename=\"empty.txt\"")
+		w.Header().Set(protocol.ContentSHA256Header, "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855")
+		w.Header().Set("Content-Length", "0")
+	}))
+	defer ts.Close()
+
+	out, err := Receive(ts.URL, filepath.Join(t.TempDir(), "empty.txt"), true, io.Discard, nil)
+	if err != nil {
+		t.Fatalf("Receive error: %v", err)
+	}
+	fi, err := os.Stat(out)
+	if err != nil {
+		t.Fatalf("empty file not created: %v", err)
+	}
+	if fi.Size() != 0 {
+		t.Errorf("size = %d, want 0", fi.Size())
+	}
+}
+
+// zipWithTrailer serves body gzip-encoded the way a warp server sends a
+// directory zip, with the checksum of the encoded bytes in a trailer
+func zipWithTrailer(body []byte) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", "attachment; filename=\"folder.zip\"")
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Header().Set("Trailer", protocol.ContentSHA256Header)
+		sum := sha256.New()
+		gz := gzip.NewWriter(io.MultiWriter(w, sum))
+		_, _ = gz.Write(body)
+		_ = gz.Close()
+		w.Header().Set(protocol.ContentSHA256Header, hex.EncodeToString(sum.Sum(nil)))
+	}
+}
+
+// manglingProxy forwards to upstream, passing mangle the raw body and
+// copying trailers only when keepTrailers is set
+func manglingProxy(t *testing.T, upstream string, mangle func([]byte), keepTrailers bool) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req, _ := http.NewRequest(r.Method, upstream+r.URL.Path, nil)
+		req.Header.Set("Accept-Encoding", r.Header.Get("Accept-Encoding"))
+		resp, err := http.DefaultTransport.RoundTrip(req)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer func() { _ = resp.Body.Close() }()
+		body, _ := io.ReadAll(resp.Body)
+		mangle(body)
+		for k, v := range resp.Header {
+			w.Header()[k] = v
+		}
+		if keepTrailers {
+			for k := range resp.Trailer {
+				w.Header().Add("Trailer", k)
+			}
+		}
+		_, _ = w.Write(body)
+		if keepTrailers {
+			for k, v := range resp.Trailer {
+				w.Header()[k] = v
+			}
+		}
+	}))
+}
+
+func TestReceiveVerifiesChecksumTrailer(t *testing.T) {
+	content := bytes.Repeat([]byte("PK zip entries "), 4096)
+	upstream := httptest.NewServer(zipWithTrailer(content))
+	defer upstream.Close()
+
+	tests := []struct {
+		name         string
+		keepTrailers bool
+	}{
+		{"trailer verified", true},
+		{"trailers dropped on the way", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proxy := manglingProxy(t, upstream.URL, func([]byte) {}, tt.keepTrailers)
+			defer proxy.Close()
+
+			var progress bytes.Buffer
+			out := filepath.Join(t.TempDir(), "folder.zip")
+			_, err := NewDownloader(nil).Receive(proxy.URL+"/d/token", out, true, &progress, nil)
+			if err != nil {
+				t.Fatalf("Receive error: %v", err)
+			}
+			if got, _ := os.ReadFile(out); !bytes.Equal(got, content) {
+				t.Errorf("saved %d bytes, want the decoded %d", len(got), len(content))
+			}
+			verified := strings.Contains(progress.String(), "Verified")
+			if verified != tt.keepTrailers {
+				t.Errorf("checksum reported verified = %v, want %v", verified, tt.keepTrailers)
+			}
+		})
+	}
+}
+
+func TestReceiveChecksumTrailerMismatch(t *testing.T) {
+	content := bytes.Repeat([]byte{0xa5}, 64<<10)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Disposition", "attachment; filename=\"folder.zip\"")
+		w.Header().Set("Trailer", protocol.ContentSHA256Header)
+		sum := sha256.Sum256(content)
+		_, _ = w.Write(content)
+		w.Header().Set(protocol.ContentSHA256Header, hex.EncodeToString(sum[:]))
+	}))
+	defer upstream.Close()
+	// No outer encoding, so only the trailer can tell
+	proxy := manglingProxy(t, upstream.URL, func(b []byte) { b[1000] ^= 0xff }, true)
+	defer proxy.Close()
+
+	out := filepath.Join(t.TempDir(), "folder.zip")
+	_, err := NewDownloader(nil).Receive(proxy.URL+"/d/token", out, true, io.Discard, nil)
+	if err == nil || !strings.Contains(err.Error(), "checksum verification failed") {
+		t.Fatalf("Receive error = %v, want a checksum mismatch", err)
+	}
+	if _, err := os.Stat(out); !os.IsNotExist(err) {
+		t.Error("corrupted download was kept")
+	}
+}
+
+// TestReceiveTiming answers every request late, as a sender hashing a large
+// file would, and checks that the summary puts the wait before the first byte
+// and suggests --precompute
+func TestReceiveTiming(t *testing.T) {
+	const delay = 600 * time.Millisecond
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(delay)
+		w.Header().Set("Content-Disposition", "attachment; filename=\"slow.bin\"")
+		_, _ = w.Write([]byte("data"))
+	}))
+	defer ts.Close()
+
+	out := &bytes.Buffer{}
+	d := NewDownloader(nil)
+	d.Renderer = ui.NewJSONRenderer(out)
+	path, err := d.Receive(ts.URL, filepath.Join(t.TempDir(), "slow.bin"), true, nil, nil)
+	if err != nil {
+		t.Fatalf("Receive error: %v", err)
+	}
+	if b, _ := os.ReadFile(path); string(b) != "data" {
+		t.Fatalf("content = %q", b)
+	}
+
+	var summary map[string]string
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var ev struct {
+			Event   string            `json:"event"`
+			Summary map[string]string `json:"summary"`
+		}
+		if err := json.Unmarshal([]byte(line), &ev); err == nil && ev.Event == "finish" {
+			summary = ev.Summary
+		}
+	}
+	var ttfb, transfer float64
+	if _, err := fmt.Sscanf(summary["Timing"], "TTFB %fs, transfer %fs", &ttfb, &transfer); err != nil {
+		t.Fatalf("Timing = %q: %v", summary["Timing"], err)
+	}
+	// The probe and the download request both wait
+	if ttfb < 2*delay.Seconds() || transfer >= delay.Seconds() {
+		t.Errorf("TTFB %.1fs, transfer %.1fs; want the %v waits before the first byte", ttfb, transfer, 2*delay)
+	}
+	if !strings.Contains(summary["Hint"], "--precompute") {
+		t.Errorf("Hint = %q, want --precompute suggested", summary["Hint"])
+	}
+}
+
+func TestReceiveRepeatedDownloadsNumbered(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The host already renamed this upload
+		w.Header().Set("Content-Disposition", "attachment; filename=\"report (1).pdf\"")
+		_, _ = w.Write([]byte("remote"))
+	}))
+	defer ts.Close()
+	t.Chdir(t.TempDir())
+	if err := os.WriteFile("report (1).pdf", []byte("local"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{"report (2).pdf", "report (3).pdf", "report (4).pdf"} {
+		var progress strings.Builder
+		out, err := Receive(ts.URL, "", false, &progress, nil)
+		if err != nil {
+			t.Fatalf("Receive error: %v", err)
+		}
+		if out != want {
+			t.Errorf("saved as %q, want %q", out, want)
+		}
+		if !strings.Contains(progress.String(), "saving as "+want) {
+			t.Errorf("progress doesn't name %q:\n%s", want, progress.String())
+		}
+		if b, _ := os.ReadFile(out); string(b) != "remote" {
+			t.Errorf("%s holds %q", out, b)
+		}
+	}
+	if b, _ := os.ReadFile("report (1).pdf"); string(b) != "local" {
+		t.Errorf("existing file now holds %q", b)
+	}
+}
+
+func TestReceiveExplicitOutputStaysStrict(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Disposition", "attachment; filename=\"report.pdf\"")
+		_, _ = w.Write([]byte("remote"))
+	}))
+	defer ts.Close()
+	dir := t.TempDir()
+
+	out := filepath.Join(dir, "report.pdf")
+	if err := os.WriteFile(out, []byte("longer local"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Receive(ts.URL, out, false, io.Discard, nil); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("Receive over an existing --output: %v", err)
+	}
+
+	// Missing directories are created; a directory gets the share's name
+	nested := filepath.Join(dir, "a", "b", "copy.pdf")
+	if got, err := Receive(ts.URL, nested, false, io.Discard, nil); err != nil || got != nested {
+		t.Errorf("Receive(%s) = %q, %v", nested, got, err)
+	}
+	if got, err := Receive(ts.URL, filepath.Join(dir, "a"), false, io.Discard, nil); err != nil || got != filepath.Join(dir, "a", "report.pdf") {
+		t.Errorf("Receive into a directory = %q, %v", got, err)
+	}
+}
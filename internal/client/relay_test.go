@@ -0,0 +1,151 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/zulfikawr/warp/internal/crypto"
+	"github.com/zulfikawr/warp/internal/protocol"
+	"github.com/zulfikawr/warp/internal/relay"
+	"github.com/zulfikawr/warp/internal/server"
+	"github.com/zulfikawr/warp/internal/ui"
+)
+
+// TestReceiveThroughRelay pairs a sender and a receiver through an
+// in-process relay and checks the file arrives decrypted and intact
+func TestReceiveThroughRelay(t *testing.T) {
+	rl, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs := &relay.Server{}
+	go func() { _ = rs.Serve(rl) }()
+	defer rs.Close()
+	relayAddr := rl.Addr().String()
+
+	content := make([]byte, 3<<20)
+	_, _ = rand.Read(content)
+	src := filepath.Join(t.TempDir(), "payload.bin")
+	if err := os.WriteFile(src, content, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tok, _ := crypto.GenerateToken(nil)
+	code, _ := crypto.GenerateCode(nil)
+	nameplate, _ := relay.NewNameplate(nil)
+	srv := &server.Server{Token: tok, PAKECode: code, SrcPath: src}
+	ln, err := relay.Listen(relayAddr, relay.Room(nameplate))
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() { _ = srv.ServeRelay(ln) }()
+	defer srv.Shutdown()
+
+	var dials atomic.Int32
+	d := NewDownloader(NewRelayClient(func(ctx context.Context) (net.Conn, error) {
+		dials.Add(1)
+		return relay.Dial(ctx, relayAddr, relay.Room(nameplate))
+	}))
+	d.Renderer = ui.NewJSONRenderer(&bytes.Buffer{})
+	base := relay.BaseURL(relayAddr)
+	key, token, err := d.PerformPAKEHandshake(base, code)
+	if err != nil {
+		t.Fatalf("PAKE through the relay: %v", err)
+	}
+	out := filepath.Join(t.TempDir(), "payload.bin")
+	path, err := d.Receive(base+protocol.PathPrefix+token, out, true, nil, key)
+	if err != nil {
+		t.Fatalf("Receive: %v", err)
+	}
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sha256.Sum256(got) != sha256.Sum256(content) {
+		t.Errorf("received %d bytes that don't match the %d sent", len(got), len(content))
+	}
+	if n := dials.Load(); n != 1 {
+		t.Errorf("dialled the relay %d times; HTTP/2 should carry every request on one connection", n)
+	}
+}
+
+// TestRelayInterceptionDetected has the "relay" terminate the receiver's TLS
+// with a certificate of its own and open a second TLS connection to the
+// sender, passing the HTTP/2 stream between them. The PAKE messages get
+// through unchanged, so only the certificate binding can give it away.
+func TestRelayInterceptionDetected(t *testing.T) {
+	rl, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs := &relay.Server{}
+	go func() { _ = rs.Serve(rl) }()
+	defer rs.Close()
+	relayAddr := rl.Addr().String()
+
+	tok, _ := crypto.GenerateToken(nil)
+	code, _ := crypto.GenerateCode(nil)
+	nameplate, _ := relay.NewNameplate(nil)
+	srv := &server.Server{Token: tok, PAKECode: code, TextContent: "secret"}
+	ln, err := relay.Listen(relayAddr, relay.Room(nameplate))
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() { _ = srv.ServeRelay(ln) }()
+	defer srv.Shutdown()
+
+	mitmCert := selfSignedCert(t)
+	d := NewDownloader(NewRelayClient(func(ctx context.Context) (net.Conn, error) {
+		upstream, err := relay.Dial(ctx, relayAddr, relay.Room(nameplate))
+		if err != nil {
+			return nil, err
+		}
+		toSender := tls.Client(upstream, &tls.Config{InsecureSkipVerify: true, NextProtos: []string{"h2"}})
+		receiverSide, mitmSide := net.Pipe()
+		toReceiver := tls.Server(mitmSide, &tls.Config{Certificates: []tls.Certificate{mitmCert}, NextProtos: []string{"h2"}})
+		go func() {
+			defer toSender.Close()
+			defer toReceiver.Close()
+			go func() { _, _ = io.Copy(toSender, toReceiver) }()
+			_, _ = io.Copy(toReceiver, toSender)
+		}()
+		return receiverSide, nil
+	}))
+	if _, _, err := d.PerformPAKEHandshake(relay.BaseURL(relayAddr), code); err == nil || !strings.Contains(err.Error(), "intercepted") {
+		t.Fatalf("PAKE through an intercepting relay: %v, want the interception detected", err)
+	}
+}
+
+// selfSignedCert makes a throwaway TLS certificate for 127.0.0.1
+func selfSignedCert(t *testing.T) tls.Certificate {
+	t.Helper()
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &priv.PublicKey, priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: priv}
+}
@@ -0,0 +1,184 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/zulfikawr/warp/internal/protocol"
+)
+
+// resumeAction is what Receive does with the file already at the output path
+type resumeAction int
+
+const (
+	resumeCreate  resumeAction = iota // nothing there, or --force
+	resumeRange                       // partial file, continue with a Range request
+	resumeRestart                     // partial file, but the server can't resume it
+	resumeRefuse                      // complete or unknown-size file without --force
+)
+
+// resumeSidecarSuffix names the file kept next to a download in progress
+const resumeSidecarSuffix = ".warp-resume"
+
+// resumePrefixSize is how much of a partial file is compared with the
+// server's copy when the sidecar can't settle whether it is still the same
+const resumePrefixSize = 64 << 10
+
+// decideResume picks the resume action for an existing file of existing
+// bytes (-1 when there is none) against a download of total bytes (-1 when
+// unknown). canResume is whether the server sent Accept-Ranges: bytes.
+func decideResume(existing, total int64, canResume, force bool) resumeAction {
+	switch {
+	case existing < 0 || force:
+		return resumeCreate
+	case existing > 0 && existing < total && canResume:
+		return resumeRange
+	case existing > 0 && existing < total:
+		return resumeRestart
+	}
+	return resumeRefuse
+}
+
+// acceptsRanges reports whether the response advertises byte-range support
+func acceptsRanges(h http.Header) bool {
+	for _, v := range strings.Split(h.Get("Accept-Ranges"), ",") {
+		if strings.EqualFold(strings.TrimSpace(v), "bytes") {
+			return true
+		}
+	}
+	return false
+}
+
+// resumeSidecar is written next to a resumable download when it starts, so a
+// later resume can tell whether the server still has the same file. It is
+// removed once the download completes.
+type resumeSidecar struct {
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256,omitempty"`
+	Mtime  string `json:"mtime,omitempty"`
+}
+
+func sidecarPath(path string) string {
+	return path + resumeSidecarSuffix
+}
+
+// writeResumeSidecar records the download described by h for path
+func writeResumeSidecar(path string, h http.Header, size int64) error {
+	data, err := json.Marshal(resumeSidecar{
+		Size:   size,
+		SHA256: h.Get(protocol.ContentSHA256Header),
+		Mtime:  h.Get(protocol.FileMtimeHeader),
+	})
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(sidecarPath(path), data, 0o600)
+}
+
+// resumable reports whether the file at path is an unfinished download that
+// action would carry on with: one this client started, with a sidecar
+func resumable(path string, action resumeAction) bool {
+	if action != resumeRange && action != resumeRestart {
+		return false
+	}
+	sc, err := readResumeSidecar(path)
+	return err == nil && sc != nil
+}
+
+// readResumeSidecar returns the sidecar of path, or nil when there is none
+func readResumeSidecar(path string) (*resumeSidecar, error) {
+	data, err := os.ReadFile(sidecarPath(path))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var sc resumeSidecar
+	if err := json.Unmarshal(data, &sc); err != nil {
+		return nil, fmt.Errorf("invalid resume sidecar: %w", err)
+	}
+	return &sc, nil
+}
+
+func removeResumeSidecar(path string) {
+	_ = os.Remove(sidecarPath(path))
+}
+
+// compare checks the sidecar against the server's current headers. It
+// returns why the partial file is stale, or "" when it isn't, and whether the
+// sidecar settled the question; a matching checksum does, a matching
+// modification time alone doesn't.
+func (sc *resumeSidecar) compare(h http.Header, size int64) (reason string, settled bool) {
+	if sc.Size != size {
+		return fmt.Sprintf("size changed from %d to %d bytes", sc.Size, size), true
+	}
+	if sum := h.Get(protocol.ContentSHA256Header); sc.SHA256 != "" && sum != "" {
+		if sum != sc.SHA256 {
+			return "checksum changed", true
+		}
+		return "", true
+	}
+	if mtime := h.Get(protocol.FileMtimeHeader); sc.Mtime != "" && mtime != "" && mtime != sc.Mtime {
+		return "modification time changed", true
+	}
+	return "", false
+}
+
+// stalePartial reports why the partial file at path, existing bytes long, no
+// longer belongs to the download described by h, or "" when it can be
+// resumed. The sidecar decides when it can; otherwise the first bytes of
+// both copies are compared.
+func (d *Downloader) stalePartial(url, path string, existing, total int64, h http.Header) (string, error) {
+	sc, err := readResumeSidecar(path)
+	if err == nil && sc != nil {
+		if reason, settled := sc.compare(h, total); settled {
+			return reason, nil
+		}
+	}
+	return d.comparePrefix(url, path, min(existing, resumePrefixSize))
+}
+
+// comparePrefix fetches the first n bytes of the remote file with a Range
+// request and compares them with the local file. Servers that ignore the
+// range send the whole file, of which only n bytes are read.
+func (d *Downloader) comparePrefix(url, path string, n int64) (string, error) {
+	local := make([]byte, n)
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	_, err = io.ReadFull(f, local)
+	_ = f.Close()
+	if err != nil {
+		return "", fmt.Errorf("failed to read partial file: %w", err)
+	}
+
+	resp, err := d.getWithBusyRetry(url, fmt.Sprintf("bytes=0-%d", n-1), nil)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		return "", fmt.Errorf("server returned error: HTTP %d", resp.StatusCode)
+	}
+	body, err := decodeBody(resp)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = body.Close() }()
+	remote := make([]byte, n)
+	if _, err := io.ReadFull(body, remote); err != nil {
+		return "the server's file is shorter", nil
+	}
+	if !bytes.Equal(local, remote) {
+		return fmt.Sprintf("first %d bytes differ", n), nil
+	}
+	return "", nil
+}
@@ -0,0 +1,174 @@
+package client
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/zulfikawr/warp/internal/protocol"
+)
+
+// rangeServer serves data with its checksum and byte ranges, recording the
+// Range header of every request
+func rangeServer(t *testing.T, data []byte, ranges *[]string) *httptest.Server {
+	t.Helper()
+	sum := sha256.Sum256(data)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*ranges = append(*ranges, r.Header.Get("Range"))
+		w.Header().Set("Content-Disposition", "attachment; filename=\"data.bin\"")
+		w.Header().Set("Accept-Ranges", "bytes")
+		start, end := 0, len(data)-1
+		if rh := r.Header.Get("Range"); rh != "" {
+			if _, err := fmt.Sscanf(rh, "bytes=%d-%d", &start, &end); err != nil {
+				_, _ = fmt.Sscanf(rh, "bytes=%d-", &start)
+			}
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(data)))
+			w.WriteHeader(http.StatusPartialContent)
+		} else {
+			w.Header().Set(protocol.ContentSHA256Header, hex.EncodeToString(sum[:]))
+		}
+		_, _ = w.Write(data[start : end+1])
+	}))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func writeSidecar(t *testing.T, out string, sc resumeSidecar) {
+	t.Helper()
+	h := http.Header{}
+	h.Set(protocol.ContentSHA256Header, sc.SHA256)
+	if err := writeResumeSidecar(out, h, sc.Size); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestResumeWithMatchingSidecar(t *testing.T) {
+	data := []byte(strings.Repeat("0123456789", 10))
+	var ranges []string
+	ts := rangeServer(t, data, &ranges)
+
+	out := filepath.Join(t.TempDir(), "data.bin")
+	if err := os.WriteFile(out, data[:40], 0o644); err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(data)
+	writeSidecar(t, out, resumeSidecar{Size: int64(len(data)), SHA256: hex.EncodeToString(sum[:])})
+
+	if _, err := Receive(ts.URL, out, false, nil, nil); err != nil {
+		t.Fatalf("Receive error: %v", err)
+	}
+	if b, _ := os.ReadFile(out); string(b) != string(data) {
+		t.Errorf("content = %q", b)
+	}
+	// The checksum settles it, no prefix request needed
+	if got := strings.Join(ranges, ","); got != ",bytes=40-" {
+		t.Errorf("Range headers = %q", ranges)
+	}
+	if _, err := os.Stat(sidecarPath(out)); !os.IsNotExist(err) {
+		t.Error("sidecar should be removed after a completed download")
+	}
+}
+
+func TestResumeRestartsOnChangedChecksum(t *testing.T) {
+	data := []byte(strings.Repeat("0123456789", 10))
+	var ranges []string
+	ts := rangeServer(t, data, &ranges)
+
+	out := filepath.Join(t.TempDir(), "data.bin")
+	// Same bytes so far, but recorded against an older version of the file
+	if err := os.WriteFile(out, data[:40], 0o644); err != nil {
+		t.Fatal(err)
+	}
+	writeSidecar(t, out, resumeSidecar{Size: int64(len(data)), SHA256: strings.Repeat("ab", 32)})
+
+	var progress strings.Builder
+	if _, err := Receive(ts.URL, out, false, &progress, nil); err != nil {
+		t.Fatalf("Receive error: %v", err)
+	}
+	if b, _ := os.ReadFile(out); string(b) != string(data) {
+		t.Errorf("content = %q", b)
+	}
+	if !strings.Contains(progress.String(), "checksum changed") {
+		t.Errorf("progress should explain the restart, got %q", progress.String())
+	}
+	if got := strings.Join(ranges, ","); got != "," {
+		t.Errorf("Range headers = %q, want a plain restart", ranges)
+	}
+}
+
+func TestResumeRestartsOnMismatchedPrefix(t *testing.T) {
+	data := []byte(strings.Repeat("0123456789", 10))
+	var ranges []string
+	ts := rangeServer(t, data, &ranges)
+
+	out := filepath.Join(t.TempDir(), "data.bin")
+	if err := os.WriteFile(out, []byte(strings.Repeat("x", 40)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var progress strings.Builder
+	if _, err := Receive(ts.URL, out, false, &progress, nil); err != nil {
+		t.Fatalf("Receive error: %v", err)
+	}
+	if b, _ := os.ReadFile(out); string(b) != string(data) {
+		t.Errorf("content = %q, want the server's file, not a mix", b)
+	}
+	if !strings.Contains(progress.String(), "no longer matches") {
+		t.Errorf("progress should explain the restart, got %q", progress.String())
+	}
+	if got := strings.Join(ranges, ","); got != ",bytes=0-39," {
+		t.Errorf("Range headers = %q", ranges)
+	}
+}
+
+func TestResumeWithoutSidecarChecksPrefix(t *testing.T) {
+	data := []byte(strings.Repeat("0123456789", 10))
+	var ranges []string
+	ts := rangeServer(t, data, &ranges)
+
+	out := filepath.Join(t.TempDir(), "data.bin")
+	if err := os.WriteFile(out, data[:40], 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Receive(ts.URL, out, false, nil, nil); err != nil {
+		t.Fatalf("Receive error: %v", err)
+	}
+	if b, _ := os.ReadFile(out); string(b) != string(data) {
+		t.Errorf("content = %q", b)
+	}
+	if got := strings.Join(ranges, ","); got != ",bytes=0-39,bytes=40-" {
+		t.Errorf("Range headers = %q", ranges)
+	}
+}
+
+func TestSidecarWrittenForInterruptedDownload(t *testing.T) {
+	data := []byte(strings.Repeat("0123456789", 10))
+	sum := sha256.Sum256(data)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Disposition", "attachment; filename=\"data.bin\"")
+		w.Header().Set("Accept-Ranges", "bytes")
+		w.Header().Set(protocol.ContentSHA256Header, hex.EncodeToString(sum[:]))
+		w.Header().Set("Content-Length", fmt.Sprint(len(data)))
+		_, _ = w.Write(data[:40])
+	}))
+	defer ts.Close()
+
+	out := filepath.Join(t.TempDir(), "data.bin")
+	if _, err := Receive(ts.URL, out, false, nil, nil); err == nil {
+		t.Fatal("a cut-off body should fail")
+	}
+	sc, err := readResumeSidecar(out)
+	if err != nil || sc == nil {
+		t.Fatalf("sidecar = %v, %v", sc, err)
+	}
+	if sc.Size != int64(len(data)) || sc.SHA256 != hex.EncodeToString(sum[:]) {
+		t.Errorf("sidecar = %+v", sc)
+	}
+}
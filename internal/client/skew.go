@@ -0,0 +1,41 @@
+package client
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/zulfikawr/warp/internal/ui"
+)
+
+// ClockSkewWarning is how far the sender's clock may be from ours before
+// Receive points it out. Expiries are timed on the server alone, but file
+// times and logs on the two machines stop lining up.
+const ClockSkewWarning = 2 * time.Minute
+
+// ClockSkew returns the server's clock minus now, read from the Date header
+// every response carries. The header counts whole seconds, so the result is
+// only good to about a second. It reports false when there is no Date.
+func ClockSkew(h http.Header, now time.Time) (time.Duration, bool) {
+	date, err := http.ParseTime(h.Get("Date"))
+	if err != nil {
+		return 0, false
+	}
+	return date.Sub(now.Truncate(time.Second)), true
+}
+
+// warnClockSkew tells the user when the server's clock is more than
+// ClockSkewWarning away from ours
+func warnClockSkew(progress io.Writer, h http.Header, now time.Time) {
+	skew, ok := ClockSkew(h, now)
+	if !ok || progress == nil || skew.Abs() <= ClockSkewWarning {
+		return
+	}
+	dir := "ahead of"
+	if skew < 0 {
+		dir = "behind"
+	}
+	_, _ = fmt.Fprintf(progress, "%s! The sender's clock is %s %s this machine's; file times and logs on the two may not line up%s\n",
+		ui.Colors.Yellow, ui.FormatDuration(skew.Abs()), dir, ui.Colors.Reset)
+}
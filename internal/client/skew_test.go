@@ -0,0 +1,45 @@
+package client
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClockSkew(t *testing.T) {
+	now := time.Date(2025, 3, 1, 12, 0, 0, 400e6, time.UTC)
+	h := http.Header{}
+	if _, ok := ClockSkew(h, now); ok {
+		t.Error("ClockSkew reported a skew without a Date header")
+	}
+	h.Set("Date", now.Add(5*time.Minute).Format(http.TimeFormat))
+	if skew, ok := ClockSkew(h, now); !ok || skew != 5*time.Minute {
+		t.Errorf("ClockSkew = %v, %v; want 5m", skew, ok)
+	}
+}
+
+func TestWarnClockSkew(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		skew time.Duration
+		want string
+	}{
+		{30 * time.Second, ""},
+		{-ClockSkewWarning, ""},
+		{10 * time.Minute, "10m00s ahead of"},
+		{-3 * time.Hour, "3h00m00s behind"},
+	}
+	for _, tt := range tests {
+		h := http.Header{"Date": {now.Add(tt.skew).UTC().Format(http.TimeFormat)}}
+		var out bytes.Buffer
+		warnClockSkew(&out, h, now)
+		if tt.want == "" && out.Len() != 0 {
+			t.Errorf("skew %v: warned %q", tt.skew, out.String())
+		}
+		if tt.want != "" && !strings.Contains(out.String(), tt.want) {
+			t.Errorf("skew %v: warning %q, want %q", tt.skew, out.String(), tt.want)
+		}
+	}
+}
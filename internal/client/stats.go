@@ -0,0 +1,147 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/zulfikawr/warp/internal/protocol"
+	"github.com/zulfikawr/warp/internal/ui"
+)
+
+// maxTopRecent bounds the completed transfers shown under the active ones
+const maxTopRecent = 5
+
+// StatsClient polls the /stats endpoint of a running share for `warp top`
+type StatsClient struct {
+	client   *http.Client
+	statsURL string
+}
+
+// NewStatsClient returns a client for the share or upload URL printed by send
+// or host
+func NewStatsClient(shareURL string) *StatsClient {
+	c := defaultHTTPClient()
+	c.Timeout = 10 * time.Second
+	return &StatsClient{client: c, statsURL: strings.TrimRight(shareURL, "/") + protocol.StatsPathSuffix}
+}
+
+// SetBasicAuth sends HTTP Basic credentials, for servers started with --basic-auth
+func (c *StatsClient) SetBasicAuth(user, password string) {
+	c.client = withBasicAuth(c.client, user, password)
+}
+
+// Fetch reads one snapshot
+func (c *StatsClient) Fetch(ctx context.Context) (*protocol.Stats, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.statsURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL: %w", err)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("connection failed: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusUnauthorized:
+		return nil, fmt.Errorf("authentication required (Basic auth credentials missing or wrong)")
+	case http.StatusForbidden:
+		return nil, fmt.Errorf("stats rejected: wrong URL or token (HTTP 403)")
+	case http.StatusNotFound:
+		return nil, fmt.Errorf("server does not serve stats (HTTP 404); it may predate warp top")
+	default:
+		return nil, fmt.Errorf("server returned error: HTTP %d", resp.StatusCode)
+	}
+
+	var st protocol.Stats
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&st); err != nil {
+		return nil, fmt.Errorf("invalid stats response: %w", err)
+	}
+	return &st, nil
+}
+
+// TopState derives the `warp top` dashboard from a snapshot and the one polled
+// before it (nil on the first poll). Active transfers come first, oldest
+// first, followed by the most recent completions. Speeds are measured between
+// the two snapshots; without a previous one they are averages.
+func TopState(prev, cur *protocol.Stats) ui.TransferState {
+	var dt float64
+	prevActive := map[string]int64{}
+	if prev != nil {
+		dt = cur.UptimeSeconds - prev.UptimeSeconds
+		for _, t := range prev.Active {
+			prevActive[t.ID] = t.Current
+		}
+	}
+
+	state := ui.TransferState{Name: "warp " + cur.Mode}
+	for _, t := range cur.Active {
+		f := ui.FileState{
+			Name:    directionArrow(t.Direction) + " " + t.Name,
+			Current: t.Current,
+			Total:   t.Total,
+			Elapsed: seconds(t.ElapsedSeconds),
+		}
+		if before, ok := prevActive[t.ID]; ok && dt > 0 {
+			f.Speed = float64(t.Current-before) / dt
+		} else if t.ElapsedSeconds > 0 {
+			f.Speed = float64(t.Current) / t.ElapsedSeconds
+		}
+		if f.Speed > 0 && t.Total > t.Current {
+			f.ETA = time.Duration(float64(t.Total-t.Current) / f.Speed * float64(time.Second))
+		}
+		state.Files = append(state.Files, f)
+		state.Current += t.Current
+		state.Total += t.Total
+		state.Elapsed = max(state.Elapsed, f.Elapsed)
+	}
+	for _, t := range cur.Recent[:min(len(cur.Recent), maxTopRecent)] {
+		f := ui.FileState{
+			Name:     directionArrow(t.Direction) + " " + t.Name,
+			Current:  t.Bytes,
+			Total:    t.Bytes,
+			Complete: true,
+			Elapsed:  seconds(t.DurationSeconds),
+		}
+		if t.DurationSeconds > 0 {
+			f.Speed = float64(t.Bytes) / t.DurationSeconds
+		}
+		state.Files = append(state.Files, f)
+	}
+
+	// Throughput between polls, or the average since the server started
+	sent, received := float64(cur.BytesSent), float64(cur.BytesReceived)
+	window := cur.UptimeSeconds
+	if dt > 0 {
+		sent -= float64(prev.BytesSent)
+		received -= float64(prev.BytesReceived)
+		window = dt
+	}
+	var upload, download float64
+	if window > 0 {
+		download, upload = sent/window, received/window
+	}
+	state.Detail = fmt.Sprintf("↓ %s ↑ %s", ui.FormatSpeed(download), ui.FormatSpeed(upload))
+	state.Title = fmt.Sprintf("%s · up %s · %d active · %s sent, %s received",
+		state.Name, ui.FormatDuration(seconds(cur.UptimeSeconds)), len(cur.Active),
+		ui.FormatBytes(cur.BytesSent), ui.FormatBytes(cur.BytesReceived))
+	return state
+}
+
+// directionArrow marks a row as a download (served) or an upload (received)
+func directionArrow(direction string) string {
+	if direction == protocol.DirectionUpload {
+		return "↑"
+	}
+	return "↓"
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
@@ -0,0 +1,106 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zulfikawr/warp/internal/protocol"
+)
+
+// Two polls one second apart: a.iso gained 30 MB, b.zip is new, c.txt finished
+const (
+	statsBefore = `{"version":"1.0","mode":"host","uptime_seconds":100,"bytes_sent":1000000,"bytes_received":50000000,
+		"active":[{"id":"t1","name":"a.iso","direction":"upload","current":40000000,"total":100000000,"elapsed_seconds":4}],
+		"recent":[]}`
+	statsAfter = `{"version":"1.0","mode":"host","uptime_seconds":101,"bytes_sent":3000000,"bytes_received":80000000,
+		"active":[{"id":"t1","name":"a.iso","direction":"upload","current":70000000,"total":100000000,"elapsed_seconds":5},
+			{"id":"t2","name":"b.zip","direction":"download","current":2000000,"elapsed_seconds":0.5}],
+		"recent":[{"name":"c.txt","direction":"upload","bytes":4000,"duration_seconds":2,"finished_at":1700000000}]}`
+)
+
+func decodeStats(t *testing.T, payload string) *protocol.Stats {
+	t.Helper()
+	var st protocol.Stats
+	if err := json.Unmarshal([]byte(payload), &st); err != nil {
+		t.Fatal(err)
+	}
+	return &st
+}
+
+func TestTopStateFromStats(t *testing.T) {
+	state := TopState(decodeStats(t, statsBefore), decodeStats(t, statsAfter))
+
+	if state.Name != "warp host" {
+		t.Errorf("Name = %q", state.Name)
+	}
+	if state.Current != 72000000 || state.Total != 100000000 {
+		t.Errorf("Current/Total = %d/%d, want sums of the active transfers", state.Current, state.Total)
+	}
+	if state.Elapsed != 5*time.Second {
+		t.Errorf("Elapsed = %v, want the oldest active transfer's", state.Elapsed)
+	}
+	if len(state.Files) != 3 {
+		t.Fatalf("got %d rows, want 2 active and 1 recent", len(state.Files))
+	}
+
+	iso, zip, txt := state.Files[0], state.Files[1], state.Files[2]
+	if iso.Name != "↑ a.iso" || iso.Complete {
+		t.Errorf("first row = %+v", iso)
+	}
+	// 30 MB over the one second between polls, 30 MB left
+	if iso.Speed != 30000000 || iso.ETA != time.Second {
+		t.Errorf("a.iso speed %v ETA %v, want the rate between polls", iso.Speed, iso.ETA)
+	}
+	// New since the last poll, so its own average; no total, no ETA
+	if zip.Name != "↓ b.zip" || zip.Speed != 4000000 || zip.ETA != 0 {
+		t.Errorf("b.zip row = %+v", zip)
+	}
+	if !txt.Complete || txt.Name != "↑ c.txt" || txt.Speed != 2000 || txt.Elapsed != 2*time.Second {
+		t.Errorf("recent row = %+v", txt)
+	}
+
+	if !strings.Contains(state.Detail, "↓ 16.0 Mbps") || !strings.Contains(state.Detail, "↑ 240.0 Mbps") {
+		t.Errorf("Detail = %q, want throughput between polls", state.Detail)
+	}
+	if !strings.Contains(state.Title, "2 active") {
+		t.Errorf("Title = %q", state.Title)
+	}
+}
+
+func TestTopStateFirstPollUsesAverages(t *testing.T) {
+	state := TopState(nil, decodeStats(t, statsBefore))
+	if got := state.Files[0].Speed; got != 10000000 {
+		t.Errorf("speed = %v, want the transfer's average", got)
+	}
+	// 1 MB sent and 50 MB received over 100 s of uptime
+	if !strings.Contains(state.Detail, "↓ 80.0 kbps") || !strings.Contains(state.Detail, "↑ 4.0 Mbps") {
+		t.Errorf("Detail = %q, want averages since start", state.Detail)
+	}
+}
+
+func TestStatsClientFetch(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/u/tok/stats" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(statsAfter))
+	}))
+	defer ts.Close()
+
+	st, err := NewStatsClient(ts.URL + "/u/tok/").Fetch(context.Background())
+	if err != nil {
+		t.Fatalf("Fetch: %v", err)
+	}
+	if len(st.Active) != 2 || st.BytesReceived != 80000000 {
+		t.Errorf("stats = %+v", st)
+	}
+	if _, err := NewStatsClient(ts.URL + "/u/other").Fetch(context.Background()); err == nil {
+		t.Error("Fetch of a missing endpoint: expected error")
+	}
+}
@@ -0,0 +1,82 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/zulfikawr/warp/internal/protocol"
+)
+
+// errSessionUnknown means the host has no record of the upload session
+var errSessionUnknown = errors.New("host has no record of the upload session")
+
+// fetchSessionStatus asks the host which chunks of the session it committed
+func (s *UploadSession) fetchSessionStatus(ctx context.Context) (*protocol.SessionStatus, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimRight(s.URL, "/")+protocol.SessionPathSegment+s.SessionID, nil)
+	if err != nil {
+		return nil, fmt.Errorf("create session status request: %w", err)
+	}
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("session status: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, errSessionUnknown
+	default:
+		return nil, fmt.Errorf("session status: host returned %d", resp.StatusCode)
+	}
+	var status protocol.SessionStatus
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&status); err != nil {
+		return nil, fmt.Errorf("session status: invalid response: %w", err)
+	}
+	return &status, nil
+}
+
+// committed reports whether the host already holds chunk id. Any failure to
+// find out counts as no, so the chunk is simply sent again.
+func (s *UploadSession) committed(ctx context.Context, id int) bool {
+	if !s.Config.sessionStatus {
+		return false
+	}
+	status, err := s.fetchSessionStatus(ctx)
+	return err == nil && status.Has(id)
+}
+
+// reconcile checks the host's record of the session against the chunks sent,
+// resends any it lacks once, and fails if the upload is still incomplete
+func (s *UploadSession) reconcile(ctx context.Context) error {
+	status, err := s.fetchSessionStatus(ctx)
+	if err != nil {
+		return err
+	}
+	if missing := status.Missing(); len(missing) > 0 && status.TotalChunks == len(s.chunks) {
+		for _, id := range missing {
+			chunk := s.chunks[id]
+			// Counted as uploaded when its response came back; it is sent again
+			s.uploadedBytes.Add(-chunk.Size)
+			s.retransmits.Add(1)
+			if err := s.uploadChunk(ctx, chunk); err != nil {
+				return err
+			}
+		}
+		if status, err = s.fetchSessionStatus(ctx); err != nil {
+			return err
+		}
+	}
+	if status.TotalChunks != len(s.chunks) {
+		return fmt.Errorf("host expects %d chunks, sent %d", status.TotalChunks, len(s.chunks))
+	}
+	if !status.Complete {
+		return fmt.Errorf("host committed %d of %d chunks", status.ReceivedChunks, status.TotalChunks)
+	}
+	return nil
+}
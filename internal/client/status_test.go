@@ -0,0 +1,132 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zulfikawr/warp/internal/protocol"
+)
+
+// statusHost is a host that serves the session status endpoint. lose is
+// called for every chunk POST and decides whether the chunk is committed and
+// whether its response is lost.
+type statusHost struct {
+	mu        sync.Mutex
+	total     int
+	committed map[int]bool
+	posts     map[int]int
+	lose      func(id, attempt int) (commit, lostResponse bool)
+}
+
+func (h *statusHost) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case strings.HasSuffix(r.URL.Path, protocol.ManifestPathSuffix):
+		_ = json.NewEncoder(w).Encode(protocol.Capabilities{
+			Version:  protocol.Version,
+			Mode:     "host",
+			Features: []string{protocol.FeatureParallelChunks, protocol.FeatureSessionStatus},
+		})
+	case strings.Contains(r.URL.Path, protocol.SessionPathSegment):
+		h.mu.Lock()
+		st := protocol.SessionStatus{TotalChunks: h.total, ReceivedBitmap: make([]byte, (h.total+7)/8)}
+		for id := range h.committed {
+			st.ReceivedBitmap[id/8] |= 1 << (id % 8)
+			st.ReceivedChunks++
+		}
+		st.Complete = st.ReceivedChunks == h.total
+		h.mu.Unlock()
+		_ = json.NewEncoder(w).Encode(st)
+	default:
+		id, _ := strconv.Atoi(r.Header.Get("X-Chunk-Id"))
+		h.mu.Lock()
+		h.total, _ = strconv.Atoi(r.Header.Get("X-Chunk-Total"))
+		h.posts[id]++
+		commit, lost := h.lose(id, h.posts[id])
+		if commit {
+			h.committed[id] = true
+		}
+		h.mu.Unlock()
+		if lost {
+			http.Error(w, "connection reset", http.StatusBadGateway)
+			return
+		}
+		_, _ = w.Write([]byte(`{"success":true}`))
+	}
+}
+
+func uploadTo(t *testing.T, h *statusHost) (*UploadSession, error) {
+	t.Helper()
+	h.committed, h.posts = make(map[int]bool), make(map[int]int)
+	ts := httptest.NewServer(h)
+	t.Cleanup(ts.Close)
+
+	path := filepath.Join(t.TempDir(), "data.bin")
+	if err := os.WriteFile(path, make([]byte, 4*1024), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	session, err := NewUploadSession(ts.URL+protocol.UploadPathPrefix+"tok", path, &UploadConfig{
+		ChunkSize:     1024,
+		MaxConcurrent: 2,
+		RetryAttempts: 2,
+		RetryDelay:    time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return session, session.Upload(context.Background())
+}
+
+func TestUploadSkipsRetryOfCommittedChunk(t *testing.T) {
+	h := &statusHost{lose: func(id, attempt int) (bool, bool) {
+		// Chunk 1 is written, but its response never arrives
+		return true, id == 1 && attempt == 1
+	}}
+	session, err := uploadTo(t, h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.posts[1] != 1 {
+		t.Errorf("chunk 1 sent %d times, want 1: the host already had it", h.posts[1])
+	}
+	if n := session.retransmits.Load(); n != 0 {
+		t.Errorf("%d retransmits counted", n)
+	}
+	if got := session.uploadedBytes.Load(); got != session.TotalSize {
+		t.Errorf("uploaded %d bytes, want %d", got, session.TotalSize)
+	}
+}
+
+func TestUploadResendsChunksTheHostLacks(t *testing.T) {
+	h := &statusHost{lose: func(id, attempt int) (bool, bool) {
+		// Chunk 2 is acknowledged the first time but never written
+		return id != 2 || attempt > 1, false
+	}}
+	session, err := uploadTo(t, h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.posts[2] != 2 {
+		t.Errorf("chunk 2 sent %d times, want 2", h.posts[2])
+	}
+	if got := session.uploadedBytes.Load(); got != session.TotalSize {
+		t.Errorf("uploaded %d bytes, want %d", got, session.TotalSize)
+	}
+}
+
+func TestUploadFailsWhenHostNeverCommits(t *testing.T) {
+	h := &statusHost{lose: func(id, attempt int) (bool, bool) { return id != 3, false }}
+	_, err := uploadTo(t, h)
+	if err == nil || !strings.Contains(err.Error(), fmt.Sprintf("committed %d of %d chunks", 3, 4)) {
+		t.Fatalf("err = %v, want the host's missing chunk reported", err)
+	}
+}
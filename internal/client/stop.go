@@ -0,0 +1,40 @@
+package client
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/zulfikawr/warp/internal/protocol"
+)
+
+// Stop asks the warp server serving shareURL to shut down gracefully.
+// shareURL is the /d/{token} or /u/{token} URL printed by send or host.
+func Stop(shareURL, secret string) error {
+	stopURL := strings.TrimRight(shareURL, "/") + protocol.StopPathSuffix
+	req, err := http.NewRequest(http.MethodPost, stopURL, nil)
+	if err != nil {
+		return fmt.Errorf("invalid URL: %w", err)
+	}
+	req.Header.Set(protocol.ManagementSecretHeader, secret)
+
+	c := defaultHTTPClient()
+	c.Timeout = 10 * time.Second
+	resp, err := c.Do(req)
+	if err != nil {
+		return fmt.Errorf("connection failed: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusForbidden:
+		return fmt.Errorf("stop rejected: wrong secret or URL (HTTP 403)")
+	default:
+		return fmt.Errorf("server returned error: HTTP %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,31 @@
+package client
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/zulfikawr/warp/internal/protocol"
+)
+
+func TestStopSendsSecret(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/d/tok/stop" {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		if r.Header.Get(protocol.ManagementSecretHeader) != "s3cret" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		_, _ = w.Write([]byte("stopping"))
+	}))
+	defer ts.Close()
+
+	if err := Stop(ts.URL+"/d/tok/", "s3cret"); err != nil {
+		t.Fatalf("Stop with correct secret: %v", err)
+	}
+	if err := Stop(ts.URL+"/d/tok", "wrong"); err == nil {
+		t.Fatal("Stop with wrong secret: expected error")
+	}
+}
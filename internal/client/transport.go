@@ -0,0 +1,81 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+
+	"github.com/zulfikawr/warp/internal/network"
+)
+
+// Transport is the protocol a transfer runs over
+type Transport string
+
+const (
+	TransportTCP  Transport = "tcp"
+	TransportQUIC Transport = "quic"
+)
+
+// FragmentationWarning is shown when a path loses full-size QUIC packets
+const FragmentationWarning = "UDP fragmentation detected, falling back to TCP; consider --quic=off"
+
+// altSvcH3 matches the HTTP/3 entry of an Alt-Svc header, h3=":port"
+var altSvcH3 = regexp.MustCompile(`(?:^|[\s,])h3="[^":]*:(\d+)"`)
+
+// QUICPort returns the HTTP/3 port a warp server advertises in its Alt-Svc
+// header, or 0 when it doesn't serve QUIC
+func QUICPort(h http.Header) int {
+	m := altSvcH3.FindStringSubmatch(h.Get("Alt-Svc"))
+	if m == nil {
+		return 0
+	}
+	port, err := strconv.Atoi(m[1])
+	if err != nil || port < 1 || port > 65535 {
+		return 0
+	}
+	return port
+}
+
+// TransportChoice is the outcome of SelectTransport
+type TransportChoice struct {
+	Transport Transport
+	Path      network.PathResult // Zero when QUIC wasn't offered
+	Warning   string             // Why QUIC was passed over; empty when it wasn't worth a warning
+}
+
+// SelectTransport picks the transport that suits the path to the server on
+// host, given the UDP port it serves QUIC on (0 = none), for warp ping to
+// report. QUIC is chosen only when a path check shows full-size datagrams
+// reach it; a path that drops them, as PPPoE and VPN overlays often do,
+// stalls QUIC while TCP is fine, so it gets TCP and a warning instead. The
+// check runs until ctx ends or every probe is answered.
+func SelectTransport(ctx context.Context, host string, quicPort int) (TransportChoice, error) {
+	choice := TransportChoice{Transport: TransportTCP}
+	if quicPort == 0 {
+		return choice, nil
+	}
+	addr, err := net.ResolveUDPAddr("udp", net.JoinHostPort(host, strconv.Itoa(quicPort)))
+	if err != nil {
+		return choice, fmt.Errorf("resolve QUIC address: %w", err)
+	}
+	conn, err := net.ListenPacket("udp", ":0")
+	if err != nil {
+		return choice, fmt.Errorf("open UDP socket: %w", err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	choice.Path, err = network.CheckUDPPath(ctx, conn, addr, network.UDPProbeSizes)
+	if err != nil {
+		return choice, err
+	}
+	switch choice.Path.Verdict {
+	case network.PathOK:
+		choice.Transport = TransportQUIC
+	case network.PathFragmented:
+		choice.Warning = FragmentationWarning
+	}
+	return choice, nil
+}
@@ -0,0 +1,85 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/zulfikawr/warp/internal/network"
+	"github.com/zulfikawr/warp/internal/protocol"
+)
+
+func TestQUICPort(t *testing.T) {
+	tests := []struct {
+		altSvc string
+		want   int
+	}{
+		{`h3=":52314"; ma=3600`, 52314},
+		{`h2=":443", h3=":8443"; ma=60`, 8443},
+		{`h3="warp.lan:9000"`, 9000},
+		{`h3-29=":443"`, 0},
+		{`h3=":99999"`, 0},
+		{`clear`, 0},
+		{``, 0},
+	}
+	for _, tt := range tests {
+		h := http.Header{}
+		if tt.altSvc != "" {
+			h.Set("Alt-Svc", tt.altSvc)
+		}
+		if got := QUICPort(h); got != tt.want {
+			t.Errorf("QUICPort(%q) = %d, want %d", tt.altSvc, got, tt.want)
+		}
+	}
+}
+
+func TestSelectTransportWithoutQUIC(t *testing.T) {
+	choice, err := SelectTransport(context.Background(), "192.0.2.1", 0)
+	if err != nil || choice.Transport != TransportTCP || choice.Warning != "" {
+		t.Errorf("got %+v, %v; want TCP without a check", choice, err)
+	}
+}
+
+func TestSelectTransportNoReply(t *testing.T) {
+	// A UDP socket that never answers, like a host whose QUIC port is firewalled
+	silent, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = silent.Close() }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	choice, err := SelectTransport(ctx, "127.0.0.1", silent.LocalAddr().(*net.UDPAddr).Port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if choice.Transport != TransportTCP || choice.Path.Verdict != network.PathNoReply || choice.Warning != "" {
+		t.Errorf("got %+v, want TCP with no reply and no warning", choice)
+	}
+}
+
+func TestPingCapturesQUICPort(t *testing.T) {
+	// Alt-Svc the way a warp server with QUIC sends it
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Alt-Svc", `h3=":52314"; ma=3600`)
+		_ = json.NewEncoder(w).Encode(protocol.Health{Status: "ok"})
+	}))
+	defer ts.Close()
+
+	p, err := NewPinger(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := p.Run(context.Background(), 1, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.QUICPort != 52314 || p.Host() != "127.0.0.1" {
+		t.Errorf("QUIC port %d on %s, want 52314 on 127.0.0.1", res.QUICPort, p.Host())
+	}
+}
@@ -18,6 +18,7 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/zulfikawr/warp/internal/crypto"
 	"github.com/zulfikawr/warp/internal/protocol"
 	"github.com/zulfikawr/warp/internal/ui"
 )
@@ -29,6 +30,11 @@ type UploadConfig struct {
 	RetryAttempts  int           // Number of retry attempts for failed chunks
 	RetryDelay     time.Duration // Delay between retries
 	ProgressWriter io.Writer     // Optional progress output
+	Renderer       ui.Renderer   // Progress display; picked for ProgressWriter when nil
+	Verify         bool          // Ask the host to verify the full-file SHA256 after the last chunk
+	Key            []byte        // Key agreed with the host; chunks are sealed with crypto.SealChunk when set
+	sessionStatus  bool          // Host reports committed chunks; set from its capabilities
+	slots          chan struct{} // Bounds chunks in flight across sessions sharing it; nil = MaxConcurrent only
 }
 
 // DefaultUploadConfig returns sensible defaults for parallel uploads
@@ -39,25 +45,32 @@ func DefaultUploadConfig() *UploadConfig {
 		RetryAttempts:  3,               // 3 retries
 		RetryDelay:     1 * time.Second, // 1s between retries
 		ProgressWriter: nil,
+		Verify:         true,
 	}
 }
 
 // UploadSession tracks the state of a parallel upload
 type UploadSession struct {
-	SessionID      string
-	URL            string
-	File           *os.File
-	TotalSize      int64
-	Config         *UploadConfig
-	Client         *http.Client // HTTP client for requests
-	uploadedBytes  atomic.Int64
-	startTime      time.Time
-	chunks         []chunkInfo
-	chunkStatus    map[int]chunkState
-	statusMu       sync.RWMutex
-	progressTicker *time.Ticker
-	cancel         context.CancelFunc
-	bufferPool     sync.Pool // Buffer pool for chunk allocation
+	SessionID     string
+	URL           string
+	File          *os.File
+	Name          string // Name the host saves the file under; File's base name when empty
+	Checksum      string // SHA256 of File when already known; computed during the upload when empty
+	TotalSize     int64
+	fileInfo      os.FileInfo // Source attributes sent as X-File-Mtime/X-File-Mode
+	Config        *UploadConfig
+	Client        *http.Client // HTTP client for requests
+	uploadedBytes atomic.Int64
+	retransmits   atomic.Int64 // Chunk sends after the first attempt
+	wastedBytes   atomic.Int64 // Bytes of chunk sends that failed
+	startTime     time.Time
+	chunks        []chunkInfo
+	chunkStatus   map[int]chunkState
+	statusMu      sync.RWMutex
+	renderer      ui.Renderer
+	cancel        context.CancelFunc
+	bufferPool    sync.Pool // Buffer pool for chunk allocation
+	verified      bool      // The host confirmed the file's SHA256
 }
 
 type chunkInfo struct {
@@ -71,6 +84,7 @@ type chunkState struct {
 	Attempts  int
 	Checksum  string
 	BytesSent int64
+	Sealed    string // SHA256 of the plaintext first sealed for this chunk
 }
 
 // NewUploadSession creates a new parallel upload session
@@ -93,42 +107,63 @@ func NewUploadSession(url, filepath string, config *UploadConfig) (*UploadSessio
 	// Generate session ID
 	sessionID := generateSessionID(filepath, stat.Size())
 
-	// Calculate chunks
-	totalChunks := int(math.Ceil(float64(stat.Size()) / float64(config.ChunkSize)))
-	chunks := make([]chunkInfo, totalChunks)
-	chunkStatus := make(map[int]chunkState, totalChunks)
+	s := &UploadSession{
+		SessionID: sessionID,
+		URL:       url,
+		File:      file,
+		TotalSize: stat.Size(),
+		fileInfo:  stat,
+		Config:    config,
+		Client:    defaultHTTPClient(), // Use shared HTTP client
+		startTime: time.Now(),
+	}
+	s.bufferPool.New = func() interface{} {
+		b := make([]byte, s.Config.ChunkSize)
+		return &b
+	}
+	s.planChunks()
+	return s, nil
+}
+
+// planChunks splits the file into Config.ChunkSize chunks, all pending
+func (s *UploadSession) planChunks() {
+	totalChunks := int(math.Ceil(float64(s.TotalSize) / float64(s.Config.ChunkSize)))
+	s.chunks = make([]chunkInfo, totalChunks)
+	s.chunkStatus = make(map[int]chunkState, totalChunks)
 
 	for i := 0; i < totalChunks; i++ {
-		offset := int64(i) * config.ChunkSize
-		size := config.ChunkSize
-		if offset+size > stat.Size() {
-			size = stat.Size() - offset
+		offset := int64(i) * s.Config.ChunkSize
+		size := s.Config.ChunkSize
+		if offset+size > s.TotalSize {
+			size = s.TotalSize - offset
 		}
-		chunks[i] = chunkInfo{
+		s.chunks[i] = chunkInfo{
 			ID:     i,
 			Offset: offset,
 			Size:   size,
 		}
-		chunkStatus[i] = chunkState{Status: "pending", Attempts: 0}
-	}
-
-	return &UploadSession{
-		SessionID:   sessionID,
-		URL:         url,
-		File:        file,
-		TotalSize:   stat.Size(),
-		Config:      config,
-		Client:      defaultHTTPClient(), // Use shared HTTP client
-		chunks:      chunks,
-		chunkStatus: chunkStatus,
-		startTime:   time.Now(),
-		bufferPool: sync.Pool{
-			New: func() interface{} {
-				b := make([]byte, config.ChunkSize)
-				return &b
-			},
-		},
-	}, nil
+		s.chunkStatus[i] = chunkState{Status: "pending", Attempts: 0}
+	}
+}
+
+// negotiate fetches the host's capabilities and adapts the session to them,
+// re-planning chunks if the chunk size changes. It fails before any chunk is
+// sent if the host would reject the file.
+func (s *UploadSession) negotiate(ctx context.Context) error {
+	caps, err := fetchCapabilities(ctx, s.Client, s.URL)
+	if err != nil {
+		return err
+	}
+	cfg, err := adaptConfig(*s.Config, caps, s.name(), s.TotalSize)
+	if err != nil {
+		return err
+	}
+	replan := cfg.ChunkSize != s.Config.ChunkSize
+	s.Config = &cfg
+	if replan {
+		s.planChunks()
+	}
+	return nil
 }
 
 // generateSessionID creates a unique session identifier
@@ -149,11 +184,51 @@ func (s *UploadSession) Upload(ctx context.Context) error {
 	s.cancel = cancel
 	defer cancel()
 
+	if err := s.negotiate(ctx); err != nil {
+		return err
+	}
+
+	// Hash the whole file alongside the chunk uploads for the finalize step;
+	// empty files never create a session on the host, so there is nothing to verify
+	verify := s.Config.Verify && s.TotalSize > 0
+	type hashResult struct {
+		sum string
+		err error
+	}
+	hashCh := make(chan hashResult, 1)
+	if verify {
+		go func() {
+			if s.Checksum != "" {
+				hashCh <- hashResult{sum: s.Checksum}
+				return
+			}
+			sum, err := s.hashFile()
+			hashCh <- hashResult{sum, err}
+		}()
+	}
+
 	// Start progress reporting if configured
-	if s.Config.ProgressWriter != nil {
-		s.progressTicker = time.NewTicker(protocol.ProgressUpdateInterval)
-		defer s.progressTicker.Stop()
-		go s.reportProgress()
+	s.renderer = s.Config.Renderer
+	if s.renderer == nil && s.Config.ProgressWriter != nil {
+		s.renderer = ui.NewRenderer(s.Config.ProgressWriter, false)
+	}
+	if s.renderer != nil {
+		s.renderer.Start(s.progressState())
+		done := make(chan struct{})
+		defer close(done)
+		go s.reportProgress(done)
+	}
+
+	// An empty file has no chunks, so the host would never create it
+	if s.TotalSize == 0 {
+		if err := s.sendEmpty(ctx); err != nil {
+			return fmt.Errorf("upload failed: %w", err)
+		}
+		if s.renderer != nil {
+			s.renderer.Update(s.progressState())
+			s.renderer.Finish(s.summary(false))
+		}
+		return nil
 	}
 
 	// Create worker pool
@@ -172,8 +247,7 @@ func (s *UploadSession) Upload(ctx context.Context) error {
 					results <- ctx.Err()
 					return
 				default:
-					err := s.uploadChunk(ctx, chunk)
-					results <- err
+					results <- s.uploadSlot(ctx, chunk)
 				}
 			}
 		}(i)
@@ -205,23 +279,70 @@ func (s *UploadSession) Upload(ctx context.Context) error {
 	}
 
 	if firstError != nil {
-		return fmt.Errorf("upload failed: %w", firstError)
+		return fmt.Errorf("upload failed%s: %w", transferSuffix(s.SessionID), firstError)
+	}
+
+	// Success per the chunk responses; confirm it with the host's own record
+	if s.Config.sessionStatus && len(s.chunks) > 0 {
+		if err := s.reconcile(ctx); err != nil {
+			return fmt.Errorf("upload failed%s: %w", transferSuffix(s.SessionID), err)
+		}
 	}
 
 	// Final progress update
-	if s.Config.ProgressWriter != nil {
-		s.printFinalProgress()
+	if s.renderer != nil {
+		s.renderer.Update(s.progressState())
+	}
+
+	if verify {
+		hr := <-hashCh
+		if hr.err != nil {
+			return fmt.Errorf("hash file: %w", hr.err)
+		}
+		if err := s.finalize(ctx, hr.sum); err != nil {
+			return fmt.Errorf("upload failed%s: %w", transferSuffix(s.SessionID), err)
+		}
+		s.verified = true
 	}
 
+	if s.renderer != nil {
+		s.renderer.Finish(s.summary(verify))
+	}
 	return nil
 }
 
+// uploadSlot uploads chunk once a shared slot is free, when the config has
+// slots shared with other sessions
+func (s *UploadSession) uploadSlot(ctx context.Context, chunk chunkInfo) error {
+	if s.Config.slots == nil {
+		return s.uploadChunk(ctx, chunk)
+	}
+	select {
+	case s.Config.slots <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	defer func() { <-s.Config.slots }()
+	return s.uploadChunk(ctx, chunk)
+}
+
+// name is the file name sent to the host
+func (s *UploadSession) name() string {
+	if s.Name != "" {
+		return s.Name
+	}
+	return filepath.Base(s.File.Name())
+}
+
 // uploadChunk uploads a single chunk with retry logic
 func (s *UploadSession) uploadChunk(ctx context.Context, chunk chunkInfo) error {
 	var lastErr error
+	sendFailed := false
+	var waited time.Duration // Spent on Retry-After, which doesn't count as attempts
+	rescheduled := false
 
 	for attempt := 0; attempt <= s.Config.RetryAttempts; attempt++ {
-		if attempt > 0 {
+		if attempt > 0 && !rescheduled {
 			// Exponential backoff
 			delay := s.Config.RetryDelay * time.Duration(1<<(attempt-1))
 			select {
@@ -229,7 +350,15 @@ func (s *UploadSession) uploadChunk(ctx context.Context, chunk chunkInfo) error
 				return ctx.Err()
 			case <-time.After(delay):
 			}
+			// The last attempt may have landed with only its response lost
+			if sendFailed && s.committed(ctx, chunk.ID) {
+				s.wastedBytes.Add(-chunk.Size)
+				s.updateChunkStatus(chunk.ID, "completed", attempt)
+				s.uploadedBytes.Add(chunk.Size)
+				return nil
+			}
 		}
+		rescheduled = false
 
 		// Update status
 		s.updateChunkStatus(chunk.ID, "uploading", attempt)
@@ -251,15 +380,40 @@ func (s *UploadSession) uploadChunk(ctx context.Context, chunk chunkInfo) error
 		checksum := sha256.Sum256(data)
 		checksumHex := hex.EncodeToString(checksum[:])
 
+		body := data
+		if s.Config.Key != nil {
+			if body, err = s.seal(chunk, data, checksumHex); err != nil {
+				s.bufferPool.Put(bufPtr)
+				s.updateChunkStatus(chunk.ID, "failed", attempt)
+				return fmt.Errorf("chunk %d: %w", chunk.ID, err)
+			}
+		}
+
 		// Send chunk
-		err = s.sendChunk(ctx, chunk, data, checksumHex)
+		if attempt > 0 {
+			s.retransmits.Add(1)
+		}
+		err = s.sendChunk(ctx, chunk, body, checksumHex)
 
 		// Return buffer after sending
 		s.bufferPool.Put(bufPtr)
 
 		if err != nil {
 			lastErr = err
+			s.wastedBytes.Add(chunk.Size)
 			s.updateChunkStatus(chunk.ID, "failed", attempt)
+			if permanent(err) {
+				return fmt.Errorf("chunk %d: %w", chunk.ID, err)
+			}
+			// Coming back when the host asks to is not a failed attempt
+			if ok, werr := waitRetryAfter(ctx, err, &waited); werr != nil {
+				return werr
+			} else if ok {
+				rescheduled = true
+				attempt--
+				continue
+			}
+			sendFailed = true
 			continue
 		}
 
@@ -281,14 +435,23 @@ func (s *UploadSession) sendChunk(ctx context.Context, chunk chunkInfo, data []b
 	}
 
 	// Set headers for chunk upload
-	filename := filepath.Base(s.File.Name())
-	req.Header.Set("X-File-Name", url.QueryEscape(filename))
+	req.Header.Set("X-File-Name", url.QueryEscape(s.name()))
 	req.Header.Set("X-Upload-Session", s.SessionID)
 	req.Header.Set("X-Upload-Offset", fmt.Sprintf("%d", chunk.Offset))
 	req.Header.Set("X-Upload-Total", fmt.Sprintf("%d", s.TotalSize))
 	req.Header.Set("X-Chunk-Id", fmt.Sprintf("%d", chunk.ID))
 	req.Header.Set("X-Chunk-Total", fmt.Sprintf("%d", len(s.chunks)))
-	req.Header.Set("X-Chunk-Checksum", checksum)
+	req.Header.Set(protocol.ChunkSizeHeader, fmt.Sprintf("%d", s.Config.ChunkSize))
+	if s.Config.Key != nil {
+		// The plaintext's checksum would tell an eavesdropper what it is;
+		// the seal authenticates the chunk instead
+		req.Header.Set(protocol.EncryptionHeader, protocol.EncryptionChunkV1)
+	} else {
+		req.Header.Set("X-Chunk-Checksum", checksum)
+	}
+	if s.fileInfo != nil {
+		protocol.SetFileAttrHeaders(req.Header, s.fileInfo)
+	}
 	req.Header.Set("Content-Length", fmt.Sprintf("%d", len(data)))
 	req.Header.Set("Content-Type", "application/octet-stream")
 
@@ -299,8 +462,7 @@ func (s *UploadSession) sendChunk(ctx context.Context, chunk chunkInfo, data []b
 	defer func() { _ = resp.Body.Close() }()
 
 	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
-		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
-		return fmt.Errorf("server returned %d: %s", resp.StatusCode, string(body))
+		return statusError(resp)
 	}
 
 	// Parse response
@@ -321,6 +483,78 @@ func (s *UploadSession) sendChunk(ctx context.Context, chunk chunkInfo, data []b
 	return nil
 }
 
+// seal encrypts a chunk for the host. A nonce must never seal two
+// plaintexts, so a retry whose bytes differ from the first attempt's fails
+// instead of being sealed again.
+func (s *UploadSession) seal(chunk chunkInfo, data []byte, checksum string) ([]byte, error) {
+	s.statusMu.Lock()
+	state := s.chunkStatus[chunk.ID]
+	first := state.Sealed
+	if first == "" {
+		state.Sealed = checksum
+		s.chunkStatus[chunk.ID] = state
+	}
+	s.statusMu.Unlock()
+	if first != "" && first != checksum {
+		return nil, fmt.Errorf("%s changed during the upload", s.name())
+	}
+
+	key, err := crypto.ChunkKey(s.Config.Key, s.SessionID)
+	if err != nil {
+		return nil, err
+	}
+	return crypto.SealChunk(key, crypto.ChunkPosition{ID: chunk.ID, Offset: chunk.Offset, Total: s.TotalSize}, data)
+}
+
+// sendEmpty creates an empty file on the host with a single zero-length
+// raw upload, retried like a chunk
+func (s *UploadSession) sendEmpty(ctx context.Context) error {
+	var lastErr error
+	var waited time.Duration
+	rescheduled := false
+	for attempt := 0; attempt <= s.Config.RetryAttempts; attempt++ {
+		if attempt > 0 && !rescheduled {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(s.Config.RetryDelay * time.Duration(1<<(attempt-1))):
+			}
+		}
+		rescheduled = false
+		req, err := http.NewRequestWithContext(ctx, "POST", s.URL, http.NoBody)
+		if err != nil {
+			return fmt.Errorf("create request: %w", err)
+		}
+		req.Header.Set("X-File-Name", url.QueryEscape(s.name()))
+		if s.fileInfo != nil {
+			protocol.SetFileAttrHeaders(req.Header, s.fileInfo)
+		}
+		req.Header.Set("Content-Type", "application/octet-stream")
+
+		resp, err := s.Client.Do(req)
+		if err != nil {
+			lastErr = fmt.Errorf("send request: %w", err)
+			continue
+		}
+		if resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusCreated {
+			_ = resp.Body.Close()
+			return nil
+		}
+		lastErr = statusError(resp)
+		_ = resp.Body.Close()
+		if permanent(lastErr) {
+			return lastErr
+		}
+		if ok, err := waitRetryAfter(ctx, lastErr, &waited); err != nil {
+			return err
+		} else if ok {
+			rescheduled = true
+			attempt--
+		}
+	}
+	return fmt.Errorf("empty file failed after %d attempts: %w", s.Config.RetryAttempts+1, lastErr)
+}
+
 // updateChunkStatus updates the status of a chunk
 func (s *UploadSession) updateChunkStatus(chunkID int, status string, attempts int) {
 	s.statusMu.Lock()
@@ -342,7 +576,7 @@ func (s *UploadSession) setChunkChecksum(chunkID int, checksum string) {
 	s.chunkStatus[chunkID] = state
 }
 
-// getProgress returns current upload progress
+// getProgress returns current upload progress; speed is in bytes per second
 func (s *UploadSession) getProgress() (completed, total int, bytesUploaded, bytesTotal int64, speed float64) {
 	s.statusMu.RLock()
 	defer s.statusMu.RUnlock()
@@ -359,51 +593,69 @@ func (s *UploadSession) getProgress() (completed, total int, bytesUploaded, byte
 
 	elapsed := time.Since(s.startTime).Seconds()
 	if elapsed > 0 {
-		speed = float64(bytesUploaded*8) / (elapsed * 1_000_000) // Mbps
+		speed = float64(bytesUploaded) / elapsed
 	}
 
 	return
 }
 
-// reportProgress periodically prints upload progress
-func (s *UploadSession) reportProgress() {
-	for range s.progressTicker.C {
-		completed, total, bytesUploaded, bytesTotal, speed := s.getProgress()
-
-		pct := float64(bytesUploaded) / float64(bytesTotal) * 100
-		barWidth := 20
-		filled := int(pct / 5)
-		if filled > barWidth {
-			filled = barWidth
-		}
-		bar := ""
-		for i := 0; i < filled; i++ {
-			bar += "="
-		}
-		for i := filled; i < barWidth; i++ {
-			bar += " "
+// reportProgress periodically reports upload progress until done is closed
+func (s *UploadSession) reportProgress(done <-chan struct{}) {
+	ticker := time.NewTicker(protocol.ProgressUpdateInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			s.renderer.Update(s.progressState())
 		}
+	}
+}
 
-		_, _ = fmt.Fprintf(s.Config.ProgressWriter, "\r[%s] %3.0f%% | %s / %s | %.1f Mbps | Chunks: %d/%d",
-			bar, pct,
-			ui.FormatBytes(bytesUploaded), ui.FormatBytes(bytesTotal),
-			speed,
-			completed, total)
+// progressState returns the upload's progress as a ui.TransferState
+func (s *UploadSession) progressState() ui.TransferState {
+	completed, total, bytesUploaded, bytesTotal, _ := s.getProgress()
+	state := ui.TransferState{
+		Name:     s.name(),
+		Current:  bytesUploaded,
+		Total:    bytesTotal,
+		Complete: bytesUploaded >= bytesTotal,
+		Elapsed:  time.Since(s.startTime),
+	}
+	if total > 0 {
+		state.Detail = fmt.Sprintf("Chunks: %d/%d", completed, total)
+	}
+	return state
+}
+
+// summary describes the finished upload
+func (s *UploadSession) summary(verified bool) ui.Summary {
+	_, _, bytesUploaded, _, speed := s.getProgress()
+	sum := ui.Summary{Title: "Upload complete", Fields: []ui.Field{
+		{Label: "File", Value: s.name()},
+		{Label: "Size", Value: ui.FormatBytes(bytesUploaded)},
+		{Label: "Time", Value: fmt.Sprintf("%.2fs", time.Since(s.startTime).Seconds())},
+		{Label: "Avg Speed", Value: ui.FormatSpeed(speed)},
+		{Label: "Transfer ID", Value: s.SessionID},
+	}}
+	if verified {
+		sum.Fields = append(sum.Fields, ui.Field{Label: "Checksum", Value: "Verified by host"})
+	}
+	if n := int(s.retransmits.Load()); n > 0 {
+		sum.Fields = append(sum.Fields, ui.Field{Label: "Retransmitted", Value: ui.FormatRetransmits(n, s.wastedBytes.Load())})
+		if ui.HighRetransmitRatio(n, len(s.chunks)) {
+			sum.Fields = append(sum.Fields, ui.Field{Label: "Hint", Value: "Chunks keep failing; try a smaller --chunk-size on this network"})
+		}
 	}
+	return sum
 }
 
-// printFinalProgress prints the final progress line
-func (s *UploadSession) printFinalProgress() {
-	completed, total, bytesUploaded, bytesTotal, speed := s.getProgress()
-	duration := time.Since(s.startTime).Seconds()
-
-	_, _ = fmt.Fprintf(s.Config.ProgressWriter, "\r[%s====================%s] %s100%%%s | %s / %s | %.1f Mbps | %.2fs | Chunks: %d/%d\n%s✓ Upload complete%s\n",
-		ui.Colors.Green, ui.Colors.Reset,
-		ui.Colors.Green, ui.Colors.Reset,
-		ui.FormatBytes(bytesUploaded), ui.FormatBytes(bytesTotal),
-		speed, duration,
-		completed, total,
-		ui.Colors.Green, ui.Colors.Reset)
+// Verified reports whether the host checked the whole file against its
+// SHA256 and found it intact. It is false until Upload succeeds, and stays
+// false for empty files and hosts that can't verify.
+func (s *UploadSession) Verified() bool {
+	return s.verified
 }
 
 // Cancel stops the upload
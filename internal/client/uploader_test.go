@@ -4,16 +4,22 @@ import (
 	"bytes"
 	"context"
 	"crypto/rand"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"github.com/zulfikawr/warp/internal/ui"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"sync"
 	"testing"
 	"time"
+
+	"github.com/zulfikawr/warp/internal/crypto"
+	"github.com/zulfikawr/warp/internal/protocol"
 )
 
 func TestParallelUpload(t *testing.T) {
@@ -174,6 +180,57 @@ func TestUploadSessionRetry(t *testing.T) {
 	}
 }
 
+func TestUploadSessionCountsRetransmits(t *testing.T) {
+	testFile := filepath.Join(t.TempDir(), "flaky.bin")
+	const chunkSize = 1024
+	if err := os.WriteFile(testFile, make([]byte, 10*chunkSize), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	attempts := make(map[string]int)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Chunk-Id")
+		mu.Lock()
+		attempts[id]++
+		n := attempts[id]
+		mu.Unlock()
+		// Chunks 3 and 7 fail once each
+		if (id == "3" || id == "7") && n == 1 {
+			http.Error(w, "simulated failure", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"success":true}`))
+	}))
+	defer server.Close()
+
+	session, err := NewUploadSession(server.URL, testFile, &UploadConfig{
+		ChunkSize:     chunkSize,
+		MaxConcurrent: 2,
+		RetryAttempts: 2,
+		RetryDelay:    time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := session.Upload(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	fields := make(map[string]string)
+	for _, f := range session.summary(false).Fields {
+		fields[f.Label] = f.Value
+	}
+	if got := fields["Retransmitted"]; got != "2 chunks retransmitted, 2.0 KiB wasted" {
+		t.Errorf("Retransmitted = %q", got)
+	}
+	// 2 of 10 chunks is above the 10% threshold
+	if fields["Hint"] == "" {
+		t.Error("no chunk size hint for a 20% retransmit ratio")
+	}
+}
+
 func TestUploadSessionCancel(t *testing.T) {
 	// Create a temporary test file
 	tmpDir := t.TempDir()
@@ -227,24 +284,150 @@ func TestUploadSessionCancel(t *testing.T) {
 	}
 }
 
-func TestFormatBytes(t *testing.T) {
-	tests := []struct {
-		bytes    int64
-		expected string
-	}{
-		{0, "0 B"},
-		{1023, "1023 B"},
-		{1024, "1.0 KB"},
-		{1536, "1.5 KB"},
-		{1048576, "1.0 MB"},
-		{1073741824, "1.0 GB"},
-		{1099511627776, "1.0 TB"},
-	}
-
-	for _, tt := range tests {
-		result := ui.FormatBytes(tt.bytes)
-		if result != tt.expected {
-			t.Errorf("ui.FormatBytes(%d) = %s, want %s", tt.bytes, result, tt.expected)
+func TestUploadEmptyFile(t *testing.T) {
+	testFile := filepath.Join(t.TempDir(), "empty.txt")
+	if err := os.WriteFile(testFile, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	var requests []*http.Request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.NotFound(w, r)
+			return
+		}
+		mu.Lock()
+		requests = append(requests, r)
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"success":true}`))
+	}))
+	defer server.Close()
+
+	progress := &bytes.Buffer{}
+	config := &UploadConfig{ChunkSize: 1024, MaxConcurrent: 3, RetryDelay: 10 * time.Millisecond, Verify: true}
+	if err := ParallelUpload(context.Background(), server.URL, testFile, config, progress); err != nil {
+		t.Fatalf("upload failed: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(requests) != 1 {
+		t.Fatalf("got %d requests, want a single zero-length upload", len(requests))
+	}
+	r := requests[0]
+	if r.ContentLength != 0 || r.Header.Get("X-File-Name") != "empty.txt" {
+		t.Errorf("Content-Length %d, X-File-Name %q", r.ContentLength, r.Header.Get("X-File-Name"))
+	}
+	if r.Header.Get("X-Upload-Session") != "" || r.Header.Get("X-Chunk-Id") != "" {
+		t.Error("empty file should be sent as a raw upload, not a chunk")
+	}
+	if !bytes.Contains(progress.Bytes(), []byte("100%")) {
+		t.Errorf("progress should show 100%%, got %q", progress.String())
+	}
+}
+
+// sealedHost is a host that takes chunks sealed with crypto.SealChunk and
+// opens them with key. onChunk, if set, may answer a chunk itself.
+func sealedHost(t *testing.T, key []byte, features []string, onChunk func(w http.ResponseWriter, id int) bool) (*httptest.Server, map[int][]byte, *sync.Mutex) {
+	t.Helper()
+	var mu sync.Mutex
+	chunks := make(map[int][]byte)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, protocol.ManifestPathSuffix) {
+			_ = json.NewEncoder(w).Encode(protocol.Capabilities{Version: "1.1.0", Features: features})
+			return
+		}
+		if strings.HasSuffix(r.URL.Path, protocol.FinalizePathSuffix) {
+			t.Error("a sealed upload sent its checksum to finalize")
+			return
+		}
+		if r.Header.Get(protocol.EncryptionHeader) != protocol.EncryptionChunkV1 || r.Header.Get("X-Chunk-Checksum") != "" {
+			t.Errorf("chunk headers: %s=%q, X-Chunk-Checksum=%q", protocol.EncryptionHeader, r.Header.Get(protocol.EncryptionHeader), r.Header.Get("X-Chunk-Checksum"))
+		}
+		id, _ := strconv.Atoi(r.Header.Get("X-Chunk-Id"))
+		if onChunk != nil && onChunk(w, id) {
+			return
+		}
+		offset, _ := strconv.ParseInt(r.Header.Get("X-Upload-Offset"), 10, 64)
+		total, _ := strconv.ParseInt(r.Header.Get("X-Upload-Total"), 10, 64)
+		sessionKey, _ := crypto.ChunkKey(key, r.Header.Get("X-Upload-Session"))
+		sealed, _ := io.ReadAll(r.Body)
+		plain, err := crypto.OpenChunk(sessionKey, crypto.ChunkPosition{ID: id, Offset: offset, Total: total}, sealed)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		chunks[id] = plain
+		mu.Unlock()
+		_, _ = w.Write([]byte(`{"success":true}`))
+	}))
+	t.Cleanup(ts.Close)
+	return ts, chunks, &mu
+}
+
+func TestUploadSealsChunks(t *testing.T) {
+	data := make([]byte, 3*64<<10+5)
+	_, _ = rand.Read(data)
+	path := filepath.Join(t.TempDir(), "secret.bin")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	key := bytes.Repeat([]byte{3}, crypto.KeySize)
+	features := []string{protocol.FeatureParallelChunks, protocol.FeatureVerify, protocol.FeatureEncryptedChunks}
+	ts, chunks, mu := sealedHost(t, key, features, nil)
+
+	cfg := &UploadConfig{ChunkSize: 64 << 10, MaxConcurrent: 3, RetryDelay: time.Millisecond, Verify: true, Key: key}
+	if err := ParallelUpload(context.Background(), ts.URL+"/u/token", path, cfg, nil); err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	var got []byte
+	for id := 0; id < len(chunks); id++ {
+		got = append(got, chunks[id]...)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("host opened %d bytes in %d chunks, want the file's %d", len(got), len(chunks), len(data))
+	}
+
+	// A host that can't open them gets nothing
+	plain, _, _ := sealedHost(t, key, []string{protocol.FeatureParallelChunks}, func(w http.ResponseWriter, id int) bool {
+		t.Errorf("chunk %d sent to a host without %s", id, protocol.FeatureEncryptedChunks)
+		return true
+	})
+	if err := ParallelUpload(context.Background(), plain.URL+"/u/token", path, cfg, nil); !errors.Is(err, ErrUploadRejected) {
+		t.Errorf("err = %v, want ErrUploadRejected", err)
+	}
+}
+
+// A retry must not seal different bytes under the nonce of the first attempt
+func TestUploadSealedRetryRefusesChangedFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log.bin")
+	if err := os.WriteFile(path, bytes.Repeat([]byte{'a'}, 2*64<<10), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	key := bytes.Repeat([]byte{3}, crypto.KeySize)
+	features := []string{protocol.FeatureParallelChunks, protocol.FeatureEncryptedChunks}
+	var failed bool
+	ts, _, _ := sealedHost(t, key, features, func(w http.ResponseWriter, id int) bool {
+		if id != 1 || failed {
+			return false
 		}
+		// Lost, and the file changes before the retry
+		failed = true
+		f, _ := os.OpenFile(path, os.O_WRONLY, 0)
+		_, _ = f.WriteAt([]byte("b"), 64<<10)
+		_ = f.Close()
+		http.Error(w, "try again", http.StatusInternalServerError)
+		return true
+	})
+
+	cfg := &UploadConfig{ChunkSize: 64 << 10, MaxConcurrent: 1, RetryAttempts: 2, RetryDelay: time.Millisecond, Key: key}
+	err := ParallelUpload(context.Background(), ts.URL+"/u/token", path, cfg, nil)
+	if err == nil || !strings.Contains(err.Error(), "changed during the upload") {
+		t.Errorf("err = %v, want the file reported as changed", err)
 	}
 }
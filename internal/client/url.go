@@ -0,0 +1,141 @@
+package client
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/zulfikawr/warp/internal/errors"
+	"github.com/zulfikawr/warp/internal/protocol"
+)
+
+// acceptedURLForms is shown when a receive argument can't be understood
+const acceptedURLForms = "accepted forms: http://host:port/d/token, host:port/d/token, host:port --token <token>, <token> --host host:port"
+
+// NormalizeReceiveURL turns what a user pasted into the canonical download URL
+// (http://host:port/d/token). arg may be a full URL, a scheme-less host:port/path,
+// a bare host:port when token is given, or a bare token when host is given.
+// Trailing slashes are ignored.
+func NormalizeReceiveURL(arg, host, token string) (string, error) {
+	arg = strings.TrimSpace(arg)
+	host = strings.TrimSpace(host)
+	token = strings.TrimSpace(token)
+
+	// A bare token alongside --host
+	if host != "" && arg != "" && !strings.ContainsAny(arg, "/:") {
+		if token != "" && token != arg {
+			return "", errors.InvalidURLError(arg, fmt.Errorf("token given twice (%q and --token %q)", arg, token))
+		}
+		token, arg = arg, ""
+	}
+	if arg == "" {
+		if host == "" || token == "" {
+			return "", errors.InvalidURLError(arg, fmt.Errorf("missing host or token; %s", acceptedURLForms))
+		}
+		arg = host
+	} else if host != "" {
+		return "", errors.InvalidURLError(arg, fmt.Errorf("--host cannot be combined with a URL; %s", acceptedURLForms))
+	}
+
+	raw := arg
+	if !strings.Contains(raw, "://") {
+		raw = "http://" + raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", errors.InvalidURLError(arg, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", errors.InvalidURLError(arg, fmt.Errorf("unsupported scheme %q; %s", u.Scheme, acceptedURLForms))
+	}
+	if u.Host == "" || u.Hostname() == "" {
+		return "", errors.InvalidURLError(arg, fmt.Errorf("missing host; %s", acceptedURLForms))
+	}
+
+	path := strings.TrimRight(u.Path, "/")
+	var pathToken string
+	switch {
+	case path == "", path+"/" == protocol.PathPrefix:
+	case strings.HasPrefix(path+"/", protocol.UploadPathPrefix):
+		return "", errors.NewUserError(
+			"This is an upload URL; did you mean warp push?",
+			[]string{
+				"Open the URL in a browser to upload files to it",
+				"Ask the sender for the download URL (http://host:port/d/token)",
+			},
+			nil,
+		)
+	case strings.HasPrefix(path, protocol.PathPrefix):
+		pathToken = strings.TrimPrefix(path, protocol.PathPrefix)
+	case strings.Count(path, "/") == 1:
+		// host:port/token without the /d/ prefix
+		pathToken = strings.TrimPrefix(path, "/")
+	default:
+		return "", errors.InvalidURLError(arg, fmt.Errorf("unexpected path %q; %s", u.Path, acceptedURLForms))
+	}
+
+	switch {
+	case pathToken != "" && token != "" && pathToken != token:
+		return "", errors.InvalidURLError(arg, fmt.Errorf("URL token %q does not match --token %q", pathToken, token))
+	case pathToken == "" && token == "":
+		return "", errors.InvalidURLError(arg, fmt.Errorf("missing token; %s", acceptedURLForms))
+	case pathToken != "":
+		token = pathToken
+	}
+	if !validToken(token) {
+		return "", errors.InvalidURLError(arg, fmt.Errorf("token %q contains invalid characters", token))
+	}
+
+	canonical := url.URL{Scheme: u.Scheme, Host: u.Host, Path: protocol.PathPrefix + token, RawQuery: u.RawQuery}
+	return canonical.String(), nil
+}
+
+// NormalizeUploadURL turns what a user pasted into the canonical host-mode
+// upload URL (http://host:port/u/token). The scheme and trailing slashes are
+// optional.
+func NormalizeUploadURL(arg string) (string, error) {
+	arg = strings.TrimSpace(arg)
+	raw := arg
+	if !strings.Contains(raw, "://") {
+		raw = "http://" + raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", errors.InvalidURLError(arg, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", errors.InvalidURLError(arg, fmt.Errorf("unsupported scheme %q; want http://host:port/u/token", u.Scheme))
+	}
+	if u.Host == "" || u.Hostname() == "" {
+		return "", errors.InvalidURLError(arg, fmt.Errorf("missing host; want http://host:port/u/token"))
+	}
+	path := strings.TrimRight(u.Path, "/")
+	if strings.HasPrefix(path+"/", protocol.PathPrefix) {
+		return "", errors.NewUserError(
+			"This is a download URL; warp push needs the upload URL of a warp host server",
+			[]string{"Start the receiving side with warp host and use the /u/ URL it prints"},
+			nil,
+		)
+	}
+	token := strings.TrimPrefix(path, protocol.UploadPathPrefix)
+	if token == path || !validToken(token) {
+		return "", errors.InvalidURLError(arg, fmt.Errorf("unexpected path %q; want http://host:port/u/token", u.Path))
+	}
+	canonical := url.URL{Scheme: u.Scheme, Host: u.Host, Path: protocol.UploadPathPrefix + token}
+	return canonical.String(), nil
+}
+
+// validToken reports whether t only uses URL-safe token characters
+func validToken(t string) bool {
+	if t == "" {
+		return false
+	}
+	for _, r := range t {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_':
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,111 @@
+package client
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/zulfikawr/warp/internal/errors"
+)
+
+func TestNormalizeReceiveURL(t *testing.T) {
+	const want = "http://192.168.1.7:52314/d/AbC123"
+	tests := []struct {
+		name  string
+		arg   string
+		host  string
+		token string
+		want  string
+		err   string // substring of the error; empty means success
+	}{
+		{name: "full URL", arg: "http://192.168.1.7:52314/d/AbC123", want: want},
+		{name: "full URL trailing slash", arg: "http://192.168.1.7:52314/d/AbC123/", want: want},
+		{name: "https kept", arg: "https://192.168.1.7:52314/d/AbC123", want: "https://192.168.1.7:52314/d/AbC123"},
+		{name: "uppercase scheme", arg: "HTTP://192.168.1.7:52314/d/AbC123", want: want},
+		{name: "surrounding whitespace", arg: "  http://192.168.1.7:52314/d/AbC123\n", want: want},
+		{name: "scheme-less", arg: "192.168.1.7:52314/d/AbC123", want: want},
+		{name: "scheme-less trailing slash", arg: "192.168.1.7:52314/d/AbC123/", want: want},
+		{name: "scheme-less without /d/", arg: "192.168.1.7:52314/AbC123", want: want},
+		{name: "hostname", arg: "laptop.local:52314/d/AbC123", want: "http://laptop.local:52314/d/AbC123"},
+		{name: "IPv6", arg: "[fe80::1]:52314/d/AbC123", want: "http://[fe80::1]:52314/d/AbC123"},
+		{name: "query preserved", arg: "192.168.1.7:52314/d/AbC123?x=1", want: want + "?x=1"},
+		{name: "host:port with --token", arg: "192.168.1.7:52314", token: "AbC123", want: want},
+		{name: "host:port slash with --token", arg: "192.168.1.7:52314/", token: "AbC123", want: want},
+		{name: "host:port /d/ with --token", arg: "192.168.1.7:52314/d/", token: "AbC123", want: want},
+		{name: "URL with matching --token", arg: want, token: "AbC123", want: want},
+		{name: "token with --host", arg: "AbC123", host: "192.168.1.7:52314", want: want},
+		{name: "token with --host URL", arg: "AbC123", host: "http://192.168.1.7:52314/", want: want},
+		{name: "--host and --token only", host: "192.168.1.7:52314", token: "AbC123", want: want},
+
+		{name: "empty", err: "missing host or token"},
+		{name: "host only", arg: "192.168.1.7:52314", err: "missing token"},
+		{name: "--host without token", host: "192.168.1.7:52314", err: "missing host or token"},
+		{name: "conflicting tokens", arg: want, token: "Other", err: "does not match"},
+		{name: "token twice", arg: "AbC123", host: "192.168.1.7:52314", token: "Other", err: "token given twice"},
+		{name: "URL with --host", arg: want, host: "192.168.1.7:52314", err: "--host cannot be combined"},
+		{name: "unsupported scheme", arg: "ftp://192.168.1.7:52314/d/AbC123", err: "unsupported scheme"},
+		{name: "missing host", arg: "http:///d/AbC123", err: "missing host"},
+		{name: "deep path", arg: "192.168.1.7:52314/x/y/AbC123", err: "unexpected path"},
+		{name: "stop URL", arg: "192.168.1.7:52314/d/AbC123/stop", err: "invalid characters"},
+		{name: "bad token chars", arg: "192.168.1.7:52314/d/AbC%20123", err: "invalid characters"},
+		{name: "unparseable", arg: "http://192.168.1.7:bad/d/AbC123", err: "Invalid URL"},
+		{name: "upload URL", arg: "http://192.168.1.7:52314/u/AbC123", err: "did you mean warp push"},
+		{name: "upload URL scheme-less", arg: "192.168.1.7:52314/u/AbC123/", err: "did you mean warp push"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NormalizeReceiveURL(tt.arg, tt.host, tt.token)
+			if tt.err == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if got != tt.want {
+					t.Fatalf("got %q, want %q", got, tt.want)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("got %q, want error containing %q", got, tt.err)
+			}
+			if !errors.IsUserError(err) {
+				t.Errorf("error %T is not a UserError", err)
+			}
+			if !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("error %q does not contain %q", err.Error(), tt.err)
+			}
+		})
+	}
+}
+
+func TestNormalizeUploadURL(t *testing.T) {
+	const want = "http://192.168.1.7:52314/u/AbC123"
+	tests := []struct {
+		name string
+		arg  string
+		want string
+		err  string // substring of the error; empty means success
+	}{
+		{name: "full URL", arg: want, want: want},
+		{name: "scheme-less trailing slash", arg: "192.168.1.7:52314/u/AbC123/", want: want},
+		{name: "https kept", arg: "https://192.168.1.7:52314/u/AbC123", want: "https://192.168.1.7:52314/u/AbC123"},
+		{name: "download URL", arg: "http://192.168.1.7:52314/d/AbC123", err: "download URL"},
+		{name: "no token", arg: "192.168.1.7:52314/u/", err: "unexpected path"},
+		{name: "no path", arg: "192.168.1.7:52314", err: "unexpected path"},
+		{name: "deep path", arg: "192.168.1.7:52314/u/AbC123/manifest", err: "unexpected path"},
+		{name: "unsupported scheme", arg: "ftp://192.168.1.7:52314/u/AbC123", err: "unsupported scheme"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NormalizeUploadURL(tt.arg)
+			if tt.err == "" {
+				if err != nil || got != tt.want {
+					t.Fatalf("got %q, %v; want %q", got, err, tt.want)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("got %q, %v; want error containing %q", got, err, tt.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+
+	"github.com/zulfikawr/warp/internal/ui"
+)
+
+// ErrNoShareChecksum means a share doesn't announce its file's checksum:
+// directories, text and followed files have none until they have been sent
+var ErrNoShareChecksum = errors.New("the share doesn't announce a checksum")
+
+// ShareSHA256 reads the SHA-256 the share at shareURL announces for its
+// file in its /info document
+func (d *Downloader) ShareSHA256(ctx context.Context, shareURL string) (string, error) {
+	caps, err := d.Info(ctx, shareURL)
+	if err != nil {
+		return "", err
+	}
+	if caps.SHA256 == "" {
+		return "", fmt.Errorf("%w; only single-file shares do", ErrNoShareChecksum)
+	}
+	return ParseSHA256(caps.SHA256)
+}
+
+// VerifyFile hashes the file at path, showing progress on renderer if it
+// isn't nil, and compares the result with want. It returns the file's
+// SHA-256; a different one is an ErrChecksumMismatch.
+func VerifyFile(path, want string, renderer ui.Renderer) (string, error) {
+	got, _, err := HashFile(path, renderer)
+	if err != nil {
+		return "", err
+	}
+	if got != want {
+		return got, fmt.Errorf("%w: %s: expected %s, got %s", ErrChecksumMismatch, filepath.Base(path), abbrev(want), abbrev(got))
+	}
+	return got, nil
+}
@@ -0,0 +1,97 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/zulfikawr/warp/internal/protocol"
+	"github.com/zulfikawr/warp/internal/ui"
+)
+
+// countingRenderer records what a hash showed of its progress
+type countingRenderer struct {
+	starts, finishes int
+	last             ui.TransferState
+}
+
+func (r *countingRenderer) Start(s ui.TransferState)  { r.starts++; r.last = s }
+func (r *countingRenderer) Update(s ui.TransferState) { r.last = s }
+func (r *countingRenderer) Finish(ui.Summary)         { r.finishes++ }
+
+func TestVerifyFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "report.pdf")
+	if err := os.WriteFile(path, []byte("hello"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	r := &countingRenderer{}
+	got, err := VerifyFile(path, hexSum("hello"), r)
+	if err != nil || got != hexSum("hello") {
+		t.Fatalf("match: got %q, %v", got, err)
+	}
+	if r.starts != 1 || r.finishes != 1 || r.last.Current != 5 || r.last.Total != 5 {
+		t.Errorf("progress: %d starts, %d finishes, last %+v", r.starts, r.finishes, r.last)
+	}
+
+	got, err = VerifyFile(path, hexSum("goodbye"), nil)
+	if !errors.Is(err, ErrChecksumMismatch) || got != hexSum("hello") {
+		t.Errorf("mismatch: got %q, %v", got, err)
+	}
+
+	if _, err := VerifyFile(filepath.Join(t.TempDir(), "missing"), hexSum("hello"), nil); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("missing file: %v", err)
+	}
+	if _, err := VerifyFile(t.TempDir(), hexSum("hello"), nil); err == nil || errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("directory: %v", err)
+	}
+}
+
+func TestShareSHA256(t *testing.T) {
+	infos := map[string]protocol.Capabilities{
+		"/d/file":  {Version: "1", Mode: "send", Name: "report.pdf", Size: 5, SHA256: hexSum("hello")},
+		"/d/dir":   {Version: "1", Mode: "send", Name: "photos.zip"},
+		"/d/bogus": {Version: "1", Mode: "send", Name: "x", SHA256: "not-hex"},
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for share, caps := range infos {
+			if r.URL.Path == share+protocol.InfoPathSuffix {
+				_ = json.NewEncoder(w).Encode(caps)
+				return
+			}
+		}
+		http.NotFound(w, r)
+	}))
+	defer ts.Close()
+	d := NewDownloader(nil)
+	ctx := context.Background()
+
+	sum, err := d.ShareSHA256(ctx, ts.URL+"/d/file")
+	if err != nil || sum != hexSum("hello") {
+		t.Errorf("file share: %q, %v", sum, err)
+	}
+	path := filepath.Join(t.TempDir(), "report.pdf")
+	if err := os.WriteFile(path, []byte("hello"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := VerifyFile(path, sum, nil); err != nil {
+		t.Errorf("verify against the share: %v", err)
+	}
+
+	if _, err := d.ShareSHA256(ctx, ts.URL+"/d/dir"); !errors.Is(err, ErrNoShareChecksum) {
+		t.Errorf("directory share: %v", err)
+	}
+	if _, err := d.ShareSHA256(ctx, ts.URL+"/d/bogus"); err == nil {
+		t.Error("invalid checksum accepted")
+	}
+	var se *StatusError
+	if _, err := d.ShareSHA256(ctx, ts.URL+"/d/gone"); !errors.As(err, &se) || se.StatusCode != http.StatusNotFound {
+		t.Errorf("stopped share: %v", err)
+	}
+}
@@ -2,25 +2,103 @@ package config
 
 import (
 	"fmt"
+	"net/netip"
 	"os"
 	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
 
 	"github.com/spf13/viper"
 )
 
+// envPrefix starts the environment variable of every key, e.g.
+// WARP_RATE_LIMIT_MBPS for rate_limit_mbps
+const envPrefix = "WARP"
+
+// envKeyReplacer maps key separators to the underscores env names use
+var envKeyReplacer = strings.NewReplacer(".", "_", "-", "_")
+
+// configFileUsed is the file the last LoadConfig read, if any
+var configFileUsed string
+
+// explicitPath is the file SetPath chose; "" searches the usual places
+var explicitPath string
+
+// SetPath makes LoadConfig read, and SaveConfig write, path instead of
+// searching for warp.yaml (the global --config flag). Unlike a searched
+// file, a missing path is an error.
+func SetPath(path string) {
+	explicitPath = path
+}
+
+// Origin tells where a setting's value came from
+type Origin string
+
+const (
+	OriginDefault Origin = "default"
+	OriginFile    Origin = "file"
+	OriginEnv     Origin = "env"
+)
+
 // Config represents the application configuration
 type Config struct {
-	DefaultInterface string  `mapstructure:"default_interface"`
-	DefaultPort      int     `mapstructure:"default_port"`
-	BufferSize       int     `mapstructure:"buffer_size"`
-	MaxUploadSize    int64   `mapstructure:"max_upload_size"`
-	RateLimitMbps    float64 `mapstructure:"rate_limit_mbps"`
-	CacheSizeMB      int64   `mapstructure:"cache_size_mb"`
-	ChunkSizeMB      int     `mapstructure:"chunk_size_mb"`
-	ParallelWorkers  int     `mapstructure:"parallel_workers"`
-	NoQR             bool    `mapstructure:"no_qr"`
-	NoChecksum       bool    `mapstructure:"no_checksum"`
-	UploadDir        string  `mapstructure:"upload_dir"`
+	DefaultInterface string   `mapstructure:"default_interface"`
+	DefaultPort      int      `mapstructure:"default_port"`
+	BufferSize       int      `mapstructure:"buffer_size"`
+	MaxUploadSize    int64    `mapstructure:"max_upload_size"`
+	RateLimitMbps    float64  `mapstructure:"rate_limit_mbps"`
+	CacheSizeMB      int64    `mapstructure:"cache_size_mb"`
+	ChunkSizeMB      int      `mapstructure:"chunk_size_mb"`
+	ParallelWorkers  int      `mapstructure:"parallel_workers"`
+	NoQR             bool     `mapstructure:"no_qr"`
+	NoChecksum       bool     `mapstructure:"no_checksum"`
+	UploadDir        string   `mapstructure:"upload_dir"`
+	StdinSpillMB     int      `mapstructure:"stdin_spill_mb"`
+	TempDir          string   `mapstructure:"temp_dir"`
+	SyncPolicy       string   `mapstructure:"sync_policy"`
+	Preallocate      string   `mapstructure:"preallocate"`
+	Discovery        string   `mapstructure:"discovery"`
+	AllowIPs         []string `mapstructure:"allow_ips"`
+	DenyIPs          []string `mapstructure:"deny_ips"`
+	LowMemory        bool     `mapstructure:"low_memory"`
+	Notifications    bool     `mapstructure:"notifications"`
+	QUIC             string   `mapstructure:"quic"`
+	Brotli           bool     `mapstructure:"brotli"`
+	MaxChunks        int      `mapstructure:"max_chunks"`
+	MaxChunkSizeMB   int      `mapstructure:"max_chunk_size_mb"`
+	SessionIdleMin   int      `mapstructure:"session_idle_minutes"`
+	Language         string   `mapstructure:"language"`
+	SpeedUnits       string   `mapstructure:"speed_units"`
+	UploadPage       string   `mapstructure:"upload_page"`
+
+	origins map[string]Origin // key -> source, filled by LoadConfig
+}
+
+// Keys returns every config key, in the order Config declares them
+func Keys() []string {
+	t := reflect.TypeOf(Config{})
+	keys := make([]string, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		if key := t.Field(i).Tag.Get("mapstructure"); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// EnvVar names the environment variable that overrides key
+func EnvVar(key string) string {
+	return envPrefix + "_" + strings.ToUpper(envKeyReplacer.Replace(key))
+}
+
+// Origin reports where key's value came from. Command-line flags are applied
+// by each command on top of the loaded config, so they never show up here.
+func (c *Config) Origin(key string) Origin {
+	if o, ok := c.origins[key]; ok {
+		return o
+	}
+	return OriginDefault
 }
 
 // DefaultConfig returns the default configuration
@@ -37,62 +115,168 @@ func DefaultConfig() *Config {
 		NoQR:             false,
 		NoChecksum:       false,
 		UploadDir:        ".",
+		StdinSpillMB:     8,  // 8MB
+		TempDir:          "", // system default
+		SyncPolicy:       "none",
+		Preallocate:      "sparse",
+		Discovery:        "mdns",
+		LowMemory:        false, // auto-detected below LowMemoryThreshold
+		Notifications:    false,
+		QUIC:             "auto",
+		Brotli:           true,
+		MaxChunks:        100000, // per upload
+		MaxChunkSizeMB:   100,    // 100MB
+		SessionIdleMin:   60,     // 1 hour
+		Language:         "",     // WARP_LANG or the system locale
+		SpeedUnits:       "bits", // Mbps, as links are rated
+		UploadPage:       "",     // The embedded upload page
 	}
 }
 
 // LoadConfig loads configuration from file or creates default config
 func LoadConfig() (*Config, error) {
 	config := DefaultConfig()
+	// A fresh instance, so repeated loads don't pile up search paths
+	v := viper.New()
 
 	// Set config file name and type
-	viper.SetConfigName("warp")
-	viper.SetConfigType("yaml")
-
-	// Add config paths in order of priority
-	if homeDir, err := os.UserHomeDir(); err == nil {
-		viper.AddConfigPath(filepath.Join(homeDir, ".config", "warp"))
-		viper.AddConfigPath(homeDir) // for .warp.yaml
-	}
-	viper.AddConfigPath("/etc/warp")
-	viper.AddConfigPath(".")
-
-	// Set environment variable prefix
-	viper.SetEnvPrefix("WARP")
-	viper.AutomaticEnv()
-
-	// Try to read config file
-	if err := viper.ReadInConfig(); err != nil {
-		if _, ok := err.(viper.ConfigFileNotFoundError); ok {
-			// Config file not found - use defaults (not an error)
-			return config, nil
+	v.SetConfigName("warp")
+	v.SetConfigType("yaml")
+
+	if explicitPath != "" {
+		if _, err := os.Stat(explicitPath); err != nil {
+			return nil, fmt.Errorf("error reading config file: %w", err)
+		}
+		v.SetConfigFile(explicitPath)
+	} else {
+		// Add config paths in order of priority
+		if homeDir, err := os.UserHomeDir(); err == nil {
+			v.AddConfigPath(filepath.Join(homeDir, ".config", "warp"))
+			v.AddConfigPath(homeDir) // for .warp.yaml
+		}
+		v.AddConfigPath("/etc/warp")
+		v.AddConfigPath(".")
+	}
+
+	// Unmarshal only sees keys viper already knows, which AutomaticEnv alone
+	// never registers, so every key is bound to its WARP_ variable
+	v.SetEnvPrefix(envPrefix)
+	v.SetEnvKeyReplacer(envKeyReplacer)
+	for _, key := range Keys() {
+		if err := v.BindEnv(key); err != nil {
+			return nil, fmt.Errorf("error binding %s: %w", EnvVar(key), err)
 		}
-		// Config file was found but another error occurred (parse error, permission, etc.)
-		// Return the actual error so users know their config is broken
-		return nil, fmt.Errorf("error reading config file: %w", err)
 	}
 
+	// Try to read config file; without one, defaults and env still apply
+	if err := v.ReadInConfig(); err != nil {
+		if _, ok := err.(viper.ConfigFileNotFoundError); !ok {
+			// Config file was found but another error occurred (parse error, permission, etc.)
+			// Return the actual error so users know their config is broken
+			return nil, fmt.Errorf("error reading config file: %w", err)
+		}
+	}
+	configFileUsed = v.ConfigFileUsed()
+
 	// Unmarshal config
-	if err := viper.Unmarshal(config); err != nil {
-		return nil, fmt.Errorf("error parsing config file: %w", err)
+	if err := v.Unmarshal(config); err != nil {
+		return nil, fmt.Errorf("error parsing config: %w", err)
 	}
 
+	config.origins = make(map[string]Origin)
+	for _, key := range Keys() {
+		switch {
+		case os.Getenv(EnvVar(key)) != "":
+			config.origins[key] = OriginEnv
+		case v.InConfig(key):
+			config.origins[key] = OriginFile
+		}
+	}
 	return config, nil
 }
 
-// SaveConfig saves the current configuration to file
-func SaveConfig(config *Config) error {
-	// Create config directory if it doesn't exist
-	homeDir, err := os.UserHomeDir()
-	if err != nil {
-		return fmt.Errorf("cannot get home directory: %w", err)
+// Validate reports the first setting that is out of range
+func (c *Config) Validate() error {
+	switch {
+	case c.DefaultPort < 0 || c.DefaultPort > 65535:
+		return fmt.Errorf("default_port must be between 0 and 65535, got %d", c.DefaultPort)
+	case c.BufferSize <= 0:
+		return fmt.Errorf("buffer_size must be positive, got %d", c.BufferSize)
+	case c.MaxUploadSize <= 0:
+		return fmt.Errorf("max_upload_size must be positive, got %d", c.MaxUploadSize)
+	case c.RateLimitMbps < 0:
+		return fmt.Errorf("rate_limit_mbps cannot be negative, got %g", c.RateLimitMbps)
+	case c.CacheSizeMB < 0:
+		return fmt.Errorf("cache_size_mb cannot be negative, got %d", c.CacheSizeMB)
+	case c.ChunkSizeMB <= 0:
+		return fmt.Errorf("chunk_size_mb must be positive, got %d", c.ChunkSizeMB)
+	case c.ParallelWorkers <= 0:
+		return fmt.Errorf("parallel_workers must be positive, got %d", c.ParallelWorkers)
+	case c.StdinSpillMB < 0:
+		return fmt.Errorf("stdin_spill_mb cannot be negative, got %d", c.StdinSpillMB)
+	case c.SyncPolicy != "" && c.SyncPolicy != "none" && c.SyncPolicy != "file" && c.SyncPolicy != "chunk":
+		return fmt.Errorf("sync_policy must be file, chunk or none, got %q", c.SyncPolicy)
+	case c.Preallocate != "" && c.Preallocate != "off" && c.Preallocate != "sparse" && c.Preallocate != "full":
+		return fmt.Errorf("preallocate must be off, sparse or full, got %q", c.Preallocate)
+	case c.Discovery != "" && c.Discovery != "mdns" && c.Discovery != "broadcast" && c.Discovery != "both":
+		return fmt.Errorf("discovery must be mdns, broadcast or both, got %q", c.Discovery)
+	case !validQUIC(c.QUIC):
+		return fmt.Errorf("quic must be off, auto or a UDP port, got %q", c.QUIC)
+	case c.MaxChunks <= 0:
+		return fmt.Errorf("max_chunks must be positive, got %d", c.MaxChunks)
+	case c.MaxChunkSizeMB <= 0:
+		return fmt.Errorf("max_chunk_size_mb must be positive, got %d", c.MaxChunkSizeMB)
+	case c.SessionIdleMin <= 0:
+		return fmt.Errorf("session_idle_minutes must be positive, got %d", c.SessionIdleMin)
+	case c.SpeedUnits != "" && c.SpeedUnits != "bits" && c.SpeedUnits != "bytes":
+		return fmt.Errorf("speed_units must be bits or bytes, got %q", c.SpeedUnits)
 	}
+	if err := validateIPList("allow_ips", c.AllowIPs); err != nil {
+		return err
+	}
+	return validateIPList("deny_ips", c.DenyIPs)
+}
 
-	configDir := filepath.Join(homeDir, ".config", "warp")
-	if err := os.MkdirAll(configDir, 0755); err != nil {
-		return fmt.Errorf("cannot create config directory: %w", err)
+// validQUIC reports whether v is off, auto, empty or a port from 1 to 65535
+func validQUIC(v string) bool {
+	switch v {
+	case "", "off", "auto":
+		return true
 	}
+	port, err := strconv.Atoi(v)
+	return err == nil && port >= 1 && port <= 65535
+}
 
-	configPath := filepath.Join(configDir, "warp.yaml")
+// validateIPList checks that every entry is a CIDR or a single IP address
+func validateIPList(key string, list []string) error {
+	for _, v := range list {
+		if _, err := netip.ParsePrefix(v); err == nil {
+			continue
+		}
+		if _, err := netip.ParseAddr(v); err != nil {
+			return fmt.Errorf("%s entries must be CIDRs or IP addresses, got %q", key, v)
+		}
+	}
+	return nil
+}
+
+// SaveConfig saves the current configuration to file
+func SaveConfig(config *Config) error {
+	configPath := explicitPath
+	if configPath == "" {
+		// Create config directory if it doesn't exist
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return fmt.Errorf("cannot get home directory: %w", err)
+		}
+
+		configDir := filepath.Join(homeDir, ".config", "warp")
+		if err := os.MkdirAll(configDir, 0755); err != nil {
+			return fmt.Errorf("cannot create config directory: %w", err)
+		}
+
+		configPath = filepath.Join(configDir, "warp.yaml")
+	}
 
 	// Set values in viper
 	viper.Set("default_interface", config.DefaultInterface)
@@ -106,6 +290,26 @@ func SaveConfig(config *Config) error {
 	viper.Set("no_qr", config.NoQR)
 	viper.Set("no_checksum", config.NoChecksum)
 	viper.Set("upload_dir", config.UploadDir)
+	viper.Set("stdin_spill_mb", config.StdinSpillMB)
+	viper.Set("temp_dir", config.TempDir)
+	viper.Set("sync_policy", config.SyncPolicy)
+	viper.Set("preallocate", config.Preallocate)
+	viper.Set("discovery", config.Discovery)
+	viper.Set("allow_ips", config.AllowIPs)
+	viper.Set("deny_ips", config.DenyIPs)
+	// Written only when on, so a saved config keeps auto-detection
+	if config.LowMemory {
+		viper.Set("low_memory", true)
+	}
+	viper.Set("notifications", config.Notifications)
+	viper.Set("quic", config.QUIC)
+	viper.Set("brotli", config.Brotli)
+	viper.Set("max_chunks", config.MaxChunks)
+	viper.Set("max_chunk_size_mb", config.MaxChunkSizeMB)
+	viper.Set("session_idle_minutes", config.SessionIdleMin)
+	viper.Set("language", config.Language)
+	viper.Set("speed_units", config.SpeedUnits)
+	viper.Set("upload_page", config.UploadPage)
 
 	// Write config file
 	if err := viper.WriteConfigAs(configPath); err != nil {
@@ -117,8 +321,11 @@ func SaveConfig(config *Config) error {
 
 // GetConfigPath returns the path to the config file
 func GetConfigPath() string {
-	if viper.ConfigFileUsed() != "" {
-		return viper.ConfigFileUsed()
+	if explicitPath != "" {
+		return explicitPath
+	}
+	if configFileUsed != "" {
+		return configFileUsed
 	}
 
 	homeDir, err := os.UserHomeDir()
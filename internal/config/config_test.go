@@ -117,3 +117,160 @@ func TestGetConfigPath(t *testing.T) {
 		t.Errorf("GetConfigPath returned unexpected relative path: %s", path)
 	}
 }
+
+func TestConfigValidate(t *testing.T) {
+	if err := DefaultConfig().Validate(); err != nil {
+		t.Fatalf("default config invalid: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		mutate func(*Config)
+	}{
+		{"port too high", func(c *Config) { c.DefaultPort = 70000 }},
+		{"zero chunk size", func(c *Config) { c.ChunkSizeMB = 0 }},
+		{"zero workers", func(c *Config) { c.ParallelWorkers = 0 }},
+		{"negative rate limit", func(c *Config) { c.RateLimitMbps = -1 }},
+		{"unknown sync policy", func(c *Config) { c.SyncPolicy = "always" }},
+		{"unknown preallocate mode", func(c *Config) { c.Preallocate = "eager" }},
+		{"unknown discovery mode", func(c *Config) { c.Discovery = "dns" }},
+		{"unknown quic setting", func(c *Config) { c.QUIC = "on" }},
+		{"quic port out of range", func(c *Config) { c.QUIC = "70000" }},
+		{"zero max chunks", func(c *Config) { c.MaxChunks = 0 }},
+		{"negative max chunk size", func(c *Config) { c.MaxChunkSizeMB = -1 }},
+		{"zero session idle time", func(c *Config) { c.SessionIdleMin = 0 }},
+		{"malformed allow entry", func(c *Config) { c.AllowIPs = []string{"10.1.2.0/24", "10.1.2"} }},
+		{"malformed deny entry", func(c *Config) { c.DenyIPs = []string{"example.com"} }},
+	}
+	for _, tt := range tests {
+		cfg := DefaultConfig()
+		tt.mutate(cfg)
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("%s: expected validation error", tt.name)
+		}
+	}
+}
+
+// writeHomeConfig points HOME at a temp dir holding a warp.yaml with body
+func writeHomeConfig(t *testing.T, body string) {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	dir := filepath.Join(home, ".config", "warp")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "warp.yaml"), []byte(body), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEnvVar(t *testing.T) {
+	if got := EnvVar("rate_limit_mbps"); got != "WARP_RATE_LIMIT_MBPS" {
+		t.Errorf("EnvVar(rate_limit_mbps) = %q", got)
+	}
+	keys := Keys()
+	if len(keys) != 28 || keys[0] != "default_interface" || keys[len(keys)-1] != "upload_page" {
+		t.Errorf("Keys() = %v", keys)
+	}
+}
+
+func TestLoadConfig_EnvWithoutFile(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("WARP_RATE_LIMIT_MBPS", "10")
+	t.Setenv("WARP_ALLOW_IPS", "10.0.0.0/8,192.168.1.5")
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if cfg.RateLimitMbps != 10 {
+		t.Errorf("RateLimitMbps = %g, want 10", cfg.RateLimitMbps)
+	}
+	if len(cfg.AllowIPs) != 2 || cfg.AllowIPs[1] != "192.168.1.5" {
+		t.Errorf("AllowIPs = %v", cfg.AllowIPs)
+	}
+	if cfg.ChunkSizeMB != 2 {
+		t.Errorf("ChunkSizeMB = %d, want the default 2", cfg.ChunkSizeMB)
+	}
+	if o := cfg.Origin("rate_limit_mbps"); o != OriginEnv {
+		t.Errorf("rate_limit_mbps origin = %s, want env", o)
+	}
+	if o := cfg.Origin("chunk_size_mb"); o != OriginDefault {
+		t.Errorf("chunk_size_mb origin = %s, want default", o)
+	}
+}
+
+func TestLoadConfig_EnvOverridesFile(t *testing.T) {
+	writeHomeConfig(t, "rate_limit_mbps: 5\nupload_dir: /from/file\nchunk_size_mb: 4\nparallel_workers: 6\n")
+	t.Setenv("WARP_RATE_LIMIT_MBPS", "10")
+	t.Setenv("WARP_UPLOAD_DIR", "/from/env")
+	t.Setenv("WARP_CHUNK_SIZE_MB", "8")
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if cfg.RateLimitMbps != 10 {
+		t.Errorf("RateLimitMbps = %g, want 10 from env", cfg.RateLimitMbps)
+	}
+	if cfg.UploadDir != "/from/env" {
+		t.Errorf("UploadDir = %q, want /from/env", cfg.UploadDir)
+	}
+	if cfg.ChunkSizeMB != 8 {
+		t.Errorf("ChunkSizeMB = %d, want 8 from env", cfg.ChunkSizeMB)
+	}
+	if cfg.ParallelWorkers != 6 {
+		t.Errorf("ParallelWorkers = %d, want 6 from file", cfg.ParallelWorkers)
+	}
+
+	origins := map[string]Origin{
+		"rate_limit_mbps":  OriginEnv,
+		"upload_dir":       OriginEnv,
+		"chunk_size_mb":    OriginEnv,
+		"parallel_workers": OriginFile,
+		"buffer_size":      OriginDefault,
+	}
+	for key, want := range origins {
+		if got := cfg.Origin(key); got != want {
+			t.Errorf("%s origin = %s, want %s", key, got, want)
+		}
+	}
+}
+
+func TestLoadConfig_EmptyEnvIsIgnored(t *testing.T) {
+	writeHomeConfig(t, "chunk_size_mb: 4\n")
+	t.Setenv("WARP_CHUNK_SIZE_MB", "")
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if cfg.ChunkSizeMB != 4 || cfg.Origin("chunk_size_mb") != OriginFile {
+		t.Errorf("ChunkSizeMB = %d from %s, want 4 from file", cfg.ChunkSizeMB, cfg.Origin("chunk_size_mb"))
+	}
+}
+
+func TestSetPath(t *testing.T) {
+	writeHomeConfig(t, "rate_limit_mbps: 5\n")
+	path := filepath.Join(t.TempDir(), "other.yaml")
+	SetPath(path)
+	defer SetPath("")
+
+	if _, err := LoadConfig(); err == nil {
+		t.Error("LoadConfig succeeded with a missing --config file")
+	}
+	if err := SaveConfig(&Config{RateLimitMbps: 7}); err != nil {
+		t.Fatalf("SaveConfig failed: %v", err)
+	}
+	if got := GetConfigPath(); got != path {
+		t.Errorf("GetConfigPath() = %q, want %q", got, path)
+	}
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if cfg.RateLimitMbps != 7 {
+		t.Errorf("RateLimitMbps = %g, want 7 from the --config file", cfg.RateLimitMbps)
+	}
+}
@@ -0,0 +1,49 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// LowMemoryThreshold is the total system memory below which low-memory mode
+// turns itself on, e.g. on a Raspberry Pi Zero
+const LowMemoryThreshold = 1 << 30 // 1GB
+
+// DetectLowMemory turns LowMemory on when total, the system memory in bytes,
+// is below LowMemoryThreshold. A low_memory set in the config file or the
+// environment, either way, is left alone, as is an unknown total of 0. It
+// reports whether it turned the mode on.
+func (c *Config) DetectLowMemory(total int64) bool {
+	if c.LowMemory || c.Origin("low_memory") != OriginDefault || total <= 0 || total >= LowMemoryThreshold {
+		return false
+	}
+	c.LowMemory = true
+	return true
+}
+
+// parseMemTotal returns the MemTotal line of /proc/meminfo in bytes
+func parseMemTotal(r io.Reader) (int64, error) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		rest, ok := strings.CutPrefix(scanner.Text(), "MemTotal:")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(rest)
+		if len(fields) != 2 || fields[1] != "kB" {
+			return 0, fmt.Errorf("malformed MemTotal line: %q", scanner.Text())
+		}
+		kb, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("malformed MemTotal line: %w", err)
+		}
+		return kb * 1024, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	return 0, fmt.Errorf("no MemTotal line")
+}
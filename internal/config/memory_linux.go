@@ -0,0 +1,15 @@
+//go:build linux
+
+package config
+
+import "os"
+
+// TotalMemory returns the system's total memory in bytes
+func TotalMemory() (int64, error) {
+	f, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = f.Close() }()
+	return parseMemTotal(f)
+}
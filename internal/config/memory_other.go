@@ -0,0 +1,11 @@
+//go:build !linux
+
+package config
+
+import "errors"
+
+// TotalMemory cannot determine the system memory on this platform, so
+// low-memory mode is only turned on explicitly
+func TotalMemory() (int64, error) {
+	return 0, errors.ErrUnsupported
+}
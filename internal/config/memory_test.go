@@ -0,0 +1,66 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+// piZeroMeminfo is the start of /proc/meminfo on a Raspberry Pi Zero 2 W
+const piZeroMeminfo = `MemTotal:         439964 kB
+MemFree:          211508 kB
+MemAvailable:     336836 kB
+Buffers:           15728 kB
+`
+
+func TestParseMemTotal(t *testing.T) {
+	got, err := parseMemTotal(strings.NewReader(piZeroMeminfo))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := int64(439964 * 1024); got != want {
+		t.Errorf("parseMemTotal = %d, want %d", got, want)
+	}
+
+	for _, bad := range []string{"", "MemFree: 1 kB\n", "MemTotal: lots kB\n", "MemTotal: 1024\n"} {
+		if _, err := parseMemTotal(strings.NewReader(bad)); err == nil {
+			t.Errorf("parseMemTotal(%q) should fail", bad)
+		}
+	}
+}
+
+func TestLowMemoryFromMeminfo(t *testing.T) {
+	total, err := parseMemTotal(strings.NewReader(piZeroMeminfo))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := DefaultConfig()
+	if !cfg.DetectLowMemory(total) {
+		t.Fatal("a 430MB machine should turn low-memory mode on")
+	}
+	if !cfg.LowMemory {
+		t.Error("DetectLowMemory reported true but left LowMemory off")
+	}
+}
+
+func TestDetectLowMemoryLeavesOthersAlone(t *testing.T) {
+	tests := []struct {
+		name  string
+		total int64
+		setup func(*Config)
+	}{
+		{"8GB", 8 << 30, nil},
+		{"unknown", 0, nil},
+		{"set in config file", 256 << 20, func(c *Config) { c.origins = map[string]Origin{"low_memory": OriginFile} }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			if tt.setup != nil {
+				tt.setup(cfg)
+			}
+			if cfg.DetectLowMemory(tt.total) || cfg.LowMemory {
+				t.Error("low-memory mode should stay off")
+			}
+		})
+	}
+}
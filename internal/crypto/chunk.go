@@ -0,0 +1,219 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// Chunks of a parallel upload are sealed independently: they go out in any
+// order, over several connections, and are retried on their own. A nonce
+// counting from zero in every chunk, as EncryptReader's does per stream,
+// would repeat across chunks under one key. Instead each session gets its
+// own key from HKDF over the shared key and the session ID, and each
+// segment of a chunk its own nonce: the chunk ID in the high 8 bytes and
+// the segment's index in the chunk in the low 4.
+
+const (
+	// ChunkSegmentSize is how much plaintext is sealed under one nonce. A
+	// chunk of n bytes is sent as ceil(n/ChunkSegmentSize) segments, at least
+	// one, each followed by its tag.
+	ChunkSegmentSize = 64 * 1024
+	// ChunkTagSize is the GCM tag after each segment
+	ChunkTagSize = 16
+
+	// chunkKeyInfo binds the session key derivation to its purpose
+	chunkKeyInfo = "warp upload chunk key v1"
+	// chunkADLabel starts the additional data of every segment
+	chunkADLabel = "warp chunk v1"
+)
+
+// ErrChunkAuth means a sealed chunk was altered, truncated, moved to
+// another position or session, or sealed with another key
+var ErrChunkAuth = errors.New("chunk failed authentication")
+
+// ChunkPosition is where a chunk belongs in its upload. It is authenticated
+// with every segment, so a chunk opens only at the position it was sealed for.
+type ChunkPosition struct {
+	ID     int   // Index of the chunk in the upload
+	Offset int64 // Where the chunk's plaintext starts in the file
+	Total  int64 // Size of the whole file
+}
+
+// ChunkKey derives the key that seals the chunks of one upload session from
+// a shared key: HKDF-SHA256 with the session ID as salt. Sessions never share
+// nonces under a key, as long as session IDs aren't reused.
+func ChunkKey(key []byte, sessionID string) ([]byte, error) {
+	if sessionID == "" {
+		return nil, errors.New("chunk key needs a session ID")
+	}
+	return hkdf.Key(sha256.New, key, []byte(sessionID), chunkKeyInfo, KeySize)
+}
+
+// SealedChunkSize is the size of a chunk of n plaintext bytes once sealed
+func SealedChunkSize(n int64) int64 {
+	return n + chunkSegments(n)*ChunkTagSize
+}
+
+// OpenedChunkSize is the plaintext size of a sealed chunk of n bytes, or an
+// error when no plaintext seals to n bytes
+func OpenedChunkSize(n int64) (int64, error) {
+	const sealedSegment = ChunkSegmentSize + ChunkTagSize
+	if n < ChunkTagSize {
+		return 0, fmt.Errorf("sealed chunk of %d bytes is shorter than a tag", n)
+	}
+	segments := (n + sealedSegment - 1) / sealedSegment
+	if last := n - (segments-1)*sealedSegment; last < ChunkTagSize {
+		return 0, fmt.Errorf("sealed chunk of %d bytes ends in a partial tag", n)
+	}
+	return n - segments*ChunkTagSize, nil
+}
+
+// chunkSegments is how many segments a chunk of n plaintext bytes takes
+func chunkSegments(n int64) int64 {
+	return max(1, (n+ChunkSegmentSize-1)/ChunkSegmentSize)
+}
+
+// SealChunk encrypts and authenticates one chunk of an upload with a key
+// from ChunkKey
+func SealChunk(chunkKey []byte, pos ChunkPosition, plaintext []byte) ([]byte, error) {
+	gcm, err := chunkAEAD(chunkKey, pos)
+	if err != nil {
+		return nil, err
+	}
+	segments := chunkSegments(int64(len(plaintext)))
+	if segments > math.MaxUint32 {
+		return nil, fmt.Errorf("chunk of %d bytes has too many segments", len(plaintext))
+	}
+	out := make([]byte, 0, SealedChunkSize(int64(len(plaintext))))
+	for i := int64(0); i < segments; i++ {
+		seg := plaintext[i*ChunkSegmentSize : min(int64(len(plaintext)), (i+1)*ChunkSegmentSize)]
+		out = gcm.Seal(out, chunkNonce(pos.ID, uint32(i)), seg, chunkAD(pos, i == segments-1))
+	}
+	return out, nil
+}
+
+// OpenChunk decrypts a chunk sealed by SealChunk for the same key and
+// position
+func OpenChunk(chunkKey []byte, pos ChunkPosition, sealed []byte) ([]byte, error) {
+	r, err := NewChunkReader(chunkKey, pos, bytes.NewReader(sealed), int64(len(sealed)))
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+// NewChunkReader decrypts a sealed chunk of sealedSize bytes from r as it
+// arrives, one segment at a time. Only authenticated plaintext is returned;
+// a segment that fails to open ends the stream with ErrChunkAuth, and a
+// stream that ends early with io.ErrUnexpectedEOF.
+func NewChunkReader(chunkKey []byte, pos ChunkPosition, r io.Reader, sealedSize int64) (io.Reader, error) {
+	if _, err := OpenedChunkSize(sealedSize); err != nil {
+		return nil, err
+	}
+	gcm, err := chunkAEAD(chunkKey, pos)
+	if err != nil {
+		return nil, err
+	}
+	return &chunkReader{
+		r:         r,
+		gcm:       gcm,
+		pos:       pos,
+		remaining: sealedSize,
+		buf:       make([]byte, min(sealedSize, ChunkSegmentSize+ChunkTagSize)),
+	}, nil
+}
+
+type chunkReader struct {
+	r         io.Reader
+	gcm       cipher.AEAD
+	pos       ChunkPosition
+	remaining int64  // Sealed bytes not read yet
+	segment   uint32 // Index of the next segment
+	buf       []byte
+	plain     []byte // Opened but not returned yet
+	err       error
+}
+
+func (c *chunkReader) Read(p []byte) (int, error) {
+	for len(c.plain) == 0 {
+		if c.err != nil {
+			return 0, c.err
+		}
+		c.next()
+	}
+	n := copy(p, c.plain)
+	c.plain = c.plain[n:]
+	return n, nil
+}
+
+// next reads and opens the next segment
+func (c *chunkReader) next() {
+	seg := c.buf[:min(c.remaining, int64(len(c.buf)))]
+	if _, err := io.ReadFull(c.r, seg); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		c.err = err
+		return
+	}
+	c.remaining -= int64(len(seg))
+	final := c.remaining == 0
+	plain, err := c.gcm.Open(seg[:0], chunkNonce(c.pos.ID, c.segment), seg, chunkAD(c.pos, final))
+	if err != nil {
+		c.err = ErrChunkAuth
+		return
+	}
+	c.plain = plain
+	c.segment++
+	if final {
+		c.err = io.EOF
+	}
+}
+
+// chunkAEAD checks pos and returns AES-256-GCM under chunkKey
+func chunkAEAD(chunkKey []byte, pos ChunkPosition) (cipher.AEAD, error) {
+	if pos.ID < 0 || pos.Offset < 0 || pos.Total < 0 {
+		return nil, fmt.Errorf("invalid chunk position %+v", pos)
+	}
+	block, err := aes.NewCipher(chunkKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCM: %w", err)
+	}
+	return gcm, nil
+}
+
+// chunkNonce is the nonce of a segment: the chunk ID in the high 8 bytes and
+// the segment's index in the low 4, so no two segments of a session share one
+func chunkNonce(id int, segment uint32) []byte {
+	nonce := make([]byte, NonceSize)
+	binary.BigEndian.PutUint64(nonce, uint64(id))
+	binary.BigEndian.PutUint32(nonce[8:], segment)
+	return nonce
+}
+
+// chunkAD is the additional data of a segment: the chunk's position, and
+// whether the segment is the chunk's last so a chunk can't be cut short at a
+// segment boundary
+func chunkAD(pos ChunkPosition, final bool) []byte {
+	ad := make([]byte, 0, len(chunkADLabel)+25)
+	ad = append(ad, chunkADLabel...)
+	ad = binary.BigEndian.AppendUint64(ad, uint64(pos.ID))
+	ad = binary.BigEndian.AppendUint64(ad, uint64(pos.Offset))
+	ad = binary.BigEndian.AppendUint64(ad, uint64(pos.Total))
+	if final {
+		return append(ad, 1)
+	}
+	return append(ad, 0)
+}
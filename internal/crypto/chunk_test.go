@@ -0,0 +1,184 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	mrand "math/rand/v2"
+	"testing"
+	"testing/iotest"
+)
+
+// Vectors pin the scheme: HKDF-SHA256 over the shared key with the session
+// ID as salt, the nonce and additional data layouts and the segment size.
+// Changing any of it breaks uploads between old and new versions.
+func TestChunkVectors(t *testing.T) {
+	seq := make([]byte, 32)
+	for i := range seq {
+		seq[i] = byte(i)
+	}
+	key, err := ChunkKey(seq, "0123456789abcdef")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := hex.EncodeToString(key); got != "1a25b6e0d6e2a96f82ce7035cfc001403a4cddc99d29eb67068fd0eaeca4d10b" {
+		t.Errorf("ChunkKey = %s", got)
+	}
+	tests := []struct {
+		pos       ChunkPosition
+		plaintext string
+		want      string
+	}{
+		{ChunkPosition{ID: 1, Offset: 2 << 20, Total: 5 << 20}, "warp", "2b661f4efb5ee53e4e65c5a014c5eff1cd00ce51"},
+		{ChunkPosition{}, "", "bb3e42eb572a621b0a9098b2c1704dfc"},
+	}
+	for _, tt := range tests {
+		sealed, err := SealChunk(key, tt.pos, []byte(tt.plaintext))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := hex.EncodeToString(sealed); got != tt.want {
+			t.Errorf("SealChunk(%+v, %q) = %s, want %s", tt.pos, tt.plaintext, got, tt.want)
+		}
+		opened, err := OpenChunk(key, tt.pos, sealed)
+		if err != nil || string(opened) != tt.plaintext {
+			t.Errorf("OpenChunk = %q, %v", opened, err)
+		}
+	}
+}
+
+func TestChunkRoundTrip(t *testing.T) {
+	key := chunkTestKey(t, "session")
+	for _, n := range []int{0, 1, ChunkSegmentSize - 1, ChunkSegmentSize, ChunkSegmentSize + 1, 3*ChunkSegmentSize + 7} {
+		plaintext := make([]byte, n)
+		_, _ = rand.Read(plaintext)
+		pos := ChunkPosition{ID: 3, Offset: 3 * int64(n), Total: 10 * int64(n)}
+		sealed, err := SealChunk(key, pos, plaintext)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if int64(len(sealed)) != SealedChunkSize(int64(n)) {
+			t.Errorf("%d bytes: sealed %d, SealedChunkSize says %d", n, len(sealed), SealedChunkSize(int64(n)))
+		}
+		if size, err := OpenedChunkSize(int64(len(sealed))); err != nil || size != int64(n) {
+			t.Errorf("%d bytes: OpenedChunkSize = %d, %v", n, size, err)
+		}
+		// Read a byte at a time, as a slow connection would deliver it
+		r, err := NewChunkReader(key, pos, iotest.OneByteReader(bytes.NewReader(sealed)), int64(len(sealed)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := io.ReadAll(iotest.OneByteReader(r))
+		if err != nil || !bytes.Equal(got, plaintext) {
+			t.Errorf("%d bytes: opened %d bytes, %v", n, len(got), err)
+		}
+	}
+}
+
+func TestOpenedChunkSizeRejectsPartialTags(t *testing.T) {
+	for _, n := range []int64{0, ChunkTagSize - 1, ChunkSegmentSize + ChunkTagSize + 5} {
+		if _, err := OpenedChunkSize(n); err == nil {
+			t.Errorf("OpenedChunkSize(%d) succeeded", n)
+		}
+	}
+}
+
+// A sealed chunk opens only under its own session, position and bytes
+func TestChunkTampering(t *testing.T) {
+	key := chunkTestKey(t, "session")
+	pos := ChunkPosition{ID: 2, Offset: 4 << 20, Total: 9 << 20}
+	plaintext := make([]byte, 2*ChunkSegmentSize+100)
+	_, _ = rand.Read(plaintext)
+	sealed, err := SealChunk(key, pos, plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const seg = ChunkSegmentSize + ChunkTagSize
+	swapped := append(append(append([]byte{}, sealed[seg:2*seg]...), sealed[:seg]...), sealed[2*seg:]...)
+	flipped := append([]byte{}, sealed...)
+	flipped[10] ^= 1
+
+	tests := []struct {
+		name   string
+		key    []byte
+		pos    ChunkPosition
+		sealed []byte
+	}{
+		{"other session", chunkTestKey(t, "other"), pos, sealed},
+		{"other chunk ID", key, ChunkPosition{ID: 3, Offset: pos.Offset, Total: pos.Total}, sealed},
+		{"other offset", key, ChunkPosition{ID: pos.ID, Offset: 0, Total: pos.Total}, sealed},
+		{"other total", key, ChunkPosition{ID: pos.ID, Offset: pos.Offset, Total: pos.Total + 1}, sealed},
+		{"flipped bit", key, pos, flipped},
+		{"segments swapped", key, pos, swapped},
+		{"last segment dropped", key, pos, sealed[:2*seg]},
+		{"first segment only", key, pos, sealed[:seg]},
+	}
+	for _, tt := range tests {
+		if _, err := OpenChunk(tt.key, tt.pos, tt.sealed); !errors.Is(err, ErrChunkAuth) {
+			t.Errorf("%s: err = %v, want ErrChunkAuth", tt.name, err)
+		}
+	}
+
+	// A body that ends before its declared size
+	r, err := NewChunkReader(key, pos, bytes.NewReader(sealed[:seg]), int64(len(sealed)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadAll(r); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("short body: err = %v, want io.ErrUnexpectedEOF", err)
+	}
+}
+
+// Every (chunk ID, segment) pair gets its own nonce, and the pair can be
+// read back from it
+func TestChunkNonceUniqueness(t *testing.T) {
+	seen := make(map[string][2]uint64)
+	check := func(id int, segment uint32) {
+		nonce := chunkNonce(id, segment)
+		if len(nonce) != NonceSize {
+			t.Fatalf("nonce is %d bytes", len(nonce))
+		}
+		k := string(nonce)
+		pair := [2]uint64{uint64(id), uint64(segment)}
+		if prev, ok := seen[k]; ok && prev != pair {
+			t.Fatalf("nonce %x used by %v and %v", nonce, prev, pair)
+		}
+		seen[k] = pair
+	}
+	// Exhaustively near the origin, where real uploads live
+	for id := 0; id < 512; id++ {
+		for segment := uint32(0); segment < 64; segment++ {
+			check(id, segment)
+		}
+	}
+	// And at random across the whole space, edges included
+	rng := mrand.New(mrand.NewPCG(1, 2))
+	for i := 0; i < 100000; i++ {
+		check(int(rng.Int64()), rng.Uint32())
+	}
+	for _, id := range []int{0, 1, 1 << 31, 1<<63 - 1} {
+		for _, segment := range []uint32{0, 1, 1 << 31, 1<<32 - 1} {
+			check(id, segment)
+		}
+	}
+}
+
+func TestChunkKeyNeedsSession(t *testing.T) {
+	if _, err := ChunkKey(make([]byte, KeySize), ""); err == nil {
+		t.Error("ChunkKey without a session ID succeeded")
+	}
+	if _, err := SealChunk(chunkTestKey(t, "s"), ChunkPosition{ID: -1}, nil); err == nil {
+		t.Error("SealChunk with a negative chunk ID succeeded")
+	}
+}
+
+func chunkTestKey(t *testing.T, sessionID string) []byte {
+	t.Helper()
+	key, err := ChunkKey(bytes.Repeat([]byte{7}, KeySize), sessionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
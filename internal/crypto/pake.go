@@ -56,3 +56,23 @@ func VerifyConfirmation(key []byte, message []byte, confirmation []byte) error {
 	}
 	return nil
 }
+
+// certLabel keeps a certificate confirmation from ever equalling a key
+// confirmation over the same bytes
+const certLabel = "warp tls certificate\x00"
+
+// CertConfirmation binds the TLS certificate a sender serves, in DER, to the
+// PAKE key, so a receiver can tell the certificate it was shown is the
+// sender's and not one put in by a relay in the middle.
+func CertConfirmation(key, certDER []byte) []byte {
+	sum := sha256.Sum256(certDER)
+	return GenerateConfirmation(key, append([]byte(certLabel), sum[:]...))
+}
+
+// VerifyCertConfirmation checks a CertConfirmation for certDER
+func VerifyCertConfirmation(key, certDER, confirmation []byte) error {
+	if !hmac.Equal(CertConfirmation(key, certDER), confirmation) {
+		return errors.New("TLS certificate isn't the one the PAKE peer serves")
+	}
+	return nil
+}
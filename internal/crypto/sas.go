@@ -0,0 +1,30 @@
+package crypto
+
+import (
+	"crypto/hkdf"
+	"crypto/sha256"
+	"encoding/binary"
+	"strings"
+)
+
+// AuthStringWords is how many words AuthString returns
+const AuthStringWords = 6
+
+// authStringInfo binds the derivation to its purpose, so the string reveals
+// nothing about keys derived from the same session key for other uses
+const authStringInfo = "warp short authentication string v1"
+
+// AuthString derives a short authentication string (SAS) from a PAKE session
+// key: six words from WordList, about 59 bits. Both ends of a handshake hold
+// the same key and so show the same words; a machine-in-the-middle ends up
+// with a different key on each side, so users comparing the words out loud
+// catch it even when it guessed or relayed the code.
+func AuthString(key []byte) string {
+	// Only fails for lengths HKDF-SHA256 can't produce
+	b, _ := hkdf.Key(sha256.New, key, nil, authStringInfo, 2*AuthStringWords)
+	words := make([]string, AuthStringWords)
+	for i := range words {
+		words[i] = WordList[int(binary.BigEndian.Uint16(b[2*i:]))%len(WordList)]
+	}
+	return strings.Join(words, " ")
+}
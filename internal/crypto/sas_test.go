@@ -0,0 +1,66 @@
+package crypto
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// Vectors pin the derivation: HKDF-SHA256 with no salt and the info string,
+// 2 bytes per word taken modulo len(WordList). Changing any of it breaks
+// confirmation between old and new versions.
+func TestAuthStringVectors(t *testing.T) {
+	seq := make([]byte, 32)
+	for i := range seq {
+		seq[i] = byte(i)
+	}
+	tests := []struct {
+		name string
+		key  []byte
+		want string
+	}{
+		{"sequential", seq, "will slender cinnamon saddle acid way"},
+		{"all ones", bytes.Repeat([]byte{0xff}, 32), "cliff valley tank sauce theory sick"},
+		{"empty", nil, "catalog trigger soon sense crisp above"},
+	}
+	for _, tt := range tests {
+		if got := AuthString(tt.key); got != tt.want {
+			t.Errorf("%s: AuthString = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestAuthStringMatchesAcrossHandshake(t *testing.T) {
+	client, err := InitializePAKE("7-apple-velocity", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := InitializePAKE("7-apple-velocity", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverKey, err := server.ComputeSharedKey(client.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientKey, err := client.ComputeSharedKey(server.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sas := AuthString(clientKey)
+	if got := AuthString(serverKey); got != sas {
+		t.Fatalf("sides disagree: client %q, server %q", sas, got)
+	}
+	words := strings.Fields(sas)
+	if len(words) != AuthStringWords {
+		t.Fatalf("AuthString = %q, want %d words", sas, AuthStringWords)
+	}
+
+	// A different session key must not give the same string
+	other := bytes.Clone(clientKey)
+	other[0] ^= 1
+	if AuthString(other) == sas {
+		t.Fatal("a one-bit change in the key left the string unchanged")
+	}
+}
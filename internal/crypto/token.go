@@ -2,18 +2,179 @@ package crypto
 
 import (
 	"crypto/rand"
+	"crypto/subtle"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
+	"math"
 	"math/big"
+	"net/url"
+	"strings"
 )
 
+// Token sizes in random bytes
+const (
+	// DefaultTokenBytes is the entropy of share tokens (256 bits)
+	DefaultTokenBytes = 32
+	// MinTokenBytes is the least entropy accepted for a token (128 bits)
+	MinTokenBytes = 16
+)
+
+// Token alphabets. Each is URL-safe, so tokens never need escaping in paths
+// or QR codes.
+const (
+	// AlphabetHex is the default, lower-case hex
+	AlphabetHex = "0123456789abcdef"
+	// AlphabetBase58 leaves out 0/O and I/l, for tokens people read or type
+	AlphabetBase58 = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+	// AlphabetBase64URL packs the most entropy into each character of a URL
+	AlphabetBase64URL = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789-_"
+)
+
+// DefaultTokenAttempts bounds how often a TokenGenerator with a Unique
+// callback draws again when Attempts is 0
+const DefaultTokenAttempts = 10
+
+// ErrTokenCollision means every token a TokenGenerator drew was rejected by
+// its Unique callback
+var ErrTokenCollision = errors.New("no unique token found")
+
+// TokenOptions configures a TokenGenerator. The zero value draws tokens as
+// long and as strong as GenerateToken's.
+type TokenOptions struct {
+	// Length is the token length in characters. 0 picks enough characters
+	// of Alphabet for DefaultTokenBytes of entropy.
+	Length int
+	// Alphabet is the characters tokens are drawn from, AlphabetHex when
+	// empty. It must hold 2 to 256 distinct URL-safe characters.
+	Alphabet string
+	// Rand is the source of randomness, crypto/rand when nil
+	Rand io.Reader
+	// Unique, when set, is offered each token drawn and reports whether it
+	// was accepted. A callback that also claims the token, such as adding it
+	// to a table under a lock, makes drawing and registering one step.
+	Unique func(token string) bool
+	// Attempts bounds the draws Unique may reject, DefaultTokenAttempts when 0
+	Attempts int
+}
+
+// TokenGenerator draws tokens of a fixed length and alphabet. Every
+// character is drawn uniformly: random bytes that would bias the draw
+// toward the start of the alphabet are skipped.
+type TokenGenerator struct {
+	opts  TokenOptions
+	limit int // bytes at or above limit are skipped
+}
+
+// NewTokenGenerator checks opts and fills in their defaults
+func NewTokenGenerator(opts TokenOptions) (*TokenGenerator, error) {
+	if opts.Alphabet == "" {
+		opts.Alphabet = AlphabetHex
+	}
+	n := len(opts.Alphabet)
+	if n < 2 || n > 256 {
+		return nil, fmt.Errorf("token alphabet has %d characters, want 2 to 256", n)
+	}
+	for i := range n {
+		c := opts.Alphabet[i]
+		if strings.IndexByte(opts.Alphabet[i+1:], c) >= 0 {
+			return nil, fmt.Errorf("token alphabet repeats %q", c)
+		}
+		if url.PathEscape(string(c)) != string(c) {
+			return nil, fmt.Errorf("token alphabet character %q isn't URL-safe", c)
+		}
+	}
+	if opts.Length < 0 {
+		return nil, fmt.Errorf("token length %d is negative", opts.Length)
+	}
+	if opts.Length == 0 {
+		opts.Length = int(math.Ceil(DefaultTokenBytes * 8 / math.Log2(float64(n))))
+	}
+	if opts.Rand == nil {
+		opts.Rand = rand.Reader
+	}
+	if opts.Attempts <= 0 {
+		opts.Attempts = DefaultTokenAttempts
+	}
+	return &TokenGenerator{opts: opts, limit: 256 - 256%n}, nil
+}
+
+// Bits returns the entropy of one token
+func (g *TokenGenerator) Bits() float64 {
+	return float64(g.opts.Length) * math.Log2(float64(len(g.opts.Alphabet)))
+}
+
+// Generate draws a token, drawing again while Unique rejects it. After
+// Attempts rejections it gives up with ErrTokenCollision.
+func (g *TokenGenerator) Generate() (string, error) {
+	if g.opts.Unique == nil {
+		return g.draw()
+	}
+	for range g.opts.Attempts {
+		tok, err := g.draw()
+		if err != nil {
+			return "", err
+		}
+		if g.opts.Unique(tok) {
+			return tok, nil
+		}
+	}
+	return "", fmt.Errorf("%w after %d attempts", ErrTokenCollision, g.opts.Attempts)
+}
+
+// draw reads random bytes until Length of them map onto the alphabet
+// without bias
+func (g *TokenGenerator) draw() (string, error) {
+	alphabet := g.opts.Alphabet
+	tok := make([]byte, 0, g.opts.Length)
+	buf := make([]byte, g.opts.Length)
+	for len(tok) < g.opts.Length {
+		b := buf[:g.opts.Length-len(tok)]
+		if _, err := io.ReadFull(g.opts.Rand, b); err != nil {
+			return "", err
+		}
+		for _, c := range b {
+			if int(c) < g.limit {
+				tok = append(tok, alphabet[int(c)%len(alphabet)])
+			}
+		}
+	}
+	return string(tok), nil
+}
+
 // GenerateToken returns a secure 32-byte hex string token.
 func GenerateToken(randReader io.Reader) (string, error) {
+	return GenerateTokenSize(randReader, DefaultTokenBytes)
+}
+
+// GenerateTokenSize returns a hex token with the entropy of n random bytes.
+// Hex keeps tokens URL-safe by construction: they never need escaping in
+// paths or QR codes.
+func GenerateTokenSize(randReader io.Reader, n int) (string, error) {
+	if n < MinTokenBytes {
+		return "", fmt.Errorf("token size %d bytes is below the minimum of %d", n, MinTokenBytes)
+	}
+	g, err := NewTokenGenerator(TokenOptions{Length: 2 * n, Rand: randReader})
+	if err != nil {
+		return "", err
+	}
+	return g.Generate()
+}
+
+// TokenEqual compares a presented token, PIN or secret with the expected value in
+// constant time so response timing doesn't reveal how many leading bytes matched
+func TokenEqual(presented, expected string) bool {
+	return subtle.ConstantTimeCompare([]byte(presented), []byte(expected)) == 1
+}
+
+// GenerateTransferID returns a short 8-byte hex ID used to correlate a single transfer
+// across logs and client output. It is not a secret.
+func GenerateTransferID(randReader io.Reader) (string, error) {
 	if randReader == nil {
 		randReader = rand.Reader
 	}
-	b := make([]byte, 32)
+	b := make([]byte, 8)
 	if _, err := io.ReadFull(randReader, b); err != nil {
 		return "", err
 	}
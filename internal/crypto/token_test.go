@@ -1,7 +1,12 @@
 package crypto
 
 import (
+	"bytes"
 	"crypto/rand"
+	"errors"
+	"net/url"
+	"slices"
+	"strings"
 	"testing"
 )
 
@@ -21,3 +26,187 @@ func TestGenerateTokenUniquenessAndLength(t *testing.T) {
 		seen[tok] = struct{}{}
 	}
 }
+
+func TestGenerateTransferID(t *testing.T) {
+	a, err := GenerateTransferID(nil)
+	if err != nil {
+		t.Fatalf("error generating transfer ID: %v", err)
+	}
+	if len(a) != 16 {
+		t.Fatalf("unexpected transfer ID length: %d", len(a))
+	}
+	b, _ := GenerateTransferID(nil)
+	if a == b {
+		t.Fatalf("duplicate transfer ID generated: %s", a)
+	}
+}
+
+func TestGenerateTokenSizeContract(t *testing.T) {
+	for _, n := range []int{MinTokenBytes, 24, DefaultTokenBytes, 64} {
+		tok, err := GenerateTokenSize(nil, n)
+		if err != nil {
+			t.Fatalf("size %d: %v", n, err)
+		}
+		if len(tok) != 2*n {
+			t.Fatalf("size %d: length %d, want %d", n, len(tok), 2*n)
+		}
+		for _, c := range tok {
+			if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f') {
+				t.Fatalf("size %d: token %q has non URL-safe character %q", n, tok, c)
+			}
+		}
+		if url.PathEscape(tok) != tok {
+			t.Fatalf("size %d: token %q needs escaping", n, tok)
+		}
+	}
+
+	// Rough entropy check: every hex digit should appear across a batch
+	var counts [16]int
+	for range 100 {
+		tok, _ := GenerateToken(nil)
+		for _, c := range tok {
+			if c <= '9' {
+				counts[c-'0']++
+			} else {
+				counts[c-'a'+10]++
+			}
+		}
+	}
+	for digit, n := range counts {
+		if n < 200 { // ~400 expected per digit over 6400 characters
+			t.Errorf("hex digit %x appeared %d times, distribution looks biased", digit, n)
+		}
+	}
+
+	if _, err := GenerateTokenSize(nil, MinTokenBytes-1); err == nil {
+		t.Error("expected error for token below minimum size")
+	}
+}
+
+func TestTokenEqual(t *testing.T) {
+	tok, _ := GenerateToken(nil)
+	if !TokenEqual(tok, tok) {
+		t.Error("identical tokens should be equal")
+	}
+	for _, other := range []string{"", tok[:len(tok)-1], tok + "0", "x" + tok[1:]} {
+		if TokenEqual(other, tok) {
+			t.Errorf("TokenEqual(%q) = true, want false", other)
+		}
+	}
+}
+
+func TestNewTokenGeneratorOptions(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     TokenOptions
+		length   int
+		alphabet string
+	}{
+		{"default", TokenOptions{}, 64, AlphabetHex},
+		{"base58", TokenOptions{Alphabet: AlphabetBase58}, 44, AlphabetBase58},
+		{"base64url", TokenOptions{Alphabet: AlphabetBase64URL}, 43, AlphabetBase64URL},
+		{"fixed length", TokenOptions{Length: 10, Alphabet: AlphabetBase58}, 10, AlphabetBase58},
+	}
+	for _, tt := range tests {
+		g, err := NewTokenGenerator(tt.opts)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		tok, err := g.Generate()
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if len(tok) != tt.length || strings.Trim(tok, tt.alphabet) != "" {
+			t.Errorf("%s: token %q isn't %d characters of its alphabet", tt.name, tok, tt.length)
+		}
+		if url.PathEscape(tok) != tok {
+			t.Errorf("%s: token %q needs escaping", tt.name, tok)
+		}
+		if tt.opts.Length == 0 && g.Bits() < DefaultTokenBytes*8 {
+			t.Errorf("%s: default length gives %.1f bits, want at least %d", tt.name, g.Bits(), DefaultTokenBytes*8)
+		}
+	}
+
+	for _, bad := range []TokenOptions{
+		{Alphabet: "a"},
+		{Alphabet: "abca"},
+		{Alphabet: "ab/"},
+		{Length: -1},
+	} {
+		if _, err := NewTokenGenerator(bad); err == nil {
+			t.Errorf("NewTokenGenerator(%+v) accepted bad options", bad)
+		}
+	}
+}
+
+// TestTokenGeneratorChiSquared checks that characters are drawn uniformly,
+// including from alphabets whose size doesn't divide 256
+func TestTokenGeneratorChiSquared(t *testing.T) {
+	for _, alphabet := range []string{AlphabetHex, AlphabetBase58, AlphabetBase64URL} {
+		g, err := NewTokenGenerator(TokenOptions{Alphabet: alphabet})
+		if err != nil {
+			t.Fatal(err)
+		}
+		counts := make(map[rune]int)
+		total := 0
+		for range 2000 {
+			tok, _ := g.Generate()
+			for _, c := range tok {
+				counts[c]++
+				total++
+			}
+		}
+		expected := float64(total) / float64(len(alphabet))
+		var chi2 float64
+		for _, c := range alphabet {
+			d := float64(counts[c]) - expected
+			chi2 += d * d / expected
+		}
+		// The statistic has len-1 degrees of freedom, so its mean is len-1;
+		// twice that plus a margin fails only a biased draw, not bad luck
+		if limit := 2*float64(len(alphabet)-1) + 30; chi2 > limit {
+			t.Errorf("alphabet of %d: chi-squared %.1f over %d characters exceeds %.1f", len(alphabet), chi2, total, limit)
+		}
+	}
+}
+
+func TestTokenGeneratorUniqueCallback(t *testing.T) {
+	taken := map[string]bool{"aaaa": true, "bbbb": true}
+	var offered []string
+	// Each draw of 4 bytes becomes one repeated character
+	draws := []byte{0, 0, 0, 0, 1, 1, 1, 1, 2, 2, 2, 2}
+	g, err := NewTokenGenerator(TokenOptions{
+		Length:   4,
+		Alphabet: "abcd",
+		Rand:     bytes.NewReader(draws),
+		Unique: func(tok string) bool {
+			offered = append(offered, tok)
+			if taken[tok] {
+				return false
+			}
+			taken[tok] = true
+			return true
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tok, err := g.Generate()
+	if err != nil || tok != "cccc" {
+		t.Fatalf("Generate = %q, %v; want cccc after two collisions", tok, err)
+	}
+	if !slices.Equal(offered, []string{"aaaa", "bbbb", "cccc"}) {
+		t.Errorf("offered %v", offered)
+	}
+
+	g, _ = NewTokenGenerator(TokenOptions{
+		Length:   4,
+		Alphabet: "abcd",
+		Rand:     bytes.NewReader(make([]byte, 4*3)),
+		Unique:   func(string) bool { return false },
+		Attempts: 3,
+	})
+	if _, err := g.Generate(); !errors.Is(err, ErrTokenCollision) {
+		t.Errorf("Generate with every draw taken = %v, want ErrTokenCollision", err)
+	}
+}
@@ -0,0 +1,98 @@
+package broadcast
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+func listenLoopback(t *testing.T, info Announcement) *Responder {
+	t.Helper()
+	r, err := Listen("127.0.0.1:0", info)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(r.Close)
+	return r
+}
+
+func TestSearchLoopback(t *testing.T) {
+	info := Announcement{Name: "warp-abcdef", Mode: "send", Token: "abcdef0123", Path: "/d/abcdef0123", IP: "127.0.0.1", Port: 54321}
+	r := listenLoopback(t, info)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	found, err := Search(ctx, []*net.UDPAddr{r.Addr()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 1 {
+		t.Fatalf("found %d servers, want 1", len(found))
+	}
+	got := found[0]
+	got.Nonce = ""
+	if got != info {
+		t.Errorf("announcement = %+v, want %+v", got, info)
+	}
+}
+
+func TestScanLoopback(t *testing.T) {
+	r := listenLoopback(t, Announcement{Name: "warp-host", Mode: "host", Token: "fedcba9876", Path: "/u/fedcba9876", Port: 40000})
+
+	targets, err := HostAddrs("127.0.0.1/32", r.Addr().Port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found, err := Scan(context.Background(), targets, 4, 300*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 1 || found[0].Token != "fedcba9876" {
+		t.Fatalf("found %+v", found)
+	}
+	// The responder left IP empty; the client fills in the sender's address
+	if found[0].IP != "127.0.0.1" {
+		t.Errorf("IP = %q, want 127.0.0.1", found[0].IP)
+	}
+}
+
+func TestResponderIgnoresForeignPackets(t *testing.T) {
+	r := listenLoopback(t, Announcement{Name: "warp-x", Mode: "send", Token: "t", Port: 1})
+
+	conn, err := net.DialUDP("udp4", nil, r.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+	if _, err := conn.Write([]byte("who has warp?")); err != nil {
+		t.Fatal(err)
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	if n, err := conn.Read(make([]byte, MaxPacketSize)); err == nil {
+		t.Errorf("responder answered an unsigned probe with %d bytes", n)
+	}
+}
+
+func TestHostAddrs(t *testing.T) {
+	addrs, err := HostAddrs("192.168.1.0/30", DefaultPort)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(addrs) != 2 || addrs[0].IP.String() != "192.168.1.1" || addrs[1].IP.String() != "192.168.1.2" {
+		t.Errorf("HostAddrs(/30) = %v", addrs)
+	}
+	if _, err := HostAddrs("10.0.0.0/16", DefaultPort); err == nil {
+		t.Error("expected a /16 to exceed the scan limit")
+	}
+	if _, err := HostAddrs("fe80::/120", DefaultPort); err == nil {
+		t.Error("expected IPv6 to be rejected")
+	}
+}
+
+func TestDirectedBroadcast(t *testing.T) {
+	_, n, _ := net.ParseCIDR("192.168.7.42/22")
+	if got := directedBroadcast(n).String(); got != "192.168.7.255" {
+		t.Errorf("directedBroadcast = %s, want 192.168.7.255", got)
+	}
+}
@@ -0,0 +1,148 @@
+// Package broadcast is warp's fallback discovery for networks that filter
+// mDNS multicast. Servers answer "who has warp?" probes on a well-known UDP
+// port with the same metadata they publish in their mDNS TXT record; clients
+// send probes to their subnets' broadcast addresses, or to every host of a
+// CIDR, and collect the answers.
+package broadcast
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// DefaultPort is the UDP port servers listen on for probes
+const DefaultPort = 8829
+
+// Wire format: magic | version | kind | JSON body | HMAC-SHA256(header+body)
+const (
+	magic           = "WRPD"
+	version    byte = 1
+	headerSize      = len(magic) + 2
+	macSize         = sha256.Size
+	// MaxPacketSize bounds both what is sent and what is read
+	MaxPacketSize = 1024
+)
+
+// Packet kinds
+const (
+	kindProbe    byte = 1
+	kindAnnounce byte = 2
+)
+
+// packetKey signs every packet. It is part of the protocol, not a secret: the
+// MAC keeps stray datagrams and other protocols off the port and stops
+// corrupted answers from being listed, but anyone running warp can produce it.
+// Announcements carry nothing beyond what mDNS already publishes.
+var packetKey = sha256.Sum256([]byte("warp broadcast discovery v1"))
+
+// ErrInvalidPacket is returned for datagrams that aren't well-formed, signed
+// warp discovery packets
+var ErrInvalidPacket = errors.New("invalid discovery packet")
+
+// Probe asks every server that hears it to announce itself. Answers echo the
+// nonce so a client only accepts replies to its own probe.
+type Probe struct {
+	Nonce string `json:"nonce"`
+}
+
+// Announcement describes a server, mirroring its mDNS TXT record
+type Announcement struct {
+	Nonce string `json:"nonce"`
+	Name  string `json:"name"`
+	Mode  string `json:"mode"` // send|host
+	Token string `json:"token"`
+	Path  string `json:"path"` // URL path including leading slash
+	IP    string `json:"ip"`
+	Port  int    `json:"port"`
+}
+
+// NewProbe returns a probe with a fresh random nonce
+func NewProbe() (Probe, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return Probe{}, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return Probe{Nonce: hex.EncodeToString(b)}, nil
+}
+
+// MarshalBinary encodes and signs the probe
+func (p Probe) MarshalBinary() ([]byte, error) {
+	return encode(kindProbe, p)
+}
+
+// UnmarshalBinary verifies and decodes a probe
+func (p *Probe) UnmarshalBinary(data []byte) error {
+	if err := decode(kindProbe, data, p); err != nil {
+		return err
+	}
+	if p.Nonce == "" {
+		return fmt.Errorf("%w: probe without nonce", ErrInvalidPacket)
+	}
+	return nil
+}
+
+// MarshalBinary encodes and signs the announcement
+func (a Announcement) MarshalBinary() ([]byte, error) {
+	return encode(kindAnnounce, a)
+}
+
+// UnmarshalBinary verifies and decodes an announcement
+func (a *Announcement) UnmarshalBinary(data []byte) error {
+	if err := decode(kindAnnounce, data, a); err != nil {
+		return err
+	}
+	if a.Port <= 0 || a.Port > 65535 {
+		return fmt.Errorf("%w: port %d out of range", ErrInvalidPacket, a.Port)
+	}
+	return nil
+}
+
+func encode(kind byte, v any) ([]byte, error) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	pkt := make([]byte, 0, headerSize+len(body)+macSize)
+	pkt = append(pkt, magic...)
+	pkt = append(pkt, version, kind)
+	pkt = append(pkt, body...)
+	pkt = append(pkt, sign(pkt)...)
+	if len(pkt) > MaxPacketSize {
+		return nil, fmt.Errorf("discovery packet too large (%d bytes)", len(pkt))
+	}
+	return pkt, nil
+}
+
+func decode(kind byte, data []byte, v any) error {
+	if len(data) < headerSize+macSize || len(data) > MaxPacketSize {
+		return fmt.Errorf("%w: %d bytes", ErrInvalidPacket, len(data))
+	}
+	if string(data[:len(magic)]) != magic {
+		return fmt.Errorf("%w: bad magic", ErrInvalidPacket)
+	}
+	if data[len(magic)] != version {
+		return fmt.Errorf("%w: version %d", ErrInvalidPacket, data[len(magic)])
+	}
+	if data[len(magic)+1] != kind {
+		return fmt.Errorf("%w: kind %d", ErrInvalidPacket, data[len(magic)+1])
+	}
+	signed, mac := data[:len(data)-macSize], data[len(data)-macSize:]
+	if !hmac.Equal(mac, sign(signed)) {
+		return fmt.Errorf("%w: bad signature", ErrInvalidPacket)
+	}
+	if err := json.Unmarshal(signed[headerSize:], v); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidPacket, err)
+	}
+	return nil
+}
+
+func sign(b []byte) []byte {
+	m := hmac.New(sha256.New, packetKey[:])
+	m.Write(b)
+	return m.Sum(nil)
+}
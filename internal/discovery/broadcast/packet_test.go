@@ -0,0 +1,66 @@
+package broadcast
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestAnnouncementRoundTrip(t *testing.T) {
+	want := Announcement{Nonce: "00112233", Name: "warp-abcdef", Mode: "send", Token: "abcdef0123", Path: "/d/abcdef0123", IP: "192.168.1.20", Port: 54321}
+	pkt, err := want.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got Announcement
+	if err := got.UnmarshalBinary(pkt); err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Errorf("round trip = %+v, want %+v", got, want)
+	}
+}
+
+func TestProbeRoundTrip(t *testing.T) {
+	p, err := NewProbe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkt, err := p.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got Probe
+	if err := got.UnmarshalBinary(pkt); err != nil || got != p {
+		t.Errorf("round trip = %+v, %v; want %+v", got, err, p)
+	}
+}
+
+func TestDecodeRejectsInvalidPackets(t *testing.T) {
+	probe, _ := Probe{Nonce: "aa"}.MarshalBinary()
+	tampered := append([]byte(nil), probe...)
+	tampered[headerSize] ^= 0xff
+	badVersion := append([]byte(nil), probe...)
+	badVersion[len(magic)] = version + 1
+
+	tests := map[string][]byte{
+		"empty":      nil,
+		"truncated":  probe[:headerSize+macSize-1],
+		"bad magic":  append([]byte("XXXX"), probe[len(magic):]...),
+		"version":    badVersion,
+		"tampered":   tampered,
+		"oversized":  make([]byte, MaxPacketSize+1),
+		"unsigned":   append([]byte(magic), version, kindProbe, '{', '}'),
+		"wrong kind": probe, // A probe decoded as an announcement
+	}
+	for name, pkt := range tests {
+		var a Announcement
+		if err := a.UnmarshalBinary(pkt); !errors.Is(err, ErrInvalidPacket) {
+			t.Errorf("%s: err = %v, want ErrInvalidPacket", name, err)
+		}
+	}
+
+	empty, _ := Probe{}.MarshalBinary()
+	if err := new(Probe).UnmarshalBinary(empty); !errors.Is(err, ErrInvalidPacket) {
+		t.Errorf("probe without nonce: err = %v", err)
+	}
+}
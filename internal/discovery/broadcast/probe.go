@@ -0,0 +1,245 @@
+package broadcast
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// Scan limits
+const (
+	// MaxScanHosts caps how many addresses a CIDR scan may probe (a /20)
+	MaxScanHosts = 4096
+	// DefaultScanConcurrency is how many hosts are probed at once
+	DefaultScanConcurrency = 64
+)
+
+// BroadcastAddrs returns the directed broadcast address of every IPv4 subnet
+// this machine is on, so probes never leave the local networks
+func BroadcastAddrs(port int) ([]*net.UDPAddr, error) {
+	ifs, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+	var out []*net.UDPAddr
+	for _, iface := range ifs {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 || iface.Flags&net.FlagBroadcast == 0 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, a := range addrs {
+			ipnet, ok := a.(*net.IPNet)
+			if !ok || ipnet.IP.To4() == nil {
+				continue
+			}
+			if ones, bits := ipnet.Mask.Size(); bits != 32 || ones >= 31 {
+				continue // Point-to-point links have no broadcast address
+			}
+			out = append(out, &net.UDPAddr{IP: directedBroadcast(ipnet), Port: port})
+		}
+	}
+	return out, nil
+}
+
+// directedBroadcast returns the all-ones host address of an IPv4 subnet
+func directedBroadcast(n *net.IPNet) net.IP {
+	ip, mask := n.IP.To4(), n.Mask
+	if len(mask) == net.IPv6len {
+		mask = mask[12:]
+	}
+	out := make(net.IP, net.IPv4len)
+	for i := range out {
+		out[i] = ip[i] | ^mask[i]
+	}
+	return out
+}
+
+// HostAddrs returns every usable host address of an IPv4 CIDR, up to MaxScanHosts
+func HostAddrs(cidr string, port int) ([]*net.UDPAddr, error) {
+	_, n, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, err
+	}
+	if n.IP.To4() == nil {
+		return nil, fmt.Errorf("%s is not an IPv4 network", cidr)
+	}
+	ones, bits := n.Mask.Size()
+	total := uint64(1) << (bits - ones)
+	first, last := uint64(0), total-1
+	if total > 2 {
+		// Skip the network and broadcast addresses
+		first, last = 1, total-2
+	}
+	if last-first+1 > MaxScanHosts {
+		return nil, fmt.Errorf("%s has %d hosts; scans are limited to %d", cidr, last-first+1, MaxScanHosts)
+	}
+	base := binary.BigEndian.Uint32(n.IP.To4())
+	out := make([]*net.UDPAddr, 0, last-first+1)
+	for i := first; i <= last; i++ {
+		ip := make(net.IP, net.IPv4len)
+		binary.BigEndian.PutUint32(ip, base+uint32(i))
+		out = append(out, &net.UDPAddr{IP: ip, Port: port})
+	}
+	return out, nil
+}
+
+// Search sends one probe to every target (typically BroadcastAddrs) and
+// collects answers until ctx is done
+func Search(ctx context.Context, targets []*net.UDPAddr) ([]Announcement, error) {
+	conn, err := net.ListenUDP("udp4", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = conn.Close() }()
+
+	probe, err := NewProbe()
+	if err != nil {
+		return nil, err
+	}
+	pkt, err := probe.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	sent := 0
+	var sendErr error
+	for _, t := range targets {
+		if _, err := conn.WriteToUDP(pkt, t); err != nil {
+			sendErr = err
+			continue
+		}
+		sent++
+	}
+	if sent == 0 && sendErr != nil {
+		return nil, sendErr
+	}
+
+	var found results
+	found.collect(ctx, conn, probe.Nonce, nil)
+	return found.list, nil
+}
+
+// Scan probes every target on its own, at most concurrency at a time, waiting
+// up to perHost for each answer. It finds servers where broadcasts are
+// dropped too, e.g. across a routed CIDR.
+func Scan(ctx context.Context, targets []*net.UDPAddr, concurrency int, perHost time.Duration) ([]Announcement, error) {
+	if concurrency <= 0 {
+		concurrency = DefaultScanConcurrency
+	}
+	concurrency = min(concurrency, len(targets))
+
+	jobs := make(chan *net.UDPAddr)
+	var found results
+	var wg sync.WaitGroup
+	var firstErr error
+	var errOnce sync.Once
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			conn, err := net.ListenUDP("udp4", nil)
+			if err != nil {
+				errOnce.Do(func() { firstErr = err })
+				for range jobs {
+					// Keep draining so the feeder never blocks on a dead worker
+				}
+				return
+			}
+			defer func() { _ = conn.Close() }()
+			for t := range jobs {
+				found.probeHost(ctx, conn, t, perHost)
+			}
+		}()
+	}
+
+feed:
+	for _, t := range targets {
+		select {
+		case jobs <- t:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	if len(found.list) == 0 && firstErr != nil {
+		return nil, firstErr
+	}
+	return found.list, nil
+}
+
+// results gathers unique announcements from concurrent readers
+type results struct {
+	mu   sync.Mutex
+	seen map[string]bool
+	list []Announcement
+}
+
+func (r *results) add(a Announcement) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.seen == nil {
+		r.seen = make(map[string]bool)
+	}
+	key := fmt.Sprintf("%s|%s|%d", a.Token, a.IP, a.Port)
+	if !r.seen[key] {
+		r.seen[key] = true
+		r.list = append(r.list, a)
+	}
+}
+
+// probeHost sends a fresh probe to target and waits up to perHost for its answer
+func (r *results) probeHost(ctx context.Context, conn *net.UDPConn, target *net.UDPAddr, perHost time.Duration) {
+	probe, err := NewProbe()
+	if err != nil {
+		return
+	}
+	pkt, err := probe.MarshalBinary()
+	if err != nil {
+		return
+	}
+	if _, err := conn.WriteToUDP(pkt, target); err != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, perHost)
+	defer cancel()
+	r.collect(ctx, conn, probe.Nonce, target.IP)
+}
+
+// collect reads answers to the probe with nonce until ctx is done. With from
+// set, only answers sent by that address count.
+func (r *results) collect(ctx context.Context, conn *net.UDPConn, nonce string, from net.IP) {
+	// Unblock the pending read as soon as ctx ends, deadline or not
+	deadline, _ := ctx.Deadline()
+	_ = conn.SetReadDeadline(deadline)
+	stop := context.AfterFunc(ctx, func() { _ = conn.SetReadDeadline(time.Now()) })
+	defer func() {
+		stop()
+		_ = conn.SetReadDeadline(time.Time{})
+	}()
+
+	buf := make([]byte, MaxPacketSize+1)
+	for ctx.Err() == nil {
+		n, src, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		if from != nil && !src.IP.Equal(from) {
+			continue
+		}
+		var a Announcement
+		if a.UnmarshalBinary(buf[:n]) != nil || a.Nonce != nonce {
+			continue
+		}
+		if a.IP == "" {
+			a.IP = src.IP.String()
+		}
+		r.add(a)
+	}
+}
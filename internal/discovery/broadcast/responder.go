@@ -0,0 +1,73 @@
+package broadcast
+
+import (
+	"errors"
+	"net"
+	"strconv"
+)
+
+// Responder answers discovery probes with a fixed announcement
+type Responder struct {
+	conn *net.UDPConn
+	info Announcement
+	done chan struct{}
+}
+
+// Listen starts answering probes on addr (":8829" by default when empty).
+// Bind to all interfaces: sockets bound to a unicast address don't receive
+// broadcasts on every platform.
+func Listen(addr string, info Announcement) (*Responder, error) {
+	if addr == "" {
+		addr = net.JoinHostPort("", strconv.Itoa(DefaultPort))
+	}
+	udpAddr, err := net.ResolveUDPAddr("udp4", addr)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.ListenUDP("udp4", udpAddr)
+	if err != nil {
+		return nil, err
+	}
+	r := &Responder{conn: conn, info: info, done: make(chan struct{})}
+	go r.serve()
+	return r, nil
+}
+
+// Addr returns the address the responder is listening on
+func (r *Responder) Addr() *net.UDPAddr {
+	return r.conn.LocalAddr().(*net.UDPAddr)
+}
+
+// Close stops answering probes and waits for the responder to exit
+func (r *Responder) Close() {
+	if r == nil {
+		return
+	}
+	_ = r.conn.Close()
+	<-r.done
+}
+
+func (r *Responder) serve() {
+	defer close(r.done)
+	buf := make([]byte, MaxPacketSize+1)
+	for {
+		n, from, err := r.conn.ReadFromUDP(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+		var probe Probe
+		if probe.UnmarshalBinary(buf[:n]) != nil {
+			continue // Not ours; stay silent
+		}
+		answer := r.info
+		answer.Nonce = probe.Nonce
+		pkt, err := answer.MarshalBinary()
+		if err != nil {
+			continue
+		}
+		_, _ = r.conn.WriteToUDP(pkt, from)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"strconv"
 	"time"
 
 	"github.com/grandcat/zeroconf"
@@ -22,6 +23,7 @@ type Service struct {
 	Token string
 	IP    net.IP
 	Port  int
+	QUIC  int // UDP port serving HTTP/3; 0 = off or not advertised
 	URL   string
 }
 
@@ -29,7 +31,8 @@ type Service struct {
 // mode: "send" or "host"
 // token: transfer token
 // path: URL path including leading slash (e.g., "/d/{token}")
-func Advertise(instance, mode, token, path string, ip net.IP, port int) (*Advertiser, error) {
+// quicPort: UDP port serving HTTP/3, 0 when QUIC is off
+func Advertise(instance, mode, token, path string, ip net.IP, port, quicPort int) (*Advertiser, error) {
 	if ip == nil {
 		return nil, fmt.Errorf("ip is required")
 	}
@@ -40,6 +43,11 @@ func Advertise(instance, mode, token, path string, ip net.IP, port int) (*Advert
 		"path=" + path,
 		"ip=" + ip.String(),
 	}
+	if quicPort > 0 {
+		txt = append(txt, "quic="+strconv.Itoa(quicPort))
+	} else {
+		txt = append(txt, "quic=off")
+	}
 
 	srv, err := zeroconf.Register(instance, "_warp._tcp", "local.", port, txt, nil)
 	if err != nil {
@@ -82,6 +90,7 @@ func Browse(ctx context.Context, timeout time.Duration) ([]Service, error) {
 			mode := attr(e, "mode")
 			token := attr(e, "token")
 			path := attr(e, "path")
+			quicPort, _ := strconv.Atoi(attr(e, "quic"))
 			url := fmt.Sprintf("http://%s:%d%s", ip.String(), e.Port, path)
 			results = append(results, Service{
 				Name:  e.Instance,
@@ -89,6 +98,7 @@ func Browse(ctx context.Context, timeout time.Duration) ([]Service, error) {
 				Token: token,
 				IP:    ip,
 				Port:  e.Port,
+				QUIC:  quicPort,
 				URL:   url,
 			})
 		}
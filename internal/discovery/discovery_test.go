@@ -5,6 +5,8 @@ import (
 	"net"
 	"testing"
 	"time"
+
+	"github.com/zulfikawr/warp/internal/discovery/broadcast"
 )
 
 func TestAdvertiseAndBrowse(t *testing.T) {
@@ -13,7 +15,7 @@ func TestAdvertiseAndBrowse(t *testing.T) {
 	token := "tokendiscovery"
 	path := "/d/" + token
 
-	adv, err := Advertise("warp-test-"+token[:6], "send", token, path, ip, port)
+	adv, err := Advertise("warp-test-"+token[:6], "send", token, path, ip, port, port)
 	if err != nil {
 		t.Fatalf("advertise failed: %v", err)
 	}
@@ -35,6 +37,9 @@ func TestAdvertiseAndBrowse(t *testing.T) {
 			if svc.URL == "" {
 				t.Fatalf("expected URL to be set")
 			}
+			if svc.QUIC != port {
+				t.Fatalf("QUIC = %d, want %d from the TXT record", svc.QUIC, port)
+			}
 			break
 		}
 	}
@@ -42,3 +47,41 @@ func TestAdvertiseAndBrowse(t *testing.T) {
 		t.Fatalf("expected to find advertised service")
 	}
 }
+
+func TestParseMode(t *testing.T) {
+	for in, want := range map[string]Mode{"": ModeMDNS, "mdns": ModeMDNS, "broadcast": ModeBroadcast, "both": ModeBoth} {
+		if got, err := ParseMode(in); err != nil || got != want {
+			t.Errorf("ParseMode(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	if _, err := ParseMode("dns"); err == nil {
+		t.Error("ParseMode accepted an unknown mode")
+	}
+}
+
+func TestBrowseWithBroadcastScan(t *testing.T) {
+	token := "tokenbroadcast"
+	r, err := broadcast.Listen("127.0.0.1:0", broadcast.Announcement{
+		Name: "warp-" + token[:6], Mode: "send", Token: token, Path: "/d/" + token, IP: "127.0.0.1", Port: 54321,
+	})
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	defer r.Close()
+
+	// Nothing answers on the subnet broadcast addresses, so the scan finds it
+	services, err := BrowseWith(context.Background(), 500*time.Millisecond, Options{
+		Mode:     ModeBroadcast,
+		Port:     r.Addr().Port,
+		ScanCIDR: "127.0.0.1/32",
+	})
+	if err != nil {
+		t.Fatalf("browse failed: %v", err)
+	}
+	if len(services) != 1 {
+		t.Fatalf("found %d services, want 1", len(services))
+	}
+	if want := "http://127.0.0.1:54321/d/" + token; services[0].URL != want || services[0].Token != token {
+		t.Errorf("service = %+v, want URL %s", services[0], want)
+	}
+}
@@ -0,0 +1,131 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/zulfikawr/warp/internal/discovery/broadcast"
+)
+
+// Mode selects which discovery mechanisms are used
+type Mode string
+
+const (
+	// ModeMDNS uses multicast DNS only (the default)
+	ModeMDNS Mode = "mdns"
+	// ModeBroadcast uses UDP broadcast probes only
+	ModeBroadcast Mode = "broadcast"
+	// ModeBoth uses mDNS and falls back to broadcast probes when it finds nothing
+	ModeBoth Mode = "both"
+)
+
+// scanHostTimeout is how long a CIDR scan waits for each host to answer
+const scanHostTimeout = 250 * time.Millisecond
+
+// ParseMode validates a --discovery value; empty means mDNS
+func ParseMode(s string) (Mode, error) {
+	switch m := Mode(s); m {
+	case "":
+		return ModeMDNS, nil
+	case ModeMDNS, ModeBroadcast, ModeBoth:
+		return m, nil
+	}
+	return "", fmt.Errorf("invalid discovery mode %q (want mdns, broadcast or both)", s)
+}
+
+// UsesMDNS reports whether m includes mDNS
+func (m Mode) UsesMDNS() bool {
+	return m != ModeBroadcast
+}
+
+// UsesBroadcast reports whether m includes UDP broadcast probes
+func (m Mode) UsesBroadcast() bool {
+	return m == ModeBroadcast || m == ModeBoth
+}
+
+// Options configures BrowseWith
+type Options struct {
+	Mode            Mode
+	Port            int    // UDP probe port; 0 = broadcast.DefaultPort
+	ScanCIDR        string // Also probe every host of this IPv4 network
+	ScanConcurrency int    // Hosts probed at once; 0 = broadcast.DefaultScanConcurrency
+}
+
+// BrowseWith discovers warp services with the mechanisms in opts.Mode. In
+// ModeBoth the broadcast probe, and the CIDR scan if set, only run when mDNS
+// finds nothing, each waiting up to timeout.
+func BrowseWith(ctx context.Context, timeout time.Duration, opts Options) ([]Service, error) {
+	mode, err := ParseMode(string(opts.Mode))
+	if err != nil {
+		return nil, err
+	}
+	if mode.UsesMDNS() {
+		services, err := Browse(ctx, timeout)
+		if err != nil || len(services) > 0 || !mode.UsesBroadcast() {
+			return services, err
+		}
+	}
+	return browseBroadcast(ctx, timeout, opts)
+}
+
+// browseBroadcast probes the local subnets, then scans opts.ScanCIDR if the
+// broadcast went unanswered
+func browseBroadcast(ctx context.Context, timeout time.Duration, opts Options) ([]Service, error) {
+	port := opts.Port
+	if port == 0 {
+		port = broadcast.DefaultPort
+	}
+
+	targets, err := broadcast.BroadcastAddrs(port)
+	if err != nil {
+		return nil, err
+	}
+	var found []broadcast.Announcement
+	if len(targets) > 0 {
+		searchCtx, cancel := context.WithTimeout(ctx, timeout)
+		found, err = broadcast.Search(searchCtx, targets)
+		cancel()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(found) == 0 && opts.ScanCIDR != "" {
+		hosts, err := broadcast.HostAddrs(opts.ScanCIDR, port)
+		if err != nil {
+			return nil, err
+		}
+		scanCtx, cancel := context.WithTimeout(ctx, timeout)
+		found, err = broadcast.Scan(scanCtx, hosts, opts.ScanConcurrency, scanHostTimeout)
+		cancel()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	services := make([]Service, 0, len(found))
+	for _, a := range found {
+		if svc, ok := serviceFromAnnouncement(a); ok {
+			services = append(services, svc)
+		}
+	}
+	return services, nil
+}
+
+// serviceFromAnnouncement converts a broadcast answer into a Service
+func serviceFromAnnouncement(a broadcast.Announcement) (Service, bool) {
+	ip := net.ParseIP(a.IP).To4()
+	if ip == nil {
+		return Service{}, false
+	}
+	return Service{
+		Name:  a.Name,
+		Mode:  a.Mode,
+		Token: a.Token,
+		IP:    ip,
+		Port:  a.Port,
+		URL:   fmt.Sprintf("http://%s:%d%s", ip.String(), a.Port, a.Path),
+	}, true
+}
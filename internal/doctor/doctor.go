@@ -0,0 +1,305 @@
+package doctor
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/zulfikawr/warp/internal/config"
+	"github.com/zulfikawr/warp/internal/crypto"
+	"github.com/zulfikawr/warp/internal/discovery"
+	"github.com/zulfikawr/warp/internal/network"
+	"github.com/zulfikawr/warp/internal/platform"
+	"github.com/zulfikawr/warp/internal/ui"
+)
+
+// Status is the outcome of a single check
+type Status int
+
+const (
+	Pass Status = iota
+	Warn
+	Fail
+)
+
+func (s Status) String() string {
+	switch s {
+	case Pass:
+		return "pass"
+	case Warn:
+		return "warn"
+	default:
+		return "fail"
+	}
+}
+
+// Result describes the outcome of one diagnostic check
+type Result struct {
+	Name        string
+	Status      Status
+	Detail      string
+	Suggestions []string // Possible solutions, shown for warn and fail
+}
+
+// peerSampleSize is how much of the peer's speedtest stream is read
+const peerSampleSize = 1 << 20 // 1MB
+
+// lowDiskThreshold matches the headroom the server keeps when accepting uploads
+const lowDiskThreshold = 1 << 30 // 1GB
+
+// Failed reports whether any result is a failure
+func Failed(results []Result) bool {
+	for _, r := range results {
+		if r.Status == Fail {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckInterface verifies a LAN IPv4 address can be discovered
+func CheckInterface(iface string) Result {
+	r := Result{Name: "Network interface"}
+	ip, err := network.DiscoverLANIP(iface)
+	if err != nil {
+		r.Status = Fail
+		r.Detail = err.Error()
+		r.Suggestions = []string{
+			"Connect to a Wi-Fi or Ethernet network",
+			"Pick an interface explicitly with --interface (see 'ip addr' or 'ifconfig')",
+		}
+		if iface != "" {
+			r.Suggestions = append(r.Suggestions, fmt.Sprintf("Check that interface %q exists and is up", iface))
+		}
+		return r
+	}
+	r.Status = Pass
+	r.Detail = ip.String()
+	if iface != "" {
+		r.Detail += " on " + iface
+	}
+	return r
+}
+
+// CheckMDNS advertises a throwaway service and browses for it to verify that
+// multicast works on this machine
+func CheckMDNS(ctx context.Context, ip net.IP, timeout time.Duration) Result {
+	r := Result{Name: "mDNS discovery"}
+	if ip == nil {
+		r.Status = Warn
+		r.Detail = "skipped (no LAN address)"
+		return r
+	}
+	id, err := crypto.GenerateTransferID(nil)
+	if err != nil {
+		r.Status = Warn
+		r.Detail = err.Error()
+		return r
+	}
+	instance := "warp-doctor-" + id[:6]
+	adv, err := discovery.Advertise(instance, "doctor", id, "/", ip, 9, 0)
+	if err != nil {
+		r.Status = Warn
+		r.Detail = fmt.Sprintf("cannot advertise: %v", err)
+		r.Suggestions = []string{"Allow UDP port 5353 (multicast) in your firewall"}
+		return r
+	}
+	defer adv.Close()
+
+	services, err := discovery.Browse(ctx, timeout)
+	if err != nil {
+		r.Status = Warn
+		r.Detail = fmt.Sprintf("cannot browse: %v", err)
+		r.Suggestions = []string{"Allow UDP port 5353 (multicast) in your firewall"}
+		return r
+	}
+	for _, svc := range services {
+		if svc.Name == instance {
+			r.Status = Pass
+			r.Detail = "loopback advertisement received"
+			return r
+		}
+	}
+	r.Status = Warn
+	r.Detail = "own advertisement not seen; 'warp search' may not find peers"
+	r.Suggestions = []string{
+		"Allow UDP port 5353 (multicast) in your firewall",
+		"Some guest/corporate networks block multicast; share the URL or QR code instead",
+	}
+	return r
+}
+
+// CheckPortBind verifies the configured port can be bound for TCP and UDP (QUIC).
+// Port 0 checks that an ephemeral port is available.
+func CheckPortBind(port int) Result {
+	r := Result{Name: "Port bind"}
+	addr := fmt.Sprintf(":%d", port)
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		r.Status = Fail
+		r.Detail = err.Error()
+		r.Suggestions = []string{
+			"Another process may be using this port; choose a different one with --port",
+			"Use port 0 (default) to pick a random free port",
+		}
+		return r
+	}
+	bound := ln.Addr().(*net.TCPAddr).Port
+	_ = ln.Close()
+
+	pc, err := net.ListenPacket("udp", fmt.Sprintf(":%d", bound))
+	if err != nil {
+		r.Status = Warn
+		r.Detail = fmt.Sprintf("TCP %d ok, UDP failed: %v", bound, err)
+		r.Suggestions = []string{"QUIC/HTTP3 will be unavailable; transfers fall back to TCP"}
+		return r
+	}
+	_ = pc.Close()
+
+	r.Status = Pass
+	if port == 0 {
+		r.Detail = fmt.Sprintf("ephemeral port %d available (TCP+UDP)", bound)
+	} else {
+		r.Detail = fmt.Sprintf("port %d available (TCP+UDP)", bound)
+	}
+	return r
+}
+
+// CheckPeer probes a running warp server: /health must answer, then a 1MB
+// sample of /speedtest/download gives a rough throughput figure
+func CheckPeer(ctx context.Context, client *http.Client, peerURL string) Result {
+	r := Result{Name: "Peer reachability"}
+	u, err := url.Parse(peerURL)
+	if err != nil || u.Host == "" {
+		r.Status = Fail
+		r.Detail = fmt.Sprintf("invalid URL: %s", peerURL)
+		r.Suggestions = []string{"Use the full URL printed by the sender, e.g. http://192.168.1.5:41234/d/<token>"}
+		return r
+	}
+	if u.Scheme == "" {
+		u.Scheme = "http"
+	}
+	base := u.Scheme + "://" + u.Host
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	start := time.Now()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, base+"/health", nil)
+	resp, err := client.Do(req)
+	if err != nil {
+		r.Status = Fail
+		r.Detail = err.Error()
+		r.Suggestions = []string{
+			"Check that the server is still running",
+			"Ensure both devices are on the same network",
+			"Check that a firewall is not dropping the port",
+		}
+		return r
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+	latency := time.Since(start)
+	if resp.StatusCode != http.StatusOK {
+		r.Status = Fail
+		r.Detail = fmt.Sprintf("/health returned HTTP %d", resp.StatusCode)
+		r.Suggestions = []string{"Verify the URL points at a warp server"}
+		return r
+	}
+
+	start = time.Now()
+	req, _ = http.NewRequestWithContext(ctx, http.MethodGet, base+"/speedtest/download", nil)
+	resp, err = client.Do(req)
+	if err != nil {
+		r.Status = Warn
+		r.Detail = fmt.Sprintf("healthy (%s), speed sample failed: %v", latency.Round(time.Millisecond), err)
+		return r
+	}
+	n, err := io.CopyN(io.Discard, resp.Body, peerSampleSize)
+	_ = resp.Body.Close()
+	elapsed := time.Since(start)
+	if err != nil && err != io.EOF {
+		r.Status = Warn
+		r.Detail = fmt.Sprintf("healthy (%s), speed sample interrupted after %s: %v", latency.Round(time.Millisecond), ui.FormatBytes(n), err)
+		return r
+	}
+
+	r.Status = Pass
+	r.Detail = fmt.Sprintf("healthy, latency %s, %s sample at %s", latency.Round(time.Millisecond), ui.FormatBytes(n), ui.FormatSpeed(float64(n)/elapsed.Seconds()))
+	return r
+}
+
+// CheckDiskSpace verifies dir exists, is writable and has free space
+func CheckDiskSpace(dir string) Result {
+	r := Result{Name: "Disk space"}
+	if dir == "" {
+		dir = "."
+	}
+	fi, err := os.Stat(dir)
+	if err != nil || !fi.IsDir() {
+		r.Status = Fail
+		r.Detail = fmt.Sprintf("upload directory %s does not exist", dir)
+		r.Suggestions = []string{"Create the directory or change upload_dir with 'warp config edit'"}
+		return r
+	}
+	probe, err := os.CreateTemp(dir, ".warp-doctor-*")
+	if err != nil {
+		r.Status = Fail
+		r.Detail = fmt.Sprintf("%s is not writable: %v", dir, err)
+		r.Suggestions = []string{"Check directory permissions", "Choose a different directory with --dest"}
+		return r
+	}
+	_ = probe.Close()
+	_ = os.Remove(probe.Name())
+
+	abs, _ := filepath.Abs(dir)
+	avail, err := platform.Current.DiskFree(dir)
+	if err != nil {
+		r.Status = Pass
+		r.Detail = fmt.Sprintf("%s writable (free space unknown on this platform)", abs)
+		return r
+	}
+	r.Detail = fmt.Sprintf("%s free in %s", ui.FormatBytes(avail), abs)
+	if avail < lowDiskThreshold {
+		r.Status = Warn
+		r.Suggestions = []string{"Free up disk space", "Choose a different destination directory"}
+		return r
+	}
+	r.Status = Pass
+	return r
+}
+
+// CheckConfig reports whether the config file loaded and holds valid values.
+// It takes the result of config.LoadConfig so callers control where it is read from.
+func CheckConfig(cfg *config.Config, loadErr error) Result {
+	r := Result{Name: "Config file"}
+	suggestions := []string{
+		"Check your config file at " + config.GetConfigPath(),
+		"Run 'warp config show' to see current settings",
+		"Delete the config file to reset to defaults",
+	}
+	if loadErr != nil {
+		r.Status = Fail
+		r.Detail = loadErr.Error()
+		r.Suggestions = suggestions
+		return r
+	}
+	if err := cfg.Validate(); err != nil {
+		r.Status = Fail
+		r.Detail = err.Error()
+		r.Suggestions = suggestions
+		return r
+	}
+	r.Status = Pass
+	r.Detail = config.GetConfigPath()
+	if _, err := os.Stat(r.Detail); err != nil {
+		r.Detail = "no config file, using defaults"
+	}
+	return r
+}
@@ -0,0 +1,102 @@
+package doctor
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/zulfikawr/warp/internal/config"
+)
+
+func TestCheckInterfaceUnknown(t *testing.T) {
+	r := CheckInterface("warp-does-not-exist0")
+	if r.Status != Fail {
+		t.Fatalf("status = %s, want fail", r.Status)
+	}
+	if len(r.Suggestions) == 0 {
+		t.Error("expected suggestions for failed check")
+	}
+}
+
+func TestCheckPortBind(t *testing.T) {
+	if r := CheckPortBind(0); r.Status == Fail {
+		t.Fatalf("ephemeral port: status = %s (%s)", r.Status, r.Detail)
+	}
+
+	ln, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = ln.Close() }()
+	busy := ln.Addr().(*net.TCPAddr).Port
+	if r := CheckPortBind(busy); r.Status != Fail {
+		t.Fatalf("busy port %d: status = %s, want fail", busy, r.Status)
+	}
+}
+
+func TestCheckPeer(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/health":
+			_, _ = w.Write([]byte(`{"status":"ok"}`))
+		case "/speedtest/download":
+			_, _ = w.Write(make([]byte, 2*peerSampleSize))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+
+	r := CheckPeer(context.Background(), ts.Client(), ts.URL+"/d/token")
+	if r.Status != Pass {
+		t.Fatalf("status = %s (%s), want pass", r.Status, r.Detail)
+	}
+	if !strings.Contains(r.Detail, "1.0 MiB") {
+		t.Errorf("detail %q does not mention the 1MB sample", r.Detail)
+	}
+
+	ts.Close()
+	if r := CheckPeer(context.Background(), nil, ts.URL); r.Status != Fail {
+		t.Fatalf("closed server: status = %s, want fail", r.Status)
+	}
+	if r := CheckPeer(context.Background(), nil, "not a url"); r.Status != Fail {
+		t.Fatalf("invalid URL: status = %s, want fail", r.Status)
+	}
+}
+
+func TestCheckDiskSpace(t *testing.T) {
+	if r := CheckDiskSpace(t.TempDir()); r.Status == Fail {
+		t.Fatalf("temp dir: status = %s (%s)", r.Status, r.Detail)
+	}
+	missing := filepath.Join(t.TempDir(), "missing")
+	if r := CheckDiskSpace(missing); r.Status != Fail {
+		t.Fatalf("missing dir: status = %s, want fail", r.Status)
+	}
+}
+
+func TestCheckConfig(t *testing.T) {
+	if r := CheckConfig(config.DefaultConfig(), nil); r.Status != Pass {
+		t.Fatalf("default config: status = %s (%s)", r.Status, r.Detail)
+	}
+	if r := CheckConfig(nil, errors.New("yaml: line 3: bad indent")); r.Status != Fail {
+		t.Fatalf("load error: status = %s, want fail", r.Status)
+	}
+	bad := config.DefaultConfig()
+	bad.ParallelWorkers = 0
+	if r := CheckConfig(bad, nil); r.Status != Fail {
+		t.Fatalf("invalid config: status = %s, want fail", r.Status)
+	}
+}
+
+func TestFailed(t *testing.T) {
+	if Failed([]Result{{Status: Pass}, {Status: Warn}}) {
+		t.Error("warnings alone should not fail")
+	}
+	if !Failed([]Result{{Status: Pass}, {Status: Fail}}) {
+		t.Error("expected failure")
+	}
+}
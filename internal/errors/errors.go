@@ -2,8 +2,9 @@ package errors
 
 import (
 	"errors"
-	"fmt"
 	"strings"
+
+	"github.com/zulfikawr/warp/internal/i18n"
 )
 
 // UserError represents an error with user-friendly message and suggestions
@@ -19,7 +20,7 @@ func (e *UserError) Error() string {
 	sb.WriteString(e.Message)
 
 	if len(e.Suggestions) > 0 {
-		sb.WriteString("\n\nPossible solutions:")
+		sb.WriteString("\n\n" + i18n.T("error.suggestions"))
 		for _, suggestion := range e.Suggestions {
 			sb.WriteString("\n  • ")
 			sb.WriteString(suggestion)
@@ -27,8 +28,7 @@ func (e *UserError) Error() string {
 	}
 
 	if e.Err != nil {
-		sb.WriteString("\n\nTechnical details: ")
-		sb.WriteString(e.Err.Error())
+		sb.WriteString("\n\n" + i18n.T("error.details", e.Err.Error()))
 	}
 
 	return sb.String()
@@ -54,17 +54,18 @@ func IsUserError(err error) bool {
 	return errors.As(err, &userErr)
 }
 
-// Common error constructors for typical scenarios
+// Common error constructors for typical scenarios. Their messages come from
+// the i18n catalog, in the user's language.
 
 // ConnectionError creates an error for connection failures
 func ConnectionError(url string, err error) error {
 	return NewUserError(
-		fmt.Sprintf("Failed to connect to %s", url),
+		i18n.T("error.connection", url),
 		[]string{
-			"Check if the server is running",
-			"Verify the URL/token is correct",
-			"Ensure both devices are on the same network",
-			"Check firewall settings",
+			i18n.T("hint.server_running"),
+			i18n.T("hint.url_token"),
+			i18n.T("hint.same_network"),
+			i18n.T("hint.firewall"),
 		},
 		err,
 	)
@@ -73,11 +74,11 @@ func ConnectionError(url string, err error) error {
 // FileNotFoundError creates an error for missing files
 func FileNotFoundError(path string, err error) error {
 	return NewUserError(
-		fmt.Sprintf("File not found: %s", path),
+		i18n.T("error.file_not_found", path),
 		[]string{
-			"Check if the file path is correct",
-			"Verify you have read permissions",
-			"Ensure the file still exists",
+			i18n.T("hint.path_correct"),
+			i18n.T("hint.read_permission"),
+			i18n.T("hint.file_still_exists"),
 		},
 		err,
 	)
@@ -86,11 +87,11 @@ func FileNotFoundError(path string, err error) error {
 // FileExistsError creates an error for existing files
 func FileExistsError(path string) error {
 	return NewUserError(
-		fmt.Sprintf("File already exists: %s", path),
+		i18n.T("error.file_exists", path),
 		[]string{
-			"Use --force flag to overwrite",
-			"Specify a different output path with --output",
-			"Rename or move the existing file",
+			i18n.T("hint.force"),
+			i18n.T("hint.output"),
+			i18n.T("hint.rename"),
 		},
 		nil,
 	)
@@ -99,11 +100,11 @@ func FileExistsError(path string) error {
 // PermissionError creates an error for permission issues
 func PermissionError(operation, path string, err error) error {
 	return NewUserError(
-		fmt.Sprintf("Permission denied: cannot %s %s", operation, path),
+		i18n.T("error.permission", operation, path),
 		[]string{
-			"Check file/directory permissions",
-			"Try running with appropriate privileges",
-			"Ensure the directory is writable",
+			i18n.T("hint.check_permissions"),
+			i18n.T("hint.privileges"),
+			i18n.T("hint.dir_writable"),
 		},
 		err,
 	)
@@ -112,11 +113,11 @@ func PermissionError(operation, path string, err error) error {
 // DiskSpaceError creates an error for insufficient disk space
 func DiskSpaceError(required, available int64) error {
 	return NewUserError(
-		fmt.Sprintf("Insufficient disk space (need %d bytes, have %d bytes)", required, available),
+		i18n.T("error.disk_space", required, available),
 		[]string{
-			"Free up disk space",
-			"Choose a different destination directory",
-			"Delete unnecessary files",
+			i18n.T("hint.free_space"),
+			i18n.T("hint.other_destination"),
+			i18n.T("hint.delete_files"),
 		},
 		nil,
 	)
@@ -125,11 +126,11 @@ func DiskSpaceError(required, available int64) error {
 // InvalidURLError creates an error for malformed URLs
 func InvalidURLError(url string, err error) error {
 	return NewUserError(
-		fmt.Sprintf("Invalid URL: %s", url),
+		i18n.T("error.invalid_url", url),
 		[]string{
-			"Check the URL format (should be http://host:port/d/token or http://host:port/u/token)",
-			"Verify the token is correct",
-			"Try copying the URL again from the server",
+			i18n.T("hint.url_format"),
+			i18n.T("hint.token_correct"),
+			i18n.T("hint.copy_url"),
 		},
 		err,
 	)
@@ -140,10 +141,10 @@ func ConfigError(message string, err error) error {
 	return NewUserError(
 		message,
 		[]string{
-			"Check your config file at ~/.config/warp/warp.yaml",
-			"Verify the YAML syntax is correct",
-			"Try running 'warp config show' to see current settings",
-			"Delete the config file to reset to defaults",
+			i18n.T("hint.config_file"),
+			i18n.T("hint.yaml_syntax"),
+			i18n.T("hint.config_show"),
+			i18n.T("hint.config_reset"),
 		},
 		err,
 	)
@@ -0,0 +1,209 @@
+// Package i18n looks up user-facing messages in per-locale catalogs embedded
+// from locales/<tag>.json. Messages take ordered placeholders, {1} for the
+// first argument, so a translation can move them to suit its word order. A
+// key missing from the selected locale falls back to English, and a locale
+// warp doesn't know selects English; nothing here fails.
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// DefaultLocale is the locale every other one falls back to
+const DefaultLocale = "en"
+
+// EnvVar selects the locale ahead of the config file and the system locale
+const EnvVar = "WARP_LANG"
+
+//go:embed locales/*.json
+var localeFS embed.FS
+
+// catalogs maps a locale tag to its messages
+var catalogs = loadCatalogs()
+
+// current is the selected locale's catalog; nil means DefaultLocale
+var current atomic.Pointer[catalog]
+
+type catalog struct {
+	tag      string
+	messages map[string]string
+}
+
+func loadCatalogs() map[string]*catalog {
+	entries, err := localeFS.ReadDir("locales")
+	if err != nil {
+		panic(err)
+	}
+	out := make(map[string]*catalog, len(entries))
+	for _, e := range entries {
+		data, err := localeFS.ReadFile(path.Join("locales", e.Name()))
+		if err != nil {
+			panic(err)
+		}
+		c := &catalog{tag: strings.TrimSuffix(e.Name(), ".json")}
+		if err := json.Unmarshal(data, &c.messages); err != nil {
+			panic(fmt.Sprintf("i18n: locales/%s: %v", e.Name(), err))
+		}
+		out[c.tag] = c
+	}
+	if out[DefaultLocale] == nil {
+		panic("i18n: no " + DefaultLocale + " catalog")
+	}
+	return out
+}
+
+// SetLocale selects the catalog for a locale such as "id", "id_ID.UTF-8" or
+// "pt-BR", trying the whole tag and then its language alone. It returns the
+// locale selected, DefaultLocale when none matches.
+func SetLocale(locale string) string {
+	c := match(locale)
+	if c == nil {
+		c = catalogs[DefaultLocale]
+	}
+	current.Store(c)
+	return c.tag
+}
+
+// match finds the catalog for locale, or nil
+func match(locale string) *catalog {
+	// Drop the encoding and modifier of POSIX locales, e.g. ".UTF-8@euro"
+	if i := strings.IndexAny(locale, ".@"); i >= 0 {
+		locale = locale[:i]
+	}
+	tag := strings.ToLower(strings.ReplaceAll(locale, "_", "-"))
+	if c, ok := catalogs[tag]; ok {
+		return c
+	}
+	if lang, _, ok := strings.Cut(tag, "-"); ok {
+		return catalogs[lang]
+	}
+	return nil
+}
+
+// Detect picks the locale to use: WARP_LANG, then configured (the config
+// file's language), then the system locale from LC_ALL, LC_MESSAGES and
+// LANG. The first one that names a known catalog wins, so a typo in one
+// doesn't hide the next; with none, it returns DefaultLocale.
+func Detect(configured string) string {
+	for _, locale := range []string{os.Getenv(EnvVar), configured, os.Getenv("LC_ALL"), os.Getenv("LC_MESSAGES"), os.Getenv("LANG")} {
+		if c := match(locale); c != nil {
+			return c.tag
+		}
+	}
+	return DefaultLocale
+}
+
+// T returns the message for key in the selected locale, with {n} replaced by
+// the nth argument. A key the locale lacks is taken from English, and a key
+// no catalog has is returned as it is.
+func T(key string, args ...any) string {
+	msg, ok := lookup(key)
+	if !ok {
+		msg = key
+	}
+	return format(msg, args)
+}
+
+// Label translates a title or label that is also shown as it is, such as a
+// transfer summary's, which JSON output keeps in English. Its key is
+// "label." plus the text in snake case: "Avg Speed" is label.avg_speed. Text
+// without a message is returned unchanged.
+func Label(text string) string {
+	if msg, ok := lookup(labelKey(text)); ok {
+		return msg
+	}
+	return text
+}
+
+// labelKey returns the catalog key Label looks text up by
+func labelKey(text string) string {
+	var b strings.Builder
+	b.WriteString("label.")
+	sep := false
+	for _, r := range strings.ToLower(text) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			if sep && b.Len() > len("label.") {
+				b.WriteByte('_')
+			}
+			b.WriteRune(r)
+			sep = false
+			continue
+		}
+		sep = true
+	}
+	return b.String()
+}
+
+func lookup(key string) (string, bool) {
+	if c := current.Load(); c != nil {
+		if msg, ok := c.messages[key]; ok {
+			return msg, true
+		}
+	}
+	msg, ok := catalogs[DefaultLocale].messages[key]
+	return msg, ok
+}
+
+// format replaces {1}, {2}, ... with args. Placeholders beyond args, and
+// braces around anything else, are left as they are.
+func format(msg string, args []any) string {
+	if len(args) == 0 || !strings.Contains(msg, "{") {
+		return msg
+	}
+	var b strings.Builder
+	for {
+		open := strings.IndexByte(msg, '{')
+		if open < 0 {
+			break
+		}
+		end := strings.IndexByte(msg[open:], '}')
+		if end < 0 {
+			break
+		}
+		n, err := strconv.Atoi(msg[open+1 : open+end])
+		if err != nil || n < 1 || n > len(args) {
+			b.WriteString(msg[:open+1])
+			msg = msg[open+1:]
+			continue
+		}
+		b.WriteString(msg[:open])
+		fmt.Fprint(&b, args[n-1])
+		msg = msg[open+end+1:]
+	}
+	b.WriteString(msg)
+	return b.String()
+}
+
+// placeholders returns the placeholder numbers msg uses, sorted and without
+// repeats
+func placeholders(msg string) []int {
+	seen := make(map[int]bool)
+	for {
+		open := strings.IndexByte(msg, '{')
+		if open < 0 {
+			break
+		}
+		end := strings.IndexByte(msg[open:], '}')
+		if end < 0 {
+			break
+		}
+		if n, err := strconv.Atoi(msg[open+1 : open+end]); err == nil && n >= 1 {
+			seen[n] = true
+		}
+		msg = msg[open+1:]
+	}
+	nums := make([]int, 0, len(seen))
+	for n := range seen {
+		nums = append(nums, n)
+	}
+	sort.Ints(nums)
+	return nums
+}
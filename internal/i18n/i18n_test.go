@@ -0,0 +1,280 @@
+package i18n
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		msg  string
+		args []any
+		want string
+	}{
+		{"Failed to connect to {1}", []any{"host:80"}, "Failed to connect to host:80"},
+		{"tersedia {2} byte, dibutuhkan {1} byte", []any{10, 4}, "tersedia 4 byte, dibutuhkan 10 byte"},
+		{"{1} and {1} again", []any{"x"}, "x and x again"},
+		{"missing {2}", []any{"x"}, "missing {2}"},
+		{"not {a} placeholder {1}", []any{"but"}, "not {a} placeholder but"},
+		{"unclosed {1", []any{"x"}, "unclosed {1"},
+		{"no args {1}", nil, "no args {1}"},
+	}
+	for _, tt := range tests {
+		if got := format(tt.msg, tt.args); got != tt.want {
+			t.Errorf("format(%q, %v) = %q, want %q", tt.msg, tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestSetLocale(t *testing.T) {
+	defer SetLocale(DefaultLocale)
+	tests := []struct{ locale, want string }{
+		{"id", "id"},
+		{"id_ID.UTF-8", "id"},
+		{"ID-id", "id"},
+		{"en_GB.UTF-8@euro", "en"},
+		{"C", DefaultLocale},
+		{"xx_YY", DefaultLocale},
+		{"", DefaultLocale},
+	}
+	for _, tt := range tests {
+		if got := SetLocale(tt.locale); got != tt.want {
+			t.Errorf("SetLocale(%q) = %q, want %q", tt.locale, got, tt.want)
+		}
+	}
+
+	SetLocale("id")
+	if got := T("error.connection", "host:80"); got != "Gagal terhubung ke host:80" {
+		t.Errorf("id error.connection = %q", got)
+	}
+	if got := Label("Avg Speed"); got != "Kecepatan Rata-rata" {
+		t.Errorf("id Label(Avg Speed) = %q", got)
+	}
+}
+
+func TestFallback(t *testing.T) {
+	catalogs["zz"] = &catalog{tag: "zz", messages: map[string]string{"help.usage": "Zz"}}
+	defer func() {
+		delete(catalogs, "zz")
+		SetLocale(DefaultLocale)
+	}()
+	SetLocale("zz")
+	if got := T("help.usage"); got != "Zz" {
+		t.Errorf("translated key = %q", got)
+	}
+	if got := T("help.flags"); got != "Flags" {
+		t.Errorf("key missing from the locale = %q, want the English", got)
+	}
+	if got := T("no.such.key"); got != "no.such.key" {
+		t.Errorf("unknown key = %q", got)
+	}
+	if got := Label("Not A Label"); got != "Not A Label" {
+		t.Errorf("unknown label = %q", got)
+	}
+}
+
+func TestDetect(t *testing.T) {
+	for _, v := range []string{EnvVar, "LC_ALL", "LC_MESSAGES", "LANG"} {
+		t.Setenv(v, "")
+	}
+	if got := Detect(""); got != DefaultLocale {
+		t.Errorf("nothing set: %q", got)
+	}
+	t.Setenv("LANG", "id_ID.UTF-8")
+	if got := Detect(""); got != "id" {
+		t.Errorf("LANG: %q", got)
+	}
+	t.Setenv("LC_ALL", "fr_FR.UTF-8") // No catalog: LANG still counts
+	if got := Detect(""); got != "id" {
+		t.Errorf("unknown LC_ALL before LANG: %q", got)
+	}
+	t.Setenv(EnvVar, "en")
+	if got := Detect("id"); got != "en" {
+		t.Errorf("WARP_LANG over the config: %q", got)
+	}
+	t.Setenv(EnvVar, "")
+	t.Setenv("LANG", "en_US.UTF-8")
+	if got := Detect("id"); got != "id" {
+		t.Errorf("config over LANG: %q", got)
+	}
+}
+
+func TestLabelKey(t *testing.T) {
+	for text, want := range map[string]string{
+		"Avg Speed":       "label.avg_speed",
+		"Transfer ID":     "label.transfer_id",
+		"Upload complete": "label.upload_complete",
+		" Saved  to ":     "label.saved_to",
+	} {
+		if got := labelKey(text); got != want {
+			t.Errorf("labelKey(%q) = %q, want %q", text, got, want)
+		}
+	}
+}
+
+// TestCatalogsComplete checks that every locale translates every English
+// message, with the same placeholders
+func TestCatalogsComplete(t *testing.T) {
+	en := catalogs[DefaultLocale].messages
+	for tag, c := range catalogs {
+		if tag == DefaultLocale {
+			continue
+		}
+		for key, msg := range en {
+			tr, ok := c.messages[key]
+			if !ok {
+				t.Errorf("%s: missing %s", tag, key)
+				continue
+			}
+			if !reflect.DeepEqual(placeholders(tr), placeholders(msg)) {
+				t.Errorf("%s: %s uses placeholders %v, English %v", tag, key, placeholders(tr), placeholders(msg))
+			}
+		}
+		for key := range c.messages {
+			if _, ok := en[key]; !ok {
+				t.Errorf("%s: %s is not an English key", tag, key)
+			}
+		}
+	}
+}
+
+// TestKeysInCatalog walks the module's source for the keys passed to T and
+// the summary titles and labels translated with Label, and checks that the
+// English catalog has each, labels spelled as in the code
+func TestKeysInCatalog(t *testing.T) {
+	en := catalogs[DefaultLocale].messages
+	keys, labels := usedKeys(t, filepath.Join("..", ".."))
+	if len(keys) == 0 || len(labels) == 0 {
+		t.Fatalf("found %d keys and %d labels; is the walk broken?", len(keys), len(labels))
+	}
+	for key, pos := range keys {
+		if _, ok := en[key]; !ok {
+			t.Errorf("%s: %s is not in locales/en.json", pos, key)
+		}
+	}
+	for text, pos := range labels {
+		if msg, ok := en[labelKey(text)]; !ok || msg != text {
+			t.Errorf("%s: label %q needs %s: %q in locales/en.json", pos, text, labelKey(text), text)
+		}
+	}
+}
+
+// usedKeys returns the literal keys of i18n.T calls, and the literal Title
+// and Label of ui.Summary and ui.Field values, each with where it's used. A
+// T call whose key isn't a literal fails the test, since it can't be checked.
+func usedKeys(t *testing.T, root string) (keys, labels map[string]string) {
+	keys, labels = make(map[string]string), make(map[string]string)
+	fset := token.NewFileSet()
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if name := d.Name(); name == "testdata" || (strings.HasPrefix(name, ".") && name != "." && name != "..") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(path, ".go") || strings.HasSuffix(path, "_test.go") {
+			return nil
+		}
+		f, err := parser.ParseFile(fset, path, nil, 0)
+		if err != nil {
+			return err
+		}
+		ast.Inspect(f, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.CallExpr:
+				if isCall(n, "i18n", "T") {
+					key, ok := stringLit(n.Args[0])
+					if !ok {
+						t.Errorf("%s: i18n.T key is not a string literal", fset.Position(n.Pos()))
+						return true
+					}
+					keys[key] = fset.Position(n.Pos()).String()
+				}
+			case *ast.CompositeLit:
+				lits := []*ast.CompositeLit{n}
+				name := typeName(n.Type)
+				if arr, ok := n.Type.(*ast.ArrayType); ok {
+					// []ui.Field{{Label: ...}}: the elements have no type of their own
+					name, lits = typeName(arr.Elt), nil
+					for _, elt := range n.Elts {
+						if lit, ok := elt.(*ast.CompositeLit); ok && lit.Type == nil {
+							lits = append(lits, lit)
+						}
+					}
+				}
+				if name != "Summary" && name != "Field" {
+					return true
+				}
+				for _, lit := range lits {
+					for _, elt := range lit.Elts {
+						kv, ok := elt.(*ast.KeyValueExpr)
+						if !ok || !(isIdent(kv.Key, "Title") || isIdent(kv.Key, "Label")) {
+							continue
+						}
+						if text, ok := stringLit(kv.Value); ok && text != "" {
+							labels[text] = fset.Position(kv.Pos()).String()
+						}
+					}
+				}
+			case *ast.AssignStmt:
+				// sum.Title = "..."
+				for i, lhs := range n.Lhs {
+					sel, ok := lhs.(*ast.SelectorExpr)
+					if !ok || sel.Sel.Name != "Title" || i >= len(n.Rhs) {
+						continue
+					}
+					if text, ok := stringLit(n.Rhs[i]); ok && text != "" {
+						labels[text] = fset.Position(n.Pos()).String()
+					}
+				}
+			}
+			return true
+		})
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keys, labels
+}
+
+func isCall(call *ast.CallExpr, pkg, fn string) bool {
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	return ok && isIdent(sel.X, pkg) && sel.Sel.Name == fn && len(call.Args) > 0
+}
+
+func isIdent(e ast.Expr, name string) bool {
+	id, ok := e.(*ast.Ident)
+	return ok && id.Name == name
+}
+
+// typeName returns the name of a composite literal's type: Summary for
+// ui.Summary
+func typeName(e ast.Expr) string {
+	switch e := e.(type) {
+	case *ast.Ident:
+		return e.Name
+	case *ast.SelectorExpr:
+		return e.Sel.Name
+	}
+	return ""
+}
+
+func stringLit(e ast.Expr) (string, bool) {
+	lit, ok := e.(*ast.BasicLit)
+	if !ok || lit.Kind != token.STRING {
+		return "", false
+	}
+	s, err := strconv.Unquote(lit.Value)
+	return s, err == nil
+}
@@ -10,6 +10,7 @@ import (
 )
 
 var (
+	mu      sync.RWMutex // Guards logger and sugar, which tests swap while servers log
 	logger  *zap.Logger
 	sugar   *zap.SugaredLogger
 	once    sync.Once
@@ -37,15 +38,26 @@ func initLogger() {
 			initErr = err
 			fmt.Fprintf(os.Stderr, "Warning: failed to initialize logger: %v\n", err)
 		}
+		logger = withRedaction(logger)
 		sugar = logger.Sugar()
 	})
 }
 
+// current returns the package loggers, initializing them on first use
+func current() (*zap.Logger, *zap.SugaredLogger) {
+	initLogger()
+	mu.RLock()
+	defer mu.RUnlock()
+	return logger, sugar
+}
+
 // SetLevel sets the logging level
-// verbosity: 0 = warn, 1 = info (-v), 2 = debug (-vv), 3+ = debug with caller (-vvv)
+// verbosity: -1 = error (-q), 0 = warn, 1 = info (-v), 2 = debug (-vv), 3+ = debug with caller (-vvv)
 func SetLevel(verbosity int) {
 	var lvl zapcore.Level
 	switch verbosity {
+	case -1:
+		lvl = zapcore.ErrorLevel
 	case 0:
 		lvl = zapcore.WarnLevel
 	case 1:
@@ -60,21 +72,44 @@ func SetLevel(verbosity int) {
 
 // GetLogger returns the structured logger
 func GetLogger() *zap.Logger {
-	initLogger()
-	return logger
+	l, _ := current()
+	return l
 }
 
 // GetSugar returns the sugared logger for easier use
 func GetSugar() *zap.SugaredLogger {
+	_, s := current()
+	return s
+}
+
+// With returns a child logger that adds fields to every entry, e.g. a transfer ID
+func With(fields ...zap.Field) *zap.Logger {
+	l, _ := current()
+	return l.With(fields...)
+}
+
+// ReplaceLogger swaps the package logger (used by tests to capture output)
+// and returns a function that restores the previous one. Tokens are redacted
+// on the replacement too.
+func ReplaceLogger(l *zap.Logger) func() {
 	initLogger()
-	return sugar
+	mu.Lock()
+	defer mu.Unlock()
+	prevLogger, prevSugar := logger, sugar
+	logger = withRedaction(l)
+	sugar = logger.Sugar()
+	return func() {
+		mu.Lock()
+		defer mu.Unlock()
+		logger, sugar = prevLogger, prevSugar
+	}
 }
 
 // Sync flushes any buffered log entries
 func Sync() {
-	initLogger()
-	_ = logger.Sync()
-	_ = sugar.Sync()
+	l, s := current()
+	_ = l.Sync()
+	_ = s.Sync()
 }
 
 // InitError returns any error that occurred during logger initialization
@@ -85,42 +120,42 @@ func InitError() error {
 
 // Info logs an informational message
 func Info(msg string, fields ...zap.Field) {
-	initLogger()
-	logger.Info(msg, fields...)
+	l, _ := current()
+	l.Info(msg, fields...)
 }
 
 // Warn logs a warning message
 func Warn(msg string, fields ...zap.Field) {
-	initLogger()
-	logger.Warn(msg, fields...)
+	l, _ := current()
+	l.Warn(msg, fields...)
 }
 
 // Error logs an error message
 func Error(msg string, fields ...zap.Field) {
-	initLogger()
-	logger.Error(msg, fields...)
+	l, _ := current()
+	l.Error(msg, fields...)
 }
 
 // Debug logs a debug message
 func Debug(msg string, fields ...zap.Field) {
-	initLogger()
-	logger.Debug(msg, fields...)
+	l, _ := current()
+	l.Debug(msg, fields...)
 }
 
 // Infof logs a formatted informational message (sugared)
 func Infof(template string, args ...interface{}) {
-	initLogger()
-	sugar.Infof(template, args...)
+	_, s := current()
+	s.Infof(template, args...)
 }
 
 // Warnf logs a formatted warning message (sugared)
 func Warnf(template string, args ...interface{}) {
-	initLogger()
-	sugar.Warnf(template, args...)
+	_, s := current()
+	s.Warnf(template, args...)
 }
 
 // Errorf logs a formatted error message (sugared)
 func Errorf(template string, args ...interface{}) {
-	initLogger()
-	sugar.Errorf(template, args...)
+	_, s := current()
+	s.Errorf(template, args...)
 }
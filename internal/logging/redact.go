@@ -0,0 +1,112 @@
+package logging
+
+import (
+	"regexp"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// tokenPrefixLen is how much of a token survives redaction, enough to tell
+// shares apart in the logs
+const tokenPrefixLen = 4
+
+// tokenPath matches a share path (/d/, /u/, /s/ or /ws/progress/ plus token) at the
+// start of a string, after a separator, or after the host of a URL. Plain
+// filesystem paths such as /home/u/docs don't match.
+var tokenPath = regexp.MustCompile(`(^|[\s"'(=]|//[^/\s"']+)(/(?:d|u|s|ws/progress)/)([^/?#\s"'),]+)`)
+
+// fullURLs turns redaction off, for --log-full-urls
+var fullURLs atomic.Bool
+
+// SetFullURLs controls whether logs and errors keep share tokens in full
+func SetFullURLs(on bool) {
+	fullURLs.Store(on)
+}
+
+// RedactToken keeps the first few characters of token
+func RedactToken(token string) string {
+	if fullURLs.Load() || len(token) <= tokenPrefixLen {
+		return token
+	}
+	return token[:tokenPrefixLen] + "..."
+}
+
+// Redact shortens every share token found in s, e.g.
+// http://10.0.0.2:8080/d/3f9a1c... keeps its host and port but only "3f9a"
+// of the token
+func Redact(s string) string {
+	if fullURLs.Load() {
+		return s
+	}
+	return tokenPath.ReplaceAllStringFunc(s, func(m string) string {
+		sub := tokenPath.FindStringSubmatch(m)
+		return sub[1] + sub[2] + RedactToken(sub[3])
+	})
+}
+
+// redactCore rewrites messages and fields before they reach the wrapped core
+type redactCore struct {
+	zapcore.Core
+}
+
+// withRedaction wraps l so nothing it writes carries a full token
+func withRedaction(l *zap.Logger) *zap.Logger {
+	return l.WithOptions(zap.WrapCore(func(c zapcore.Core) zapcore.Core {
+		return redactCore{c}
+	}))
+}
+
+func (c redactCore) With(fields []zapcore.Field) zapcore.Core {
+	return redactCore{c.Core.With(redactFields(fields))}
+}
+
+func (c redactCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c redactCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	ent.Message = Redact(ent.Message)
+	return c.Core.Write(ent, redactFields(fields))
+}
+
+// redactFields returns fields with tokens shortened, copying only when one
+// of them changes
+func redactFields(fields []zapcore.Field) []zapcore.Field {
+	if fullURLs.Load() {
+		return fields
+	}
+	out := fields
+	for i, f := range fields {
+		var s string
+		switch {
+		case f.Type == zapcore.StringType && f.Key == "token":
+			s = RedactToken(f.String)
+		case f.Type == zapcore.StringType:
+			s = Redact(f.String)
+		case f.Type == zapcore.ErrorType:
+			err, ok := f.Interface.(error)
+			if !ok || err == nil {
+				continue
+			}
+			msg := err.Error()
+			if s = Redact(msg); s == msg {
+				continue
+			}
+		default:
+			continue
+		}
+		if f.Type == zapcore.StringType && s == f.String {
+			continue
+		}
+		if &out[0] == &fields[0] {
+			out = append([]zapcore.Field(nil), fields...)
+		}
+		out[i] = zap.String(f.Key, s)
+	}
+	return out
+}
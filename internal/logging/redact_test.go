@@ -0,0 +1,82 @@
+package logging
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+const testToken = "3f9a1c0be47d2a58"
+
+func TestRedact(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"/d/" + testToken, "/d/3f9a..."},
+		{"/u/" + testToken + "/chunk", "/u/3f9a.../chunk"},
+		{"/ws/progress/" + testToken, "/ws/progress/3f9a..."},
+		{"/s/k7m2qx", "/s/k7m2..."},
+		{`Get "http://10.0.0.2:8080/d/` + testToken + `": connection refused`, `Get "http://10.0.0.2:8080/d/3f9a...": connection refused`},
+		{"Invalid URL: http://host:1/u/" + testToken + "?x=1", "Invalid URL: http://host:1/u/3f9a...?x=1"},
+		{"/d/abc", "/d/abc"},
+		{"/home/u/documents/report.pdf", "/home/u/documents/report.pdf"},
+		{"no tokens here", "no tokens here"},
+	}
+	for _, tt := range tests {
+		if got := Redact(tt.in); got != tt.want {
+			t.Errorf("Redact(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestLoggerRedactsTokens(t *testing.T) {
+	core, logs := observer.New(zapcore.InfoLevel)
+	defer ReplaceLogger(zap.New(core))()
+
+	url := "http://10.0.0.2:8080/d/" + testToken
+	With(zap.String("path", "/u/"+testToken)).Info("Request for "+url,
+		zap.String("url", url),
+		zap.String("token", testToken),
+		zap.Error(errors.New(`Get "`+url+`": EOF`)),
+		zap.Int("size", 10),
+	)
+	Infof("Serving %s", url)
+
+	for _, e := range logs.All() {
+		if strings.Contains(e.Message, testToken) {
+			t.Errorf("message %q carries the full token", e.Message)
+		}
+		for k, v := range e.ContextMap() {
+			if s, ok := v.(string); ok && strings.Contains(s, testToken) {
+				t.Errorf("field %s = %q carries the full token", k, s)
+			}
+		}
+	}
+	entry := logs.All()[0].ContextMap()
+	if entry["token"] != "3f9a..." || entry["url"] != "http://10.0.0.2:8080/d/3f9a..." || entry["size"] != int64(10) {
+		t.Errorf("fields = %v", entry)
+	}
+	if entry["path"] != "/u/3f9a..." {
+		t.Errorf("With field path = %v", entry["path"])
+	}
+}
+
+func TestFullURLsKeepsTokens(t *testing.T) {
+	SetFullURLs(true)
+	defer SetFullURLs(false)
+	core, logs := observer.New(zapcore.InfoLevel)
+	defer ReplaceLogger(zap.New(core))()
+
+	Info("Request", zap.String("path", "/d/"+testToken), zap.String("token", testToken))
+	fields := logs.All()[0].ContextMap()
+	if fields["path"] != "/d/"+testToken || fields["token"] != testToken {
+		t.Errorf("fields = %v, want full tokens", fields)
+	}
+	if got := Redact("/d/" + testToken); got != "/d/"+testToken {
+		t.Errorf("Redact = %q with full URLs on", got)
+	}
+}
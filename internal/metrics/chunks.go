@@ -33,6 +33,15 @@ var (
 		[]string{"status"},
 	)
 
+	// ChunkDuplicatesTotal counts chunks received again after they were written.
+	// Use this to see how much bandwidth client retries waste on flaky links.
+	ChunkDuplicatesTotal = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "warp_chunk_duplicates_total",
+			Help: "Total number of duplicate chunk receipts",
+		},
+	)
+
 	// ParallelUploadWorkers tracks the number of active parallel upload workers.
 	// Use this to monitor concurrent chunk upload activity.
 	ParallelUploadWorkers = promauto.NewGauge(
@@ -1,6 +1,8 @@
 package metrics
 
 import (
+	"time"
+
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 )
@@ -24,6 +26,32 @@ var (
 		[]string{"file_ext"},
 	)
 
+	// DownloadTTFB tracks the time from a download request to its first body
+	// byte, checksum computation included.
+	// Labels: file_ext
+	// Use this to tell a slow start (hashing a large file) from a slow link.
+	DownloadTTFB = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "warp_download_ttfb_seconds",
+			Help:    "Time to first byte of a download in seconds",
+			Buckets: prometheus.ExponentialBuckets(0.001, 4, 10), // 1ms to ~4m
+		},
+		[]string{"file_ext"},
+	)
+
+	// DownloadTransferDuration tracks the time a download took after its
+	// first body byte.
+	// Labels: file_ext
+	// Together with DownloadTTFB, it splits a download's duration.
+	DownloadTransferDuration = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "warp_download_transfer_seconds",
+			Help:    "Download duration after the first byte in seconds",
+			Buckets: prometheus.ExponentialBuckets(0.1, 2, 10), // 0.1s to ~100s
+		},
+		[]string{"file_ext"},
+	)
+
 	// DownloadSize tracks the size of downloaded files in bytes.
 	// Labels: file_ext
 	// Use this to understand download size distribution.
@@ -77,3 +105,10 @@ var (
 		},
 	)
 )
+
+// ObserveDownloadTiming records a completed download's time to first byte and
+// the time it took after that.
+func ObserveDownloadTiming(fileExt string, ttfb, transfer time.Duration) {
+	DownloadTTFB.WithLabelValues(fileExt).Observe(ttfb.Seconds())
+	DownloadTransferDuration.WithLabelValues(fileExt).Observe(transfer.Seconds())
+}
@@ -35,6 +35,17 @@ var (
 		[]string{"method", "path", "status"},
 	)
 
+	// TransfersByClient counts transfers by coarse client class.
+	// Labels: class (cli, browser, other)
+	// Use this to see whether transfers come from the CLI or browsers.
+	TransfersByClient = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "warp_transfers_by_client_total",
+			Help: "Total number of transfers by client class",
+		},
+		[]string{"class"},
+	)
+
 	// RateLimitedRequests counts requests that exceeded rate limits.
 	// Labels: client_ip
 	// Use this to identify abusive clients and tune rate limiting.
@@ -45,6 +56,63 @@ var (
 		},
 		[]string{"client_ip"},
 	)
+
+	// ClientBytes is the bytes each client IP moved, uploads and downloads
+	// together, in the current --quota-per-ip period. It is updated as each
+	// transfer or chunk finishes and starts over when the period does.
+	// Labels: client_ip
+	// Use this to find the device filling a shared drop box.
+	ClientBytes = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "warp_client_bytes",
+			Help: "Bytes moved per client IP in the current quota period",
+		},
+		[]string{"client_ip"},
+	)
+
+	// QuotaExceeded counts requests refused with 429 because the client IP
+	// used up its --quota-per-ip.
+	// Labels: client_ip
+	QuotaExceeded = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "warp_quota_exceeded_total",
+			Help: "Total number of requests refused for an exhausted per-IP quota",
+		},
+		[]string{"client_ip"},
+	)
+
+	// TokenRejectedTotal counts requests refused for a wrong share token,
+	// leaving out favicon and other requests browsers make on their own.
+	// Use this to spot clients guessing tokens.
+	TokenRejectedTotal = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "warp_token_rejected_total",
+			Help: "Total number of requests refused for a wrong share token",
+		},
+	)
+
+	// IPFilterDenied counts requests refused by the IP allow/deny lists.
+	// Labels: reason (denied, not_allowed)
+	// Use this to spot clients probing a share they are not meant to reach.
+	IPFilterDenied = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "warp_ip_filter_denied_total",
+			Help: "Total number of requests refused by the IP allow/deny lists",
+		},
+		[]string{"reason"},
+	)
+
+	// SpeedTestBytes counts bytes moved by speed tests as they pass.
+	// Labels: direction (upload, download)
+	// Use this to watch a speed test progress, or to tell its traffic apart
+	// from transfers.
+	SpeedTestBytes = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "warp_speedtest_bytes_total",
+			Help: "Total bytes moved by speed tests",
+		},
+		[]string{"direction"},
+	)
 )
 
 // Helper functions for HTTP metrics
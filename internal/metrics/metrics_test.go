@@ -1,9 +1,14 @@
 package metrics
 
 import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/prometheus/client_golang/prometheus/testutil"
 )
 
@@ -14,15 +19,19 @@ func TestMetricsRegistration(t *testing.T) {
 		UploadSize,
 		UploadThroughput,
 		UploadsTotal,
+		UploadSyncDuration,
 		DownloadDuration,
 		DownloadSize,
 		DownloadThroughput,
 		DownloadsTotal,
+		DownloadTTFB,
+		DownloadTransferDuration,
 		ActiveTransfers,
 		ActiveUploads,
 		ActiveDownloads,
 		ChunkUploadDuration,
 		ChunkUploadsTotal,
+		ChunkDuplicatesTotal,
 		ParallelUploadWorkers,
 		ChecksumVerifications,
 		CacheHits,
@@ -30,6 +39,8 @@ func TestMetricsRegistration(t *testing.T) {
 		CacheSize,
 		ActiveWebSocketConnections,
 		WebSocketMessagesTotal,
+		IPFilterDenied,
+		TokenRejectedTotal,
 	}
 
 	for _, metric := range metrics {
@@ -154,3 +165,36 @@ func TestWebSocketMetrics(t *testing.T) {
 	// Cleanup
 	ActiveWebSocketConnections.Dec()
 }
+
+func TestRecordErrorRedactsTokens(t *testing.T) {
+	reason := `Get "http://10.0.0.2:8080/u/3f9a1c0be47d2a58/chunk": EOF`
+	RecordError(reason, "upload")
+	RecordRetry("upload", reason)
+
+	redacted := `Get "http://10.0.0.2:8080/u/3f9a.../chunk": EOF`
+	if n := testutil.ToFloat64(ErrorsTotal.WithLabelValues(redacted, "upload")); n != 1 {
+		t.Errorf("errors with redacted label = %v, want 1", n)
+	}
+	if n := testutil.ToFloat64(RetryAttemptsTotal.WithLabelValues("upload", redacted)); n != 1 {
+		t.Errorf("retries with redacted label = %v, want 1", n)
+	}
+}
+
+func TestObserveTransferExemplar(t *testing.T) {
+	ObserveTransfer(UploadDuration.WithLabelValues(".exemplar"), 0.3, "a1b2c3d4-0")
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(UploadDuration)
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set("Accept", "application/openmetrics-text")
+	rec := httptest.NewRecorder()
+	promhttp.HandlerFor(reg, promhttp.HandlerOpts{EnableOpenMetrics: true}).ServeHTTP(rec, req)
+	body, _ := io.ReadAll(rec.Body)
+
+	for _, line := range strings.Split(string(body), "\n") {
+		if strings.Contains(line, `file_ext=".exemplar"`) && strings.Contains(line, `# {transfer_id="a1b2c3d4-0"} 0.3`) {
+			return
+		}
+	}
+	t.Errorf("no transfer_id exemplar in:\n%s", body)
+}
@@ -3,6 +3,8 @@ package metrics
 import (
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/zulfikawr/warp/internal/logging"
 )
 
 // Session Metrics
@@ -35,6 +37,25 @@ var (
 		[]string{"operation", "reason"},
 	)
 
+	// PAKESessionsPending is the number of PAKE handshakes between init and
+	// verify. It stays near zero; a climb means clients open handshakes they
+	// never finish.
+	PAKESessionsPending = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "warp_pake_sessions_pending",
+			Help: "PAKE handshakes waiting for their verify step",
+		},
+	)
+
+	// PAKESessionsExpired counts PAKE handshakes dropped because their
+	// client didn't verify within the session TTL.
+	PAKESessionsExpired = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "warp_pake_sessions_expired_total",
+			Help: "PAKE handshakes dropped unverified after their TTL",
+		},
+	)
+
 	// ErrorsTotal counts errors by type and operation.
 	// Labels: type (network, validation, permission, disk), operation (upload, download)
 	// Use this to identify common error patterns and debugging priorities.
@@ -59,12 +80,26 @@ func RecordDownloadSession(durationSeconds float64) {
 	SessionDuration.WithLabelValues("download").Observe(durationSeconds)
 }
 
-// RecordRetry records a retry attempt.
+// RecordRetry records a retry attempt. The reason may be an error string,
+// so share tokens are shortened before it becomes a label.
 func RecordRetry(operation, reason string) {
-	RetryAttemptsTotal.WithLabelValues(operation, reason).Inc()
+	RetryAttemptsTotal.WithLabelValues(operation, logging.Redact(reason)).Inc()
 }
 
-// RecordError records an error by type and operation.
+// RecordError records an error by type and operation, with share tokens
+// shortened like RecordRetry.
 func RecordError(errorType, operation string) {
-	ErrorsTotal.WithLabelValues(errorType, operation).Inc()
+	ErrorsTotal.WithLabelValues(logging.Redact(errorType), operation).Inc()
+}
+
+// ObserveTransfer records v on o with the transfer's ID as its exemplar, so
+// an OpenMetrics scrape links the bucket to the transfer's log lines. /metrics
+// is not token-guarded: pass only the random per-request ID, never an upload
+// session ID, which lets its holder add to the upload.
+func ObserveTransfer(o prometheus.Observer, v float64, transferID string) {
+	if eo, ok := o.(prometheus.ExemplarObserver); ok && transferID != "" {
+		eo.ObserveWithExemplar(v, prometheus.Labels{"transfer_id": transferID})
+		return
+	}
+	o.Observe(v)
 }
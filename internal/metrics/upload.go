@@ -67,4 +67,36 @@ var (
 			Help: "Number of active uploads",
 		},
 	)
+
+	// ReservedUploadBytes tracks disk space promised to uploads in progress.
+	// Use this to see how close concurrent uploads are to filling the disk.
+	ReservedUploadBytes = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "warp_upload_reserved_bytes",
+			Help: "Disk space reserved by uploads in progress in bytes",
+		},
+	)
+
+	// UploadSyncDuration tracks time spent in fsync for received uploads.
+	// Labels: policy (file, chunk), target (file, chunk, dir)
+	// Use this to measure the throughput cost of --sync-policy.
+	UploadSyncDuration = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "warp_upload_fsync_duration_seconds",
+			Help:    "Time spent flushing uploads to disk in seconds",
+			Buckets: prometheus.ExponentialBuckets(0.0001, 4, 10), // 0.1ms to ~26s
+		},
+		[]string{"policy", "target"},
+	)
+
+	// UploadScans counts runs of the --scan-cmd hook on finished uploads.
+	// Labels: result (clean, rejected, timeout, error)
+	// Use this to see how often uploads are quarantined and scanners stall.
+	UploadScans = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "warp_upload_scans_total",
+			Help: "Total number of upload scans by result",
+		},
+		[]string{"result"},
+	)
 )
@@ -0,0 +1,15 @@
+//go:build linux
+
+package naming
+
+import "syscall"
+
+// Max returns the longest file name in bytes the filesystem at dir accepts,
+// capped at MaxBytes
+func Max(dir string) int {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(dir, &stat); err != nil || stat.Namelen <= 0 {
+		return MaxBytes
+	}
+	return int(min(stat.Namelen, MaxBytes))
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package naming
+
+// Max assumes the common limit on non-Linux platforms
+func Max(_ string) int {
+	return MaxBytes
+}
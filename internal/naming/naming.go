@@ -0,0 +1,98 @@
+// Package naming picks file names that don't clobber what is already on
+// disk. The host uses it for uploads and the receiver for downloads, so a
+// name that is taken gets the same " (1)", " (2)" suffix on both sides.
+package naming
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// MaxBytes is the longest name most filesystems accept
+const MaxBytes = 255
+
+// maxAttempts is how many numbered names Unique tries before falling back
+// to a timestamp
+const maxAttempts = 1000
+
+// Unique returns the path of name in dir, or of "name (n).ext" with the
+// smallest n that is free when name is taken. A name that is itself
+// numbered carries on from its number. The name is shortened to fit
+// the filesystem first, keeping its extension; the suffix is fitted in by
+// shortening the base further.
+func Unique(dir, name string) string {
+	limit := Max(dir)
+	name = Fit(name, limit)
+	p := filepath.Join(dir, name)
+	if free(p) {
+		return p
+	}
+	ext := filepath.Ext(name)
+	base, first := numbered(strings.TrimSuffix(name, ext))
+	for i := first; i < first+maxAttempts; i++ {
+		suffix := fmt.Sprintf(" (%d)", i)
+		p = filepath.Join(dir, TruncateUTF8(base, limit-len(suffix)-len(ext))+suffix+ext)
+		if free(p) {
+			return p
+		}
+	}
+	suffix := fmt.Sprintf("_%d", time.Now().UnixNano())
+	return filepath.Join(dir, TruncateUTF8(base, limit-len(suffix)-len(ext))+suffix+ext)
+}
+
+// numbered splits a base that already ends in " (n)" into the plain base and
+// n+1, so a taken "report (1)" goes on to "report (2)" rather than
+// "report (1) (1)". Other bases count from 1.
+func numbered(base string) (string, int) {
+	open := strings.LastIndex(base, " (")
+	if open <= 0 || !strings.HasSuffix(base, ")") {
+		return base, 1
+	}
+	n, err := strconv.Atoi(base[open+2 : len(base)-1])
+	if err != nil || n < 1 || strconv.Itoa(n) != base[open+2:len(base)-1] {
+		return base, 1
+	}
+	return base[:open], n + 1
+}
+
+// free reports whether nothing, not even a dangling symlink, is at p
+func free(p string) bool {
+	_, err := os.Lstat(p)
+	return os.IsNotExist(err)
+}
+
+// Fit shortens name to at most limit bytes, cutting the base on a rune
+// boundary so the extension survives. An extension longer than half the
+// limit is treated as part of the base.
+func Fit(name string, limit int) string {
+	if len(name) <= limit {
+		return name
+	}
+	ext := filepath.Ext(name)
+	if len(ext) > limit/2 {
+		ext = ""
+	}
+	base := TruncateUTF8(strings.TrimSuffix(name, ext), limit-len(ext))
+	// A cut that ends in a dot would run into the extension as ".."
+	return strings.TrimRight(base, ".") + ext
+}
+
+// TruncateUTF8 returns the longest prefix of s that fits in n bytes without
+// splitting a rune
+func TruncateUTF8(s string, n int) string {
+	if n <= 0 {
+		return ""
+	}
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
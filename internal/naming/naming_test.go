@@ -0,0 +1,69 @@
+package naming
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestUnique(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"report.pdf", "report (1).pdf", "notes", "v (x).txt", "dangling"} {
+		p := filepath.Join(dir, name)
+		if name == "dangling" {
+			if err := os.Symlink("missing", p); err != nil {
+				t.Skipf("symlinks unavailable: %v", err)
+			}
+			continue
+		}
+		if err := os.WriteFile(p, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct{ name, want string }{
+		{"new.pdf", "new.pdf"},
+		{"report.pdf", "report (2).pdf"},
+		{"report (1).pdf", "report (2).pdf"},
+		{"report (7).pdf", "report (7).pdf"},
+		{"notes", "notes (1)"},
+		{"v (x).txt", "v (x) (1).txt"},
+		{"dangling", "dangling (1)"},
+	}
+	for _, tt := range tests {
+		if got := filepath.Base(Unique(dir, tt.name)); got != tt.want {
+			t.Errorf("Unique(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestUniqueFitsSuffix(t *testing.T) {
+	dir := t.TempDir()
+	name := strings.Repeat("é", 200) + ".txt"
+	first := Unique(dir, name)
+	if len(filepath.Base(first)) > MaxBytes {
+		t.Fatalf("name is %d bytes", len(filepath.Base(first)))
+	}
+	if err := os.WriteFile(first, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	second := filepath.Base(Unique(dir, name))
+	if len(second) > MaxBytes || !strings.HasSuffix(second, " (1).txt") {
+		t.Errorf("second name %q (%d bytes)", second, len(second))
+	}
+}
+
+func TestFit(t *testing.T) {
+	if got := Fit("short.txt", 20); got != "short.txt" {
+		t.Errorf("Fit kept %q", got)
+	}
+	if got := Fit("abcdefghij.txt", 10); got != "abcdef.txt" {
+		t.Errorf("Fit = %q, want abcdef.txt", got)
+	}
+	if got := Fit("ab."+strings.Repeat("x", 10), 8); got != "ab.xxxxx" {
+		t.Errorf("long extension: Fit = %q", got)
+	}
+	if got := TruncateUTF8("héllo", 2); got != "h" {
+		t.Errorf("TruncateUTF8 split a rune: %q", got)
+	}
+}
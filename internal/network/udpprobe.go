@@ -0,0 +1,169 @@
+package network
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"slices"
+	"time"
+)
+
+// UDPProbeSizes are the datagram sizes CheckUDPPath sends: QUIC's minimum, a
+// size that fits under most tunnels, and the most a 1500-byte Ethernet MTU
+// carries over IPv4
+var UDPProbeSizes = []int{1200, 1400, 1472}
+
+// DefaultUDPProbeTimeout bounds CheckUDPPath when ctx has no deadline
+const DefaultUDPProbeTimeout = 500 * time.Millisecond
+
+// udpProbeCopies is how often each size is sent, so one lost datagram isn't
+// taken for a path that drops that size
+const udpProbeCopies = 2
+
+// probeVersion is a reserved QUIC version (RFC 9000, section 15). Servers
+// answer it with a Version Negotiation packet, but only for datagrams of at
+// least 1200 bytes, which is what makes it a size probe.
+const probeVersion = 0x1a2a3a4a
+
+// PathVerdict is what CheckUDPPath learned about a UDP path
+type PathVerdict int
+
+const (
+	PathNoReply    PathVerdict = iota // Nothing came back: UDP blocked, or no QUIC listener
+	PathOK                            // Probes of every size got through
+	PathFragmented                    // Small probes got through but the largest were lost
+)
+
+func (v PathVerdict) String() string {
+	switch v {
+	case PathOK:
+		return "ok"
+	case PathFragmented:
+		return "fragmented"
+	}
+	return "no reply"
+}
+
+// PathResult is the outcome of CheckUDPPath
+type PathResult struct {
+	Verdict PathVerdict
+	Largest int   // Largest probe size answered; 0 when none was
+	Lost    []int // Probe sizes that went unanswered
+}
+
+// CheckUDPPath sends QUIC probes of each size to the QUIC listener at addr
+// and reports which sizes came back. It waits until every size is answered
+// or ctx ends, DefaultUDPProbeTimeout when ctx has no deadline. Losing the
+// large probes while the small ones are answered is the sign of a path whose
+// MTU is too small for full-size QUIC packets, such as PPPoE or a VPN.
+func CheckUDPPath(ctx context.Context, conn net.PacketConn, addr net.Addr, sizes []int) (PathResult, error) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(DefaultUDPProbeTimeout)
+	}
+	if err := conn.SetReadDeadline(deadline); err != nil {
+		return PathResult{}, fmt.Errorf("set read deadline: %w", err)
+	}
+	// Wake a blocked read when ctx is cancelled early
+	stop := context.AfterFunc(ctx, func() { _ = conn.SetReadDeadline(time.Now()) })
+	defer stop()
+
+	// One connection ID per size; the server echoes it back
+	pending := make(map[uint64]int, len(sizes))
+	for _, size := range sizes {
+		id, packet, err := probePacket(size)
+		if err != nil {
+			return PathResult{}, err
+		}
+		pending[id] = size
+		for range udpProbeCopies {
+			if _, err := conn.WriteTo(packet, addr); err != nil {
+				return PathResult{}, fmt.Errorf("send %d-byte probe: %w", size, err)
+			}
+		}
+	}
+
+	answered := make(map[int]bool, len(sizes))
+	buf := make([]byte, 1500)
+	for len(answered) < len(sizes) {
+		n, from, err := conn.ReadFrom(buf)
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			break
+		}
+		if err != nil {
+			return PathResult{}, fmt.Errorf("read probe reply: %w", err)
+		}
+		if !sameAddr(from, addr) {
+			continue
+		}
+		if id, ok := versionNegotiationID(buf[:n]); ok {
+			if size, ok := pending[id]; ok {
+				answered[size] = true
+			}
+		}
+	}
+	return pathResult(sizes, answered), nil
+}
+
+// sameAddr compares UDP addresses by value, so an IPv4-mapped IPv6 source
+// still matches the IPv4 address it was sent to
+func sameAddr(a, b net.Addr) bool {
+	ua, okA := a.(*net.UDPAddr)
+	ub, okB := b.(*net.UDPAddr)
+	if okA && okB {
+		return ua.IP.Equal(ub.IP) && ua.Port == ub.Port
+	}
+	return a.String() == b.String()
+}
+
+// pathResult judges a path from the probe sizes that were answered
+func pathResult(sizes []int, answered map[int]bool) PathResult {
+	var res PathResult
+	for _, size := range sizes {
+		if answered[size] {
+			res.Largest = max(res.Largest, size)
+		} else {
+			res.Lost = append(res.Lost, size)
+		}
+	}
+	switch {
+	case res.Largest == 0:
+		res.Verdict = PathNoReply
+	case len(res.Lost) > 0 && answered[slices.Min(sizes)] && !answered[slices.Max(sizes)]:
+		res.Verdict = PathFragmented
+	default:
+		// Every size, or a scattering that looks like ordinary loss
+		res.Verdict = PathOK
+	}
+	return res
+}
+
+// probePacket builds a size-byte QUIC long header packet with probeVersion.
+// id is its 8-byte source connection ID, which the answer carries as its
+// destination.
+func probePacket(size int) (id uint64, packet []byte, err error) {
+	packet = make([]byte, size)
+	if _, err := rand.Read(packet[6:14]); err != nil {
+		return 0, nil, fmt.Errorf("generate probe: %w", err)
+	}
+	packet[0] = 0xc0 // Long header, QUIC bit
+	binary.BigEndian.PutUint32(packet[1:5], probeVersion)
+	packet[5] = 8 // Destination connection ID, random
+	packet[14] = 8
+	id = binary.BigEndian.Uint64(packet[6:14]) ^ uint64(size)
+	binary.BigEndian.PutUint64(packet[15:23], id)
+	return id, packet, nil
+}
+
+// versionNegotiationID returns the destination connection ID of a QUIC
+// Version Negotiation packet, which is the ID of the probe it answers
+func versionNegotiationID(b []byte) (uint64, bool) {
+	if len(b) < 14 || b[0]&0x80 == 0 || binary.BigEndian.Uint32(b[1:5]) != 0 || b[5] != 8 {
+		return 0, false
+	}
+	return binary.BigEndian.Uint64(b[6:14]), true
+}
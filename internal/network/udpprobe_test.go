@@ -0,0 +1,167 @@
+package network
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"math/big"
+	"net"
+	"os"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go"
+)
+
+// fakePathConn stands in for a UDP socket on a path that drops datagrams
+// larger than mtu. It answers every probe that fits the way a QUIC server
+// does, with a Version Negotiation packet.
+type fakePathConn struct {
+	net.PacketConn // Unused methods panic
+	peer           net.Addr
+	mtu            int
+	replies        chan []byte
+
+	mu       sync.Mutex
+	deadline time.Time
+}
+
+func newFakePathConn(mtu int) *fakePathConn {
+	return &fakePathConn{
+		peer:    &net.UDPAddr{IP: net.IPv4(192, 168, 1, 7), Port: 52314},
+		mtu:     mtu,
+		replies: make(chan []byte, 16),
+	}
+}
+
+func (c *fakePathConn) WriteTo(b []byte, _ net.Addr) (int, error) {
+	if len(b) <= c.mtu {
+		// Swap the connection IDs, as a Version Negotiation packet does
+		reply := []byte{0xc0, 0, 0, 0, 0, 8}
+		reply = append(reply, b[15:23]...)
+		reply = append(reply, 8)
+		reply = append(reply, b[6:14]...)
+		c.replies <- append(reply, 0, 0, 0, 1)
+	}
+	return len(b), nil
+}
+
+func (c *fakePathConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	for {
+		c.mu.Lock()
+		deadline := c.deadline
+		c.mu.Unlock()
+		if !time.Now().Before(deadline) {
+			return 0, nil, os.ErrDeadlineExceeded
+		}
+		select {
+		case reply := <-c.replies:
+			return copy(b, reply), c.peer, nil
+		case <-time.After(5 * time.Millisecond):
+		}
+	}
+}
+
+func (c *fakePathConn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.deadline = t
+	return nil
+}
+
+func TestCheckUDPPath(t *testing.T) {
+	tests := []struct {
+		name    string
+		mtu     int
+		verdict PathVerdict
+		largest int
+		lost    []int
+	}{
+		{"ethernet", 1500, PathOK, 1472, nil},
+		{"pppoe", 1464, PathFragmented, 1400, []int{1472}},
+		{"vpn", 1380, PathFragmented, 1200, []int{1400, 1472}},
+		{"udp blocked", 0, PathNoReply, 0, []int{1200, 1400, 1472}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := newFakePathConn(tt.mtu)
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+			res, err := CheckUDPPath(ctx, conn, conn.peer, UDPProbeSizes)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.Verdict != tt.verdict || res.Largest != tt.largest || !slices.Equal(res.Lost, tt.lost) {
+				t.Errorf("got %s, largest %d, lost %v; want %s, largest %d, lost %v",
+					res.Verdict, res.Largest, res.Lost, tt.verdict, tt.largest, tt.lost)
+			}
+		})
+	}
+}
+
+func TestCheckUDPPathReturnsOnceAnswered(t *testing.T) {
+	conn := newFakePathConn(1500)
+	start := time.Now()
+	if _, err := CheckUDPPath(context.Background(), conn, conn.peer, UDPProbeSizes); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed >= DefaultUDPProbeTimeout {
+		t.Errorf("took %s with every probe answered", elapsed)
+	}
+}
+
+func TestPathResultScatteredLoss(t *testing.T) {
+	// The largest size arriving means the path carries it; the gap is plain loss
+	res := pathResult(UDPProbeSizes, map[int]bool{1200: true, 1472: true})
+	if res.Verdict != PathOK {
+		t.Errorf("got %s, want ok", res.Verdict)
+	}
+}
+
+// TestCheckUDPPathQUICListener probes a real QUIC listener over loopback,
+// whose MTU carries every size
+func TestCheckUDPPathQUICListener(t *testing.T) {
+	ln, err := quic.ListenAddr("127.0.0.1:0", testTLSConfig(t), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = ln.Close() }()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	res, err := CheckUDPPath(ctx, conn, ln.Addr(), UDPProbeSizes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Verdict != PathOK || res.Largest != 1472 {
+		t.Errorf("got %+v, want every size answered", res)
+	}
+}
+
+func testTLSConfig(t *testing.T) *tls.Config {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{SerialNumber: big.NewInt(1), NotAfter: time.Now().Add(time.Hour)}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}},
+		NextProtos:   []string{"h3"},
+	}
+}
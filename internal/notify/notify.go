@@ -0,0 +1,126 @@
+// Package notify shows desktop notifications when a transfer finishes.
+package notify
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/zulfikawr/warp/internal/logging"
+	"github.com/zulfikawr/warp/internal/ui"
+	"go.uber.org/zap"
+)
+
+// Timeout bounds each notification command, so a hung notification daemon
+// never holds up warp
+const Timeout = 2 * time.Second
+
+// appName is shown as the notification's source where the platform has one
+const appName = "warp"
+
+// Runner runs a command to completion; tests replace it
+type Runner func(ctx context.Context, name string, args ...string) error
+
+// Notifier shows desktop notifications with the platform's own tool:
+// notify-send on Linux, osascript on macOS and a PowerShell toast on Windows.
+// On other platforms, or when the tool is missing, it does nothing. Errors are
+// only logged, so a notification can never fail a transfer.
+type Notifier struct {
+	GOOS string // Platform whose command is built; runtime.GOOS when empty
+	Run  Runner // Runs the command; exec with Timeout when nil
+}
+
+// New returns a Notifier for the current platform
+func New() *Notifier {
+	return &Notifier{}
+}
+
+// Completed announces a finished transfer with its size and duration
+func (n *Notifier) Completed(name string, size int64, elapsed time.Duration) {
+	n.send("Transfer complete", fmt.Sprintf("%s (%s) in %s", name, ui.FormatBytes(size), ui.FormatDuration(elapsed)))
+}
+
+// Failed announces a transfer that ended with err
+func (n *Notifier) Failed(name string, err error) {
+	body := name
+	if err != nil {
+		body = fmt.Sprintf("%s: %v", name, err)
+	}
+	n.send("Transfer failed", body)
+}
+
+// send shows a notification. Share tokens in body, from a URL or an error
+// quoting one, are shortened: notifications can show on a locked screen.
+func (n *Notifier) send(title, body string) {
+	if n == nil {
+		return
+	}
+	body = logging.Redact(body)
+	goos := n.GOOS
+	if goos == "" {
+		goos = runtime.GOOS
+	}
+	name, args, ok := Command(goos, title, body)
+	if !ok {
+		return
+	}
+	run := n.Run
+	if run == nil {
+		run = execRun
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	defer cancel()
+	if err := run(ctx, name, args...); err != nil {
+		logging.Debug("Desktop notification failed", zap.String("command", name), zap.Error(err))
+	}
+}
+
+// Command returns the command that shows a notification on goos, or false
+// when warp has no way to notify there
+func Command(goos, title, body string) (name string, args []string, ok bool) {
+	switch goos {
+	case "linux", "freebsd", "openbsd", "netbsd":
+		// "--" keeps a file name starting with "-" from being read as an option
+		return "notify-send", []string{"--app-name=" + appName, "--", title, body}, true
+	case "darwin":
+		script := fmt.Sprintf("display notification %s with title %s", appleScriptString(body), appleScriptString(title))
+		return "osascript", []string{"-e", script}, true
+	case "windows":
+		return "powershell", []string{"-NoProfile", "-NonInteractive", "-Command", toastScript(title, body)}, true
+	}
+	return "", nil, false
+}
+
+// appleScriptString quotes s as an AppleScript string literal
+func appleScriptString(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// powerShellString quotes s as a PowerShell single-quoted string, in which
+// nothing is expanded
+func powerShellString(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// toastScript shows a two-line toast through the WinRT notification API
+func toastScript(title, body string) string {
+	return strings.Join([]string{
+		"[Windows.UI.Notifications.ToastNotificationManager, Windows.UI.Notifications, ContentType = WindowsRuntime] > $null",
+		"$xml = [Windows.UI.Notifications.ToastNotificationManager]::GetTemplateContent([Windows.UI.Notifications.ToastTemplateType]::ToastText02)",
+		"$text = $xml.GetElementsByTagName('text')",
+		"$text.Item(0).AppendChild($xml.CreateTextNode(" + powerShellString(title) + ")) > $null",
+		"$text.Item(1).AppendChild($xml.CreateTextNode(" + powerShellString(body) + ")) > $null",
+		"[Windows.UI.Notifications.ToastNotificationManager]::CreateToastNotifier(" + powerShellString(appName) + ").Show([Windows.UI.Notifications.ToastNotification]::new($xml))",
+	}, "; ")
+}
+
+// execRun runs the command, treating a missing tool as nothing to do
+func execRun(ctx context.Context, name string, args ...string) error {
+	if _, err := exec.LookPath(name); err != nil {
+		return nil
+	}
+	return exec.CommandContext(ctx, name, args...).Run()
+}
@@ -0,0 +1,96 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type call struct {
+	name string
+	args []string
+}
+
+// recorder returns a Runner that records each command and fails with err
+func recorder(calls *[]call, err error) Runner {
+	return func(ctx context.Context, name string, args ...string) error {
+		if _, ok := ctx.Deadline(); !ok {
+			return errors.New("command run without a timeout")
+		}
+		*calls = append(*calls, call{name, args})
+		return err
+	}
+}
+
+func TestCompletedCommands(t *testing.T) {
+	const body = "report.pdf (1.5 MiB) in 1m05s"
+	tests := []struct {
+		goos string
+		want call
+	}{
+		{"linux", call{"notify-send", []string{"--app-name=warp", "--", "Transfer complete", body}}},
+		{"darwin", call{"osascript", []string{"-e", `display notification "` + body + `" with title "Transfer complete"`}}},
+		{"windows", call{"powershell", []string{"-NoProfile", "-NonInteractive", "-Command", toastScript("Transfer complete", body)}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.goos, func(t *testing.T) {
+			var calls []call
+			n := &Notifier{GOOS: tt.goos, Run: recorder(&calls, nil)}
+			n.Completed("report.pdf", 1536<<10, 65*time.Second)
+			if len(calls) != 1 || !reflect.DeepEqual(calls[0], tt.want) {
+				t.Fatalf("commands = %q, want %q", calls, tt.want)
+			}
+		})
+	}
+}
+
+func TestWindowsToastQuoting(t *testing.T) {
+	script := toastScript("Transfer failed", "it's done")
+	if !strings.Contains(script, "CreateTextNode('it''s done')") || !strings.Contains(script, "CreateToastNotifier('warp')") {
+		t.Errorf("unexpected script: %s", script)
+	}
+}
+
+func TestMacOSQuoting(t *testing.T) {
+	var calls []call
+	n := &Notifier{GOOS: "darwin", Run: recorder(&calls, nil)}
+	n.Failed(`say "hi".txt`, errors.New(`bad \ path`))
+	want := `display notification "say \"hi\".txt: bad \\ path" with title "Transfer failed"`
+	if len(calls) != 1 || calls[0].args[1] != want {
+		t.Fatalf("commands = %q, want script %q", calls, want)
+	}
+}
+
+func TestUnsupportedPlatformIsNoop(t *testing.T) {
+	var calls []call
+	n := &Notifier{GOOS: "plan9", Run: recorder(&calls, nil)}
+	n.Completed("a.txt", 1, time.Second)
+	if len(calls) != 0 {
+		t.Errorf("ran %q on a platform without notifications", calls)
+	}
+	// A nil Notifier is what callers hold without --notify
+	var off *Notifier
+	off.Failed("a.txt", errors.New("boom"))
+}
+
+func TestRunnerErrorIsIgnored(t *testing.T) {
+	var calls []call
+	n := &Notifier{GOOS: "linux", Run: recorder(&calls, errors.New("no notification daemon"))}
+	n.Failed("a.txt", errors.New("connection reset"))
+	if len(calls) != 1 || calls[0].args[3] != "a.txt: connection reset" {
+		t.Errorf("commands = %q", calls)
+	}
+}
+
+func TestFailedRedactsToken(t *testing.T) {
+	const token = "3f9a1c2b4d5e6f708192a3b4c5d6e7f8"
+	var calls []call
+	n := &Notifier{GOOS: "linux", Run: recorder(&calls, nil)}
+	n.Failed("http://10.0.0.2:8080/d/"+token, errors.New("connection reset"))
+	if len(calls) != 1 || strings.Contains(calls[0].args[3], token) {
+		t.Errorf("commands = %q, want the token shortened", calls)
+	}
+}
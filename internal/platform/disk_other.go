@@ -0,0 +1,9 @@
+//go:build !linux && !darwin && !windows
+
+package platform
+
+const hasDiskFree = false
+
+func diskFree(_ string) (int64, error) {
+	return 0, unsupported("disk free space")
+}
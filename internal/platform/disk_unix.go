@@ -0,0 +1,15 @@
+//go:build linux || darwin
+
+package platform
+
+import "golang.org/x/sys/unix"
+
+const hasDiskFree = true
+
+func diskFree(path string) (int64, error) {
+	var stat unix.Statfs_t
+	if err := unix.Statfs(path, &stat); err != nil {
+		return 0, err
+	}
+	return int64(stat.Bavail) * int64(stat.Bsize), nil
+}
@@ -0,0 +1,20 @@
+//go:build windows
+
+package platform
+
+import "golang.org/x/sys/windows"
+
+const hasDiskFree = true
+
+func diskFree(path string) (int64, error) {
+	p, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, err
+	}
+	// The first count honours per-user quotas, like Bavail does on Unix
+	var avail uint64
+	if err := windows.GetDiskFreeSpaceEx(p, &avail, nil, nil); err != nil {
+		return 0, err
+	}
+	return int64(avail), nil
+}
@@ -0,0 +1,54 @@
+//go:build linux
+
+package platform
+
+import (
+	"errors"
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	hasSendfile  = true
+	hasFallocate = true
+	hasIonice    = true
+)
+
+func sendfile(socket uintptr, f *os.File, offset *int64, n int) (int, error) {
+	return syscall.Sendfile(int(socket), int(f.Fd()), offset, n)
+}
+
+func fallocate(f *os.File, size int64) error {
+	rc, err := f.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var ferr error
+	if err := rc.Control(func(fd uintptr) {
+		ferr = syscall.Fallocate(int(fd), 0, 0, size)
+	}); err != nil {
+		return err
+	}
+	if errors.Is(ferr, syscall.EOPNOTSUPP) {
+		return unsupported("fallocate on this filesystem")
+	}
+	return ferr
+}
+
+// The ioprio_set(2) arguments for the whole calling process and the idle
+// class, which has no levels
+const (
+	ioprioWhoProcess = 1
+	ioprioClassIdle  = 3
+	ioprioClassShift = 13
+)
+
+func lowerIOPriority() error {
+	_, _, errno := unix.Syscall(unix.SYS_IOPRIO_SET, ioprioWhoProcess, 0, ioprioClassIdle<<ioprioClassShift)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,25 @@
+//go:build !linux
+
+package platform
+
+import "os"
+
+// Only Linux has the sendfile(2) semantics warp relies on, fallocate(2) and
+// ioprio_set(2)
+const (
+	hasSendfile  = false
+	hasFallocate = false
+	hasIonice    = false
+)
+
+func sendfile(_ uintptr, _ *os.File, _ *int64, _ int) (int, error) {
+	return 0, unsupported("sendfile")
+}
+
+func fallocate(_ *os.File, _ int64) error {
+	return unsupported("fallocate")
+}
+
+func lowerIOPriority() error {
+	return unsupported("ionice")
+}
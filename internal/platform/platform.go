@@ -0,0 +1,79 @@
+// Package platform wraps the system calls warp uses that not every OS has:
+// zero-copy sendfile, block allocation, I/O priority and free disk space.
+// Each has a build-tagged implementation per OS; Current says which of them
+// this build has, and its methods return an error matching
+// errors.ErrUnsupported for the rest instead of failing to compile or
+// panicking, so callers fall back to the portable way.
+package platform
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+)
+
+// Capabilities are the platform features available to a build
+type Capabilities struct {
+	// HasSendfile means Sendfile copies a file to a socket in the kernel
+	HasSendfile bool
+	// HasFallocate means Fallocate reserves a file's blocks rather than
+	// leaving it sparse
+	HasFallocate bool
+	// HasIonice means LowerIOPriority can put the process in the idle I/O
+	// class
+	HasIonice bool
+	// HasDiskFree means DiskFree can tell the free space of a filesystem
+	HasDiskFree bool
+}
+
+// Current is what the OS this binary was built for supports
+var Current = Capabilities{
+	HasSendfile:  hasSendfile,
+	HasFallocate: hasFallocate,
+	HasIonice:    hasIonice,
+	HasDiskFree:  hasDiskFree,
+}
+
+// unsupported is the error for a call c doesn't have
+func unsupported(call string) error {
+	return fmt.Errorf("%s: %w on %s", call, errors.ErrUnsupported, runtime.GOOS)
+}
+
+// Sendfile copies up to n bytes of f from *offset to the socket with file
+// descriptor socket, advancing *offset, and returns how many it sent. A
+// non-blocking socket that is full gives syscall.EAGAIN.
+func (c Capabilities) Sendfile(socket uintptr, f *os.File, offset *int64, n int) (int, error) {
+	if !c.HasSendfile {
+		return 0, unsupported("sendfile")
+	}
+	return sendfile(socket, f, offset, n)
+}
+
+// Fallocate reserves the blocks of f's first size bytes, extending it to
+// size. A filesystem that can't allocate ahead is unsupported too, so the
+// caller can truncate instead.
+func (c Capabilities) Fallocate(f *os.File, size int64) error {
+	if !c.HasFallocate {
+		return unsupported("fallocate")
+	}
+	return fallocate(f, size)
+}
+
+// LowerIOPriority moves the process to the idle I/O class, like
+// "ionice -c 3", so its disk reads and writes yield to everything else
+func (c Capabilities) LowerIOPriority() error {
+	if !c.HasIonice {
+		return unsupported("ionice")
+	}
+	return lowerIOPriority()
+}
+
+// DiskFree returns the bytes available to unprivileged users on the
+// filesystem holding path
+func (c Capabilities) DiskFree(path string) (int64, error) {
+	if !c.HasDiskFree {
+		return 0, unsupported("disk free space")
+	}
+	return diskFree(path)
+}
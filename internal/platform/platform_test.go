@@ -0,0 +1,95 @@
+package platform
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestUnsupportedCalls(t *testing.T) {
+	// The zero value is a platform with none of the features, whatever this
+	// one has, so every call must take the unsupported path
+	var none Capabilities
+	f, err := os.Create(filepath.Join(t.TempDir(), "data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = f.Close() }()
+
+	offset := int64(0)
+	if n, err := none.Sendfile(0, f, &offset, 10); n != 0 || !errors.Is(err, errors.ErrUnsupported) {
+		t.Errorf("Sendfile = %d, %v", n, err)
+	}
+	if err := none.Fallocate(f, 1<<20); !errors.Is(err, errors.ErrUnsupported) {
+		t.Errorf("Fallocate = %v", err)
+	}
+	if fi, _ := f.Stat(); fi.Size() != 0 {
+		t.Errorf("unsupported Fallocate changed the file to %d bytes", fi.Size())
+	}
+	if err := none.LowerIOPriority(); !errors.Is(err, errors.ErrUnsupported) {
+		t.Errorf("LowerIOPriority = %v", err)
+	}
+	if free, err := none.DiskFree(t.TempDir()); free != 0 || !errors.Is(err, errors.ErrUnsupported) {
+		t.Errorf("DiskFree = %d, %v", free, err)
+	}
+}
+
+func TestDiskFree(t *testing.T) {
+	if !Current.HasDiskFree {
+		t.Skipf("no free space on %s", runtime.GOOS)
+	}
+	free, err := Current.DiskFree(t.TempDir())
+	if err != nil || free <= 0 {
+		t.Errorf("DiskFree = %d, %v", free, err)
+	}
+	if _, err := Current.DiskFree(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("DiskFree of a missing path succeeded")
+	}
+}
+
+func TestFallocate(t *testing.T) {
+	if !Current.HasFallocate {
+		t.Skipf("no fallocate on %s", runtime.GOOS)
+	}
+	f, err := os.Create(filepath.Join(t.TempDir(), "data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = f.Close() }()
+	err = Current.Fallocate(f, 1<<20)
+	if errors.Is(err, errors.ErrUnsupported) {
+		t.Skip("the temp directory's filesystem can't allocate ahead")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi, _ := f.Stat(); fi.Size() != 1<<20 {
+		t.Errorf("size = %d, want 1 MiB", fi.Size())
+	}
+}
+
+// TestPlatformStubsCompile builds the whole module for the other platforms
+// warp ships for, so code that only compiles on the one running the tests
+// is caught here rather than at release
+func TestPlatformStubsCompile(t *testing.T) {
+	if testing.Short() {
+		t.Skip("cross-compiles the module")
+	}
+	goBin, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("no go toolchain")
+	}
+	for _, goos := range []string{"linux", "darwin", "windows", "freebsd"} {
+		t.Run(goos, func(t *testing.T) {
+			cmd := exec.Command(goBin, "build", "./...")
+			cmd.Dir = filepath.Join("..", "..")
+			cmd.Env = append(os.Environ(), "GOOS="+goos, "GOARCH=amd64", "CGO_ENABLED=0")
+			if out, err := cmd.CombinedOutput(); err != nil {
+				t.Errorf("GOOS=%s go build ./...: %v\n%s", goos, err, out)
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package protocol
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// FileAttrs are the file attributes preserved across a single-file transfer
+type FileAttrs struct {
+	ModTime time.Time   // Zero when not sent
+	Mode    os.FileMode // Permission bits only; zero when not sent
+}
+
+// SetFileAttrHeaders adds the mtime and mode of fi to h
+func SetFileAttrHeaders(h http.Header, fi os.FileInfo) {
+	h.Set(FileMtimeHeader, fi.ModTime().UTC().Format(time.RFC3339Nano))
+	h.Set(FileModeHeader, fmt.Sprintf("%04o", fi.Mode().Perm()))
+}
+
+// FileAttrsFromHeader parses the attribute headers in h. Missing or malformed
+// values are left zero so a bad header never fails the transfer.
+func FileAttrsFromHeader(h http.Header) FileAttrs {
+	var a FileAttrs
+	if v := h.Get(FileMtimeHeader); v != "" {
+		if t, err := time.Parse(time.RFC3339Nano, v); err == nil {
+			a.ModTime = t
+		}
+	}
+	if v := h.Get(FileModeHeader); v != "" {
+		if m, err := strconv.ParseUint(v, 8, 32); err == nil {
+			a.Mode = os.FileMode(m).Perm()
+		}
+	}
+	return a
+}
+
+// Apply sets the attributes on path. Only the permission bits of Mode are applied.
+func (a FileAttrs) Apply(path string) error {
+	if a.Mode != 0 {
+		if err := os.Chmod(path, a.Mode); err != nil {
+			return fmt.Errorf("failed to set mode: %w", err)
+		}
+	}
+	if !a.ModTime.IsZero() {
+		if err := os.Chtimes(path, time.Time{}, a.ModTime); err != nil {
+			return fmt.Errorf("failed to set modification time: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package protocol
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileAttrHeadersRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "f")
+	if err := os.WriteFile(path, []byte("x"), 0o640); err != nil {
+		t.Fatal(err)
+	}
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 123456789, time.UTC)
+	if err := os.Chtimes(path, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := http.Header{}
+	SetFileAttrHeaders(h, fi)
+	if got := h.Get(FileModeHeader); got != "0640" {
+		t.Errorf("%s = %q, want 0640", FileModeHeader, got)
+	}
+
+	a := FileAttrsFromHeader(h)
+	if !a.ModTime.Equal(fi.ModTime()) {
+		t.Errorf("ModTime = %v, want %v", a.ModTime, fi.ModTime())
+	}
+	if a.Mode != fi.Mode().Perm() {
+		t.Errorf("Mode = %v, want %v", a.Mode, fi.Mode().Perm())
+	}
+}
+
+func TestFileAttrsFromHeaderIgnoresBadValues(t *testing.T) {
+	h := http.Header{}
+	h.Set(FileMtimeHeader, "yesterday")
+	h.Set(FileModeHeader, "rwxr-xr-x")
+	a := FileAttrsFromHeader(h)
+	if !a.ModTime.IsZero() || a.Mode != 0 {
+		t.Fatalf("got %+v, want zero attrs", a)
+	}
+	// Setuid and other non-permission bits are dropped
+	h.Set(FileModeHeader, "4755")
+	if a := FileAttrsFromHeader(h); a.Mode != 0o755 {
+		t.Errorf("Mode = %04o, want 0755", a.Mode)
+	}
+}
@@ -0,0 +1,119 @@
+package protocol
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Capability feature names advertised by the manifest and info endpoints
+const (
+	FeatureParallelChunks   = "parallel_chunks"    // Chunks of one file may be sent concurrently
+	FeatureRawStream        = "raw_stream"         // Whole file as a raw request body (X-File-Name)
+	FeaturePerChunkChecksum = "per_chunk_checksum" // X-Chunk-Checksum is verified per chunk
+	FeatureVerify           = "verify"             // Full-file SHA256 check via /finalize
+	FeatureEncryption       = "encryption"         // Transfers are encrypted with the share password
+	FeatureResume           = "resume"             // Interrupted transfers continue from an offset
+	FeatureDedupe           = "dedupe"             // Identical content is stored only once
+	FeatureCompression      = "compression"        // Responses may use zstd or gzip
+	FeatureSessionStatus    = "session_status"     // Committed chunks of a parallel upload via /session/{id}
+	FeatureMirror           = "mirror"             // A directory share's files one by one via /ls and /file
+	FeatureFollow           = "follow"             // The file is streamed as it grows; no size, ranges or checksum
+	FeaturePlaylist         = "playlist"           // An M3U playlist of the share's audio and video at /playlist.m3u8
+	FeatureEncryptedChunks  = "encrypted_chunks"   // Parallel chunks may be sealed with crypto.SealChunk (X-Encryption: chunk-v1)
+)
+
+// Capabilities describes what a server supports. It is served at
+// /u/{token}/manifest for uploads and /d/{token}/info for downloads.
+type Capabilities struct {
+	Version       string   `json:"version"`
+	Mode          string   `json:"mode"`                 // "send" or "host"
+	ChunkSize     int64    `json:"chunk_size,omitempty"` // Recommended chunk size
+	MaxConcurrent int      `json:"max_concurrent"`       // Recommended parallel workers
+	Features      []string `json:"features"`
+	Limits        Limits   `json:"limits"`
+	FreeSpace     int64    `json:"free_space,omitempty"` // Bytes free in the upload directory; 0 = unknown
+	// RecentSpeed is the bytes per second of the host's recent uploads, for
+	// time estimates; 0 = no history
+	RecentSpeed int64 `json:"recent_speed,omitempty"`
+	// Share details, download side only
+	Name string `json:"name,omitempty"`
+	Size int64  `json:"size,omitempty"`
+	// SHA256 is the shared file's checksum in hex; single files only, as a
+	// directory's zip is only hashed while it streams
+	SHA256 string `json:"sha256,omitempty"`
+	// EstimatedSeconds is roughly how long the download would take at the
+	// speed of the sender's recent downloads; 0 = no history or no size
+	EstimatedSeconds int64 `json:"estimated_seconds,omitempty"`
+}
+
+// Limits are the server-enforced bounds on a transfer. Zero values mean no
+// limit. The Validate methods in validate.go check values against them.
+type Limits struct {
+	Version           int      `json:"version,omitempty"` // ValidationVersion of the host; 0 for hosts that predate it
+	MaxTotalSize      int64    `json:"max_upload_size,omitempty"`
+	MaxFileSize       int64    `json:"max_file_size,omitempty"`
+	AllowedExtensions []string `json:"allowed_extensions,omitempty"` // Lowercase, with leading dot
+	MaxConcurrent     int      `json:"max_concurrent,omitempty"`     // Simultaneous transfers
+	MaxChunks         int      `json:"max_chunks,omitempty"`         // Chunks in one parallel upload
+	MaxChunkSize      int64    `json:"max_chunk_size,omitempty"`
+	// An upload session with no chunk for this long is dropped, partial
+	// file and all. Sent as max_session_idle_seconds.
+	MaxSessionIdleTime time.Duration `json:"-"`
+}
+
+// limitsJSON is Limits on the wire
+type limitsJSON struct {
+	limitsAlias
+	MaxSessionIdleSeconds int64 `json:"max_session_idle_seconds,omitempty"`
+}
+
+// limitsAlias drops the methods of Limits, so encoding doesn't recurse
+type limitsAlias Limits
+
+func (l Limits) MarshalJSON() ([]byte, error) {
+	return json.Marshal(limitsJSON{limitsAlias(l), int64(l.MaxSessionIdleTime / time.Second)})
+}
+
+func (l *Limits) UnmarshalJSON(data []byte) error {
+	var v limitsJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*l = Limits(v.limitsAlias)
+	l.MaxSessionIdleTime = time.Duration(v.MaxSessionIdleSeconds) * time.Second
+	return nil
+}
+
+// Has reports whether the server advertises feature
+func (c *Capabilities) Has(feature string) bool {
+	return slices.Contains(c.Features, feature)
+}
+
+// ExtensionAllowed reports whether name's extension is in AllowedExtensions.
+// An empty list allows everything.
+func (l Limits) ExtensionAllowed(name string) bool {
+	if len(l.AllowedExtensions) == 0 {
+		return true
+	}
+	return slices.Contains(l.AllowedExtensions, strings.ToLower(filepath.Ext(name)))
+}
+
+// NormalizeExtensions lowercases exts and adds a leading dot where missing,
+// e.g. "JPG" -> ".jpg"
+func NormalizeExtensions(exts []string) []string {
+	var out []string
+	for _, e := range exts {
+		e = strings.ToLower(strings.TrimSpace(e))
+		if e == "" {
+			continue
+		}
+		if !strings.HasPrefix(e, ".") {
+			e = "." + e
+		}
+		out = append(out, e)
+	}
+	return out
+}
@@ -43,7 +43,8 @@ const (
 	// ProgressUpdateInterval is how often progress is updated in the UI
 	ProgressUpdateInterval = 200 * time.Millisecond
 
-	// WebSocketUpdateInterval is how often WebSocket progress messages are sent
+	// WebSocketUpdateInterval is the shortest gap between WebSocket progress
+	// messages; within it they follow each transfer's pace
 	WebSocketUpdateInterval = 100 * time.Millisecond
 
 	// ProgressRefreshRate is the refresh rate in Hz
@@ -82,11 +83,98 @@ const (
 	// UploadPathPrefix is the URL path prefix for uploads
 	UploadPathPrefix = "/u/"
 
+	// ShortPathPrefix is the URL path prefix of a share's short alias (--short)
+	ShortPathPrefix = "/s/"
+
+	// HealthPath is the URL path of the liveness check used by warp ping
+	HealthPath = "/health"
+
 	// PAKEInitPath is the URL path for PAKE initialization
 	PAKEInitPath = "/pake/init"
 
 	// PAKEVerifyPath is the URL path for PAKE verification
 	PAKEVerifyPath = "/pake/verify"
+
+	// EncryptInfoPath is the URL path that tells receivers whether the share is encrypted
+	EncryptInfoPath = "/d/encrypt-info"
+
+	// ProgressPathPrefix is the URL path prefix for the progress WebSocket (followed by the token)
+	ProgressPathPrefix = "/ws/progress/"
+
+	// StopPathSuffix is appended to a share URL to stop the server remotely
+	StopPathSuffix = "/stop"
+
+	// FinalizePathSuffix is appended to an upload URL to verify a completed parallel upload
+	FinalizePathSuffix = "/finalize"
+
+	// ManifestPathSuffix is appended to an upload URL to fetch the host's capabilities
+	ManifestPathSuffix = "/manifest"
+
+	// InfoPathSuffix is appended to a share URL to fetch the sender's capabilities
+	InfoPathSuffix = "/info"
+
+	// StatsPathSuffix is appended to a share or upload URL to fetch live transfer stats
+	StatsPathSuffix = "/stats"
+
+	// ListPathSuffix is appended to a directory share URL to list its files with their checksums
+	ListPathSuffix = "/ls"
+
+	// FilePathSuffix is appended to a directory share URL to fetch one of its files, named by the path query parameter
+	FilePathSuffix = "/file"
+
+	// PlaylistPathSuffix is appended to a directory share URL, sent with --media, for an M3U playlist of its audio and video
+	PlaylistPathSuffix = "/playlist.m3u8"
+
+	// VerifyPathSegment is appended to an upload URL, followed by a job ID, to poll an async verification
+	VerifyPathSegment = "/verify/"
+
+	// SessionPathSegment is appended to an upload URL, followed by a session ID, to see which chunks the host committed
+	SessionPathSegment = "/session/"
+)
+
+// HTTP headers
+const (
+	// TransferIDHeader carries the ID that correlates a transfer across server logs and client output
+	TransferIDHeader = "X-Warp-Transfer-Id"
+
+	// VersionHeader carries the warp version of CLI clients
+	VersionHeader = "X-Warp-Version"
+
+	// ManagementSecretHeader carries the secret for management endpoints such as stop
+	ManagementSecretHeader = "X-Warp-Secret"
+
+	// FileMtimeHeader carries a single file's modification time (RFC3339)
+	FileMtimeHeader = "X-File-Mtime"
+
+	// FileModeHeader carries a single file's permission bits (octal)
+	FileModeHeader = "X-File-Mode"
+
+	// ChunkSizeHeader carries the chunk size of a parallel upload; each chunk's
+	// offset must be its X-Chunk-Id times this size
+	ChunkSizeHeader = "X-Chunk-Size"
+
+	// ContentSHA256Header carries a file's SHA256 (hex): set on downloads, sent by uploaders to finalize
+	ContentSHA256Header = "X-Content-SHA256"
+
+	// FollowHeader is "1" on a download that streams a growing file until the
+	// sender stops (send --follow); it has no length or checksum
+	FollowHeader = "X-Warp-Follow"
+
+	// EncryptionHeader is "true" on a download whose body is encrypted with
+	// the key agreed over PAKE, and EncryptionChunkV1 on a parallel upload
+	// chunk sealed with crypto.SealChunk
+	EncryptionHeader = "X-Encryption"
+
+	// EncryptionChunkV1 is the EncryptionHeader value of a sealed upload chunk
+	EncryptionChunkV1 = "chunk-v1"
+
+	// AppendHeader is "true" on a raw upload that extends the host's file of
+	// the same name instead of saving a new one (host --allow-append)
+	AppendHeader = "X-Append"
+
+	// AppendOffsetHeader carries the size the uploader expects the host's
+	// file to have before an append; a mismatch is answered with 409
+	AppendOffsetHeader = "X-Append-Offset"
 )
 
 // GetOptimalBufferSize returns the best buffer size for a given file size
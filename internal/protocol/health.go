@@ -0,0 +1,27 @@
+package protocol
+
+import "time"
+
+// Health is served at /health without a token. warp ping uses it to measure
+// latency and clock skew before a transfer.
+type Health struct {
+	Status    string    `json:"status"` // Always "ok"
+	Version   string    `json:"version"`
+	Mode      string    `json:"mode"` // "send" or "host"
+	Time      time.Time `json:"time"` // Server clock when the response was built
+	Encrypted bool      `json:"encrypted"`
+	PAKE      bool      `json:"pake"`     // A PAKE code can be exchanged for the token
+	Reserved  int64     `json:"reserved"` // Disk bytes reserved by uploads in progress
+	// Send mode: downloads served to the end, whole files and Range
+	// continuations apart, and when a download was last requested
+	Downloads        int64      `json:"downloads"`
+	PartialDownloads int64      `json:"partial_downloads"`
+	LastAccess       *time.Time `json:"last_access,omitempty"` // Absent until the first download request
+	// Bytes all clients moved this quota period, uploads and downloads
+	// together, and the --quota-per-ip limit with when usage starts over.
+	// The quota fields are absent without --quota-per-ip. The bytes of each
+	// client IP are in Stats, behind the token.
+	UsageTotal int64      `json:"usage_total"`
+	Quota      int64      `json:"quota,omitempty"`
+	QuotaReset *time.Time `json:"quota_reset,omitempty"`
+}
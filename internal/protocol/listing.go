@@ -0,0 +1,16 @@
+package protocol
+
+// Listing is the file list of a directory share. It is served at
+// /d/{token}/ls for `warp receive --mirror`, which then fetches each file from
+// /d/{token}/file?path=<path>.
+type Listing struct {
+	Name  string         `json:"name"` // The shared directory's name
+	Files []ListingEntry `json:"files"`
+}
+
+// ListingEntry is one regular file of a directory share
+type ListingEntry struct {
+	Path   string `json:"path"` // Slash-separated, relative to the shared directory
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
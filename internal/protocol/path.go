@@ -0,0 +1,47 @@
+package protocol
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+var (
+	// ErrNotSharePath means the path starts with neither /d/ nor /u/
+	ErrNotSharePath = errors.New("not a share path")
+	// ErrEmptyToken means a share path carries no token
+	ErrEmptyToken = errors.New("share path has no token")
+)
+
+// ParseSharePath splits an escaped share path (r.URL.EscapedPath()) such as
+// /u/{token}/verify/{id} into its mode, DirectionDownload for /d/ and
+// DirectionUpload for /u/, the token and the rest, here "/verify/{id}". The
+// token and the rest are unescaped, so an encoded slash stays inside its
+// segment. Trailing slashes are dropped; the rest is "" for the share itself.
+// Comparing the token, in constant time, is left to the caller.
+func ParseSharePath(path string) (mode, token, rest string, err error) {
+	switch {
+	case strings.HasPrefix(path, PathPrefix):
+		mode, path = DirectionDownload, path[len(PathPrefix):]
+	case strings.HasPrefix(path, UploadPathPrefix):
+		mode, path = DirectionUpload, path[len(UploadPathPrefix):]
+	default:
+		return "", "", "", ErrNotSharePath
+	}
+
+	rawToken, rawRest, _ := strings.Cut(path, "/")
+	if token, err = url.PathUnescape(rawToken); err != nil {
+		return "", "", "", fmt.Errorf("invalid token escape: %w", err)
+	}
+	if token == "" {
+		return "", "", "", ErrEmptyToken
+	}
+	if rawRest = strings.TrimRight(rawRest, "/"); rawRest != "" {
+		if rest, err = url.PathUnescape(rawRest); err != nil {
+			return "", "", "", fmt.Errorf("invalid path escape: %w", err)
+		}
+		rest = "/" + rest
+	}
+	return mode, token, rest, nil
+}
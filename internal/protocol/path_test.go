@@ -0,0 +1,56 @@
+package protocol
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseSharePath(t *testing.T) {
+	tests := []struct {
+		name              string
+		path              string
+		mode, token, rest string
+		wantErr           error
+		wantAnyErr        bool
+	}{
+		{"download", "/d/abc123", DirectionDownload, "abc123", "", nil, false},
+		{"upload", "/u/abc123", DirectionUpload, "abc123", "", nil, false},
+		{"trailing slash", "/d/abc123/", DirectionDownload, "abc123", "", nil, false},
+		{"trailing slashes", "/u/abc123//", DirectionUpload, "abc123", "", nil, false},
+		{"sub-route", "/d/abc123/info", DirectionDownload, "abc123", InfoPathSuffix, nil, false},
+		{"sub-route with slash", "/u/abc123/manifest/", DirectionUpload, "abc123", ManifestPathSuffix, nil, false},
+		{"extra segments", "/u/abc123/verify/job-1", DirectionUpload, "abc123", "/verify/job-1", nil, false},
+		{"encoded token", "/d/abc%2D123", DirectionDownload, "abc-123", "", nil, false},
+		{"encoded slash stays in the token", "/d/abc%2F123/stop", DirectionDownload, "abc/123", StopPathSuffix, nil, false},
+		{"encoded rest", "/u/abc123/session/s%20id", DirectionUpload, "abc123", "/session/s id", nil, false},
+		{"empty token", "/d/", "", "", "", ErrEmptyToken, false},
+		{"empty token with rest", "/u//stop", "", "", "", ErrEmptyToken, false},
+		{"bad escape", "/d/abc%zz", "", "", "", nil, true},
+		{"bad escape in rest", "/d/abc/%zz", "", "", "", nil, true},
+		{"other path", "/health", "", "", "", ErrNotSharePath, false},
+		{"prefix without slash", "/d", "", "", "", ErrNotSharePath, false},
+		{"progress socket", "/ws/progress/abc123", "", "", "", ErrNotSharePath, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mode, token, rest, err := ParseSharePath(tt.path)
+			switch {
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+				return
+			case tt.wantAnyErr:
+				if err == nil {
+					t.Fatalf("no error for %q", tt.path)
+				}
+				return
+			case err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if mode != tt.mode || token != tt.token || rest != tt.rest {
+				t.Errorf("got (%q, %q, %q), want (%q, %q, %q)", mode, token, rest, tt.mode, tt.token, tt.rest)
+			}
+		})
+	}
+}
@@ -0,0 +1,31 @@
+package protocol
+
+// SessionStatus is the host's view of a parallel upload, served at
+// /u/{token}/session/{sessionID}. Chunk i is committed when bit i%8 of
+// ReceivedBitmap[i/8] is set (least significant bit first).
+type SessionStatus struct {
+	TotalChunks    int    `json:"total_chunks"`
+	ReceivedChunks int    `json:"received_chunks"`
+	ReceivedBitmap []byte `json:"received_bitmap"` // base64 in JSON
+	BytesWritten   int64  `json:"bytes_written"`
+	Complete       bool   `json:"complete"`
+}
+
+// Has reports whether the host committed chunk id
+func (s *SessionStatus) Has(id int) bool {
+	if id < 0 || id/8 >= len(s.ReceivedBitmap) {
+		return false
+	}
+	return s.ReceivedBitmap[id/8]&(1<<(id%8)) != 0
+}
+
+// Missing returns the IDs of the chunks the host has not committed
+func (s *SessionStatus) Missing() []int {
+	var ids []int
+	for id := 0; id < s.TotalChunks; id++ {
+		if !s.Has(id) {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
@@ -0,0 +1,40 @@
+package protocol
+
+// Transfer directions reported by the stats endpoint
+const (
+	DirectionDownload = "download"
+	DirectionUpload   = "upload"
+)
+
+// Stats is a snapshot of a running server's transfers. It is served at
+// /d/{token}/stats and /u/{token}/stats and polled by `warp top`.
+type Stats struct {
+	Version       string              `json:"version"`
+	Mode          string              `json:"mode"` // "send" or "host"
+	UptimeSeconds float64             `json:"uptime_seconds"`
+	BytesSent     int64               `json:"bytes_sent"`     // Downloads, including those in progress
+	BytesReceived int64               `json:"bytes_received"` // Uploads, including those in progress
+	Active        []TransferStats     `json:"active"`
+	Recent        []CompletedTransfer `json:"recent"` // Newest first
+	Usage         map[string]int64    `json:"usage"`  // Bytes each client IP moved this quota period
+}
+
+// TransferStats is one transfer in progress
+type TransferStats struct {
+	ID             string  `json:"id"` // Stable while the transfer runs; not its transfer or session ID
+	Name           string  `json:"name"`
+	Direction      string  `json:"direction"`
+	Current        int64   `json:"current"`
+	Total          int64   `json:"total,omitempty"` // 0 when unknown, e.g. a zipped directory
+	ElapsedSeconds float64 `json:"elapsed_seconds"`
+}
+
+// CompletedTransfer is a transfer that finished successfully
+type CompletedTransfer struct {
+	Name            string  `json:"name"`
+	Direction       string  `json:"direction"`
+	Bytes           int64   `json:"bytes"`
+	DurationSeconds float64 `json:"duration_seconds"`
+	FinishedAt      int64   `json:"finished_at"`            // Unix seconds
+	TTFBSeconds     float64 `json:"ttfb_seconds,omitempty"` // Part of the duration before the first byte; downloads only
+}
@@ -0,0 +1,179 @@
+package protocol
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// ValidationVersion numbers the rules in this file. Hosts advertise it in
+// Limits.Version so clients know what they are pre-validating against; bump
+// it when a rule changes meaning.
+const ValidationVersion = 1
+
+// Fixed bounds, the same on every host
+const (
+	MinSessionIDLength = 8
+	MaxSessionIDLength = 64
+	MinChunkSize       = 64 << 10 // Every chunk but the last; 64KB
+)
+
+// Defaults for the configurable Limits
+const (
+	DefaultMaxChunks          = 100000
+	DefaultMaxChunkSize       = 100 << 20 // 100MB
+	DefaultMaxTotalSize       = 10 << 30  // 10GB
+	DefaultMaxSessionIdleTime = time.Hour
+)
+
+// DefaultLimits returns the upload bounds a host uses when none are
+// configured
+func DefaultLimits() Limits {
+	return Limits{
+		Version:            ValidationVersion,
+		MaxChunks:          DefaultMaxChunks,
+		MaxChunkSize:       DefaultMaxChunkSize,
+		MaxTotalSize:       DefaultMaxTotalSize,
+		MaxSessionIdleTime: DefaultMaxSessionIdleTime,
+	}
+}
+
+// ErrInvalidSessionID is wrapped by session ID errors that aren't about its
+// length
+var ErrInvalidSessionID = errors.New("invalid session ID")
+
+// LimitError reports a value on the wrong side of a limit. Max tells which
+// side: the value may be at most Limit, or at least Limit when Max is false.
+type LimitError struct {
+	What  string // e.g. "chunk size", "total chunks"
+	Value int64
+	Limit int64
+	Max   bool
+}
+
+func (e *LimitError) Error() string {
+	if e.Max {
+		return fmt.Sprintf("%s too large: %d (max: %d)", e.What, e.Value, e.Limit)
+	}
+	return fmt.Sprintf("%s too small: %d (min: %d)", e.What, e.Value, e.Limit)
+}
+
+// atMost returns a LimitError when value exceeds limit. A zero limit is no
+// limit.
+func atMost(what string, value, limit int64) error {
+	if limit > 0 && value > limit {
+		return &LimitError{What: what, Value: value, Limit: limit, Max: true}
+	}
+	return nil
+}
+
+// atLeast returns a LimitError when value is below limit
+func atLeast(what string, value, limit int64) error {
+	if value < limit {
+		return &LimitError{What: what, Value: value, Limit: limit}
+	}
+	return nil
+}
+
+// sessionIDPattern validates session IDs (alphanumeric, hyphens, and underscores only)
+var sessionIDPattern = regexp.MustCompile(`^[a-zA-Z0-9\-_]+$`)
+
+// ValidateSessionID checks if a session ID is valid
+func ValidateSessionID(sessionID string) error {
+	n := int64(len(sessionID))
+	if err := atLeast("session ID length", n, MinSessionIDLength); err != nil {
+		return err
+	}
+	if err := atMost("session ID length", n, MaxSessionIDLength); err != nil {
+		return err
+	}
+	if !sessionIDPattern.MatchString(sessionID) {
+		return fmt.Errorf("%w: only alphanumeric, hyphens, and underscores allowed", ErrInvalidSessionID)
+	}
+	return nil
+}
+
+// ValidateOffset checks if an upload offset is valid for the given file
+// size. A fileSize of 0 means unknown.
+func ValidateOffset(offset, fileSize int64) error {
+	if err := atLeast("offset", offset, 0); err != nil {
+		return err
+	}
+	return atMost("offset", offset, fileSize)
+}
+
+// ValidateTotalChunks checks the chunk count of an upload against MaxChunks
+func (l Limits) ValidateTotalChunks(totalChunks int) error {
+	if err := atLeast("total chunks", int64(totalChunks), 1); err != nil {
+		return err
+	}
+	return atMost("total chunks", int64(totalChunks), int64(l.MaxChunks))
+}
+
+// ValidateChunkID checks that chunkID is an index into totalChunks chunks.
+// Call ValidateTotalChunks first; this doesn't check the count.
+func (l Limits) ValidateChunkID(chunkID, totalChunks int) error {
+	if err := atLeast("chunk ID", int64(chunkID), 0); err != nil {
+		return err
+	}
+	if l.MaxChunks > 0 {
+		if err := atMost("chunk ID", int64(chunkID), int64(l.MaxChunks-1)); err != nil {
+			return err
+		}
+	}
+	if totalChunks > 0 {
+		return atMost("chunk ID", int64(chunkID), int64(totalChunks-1))
+	}
+	return nil
+}
+
+// ValidateChunkSize checks the size of a chunk that isn't the last one,
+// which has to be between MinChunkSize and MaxChunkSize
+func (l Limits) ValidateChunkSize(chunkSize int64) error {
+	if err := atLeast("chunk size", chunkSize, MinChunkSize); err != nil {
+		return err
+	}
+	return atMost("chunk size", chunkSize, l.MaxChunkSize)
+}
+
+// ValidateTotalSize checks the size of a whole upload against MaxTotalSize
+func (l Limits) ValidateTotalSize(size int64) error {
+	if err := atLeast("upload size", size, 0); err != nil {
+		return err
+	}
+	return atMost("upload size", size, l.MaxTotalSize)
+}
+
+// ValidateChunkOffset checks that a chunk sits where its ID puts it in a file
+// split into chunkSize pieces. Every chunk but the last must be exactly
+// chunkSize bytes; the last may be shorter and, when totalSize is known, must
+// end the file.
+func ValidateChunkOffset(chunkID, totalChunks int, offset, length, chunkSize, totalSize int64) error {
+	if want := int64(chunkID) * chunkSize; offset != want {
+		return fmt.Errorf("chunk %d must start at offset %d, got %d", chunkID, want, offset)
+	}
+
+	if chunkID < totalChunks-1 {
+		if length != chunkSize {
+			return fmt.Errorf("chunk %d is %d bytes, want %d", chunkID, length, chunkSize)
+		}
+		return nil
+	}
+
+	if length > chunkSize {
+		return fmt.Errorf("last chunk is %d bytes, more than the chunk size %d", length, chunkSize)
+	}
+	if totalSize > 0 && offset+length != totalSize {
+		return fmt.Errorf("last chunk ends at %d, want the file size %d", offset+length, totalSize)
+	}
+	return nil
+}
+
+// ValidateContentLength checks if content length is within acceptable bounds
+func ValidateContentLength(contentLength, maxSize int64) error {
+	if err := atLeast("content length", contentLength, 1); err != nil {
+		return err
+	}
+	return atMost("content length", contentLength, maxSize)
+}
@@ -0,0 +1,218 @@
+package protocol
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// checkLimit fails unless err matches want: nil, or a LimitError with the
+// same limit and side
+func checkLimit(t *testing.T, name string, err error, want *LimitError) {
+	t.Helper()
+	if want == nil {
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", name, err)
+		}
+		return
+	}
+	var le *LimitError
+	if !errors.As(err, &le) {
+		t.Errorf("%s: got %v, want a LimitError", name, err)
+		return
+	}
+	if le.Limit != want.Limit || le.Max != want.Max {
+		t.Errorf("%s: got limit %d max=%v, want %d max=%v", name, le.Limit, le.Max, want.Limit, want.Max)
+	}
+}
+
+func maxErr(limit int64) *LimitError { return &LimitError{Limit: limit, Max: true} }
+func minErr(limit int64) *LimitError { return &LimitError{Limit: limit} }
+
+func TestValidateTotalChunks(t *testing.T) {
+	l := Limits{MaxChunks: 10}
+	tests := []struct {
+		name string
+		n    int
+		want *LimitError
+	}{
+		{"one", 1, nil},
+		{"at limit", 10, nil},
+		{"one over", 11, maxErr(10)},
+		{"zero", 0, minErr(1)},
+		{"negative", -1, minErr(1)},
+	}
+	for _, tt := range tests {
+		checkLimit(t, tt.name, l.ValidateTotalChunks(tt.n), tt.want)
+	}
+	checkLimit(t, "no MaxChunks", Limits{}.ValidateTotalChunks(1<<30), nil)
+}
+
+func TestValidateChunkID(t *testing.T) {
+	l := Limits{MaxChunks: 10}
+	tests := []struct {
+		name      string
+		id, total int
+		want      *LimitError
+	}{
+		{"first", 0, 5, nil},
+		{"last", 4, 5, nil},
+		{"equal to total", 5, 5, maxErr(4)},
+		{"last under MaxChunks", 9, 0, nil},
+		{"at MaxChunks", 10, 0, maxErr(9)},
+		{"negative", -1, 5, minErr(0)},
+	}
+	for _, tt := range tests {
+		checkLimit(t, tt.name, l.ValidateChunkID(tt.id, tt.total), tt.want)
+	}
+}
+
+func TestValidateChunkSize(t *testing.T) {
+	l := Limits{MaxChunkSize: 1 << 20}
+	tests := []struct {
+		name string
+		size int64
+		want *LimitError
+	}{
+		{"at minimum", MinChunkSize, nil},
+		{"one under minimum", MinChunkSize - 1, minErr(MinChunkSize)},
+		{"at limit", 1 << 20, nil},
+		{"one over", 1<<20 + 1, maxErr(1 << 20)},
+		{"zero", 0, minErr(MinChunkSize)},
+		{"negative", -1, minErr(MinChunkSize)},
+	}
+	for _, tt := range tests {
+		checkLimit(t, tt.name, l.ValidateChunkSize(tt.size), tt.want)
+	}
+}
+
+func TestValidateTotalSize(t *testing.T) {
+	l := Limits{MaxTotalSize: 1000}
+	tests := []struct {
+		name string
+		size int64
+		want *LimitError
+	}{
+		{"zero", 0, nil},
+		{"at limit", 1000, nil},
+		{"one over", 1001, maxErr(1000)},
+		{"negative", -1, minErr(0)},
+	}
+	for _, tt := range tests {
+		checkLimit(t, tt.name, l.ValidateTotalSize(tt.size), tt.want)
+	}
+	checkLimit(t, "no MaxTotalSize", Limits{}.ValidateTotalSize(1<<50), nil)
+}
+
+func TestValidateOffset(t *testing.T) {
+	tests := []struct {
+		name         string
+		offset, size int64
+		want         *LimitError
+	}{
+		{"start", 0, 100, nil},
+		{"at end", 100, 100, nil},
+		{"one past end", 101, 100, maxErr(100)},
+		{"unknown size", 1 << 40, 0, nil},
+		{"negative", -1, 100, minErr(0)},
+	}
+	for _, tt := range tests {
+		checkLimit(t, tt.name, ValidateOffset(tt.offset, tt.size), tt.want)
+	}
+}
+
+func TestValidateContentLength(t *testing.T) {
+	tests := []struct {
+		name string
+		n    int64
+		want *LimitError
+	}{
+		{"one byte", 1, nil},
+		{"at limit", 500, nil},
+		{"one over", 501, maxErr(500)},
+		{"zero", 0, minErr(1)},
+		{"negative", -1, minErr(1)},
+	}
+	for _, tt := range tests {
+		checkLimit(t, tt.name, ValidateContentLength(tt.n, 500), tt.want)
+	}
+}
+
+func TestValidateSessionID(t *testing.T) {
+	tests := []struct {
+		name, id string
+		want     *LimitError
+	}{
+		{"at minimum", strings.Repeat("a", MinSessionIDLength), nil},
+		{"one short", strings.Repeat("a", MinSessionIDLength-1), minErr(MinSessionIDLength)},
+		{"empty", "", minErr(MinSessionIDLength)},
+		{"at maximum", strings.Repeat("a", MaxSessionIDLength), nil},
+		{"one over", strings.Repeat("a", MaxSessionIDLength+1), maxErr(MaxSessionIDLength)},
+	}
+	for _, tt := range tests {
+		checkLimit(t, tt.name, ValidateSessionID(tt.id), tt.want)
+	}
+	if err := ValidateSessionID("session/../id"); !errors.Is(err, ErrInvalidSessionID) {
+		t.Errorf("bad characters: got %v, want ErrInvalidSessionID", err)
+	}
+}
+
+func TestValidateChunkOffset(t *testing.T) {
+	const size = 1000
+	tests := []struct {
+		name                 string
+		id, total            int
+		offset, length, file int64
+		wantErr              bool
+	}{
+		{"first", 0, 3, 0, size, 2500, false},
+		{"middle", 1, 3, size, size, 2500, false},
+		{"short last", 2, 3, 2 * size, 500, 2500, false},
+		{"last with unknown total", 2, 3, 2 * size, 500, 0, false},
+		{"another chunk's offset", 2, 3, 0, 500, 2500, true},
+		{"misaligned", 1, 3, size + 1, size, 2500, true},
+		{"short middle", 1, 3, size, 999, 2500, true},
+		{"oversized last", 2, 3, 2 * size, size + 1, 0, true},
+		{"last not ending the file", 2, 3, 2 * size, 400, 2500, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateChunkOffset(tt.id, tt.total, tt.offset, tt.length, size, tt.file)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLimitErrorMessage(t *testing.T) {
+	err := Limits{MaxChunks: 4}.ValidateTotalChunks(5)
+	if got, want := err.Error(), "total chunks too large: 5 (max: 4)"; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+	err = Limits{}.ValidateChunkSize(10)
+	if got, want := err.Error(), "chunk size too small: 10 (min: 65536)"; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+}
+
+func TestLimitsJSON(t *testing.T) {
+	in := DefaultLimits()
+	in.MaxFileSize = 42
+	data, err := json.Marshal(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"max_session_idle_seconds":3600`) || !strings.Contains(string(data), `"max_chunks":100000`) {
+		t.Errorf("wire form = %s", data)
+	}
+	var out Limits
+	if err := json.Unmarshal(data, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.MaxSessionIdleTime != time.Hour || out.MaxFileSize != 42 || out.Version != ValidationVersion {
+		t.Errorf("round trip = %+v", out)
+	}
+}
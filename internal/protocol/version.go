@@ -0,0 +1,16 @@
+package protocol
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// Version is the warp release. Override at build time with
+// -ldflags "-X github.com/zulfikawr/warp/internal/protocol.Version=1.2.3"
+var Version = "1.1.0"
+
+// UserAgent returns the User-Agent sent by warp CLI clients,
+// e.g. "warp/1.1.0 (linux; amd64)"
+func UserAgent() string {
+	return fmt.Sprintf("warp/%s (%s; %s)", Version, runtime.GOOS, runtime.GOARCH)
+}
@@ -0,0 +1,146 @@
+package relay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/zulfikawr/warp/internal/logging"
+)
+
+// Retry delays of a Listener whose relay went away or refused it
+const (
+	minRetry = time.Second
+	maxRetry = 30 * time.Second
+)
+
+// Dial connects to the relay at addr and waits until the sender of room
+// pairs with it. The connection returned leads to the sender.
+func Dial(ctx context.Context, addr, room string) (net.Conn, error) {
+	conn, err := hello(ctx, addr, roleDial, room)
+	if err != nil {
+		return nil, err
+	}
+	if err := awaitPeer(ctx, conn); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// hello connects to the relay and announces role in room
+func hello(ctx context.Context, addr, role, room string) (net.Conn, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.WriteString(conn, fmt.Sprintf("%s %s %s\n", magic, role, room)); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// awaitPeer reads the relay's OK, giving up when ctx ends
+func awaitPeer(ctx context.Context, conn net.Conn) error {
+	stop := context.AfterFunc(ctx, func() { _ = conn.SetReadDeadline(time.Now()) })
+	err := readReply(conn)
+	if !stop() {
+		// ctx ended while reading, whether or not the reply arrived
+		return ctx.Err()
+	}
+	return err
+}
+
+// Listener accepts receivers paired with a sender through a relay. It keeps
+// one connection waiting at the relay, opening the next as each is paired.
+type Listener struct {
+	addr, room string
+	ctx        context.Context
+	cancel     context.CancelFunc
+
+	mu   sync.Mutex
+	next net.Conn // Waiting connection already announced, or nil
+}
+
+// Listen announces a sender in room at the relay at addr. It fails when the
+// relay can't be reached or refuses the room; after that, Accept retries
+// until Close.
+func Listen(addr, room string) (*Listener, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	conn, err := hello(ctx, addr, roleServe, room)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	return &Listener{addr: addr, room: room, ctx: ctx, cancel: cancel, next: conn}, nil
+}
+
+// Accept waits for a receiver and returns the connection leading to it
+func (l *Listener) Accept() (net.Conn, error) {
+	delay := minRetry
+	for {
+		conn, err := l.waiting()
+		if err == nil {
+			if err = awaitPeer(l.ctx, conn); err == nil {
+				return conn, nil
+			}
+			_ = conn.Close()
+		}
+		if l.ctx.Err() != nil {
+			return nil, net.ErrClosed
+		}
+		if !errors.Is(err, io.EOF) {
+			logging.Warn("Relay connection failed, retrying", zap.String("relay", l.addr), zap.Duration("in", delay), zap.Error(err))
+			select {
+			case <-l.ctx.Done():
+				return nil, net.ErrClosed
+			case <-time.After(delay):
+			}
+			delay = min(2*delay, maxRetry)
+		}
+		// The relay closes waiting connections that go idle: announce again
+	}
+}
+
+// waiting returns the announced connection Listen opened, or announces a new one
+func (l *Listener) waiting() (net.Conn, error) {
+	l.mu.Lock()
+	conn := l.next
+	l.next = nil
+	l.mu.Unlock()
+	if conn != nil {
+		return conn, nil
+	}
+	return hello(l.ctx, l.addr, roleServe, l.room)
+}
+
+// Close stops accepting; connections already returned stay open
+func (l *Listener) Close() error {
+	l.cancel()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.next != nil {
+		_ = l.next.Close()
+		l.next = nil
+	}
+	return nil
+}
+
+// Addr returns the relay's address
+func (l *Listener) Addr() net.Addr {
+	return relayAddr(l.addr)
+}
+
+// relayAddr is a relay's host:port as a net.Addr
+type relayAddr string
+
+func (a relayAddr) Network() string { return "relay" }
+func (a relayAddr) String() string  { return string(a) }
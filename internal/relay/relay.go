@@ -0,0 +1,168 @@
+// Package relay connects a sender and a receiver that can't reach each other
+// but can both reach a third machine. The relay pairs one connection from
+// each side by room and forwards bytes between them; it stores nothing and
+// doesn't look at what it forwards.
+//
+// A connection opens with one line, "WARP-RELAY/1 SERVE <room>" from the
+// sender or "WARP-RELAY/1 DIAL <room>" from the receiver. The relay answers
+// "OK" once the other side arrives, or "ERR <reason>" and closes. After OK
+// the connection is the peer's. The sender keeps a SERVE connection waiting
+// at all times, so a receiver can open as many connections as it needs.
+//
+// The room comes from a nameplate, a random rendezvous ID the sender picks
+// and shows in front of its PAKE code, as in "3f9a0c21-7-apple-velocity". The
+// nameplate never goes into PAKE, so what the relay or anyone watching the
+// hello learns says nothing about the code: guessing it takes one online
+// handshake with the sender per guess, which the sender limits.
+//
+// warp runs HTTP/2 over TLS through the pair, which multiplexes every request
+// of a transfer over one connection. The receiver pins the sender's
+// certificate, which the PAKE handshake then authenticates, so the relay
+// can't sit in the middle of the TLS either. Content is encrypted end to end
+// with the PAKE key on top of that.
+package relay
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultPort is the port warp relay listens on by default
+const DefaultPort = 9000
+
+// Defaults for a Server's zero fields
+const (
+	DefaultIdleTimeout = 5 * time.Minute  // Pairs and waiting senders with no traffic are closed
+	DefaultPairTimeout = 30 * time.Second // A receiver waits this long for the sender
+)
+
+const (
+	magic       = "WARP-RELAY/1"
+	roleServe   = "SERVE"
+	roleDial    = "DIAL"
+	replyOK     = "OK"
+	replyErr    = "ERR"
+	maxLine     = 128
+	helloWait   = 10 * time.Second // For the first line of a new connection
+	maxWaiting  = 8                // Connections one room may keep waiting per side
+	roomHexSize = 32
+	// nameplateHexSize is the length of a nameplate: 32 random bits, enough
+	// for senders on one relay not to collide
+	nameplateHexSize = 8
+)
+
+// ErrRejected is returned when the relay refuses a connection
+var ErrRejected = errors.New("relay refused the connection")
+
+// Room returns the relay room for a nameplate. Both sides derive it from the
+// nameplate alone; the PAKE code is never an input.
+func Room(nameplate string) string {
+	sum := sha256.Sum256([]byte("warp relay room\x00" + nameplate))
+	return hex.EncodeToString(sum[:])[:roomHexSize]
+}
+
+// NewNameplate returns a random nameplate for a sender, reading from
+// crypto/rand when r is nil
+func NewNameplate(r io.Reader) (string, error) {
+	if r == nil {
+		r = rand.Reader
+	}
+	b := make([]byte, nameplateHexSize/2)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Code is what a receiver types to reach a sender through a relay: the
+// nameplate, a dash and the PAKE code
+func Code(nameplate, pakeCode string) string {
+	return nameplate + "-" + pakeCode
+}
+
+// SplitCode separates a Code into its nameplate and PAKE code
+func SplitCode(code string) (nameplate, pakeCode string, err error) {
+	nameplate, pakeCode, _ = strings.Cut(code, "-")
+	if len(nameplate) != nameplateHexSize || pakeCode == "" {
+		return "", "", fmt.Errorf("relay code %q should be a nameplate and a PAKE code, e.g. 3f9a0c21-7-apple-velocity", code)
+	}
+	if _, err := hex.DecodeString(nameplate); err != nil {
+		return "", "", fmt.Errorf("relay code %q starts with an invalid nameplate", code)
+	}
+	return nameplate, pakeCode, nil
+}
+
+// validRoom reports whether room is a Room value
+func validRoom(room string) bool {
+	if len(room) != roomHexSize {
+		return false
+	}
+	_, err := hex.DecodeString(room)
+	return err == nil
+}
+
+// ParseAddr checks a relay address: host:port, or a host alone for
+// DefaultPort
+func ParseAddr(v string) (string, error) {
+	if v == "" {
+		return "", errors.New("empty relay address")
+	}
+	host, port, err := net.SplitHostPort(v)
+	if err != nil {
+		// No port, or an IPv6 address without brackets
+		host, port = strings.Trim(v, "[]"), strconv.Itoa(DefaultPort)
+	}
+	if host == "" {
+		return "", fmt.Errorf("relay address %q has no host", v)
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+		return "", fmt.Errorf("relay address %q has an invalid port", v)
+	}
+	return net.JoinHostPort(host, port), nil
+}
+
+// BaseURL is the base of share URLs reached through the relay at addr. The
+// host only names the relay; every connection is dialled through it.
+func BaseURL(addr string) string {
+	return "https://" + addr
+}
+
+// readLine reads one newline-terminated line a byte at a time, so nothing
+// after it is taken from r
+func readLine(r io.Reader) (string, error) {
+	var line []byte
+	var b [1]byte
+	for len(line) <= maxLine {
+		if _, err := io.ReadFull(r, b[:]); err != nil {
+			return "", err
+		}
+		if b[0] == '\n' {
+			return string(line), nil
+		}
+		line = append(line, b[0])
+	}
+	return "", fmt.Errorf("line longer than %d bytes", maxLine)
+}
+
+// readReply reads the relay's answer to a hello
+func readReply(r io.Reader) error {
+	line, err := readLine(r)
+	if err != nil {
+		return err
+	}
+	if line == replyOK {
+		return nil
+	}
+	if reason, ok := strings.CutPrefix(line, replyErr+" "); ok {
+		return fmt.Errorf("%w: %s", ErrRejected, reason)
+	}
+	return fmt.Errorf("unexpected relay reply %q", line)
+}
@@ -0,0 +1,221 @@
+package relay
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// startRelay serves s on a loopback port and returns its address
+func startRelay(t *testing.T, s *Server) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() { _ = s.Serve(ln) }()
+	t.Cleanup(func() { _ = s.Close() })
+	return ln.Addr().String()
+}
+
+func TestPairForwards(t *testing.T) {
+	addr := startRelay(t, &Server{})
+	room := Room("3f9a0c21")
+	ln, err := Listen(addr, room)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	payload := make([]byte, 1<<20)
+	_, _ = rand.Read(payload)
+	go func() {
+		// The sender answers each receiver with its checksum and the payload
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				greeting, _ := readLine(conn)
+				sum := sha256.Sum256(payload)
+				_, _ = conn.Write([]byte(greeting + "\n"))
+				_, _ = conn.Write(sum[:])
+				_, _ = conn.Write(payload)
+			}()
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	// Two receivers in turn: the sender keeps a connection waiting
+	for _, name := range []string{"first", "second"} {
+		conn, err := Dial(ctx, addr, room)
+		if err != nil {
+			t.Fatalf("%s dial: %v", name, err)
+		}
+		_, _ = conn.Write([]byte(name + "\n"))
+		got, err := io.ReadAll(conn)
+		_ = conn.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := name + "\n"
+		if !bytes.HasPrefix(got, []byte(want)) {
+			t.Fatalf("%s: got %q first", name, got[:min(len(got), 16)])
+		}
+		got = got[len(want):]
+		if len(got) < sha256.Size {
+			t.Fatalf("%s: %d bytes", name, len(got))
+		}
+		if sum := sha256.Sum256(got[sha256.Size:]); !bytes.Equal(sum[:], got[:sha256.Size]) {
+			t.Errorf("%s: checksum mismatch over %d bytes", name, len(got)-sha256.Size)
+		}
+	}
+}
+
+func TestDialWithoutSender(t *testing.T) {
+	addr := startRelay(t, &Server{PairTimeout: 100 * time.Millisecond})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := Dial(ctx, addr, Room("00000000"))
+	if !errors.Is(err, ErrRejected) {
+		t.Errorf("err = %v, want ErrRejected", err)
+	}
+}
+
+func TestBadHello(t *testing.T) {
+	addr := startRelay(t, &Server{})
+	for _, hello := range []string{
+		"GET / HTTP/1.1\n",
+		magic + " DIAL not-a-room\n",
+		magic + " WATCH " + Room("x") + "\n",
+	} {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = io.WriteString(conn, hello)
+		if err := readReply(conn); !errors.Is(err, ErrRejected) {
+			t.Errorf("%q: err = %v, want ErrRejected", hello, err)
+		}
+		_ = conn.Close()
+	}
+}
+
+// pair connects a sender and a receiver in a fresh room
+func pair(t *testing.T, addr string) (sender, receiver net.Conn) {
+	t.Helper()
+	room := Room(t.Name())
+	ln, err := Listen(addr, room)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err == nil {
+			accepted <- conn
+		}
+	}()
+	receiver, err = Dial(context.Background(), addr, room)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case sender = <-accepted:
+	case <-time.After(5 * time.Second):
+		t.Fatal("sender never paired")
+	}
+	t.Cleanup(func() {
+		_ = sender.Close()
+		_ = receiver.Close()
+	})
+	return sender, receiver
+}
+
+func TestIdlePairClosed(t *testing.T) {
+	addr := startRelay(t, &Server{IdleTimeout: 200 * time.Millisecond})
+	_, receiver := pair(t, addr)
+	_ = receiver.SetReadDeadline(time.Now().Add(5 * time.Second))
+	start := time.Now()
+	if _, err := receiver.Read(make([]byte, 1)); err == nil {
+		t.Fatal("read data from an idle pair")
+	}
+	if elapsed := time.Since(start); elapsed >= 5*time.Second {
+		t.Errorf("idle pair still open after %v", elapsed)
+	}
+}
+
+func TestPairRateLimit(t *testing.T) {
+	addr := startRelay(t, &Server{RateLimitMbps: 8}) // 1 MB/s
+	sender, receiver := pair(t, addr)
+	const size = 1 << 20
+	go func() { _, _ = sender.Write(make([]byte, size)) }()
+	start := time.Now()
+	if _, err := io.ReadFull(receiver, make([]byte, size)); err != nil {
+		t.Fatal(err)
+	}
+	// The first 100ms is burst
+	if elapsed := time.Since(start); elapsed < 800*time.Millisecond {
+		t.Errorf("1 MB at 8 Mbps took %v", elapsed)
+	}
+}
+
+func TestParseAddr(t *testing.T) {
+	for in, want := range map[string]string{
+		"relay.example.com":      "relay.example.com:9000",
+		"relay.example.com:9443": "relay.example.com:9443",
+		"10.0.0.5":               "10.0.0.5:9000",
+		"[fd00::1]:9001":         "[fd00::1]:9001",
+		"fd00::1":                "[fd00::1]:9000",
+	} {
+		if got, err := ParseAddr(in); err != nil || got != want {
+			t.Errorf("ParseAddr(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"", ":9000", "relay:0", "relay:http"} {
+		if got, err := ParseAddr(in); err == nil {
+			t.Errorf("ParseAddr(%q) = %q, want an error", in, got)
+		}
+	}
+}
+
+func TestRoom(t *testing.T) {
+	a, b := Room("3f9a0c21"), Room("3f9a0c21")
+	if a != b || !validRoom(a) {
+		t.Errorf("Room = %q, %q", a, b)
+	}
+	if Room("3f9a0c22") == a {
+		t.Error("different nameplates share a room")
+	}
+}
+
+func TestCode(t *testing.T) {
+	nameplate, err := NewNameplate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := Code(nameplate, "7-apple-velocity")
+	gotPlate, gotCode, err := SplitCode(code)
+	if err != nil || gotPlate != nameplate || gotCode != "7-apple-velocity" {
+		t.Errorf("SplitCode(%q) = %q, %q, %v", code, gotPlate, gotCode, err)
+	}
+	// The room depends on the nameplate only, never on the PAKE code
+	if Room(gotPlate) != Room(nameplate) {
+		t.Error("room changed with the PAKE code")
+	}
+	for _, bad := range []string{"7-apple-velocity", "3f9a0c21", "3f9a0c21-", "zz9a0c21-7-apple-velocity", ""} {
+		if _, _, err := SplitCode(bad); err == nil {
+			t.Errorf("SplitCode(%q) accepted", bad)
+		}
+	}
+}
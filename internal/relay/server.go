@@ -0,0 +1,380 @@
+package relay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/time/rate"
+
+	"github.com/zulfikawr/warp/internal/logging"
+)
+
+// Server pairs senders and receivers by room and forwards bytes between them
+type Server struct {
+	RateLimitMbps float64       // Per pair, both directions together; 0 = no cap
+	IdleTimeout   time.Duration // 0 = DefaultIdleTimeout
+	PairTimeout   time.Duration // 0 = DefaultPairTimeout
+
+	mu     sync.Mutex
+	rooms  map[string]*room
+	ln     net.Listener
+	conns  map[net.Conn]struct{} // Open connections, closed by Close
+	closed bool
+	wg     sync.WaitGroup
+}
+
+// room holds the connections of one room waiting for the other side
+type room struct {
+	serve, dial []*waiter
+}
+
+// waiter is a connection waiting for its peer, which arrives on pair
+type waiter struct {
+	conn net.Conn
+	pair chan net.Conn
+}
+
+// Serve accepts connections on ln until Close
+func (s *Server) Serve(ln net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return net.ErrClosed
+	}
+	s.ln = ln
+	s.mu.Unlock()
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if s.isClosed() {
+				return nil
+			}
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				continue
+			}
+			return err
+		}
+		if !s.track(conn) {
+			_ = conn.Close()
+			return nil
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.handle(conn)
+		}()
+	}
+}
+
+// ListenAndServe listens on the TCP address addr and serves it
+func (s *Server) ListenAndServe(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(ln)
+}
+
+// Close stops accepting, closes every connection and waits for the handlers
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	var err error
+	if s.ln != nil {
+		err = s.ln.Close()
+	}
+	for c := range s.conns {
+		_ = c.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	return err
+}
+
+func (s *Server) isClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed
+}
+
+func (s *Server) track(c net.Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return false
+	}
+	if s.conns == nil {
+		s.conns = make(map[net.Conn]struct{})
+	}
+	s.conns[c] = struct{}{}
+	return true
+}
+
+func (s *Server) untrack(c net.Conn) {
+	s.mu.Lock()
+	delete(s.conns, c)
+	s.mu.Unlock()
+	_ = c.Close()
+}
+
+func (s *Server) idleTimeout() time.Duration {
+	if s.IdleTimeout > 0 {
+		return s.IdleTimeout
+	}
+	return DefaultIdleTimeout
+}
+
+func (s *Server) pairTimeout() time.Duration {
+	if s.PairTimeout > 0 {
+		return s.PairTimeout
+	}
+	return DefaultPairTimeout
+}
+
+// handle reads the hello of a new connection and pairs it, or parks it until
+// its peer arrives. The connection that waited forwards the pair.
+func (s *Server) handle(conn net.Conn) {
+	_ = conn.SetReadDeadline(time.Now().Add(helloWait))
+	line, err := readLine(conn)
+	if err != nil {
+		s.untrack(conn)
+		return
+	}
+	role, roomID, ok := parseHello(line)
+	if !ok {
+		s.reject(conn, "bad hello")
+		return
+	}
+
+	w := &waiter{conn: conn, pair: make(chan net.Conn, 1)}
+	peer, err := s.pairOrPark(roomID, role, w)
+	if err != nil {
+		s.reject(conn, err.Error())
+		return
+	}
+	if peer != nil {
+		// The peer's handler forwards the pair
+		_ = conn.SetReadDeadline(time.Time{})
+		peer.pair <- conn
+		return
+	}
+
+	wait := s.idleTimeout()
+	if role == roleDial {
+		wait = s.pairTimeout()
+	}
+	// Nothing may arrive before OK, so a read that returns means the
+	// connection closed, broke the protocol or waited too long
+	gone := make(chan struct{})
+	_ = conn.SetReadDeadline(time.Now().Add(wait))
+	go func() {
+		var b [1]byte
+		_, _ = conn.Read(b[:])
+		close(gone)
+	}()
+	select {
+	case other := <-w.pair:
+		_ = conn.SetReadDeadline(time.Now())
+		<-gone
+		_ = conn.SetReadDeadline(time.Time{})
+		s.forward(roomID, conn, other)
+	case <-gone:
+		if s.unpark(roomID, role, w) {
+			if role == roleDial {
+				_, _ = io.WriteString(conn, replyErr+" no sender in this room\n")
+			}
+			s.untrack(conn)
+			return
+		}
+		// Paired as it left: the peer gets closed and retries
+		s.untrack(conn)
+		s.untrack(<-w.pair)
+	}
+}
+
+// parseHello splits "WARP-RELAY/1 <role> <room>"
+func parseHello(line string) (role, roomID string, ok bool) {
+	fields := strings.Fields(line)
+	if len(fields) != 3 || fields[0] != magic || !validRoom(fields[2]) {
+		return "", "", false
+	}
+	if fields[1] != roleServe && fields[1] != roleDial {
+		return "", "", false
+	}
+	return fields[1], fields[2], true
+}
+
+// pairOrPark takes a waiting connection of the other role from the room, or
+// parks w when there is none. It returns the peer taken, if any.
+func (s *Server) pairOrPark(roomID, role string, w *waiter) (*waiter, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.rooms == nil {
+		s.rooms = make(map[string]*room)
+	}
+	r := s.rooms[roomID]
+	if r == nil {
+		r = &room{}
+		s.rooms[roomID] = r
+	}
+	mine, theirs := &r.serve, &r.dial
+	if role == roleDial {
+		mine, theirs = theirs, mine
+	}
+	if len(*theirs) > 0 {
+		peer := (*theirs)[0]
+		*theirs = (*theirs)[1:]
+		s.dropEmpty(roomID, r)
+		return peer, nil
+	}
+	if len(*mine) >= maxWaiting {
+		return nil, fmt.Errorf("room full")
+	}
+	*mine = append(*mine, w)
+	return nil, nil
+}
+
+// unpark removes w from the room. It reports false when w was already taken
+// by a peer.
+func (s *Server) unpark(roomID, role string, w *waiter) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r := s.rooms[roomID]
+	if r == nil {
+		return false
+	}
+	list := &r.serve
+	if role == roleDial {
+		list = &r.dial
+	}
+	for i, x := range *list {
+		if x == w {
+			*list = append((*list)[:i], (*list)[i+1:]...)
+			s.dropEmpty(roomID, r)
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) dropEmpty(roomID string, r *room) {
+	if len(r.serve) == 0 && len(r.dial) == 0 {
+		delete(s.rooms, roomID)
+	}
+}
+
+func (s *Server) reject(conn net.Conn, reason string) {
+	_ = conn.SetWriteDeadline(time.Now().Add(helloWait))
+	_, _ = io.WriteString(conn, replyErr+" "+reason+"\n")
+	s.untrack(conn)
+}
+
+// forward tells both sides they are paired and copies between them until
+// either closes or the pair goes idle
+func (s *Server) forward(roomID string, a, b net.Conn) {
+	defer s.untrack(a)
+	defer s.untrack(b)
+	for _, c := range []net.Conn{a, b} {
+		_ = c.SetWriteDeadline(time.Now().Add(helloWait))
+		if _, err := io.WriteString(c, replyOK+"\n"); err != nil {
+			return
+		}
+		_ = c.SetWriteDeadline(time.Time{})
+	}
+	log := logging.With(zap.String("room", roomID[:8]))
+	log.Info("Relay pair opened")
+	started := time.Now()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	p := &pipe{limiter: s.limiter()}
+	p.touch()
+	var wg sync.WaitGroup
+	for _, dir := range [][2]net.Conn{{a, b}, {b, a}} {
+		wg.Add(1)
+		go func(dst, src net.Conn) {
+			defer wg.Done()
+			defer cancel()
+			p.copy(ctx, dst, src)
+		}(dir[0], dir[1])
+	}
+
+	idle := s.idleTimeout()
+	ticker := time.NewTicker(min(idle/4, time.Second))
+	defer ticker.Stop()
+	reason := "closed"
+loop:
+	for {
+		select {
+		case <-ctx.Done():
+			break loop
+		case <-ticker.C:
+			if p.idleFor() >= idle {
+				reason = "idle"
+				break loop
+			}
+		}
+	}
+	_ = a.Close()
+	_ = b.Close()
+	wg.Wait()
+	log.Info("Relay pair closed", zap.String("reason", reason),
+		zap.Int64("bytes", p.bytes.Load()), zap.Duration("duration", time.Since(started)))
+}
+
+// limiter returns the rate limiter of a new pair, or nil without a cap
+func (s *Server) limiter() *rate.Limiter {
+	if s.RateLimitMbps <= 0 {
+		return nil
+	}
+	bytesPerSecond := s.RateLimitMbps * 1_000_000 / 8
+	return rate.NewLimiter(rate.Limit(bytesPerSecond), max(int(bytesPerSecond/10), copyBufferSize))
+}
+
+// copyBufferSize is the most one read of a pair forwards at once, which the
+// rate limiter's burst must allow
+const copyBufferSize = 32 * 1024
+
+// pipe is the shared state of a pair's two directions
+type pipe struct {
+	limiter  *rate.Limiter
+	bytes    atomic.Int64
+	lastSeen atomic.Int64 // Unix nanoseconds of the last bytes either way
+}
+
+func (p *pipe) touch() { p.lastSeen.Store(time.Now().UnixNano()) }
+
+func (p *pipe) idleFor() time.Duration {
+	return time.Since(time.Unix(0, p.lastSeen.Load()))
+}
+
+func (p *pipe) copy(ctx context.Context, dst, src net.Conn) {
+	buf := make([]byte, copyBufferSize)
+	for {
+		n, err := src.Read(buf)
+		if n > 0 {
+			p.touch()
+			if p.limiter != nil {
+				if p.limiter.WaitN(ctx, n) != nil {
+					return
+				}
+			}
+			if _, werr := dst.Write(buf[:n]); werr != nil {
+				return
+			}
+			p.bytes.Add(int64(n))
+		}
+		if err != nil {
+			return
+		}
+	}
+}
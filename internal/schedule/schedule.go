@@ -0,0 +1,88 @@
+// Package schedule works out when a delayed transfer starts and waits for it.
+package schedule
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrBothSet means both a start time and a delay were given
+var ErrBothSet = errors.New("give a start time or a delay, not both")
+
+// Start returns when a transfer given --start-at at and --start-in in should
+// begin, relative to now. It returns the zero time when neither is set.
+func Start(at, in string, now time.Time) (time.Time, error) {
+	at, in = strings.TrimSpace(at), strings.TrimSpace(in)
+	switch {
+	case at != "" && in != "":
+		return time.Time{}, ErrBothSet
+	case at != "":
+		return ParseClock(at, now)
+	case in != "":
+		d, err := time.ParseDuration(in)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid delay %q: use a duration such as 90s, 45m or 2h", in)
+		}
+		if d <= 0 {
+			return time.Time{}, fmt.Errorf("delay must be positive, got %s", in)
+		}
+		return now.Add(d), nil
+	}
+	return time.Time{}, nil
+}
+
+// ParseClock turns an HH:MM (or HH:MM:SS) wall-clock time into the next time
+// it comes round in now's time zone: today while it's still ahead, else
+// tomorrow. A full RFC 3339 timestamp is taken as is, but must be in the
+// future.
+func ParseClock(s string, now time.Time) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		if !t.After(now) {
+			return time.Time{}, fmt.Errorf("start time %s has already passed", s)
+		}
+		return t, nil
+	}
+
+	var clock time.Time
+	var err error
+	for _, layout := range []string{"15:04", "15:04:05"} {
+		if clock, err = time.Parse(layout, s); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid start time %q: use HH:MM, e.g. 18:00", s)
+	}
+
+	y, m, d := now.Date()
+	t := time.Date(y, m, d, clock.Hour(), clock.Minute(), clock.Second(), 0, now.Location())
+	if !t.After(now) {
+		// time.Date normalizes day d+1, across month and year ends too
+		t = time.Date(y, m, d+1, clock.Hour(), clock.Minute(), clock.Second(), 0, now.Location())
+	}
+	return t, nil
+}
+
+// Wait blocks until at, calling tick with the time left about once a second
+// so callers can show a countdown. It returns ctx's error if ctx ends first.
+func Wait(ctx context.Context, at time.Time, tick func(left time.Duration)) error {
+	for {
+		left := time.Until(at)
+		if left <= 0 {
+			return nil
+		}
+		if tick != nil {
+			tick(left)
+		}
+		timer := time.NewTimer(min(left, time.Second))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
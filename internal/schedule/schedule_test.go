@@ -0,0 +1,108 @@
+package schedule
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseClock(t *testing.T) {
+	loc := time.FixedZone("UTC+7", 7*3600)
+	at := func(month time.Month, day, hour, min, sec int) time.Time {
+		return time.Date(2026, month, day, hour, min, sec, 0, loc)
+	}
+	tests := []struct {
+		name  string
+		clock string
+		now   time.Time
+		want  time.Time
+	}{
+		{"later today", "18:00", at(3, 10, 9, 30, 0), at(3, 10, 18, 0, 0)},
+		{"earlier today is tomorrow", "08:00", at(3, 10, 9, 30, 0), at(3, 11, 8, 0, 0)},
+		{"the current minute is tomorrow", "09:30", at(3, 10, 9, 30, 0), at(3, 11, 9, 30, 0)},
+		{"a second ahead is today", "09:30:01", at(3, 10, 9, 30, 0), at(3, 10, 9, 30, 1)},
+		{"midnight just before it", "00:00", at(3, 10, 23, 59, 59), at(3, 11, 0, 0, 0)},
+		{"midnight just after it", "00:00", at(3, 11, 0, 0, 1), at(3, 12, 0, 0, 0)},
+		{"just past midnight", "00:05", at(3, 11, 0, 1, 0), at(3, 11, 0, 5, 0)},
+		{"late evening from early morning", "23:59", at(3, 11, 0, 1, 0), at(3, 11, 23, 59, 0)},
+		{"across a month end", "06:00", at(3, 31, 22, 0, 0), at(4, 1, 6, 0, 0)},
+		{"across a year end", "06:00", at(12, 31, 22, 0, 0), time.Date(2027, 1, 1, 6, 0, 0, 0, loc)},
+		{"single-digit hour", "9:15", at(3, 10, 8, 0, 0), at(3, 10, 9, 15, 0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseClock(tt.clock, tt.now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !got.Equal(tt.want) || got.Location() != loc {
+				t.Errorf("ParseClock(%q) at %s = %s, want %s", tt.clock, tt.now, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseClockRFC3339(t *testing.T) {
+	now := time.Date(2026, 3, 10, 9, 0, 0, 0, time.UTC)
+	got, err := ParseClock("2026-03-12T18:00:00Z", now)
+	if err != nil || !got.Equal(time.Date(2026, 3, 12, 18, 0, 0, 0, time.UTC)) {
+		t.Errorf("got %s, %v", got, err)
+	}
+	if _, err := ParseClock("2026-03-09T18:00:00Z", now); err == nil || !strings.Contains(err.Error(), "already passed") {
+		t.Errorf("past timestamp: got %v", err)
+	}
+}
+
+func TestParseClockErrors(t *testing.T) {
+	now := time.Date(2026, 3, 10, 9, 0, 0, 0, time.UTC)
+	for _, s := range []string{"", "6pm", "24:00", "18:60", "18", "tomorrow"} {
+		if _, err := ParseClock(s, now); err == nil {
+			t.Errorf("ParseClock(%q) succeeded", s)
+		}
+	}
+}
+
+func TestStart(t *testing.T) {
+	now := time.Date(2026, 3, 10, 9, 0, 0, 0, time.UTC)
+
+	if got, err := Start("", "", now); err != nil || !got.IsZero() {
+		t.Errorf("neither set: got %s, %v", got, err)
+	}
+	if got, err := Start("", "2h", now); err != nil || !got.Equal(now.Add(2*time.Hour)) {
+		t.Errorf("--start-in 2h: got %s, %v", got, err)
+	}
+	if got, err := Start(" 18:00 ", "", now); err != nil || got.Hour() != 18 || got.Day() != 10 {
+		t.Errorf("--start-at 18:00: got %s, %v", got, err)
+	}
+	if _, err := Start("18:00", "2h", now); !errors.Is(err, ErrBothSet) {
+		t.Errorf("both set: got %v", err)
+	}
+	for _, in := range []string{"2", "soon", "0s", "-5m"} {
+		if _, err := Start("", in, now); err == nil {
+			t.Errorf("--start-in %q succeeded", in)
+		}
+	}
+}
+
+func TestWait(t *testing.T) {
+	ticks := 0
+	start := time.Now()
+	if err := Wait(context.Background(), start.Add(50*time.Millisecond), func(time.Duration) { ticks++ }); err != nil {
+		t.Fatal(err)
+	}
+	if time.Since(start) < 50*time.Millisecond || ticks == 0 {
+		t.Errorf("returned after %s with %d ticks", time.Since(start), ticks)
+	}
+
+	if err := Wait(context.Background(), start.Add(-time.Second), nil); err != nil {
+		t.Errorf("past time: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	if err := Wait(ctx, time.Now().Add(time.Hour), nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled wait returned %v", err)
+	}
+}
@@ -0,0 +1,194 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	"go.uber.org/zap"
+
+	"github.com/zulfikawr/warp/internal/protocol"
+	"github.com/zulfikawr/warp/internal/ui"
+)
+
+// appendResult answers an append that was written
+type appendResult struct {
+	Success  bool   `json:"success"`
+	Filename string `json:"filename"`
+	Size     int64  `json:"size"`      // Bytes appended by this request
+	FileSize int64  `json:"file_size"` // Size of the file after it
+}
+
+// appendConflict answers an append whose X-Append-Offset isn't the file's
+// size, so the uploader can send from the right place
+type appendConflict struct {
+	Error string `json:"error"`
+	Size  int64  `json:"size"`
+}
+
+// wantsAppend reports whether a raw upload asks to extend the existing file
+func wantsAppend(r *http.Request) bool {
+	return r.Header.Get(protocol.AppendHeader) == "true"
+}
+
+// pathLock serializes the appends to one path, counting those holding or
+// waiting for it
+type pathLock struct {
+	sync.Mutex
+	refs int
+}
+
+// lockAppend waits for the other appends to path and returns the func that
+// ends this one. The lock is dropped once no append holds or waits for it,
+// so paths appended to once don't pile up.
+func (s *Server) lockAppend(path string) (unlock func()) {
+	s.appendMu.Lock()
+	if s.appendLocks == nil {
+		s.appendLocks = make(map[string]*pathLock)
+	}
+	l := s.appendLocks[path]
+	if l == nil {
+		l = &pathLock{}
+		s.appendLocks[path] = l
+	}
+	l.refs++
+	s.appendMu.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+		s.appendMu.Lock()
+		if l.refs--; l.refs == 0 {
+			delete(s.appendLocks, path)
+		}
+		s.appendMu.Unlock()
+	}
+}
+
+// handleAppend writes the body of a raw upload to the end of the file called
+// name, creating it if needed, instead of saving it under a new unique name.
+// With X-Append-Offset the file must be exactly that long beforehand. A body
+// that doesn't arrive whole is cut off again, so a retry finds the file as it
+// was. An empty append only reports the file's size, 0 when there is no
+// file yet, and creates nothing.
+func (s *Server) handleAppend(w http.ResponseWriter, r *http.Request, log *zap.Logger, transferID, name string) {
+	setNoCache(w.Header())
+	expected := int64(-1)
+	if v := r.Header.Get(protocol.AppendOffsetHeader); v != "" {
+		off, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || off < 0 {
+			http.Error(w, "invalid append offset", http.StatusBadRequest)
+			return
+		}
+		expected = off
+	}
+
+	probe := r.ContentLength == 0
+	dir, rel := s.uploadDir(r)
+	if !probe {
+		if err := s.mkdirUpload(dir); err != nil {
+			log.Error("Failed to create upload directory", zap.String("dir", rel), zap.Error(err))
+			http.Error(w, "server error", http.StatusInternalServerError)
+			return
+		}
+	}
+	outPath := filepath.Join(dir, name)
+	filename := relPath(rel, name)
+
+	defer s.lockAppend(outPath)()
+
+	flags := os.O_WRONLY | os.O_APPEND
+	if !probe {
+		flags |= os.O_CREATE
+	}
+	var start int64
+	f, err := os.OpenFile(outPath, flags, 0o600)
+	switch {
+	case probe && errors.Is(err, os.ErrNotExist):
+		// Nothing to append to yet
+	case err != nil:
+		log.Error("Failed to open file", zap.String("filename", filename), zap.Error(err))
+		http.Error(w, "disk error", http.StatusInternalServerError)
+		return
+	default:
+		defer func() { _ = f.Close() }()
+		fi, err := f.Stat()
+		if err != nil {
+			log.Error("Failed to stat file", zap.String("filename", filename), zap.Error(err))
+			http.Error(w, "disk error", http.StatusInternalServerError)
+			return
+		}
+		start = fi.Size()
+	}
+
+	if expected >= 0 && expected != start {
+		log.Warn("Append offset mismatch", zap.String("filename", filename),
+			zap.Int64("expected_offset", expected), zap.Int64("file_size", start))
+		w.Header().Set("Content-Type", jsonContentType)
+		w.WriteHeader(http.StatusConflict)
+		_ = json.NewEncoder(w).Encode(appendConflict{
+			Error: fmt.Sprintf("append offset %d does not match the file size %d", expected, start),
+			Size:  start,
+		})
+		return
+	}
+	if !s.checkUploadLimits(w, name, start+r.ContentLength) {
+		log.Warn("Append rejected by limits", zap.String("filename", filename), zap.Int64("size", start+r.ContentLength))
+		return
+	}
+	if probe {
+		w.Header().Set("Content-Type", jsonContentType)
+		_ = json.NewEncoder(w).Encode(appendResult{Success: true, Filename: filename, FileSize: start})
+		return
+	}
+
+	release, err := s.reserveDisk(dir, r.ContentLength)
+	if err != nil {
+		log.Warn("Disk space check failed", zap.Error(err))
+		http.Error(w, "insufficient disk space", http.StatusInsufficientStorage)
+		return
+	}
+	defer release()
+
+	log.Info("Appending to file", zap.String("filename", filename),
+		zap.String("size", ui.FormatBytes(r.ContentLength)), zap.Int64("offset", start))
+	pt := s.trackTransfer(transferID, filename, protocol.DirectionUpload, r.ContentLength, s.clientIP(r))
+	completed := false
+	defer func() {
+		if completed {
+			s.finishUpload(transferID, outPath)
+		} else {
+			s.finishTransfer(transferID, false)
+		}
+	}()
+
+	n, err := io.Copy(f, &progressReader{r: io.LimitReader(r.Body, r.ContentLength), pt: pt})
+	if err == nil && n < r.ContentLength {
+		err = io.ErrUnexpectedEOF
+	}
+	if err == nil {
+		err = s.SyncPolicy.finishFile(f)
+	}
+	if err != nil {
+		log.Error("Append failed", zap.String("filename", filename), zap.Int64("received", n), zap.Error(err))
+		if terr := f.Truncate(start); terr != nil {
+			log.Error("Failed to undo partial append", zap.String("filename", filename), zap.Error(terr))
+		}
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			http.Error(w, "incomplete body", http.StatusBadRequest)
+			return
+		}
+		http.Error(w, "write error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", jsonContentType)
+	_ = json.NewEncoder(w).Encode(appendResult{Success: true, Filename: filename, Size: n, FileSize: start + n})
+	completed = true
+}
@@ -0,0 +1,193 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/zulfikawr/warp/internal/crypto"
+	"github.com/zulfikawr/warp/internal/protocol"
+)
+
+// appendServer runs a host-mode server over a temp dir
+func appendServer(t *testing.T, allow bool) (*Server, *httptest.Server) {
+	t.Helper()
+	tok, _ := crypto.GenerateToken(nil)
+	s := &Server{Token: tok, HostMode: true, UploadDir: t.TempDir(), AllowAppend: allow}
+	ts := httptest.NewServer(s.routes())
+	t.Cleanup(ts.Close)
+	return s, ts
+}
+
+// sendAppend appends body to name, expecting the file at offset unless it is
+// negative, and returns the status and response body
+func sendAppend(t *testing.T, s *Server, ts *httptest.Server, name, body string, offset int64) (int, []byte) {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodPost, ts.URL+protocol.UploadPathPrefix+s.Token, bytes.NewReader([]byte(body)))
+	req.Header.Set("X-File-Name", name)
+	req.Header.Set(protocol.AppendHeader, "true")
+	if offset >= 0 {
+		req.Header.Set(protocol.AppendOffsetHeader, strconv.FormatInt(offset, 10))
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	out, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, out
+}
+
+func TestAppendExtendsFile(t *testing.T) {
+	s, ts := appendServer(t, true)
+	path := filepath.Join(s.UploadDir, "app.log")
+
+	if status, body := sendAppend(t, s, ts, "app.log", "line 1\n", 0); status != http.StatusOK {
+		t.Fatalf("first append: status %d: %s", status, body)
+	}
+	status, body := sendAppend(t, s, ts, "app.log", "line 2\n", 7)
+	if status != http.StatusOK {
+		t.Fatalf("second append: status %d: %s", status, body)
+	}
+	var res appendResult
+	if err := json.Unmarshal(body, &res); err != nil {
+		t.Fatal(err)
+	}
+	if res.Filename != "app.log" || res.Size != 7 || res.FileSize != 14 {
+		t.Errorf("result = %+v, want app.log, 7 appended, 14 total", res)
+	}
+	// Without an offset the body goes to the end as well
+	if status, body := sendAppend(t, s, ts, "app.log", "line 3\n", -1); status != http.StatusOK {
+		t.Fatalf("append without offset: status %d: %s", status, body)
+	}
+
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "line 1\nline 2\nline 3\n" {
+		t.Errorf("file = %q", got)
+	}
+	if entries, _ := os.ReadDir(s.UploadDir); len(entries) != 1 {
+		t.Errorf("%d files in the upload directory, want app.log alone", len(entries))
+	}
+}
+
+func TestConcurrentAppendsDropTheirLock(t *testing.T) {
+	s, ts := appendServer(t, true)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if status, body := sendAppend(t, s, ts, "app.log", "line\n", -1); status != http.StatusOK {
+				t.Errorf("append: status %d: %s", status, body)
+			}
+		}()
+	}
+	wg.Wait()
+
+	got, err := os.ReadFile(filepath.Join(s.UploadDir, "app.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 8*len("line\n") {
+		t.Errorf("file is %d bytes, want every append whole", len(got))
+	}
+	s.appendMu.Lock()
+	defer s.appendMu.Unlock()
+	if len(s.appendLocks) != 0 {
+		t.Errorf("%d append locks left after the appends finished", len(s.appendLocks))
+	}
+}
+
+func TestAppendProbe(t *testing.T) {
+	s, ts := appendServer(t, true)
+	probe := func() appendResult {
+		t.Helper()
+		status, body := sendAppend(t, s, ts, "app.log", "", -1)
+		if status != http.StatusOK {
+			t.Fatalf("probe: status %d: %s", status, body)
+		}
+		var res appendResult
+		if err := json.Unmarshal(body, &res); err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+
+	if res := probe(); res.FileSize != 0 {
+		t.Errorf("probe of a missing file = %+v, want size 0", res)
+	}
+	if _, err := os.Stat(filepath.Join(s.UploadDir, "app.log")); !os.IsNotExist(err) {
+		t.Errorf("probe created the file: %v", err)
+	}
+	if status, body := sendAppend(t, s, ts, "app.log", "line 1\n", 0); status != http.StatusOK {
+		t.Fatalf("append: status %d: %s", status, body)
+	}
+	if res := probe(); res.FileSize != 7 {
+		t.Errorf("probe = %+v, want size 7", res)
+	}
+}
+
+func TestAppendOffsetMismatch(t *testing.T) {
+	s, ts := appendServer(t, true)
+	if status, body := sendAppend(t, s, ts, "app.log", "0123456789", 0); status != http.StatusOK {
+		t.Fatalf("first append: status %d: %s", status, body)
+	}
+
+	for _, offset := range []int64{4, 12} {
+		status, body := sendAppend(t, s, ts, "app.log", "gap", offset)
+		if status != http.StatusConflict {
+			t.Fatalf("offset %d: status %d, want 409", offset, status)
+		}
+		var conflict appendConflict
+		if err := json.Unmarshal(body, &conflict); err != nil {
+			t.Fatalf("offset %d: %v in %s", offset, err, body)
+		}
+		if conflict.Size != 10 || conflict.Error == "" {
+			t.Errorf("offset %d: conflict = %+v, want size 10", offset, conflict)
+		}
+	}
+	if got, _ := os.ReadFile(filepath.Join(s.UploadDir, "app.log")); string(got) != "0123456789" {
+		t.Errorf("file = %q after refused appends", got)
+	}
+}
+
+func TestAppendRefused(t *testing.T) {
+	t.Run("flag off", func(t *testing.T) {
+		s, ts := appendServer(t, false)
+		if err := os.WriteFile(filepath.Join(s.UploadDir, "app.log"), []byte("old"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if status, _ := sendAppend(t, s, ts, "app.log", "new", 3); status != http.StatusBadRequest {
+			t.Fatalf("status %d, want 400", status)
+		}
+		if entries, _ := os.ReadDir(s.UploadDir); len(entries) != 1 {
+			t.Errorf("%d files in the upload directory, want the original alone", len(entries))
+		}
+	})
+	t.Run("chunked", func(t *testing.T) {
+		s, ts := appendServer(t, true)
+		req, _ := http.NewRequest(http.MethodPost, ts.URL+protocol.UploadPathPrefix+s.Token, bytes.NewReader([]byte("data")))
+		req.Header.Set("X-File-Name", "app.log")
+		req.Header.Set(protocol.AppendHeader, "true")
+		req.Header.Set("X-Upload-Offset", "0")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Fatalf("status %d, want 400", resp.StatusCode)
+		}
+	})
+}
@@ -0,0 +1,46 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/zulfikawr/warp/internal/crypto"
+	"github.com/zulfikawr/warp/internal/protocol"
+)
+
+// basicAuthRealm is sent in the WWW-Authenticate challenge
+const basicAuthRealm = `Basic realm="warp", charset="UTF-8"`
+
+// basicAuthEnabled reports whether token paths require HTTP Basic auth
+func (s *Server) basicAuthEnabled() bool {
+	return s.BasicAuthUser != "" || s.BasicAuthPassword != ""
+}
+
+// requireBasicAuth wraps a token-path handler with HTTP Basic auth when it is
+// configured. Browsers prompt natively on the 401 challenge. Remote stop
+// requests carry their own secret and are let through.
+func (s *Server) requireBasicAuth(next http.HandlerFunc) http.HandlerFunc {
+	if !s.basicAuthEnabled() {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, _, rest, err := protocol.ParseSharePath(r.URL.EscapedPath()); r.Method == http.MethodPost && err == nil && rest == protocol.StopPathSuffix {
+			next(w, r)
+			return
+		}
+		if !s.checkBasicAuth(r) {
+			w.Header().Set("WWW-Authenticate", basicAuthRealm)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// checkBasicAuth compares the request's credentials in constant time. Both
+// halves are always compared so timing doesn't reveal which one was wrong.
+func (s *Server) checkBasicAuth(r *http.Request) bool {
+	user, pass, ok := r.BasicAuth()
+	userOK := crypto.TokenEqual(user, s.BasicAuthUser)
+	passOK := crypto.TokenEqual(pass, s.BasicAuthPassword)
+	return ok && userOK && passOK
+}
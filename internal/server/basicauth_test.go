@@ -0,0 +1,87 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/zulfikawr/warp/internal/crypto"
+	"github.com/zulfikawr/warp/internal/protocol"
+)
+
+func TestBasicAuth(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "file.txt")
+	if err := os.WriteFile(path, []byte("hello"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tok, _ := crypto.GenerateToken(nil)
+	s := &Server{Token: tok, SrcPath: path, BasicAuthUser: "guest", BasicAuthPassword: "correct-horse", Password: "different-encryption-pass"}
+	ts := httptest.NewServer(s.routes())
+	defer ts.Close()
+	url := ts.URL + protocol.PathPrefix + tok
+
+	tests := []struct {
+		name       string
+		user, pass string
+		setAuth    bool
+		wantStatus int
+	}{
+		{"challenge without credentials", "", "", false, http.StatusUnauthorized},
+		{"wrong password", "guest", "wrong", true, http.StatusUnauthorized},
+		{"wrong user", "admin", "correct-horse", true, http.StatusUnauthorized},
+		{"encryption password is not accepted", "guest", "different-encryption-pass", true, http.StatusUnauthorized},
+		{"correct credentials", "guest", "correct-horse", true, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodGet, url, nil)
+			if tt.setAuth {
+				req.SetBasicAuth(tt.user, tt.pass)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_ = resp.Body.Close()
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			challenge := resp.Header.Get("WWW-Authenticate")
+			if tt.wantStatus == http.StatusUnauthorized && challenge != basicAuthRealm {
+				t.Errorf("WWW-Authenticate = %q, want %q", challenge, basicAuthRealm)
+			}
+			if tt.wantStatus == http.StatusOK && challenge != "" {
+				t.Errorf("unexpected challenge on success: %q", challenge)
+			}
+		})
+	}
+
+	// Health stays open for monitoring
+	resp, err := http.Get(ts.URL + "/health")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("/health status = %d, want 200", resp.StatusCode)
+	}
+}
+
+func TestBasicAuthProtectsUploads(t *testing.T) {
+	tok, _ := crypto.GenerateToken(nil)
+	s := &Server{Token: tok, HostMode: true, UploadDir: t.TempDir(), BasicAuthUser: "guest", BasicAuthPassword: "pw"}
+	ts := httptest.NewServer(s.routes())
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + protocol.UploadPathPrefix + tok)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("upload page status = %d, want 401", resp.StatusCode)
+	}
+}
@@ -28,6 +28,34 @@ type checksumCacheEntry struct {
 	checksum string
 	modTime  time.Time
 	size     int64
+	hashedAt time.Time // When hashing started
+}
+
+// DefaultMtimeGranularity is the MtimeGranularity used when it is 0: FAT
+// stores modification times in 2 second steps
+const DefaultMtimeGranularity = 2 * time.Second
+
+// mtimeGranularity is how coarse modification times may be
+func (s *Server) mtimeGranularity() time.Duration {
+	if s.MtimeGranularity > 0 {
+		return s.MtimeGranularity
+	}
+	return DefaultMtimeGranularity
+}
+
+// racy reports whether the file may have changed after it was hashed without
+// its size or modification time showing it: the hash started within one
+// granularity step of the mtime, so a later write in the same step leaves the
+// mtime as it was. A hash taken once the step is over settles it.
+func (e *checksumCacheEntry) racy(granularity time.Duration) bool {
+	return e.hashedAt.Sub(e.modTime) < granularity
+}
+
+// compressionCacheEntry caches a compression decision with validation metadata
+type compressionCacheEntry struct {
+	decision compressionDecision
+	modTime  time.Time
+	size     int64
 }
 
 // Buffer pools for different file sizes to reduce allocations
@@ -68,6 +96,14 @@ func getBuffer(size int) *[]byte {
 	return pool.Get().(*[]byte)
 }
 
+// bufferSize caps a pool tier at LowMemoryBufferSize in low-memory mode
+func (s *Server) bufferSize(size int) int {
+	if s.LowMemory && size > LowMemoryBufferSize {
+		return LowMemoryBufferSize
+	}
+	return size
+}
+
 // putBuffer returns a buffer to the appropriate pool
 func putBuffer(buf *[]byte) {
 	size := len(*buf)
@@ -78,7 +114,7 @@ func putBuffer(buf *[]byte) {
 }
 
 // computeFileChecksum calculates SHA256 hash of a file
-func computeFileChecksum(filePath string) (string, error) {
+func computeFileChecksum(filePath string, bufSize int) (string, error) {
 	f, err := os.Open(filePath)
 	if err != nil {
 		return "", fmt.Errorf("failed to open file for checksum: %w", err)
@@ -86,7 +122,6 @@ func computeFileChecksum(filePath string) (string, error) {
 	defer func() { _ = f.Close() }()
 
 	hash := sha256.New()
-	bufSize := 1048576 // 1MB buffer for checksum computation
 	buf := getBuffer(bufSize)
 	defer putBuffer(buf)
 
@@ -108,13 +143,14 @@ func (s *Server) getCachedChecksum(path string) (string, error) {
 	if val, ok := s.checksumCache.Load(path); ok {
 		entry := val.(*checksumCacheEntry)
 		// Verify file hasn't changed
-		if entry.modTime.Equal(fi.ModTime()) && entry.size == fi.Size() {
+		if entry.modTime.Equal(fi.ModTime()) && entry.size == fi.Size() && !entry.racy(s.mtimeGranularity()) {
 			return entry.checksum, nil
 		}
 	}
 
 	// Compute checksum
-	checksum, err := computeFileChecksum(path)
+	hashedAt := s.now()
+	checksum, err := computeFileChecksum(path, s.bufferSize(protocol.BufferSizeLarge))
 	if err != nil {
 		return "", fmt.Errorf("checksum computation failed: %w", err)
 	}
@@ -124,11 +160,27 @@ func (s *Server) getCachedChecksum(path string) (string, error) {
 		checksum: checksum,
 		modTime:  fi.ModTime(),
 		size:     fi.Size(),
+		hashedAt: hashedAt,
 	})
 
 	return checksum, nil
 }
 
+// WarmChecksum computes the checksum of a single-file share now, so the first
+// download doesn't wait for it. Text, directory and multi-file shares have
+// none to compute.
+func (s *Server) WarmChecksum() error {
+	if s.SrcPath == "" || len(s.SrcFiles) > 0 {
+		return nil
+	}
+	fi, err := os.Stat(s.SrcPath)
+	if err != nil || fi.IsDir() {
+		return err
+	}
+	_, err = s.getCachedChecksum(s.SrcPath)
+	return err
+}
+
 // isCompressible checks if the file extension indicates compressible content
 func isCompressible(path string) bool {
 	ext := strings.ToLower(filepath.Ext(path))
@@ -143,3 +195,20 @@ func isCompressible(path string) bool {
 	}
 	return false
 }
+
+// isPrecompressed checks if the file extension indicates content that is
+// already compressed, where another pass only costs CPU
+func isPrecompressed(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	precompressed := []string{
+		".zip", ".gz", ".tgz", ".bz2", ".xz", ".zst", ".7z", ".rar",
+		".jpg", ".jpeg", ".png", ".gif", ".webp", ".heic", ".avif",
+		".mp3", ".aac", ".ogg", ".flac", ".mp4", ".mkv", ".mov", ".webm", ".avi",
+	}
+	for _, c := range precompressed {
+		if ext == c {
+			return true
+		}
+	}
+	return false
+}
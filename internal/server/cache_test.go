@@ -0,0 +1,61 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestChecksumSameMtimeStep rewrites a file without changing its size or
+// mtime, as a write within one step of a coarse filesystem clock would
+func TestChecksumSameMtimeStep(t *testing.T) {
+	mtime := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name        string
+		granularity time.Duration
+		hashAfter   time.Duration // Hash this long after the mtime
+		wantRehash  bool
+	}{
+		{"same step", 0, 500 * time.Millisecond, true},
+		{"step over", 0, 10 * time.Second, false},
+		{"custom granularity", 30 * time.Second, 10 * time.Second, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "file.txt")
+			write := func(content string) {
+				t.Helper()
+				if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.Chtimes(path, mtime, mtime); err != nil {
+					t.Fatal(err)
+				}
+			}
+			now := mtime.Add(tt.hashAfter)
+			s := &Server{MtimeGranularity: tt.granularity, clock: func() time.Time { return now }}
+
+			write("version 1")
+			first, err := s.getCachedChecksum(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			write("version 2")
+			now = now.Add(time.Minute)
+			second, err := s.getCachedChecksum(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if rehashed := second != first; rehashed != tt.wantRehash {
+				t.Errorf("rehashed = %v, want %v", rehashed, tt.wantRehash)
+			}
+
+			// Once hashed after the step, the entry is trusted
+			entry, _ := s.checksumCache.Load(path)
+			if tt.wantRehash && entry.(*checksumCacheEntry).racy(s.mtimeGranularity()) {
+				t.Error("entry hashed a minute later is still racy")
+			}
+		})
+	}
+}
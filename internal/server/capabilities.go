@@ -0,0 +1,146 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/zulfikawr/warp/internal/protocol"
+)
+
+// handleManifest advertises upload capabilities: recommended chunk size and
+// concurrency, supported features, limits and free disk space. chunk_size and
+// max_concurrent stay at the top level for the browser upload page.
+func (s *Server) handleManifest(w http.ResponseWriter, r *http.Request) {
+	dest := s.UploadDir
+	if dest == "" {
+		dest = "."
+	}
+	features := []string{
+		protocol.FeatureParallelChunks,
+		protocol.FeatureRawStream,
+		protocol.FeatureResume,
+		protocol.FeatureVerify,
+		protocol.FeatureSessionStatus,
+	}
+	if s.Password != "" {
+		features = append(features, protocol.FeatureEncryption)
+	}
+	if s.uploadKey() != nil {
+		features = append(features, protocol.FeatureEncryptedChunks)
+	}
+
+	// Every chunk request takes a transfer slot, so more workers than slots
+	// only earns 503s
+	workers := ManifestMaxConcurrent
+	if s.MaxTransfers > 0 && s.MaxTransfers < workers {
+		workers = s.MaxTransfers
+	}
+	if s.LowMemory {
+		workers = 1
+	}
+
+	writeCapabilities(w, protocol.Capabilities{
+		Version:       protocol.Version,
+		Mode:          "host",
+		ChunkSize:     ManifestChunkSize,
+		MaxConcurrent: workers,
+		Features:      features,
+		Limits:        s.uploadLimits(),
+		FreeSpace:     s.availableSpace(dest),
+		RecentSpeed:   int64(s.uploadRate.rate()),
+	})
+}
+
+// handleInfo describes the share and what the sender supports for downloads
+func (s *Server) handleInfo(w http.ResponseWriter, r *http.Request) {
+	caps := protocol.Capabilities{
+		Version:  protocol.Version,
+		Mode:     "send",
+		Features: []string{},
+		Limits:   protocol.Limits{MaxConcurrent: s.MaxTransfers},
+	}
+	if s.Password != "" {
+		caps.Features = append(caps.Features, protocol.FeatureEncryption)
+	}
+
+	switch fi, err := os.Stat(s.SrcPath); {
+	case s.TextContent != "":
+		caps.Name, caps.Size = "text", int64(len(s.TextContent))
+	case err != nil:
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	case fi.IsDir():
+		// Zipped on the fly: size unknown, no ranges
+		caps.Name = s.archiveName()
+		if !s.LowMemory {
+			caps.Features = append(caps.Features, protocol.FeatureCompression)
+		}
+		if s.mirrorable() {
+			caps.Features = append(caps.Features, protocol.FeatureMirror)
+			if s.Media {
+				caps.Features = append(caps.Features, protocol.FeaturePlaylist)
+			}
+		}
+	case s.Follow:
+		// Still growing: no size and no ranges
+		caps.Name = fi.Name()
+		caps.Features = append(caps.Features, protocol.FeatureFollow)
+	default:
+		caps.Name, caps.Size = fi.Name(), fi.Size()
+		// The same checksum downloads carry, cached after the first hash
+		if sum, err := s.checksumFor(fi); err == nil {
+			caps.SHA256 = sum
+		}
+		if s.Password == "" && !s.ServeAsText {
+			caps.Features = append(caps.Features, protocol.FeatureResume)
+		}
+	}
+	caps.EstimatedSeconds = s.downloadRate.estimateSeconds(caps.Size)
+
+	writeCapabilities(w, caps)
+}
+
+// uploadLimits reports the limits enforced on uploads: the configured Limits
+// over protocol.DefaultLimits, plus the per-file limits
+func (s *Server) uploadLimits() protocol.Limits {
+	l := protocol.DefaultLimits()
+	if s.Limits.MaxChunks > 0 {
+		l.MaxChunks = s.Limits.MaxChunks
+	}
+	if s.Limits.MaxChunkSize > 0 {
+		l.MaxChunkSize = s.Limits.MaxChunkSize
+	}
+	if s.Limits.MaxTotalSize > 0 {
+		l.MaxTotalSize = s.Limits.MaxTotalSize
+	}
+	if s.Limits.MaxSessionIdleTime > 0 {
+		l.MaxSessionIdleTime = s.Limits.MaxSessionIdleTime
+	}
+	l.MaxFileSize = s.MaxFileSize
+	l.AllowedExtensions = s.AllowedExtensions
+	l.MaxConcurrent = s.MaxTransfers
+	return l
+}
+
+// checkUploadLimits rejects a file that breaks the per-file limits, writing
+// the error response. size < 0 skips the size check.
+func (s *Server) checkUploadLimits(w http.ResponseWriter, name string, size int64) bool {
+	limits := s.uploadLimits()
+	if !limits.ExtensionAllowed(name) {
+		http.Error(w, "file type not allowed (accepted: "+strings.Join(limits.AllowedExtensions, ", ")+")", http.StatusUnsupportedMediaType)
+		return false
+	}
+	if limits.MaxFileSize > 0 && size > limits.MaxFileSize {
+		http.Error(w, "file too large", http.StatusRequestEntityTooLarge)
+		return false
+	}
+	return true
+}
+
+func writeCapabilities(w http.ResponseWriter, caps protocol.Capabilities) {
+	w.Header().Set("Content-Type", jsonContentType)
+	setNoCache(w.Header())
+	_ = json.NewEncoder(w).Encode(caps)
+}
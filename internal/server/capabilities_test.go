@@ -0,0 +1,234 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zulfikawr/warp/internal/crypto"
+	"github.com/zulfikawr/warp/internal/protocol"
+)
+
+func getCapabilities(t *testing.T, u string) protocol.Capabilities {
+	t.Helper()
+	resp, err := http.Get(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET %s: status %d", u, resp.StatusCode)
+	}
+	var caps protocol.Capabilities
+	if err := json.NewDecoder(resp.Body).Decode(&caps); err != nil {
+		t.Fatal(err)
+	}
+	return caps
+}
+
+func TestManifestCapabilities(t *testing.T) {
+	tok, _ := crypto.GenerateToken(nil)
+	s := &Server{
+		Token:             tok,
+		HostMode:          true,
+		UploadDir:         t.TempDir(),
+		MaxTransfers:      2,
+		MaxFileSize:       1 << 20,
+		AllowedExtensions: []string{".jpg", ".png"},
+	}
+	ts := httptest.NewServer(s.routes())
+	defer ts.Close()
+
+	caps := getCapabilities(t, ts.URL+protocol.UploadPathPrefix+tok+protocol.ManifestPathSuffix)
+	if caps.Version != protocol.Version || caps.Mode != "host" {
+		t.Errorf("version/mode = %q/%q", caps.Version, caps.Mode)
+	}
+	if caps.ChunkSize != ManifestChunkSize {
+		t.Errorf("chunk_size = %d, want %d", caps.ChunkSize, ManifestChunkSize)
+	}
+	if caps.MaxConcurrent != 2 {
+		t.Errorf("max_concurrent = %d, want it capped at --max-transfers (2)", caps.MaxConcurrent)
+	}
+	for _, f := range []string{protocol.FeatureParallelChunks, protocol.FeatureRawStream, protocol.FeatureVerify} {
+		if !caps.Has(f) {
+			t.Errorf("missing feature %s in %v", f, caps.Features)
+		}
+	}
+	if caps.Has(protocol.FeatureEncryption) {
+		t.Error("encryption advertised without a password")
+	}
+	want := protocol.DefaultLimits()
+	want.MaxFileSize, want.AllowedExtensions, want.MaxConcurrent = 1<<20, []string{".jpg", ".png"}, 2
+	if !reflect.DeepEqual(caps.Limits, want) {
+		t.Errorf("limits = %+v, want %+v", caps.Limits, want)
+	}
+}
+
+func TestInfoEndpoint(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "report.pdf")
+	if err := os.WriteFile(path, []byte("hello"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tok, _ := crypto.GenerateToken(nil)
+	s := &Server{Token: tok, SrcPath: path}
+	ts := httptest.NewServer(s.routes())
+	defer ts.Close()
+
+	caps := getCapabilities(t, ts.URL+protocol.PathPrefix+tok+protocol.InfoPathSuffix)
+	if caps.Mode != "send" || caps.Name != "report.pdf" || caps.Size != 5 {
+		t.Errorf("unexpected info %+v", caps)
+	}
+	// SHA256 of "hello"
+	if want := "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"; caps.SHA256 != want {
+		t.Errorf("sha256 = %q, want %q", caps.SHA256, want)
+	}
+	if !caps.Has(protocol.FeatureResume) {
+		t.Errorf("unencrypted file should advertise resume, got %v", caps.Features)
+	}
+
+	resp, err := http.Get(ts.URL + protocol.PathPrefix + "wrong" + protocol.InfoPathSuffix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("wrong token: status %d, want 403", resp.StatusCode)
+	}
+}
+
+func TestUploadLimitsEnforced(t *testing.T) {
+	dir := t.TempDir()
+	tok, _ := crypto.GenerateToken(nil)
+	s := &Server{Token: tok, HostMode: true, UploadDir: dir, MaxFileSize: 8, AllowedExtensions: []string{".txt"}}
+	ts := httptest.NewServer(s.routes())
+	defer ts.Close()
+
+	tests := []struct {
+		name string
+		file string
+		body string
+		want int
+	}{
+		{"allowed", "ok.txt", "1234", http.StatusOK},
+		{"wrong extension", "evil.exe", "1234", http.StatusUnsupportedMediaType},
+		{"too large", "big.txt", "0123456789", http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodPost, ts.URL+protocol.UploadPathPrefix+tok, bytes.NewReader([]byte(tt.body)))
+			req.Header.Set("X-File-Name", url.QueryEscape(tt.file))
+			req.Header.Set("Content-Length", strconv.Itoa(len(tt.body)))
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_ = resp.Body.Close()
+			if resp.StatusCode != tt.want {
+				t.Fatalf("status %d, want %d", resp.StatusCode, tt.want)
+			}
+			_, err = os.Stat(filepath.Join(dir, tt.file))
+			if saved := err == nil; saved != (tt.want == http.StatusOK) {
+				t.Errorf("file saved = %v", saved)
+			}
+		})
+	}
+}
+
+func TestConfiguredChunkLimits(t *testing.T) {
+	tok, _ := crypto.GenerateToken(nil)
+	s := &Server{Token: tok, HostMode: true, UploadDir: t.TempDir(), Limits: protocol.Limits{
+		MaxChunks: 4, MaxTotalSize: 1 << 20, MaxSessionIdleTime: 5 * time.Minute,
+	}}
+	ts := httptest.NewServer(s.routes())
+	defer ts.Close()
+
+	caps := getCapabilities(t, ts.URL+protocol.UploadPathPrefix+tok+protocol.ManifestPathSuffix)
+	l := caps.Limits
+	if l.Version != protocol.ValidationVersion || l.MaxChunks != 4 || l.MaxTotalSize != 1<<20 ||
+		l.MaxSessionIdleTime != 5*time.Minute || l.MaxChunkSize != protocol.DefaultMaxChunkSize {
+		t.Errorf("limits = %+v, want the configured ones over the defaults", l)
+	}
+
+	post := func(total, chunkID string, size int) (int, string) {
+		req, _ := http.NewRequest(http.MethodPost, ts.URL+protocol.UploadPathPrefix+tok, bytes.NewReader(make([]byte, size)))
+		req.Header.Set("X-File-Name", "data.bin")
+		req.Header.Set("X-Upload-Session", "limits-session-1")
+		req.Header.Set("X-Upload-Offset", "0")
+		req.Header.Set("X-Upload-Total", strconv.Itoa(size))
+		req.Header.Set("X-Chunk-Id", chunkID)
+		req.Header.Set("X-Chunk-Total", total)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = resp.Body.Close() }()
+		var body bytes.Buffer
+		_, _ = body.ReadFrom(resp.Body)
+		return resp.StatusCode, body.String()
+	}
+	if code, body := post("5", "0", 10); code != http.StatusBadRequest || !strings.Contains(body, "total chunks too large: 5 (max: 4)") {
+		t.Errorf("5 chunks: %d %q, want 400 naming the limit", code, body)
+	}
+	if code, body := post("1", "0", 2<<20); code != http.StatusRequestEntityTooLarge || !strings.Contains(body, "(max: 1048576)") {
+		t.Errorf("2MB upload: %d %q, want 413 naming the limit", code, body)
+	}
+	if code, _ := post("4", "3", 10); code == http.StatusBadRequest {
+		t.Error("a chunk count at the limit was rejected")
+	}
+}
+
+func TestLowMemoryCapabilities(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "notes.txt"), bytes.Repeat([]byte("warp "), 4096), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tok, _ := crypto.GenerateToken(nil)
+	s := &Server{Token: tok, HostMode: true, UploadDir: dir, SrcPath: dir, LowMemory: true}
+	ts := httptest.NewServer(s.routes())
+	defer ts.Close()
+
+	caps := getCapabilities(t, ts.URL+protocol.UploadPathPrefix+tok+protocol.ManifestPathSuffix)
+	if caps.MaxConcurrent != 1 {
+		t.Errorf("max_concurrent = %d, want 1 in low-memory mode", caps.MaxConcurrent)
+	}
+
+	// A shared directory would be zipped and compressed on the fly
+	s = &Server{Token: tok, SrcPath: dir, LowMemory: true}
+	ts = httptest.NewServer(s.routes())
+	defer ts.Close()
+	caps = getCapabilities(t, ts.URL+protocol.PathPrefix+tok+protocol.InfoPathSuffix)
+	if caps.Has(protocol.FeatureCompression) {
+		t.Errorf("compression advertised in low-memory mode: %v", caps.Features)
+	}
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+protocol.PathPrefix+tok, nil)
+	req.Header.Set("Accept-Encoding", "zstd, gzip")
+	resp, err := http.DefaultTransport.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if enc := resp.Header.Get("Content-Encoding"); enc != "" {
+		t.Errorf("Content-Encoding = %q, want identity", enc)
+	}
+
+	fi, err := os.Stat(filepath.Join(dir, "notes.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := s.compressionFor(filepath.Join(dir, "notes.txt"), fi); d.compress {
+		t.Errorf("compression decision = %s, want none", d.describe("zstd"))
+	}
+	if got := s.bufferSize(protocol.BufferSizeVeryLarge); got != LowMemoryBufferSize {
+		t.Errorf("bufferSize(4MB) = %d, want %d", got, LowMemoryBufferSize)
+	}
+}
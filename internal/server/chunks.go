@@ -1,28 +1,34 @@
 package server
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
-	"path/filepath"
 	"strconv"
 	"time"
 
-	"github.com/zulfikawr/warp/internal/logging"
+	"github.com/zulfikawr/warp/internal/crypto"
 	"github.com/zulfikawr/warp/internal/metrics"
+	"github.com/zulfikawr/warp/internal/protocol"
+	"github.com/zulfikawr/warp/internal/ui"
 	"go.uber.org/zap"
 )
 
+// errShortChunk means a chunk body ended before its Content-Length
+var errShortChunk = errors.New("chunk body ended early")
+
 // handleParallelChunk processes a single chunk in a parallel upload session
-func (s *Server) handleParallelChunk(w http.ResponseWriter, r *http.Request, filename, sessionID, chunkIDStr, chunkTotalStr, offsetStr, dest string) {
+func (s *Server) handleParallelChunk(w http.ResponseWriter, r *http.Request, log *zap.Logger, filename, sessionID, chunkIDStr, chunkTotalStr, offsetStr, dest, rel string) {
 	chunkStartTime := time.Now()
 	metrics.ParallelUploadWorkers.Inc()
 	defer metrics.ParallelUploadWorkers.Dec()
 
 	// Validate session ID
-	if err := ValidateSessionID(sessionID); err != nil {
-		logging.Warn("Invalid session ID", zap.String("session_id", sessionID), zap.Error(err))
+	if err := protocol.ValidateSessionID(sessionID); err != nil {
+		log.Warn("Invalid session ID", zap.String("session_id", sessionID), zap.Error(err))
 		http.Error(w, fmt.Sprintf("invalid session ID: %v", err), http.StatusBadRequest)
 		return
 	}
@@ -41,15 +47,16 @@ func (s *Server) handleParallelChunk(w http.ResponseWriter, r *http.Request, fil
 	}
 
 	// Validate total chunks
-	if err := ValidateTotalChunks(chunkTotal); err != nil {
-		logging.Warn("Invalid total chunks", zap.Int("total", chunkTotal), zap.Error(err))
+	limits := s.uploadLimits()
+	if err := limits.ValidateTotalChunks(chunkTotal); err != nil {
+		log.Warn("Invalid total chunks", zap.Int("total", chunkTotal), zap.Error(err))
 		http.Error(w, fmt.Sprintf("invalid total chunks: %v", err), http.StatusBadRequest)
 		return
 	}
 
 	// Validate chunk ID
-	if err := ValidateChunkID(chunkID, chunkTotal); err != nil {
-		logging.Warn("Invalid chunk ID", zap.Int("chunk_id", chunkID), zap.Int("total", chunkTotal), zap.Error(err))
+	if err := limits.ValidateChunkID(chunkID, chunkTotal); err != nil {
+		log.Warn("Invalid chunk ID", zap.Int("chunk_id", chunkID), zap.Int("total", chunkTotal), zap.Error(err))
 		http.Error(w, fmt.Sprintf("invalid chunk ID: %v", err), http.StatusBadRequest)
 		return
 	}
@@ -67,41 +74,99 @@ func (s *Server) handleParallelChunk(w http.ResponseWriter, r *http.Request, fil
 
 	// Validate offset if we know the total size
 	if totalSize > 0 {
-		if err := ValidateOffset(offset, totalSize); err != nil {
-			logging.Warn("Invalid offset", zap.Int64("offset", offset), zap.Int64("total_size", totalSize), zap.Error(err))
+		if err := protocol.ValidateOffset(offset, totalSize); err != nil {
+			log.Warn("Invalid offset", zap.Int64("offset", offset), zap.Int64("total_size", totalSize), zap.Error(err))
 			http.Error(w, fmt.Sprintf("invalid offset: %v", err), http.StatusBadRequest)
 			return
 		}
 	}
 
-	// Validate chunk size (content length)
-	if r.ContentLength > 0 {
-		if err := ValidateChunkSize(r.ContentLength); err != nil {
-			logging.Warn("Invalid chunk size", zap.Int64("size", r.ContentLength), zap.Error(err))
+	// Chunks are streamed to disk and checked against their length as they land
+	if r.ContentLength < 0 {
+		http.Error(w, "invalid or missing content length", http.StatusBadRequest)
+		return
+	}
+
+	// A sealed chunk is opened as it streams in; its plaintext is what the
+	// checks below and the file see
+	body, size := io.Reader(r.Body), r.ContentLength
+	if scheme := r.Header.Get(protocol.EncryptionHeader); scheme != "" {
+		pos := crypto.ChunkPosition{ID: chunkID, Offset: offset, Total: totalSize}
+		body, size, err = s.openChunk(r.Body, r.ContentLength, scheme, sessionID, pos)
+		if err != nil {
+			log.Warn("Encrypted chunk refused", zap.Int("chunk_id", chunkID), zap.String("session_id", sessionID[:8]), zap.Error(err))
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Validate chunk size (content length); only the last chunk may be short
+	if size > limits.MaxChunkSize || (size > 0 && chunkID < chunkTotal-1) {
+		if err := limits.ValidateChunkSize(size); err != nil {
+			log.Warn("Invalid chunk size", zap.Int64("size", size), zap.Error(err))
 			http.Error(w, fmt.Sprintf("invalid chunk size: %v", err), http.StatusBadRequest)
 			return
 		}
 	}
 
+	// The negotiated chunk size, when the client declares it
+	var declaredChunkSize int64
+	if v := r.Header.Get(protocol.ChunkSizeHeader); v != "" {
+		declaredChunkSize, err = strconv.ParseInt(v, 10, 64)
+		if err != nil || declaredChunkSize <= 0 || declaredChunkSize > limits.MaxChunkSize {
+			http.Error(w, "invalid chunk size header", http.StatusBadRequest)
+			return
+		}
+	}
+
 	// Get or create upload session
-	session, err := s.getOrCreateSession(sessionID, filename, totalSize, chunkTotal, dest)
+	client := clientInfoFrom(r)
+	client.IP = s.clientIP(r)
+	session, err := s.getOrCreateSession(sessionID, filename, totalSize, chunkTotal, dest, rel, client)
+	if errors.Is(err, errDiskFull) {
+		log.Warn("Disk space check failed", zap.String("session_id", sessionID[:8]), zap.Error(err))
+		http.Error(w, "insufficient disk space", http.StatusInsufficientStorage)
+		return
+	}
 	if err != nil {
-		logging.Error("Failed to create session", zap.String("session_id", sessionID[:8]), zap.String("filename", filename), zap.Error(err))
+		log.Error("Failed to create session", zap.String("session_id", sessionID[:8]), zap.String("filename", filename), zap.Error(err))
 		http.Error(w, "session error", http.StatusInternalServerError)
 		return
 	}
+	if err := session.scanRejected(); err != nil {
+		writeScanRejection(w, session.RelPath, err)
+		return
+	}
 
-	// Read chunk data
-	chunkData, err := io.ReadAll(io.LimitReader(r.Body, r.ContentLength))
-	if err != nil {
-		logging.Error("Failed to read chunk", zap.Int("chunk_id", chunkID), zap.String("session_id", sessionID[:8]), zap.Error(err))
-		http.Error(w, "read error", http.StatusInternalServerError)
+	// Reject chunks that would land in another chunk's byte range
+	if err := session.checkChunkLayout(chunkID, offset, size, declaredChunkSize); err != nil {
+		log.Warn("Chunk does not match the session's layout", zap.Int("chunk_id", chunkID), zap.Int64("offset", offset), zap.String("session_id", sessionID[:8]), zap.Error(err))
+		http.Error(w, fmt.Sprintf("invalid chunk offset: %v", err), http.StatusBadRequest)
 		return
 	}
 
-	// Write chunk to file
-	if err := session.writeChunk(chunkID, offset, chunkData); err != nil {
-		logging.Error("Failed to write chunk", zap.Int("chunk_id", chunkID), zap.String("session_id", sessionID[:8]), zap.Error(err))
+	// Stream the chunk to its place in the file
+	received, err := session.writeChunkFrom(chunkID, offset, body, size)
+	// Chunk progress is set from the chunks on disk, so quota usage is
+	// counted here instead, retransmits included
+	s.usageFor(client.IP).add(received)
+	s.publishUsage(client.IP)
+	if errors.Is(err, crypto.ErrChunkAuth) {
+		// Wrong key, or altered or moved on the way; resending won't help
+		log.Warn("Chunk failed authentication", zap.Int("chunk_id", chunkID), zap.String("session_id", sessionID[:8]), zap.Error(err))
+		metrics.ChunkUploadsTotal.WithLabelValues("error").Inc()
+		http.Error(w, "chunk failed authentication", http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, errShortChunk) {
+		// Most likely the client went away mid-chunk; it retries the whole chunk
+		log.Warn("Chunk ended early", zap.Int("chunk_id", chunkID), zap.String("session_id", sessionID[:8]), zap.Int64("received", received), zap.Int64("expected", size), zap.Error(err))
+		metrics.ChunkUploadsTotal.WithLabelValues("error").Inc()
+		http.Error(w, "incomplete chunk", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Error("Failed to write chunk", zap.Int("chunk_id", chunkID), zap.String("session_id", sessionID[:8]), zap.Error(err))
 		metrics.ChunkUploadsTotal.WithLabelValues("error").Inc()
 		http.Error(w, "write error", http.StatusInternalServerError)
 		return
@@ -115,106 +180,222 @@ func (s *Server) handleParallelChunk(w http.ResponseWriter, r *http.Request, fil
 	// Track cumulative chunk timing for this file
 	s.addChunkDuration(filename, time.Since(chunkStartTime))
 
+	// Close file handle but keep session for a bit (for late retries). Done before
+	// responding so the file is final (and durable, per the sync policy) when the
+	// client sees the last chunk succeed.
+	if session.isComplete() {
+		session.mu.Lock()
+		var syncErr error
+		// Late duplicates of a finished upload find the handle already closed
+		finished := session.FileHandle != nil
+		if finished {
+			session.waitPreallocation()
+			syncErr = session.syncPolicy.finishFile(session.FileHandle)
+			_ = session.FileHandle.Close()
+			session.FileHandle = nil
+			// The bytes are on disk now, and counted in the free space
+			if session.releaseDisk != nil {
+				session.releaseDisk()
+			}
+		}
+		fields := []zap.Field{zap.String("filename", session.RelPath), zap.String("size", ui.FormatBytes(session.TotalSize))}
+		if session.Duplicates > 0 {
+			fields = append(fields, zap.String("retransmits", ui.FormatRetransmits(session.Duplicates, session.DuplicateSize)))
+		}
+		session.mu.Unlock()
+		if syncErr != nil {
+			log.Error("Failed to sync upload", zap.String("session_id", sessionID[:8]), zap.Error(syncErr))
+			http.Error(w, "write error", http.StatusInternalServerError)
+			return
+		}
+		// Scanned under its hidden name, and only then given the real one
+		if finished {
+			if err := s.screenUpload(log, session.FilePath, session.RelPath); err != nil {
+				session.mu.Lock()
+				session.rejected = err
+				session.mu.Unlock()
+				s.finishTransfer(sessionID, false)
+				writeScanRejection(w, session.RelPath, err)
+				s.scheduleSessionCleanup(sessionID)
+				return
+			}
+			if err := session.promote(); err != nil {
+				log.Error("Failed to move upload into place", zap.String("filename", session.RelPath), zap.Error(err))
+				s.finishTransfer(sessionID, false)
+				http.Error(w, "write error", http.StatusInternalServerError)
+				return
+			}
+			fields[0] = zap.String("filename", session.RelPath)
+			s.applyUploadAttrs(log, r, session.FilePath)
+			s.finishUpload(sessionID, session.FilePath)
+			log.Info("File received", fields...)
+		}
+	}
+
 	// Build response
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 
 	response := map[string]interface{}{
 		"success":  true,
-		"filename": filepath.Base(session.FilePath),
-		"received": len(chunkData),
+		"filename": session.RelPath,
+		"received": received,
 		"chunk_id": chunkID,
 		"complete": session.isComplete(),
 	}
 
 	_ = json.NewEncoder(w).Encode(response)
 
+	// Under full preallocation the file is allocated now that the client has
+	// its first answer, rather than while it waits for one
+	session.startPreallocation()
+
 	// Cleanup if complete
 	if session.isComplete() {
-		// Close file handle but keep session for a bit (for late retries)
-		session.mu.Lock()
-		if session.FileHandle != nil {
-			_ = session.FileHandle.Sync()
-			_ = session.FileHandle.Close()
-			session.FileHandle = nil
-		}
-		session.mu.Unlock()
+		s.scheduleSessionCleanup(sessionID)
+	}
+}
 
-		// Force final progress update to ensure it reaches 100%
-		if s.multiFileDisplay != nil {
-			s.printMultiFileProgress()
-		}
+// openChunk returns a reader that decrypts a chunk sealed with
+// crypto.SealChunk under the key agreed over PAKE, and the chunk's plaintext
+// size
+func (s *Server) openChunk(body io.Reader, sealedSize int64, scheme, sessionID string, pos crypto.ChunkPosition) (io.Reader, int64, error) {
+	if scheme != protocol.EncryptionChunkV1 {
+		return nil, 0, fmt.Errorf("unsupported chunk encryption %q", scheme)
+	}
+	key := s.uploadKey()
+	if key == nil {
+		return nil, 0, errors.New("chunk is encrypted but no key was agreed")
+	}
+	size, err := crypto.OpenedChunkSize(sealedSize)
+	if err != nil {
+		return nil, 0, err
+	}
+	chunkKey, err := crypto.ChunkKey(key, sessionID)
+	if err != nil {
+		return nil, 0, err
+	}
+	r, err := crypto.NewChunkReader(chunkKey, pos, body, sealedSize)
+	if err != nil {
+		return nil, 0, err
+	}
+	return r, size, nil
+}
 
-		// Schedule cleanup after a delay
-		go func() {
-			time.Sleep(30 * time.Second)
-			s.cleanupSession(sessionID)
-		}()
+// uploadKey is the key agreed over PAKE for this share, or nil
+func (s *Server) uploadKey() []byte {
+	if val, ok := s.tokenKeys.Load(s.Token); ok {
+		return val.([]byte)
 	}
+	return nil
+}
+
+// scheduleSessionCleanup forgets a finished session after a delay, so late
+// retries still find it
+func (s *Server) scheduleSessionCleanup(sessionID string) {
+	go func() {
+		time.Sleep(30 * time.Second)
+		s.cleanupSession(sessionID)
+	}()
 }
 
-// writeChunk writes a chunk of data to the appropriate file position
+// writeChunk writes a chunk of data to the appropriate file position and
+// reports the session's progress to the display
 func (session *uploadSession) writeChunk(chunkID int, offset int64, data []byte) error {
+	_, err := session.writeChunkFrom(chunkID, offset, bytes.NewReader(data), int64(len(data)))
+	return err
+}
+
+// writeChunkFrom streams size bytes of body into the file at offset through a
+// pooled buffer, so a chunk never sits in memory whole. Callers that want to
+// hash the chunk can wrap body in an io.TeeReader. The chunk is only marked
+// written once all size bytes have landed; a body that ends early returns
+// errShortChunk and leaves the chunk for the client to retry.
+func (session *uploadSession) writeChunkFrom(chunkID int, offset int64, body io.Reader, size int64) (int64, error) {
 	session.mu.Lock()
+	written := session.ChunksWritten[chunkID]
+	fh := session.FileHandle
+	session.mu.Unlock()
 
 	// Check if chunk was already written (idempotent)
-	alreadyWritten := session.ChunksWritten[chunkID]
-	if !alreadyWritten {
-		n, err := session.FileHandle.WriteAt(data, offset)
-		if err != nil {
-			session.mu.Unlock()
-			return fmt.Errorf("write failed: %w", err)
-		}
-		if n != len(data) {
-			session.mu.Unlock()
-			return fmt.Errorf("incomplete write: wrote %d of %d bytes", n, len(data))
-		}
-
-		session.ChunksWritten[chunkID] = true
-		session.LastActivity = time.Now()
+	if written {
+		// A retry of a chunk whose response was lost: the bytes crossed the network twice
+		n, _ := io.Copy(io.Discard, io.LimitReader(body, size))
+		session.markChunk(chunkID, n, false)
+		return n, nil
+	}
+	if fh == nil {
+		return 0, errors.New("upload session is closed")
 	}
 
-	// Update progress display even for duplicate chunks (important for retries)
-	if session.server != nil && session.server.multiFileDisplay != nil {
-		display := session.server.multiFileDisplay
-		display.mu.Lock()
-
-		if fileProgress, exists := display.files[session.SessionID]; exists {
-			isComplete := len(session.ChunksWritten) >= session.TotalChunks
-
-			var receivedBytes int64
-			if isComplete {
-				receivedBytes = session.TotalSize
-			} else {
-				chunkSize := session.TotalSize / int64(session.TotalChunks)
-				receivedBytes = int64(len(session.ChunksWritten)) * chunkSize
-				if receivedBytes > session.TotalSize {
-					receivedBytes = session.TotalSize
-				}
-			}
-
-			oldReceived := fileProgress.received
-			fileProgress.received = receivedBytes
-			display.totalReceived += (receivedBytes - oldReceived)
-
-			if isComplete && !fileProgress.complete {
-				fileProgress.complete = true
-				fileProgress.received = session.TotalSize
-				fileProgress.endTime = time.Now()
-				session.complete = true
+	// Chunks cover disjoint byte ranges, so the copy runs without the
+	// session lock and workers don't wait on each other's network reads
+	buf := getBuffer(protocol.BufferSizeMedium)
+	defer putBuffer(buf)
+	var n int64
+	for n < size {
+		p := (*buf)[:min(int64(len(*buf)), size-n)]
+		m, rerr := body.Read(p)
+		if m > 0 {
+			if _, err := fh.WriteAt(p[:m], offset+n); err != nil {
+				return n, fmt.Errorf("write failed: %w", err)
 			}
+			n += int64(m)
+		}
+		if rerr == io.EOF {
+			break
+		}
+		if rerr != nil {
+			return n, fmt.Errorf("%w: %w", errShortChunk, rerr)
+		}
+	}
+	if n != size {
+		return n, fmt.Errorf("%w: got %d of %d bytes", errShortChunk, n, size)
+	}
 
-			if time.Since(display.lastUpdate) > 100*time.Millisecond || fileProgress.complete {
-				display.lastUpdate = time.Now()
-				display.mu.Unlock()
-				session.server.printMultiFileProgress()
-				display.mu.Lock()
-			}
+	// A chunk only counts as written once it is on disk
+	if session.syncPolicy.syncsChunks() {
+		if err := session.syncPolicy.syncFile(fh, "chunk"); err != nil {
+			return n, err
 		}
+	}
+	session.markChunk(chunkID, n, true)
+	return n, nil
+}
 
-		display.mu.Unlock()
+// markChunk records a received chunk and reports the session's progress to
+// the display. fresh is false for a chunk that was already written.
+func (session *uploadSession) markChunk(chunkID int, size int64, fresh bool) {
+	session.mu.Lock()
+	// Two copies of one chunk can race through writeChunkFrom; the later
+	// one is the duplicate
+	if fresh && !session.ChunksWritten[chunkID] {
+		session.ChunksWritten[chunkID] = true
+		session.BytesWritten += size
+		session.LastActivity = time.Now()
+	} else {
+		session.Duplicates++
+		session.DuplicateSize += size
+		metrics.ChunkDuplicatesTotal.Inc()
 	}
 
+	var receivedBytes int64
+	if len(session.ChunksWritten) >= session.TotalChunks {
+		session.complete = true
+		receivedBytes = session.TotalSize
+	} else {
+		chunkSize := session.TotalSize / int64(session.TotalChunks)
+		receivedBytes = min(int64(len(session.ChunksWritten))*chunkSize, session.TotalSize)
+	}
+	if session.tracker != nil {
+		session.tracker.SetProgress(receivedBytes)
+	}
+	ev := progressEvent{sessionID: session.SessionID, received: receivedBytes, complete: session.complete, duplicates: session.Duplicates, wasted: session.DuplicateSize, at: time.Now()}
 	session.mu.Unlock()
-	return nil
+
+	// Report even duplicate chunks (important for retries); the display
+	// goroutine owns the progress state, so no display lock is taken here
+	if session.server != nil {
+		session.server.progressDisplay().send(ev)
+	}
 }
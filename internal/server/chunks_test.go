@@ -0,0 +1,447 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/zulfikawr/warp/internal/crypto"
+	"github.com/zulfikawr/warp/internal/metrics"
+	"github.com/zulfikawr/warp/internal/protocol"
+	"github.com/zulfikawr/warp/internal/ui"
+)
+
+func TestParallelChunkRejectsOverlappingOffset(t *testing.T) {
+	dir := t.TempDir()
+	tok, _ := crypto.GenerateToken(nil)
+	s := &Server{Token: tok, HostMode: true, UploadDir: dir}
+	ts := httptest.NewServer(s.routes())
+	defer ts.Close()
+
+	const chunkSize = 64 << 10
+	const total = 2*chunkSize + 100
+	send := func(id int, offset int64, fill byte, length int, declared string) int {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPost, ts.URL+protocol.UploadPathPrefix+tok, bytes.NewReader(bytes.Repeat([]byte{fill}, length)))
+		req.Header.Set("X-File-Name", "data.bin")
+		req.Header.Set("X-Upload-Session", "overlap-session-1")
+		req.Header.Set("X-Upload-Offset", fmt.Sprint(offset))
+		req.Header.Set("X-Upload-Total", fmt.Sprint(total))
+		req.Header.Set("X-Chunk-Id", fmt.Sprint(id))
+		req.Header.Set("X-Chunk-Total", "3")
+		if declared != "" {
+			req.Header.Set(protocol.ChunkSizeHeader, declared)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if code := send(0, 0, 'a', chunkSize, fmt.Sprint(chunkSize)); code != http.StatusOK {
+		t.Fatalf("chunk 0: status %d", code)
+	}
+	// Chunk 2 carrying chunk 0's offset
+	if code := send(2, 0, 'x', 100, ""); code != http.StatusBadRequest {
+		t.Errorf("chunk 2 at offset 0: status %d, want 400", code)
+	}
+	// A chunk size that disagrees with the session's
+	if code := send(1, chunkSize, 'x', chunkSize, fmt.Sprint(2*chunkSize)); code != http.StatusBadRequest {
+		t.Errorf("chunk 1 with a different X-Chunk-Size: status %d, want 400", code)
+	}
+
+	got, err := os.ReadFile(filepath.Join(dir, "data.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got[:chunkSize], bytes.Repeat([]byte{'a'}, chunkSize)) {
+		t.Error("chunk 0's byte range was overwritten")
+	}
+	if bytes.IndexByte(got, 'x') >= 0 {
+		t.Error("a rejected chunk reached the file")
+	}
+
+	// The real chunks still complete the file; the last one is short
+	if code := send(1, chunkSize, 'b', chunkSize, ""); code != http.StatusOK {
+		t.Errorf("chunk 1: status %d", code)
+	}
+	if code := send(2, 2*chunkSize, 'c', 100, fmt.Sprint(chunkSize)); code != http.StatusOK {
+		t.Errorf("short last chunk: status %d", code)
+	}
+	got, _ = os.ReadFile(filepath.Join(dir, "data.bin"))
+	want := strings.Repeat("a", chunkSize) + strings.Repeat("b", chunkSize) + strings.Repeat("c", 100)
+	if string(got) != want {
+		t.Error("completed file does not match the chunks sent")
+	}
+}
+
+func TestDuplicateChunksAreCounted(t *testing.T) {
+	dir := t.TempDir()
+	tok, _ := crypto.GenerateToken(nil)
+	s := &Server{Token: tok, HostMode: true, UploadDir: dir}
+	ts := httptest.NewServer(s.routes())
+	defer ts.Close()
+
+	const chunkSize = 64 << 10
+	send := func(id int) {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPost, ts.URL+protocol.UploadPathPrefix+tok, bytes.NewReader(make([]byte, chunkSize)))
+		req.Header.Set("X-File-Name", "data.bin")
+		req.Header.Set("X-Upload-Session", "duplicate-session-1")
+		req.Header.Set("X-Upload-Offset", fmt.Sprint(id*chunkSize))
+		req.Header.Set("X-Upload-Total", fmt.Sprint(3*chunkSize))
+		req.Header.Set("X-Chunk-Id", fmt.Sprint(id))
+		req.Header.Set("X-Chunk-Total", "3")
+		req.Header.Set(protocol.ChunkSizeHeader, fmt.Sprint(chunkSize))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("chunk %d: status %d", id, resp.StatusCode)
+		}
+	}
+
+	before := testutil.ToFloat64(metrics.ChunkDuplicatesTotal)
+	// Chunk 0 is retried twice, as after two lost responses
+	for _, id := range []int{0, 0, 1, 0, 2} {
+		send(id)
+	}
+
+	val, ok := s.uploadSessions.Load("duplicate-session-1")
+	if !ok {
+		t.Fatal("session not found")
+	}
+	session := val.(*uploadSession)
+	session.mu.Lock()
+	dups, wasted := session.Duplicates, session.DuplicateSize
+	session.mu.Unlock()
+	if dups != 2 || wasted != 2*chunkSize {
+		t.Errorf("session counted %d duplicates (%d bytes), want 2 (%d bytes)", dups, wasted, 2*chunkSize)
+	}
+	if got := testutil.ToFloat64(metrics.ChunkDuplicatesTotal) - before; got != 2 {
+		t.Errorf("warp_chunk_duplicates_total grew by %v, want 2", got)
+	}
+}
+
+func TestRetransmitSummaryFields(t *testing.T) {
+	display := &MultiFileProgress{files: map[string]*FileProgress{
+		"a": {chunks: 20, duplicates: 1, wasted: 2 << 20},
+		"b": {chunks: 10},
+	}}
+	fields := display.retransmitFields()
+	if len(fields) != 1 || fields[0].Value != ui.FormatRetransmits(1, 2<<20) {
+		t.Errorf("fields = %+v, want one Retransmitted line and no hint", fields)
+	}
+
+	display.files["b"].duplicates, display.files["b"].wasted = 3, 6<<20
+	fields = display.retransmitFields()
+	if len(fields) != 2 || fields[0].Value != "4 chunks retransmitted, 8.0 MiB wasted" || fields[1].Label != "Hint" {
+		t.Errorf("fields = %+v, want the total and a hint above 10%%", fields)
+	}
+
+	display.files["a"].duplicates, display.files["b"].duplicates = 0, 0
+	if fields := display.retransmitFields(); fields != nil {
+		t.Errorf("fields = %+v without duplicates", fields)
+	}
+}
+
+func TestSessionStatusEndpoint(t *testing.T) {
+	dir := t.TempDir()
+	tok, _ := crypto.GenerateToken(nil)
+	s := &Server{Token: tok, HostMode: true, UploadDir: dir}
+	ts := httptest.NewServer(s.routes())
+	defer ts.Close()
+
+	const sessionID = "status-session-1"
+	const chunkSize = 64 << 10
+	const total = 9*chunkSize + 10
+	send := func(id int) {
+		t.Helper()
+		length := chunkSize
+		if id == 9 {
+			length = 10
+		}
+		req, _ := http.NewRequest(http.MethodPost, ts.URL+protocol.UploadPathPrefix+tok, bytes.NewReader(make([]byte, length)))
+		req.Header.Set("X-File-Name", "data.bin")
+		req.Header.Set("X-Upload-Session", sessionID)
+		req.Header.Set("X-Upload-Offset", fmt.Sprint(id*chunkSize))
+		req.Header.Set("X-Upload-Total", fmt.Sprint(total))
+		req.Header.Set("X-Chunk-Id", fmt.Sprint(id))
+		req.Header.Set("X-Chunk-Total", "10")
+		req.Header.Set(protocol.ChunkSizeHeader, fmt.Sprint(chunkSize))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("chunk %d: status %d", id, resp.StatusCode)
+		}
+	}
+	status := func(token, id string) (int, protocol.SessionStatus) {
+		t.Helper()
+		resp, err := http.Get(ts.URL + protocol.UploadPathPrefix + token + protocol.SessionPathSegment + id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = resp.Body.Close() }()
+		var st protocol.SessionStatus
+		if resp.StatusCode == http.StatusOK {
+			if err := json.NewDecoder(resp.Body).Decode(&st); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return resp.StatusCode, st
+	}
+
+	if code, _ := status(tok, "no-such-session-1"); code != http.StatusNotFound {
+		t.Errorf("unknown session: status %d, want 404", code)
+	}
+
+	// Partial: chunks 0, 2 and 9 of 10
+	for _, id := range []int{0, 2, 9} {
+		send(id)
+	}
+	code, st := status(tok, sessionID)
+	if code != http.StatusOK {
+		t.Fatalf("partial session: status %d", code)
+	}
+	if st.TotalChunks != 10 || st.ReceivedChunks != 3 || st.Complete {
+		t.Errorf("partial status = %+v", st)
+	}
+	if !bytes.Equal(st.ReceivedBitmap, []byte{0b00000101, 0b00000010}) {
+		t.Errorf("bitmap = %08b", st.ReceivedBitmap)
+	}
+	if st.BytesWritten != 2*chunkSize+10 {
+		t.Errorf("bytes_written = %d, want %d", st.BytesWritten, 2*chunkSize+10)
+	}
+	if got := st.Missing(); fmt.Sprint(got) != "[1 3 4 5 6 7 8]" {
+		t.Errorf("Missing() = %v", got)
+	}
+
+	// Complete
+	for _, id := range []int{1, 3, 4, 5, 6, 7, 8} {
+		send(id)
+	}
+	_, st = status(tok, sessionID)
+	if !st.Complete || st.ReceivedChunks != 10 || st.BytesWritten != total || len(st.Missing()) != 0 {
+		t.Errorf("complete status = %+v", st)
+	}
+
+	if code, _ := status("wrong-token", sessionID); code != http.StatusForbidden {
+		t.Errorf("wrong token: status %d, want 403", code)
+	}
+}
+
+// disconnectingReader hands out n bytes and then fails the way a request body
+// does when the client drops the connection
+type disconnectingReader struct {
+	n int
+}
+
+func (r *disconnectingReader) Read(p []byte) (int, error) {
+	if r.n == 0 {
+		return 0, io.ErrUnexpectedEOF
+	}
+	p = p[:min(len(p), r.n)]
+	clear(p)
+	r.n -= len(p)
+	return len(p), nil
+}
+
+func TestShortChunkStaysIncomplete(t *testing.T) {
+	s := &Server{Renderer: ui.NewJSONRenderer(io.Discard)}
+	s.shutdownCtx, s.shutdownCancel = context.WithCancel(context.Background())
+	defer s.shutdownCancel()
+
+	const chunkSize = 64 << 10
+	session, err := s.getOrCreateSession("short-chunk-session-1", "data.bin", 2*chunkSize, 2, t.TempDir(), "", clientInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = session.FileHandle.Close() }()
+
+	tests := []struct {
+		name string
+		body io.Reader
+	}{
+		{"disconnect", &disconnectingReader{n: chunkSize / 2}},
+		{"early EOF", bytes.NewReader(make([]byte, chunkSize/2))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n, err := session.writeChunkFrom(0, 0, tt.body, chunkSize)
+			if !errors.Is(err, errShortChunk) {
+				t.Fatalf("err = %v, want errShortChunk", err)
+			}
+			if n != chunkSize/2 {
+				t.Errorf("wrote %d bytes, want %d", n, chunkSize/2)
+			}
+			session.mu.Lock()
+			written, bytesWritten := session.ChunksWritten[0], session.BytesWritten
+			session.mu.Unlock()
+			if written || bytesWritten != 0 {
+				t.Errorf("short chunk marked written (%d bytes counted)", bytesWritten)
+			}
+		})
+	}
+
+	// The retry lands as a fresh chunk, not a duplicate
+	if _, err := session.writeChunkFrom(0, 0, bytes.NewReader(bytes.Repeat([]byte{'a'}, chunkSize)), chunkSize); err != nil {
+		t.Fatal(err)
+	}
+	session.mu.Lock()
+	written, dups := session.ChunksWritten[0], session.Duplicates
+	session.mu.Unlock()
+	if !written || dups != 0 {
+		t.Errorf("retry: written %v with %d duplicates, want true with 0", written, dups)
+	}
+}
+
+// BenchmarkParallelChunkAllocs posts 2MB chunks through the upload handler.
+// Bytes per op stay far below the chunk size because the body is streamed
+// to disk through a pooled buffer.
+func BenchmarkParallelChunkAllocs(b *testing.B) {
+	tok, _ := crypto.GenerateToken(nil)
+	s := &Server{Token: tok, HostMode: true, UploadDir: b.TempDir(), Renderer: ui.NewJSONRenderer(io.Discard)}
+	h := s.routes()
+	const chunkSize = ManifestChunkSize
+	data := make([]byte, chunkSize)
+	body := bytes.NewReader(data)
+
+	b.ReportAllocs()
+	b.SetBytes(chunkSize)
+	for i := 0; i < b.N; i++ {
+		id := i % protocol.DefaultMaxChunks
+		body.Reset(data)
+		req := httptest.NewRequest(http.MethodPost, protocol.UploadPathPrefix+tok, body)
+		req.Header.Set("X-File-Name", "bench.bin")
+		req.Header.Set("X-Upload-Session", "alloc-bench-session")
+		req.Header.Set("X-Upload-Offset", fmt.Sprint(int64(id)*chunkSize))
+		req.Header.Set("X-Chunk-Id", fmt.Sprint(id))
+		req.Header.Set("X-Chunk-Total", fmt.Sprint(protocol.DefaultMaxChunks))
+		req.Header.Set(protocol.ChunkSizeHeader, fmt.Sprint(chunkSize))
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			b.Fatalf("chunk %d: status %d", id, rec.Code)
+		}
+	}
+	b.StopTimer()
+	s.cleanupSession("alloc-bench-session")
+}
+
+func TestEncryptedChunks(t *testing.T) {
+	dir := t.TempDir()
+	tok, _ := crypto.GenerateToken(nil)
+	s := &Server{Token: tok, HostMode: true, UploadDir: dir}
+	key := bytes.Repeat([]byte{9}, crypto.KeySize)
+	s.tokenKeys.Store(tok, key)
+	ts := httptest.NewServer(s.routes())
+	defer ts.Close()
+
+	const chunkSize = 64 << 10
+	const total = 2*chunkSize + 100
+	plain := make([]byte, total)
+	for i := range plain {
+		plain[i] = byte(i % 251)
+	}
+	const session = "sealed-session-1"
+	sessionKey, _ := crypto.ChunkKey(key, session)
+	seal := func(key []byte, id int) []byte {
+		off := int64(id) * chunkSize
+		sealed, err := crypto.SealChunk(key, crypto.ChunkPosition{ID: id, Offset: off, Total: total}, plain[off:min(off+chunkSize, total)])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sealed
+	}
+	send := func(body []byte, id int, scheme string) (int, string) {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPost, ts.URL+protocol.UploadPathPrefix+tok, bytes.NewReader(body))
+		req.Header.Set("X-File-Name", "secret.bin")
+		req.Header.Set("X-Upload-Session", session)
+		req.Header.Set("X-Upload-Offset", fmt.Sprint(id*chunkSize))
+		req.Header.Set("X-Upload-Total", fmt.Sprint(total))
+		req.Header.Set("X-Chunk-Id", fmt.Sprint(id))
+		req.Header.Set("X-Chunk-Total", "3")
+		req.Header.Set(protocol.ChunkSizeHeader, fmt.Sprint(chunkSize))
+		req.Header.Set(protocol.EncryptionHeader, scheme)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = resp.Body.Close() }()
+		b, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(b)
+	}
+
+	// The host says it takes sealed chunks once a key is agreed
+	resp, err := http.Get(ts.URL + protocol.UploadPathPrefix + tok + protocol.ManifestPathSuffix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var caps protocol.Capabilities
+	_ = json.NewDecoder(resp.Body).Decode(&caps)
+	_ = resp.Body.Close()
+	if !caps.Has(protocol.FeatureEncryptedChunks) {
+		t.Errorf("manifest features %v lack %s", caps.Features, protocol.FeatureEncryptedChunks)
+	}
+
+	if code, _ := send(seal(sessionKey, 0), 0, protocol.EncryptionChunkV1); code != http.StatusOK {
+		t.Fatalf("chunk 0: status %d", code)
+	}
+	refused := []struct {
+		name   string
+		body   []byte
+		id     int
+		scheme string
+		want   string
+	}{
+		{"sealed for another position", func() []byte {
+			b, _ := crypto.SealChunk(sessionKey, crypto.ChunkPosition{ID: 1, Offset: 0, Total: total}, plain[chunkSize:2*chunkSize])
+			return b
+		}(), 1, protocol.EncryptionChunkV1, "authentication"},
+		{"sealed for another session", seal(func() []byte { k, _ := crypto.ChunkKey(key, "other"); return k }(), 1), 1, protocol.EncryptionChunkV1, "authentication"},
+		{"unknown scheme", seal(sessionKey, 1), 1, "chunk-v9", "unsupported"},
+		{"partial tag", append(seal(sessionKey, 1), 1, 2, 3), 1, protocol.EncryptionChunkV1, "partial tag"},
+	}
+	for _, tt := range refused {
+		if code, body := send(tt.body, tt.id, tt.scheme); code != http.StatusBadRequest || !strings.Contains(body, tt.want) {
+			t.Errorf("%s: status %d %q, want 400 mentioning %q", tt.name, code, body, tt.want)
+		}
+	}
+	for id := 1; id < 3; id++ {
+		if code, body := send(seal(sessionKey, id), id, protocol.EncryptionChunkV1); code != http.StatusOK {
+			t.Fatalf("chunk %d: status %d %s", id, code, body)
+		}
+	}
+	got, err := os.ReadFile(filepath.Join(dir, "secret.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, plain) {
+		t.Error("opened chunks don't make up the file")
+	}
+
+	// Without a key there is nothing to open them with
+	s.tokenKeys.Delete(tok)
+	if code, body := send(seal(sessionKey, 0), 0, protocol.EncryptionChunkV1); code != http.StatusBadRequest || !strings.Contains(body, "no key") {
+		t.Errorf("no key: status %d %q", code, body)
+	}
+}
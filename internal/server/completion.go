@@ -0,0 +1,276 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/zulfikawr/warp/internal/logging"
+	"github.com/zulfikawr/warp/internal/protocol"
+)
+
+// Expectation is what a scripted host waits for: an upload matching each of
+// Names and, with Count, at least Count matching uploads. A name is a file
+// name or a glob; one containing "/" is matched against the path relative to
+// the upload directory, any other against the file's base name. Without Names
+// every upload matches.
+type Expectation struct {
+	Names []string
+	Count int
+}
+
+// Validate reports a malformed pattern or an expectation of nothing
+func (e Expectation) Validate() error {
+	if len(e.Names) == 0 && e.Count <= 0 {
+		return fmt.Errorf("nothing expected: give a name or a count")
+	}
+	if e.Count < 0 {
+		return fmt.Errorf("expected count must not be negative, got %d", e.Count)
+	}
+	for _, name := range e.Names {
+		if _, err := path.Match(filepath.ToSlash(name), ""); err != nil {
+			return fmt.Errorf("invalid pattern %q: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// matchName reports whether the upload saved at rel (slash-separated,
+// relative to the upload directory) matches the expected name or glob
+func matchName(name, rel string) bool {
+	name = filepath.ToSlash(name)
+	target := path.Base(rel)
+	if strings.Contains(name, "/") {
+		target = rel
+	}
+	ok, _ := path.Match(name, target)
+	return ok
+}
+
+// CompletedFile is one upload listed in a completion file
+type CompletedFile struct {
+	Name       string    `json:"name"` // Relative to the upload directory, slash-separated
+	Size       int64     `json:"size"`
+	SHA256     string    `json:"sha256"`
+	ClientIP   string    `json:"client_ip,omitempty"`
+	ReceivedAt time.Time `json:"received_at"`
+}
+
+// CompletionReport is the content of a completion file. It is rewritten after
+// every matching upload, so Complete is false until the expectation is met.
+type CompletionReport struct {
+	Complete      bool            `json:"complete"`
+	Expected      []string        `json:"expected,omitempty"`
+	ExpectedCount int             `json:"expected_count,omitempty"`
+	Pending       []string        `json:"pending,omitempty"` // Names nothing has matched yet
+	Files         []CompletedFile `json:"files"`
+}
+
+// CompletionFile records the uploads that meet an Expectation in a JSON file
+// at Path, for scripts that wait on a host without parsing its output
+type CompletionFile struct {
+	Path      string
+	Expect    Expectation
+	UploadDir string // Names in the file are relative to it
+
+	files   []CompletedFile
+	matched []bool // Per Expect.Names
+
+	mu     sync.Mutex
+	queued []Event       // Uploads passed to Queue that Watch hasn't taken yet
+	wake   chan struct{} // Signaled when queued grows or the file is closed
+	closed bool
+	once   sync.Once
+}
+
+// Add records file if it matches the expectation and reports whether it did
+func (c *CompletionFile) Add(file CompletedFile) bool {
+	if c.matched == nil {
+		c.matched = make([]bool, len(c.Expect.Names))
+	}
+	match := len(c.Expect.Names) == 0
+	for i, name := range c.Expect.Names {
+		if matchName(name, file.Name) {
+			c.matched[i], match = true, true
+		}
+	}
+	if match {
+		c.files = append(c.files, file)
+	}
+	return match
+}
+
+// Complete reports whether the uploads added so far meet the expectation
+func (c *CompletionFile) Complete() bool {
+	for i := range c.Expect.Names {
+		if c.matched == nil || !c.matched[i] {
+			return false
+		}
+	}
+	return len(c.files) >= c.Expect.Count
+}
+
+// Report is what the completion file holds for the uploads added so far
+func (c *CompletionFile) Report() CompletionReport {
+	r := CompletionReport{
+		Complete:      c.Complete(),
+		Expected:      c.Expect.Names,
+		ExpectedCount: c.Expect.Count,
+		Files:         append([]CompletedFile{}, c.files...),
+	}
+	for i, name := range c.Expect.Names {
+		if c.matched == nil || !c.matched[i] {
+			r.Pending = append(r.Pending, name)
+		}
+	}
+	return r
+}
+
+// Write writes the report as indented JSON. The file is replaced in one
+// rename, so a reader never sees half a report. Without a Path it does
+// nothing.
+func (c *CompletionFile) Write() error {
+	if c.Path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(c.Report(), "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(c.Path), ".warp-completion-*")
+	if err != nil {
+		return fmt.Errorf("write completion file: %w", err)
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("write completion file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("write completion file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), c.Path); err != nil {
+		return fmt.Errorf("write completion file: %w", err)
+	}
+	return nil
+}
+
+// Queue hands the TransferCompleted event of a saved upload to Watch. It
+// never blocks and never drops one, so it can be the server's OnUpload.
+func (c *CompletionFile) Queue(ev Event) {
+	c.setup()
+	c.mu.Lock()
+	if !c.closed {
+		c.queued = append(c.queued, ev)
+	}
+	c.mu.Unlock()
+	c.signal()
+}
+
+// Close makes Watch return once it has added the uploads already queued
+func (c *CompletionFile) Close() {
+	c.setup()
+	c.mu.Lock()
+	c.closed = true
+	c.mu.Unlock()
+	c.signal()
+}
+
+func (c *CompletionFile) setup() {
+	c.once.Do(func() { c.wake = make(chan struct{}, 1) })
+}
+
+func (c *CompletionFile) signal() {
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+}
+
+// next waits for the next queued upload; false means the file was closed
+// and nothing is left
+func (c *CompletionFile) next() (Event, bool) {
+	for {
+		c.mu.Lock()
+		if len(c.queued) > 0 {
+			ev := c.queued[0]
+			c.queued = c.queued[1:]
+			c.mu.Unlock()
+			return ev, true
+		}
+		closed := c.closed
+		c.mu.Unlock()
+		if closed {
+			return Event{}, false
+		}
+		<-c.wake
+	}
+}
+
+// Watch checksums and adds every upload passed to Queue, rewriting the file
+// after each match, until Close. It runs apart from the uploads, so hashing
+// a large file holds up only the completion file. complete, if not nil, is
+// closed once the expectation is met. The file is written once up front, so
+// it exists with Complete false from the start.
+func (c *CompletionFile) Watch(complete chan<- struct{}) {
+	c.setup()
+	if err := c.Write(); err != nil {
+		logging.Error("Failed to write completion file", zap.String("path", c.Path), zap.Error(err))
+	}
+	signaled := false
+	for {
+		ev, ok := c.next()
+		if !ok {
+			return
+		}
+		if ev.Type != EventTransferCompleted || ev.Direction != protocol.DirectionUpload || ev.Path == "" {
+			continue
+		}
+		file, err := c.completedFile(ev)
+		if err != nil {
+			logging.Error("Failed to checksum upload for the completion file", zap.String("path", ev.Path), zap.Error(err))
+			continue
+		}
+		if !c.Add(file) {
+			continue
+		}
+		if err := c.Write(); err != nil {
+			logging.Error("Failed to write completion file", zap.String("path", c.Path), zap.Error(err))
+		}
+		if c.Complete() && !signaled && complete != nil {
+			close(complete)
+			signaled = true
+		}
+	}
+}
+
+// completedFile describes the upload of ev as saved on disk
+func (c *CompletionFile) completedFile(ev Event) (CompletedFile, error) {
+	fi, err := os.Stat(ev.Path)
+	if err != nil {
+		return CompletedFile{}, err
+	}
+	sum, err := hashFileContext(context.Background(), ev.Path)
+	if err != nil {
+		return CompletedFile{}, err
+	}
+	rel, err := filepath.Rel(c.UploadDir, ev.Path)
+	if err != nil {
+		rel = filepath.Base(ev.Path)
+	}
+	return CompletedFile{
+		Name:       filepath.ToSlash(rel),
+		Size:       fi.Size(),
+		SHA256:     sum,
+		ClientIP:   ev.ClientIP,
+		ReceivedAt: ev.Time,
+	}, nil
+}
@@ -0,0 +1,157 @@
+package server
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/zulfikawr/warp/internal/protocol"
+)
+
+func TestMatchName(t *testing.T) {
+	tests := []struct {
+		name, rel string
+		want      bool
+	}{
+		{"report.pdf", "report.pdf", true},
+		{"report.pdf", "2026-10-16/report.pdf", true},
+		{"report.pdf", "report (1).pdf", false},
+		{"*.pdf", "report.pdf", true},
+		{"*.pdf", "10.0.0.7/scan.pdf", true},
+		{"*.pdf", "report.pdf.txt", false},
+		{"scan-??.png", "scan-01.png", true},
+		{"scan-[0-9]*.png", "scan-x.png", false},
+		{"2026-*/*.pdf", "2026-10-16/report.pdf", true},
+		{"2026-*/*.pdf", "report.pdf", false},
+		{"*", "sub/dir.bin", true},
+	}
+	for _, tt := range tests {
+		if got := matchName(tt.name, tt.rel); got != tt.want {
+			t.Errorf("matchName(%q, %q) = %v, want %v", tt.name, tt.rel, got, tt.want)
+		}
+	}
+}
+
+func TestExpectationValidate(t *testing.T) {
+	for _, e := range []Expectation{{}, {Count: -1, Names: []string{"a"}}, {Names: []string{"[a"}}} {
+		if err := e.Validate(); err == nil {
+			t.Errorf("%+v is valid", e)
+		}
+	}
+	if err := (Expectation{Names: []string{"*.pdf"}, Count: 2}).Validate(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCompletionFileComplete(t *testing.T) {
+	c := &CompletionFile{Expect: Expectation{Names: []string{"a.bin", "*.log"}, Count: 3}}
+	for _, name := range []string{"a.bin", "other.txt", "x.log"} {
+		c.Add(CompletedFile{Name: name})
+	}
+	if c.Complete() {
+		t.Fatal("complete with two matching uploads of three")
+	}
+	if r := c.Report(); len(r.Files) != 2 || len(r.Pending) != 0 {
+		t.Fatalf("report = %+v", r)
+	}
+	c.Add(CompletedFile{Name: "y.log"})
+	if !c.Complete() {
+		t.Fatal("not complete with every name matched and three uploads")
+	}
+}
+
+func readReport(t *testing.T, path string) CompletionReport {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var r CompletionReport
+	if err := json.Unmarshal(data, &r); err != nil {
+		t.Fatalf("invalid completion file: %v\n%s", err, data)
+	}
+	return r
+}
+
+func TestCompletionFileWriteIsAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "done.json")
+	c := &CompletionFile{Path: path, Expect: Expectation{Names: []string{"a.bin", "b.bin"}}}
+	if err := c.Write(); err != nil {
+		t.Fatal(err)
+	}
+	if r := readReport(t, path); r.Complete || len(r.Pending) != 2 || len(r.Files) != 0 {
+		t.Fatalf("initial report = %+v", r)
+	}
+
+	// A reader holding the old file keeps seeing it whole
+	old, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = old.Close() }()
+	c.Add(CompletedFile{Name: "a.bin", Size: 1, SHA256: "ab"})
+	if err := c.Write(); err != nil {
+		t.Fatal(err)
+	}
+	var before CompletionReport
+	if err := json.NewDecoder(old).Decode(&before); err != nil || len(before.Files) != 0 {
+		t.Fatalf("old file = %+v, %v", before, err)
+	}
+	if r := readReport(t, path); len(r.Files) != 1 || r.Files[0].Name != "a.bin" || len(r.Pending) != 1 {
+		t.Fatalf("partial report = %+v", r)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("temporary files left behind: %v", entries)
+	}
+}
+
+func TestCompletionFileWatch(t *testing.T) {
+	uploads := t.TempDir()
+	path := filepath.Join(t.TempDir(), "done.json")
+	for _, name := range []string{"a.bin", "b.bin"} {
+		if err := os.WriteFile(filepath.Join(uploads, name), []byte("hello"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c := &CompletionFile{Path: path, Expect: Expectation{Names: []string{"*.bin"}, Count: 2}, UploadDir: uploads}
+	complete := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		c.Watch(complete)
+		close(done)
+	}()
+
+	upload := func(name string) Event {
+		return Event{Type: EventTransferCompleted, Direction: protocol.DirectionUpload, Filename: name, Path: filepath.Join(uploads, name), ClientIP: "10.0.0.7"}
+	}
+	c.Queue(Event{Type: EventTransferCompleted, Direction: protocol.DirectionDownload, Path: filepath.Join(uploads, "a.bin")})
+	c.Queue(upload("a.bin"))
+	c.Queue(upload("b.bin"))
+	select {
+	case <-complete:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expectation never met")
+	}
+	c.Close()
+	<-done
+
+	r := readReport(t, path)
+	if !r.Complete || len(r.Files) != 2 {
+		t.Fatalf("report = %+v", r)
+	}
+	// sha256("hello")
+	const sum = "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+	for i, f := range r.Files {
+		if f.Name != []string{"a.bin", "b.bin"}[i] || f.Size != 5 || f.SHA256 != sum || f.ClientIP != "10.0.0.7" {
+			t.Errorf("file %d = %+v", i, f)
+		}
+	}
+}
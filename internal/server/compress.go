@@ -0,0 +1,231 @@
+package server
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression heuristics
+const (
+	// compressionSampleSize is how much of a file is test-compressed
+	compressionSampleSize = 256 << 10
+	// minCompressionRatio is the sampled ratio compression has to beat
+	minCompressionRatio = 1.3
+	// minCompressSize skips files too small for compression to save anything
+	// worth an encoder round trip
+	minCompressSize = 4 << 10
+	// assumedLinkMbps stands in for the link speed when no rate limit is set
+	assumedLinkMbps = 1000
+)
+
+// Content-Encodings the server produces
+const (
+	encodingZstd   = "zstd"
+	encodingBrotli = "br"
+	encodingGzip   = "gzip"
+)
+
+// brotliLevel is close to gzip's default speed while still compressing
+// noticeably better; higher levels cost far more CPU than they save on a LAN
+const brotliLevel = 4
+
+// sampleEncoder compresses samples at zstd level 1, matching what is served
+var sampleEncoder = sync.OnceValue(func() *zstd.Encoder {
+	enc, _ := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedFastest), zstd.WithEncoderConcurrency(1))
+	return enc
+})
+
+// compressionDecision records whether a file is worth compressing and why
+type compressionDecision struct {
+	compress bool
+	reason   string  // extension, sampled, cpu-bound, small or low-memory
+	ratio    float64 // sampled original/compressed size; 0 when not sampled
+}
+
+// describe renders the decision for the transfer log, e.g.
+// "zstd (sampled ratio 3.4x)" or "none (extension)"
+func (d compressionDecision) describe(codec string) string {
+	if !d.compress {
+		codec = "none"
+	}
+	if d.ratio > 0 {
+		return fmt.Sprintf("%s (%s ratio %.1fx)", codec, d.reason, d.ratio)
+	}
+	return fmt.Sprintf("%s (%s)", codec, d.reason)
+}
+
+// compressionSample is the outcome of test-compressing the start of a file
+type compressionSample struct {
+	ratio       float64
+	bytesPerSec float64 // compression throughput; 0 when too fast to measure
+}
+
+// compressionFor decides whether to compress path, reusing the cached
+// decision while the file's size and modification time are unchanged
+func (s *Server) compressionFor(path string, fi os.FileInfo) compressionDecision {
+	// Encoders cost memory and CPU a small device doesn't have; not even sampled
+	if s.LowMemory {
+		return compressionDecision{reason: "low-memory"}
+	}
+	if val, ok := s.compressionCache.Load(path); ok {
+		entry := val.(*compressionCacheEntry)
+		if entry.modTime.Equal(fi.ModTime()) && entry.size == fi.Size() {
+			return entry.decision
+		}
+	}
+
+	d := s.decideCompression(path, fi.Size())
+	s.compressionCache.Store(path, &compressionCacheEntry{
+		decision: d,
+		modTime:  fi.ModTime(),
+		size:     fi.Size(),
+	})
+	return d
+}
+
+// decideCompression uses the extension lists for obvious cases and samples
+// the file for everything else
+func (s *Server) decideCompression(path string, size int64) compressionDecision {
+	switch {
+	case size <= minCompressSize:
+		return compressionDecision{reason: "small"}
+	case isCompressible(path):
+		return compressionDecision{compress: true, reason: "extension"}
+	case isPrecompressed(path):
+		return compressionDecision{reason: "extension"}
+	}
+
+	sample, err := sampleCompression(path)
+	if err != nil {
+		return compressionDecision{reason: "unreadable"}
+	}
+	return decideFromSample(sample, s.linkBytesPerSec())
+}
+
+// decideFromSample enables compression when the sample shrinks enough and the
+// encoder keeps up with the link, so compressing never slows the transfer
+func decideFromSample(sample compressionSample, linkBytesPerSec float64) compressionDecision {
+	d := compressionDecision{reason: "sampled", ratio: sample.ratio}
+	if sample.ratio < minCompressionRatio {
+		return d
+	}
+	if sample.bytesPerSec > 0 && sample.bytesPerSec < linkBytesPerSec {
+		d.reason = "cpu-bound"
+		return d
+	}
+	d.compress = true
+	return d
+}
+
+// linkBytesPerSec is the configured rate limit, or assumedLinkMbps without one
+func (s *Server) linkBytesPerSec() float64 {
+	mbps := s.RateLimitMbps
+	if mbps <= 0 {
+		mbps = assumedLinkMbps
+	}
+	return mbps * 1_000_000 / 8
+}
+
+// sampleCompression compresses the first compressionSampleSize bytes of path
+// and reports the ratio and throughput
+func sampleCompression(path string) (compressionSample, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return compressionSample{}, err
+	}
+	defer func() { _ = f.Close() }()
+
+	buf := make([]byte, compressionSampleSize)
+	n, err := io.ReadFull(f, buf)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return compressionSample{}, err
+	}
+	buf = buf[:n]
+
+	enc := sampleEncoder()
+	start := time.Now()
+	out := enc.EncodeAll(buf, make([]byte, 0, len(buf)))
+	elapsed := time.Since(start)
+
+	sample := compressionSample{ratio: float64(len(buf)) / float64(max(len(out), 1))}
+	if elapsed > 0 {
+		sample.bytesPerSec = float64(len(buf)) / elapsed.Seconds()
+	}
+	return sample, nil
+}
+
+// encodings lists the Content-Encodings the server offers, best first.
+// zstd is what the warp CLI asks for; browsers don't send it and get brotli,
+// then gzip.
+func (s *Server) encodings() []string {
+	if s.NoBrotli {
+		return []string{encodingZstd, encodingGzip}
+	}
+	return []string{encodingZstd, encodingBrotli, encodingGzip}
+}
+
+// chooseEncoding returns the first of serverPrefs the Accept-Encoding header
+// allows, or "" for identity. The server's order wins over the client's
+// q-values; only q=0 rules an encoding out. "*" accepts anything not listed.
+func chooseEncoding(acceptEncoding string, serverPrefs []string) string {
+	accepted := make(map[string]bool)
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(part, ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		accepted[name] = qualityAllows(params)
+	}
+	for _, enc := range serverPrefs {
+		if ok, listed := accepted[enc]; listed {
+			if ok {
+				return enc
+			}
+			continue
+		}
+		if accepted["*"] {
+			return enc
+		}
+	}
+	return ""
+}
+
+// qualityAllows reports whether the parameters of an Accept-Encoding entry
+// leave it acceptable: anything but an explicit q=0. A malformed q-value
+// is ignored.
+func qualityAllows(params string) bool {
+	for _, p := range strings.Split(params, ";") {
+		key, val, ok := strings.Cut(strings.TrimSpace(p), "=")
+		if !ok || !strings.EqualFold(strings.TrimSpace(key), "q") {
+			continue
+		}
+		if q, err := strconv.ParseFloat(strings.TrimSpace(val), 64); err == nil {
+			return q > 0
+		}
+	}
+	return true
+}
+
+// newEncoder wraps w in the writer for encoding, which must be one of the
+// encodings constants. Closing it flushes the stream but not w.
+func newEncoder(encoding string, w io.Writer, zstdLevel zstd.EncoderLevel) (io.WriteCloser, error) {
+	switch encoding {
+	case encodingZstd:
+		return zstd.NewWriter(w, zstd.WithEncoderLevel(zstdLevel))
+	case encodingBrotli:
+		return brotli.NewWriterLevel(w, brotliLevel), nil
+	case encodingGzip:
+		return gzip.NewWriter(w), nil
+	}
+	return nil, fmt.Errorf("unsupported encoding %q", encoding)
+}
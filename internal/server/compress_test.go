@@ -0,0 +1,163 @@
+package server
+
+import (
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeSampleFile(t *testing.T, name string, data []byte) (string, os.FileInfo) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path, fi
+}
+
+func repetitiveText(size int) []byte {
+	line := `{"level":"info","msg":"request served","status":200,"path":"/api/items"}` + "\n"
+	return []byte(strings.Repeat(line, size/len(line)+1)[:size])
+}
+
+func TestCompressionDecisionRandomData(t *testing.T) {
+	data := make([]byte, 512<<10)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatal(err)
+	}
+	path, fi := writeSampleFile(t, "random.dat", data)
+
+	s := &Server{RateLimitMbps: 10}
+	d := s.compressionFor(path, fi)
+	if d.compress {
+		t.Errorf("random data should not be compressed: %s", d.describe("zstd"))
+	}
+	if d.reason != "sampled" || d.ratio >= minCompressionRatio {
+		t.Errorf("decision = %+v, want a sampled ratio below %.1f", d, minCompressionRatio)
+	}
+}
+
+func TestCompressionDecisionRepetitiveText(t *testing.T) {
+	path, fi := writeSampleFile(t, "events.dat", repetitiveText(512<<10))
+
+	// A slow link keeps the CPU check from depending on the machine
+	s := &Server{RateLimitMbps: 10}
+	d := s.compressionFor(path, fi)
+	if !d.compress {
+		t.Fatalf("repetitive text should be compressed: %s", d.describe("zstd"))
+	}
+	if d.ratio < 3 {
+		t.Errorf("sampled ratio = %.1f, want at least 3", d.ratio)
+	}
+	if got := d.describe("zstd"); !strings.HasPrefix(got, "zstd (sampled ratio ") {
+		t.Errorf("describe = %q", got)
+	}
+}
+
+func TestCompressionDecisionFastPaths(t *testing.T) {
+	big := repetitiveText(64 << 10)
+	tests := []struct {
+		name     string
+		data     []byte
+		compress bool
+		reason   string
+	}{
+		{"notes.txt", big, true, "extension"},
+		{"photo.jpg", big, false, "extension"},
+		{"icon.svg", []byte(`<svg xmlns="http://www.w3.org/2000/svg"/>`), false, "small"},
+	}
+	for _, tt := range tests {
+		path, fi := writeSampleFile(t, tt.name, tt.data)
+		d := (&Server{}).compressionFor(path, fi)
+		if d.compress != tt.compress || d.reason != tt.reason || d.ratio != 0 {
+			t.Errorf("%s: decision = %+v, want compress=%v reason=%s unsampled", tt.name, d, tt.compress, tt.reason)
+		}
+	}
+}
+
+func TestDecideFromSampleCPUBound(t *testing.T) {
+	link := float64(100 << 20)
+	if d := decideFromSample(compressionSample{ratio: 4, bytesPerSec: link / 2}, link); d.compress || d.reason != "cpu-bound" {
+		t.Errorf("slow encoder: decision = %+v, want cpu-bound", d)
+	}
+	if d := decideFromSample(compressionSample{ratio: 4, bytesPerSec: link * 2}, link); !d.compress {
+		t.Errorf("fast encoder: decision = %+v, want compress", d)
+	}
+	if d := decideFromSample(compressionSample{ratio: 1.1, bytesPerSec: link * 2}, link); d.compress {
+		t.Errorf("low ratio: decision = %+v, want no compression", d)
+	}
+}
+
+func TestCompressionDecisionCache(t *testing.T) {
+	path, fi := writeSampleFile(t, "data.bin", repetitiveText(64<<10))
+	s := &Server{RateLimitMbps: 10}
+	if d := s.compressionFor(path, fi); !d.compress {
+		t.Fatalf("decision = %+v, want compress", d)
+	}
+
+	// Replace the content with random bytes of the same size: the decision is
+	// reused until the modification time changes
+	data := make([]byte, fi.Size())
+	if _, err := rand.Read(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, fi.ModTime(), fi.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+	if d := s.compressionFor(path, fi); !d.compress {
+		t.Errorf("cached decision not reused: %+v", d)
+	}
+
+	later := fi.ModTime().Add(time.Second)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	fi2, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := s.compressionFor(path, fi2); d.compress {
+		t.Errorf("stale decision reused after modification: %+v", d)
+	}
+}
+
+func TestChooseEncoding(t *testing.T) {
+	all := []string{encodingZstd, encodingBrotli, encodingGzip}
+	noBrotli := []string{encodingZstd, encodingGzip}
+	tests := []struct {
+		name, accept string
+		prefs        []string
+		want         string
+	}{
+		{"warp cli", "zstd, gzip", all, "zstd"},
+		{"chrome", "gzip, deflate, br, zstd", all, "zstd"},
+		{"firefox", "gzip, deflate, br", all, "br"},
+		{"safari without brotli switch", "gzip, deflate, br", noBrotli, "gzip"},
+		{"gzip only", "gzip", all, "gzip"},
+		{"none", "", all, ""},
+		{"identity", "identity", all, ""},
+		{"upper case", "GZIP, BR", all, "br"},
+		{"q values ignored for order", "gzip;q=1.0, br;q=0.5", all, "br"},
+		{"q=0 refuses", "br;q=0, gzip", all, "gzip"},
+		{"q=0 with spaces", "zstd ; q=0.0 , gzip", all, "gzip"},
+		{"malformed q keeps entry", "br;q=high", all, "br"},
+		{"wildcard", "*", all, "zstd"},
+		{"wildcard minus refused", "zstd;q=0, *", all, "br"},
+		{"substring is not a match", "x-gzip-ish", all, ""},
+	}
+	for _, tt := range tests {
+		if got := chooseEncoding(tt.accept, tt.prefs); got != tt.want {
+			t.Errorf("%s: chooseEncoding(%q) = %q, want %q", tt.name, tt.accept, got, tt.want)
+		}
+	}
+}
@@ -14,19 +14,25 @@ const (
 	WebSocketWriteBuffer    = 1024
 )
 
-// Session management
+// Session management. Idle upload sessions expire after
+// Limits.MaxSessionIdleTime; StaleSessionThreshold keeps finished verify jobs.
 const (
 	SessionCleanupInterval = 15 * time.Minute
 	StaleSessionThreshold  = 1 * time.Hour
 )
 
-// Upload limits
+// Upload limits; the configurable ones are in protocol.Limits
 const (
-	MaxUploadSize     = 10 << 30 // 10GB
 	MaxPartSize       = 10 << 30 // 10GB
 	MaxFilenameLength = 255
 )
 
+// Upload parameters recommended by the manifest
+const (
+	ManifestChunkSize     = 2 << 20 // 2MB
+	ManifestMaxConcurrent = 3
+)
+
 // Buffer sizes
 const (
 	MinBufferSize     = protocol.BufferSizeSmall     // 8KB
@@ -34,6 +40,12 @@ const (
 	MaxBufferSize     = protocol.BufferSizeVeryLarge // 4MB
 )
 
+// Low-memory mode (--low-memory)
+const (
+	LowMemoryBufferSize        = protocol.BufferSizeMedium // 64KB, the largest pool tier used
+	LowMemoryWebSocketInterval = time.Second
+)
+
 // TCP tuning
 const (
 	TCPKeepAlivePeriod   = 3 * time.Minute
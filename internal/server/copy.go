@@ -0,0 +1,63 @@
+package server
+
+import (
+	"io"
+	"net"
+	"os"
+
+	"github.com/zulfikawr/warp/internal/protocol"
+)
+
+// copyStep is how many bytes stepCopy moves between progress updates
+const copyStep = 4 << 20
+
+// stepCopy copies src to dst until EOF, calling progress after every
+// copyStep bytes. Each step is a plain io.Copy of an *io.LimitedReader,
+// which *os.File and net/http responses accept in their ReadFrom fast paths
+// (splice from a socket, sendfile or copy_file_range from a file), so the
+// bytes don't pass through a user-space buffer the way a wrapping reader
+// such as progressReader forces them to. A src that is itself an
+// *io.LimitedReader is unwrapped, since those fast paths look through one
+// level only, and its N is kept up to date.
+func stepCopy(dst io.Writer, src io.Reader, progress func(n int64)) (int64, error) {
+	limit := int64(-1)
+	outer, limited := src.(*io.LimitedReader)
+	if limited {
+		limit, src = outer.N, outer.R
+	}
+	var written int64
+	for limit < 0 || written < limit {
+		step := int64(copyStep)
+		if limit >= 0 {
+			step = min(step, limit-written)
+		}
+		n, err := io.Copy(dst, &io.LimitedReader{R: src, N: step})
+		written += n
+		if limited {
+			outer.N -= n
+		}
+		if n > 0 {
+			progress(n)
+		}
+		if err != nil || n < step {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// receiveBody copies n bytes of a hijacked raw upload from conn to f. On
+// Linux the file splices them from the socket through a pipe (os.File's
+// ReadFrom, reached by stepCopy), so they never enter user space; the
+// runtime retries partial splices and waits out EAGAIN on the connection's
+// poller. With NoSplice they go through a pooled buffer instead, the escape
+// hatch for a kernel or filesystem where splice misbehaves.
+func (s *Server) receiveBody(f *os.File, conn net.Conn, n int64, pt *ProgressTracker) (int64, error) {
+	if !s.NoSplice {
+		return stepCopy(f, io.LimitReader(conn, n), pt.UpdateProgress)
+	}
+	bufPtr := getBuffer(s.bufferSize(protocol.GetOptimalBufferSize(n)))
+	defer putBuffer(bufPtr)
+	// Hiding the file's ReadFrom keeps io.CopyBuffer on the buffer
+	return io.CopyBuffer(struct{ io.Writer }{f}, &progressReader{r: io.LimitReader(conn, n), pt: pt}, *bufPtr)
+}
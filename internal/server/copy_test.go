@@ -0,0 +1,341 @@
+package server
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/zulfikawr/warp/internal/crypto"
+	"github.com/zulfikawr/warp/internal/protocol"
+)
+
+func TestStepCopy(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789abcdef"), (2*copyStep+100)/16)
+	tests := []struct {
+		name  string
+		limit int64 // -1: none
+		want  int64
+	}{
+		{"to EOF", -1, int64(len(data))},
+		{"within a step", 100, 100},
+		{"exactly one step", copyStep, copyStep},
+		{"several steps", 2*copyStep + 10, 2*copyStep + 10},
+		{"limit past EOF", int64(len(data)) + 5, int64(len(data))},
+		{"zero", 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var src io.Reader = bytes.NewReader(data)
+			lr, limited := src, false
+			if tt.limit >= 0 {
+				lr, limited = io.LimitReader(src, tt.limit), true
+			}
+			var dst bytes.Buffer
+			var progress int64
+			n, err := stepCopy(&dst, lr, func(n int64) {
+				if n > copyStep {
+					t.Errorf("progress step of %d bytes", n)
+				}
+				progress += n
+			})
+			if err != nil || n != tt.want {
+				t.Fatalf("stepCopy = %d, %v; want %d", n, err, tt.want)
+			}
+			if progress != n || !bytes.Equal(dst.Bytes(), data[:n]) {
+				t.Errorf("progress %d, copied %d bytes; want %d of the source", progress, dst.Len(), n)
+			}
+			if limited {
+				if left := lr.(*io.LimitedReader).N; left != tt.limit-n {
+					t.Errorf("limit left = %d, want %d", left, tt.limit-n)
+				}
+			}
+		})
+	}
+}
+
+func TestProgressWriterReadFrom(t *testing.T) {
+	data := strings.Repeat("x", copyStep+1)
+	for _, tt := range []struct {
+		name string
+		w    func(*bytes.Buffer) io.Writer
+	}{
+		{"reader from", func(b *bytes.Buffer) io.Writer { return b }},
+		{"plain writer", func(b *bytes.Buffer) io.Writer { return struct{ io.Writer }{b} }},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			pt := &ProgressTracker{}
+			n, err := io.Copy(&progressWriter{w: tt.w(&buf), pt: pt}, strings.NewReader(data))
+			if err != nil || n != int64(len(data)) || buf.String() != data {
+				t.Fatalf("copied %d, %v", n, err)
+			}
+			if pt.BytesWritten != n {
+				t.Errorf("progress = %d, want %d", pt.BytesWritten, n)
+			}
+		})
+	}
+}
+
+// TestRawUploadReadAhead sends a raw upload whose headers and body arrive
+// together, so part of the body is already buffered by net/http when the
+// handler hijacks the connection and the rest is read from it directly
+func TestRawUploadReadAhead(t *testing.T) {
+	tok, _ := crypto.GenerateToken(nil)
+	s := &Server{Token: tok, HostMode: true, UploadDir: t.TempDir()}
+	ts := httptest.NewServer(s.routes())
+	defer ts.Close()
+
+	body := bytes.Repeat([]byte("warp"), copyStep/2)
+	conn, err := net.Dial("tcp", ts.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+	req := "POST " + protocol.UploadPathPrefix + tok + " HTTP/1.1\r\nHost: warp\r\nX-File-Name: ahead.bin\r\n" +
+		"Content-Length: " + strconv.Itoa(len(body)) + "\r\n\r\n"
+	if _, err := conn.Write(append([]byte(req), body...)); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := io.ReadAll(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(resp, []byte("HTTP/1.1 200")) {
+		t.Fatalf("response %q", resp)
+	}
+	got, err := os.ReadFile(filepath.Join(s.UploadDir, "ahead.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, body) {
+		t.Errorf("saved %d bytes, want the %d sent", len(got), len(body))
+	}
+}
+
+// TestRawUploadNoSplice uploads the same file with and without --no-splice
+// and checks both land byte for byte, whether the body follows the headers
+// at once or only after 100 Continue
+func TestRawUploadNoSplice(t *testing.T) {
+	data := make([]byte, 2*copyStep+12345)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatal(err)
+	}
+	want := sha256.Sum256(data)
+	for _, noSplice := range []bool{false, true} {
+		for _, expect := range []bool{false, true} {
+			tok, _ := crypto.GenerateToken(nil)
+			s := &Server{Token: tok, HostMode: true, UploadDir: t.TempDir(), NoSplice: noSplice}
+			ts := httptest.NewServer(s.routes())
+			req, _ := http.NewRequest(http.MethodPost, ts.URL+protocol.UploadPathPrefix+tok, bytes.NewReader(data))
+			req.Header.Set("X-File-Name", "data.bin")
+			if expect {
+				req.Header.Set("Expect", "100-continue")
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_ = resp.Body.Close()
+			ts.Close()
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("no-splice %v, expect %v: status %d", noSplice, expect, resp.StatusCode)
+			}
+			got, err := os.ReadFile(filepath.Join(s.UploadDir, "data.bin"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if sha256.Sum256(got) != want {
+				t.Errorf("no-splice %v, expect %v: saved %d bytes that don't match the %d sent", noSplice, expect, len(got), len(data))
+			}
+		}
+	}
+}
+
+// benchSize is the file moved by each benchmark run: 2GB, or 64MB with
+// -short. Run with -benchtime=1x.
+func benchSize() int64 {
+	if testing.Short() {
+		return 64 << 20
+	}
+	return 2 << 30
+}
+
+// BenchmarkCopyConnToFile compares the raw upload copy from a TCP
+// connection into a file with --no-splice, through progressReader and a
+// pooled buffer, and without, where the file splices from the socket. The
+// CPU time per run, which includes the in-process sender, shows what the
+// splice saves.
+func BenchmarkCopyConnToFile(b *testing.B) {
+	size := benchSize()
+	for _, tt := range []struct {
+		name     string
+		noSplice bool
+	}{{"buffered", true}, {"splice", false}} {
+		s := &Server{NoSplice: tt.noSplice}
+		b.Run(tt.name, func(b *testing.B) {
+			b.SetBytes(size)
+			cpuStart, cpuKnown := processCPU()
+			for i := 0; i < b.N; i++ {
+				ln, err := net.Listen("tcp", "127.0.0.1:0")
+				if err != nil {
+					b.Fatal(err)
+				}
+				go sendZeros(ln.Addr().String(), size)
+				conn, err := ln.Accept()
+				if err != nil {
+					b.Fatal(err)
+				}
+				f, err := os.Create(filepath.Join(b.TempDir(), "upload.bin"))
+				if err != nil {
+					b.Fatal(err)
+				}
+				if n, err := s.receiveBody(f, conn, size, &ProgressTracker{}); err != nil || n != size {
+					b.Fatalf("copied %d of %d: %v", n, size, err)
+				}
+				_ = f.Close()
+				_ = conn.Close()
+				_ = ln.Close()
+			}
+			if cpuEnd, ok := processCPU(); cpuKnown && ok {
+				b.ReportMetric(float64((cpuEnd-cpuStart).Milliseconds())/float64(b.N), "cpu-ms/op")
+			}
+		})
+	}
+}
+
+// sendZeros writes size zero bytes to a TCP connection to addr
+func sendZeros(addr string, size int64) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return
+	}
+	defer func() { _ = conn.Close() }()
+	_, _ = io.Copy(conn, io.LimitReader(zeros{}, size))
+}
+
+type zeros struct{}
+
+func (zeros) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
+
+// BenchmarkCopyFileToResponse compares serving a file through progressWriter
+// without its ReadFrom, as it used to be, and with it, which reaches
+// sendfile in net/http
+func BenchmarkCopyFileToResponse(b *testing.B) {
+	size := benchSize()
+	path := filepath.Join(b.TempDir(), "download.bin")
+	if err := os.WriteFile(path, nil, 0o600); err != nil {
+		b.Fatal(err)
+	}
+	if err := os.Truncate(path, size); err != nil {
+		b.Fatal(err)
+	}
+	for _, name := range []string{"buffered", "step"} {
+		b.Run(name, func(b *testing.B) {
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				f, err := os.Open(path)
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+				defer func() { _ = f.Close() }()
+				w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+				var writer io.Writer = &progressWriter{w: w, pt: &ProgressTracker{}}
+				if name == "buffered" {
+					writer = struct{ io.Writer }{writer}
+				}
+				_, _ = io.Copy(writer, f)
+			}))
+			defer ts.Close()
+			b.SetBytes(size)
+			for i := 0; i < b.N; i++ {
+				resp, err := http.Get(ts.URL)
+				if err != nil {
+					b.Fatal(err)
+				}
+				n, err := io.Copy(io.Discard, resp.Body)
+				_ = resp.Body.Close()
+				if err != nil || n != size {
+					b.Fatalf("downloaded %d of %d: %v", n, size, err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkRawUpload sends a file as one raw upload to a host-mode server
+func BenchmarkRawUpload(b *testing.B) {
+	size := benchSize()
+	tok, _ := crypto.GenerateToken(nil)
+	s := &Server{Token: tok, HostMode: true, UploadDir: b.TempDir()}
+	ts := httptest.NewServer(s.routes())
+	defer ts.Close()
+	b.SetBytes(size)
+	for i := 0; i < b.N; i++ {
+		req, _ := http.NewRequest(http.MethodPost, ts.URL+protocol.UploadPathPrefix+tok, io.LimitReader(zeros{}, size))
+		req.ContentLength = size
+		req.Header.Set("X-File-Name", "bench.bin")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			b.Fatal(err)
+		}
+		_ = resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			b.Fatalf("status %d", resp.StatusCode)
+		}
+		b.StopTimer()
+		entries, _ := os.ReadDir(s.UploadDir)
+		for _, e := range entries {
+			_ = os.Remove(filepath.Join(s.UploadDir, e.Name()))
+		}
+		b.StartTimer()
+	}
+}
+
+// BenchmarkDownload fetches a shared file from a send-mode server,
+// uncompressed. Its checksum is cached first, so the run times the transfer
+// alone.
+func BenchmarkDownload(b *testing.B) {
+	size := benchSize()
+	path := filepath.Join(b.TempDir(), "download.bin")
+	if err := os.WriteFile(path, nil, 0o600); err != nil {
+		b.Fatal(err)
+	}
+	if err := os.Truncate(path, size); err != nil {
+		b.Fatal(err)
+	}
+	tok, _ := crypto.GenerateToken(nil)
+	s := &Server{Token: tok, SrcPath: path}
+	if fi, err := os.Stat(path); err == nil {
+		_, _ = s.checksumFor(fi)
+	}
+	ts := httptest.NewServer(s.routes())
+	defer ts.Close()
+	b.SetBytes(size)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		// The zeros would otherwise be compressed
+		req, _ := http.NewRequest(http.MethodGet, ts.URL+protocol.PathPrefix+tok, nil)
+		req.Header.Set("Accept-Encoding", "identity")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			b.Fatal(err)
+		}
+		n, err := io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+		if err != nil || n != size {
+			b.Fatalf("downloaded %d of %d: %v", n, size, err)
+		}
+	}
+}
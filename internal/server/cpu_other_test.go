@@ -0,0 +1,10 @@
+//go:build !unix
+
+package server
+
+import "time"
+
+// processCPU is unknown here; benchmarks leave out their CPU time
+func processCPU() (time.Duration, bool) {
+	return 0, false
+}
@@ -0,0 +1,57 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// DefaultDirMode is the mode of upload directories when DirMode is unset
+const DefaultDirMode os.FileMode = 0o755
+
+// dirMode returns the mode for directories created for uploads
+func (s *Server) dirMode() os.FileMode {
+	if s.DirMode == 0 {
+		return DefaultDirMode
+	}
+	return s.DirMode
+}
+
+// mkdirUpload creates an upload directory, and any missing parents, with
+// DirMode
+func (s *Server) mkdirUpload(dir string) error {
+	return MkdirMode(dir, s.dirMode())
+}
+
+// MkdirMode creates dir and any missing parents like os.MkdirAll. When dir
+// itself is new it gets exactly mode, whatever the umask; an existing
+// directory keeps its permissions.
+func MkdirMode(dir string, mode os.FileMode) error {
+	if _, err := os.Stat(dir); err == nil {
+		return nil
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err := os.MkdirAll(dir, mode); err != nil {
+		return err
+	}
+	return os.Chmod(dir, mode)
+}
+
+// PrepareUploadDir creates dir with mode if it's missing, then checks that
+// uploads can be written there by creating and removing a probe file, so a
+// read-only destination fails at startup rather than on the first upload.
+func PrepareUploadDir(dir string, mode os.FileMode) error {
+	if err := MkdirMode(dir, mode); err != nil {
+		return err
+	}
+	probe, err := os.CreateTemp(dir, ".warp-probe-*")
+	if err != nil {
+		return fmt.Errorf("destination is not writable: %w", err)
+	}
+	_ = probe.Close()
+	if err := os.Remove(probe.Name()); err != nil {
+		return fmt.Errorf("cannot remove probe file: %w", err)
+	}
+	return nil
+}
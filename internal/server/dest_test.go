@@ -0,0 +1,90 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// assertMode checks dir's permission bits; Windows has no such bits to check
+func assertMode(t *testing.T, dir string, want os.FileMode) {
+	t.Helper()
+	fi, err := os.Stat(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runtime.GOOS == "windows" {
+		return
+	}
+	if got := fi.Mode().Perm(); got != want {
+		t.Errorf("%s has mode %04o, want %04o", dir, got, want)
+	}
+}
+
+func TestMkdirMode(t *testing.T) {
+	base := t.TempDir()
+
+	// Exact mode on the new directory, even for bits the umask would clear
+	dir := filepath.Join(base, "a", "b")
+	if err := MkdirMode(dir, 0o770); err != nil {
+		t.Fatal(err)
+	}
+	assertMode(t, dir, 0o770)
+
+	// An existing directory is left alone
+	if err := os.Chmod(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := MkdirMode(dir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	assertMode(t, dir, 0o755)
+}
+
+func TestPrepareUploadDir(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "uploads")
+	if err := PrepareUploadDir(dir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	assertMode(t, dir, 0o700)
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("probe file left behind: %v", entries)
+	}
+}
+
+func TestPrepareUploadDirNotWritable(t *testing.T) {
+	base := t.TempDir()
+
+	// A file in the way fails whoever runs the test
+	file := filepath.Join(base, "file")
+	if err := os.WriteFile(file, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := PrepareUploadDir(filepath.Join(file, "uploads"), 0o755); err == nil {
+		t.Error("expected an error for a destination under a file")
+	}
+
+	if runtime.GOOS == "windows" || os.Geteuid() == 0 {
+		t.Skip("directory permissions don't stop root or Windows")
+	}
+	readOnly := filepath.Join(base, "ro")
+	if err := os.Mkdir(readOnly, 0o500); err != nil {
+		t.Fatal(err)
+	}
+	err := PrepareUploadDir(readOnly, 0o755)
+	if err == nil || !strings.Contains(err.Error(), "not writable") {
+		t.Errorf("got %v, want a not writable error", err)
+	}
+}
+
+func TestUploadSubdirectoriesUseDirMode(t *testing.T) {
+	s, ts, clock := organizedServer(t, OrganizeDate)
+	s.DirMode = 0o700
+	clock.Store(time.Date(2026, 3, 10, 12, 0, 0, 0, time.Local).UnixNano())
+
+	rawUpload(t, ts, s.Token, "a.txt", []byte("hello"), nil)
+	assertMode(t, filepath.Join(s.UploadDir, "2026-03-10"), 0o700)
+}
@@ -1,16 +1,18 @@
 package server
 
 import (
-	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"github.com/klauspost/compress/zstd"
-	"github.com/zulfikawr/warp/internal/logging"
 	"go.uber.org/zap"
 	"io"
 	"net/http"
 	"os"
 	"path/filepath"
 	"runtime"
+	"strconv"
 	"strings"
 	"time"
 
@@ -20,32 +22,43 @@ import (
 	"github.com/zulfikawr/warp/internal/ui"
 )
 
+// activeDownload counts requests under /d/ as active downloads while next
+// serves them
+func activeDownload(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		metrics.ActiveDownloads.Inc()
+		metrics.ActiveTransfers.Inc()
+		defer func() {
+			metrics.ActiveDownloads.Dec()
+			metrics.ActiveTransfers.Dec()
+		}()
+		next(w, r)
+	}
+}
+
 // handleDownload serves the file or directory for download with various optimizations
 func (s *Server) handleDownload(w http.ResponseWriter, r *http.Request) {
 	startTime := time.Now()
-	metrics.ActiveDownloads.Inc()
-	metrics.ActiveTransfers.Inc()
-	defer func() {
-		metrics.ActiveDownloads.Dec()
-		metrics.ActiveTransfers.Dec()
-	}()
-
-	// Expect /d/{token}
-	p := strings.TrimPrefix(r.URL.Path, protocol.PathPrefix)
-	if p != s.Token {
-		http.Error(w, "forbidden", http.StatusForbidden)
+	s.lastAccess.Store(time.Now().UnixNano())
+	if !s.checkQuota(w, r) {
 		return
 	}
+	release, ok := s.acquireTransfer(w)
+	if !ok {
+		return
+	}
+	defer release()
+	id, log := startTransfer(w, r, "")
 
 	// If TextContent is set, serve text securely
 	if s.TextContent != "" {
 		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 		w.Header().Set("Content-Length", fmt.Sprintf("%d", len(s.TextContent)))
 		// Prevent caching of sensitive text content
-		w.Header().Set("Cache-Control", "no-store, no-cache, must-revalidate, max-age=0")
-		w.Header().Set("Pragma", "no-cache")
-		w.Header().Set("Expires", "0")
-		_, _ = w.Write([]byte(s.TextContent))
+		setNoCache(w.Header())
+		if _, err := w.Write([]byte(s.TextContent)); err == nil {
+			s.countDownload(false)
+		}
 		return
 	}
 
@@ -54,51 +67,67 @@ func (s *Server) handleDownload(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "not found", http.StatusNotFound)
 		return
 	}
+	if s.ServeAsText && !fi.IsDir() {
+		s.serveTextFile(w, r, fi.Size())
+		return
+	}
+	if s.Follow && !fi.IsDir() {
+		s.serveFollow(w, r, id, log)
+		return
+	}
 	if fi.IsDir() {
 		w.Header().Set("Content-Type", "application/zip")
-		name := filepath.Base(s.SrcPath) + ".zip"
+		name := s.archiveName()
+		// Zipped on the fly, so the size is unknown and the checksum follows
+		// the body as a trailer. It covers the body as sent, after any
+		// Content-Encoding, which is what the receiver can hash too.
+		w.Header().Set("Trailer", protocol.ContentSHA256Header)
+		sum := sha256.New()
+		body := &progressWriter{w: io.MultiWriter(w, sum), pt: s.trackTransfer(id, name, protocol.DirectionDownload, 0, s.clientIP(r))}
+		completed := false
+		defer func() { s.finishDownload(id, completed, nil, log) }()
 		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", name))
-		// If client supports zstd or gzip, wrap the writer so the transmitted zip is compressed
-		enc := strings.ToLower(r.Header.Get("Accept-Encoding"))
-		if strings.Contains(enc, "zstd") {
-			w.Header().Set("Content-Encoding", "zstd")
+		// If the client accepts an encoding, wrap the writer so the transmitted zip is compressed
+		if enc := chooseEncoding(r.Header.Get("Accept-Encoding"), s.encodings()); enc != "" && !s.LowMemory {
+			w.Header().Set("Content-Encoding", enc)
 			// Let transfer encoding decide length
 			w.Header().Del("Content-Length")
-			zw, err := zstd.NewWriter(w)
+			zw, err := newEncoder(enc, body, zstd.SpeedDefault)
 			if err != nil {
 				http.Error(w, "zip error", http.StatusInternalServerError)
 				return
 			}
-			defer zw.Close()
-			if err := ZipDirectoryWithProgress(zw, s.SrcPath, os.Stderr); err != nil {
+			if err := s.zipSource(zw, os.Stderr); err != nil {
+				_ = zw.Close()
 				http.Error(w, "zip error", http.StatusInternalServerError)
+				return
 			}
-			return
-		}
-		if strings.Contains(enc, "gzip") {
-			w.Header().Set("Content-Encoding", "gzip")
-			w.Header().Del("Content-Length")
-			gw := gzip.NewWriter(w)
-			defer gw.Close()
-			if err := ZipDirectoryWithProgress(gw, s.SrcPath, os.Stderr); err != nil {
-				http.Error(w, "zip error", http.StatusInternalServerError)
+			// The encoder's last frame has to be hashed before the trailer is set
+			if err := zw.Close(); err != nil {
+				return
 			}
-			return
-		}
-		// Default: no outer encoding, stream raw zip
-		if err := ZipDirectoryWithProgress(w, s.SrcPath, os.Stderr); err != nil {
+		} else if err := s.zipSource(body, os.Stderr); err != nil {
+			// Default: no outer encoding, stream raw zip
 			http.Error(w, "zip error", http.StatusInternalServerError)
+			return
 		}
+		w.Header().Set(protocol.ContentSHA256Header, hex.EncodeToString(sum.Sum(nil)))
+		completed = true
 		return
 	}
-	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filepath.Base(s.SrcPath)))
+	pt := s.trackTransfer(id, filepath.Base(s.SrcPath), protocol.DirectionDownload, fi.Size(), s.clientIP(r))
+	completed := false
+	// What of the file went out, when the body is the file's own bytes
+	var served *servedRange
+	defer func() { s.finishDownload(id, completed, served, log) }()
+	key := rangeKey{ip: s.clientIP(r), userAgent: r.UserAgent(), token: s.Token}
+	protocol.SetFileAttrHeaders(w.Header(), fi)
 
 	// Check if client supports compression and file is compressible
-	encHeader := r.Header.Get("Accept-Encoding")
-	acceptsZstd := strings.Contains(encHeader, "zstd")
-	acceptsGzip := strings.Contains(encHeader, "gzip")
-	// Prefer zstd when available
-	shouldCompress := (acceptsZstd || acceptsGzip) && isCompressible(s.SrcPath) && fi.Size() > 1024 // Only compress files > 1KB
+	encoding := chooseEncoding(r.Header.Get("Accept-Encoding"), s.encodings())
+	// Extension fast path, otherwise a sampled ratio weighed against the link speed
+	compression := s.compressionFor(s.SrcPath, fi)
+	shouldCompress := encoding != "" && compression.compress
 
 	// Support resumable downloads via Range headers
 	f, err := os.Open(s.SrcPath)
@@ -113,10 +142,10 @@ func (s *Server) handleDownload(w http.ResponseWriter, r *http.Request) {
 	var isEncrypted bool
 	if val, ok := s.tokenKeys.Load(s.Token); ok {
 		key := val.([]byte)
-		logging.Info("Found key for token in tokenKeys", zap.String("token", s.Token), zap.Int("keyLen", len(key)))
+		log.Info("Found key for token in tokenKeys", zap.String("token", s.Token), zap.Int("keyLen", len(key)))
 		encReader, err := crypto.NewEncryptReader(f, key)
 		if err != nil {
-			logging.Error("Failed to create encrypt reader", zap.Error(err))
+			log.Error("Failed to create encrypt reader", zap.Error(err))
 			http.Error(w, "encryption error", http.StatusInternalServerError)
 			return
 		}
@@ -125,104 +154,130 @@ func (s *Server) handleDownload(w http.ResponseWriter, r *http.Request) {
 		// Range requests and compression don't work with our chunked encryption
 		shouldCompress = false
 	} else {
-		logging.Info("No key found for token", zap.String("token", s.Token))
+		log.Info("No key found for token", zap.String("token", s.Token))
+	}
+
+	// An encrypted body means nothing to a browser, whatever the file is
+	contentType := "application/octet-stream"
+	if !isEncrypted {
+		contentType = contentTypeFor(s.SrcPath, f)
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Disposition", contentDisposition(s.Inline && isPreviewable(contentType), filepath.Base(s.SrcPath)))
+	// Tell receivers up front whether a partial file can be resumed
+	if !isEncrypted {
+		w.Header().Set("Accept-Ranges", "bytes")
 	}
 
 	// Apply rate limiting if configured
-	clientIP := getClientIP(r)
+	clientIP := s.clientIP(r)
 	var writer io.Writer = w
 	if limiter := s.getRateLimiter(clientIP); limiter != nil {
 		writer = &RateLimitedWriter{w: w, limiter: limiter}
 		metrics.RateLimitedRequests.WithLabelValues(clientIP).Inc()
 	}
+	// Counts bytes on the wire: compressed or encrypted bodies differ from the file size
+	writer = &progressWriter{w: writer, pt: pt}
 
-	rangeHeader := r.Header.Get("Range")
-	if rangeHeader != "" && strings.HasPrefix(rangeHeader, "bytes=") && reader == f {
-		// Range requests only supported for unencrypted files
-		// Parse Range: bytes=start-end
-		rangeSpec := strings.TrimPrefix(rangeHeader, "bytes=")
-		var start int64
-		if _, err := fmt.Sscanf(rangeSpec, "%d-", &start); err == nil && start > 0 {
-			if _, err := f.Seek(start, 0); err == nil {
-				w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, fi.Size()-1, fi.Size()))
-				w.Header().Set("Content-Length", fmt.Sprintf("%d", fi.Size()-start))
-				w.WriteHeader(http.StatusPartialContent)
-				_, _ = io.Copy(writer, f)
-				logging.Info("Resumed download", zap.Int64("start", start), zap.String("filename", filepath.Base(s.SrcPath)))
+	// Range requests only supported for unencrypted files. A whole-file
+	// range is served as a plain 200.
+	if start, end, ok := parseByteRange(r.Header.Get("Range"), fi.Size()); ok && reader == f && (start > 0 || end < fi.Size()-1) {
+		if _, err := f.Seek(start, io.SeekStart); err == nil {
+			length := end - start + 1
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, fi.Size()))
+			w.Header().Set("Content-Length", fmt.Sprintf("%d", length))
+			if !s.startBody(w, pt, fi, log) {
 				return
 			}
+			w.WriteHeader(http.StatusPartialContent)
+			n, err := io.CopyN(writer, f, length)
+			if errors.Is(err, io.EOF) {
+				err = nil // short copy, reported by finishBody
+			}
+			served = &servedRange{key: key, size: fi.Size(), start: start, n: n}
+			unchanged := s.finishBody(fi, n, length, err, log)
+			completed = unchanged && err == nil
+			if unchanged && start > 0 {
+				log.Info("Resumed download", zap.Int64("start", start), zap.String("filename", filepath.Base(s.SrcPath)))
+			}
+			return
 		}
 	}
 
 	// Serve with compression if applicable
 	if shouldCompress {
 		// Compute checksum first (with caching)
-		checksum, err := s.getCachedChecksum(s.SrcPath)
+		checksum, err := s.checksumFor(fi)
+		if errors.Is(err, errSourceChanged) {
+			s.refuseChangedSource(w, log)
+			return
+		}
 		if err == nil {
 			w.Header().Set("X-Content-SHA256", checksum)
 		}
 
-		// Decide encoder preference
-		enc := strings.ToLower(r.Header.Get("Accept-Encoding"))
-		// Reset file to beginning
 		_, _ = f.Seek(0, 0)
-
-		if strings.Contains(enc, "zstd") {
-			w.Header().Set("Content-Encoding", "zstd")
-			w.Header().Del("Content-Length")
-			zw, err := zstd.NewWriter(writer)
-			if err != nil {
-				http.Error(w, "compression error", http.StatusInternalServerError)
-				return
-			}
-			_, _ = io.Copy(zw, f)
-			_ = zw.Close()
-			if checksum != "" {
-				logging.Info("Served file with zstd compression", zap.String("filename", filepath.Base(s.SrcPath)), zap.String("checksum", checksum[:16]+"..."))
-			}
+		w.Header().Set("Content-Encoding", encoding)
+		w.Header().Del("Content-Length") // Let the encoder decide the length
+		if !s.startBody(w, pt, fi, log) {
 			return
 		}
-
-		// Fallback to gzip if supported
-		if strings.Contains(enc, "gzip") {
-			w.Header().Set("Content-Encoding", "gzip")
-			w.Header().Del("Content-Length") // Let gzip set the length
-
-			// Reset file to beginning (already reset above)
-			gzipWriter := gzip.NewWriter(writer)
-			_, _ = io.Copy(gzipWriter, f)
-			_ = gzipWriter.Close()
-
-			if checksum != "" {
-				logging.Info("Served file with gzip compression", zap.String("filename", filepath.Base(s.SrcPath)), zap.String("checksum", checksum[:16]+"..."))
-			}
+		// zstd at level 1, the level the compression decision was sampled at
+		zw, err := newEncoder(encoding, writer, zstd.SpeedFastest)
+		if err != nil {
+			http.Error(w, "compression error", http.StatusInternalServerError)
 			return
 		}
+		n, err := io.Copy(zw, f)
+		_ = zw.Close()
+		unchanged := s.finishBody(fi, n, fi.Size(), err, log)
+		completed = unchanged && err == nil
+		if unchanged && checksum != "" {
+			log.Info("Served file with "+encoding+" compression", zap.String("filename", filepath.Base(s.SrcPath)), zap.String("compression", compression.describe(encoding)), zap.String("checksum", checksum[:16]+"..."))
+		}
+		return
+	}
+
+	if encoding != "" && !isEncrypted {
+		log.Info("Serving file uncompressed", zap.String("filename", filepath.Base(s.SrcPath)), zap.String("compression", compression.describe("")))
 	}
 
 	// Use zero-copy sendfile for large binary files on Linux (>10MB and not compressible)
 	// BUT: Skip sendfile for encrypted transfers since we need to stream through EncryptReader
-	if runtime.GOOS == "linux" && fi.Size() > 10*1024*1024 && !isCompressible(s.SrcPath) && !isEncrypted {
+	if runtime.GOOS == "linux" && fi.Size() > 10*1024*1024 && !compression.compress && !isEncrypted {
 		// Compute checksum before sending (with caching)
-		checksum, err := s.getCachedChecksum(s.SrcPath)
+		checksum, err := s.checksumFor(fi)
+		if errors.Is(err, errSourceChanged) {
+			s.refuseChangedSource(w, log)
+			return
+		}
 		if err == nil {
 			w.Header().Set("X-Content-SHA256", checksum)
 		}
 
 		// Set headers before attempting sendfile
-		w.Header().Set("Content-Type", "application/octet-stream")
 		w.Header().Set("Content-Length", fmt.Sprintf("%d", fi.Size()))
+		if !s.startBody(w, pt, fi, log) {
+			return
+		}
 
 		if err := sendfileZeroCopy(w, f, 0, fi.Size()); err == nil {
+			// sendfile doesn't report a count; the re-stat still catches changes
+			pt.UpdateProgress(fi.Size())
+			served = &servedRange{key: key, size: fi.Size(), n: fi.Size()}
+			if completed = s.finishBody(fi, fi.Size(), fi.Size(), nil, log); !completed {
+				return
+			}
 			if checksum != "" {
-				logging.Info("Served file using zero-copy sendfile", zap.String("filename", filepath.Base(s.SrcPath)), zap.String("size", ui.FormatBytes(fi.Size())), zap.String("checksum", checksum[:16]+"..."))
+				log.Info("Served file using zero-copy sendfile", zap.String("filename", filepath.Base(s.SrcPath)), zap.String("size", ui.FormatBytes(fi.Size())), zap.String("checksum", checksum[:16]+"..."))
 			} else {
-				logging.Info("Served file using zero-copy sendfile", zap.String("filename", filepath.Base(s.SrcPath)), zap.String("size", ui.FormatBytes(fi.Size())))
+				log.Info("Served file using zero-copy sendfile", zap.String("filename", filepath.Base(s.SrcPath)), zap.String("size", ui.FormatBytes(fi.Size())))
 			}
 			return
 		}
 		// If sendfile fails, fall back to normal method
-		logging.Warn("Sendfile failed, falling back to standard copy", zap.String("filename", filepath.Base(s.SrcPath)), zap.Error(err))
+		log.Warn("Sendfile failed, falling back to standard copy", zap.String("filename", filepath.Base(s.SrcPath)), zap.Error(err))
 		// Need to reopen file since sendfile may have consumed it
 		_ = f.Close()
 		f, err = os.Open(s.SrcPath)
@@ -245,45 +300,56 @@ func (s *Server) handleDownload(w http.ResponseWriter, r *http.Request) {
 
 	// Normal full file download without compression (fallback)
 	// Compute checksum for integrity verification (with caching)
-	checksum, err := s.getCachedChecksum(s.SrcPath)
+	checksum, err := s.checksumFor(fi)
+	if errors.Is(err, errSourceChanged) {
+		s.refuseChangedSource(w, log)
+		return
+	}
 	if err == nil {
 		w.Header().Set("X-Content-SHA256", checksum)
 	}
 
 	if reader != f {
 		// Encrypted transfer
-		w.Header().Set("Content-Type", "application/octet-stream")
-		w.Header().Set("X-Encryption", "true")
+		w.Header().Set(protocol.EncryptionHeader, "true")
 		// For encrypted transfers, calculate and set Content-Length
 		// Size = 12 byte nonce + plaintext + (16 byte GCM tag per 64KB chunk)
 		encryptedSize := calculateEncryptedSize(fi.Size())
 		w.Header().Set("Content-Length", fmt.Sprintf("%d", encryptedSize))
-		_, _ = io.Copy(writer, reader)
+		if !s.startBody(w, pt, fi, log) {
+			return
+		}
+		n, err := io.Copy(writer, reader)
+		completed = s.finishBody(fi, n, encryptedSize, err, log) && err == nil
 		return
 	}
 
 	// Normal unencrypted transfer - use http.ServeFile for proper HTTP handling
-	w.Header().Set("Content-Type", "application/octet-stream")
 	w.Header().Set("Content-Length", fmt.Sprintf("%d", fi.Size()))
 
 	if checksum := r.Header.Get("X-Content-SHA256"); checksum == "" {
 		// Only compute checksum if not already set by other code paths
-		if c, err := s.getCachedChecksum(s.SrcPath); err == nil {
+		if c, err := s.checksumFor(fi); err == nil {
 			w.Header().Set("X-Content-SHA256", c)
 		}
 	}
 
-	_, _ = io.Copy(writer, reader)
+	if !s.startBody(w, pt, fi, log) {
+		return
+	}
+	n, err := io.Copy(writer, reader)
+	served = &servedRange{key: key, size: fi.Size(), n: n}
+	if !s.finishBody(fi, n, fi.Size(), err, log) {
+		return
+	}
+	completed = err == nil
 
 	// Record metrics after successful download
 	duration := time.Since(startTime).Seconds()
-	fileExt := strings.ToLower(filepath.Ext(s.SrcPath))
-	if fileExt == "" {
-		fileExt = "no_ext"
-	}
+	fileExt := fileExtLabel(s.SrcPath)
 
-	metrics.DownloadDuration.WithLabelValues(fileExt).Observe(duration)
-	metrics.DownloadSize.WithLabelValues(fileExt).Observe(float64(fi.Size()))
+	metrics.ObserveTransfer(metrics.DownloadDuration.WithLabelValues(fileExt), duration, id)
+	metrics.ObserveTransfer(metrics.DownloadSize.WithLabelValues(fileExt), float64(fi.Size()), id)
 	if duration > 0 {
 		throughputMbps := float64(fi.Size()*8) / (duration * 1_000_000)
 		metrics.DownloadThroughput.WithLabelValues(fileExt).Observe(throughputMbps)
@@ -291,6 +357,61 @@ func (s *Server) handleDownload(w http.ResponseWriter, r *http.Request) {
 	metrics.DownloadsTotal.WithLabelValues(fileExt, "success").Inc()
 }
 
+// fileExtLabel is the file_ext label of name in metrics, e.g. ".pdf", or
+// "no_ext"
+func fileExtLabel(name string) string {
+	if ext := strings.ToLower(filepath.Ext(name)); ext != "" {
+		return ext
+	}
+	return "no_ext"
+}
+
+// parseByteRange reads a single "bytes=start-" or "bytes=start-end" range
+// for a file of size bytes, clamping end to the last byte. Suffix ranges and
+// multiple ranges aren't supported.
+func parseByteRange(h string, size int64) (start, end int64, ok bool) {
+	spec, found := strings.CutPrefix(h, "bytes=")
+	if !found || strings.Contains(spec, ",") {
+		return 0, 0, false
+	}
+	first, last, found := strings.Cut(spec, "-")
+	start, err := strconv.ParseInt(first, 10, 64)
+	if !found || err != nil || start < 0 || start >= size {
+		return 0, 0, false
+	}
+	end = size - 1
+	if last != "" {
+		if end, err = strconv.ParseInt(last, 10, 64); err != nil || end < start {
+			return 0, 0, false
+		}
+		end = min(end, size-1)
+	}
+	return start, end, true
+}
+
+// serveTextFile streams spooled text the same way TextContent is served, without
+// holding it in memory
+func (s *Server) serveTextFile(w http.ResponseWriter, r *http.Request, size int64) {
+	f, err := os.Open(s.SrcPath)
+	if err != nil {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	defer func() { _ = f.Close() }()
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Content-Length", fmt.Sprintf("%d", size))
+	setNoCache(w.Header())
+
+	var writer io.Writer = w
+	if limiter := s.getRateLimiter(s.clientIP(r)); limiter != nil {
+		writer = &RateLimitedWriter{w: w, limiter: limiter}
+	}
+	if _, err := io.Copy(writer, f); err == nil {
+		s.countDownload(false)
+	}
+}
+
 // calculateEncryptedSize estimates the size of data after encryption
 // Encryption adds: 12 bytes for nonce + 16 bytes GCM tag per encrypted chunk + 4 bytes length prefix per chunk
 // Plaintext is encrypted in 64KB chunks
@@ -0,0 +1,272 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/zulfikawr/warp/internal/crypto"
+	"github.com/zulfikawr/warp/internal/metrics"
+	"github.com/zulfikawr/warp/internal/protocol"
+)
+
+func TestDownloadAcceptRanges(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "data.bin")
+	if err := os.WriteFile(file, make([]byte, 4096), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	folder := filepath.Join(dir, "folder")
+	if err := os.MkdirAll(folder, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(folder, "a.txt"), []byte("a"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		server    func(tok string) *Server
+		encrypted bool
+		want      string
+	}{
+		{"file", func(tok string) *Server { return &Server{Token: tok, SrcPath: file} }, false, "bytes"},
+		{"text", func(tok string) *Server { return &Server{Token: tok, TextContent: "hello"} }, false, ""},
+		{"directory zip", func(tok string) *Server { return &Server{Token: tok, SrcPath: folder} }, false, ""},
+		{"encrypted file", func(tok string) *Server { return &Server{Token: tok, SrcPath: file} }, true, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tok, _ := crypto.GenerateToken(nil)
+			s := tt.server(tok)
+			if tt.encrypted {
+				s.tokenKeys.Store(tok, make([]byte, 32))
+			}
+			ts := httptest.NewServer(s.routes())
+			defer ts.Close()
+
+			resp, err := http.Get(ts.URL + protocol.PathPrefix + tok)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, _ = io.Copy(io.Discard, resp.Body)
+			_ = resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("status %d", resp.StatusCode)
+			}
+			if got := resp.Header.Get("Accept-Ranges"); got != tt.want {
+				t.Errorf("Accept-Ranges = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseByteRange(t *testing.T) {
+	tests := []struct {
+		header     string
+		start, end int64
+		ok         bool
+	}{
+		{"bytes=40-", 40, 99, true},
+		{"bytes=0-9", 0, 9, true},
+		{"bytes=90-200", 90, 99, true},
+		{"bytes=100-", 0, 0, false},
+		{"bytes=9-3", 0, 0, false},
+		{"bytes=-10", 0, 0, false},
+		{"bytes=0-1,5-6", 0, 0, false},
+		{"items=0-9", 0, 0, false},
+		{"", 0, 0, false},
+	}
+	for _, tt := range tests {
+		start, end, ok := parseByteRange(tt.header, 100)
+		if ok != tt.ok || (ok && (start != tt.start || end != tt.end)) {
+			t.Errorf("parseByteRange(%q) = %d, %d, %v", tt.header, start, end, ok)
+		}
+	}
+}
+
+func TestDownloadPrefixRange(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "data.bin")
+	data := []byte("0123456789abcdefghij")
+	if err := os.WriteFile(file, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tok, _ := crypto.GenerateToken(nil)
+	s := &Server{Token: tok, SrcPath: file}
+	ts := httptest.NewServer(s.routes())
+	defer ts.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+protocol.PathPrefix+tok, nil)
+	req.Header.Set("Range", "bytes=0-9")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusPartialContent || string(body) != "0123456789" {
+		t.Fatalf("status %d, body %q", resp.StatusCode, body)
+	}
+	if cr := resp.Header.Get("Content-Range"); cr != "bytes 0-9/20" {
+		t.Errorf("Content-Range = %q", cr)
+	}
+}
+
+func TestDownloadContentEncodings(t *testing.T) {
+	data := repetitiveText(256 << 10)
+	sum := sha256.Sum256(data)
+	file := filepath.Join(t.TempDir(), "app.log")
+	if err := os.WriteFile(file, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	decoders := map[string]func(io.Reader) (io.Reader, error){
+		"":     func(r io.Reader) (io.Reader, error) { return r, nil },
+		"br":   func(r io.Reader) (io.Reader, error) { return brotli.NewReader(r), nil },
+		"gzip": func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) },
+		"zstd": func(r io.Reader) (io.Reader, error) { return zstd.NewReader(r) },
+	}
+	tests := []struct {
+		name, accept string
+		noBrotli     bool
+		want         string
+	}{
+		{"browser", "gzip, deflate, br", false, "br"},
+		{"warp cli", "zstd, gzip", false, "zstd"},
+		{"brotli disabled", "gzip, deflate, br", true, "gzip"},
+		{"identity", "identity", false, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tok, _ := crypto.GenerateToken(nil)
+			s := &Server{Token: tok, SrcPath: file, NoBrotli: tt.noBrotli}
+			ts := httptest.NewServer(s.routes())
+			defer ts.Close()
+
+			req, _ := http.NewRequest(http.MethodGet, ts.URL+protocol.PathPrefix+tok, nil)
+			req.Header.Set("Accept-Encoding", tt.accept) // also stops the transport decoding gzip itself
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() { _ = resp.Body.Close() }()
+			if got := resp.Header.Get("Content-Encoding"); got != tt.want {
+				t.Fatalf("Content-Encoding = %q, want %q", got, tt.want)
+			}
+			wire, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.want != "" && len(wire) >= len(data) {
+				t.Errorf("%s body is %d bytes for %d of text", tt.want, len(wire), len(data))
+			}
+			dec, err := decoders[tt.want](bytes.NewReader(wire))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := io.ReadAll(dec)
+			if err != nil {
+				t.Fatalf("decode %s: %v", tt.want, err)
+			}
+			gotSum := sha256.Sum256(got)
+			if gotSum != sum {
+				t.Fatalf("decoded %d bytes with a different checksum", len(got))
+			}
+			if h := resp.Header.Get(protocol.ContentSHA256Header); tt.want != "" && h != hex.EncodeToString(sum[:]) {
+				t.Errorf("%s = %q, want the checksum of the decoded file", protocol.ContentSHA256Header, h)
+			}
+		})
+	}
+}
+
+func TestDirectoryDownloadChecksumTrailer(t *testing.T) {
+	folder := t.TempDir()
+	if err := os.WriteFile(filepath.Join(folder, "app.log"), repetitiveText(64<<10), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(folder, "b.txt"), []byte("b"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, accept := range []string{"zstd, gzip", "gzip", "identity"} {
+		t.Run(accept, func(t *testing.T) {
+			tok, _ := crypto.GenerateToken(nil)
+			ts := httptest.NewServer((&Server{Token: tok, SrcPath: folder}).routes())
+			defer ts.Close()
+
+			req, _ := http.NewRequest(http.MethodGet, ts.URL+protocol.PathPrefix+tok, nil)
+			req.Header.Set("Accept-Encoding", accept)
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() { _ = resp.Body.Close() }()
+			if _, ok := resp.Trailer[http.CanonicalHeaderKey(protocol.ContentSHA256Header)]; !ok {
+				t.Fatalf("trailer not announced, Trailer = %v", resp.Trailer)
+			}
+			if h := resp.Header.Get(protocol.ContentSHA256Header); h != "" {
+				t.Errorf("checksum sent as a header too: %q", h)
+			}
+			wire, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Over the body as sent, encoded or not
+			sum := sha256.Sum256(wire)
+			if got := resp.Trailer.Get(protocol.ContentSHA256Header); got != hex.EncodeToString(sum[:]) {
+				t.Errorf("trailer = %q, want the checksum of the %d bytes received", got, len(wire))
+			}
+		})
+	}
+}
+
+// TestDownloadTimeToFirstByte holds the body back as hashing a large file
+// would, and checks that the wait is counted before the first byte and not
+// as transfer time
+func TestDownloadTimeToFirstByte(t *testing.T) {
+	const delay = 300 * time.Millisecond
+	path := filepath.Join(t.TempDir(), "slow.ttfb")
+	if err := os.WriteFile(path, []byte("data"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tok, _ := crypto.GenerateToken(nil)
+	s := &Server{Token: tok, SrcPath: path, beforeBody: func() { time.Sleep(delay) }}
+	ts := httptest.NewServer(s.routes())
+	defer ts.Close()
+	series := testutil.CollectAndCount(metrics.DownloadTTFB)
+
+	resp, err := http.Get(ts.URL + protocol.PathPrefix + tok)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+
+	// The handler finishes the transfer after the last byte has gone out
+	var recent []protocol.CompletedTransfer
+	for deadline := time.Now().Add(2 * time.Second); len(recent) == 0 && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+		recent = s.stats().Recent
+	}
+	if len(recent) != 1 {
+		t.Fatalf("recent = %+v, want the download", recent)
+	}
+	ttfb, total := recent[0].TTFBSeconds, recent[0].DurationSeconds
+	if ttfb < delay.Seconds() || total-ttfb >= delay.Seconds() {
+		t.Errorf("TTFB %.3fs of %.3fs; want the %v wait before the first byte", ttfb, total, delay)
+	}
+	if got := testutil.CollectAndCount(metrics.DownloadTTFB); got != series+1 {
+		t.Errorf("%d warp_download_ttfb_seconds series, want %d with .ttfb", got, series+1)
+	}
+}
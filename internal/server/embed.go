@@ -6,3 +6,6 @@ import (
 
 //go:embed static/upload.html
 var uploadPageHTML string
+
+//go:embed static/favicon.ico
+var faviconICO []byte
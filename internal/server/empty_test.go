@@ -0,0 +1,95 @@
+package server
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/zulfikawr/warp/internal/crypto"
+	"github.com/zulfikawr/warp/internal/protocol"
+)
+
+// emptySHA256 is the SHA256 of zero bytes
+const emptySHA256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+func TestRawUploadEmptyFile(t *testing.T) {
+	dir := t.TempDir()
+	tok, _ := crypto.GenerateToken(nil)
+	s := &Server{Token: tok, HostMode: true, UploadDir: dir}
+	ts := httptest.NewServer(s.routes())
+	defer ts.Close()
+
+	req, _ := http.NewRequest(http.MethodPost, ts.URL+protocol.UploadPathPrefix+tok, http.NoBody)
+	req.Header.Set("X-File-Name", "empty.txt")
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("empty upload never answered: %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want 200", resp.StatusCode)
+	}
+
+	fi, err := os.Stat(filepath.Join(dir, "empty.txt"))
+	if err != nil {
+		t.Fatalf("empty file not created: %v", err)
+	}
+	if fi.Size() != 0 {
+		t.Errorf("size = %d, want 0", fi.Size())
+	}
+}
+
+func TestDownloadEmptyFile(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "empty.txt")
+	if err := os.WriteFile(src, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tok, _ := crypto.GenerateToken(nil)
+	s := &Server{Token: tok, SrcPath: src}
+	ts := httptest.NewServer(s.routes())
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + protocol.PathPrefix + tok)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || len(body) != 0 {
+		t.Fatalf("status %d, %d bytes", resp.StatusCode, len(body))
+	}
+	if got := resp.Header.Get(protocol.ContentSHA256Header); got != emptySHA256 {
+		t.Errorf("%s = %q, want the empty checksum", protocol.ContentSHA256Header, got)
+	}
+}
+
+func TestDownloadEmptyDirectory(t *testing.T) {
+	tok, _ := crypto.GenerateToken(nil)
+	s := &Server{Token: tok, SrcPath: t.TempDir()}
+	ts := httptest.NewServer(s.routes())
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + protocol.PathPrefix + tok)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d", resp.StatusCode)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		t.Fatalf("empty directory should be a valid zip: %v", err)
+	}
+	if len(zr.File) != 0 {
+		t.Errorf("zip has %d entries, want 0", len(zr.File))
+	}
+}
@@ -0,0 +1,70 @@
+package server
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	// throughputWindow is how many recent transfers an estimate averages
+	throughputWindow = 10
+	// minThroughputSample is the smallest transfer counted: smaller ones say
+	// more about latency than about the link
+	minThroughputSample = 1 << 20
+)
+
+// throughput is a rolling average of the speed of recently completed
+// transfers in one direction. Each transfer is one client's connection, so
+// the average follows the clients the server has been seeing lately.
+type throughput struct {
+	mu      sync.Mutex
+	samples [throughputWindow]throughputSample
+	n, next int
+}
+
+type throughputSample struct {
+	bytes   int64
+	elapsed time.Duration
+}
+
+// add records a completed transfer of n bytes that took elapsed, after its
+// first byte for downloads
+func (t *throughput) add(n int64, elapsed time.Duration) {
+	if n < minThroughputSample || elapsed <= 0 {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.samples[t.next] = throughputSample{n, elapsed}
+	t.next = (t.next + 1) % throughputWindow
+	t.n = min(t.n+1, throughputWindow)
+}
+
+// rate returns the average speed of the recent transfers in bytes per
+// second, or 0 without any. It weighs transfers by size, so one slow small
+// file doesn't drag down the estimate for a large one.
+func (t *throughput) rate() float64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var bytes int64
+	var elapsed time.Duration
+	for _, s := range t.samples[:t.n] {
+		bytes += s.bytes
+		elapsed += s.elapsed
+	}
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(bytes) / elapsed.Seconds()
+}
+
+// estimateSeconds is how long size bytes would take at the recent rate,
+// rounded up to a whole second; 0 when there is no history or no size
+func (t *throughput) estimateSeconds(size int64) int64 {
+	r := t.rate()
+	if r <= 0 || size <= 0 {
+		return 0
+	}
+	return int64(math.Ceil(float64(size) / r))
+}
@@ -0,0 +1,141 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zulfikawr/warp/internal/crypto"
+	"github.com/zulfikawr/warp/internal/protocol"
+)
+
+func TestThroughputRate(t *testing.T) {
+	var tp throughput
+	if r := tp.rate(); r != 0 {
+		t.Fatalf("rate without history = %v", r)
+	}
+	if s := tp.estimateSeconds(1 << 30); s != 0 {
+		t.Fatalf("estimate without history = %d", s)
+	}
+
+	// Too small to say anything about the link
+	tp.add(1<<20-1, time.Millisecond)
+	tp.add(1<<20, 0)
+	if r := tp.rate(); r != 0 {
+		t.Fatalf("small samples counted: rate %v", r)
+	}
+
+	// Weighted by size: 30 MiB in 3s and 10 MiB in 2s average 8 MiB/s, not 7.5
+	tp.add(30<<20, 3*time.Second)
+	tp.add(10<<20, 2*time.Second)
+	if r := tp.rate(); r != 8<<20 {
+		t.Errorf("rate = %v, want %v", r, 8<<20)
+	}
+	if s := tp.estimateSeconds(80 << 20); s != 10 {
+		t.Errorf("estimate for 80 MiB = %ds, want 10", s)
+	}
+	// Rounded up
+	if s := tp.estimateSeconds(80<<20 + 1); s != 11 {
+		t.Errorf("estimate for 80 MiB + 1 = %ds, want 11", s)
+	}
+	if s := tp.estimateSeconds(0); s != 0 {
+		t.Errorf("estimate without a size = %ds", s)
+	}
+}
+
+func TestThroughputWindow(t *testing.T) {
+	var tp throughput
+	// Old slow transfers fall out of the window
+	for range throughputWindow {
+		tp.add(1<<20, time.Second)
+	}
+	for range throughputWindow {
+		tp.add(4<<20, time.Second)
+	}
+	if r := tp.rate(); r != 4<<20 {
+		t.Errorf("rate = %v, want only the last %d transfers (%v)", r, throughputWindow, 4<<20)
+	}
+	tp.add(14<<20, time.Second)
+	want := float64((throughputWindow-1)*4<<20+14<<20) / throughputWindow
+	if r := tp.rate(); r != want {
+		t.Errorf("rate = %v, want %v", r, want)
+	}
+}
+
+func TestInfoEstimate(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "disk.img")
+	data := make([]byte, 2<<20)
+	_, _ = rand.Read(data) // Incompressible, so all of it crosses the wire
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tok, _ := crypto.GenerateToken(nil)
+	s := &Server{Token: tok, SrcPath: path}
+	ts := httptest.NewServer(s.routes())
+	defer ts.Close()
+	infoURL := ts.URL + protocol.PathPrefix + tok + protocol.InfoPathSuffix
+
+	fields := func() map[string]any {
+		t.Helper()
+		resp, err := http.Get(infoURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = resp.Body.Close() }()
+		var m map[string]any
+		if err := json.NewDecoder(resp.Body).Decode(&m); err != nil {
+			t.Fatal(err)
+		}
+		return m
+	}
+	if v, ok := fields()["estimated_seconds"]; ok {
+		t.Fatalf("estimated_seconds = %v before any download", v)
+	}
+
+	// A finished download gives the history
+	resp, err := http.Get(ts.URL + protocol.PathPrefix + tok)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+	// The handler finishes the transfer after the last byte is out
+	for deadline := time.Now().Add(2 * time.Second); s.downloadRate.rate() <= 0; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("download not recorded")
+		}
+	}
+	v, ok := fields()["estimated_seconds"]
+	if !ok {
+		t.Fatal("estimated_seconds missing after a download")
+	}
+	if n, _ := v.(float64); n < 1 {
+		t.Errorf("estimated_seconds = %v", v)
+	}
+}
+
+func TestUploadPageEstimate(t *testing.T) {
+	tok, _ := crypto.GenerateToken(nil)
+	s := &Server{Token: tok, HostMode: true, UploadDir: t.TempDir()}
+	page := func() string {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		s.serveUploadPage(rec)
+		return rec.Body.String()
+	}
+	if !strings.Contains(page(), "recentSpeed:  0 ,") {
+		t.Error("page without history should have no recent speed")
+	}
+	s.uploadRate.add(8<<20, time.Second)
+	if !strings.Contains(page(), "recentSpeed:  8388608 ,") {
+		t.Error("page missing the recent upload speed")
+	}
+}
@@ -0,0 +1,132 @@
+package server
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// EventType names a transfer lifecycle event
+type EventType string
+
+// Events delivered by Server.Events
+const (
+	EventTransferStarted   EventType = "transfer_started"
+	EventProgress          EventType = "progress"
+	EventTransferCompleted EventType = "transfer_completed"
+	EventTransferFailed    EventType = "transfer_failed"
+	EventSessionCreated    EventType = "session_created" // A chunked upload session was opened
+	EventSessionExpired    EventType = "session_expired" // A chunked upload session went stale
+	EventPeerVerified      EventType = "peer_verified"   // A client completed the PAKE handshake
+)
+
+// eventBufferSize is each subscriber's backlog; the oldest events are
+// dropped when it fills
+const eventBufferSize = 256
+
+// errTransferIncomplete is the Err of TransferFailed events
+var errTransferIncomplete = errors.New("transfer ended before completing")
+
+// Event is one transfer lifecycle event. Fields that don't apply to a Type
+// are left zero.
+type Event struct {
+	Type       EventType
+	Time       time.Time
+	TransferID string // Transfer ID, or the session ID of a chunked upload
+	Direction  string // protocol.DirectionDownload or protocol.DirectionUpload
+	Filename   string
+	Bytes      int64 // Transferred so far
+	Total      int64 // Expected size; 0 when unknown
+	ClientIP   string
+	Err        error         // Why a transfer failed
+	AuthString string        // PeerVerified: the words both sides should see, see crypto.AuthString
+	Path       string        // TransferCompleted uploads: where the file was saved
+	Duration   time.Duration // TransferCompleted: from the transfer's start to its end
+}
+
+// eventBus fans events out to subscribers without ever blocking the sender
+type eventBus struct {
+	mu     sync.Mutex
+	subs   []chan Event
+	closed bool
+}
+
+// Events subscribes to the server's transfer lifecycle events, in the order
+// they happened. Delivery never blocks a transfer: a subscriber that falls
+// eventBufferSize events behind loses the oldest ones. The channel is closed
+// when the server shuts down. Each call returns a new subscription.
+func (s *Server) Events() <-chan Event {
+	b := &s.events
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	ch := make(chan Event, eventBufferSize)
+	if b.closed {
+		close(ch)
+		return ch
+	}
+	b.subs = append(b.subs, ch)
+	return ch
+}
+
+// publish delivers ev to every subscriber, dropping a full subscriber's
+// oldest event to make room
+func (b *eventBus) publish(ev Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return
+	}
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+	for _, ch := range b.subs {
+		select {
+		case ch <- ev:
+			continue
+		default:
+		}
+		// Senders are serialized by mu, so one receive always makes room
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- ev
+	}
+}
+
+// close ends every subscription
+func (b *eventBus) close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return
+	}
+	b.closed = true
+	for _, ch := range b.subs {
+		close(ch)
+	}
+	b.subs = nil
+}
+
+// event builds an event describing pt's transfer
+func (pt *ProgressTracker) event(t EventType) Event {
+	return Event{
+		Type:       t,
+		TransferID: pt.ID,
+		Direction:  pt.Direction,
+		Filename:   pt.Filename,
+		Bytes:      atomic.LoadInt64(&pt.BytesWritten),
+		Total:      pt.TotalSize,
+		ClientIP:   pt.ClientIP,
+	}
+}
+
+// progressed publishes a Progress event when the transfer's pacer says one
+// is due: about every 1% of the transfer, or every half second when it's slow
+func (pt *ProgressTracker) progressed() {
+	if pt.events == nil || !pt.pacer.Ready(atomic.LoadInt64(&pt.BytesWritten)) {
+		return
+	}
+	pt.events.publish(pt.event(EventProgress))
+}
@@ -0,0 +1,217 @@
+package server
+
+import (
+	"bytes"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/zulfikawr/warp/internal/crypto"
+	"github.com/zulfikawr/warp/internal/protocol"
+)
+
+// collectEvents reads events until one of type last arrives, leaving out
+// throttled Progress events
+func collectEvents(t *testing.T, ch <-chan Event, last EventType) []Event {
+	t.Helper()
+	var got []Event
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case ev := <-ch:
+			if ev.Type == EventProgress {
+				continue
+			}
+			got = append(got, ev)
+			if ev.Type == last {
+				return got
+			}
+		case <-timeout:
+			t.Fatalf("timed out waiting for %s; got %+v", last, got)
+		}
+	}
+}
+
+func eventTypes(events []Event) []EventType {
+	types := make([]EventType, len(events))
+	for i, ev := range events {
+		types[i] = ev.Type
+	}
+	return types
+}
+
+func TestEventsForDownload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.bin")
+	data := make([]byte, 64<<10)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tok, _ := crypto.GenerateToken(nil)
+	s := &Server{Token: tok, SrcPath: path}
+	events := s.Events()
+	ts := httptest.NewServer(s.routes())
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + protocol.PathPrefix + tok)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+
+	got := collectEvents(t, events, EventTransferCompleted)
+	if want := []EventType{EventTransferStarted, EventTransferCompleted}; fmt.Sprint(eventTypes(got)) != fmt.Sprint(want) {
+		t.Fatalf("events = %v, want %v", eventTypes(got), want)
+	}
+	done := got[1]
+	if done.Filename != "data.bin" || done.Direction != protocol.DirectionDownload || done.Bytes != int64(len(data)) || done.Total != int64(len(data)) {
+		t.Errorf("completed event = %+v", done)
+	}
+	if done.ClientIP != "127.0.0.1" || done.TransferID != got[0].TransferID || done.Err != nil {
+		t.Errorf("completed event = %+v", done)
+	}
+}
+
+func TestEventsForChunkedUpload(t *testing.T) {
+	dir := t.TempDir()
+	tok, _ := crypto.GenerateToken(nil)
+	var uploads []Event
+	s := &Server{Token: tok, HostMode: true, UploadDir: dir, OnUpload: func(ev Event) { uploads = append(uploads, ev) }}
+	events := s.Events()
+	ts := httptest.NewServer(s.routes())
+	defer ts.Close()
+
+	const chunkSize = 64 << 10
+	for id := range 2 {
+		req, _ := http.NewRequest(http.MethodPost, ts.URL+protocol.UploadPathPrefix+tok, bytes.NewReader(make([]byte, chunkSize)))
+		req.Header.Set("X-File-Name", "upload.bin")
+		req.Header.Set("X-Upload-Session", "events-session-1")
+		req.Header.Set("X-Upload-Offset", fmt.Sprint(id*chunkSize))
+		req.Header.Set("X-Upload-Total", fmt.Sprint(2*chunkSize))
+		req.Header.Set("X-Chunk-Id", fmt.Sprint(id))
+		req.Header.Set("X-Chunk-Total", "2")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("chunk %d: status %d", id, resp.StatusCode)
+		}
+	}
+
+	got := collectEvents(t, events, EventTransferCompleted)
+	want := []EventType{EventSessionCreated, EventTransferStarted, EventTransferCompleted}
+	if fmt.Sprint(eventTypes(got)) != fmt.Sprint(want) {
+		t.Fatalf("events = %v, want %v", eventTypes(got), want)
+	}
+	for _, ev := range got {
+		if ev.TransferID != "events-session-1" || ev.Filename != "upload.bin" || ev.Direction != protocol.DirectionUpload || ev.ClientIP != "127.0.0.1" {
+			t.Errorf("%s event = %+v", ev.Type, ev)
+		}
+	}
+	if got[2].Bytes != 2*chunkSize {
+		t.Errorf("completed with %d bytes, want %d", got[2].Bytes, 2*chunkSize)
+	}
+	if got[2].Duration <= 0 {
+		t.Errorf("completed in %v", got[2].Duration)
+	}
+	if want := filepath.Join(dir, "upload.bin"); got[2].Path != want {
+		t.Errorf("completed at %q, want %q", got[2].Path, want)
+	}
+	// Chunks are sent one after another, so the last one's response follows OnUpload
+	if len(uploads) != 1 || uploads[0].Path != got[2].Path {
+		t.Errorf("OnUpload got %+v, want the completed upload once", uploads)
+	}
+
+	// Expiry fails the (already completed) session only once
+	s.cleanupSession("events-session-1")
+	select {
+	case ev := <-events:
+		t.Errorf("unexpected event after completion: %+v", ev)
+	default:
+	}
+}
+
+func TestEventsForLegacyChunkedUpload(t *testing.T) {
+	dir := t.TempDir()
+	tok, _ := crypto.GenerateToken(nil)
+	s := &Server{Token: tok, HostMode: true, UploadDir: dir}
+	events := s.Events()
+	ts := httptest.NewServer(s.routes())
+	defer ts.Close()
+
+	// Sequential chunks without a session ID, as older clients send them
+	legacy := func(name string, offset int64) {
+		rawUpload(t, ts, tok, name, []byte("01234"), map[string]string{"X-Upload-Offset": fmt.Sprint(offset), "X-Upload-Total": "15"})
+	}
+	for offset := int64(0); offset < 15; offset += 5 {
+		legacy("log.txt", offset)
+	}
+	got := collectEvents(t, events, EventTransferCompleted)
+	if want := []EventType{EventTransferStarted, EventTransferCompleted}; fmt.Sprint(eventTypes(got)) != fmt.Sprint(want) {
+		t.Fatalf("events = %v, want %v", eventTypes(got), want)
+	}
+	if done := got[1]; done.TransferID != got[0].TransferID || done.Bytes != 15 || done.Total != 15 {
+		t.Errorf("completed event = %+v", done)
+	}
+
+	// One whose next chunk never comes fails once it goes stale
+	legacy("gone.txt", 0)
+	collectEvents(t, events, EventTransferStarted)
+	key := filepath.Join(dir, "gone.txt")
+	val, ok := s.legacyUploads.Load(key)
+	if !ok {
+		t.Fatal("unfinished upload isn't kept open")
+	}
+	s.legacyUploads.Store(key, legacyUpload{val.(legacyUpload).pt, time.Now().Add(-24 * time.Hour)})
+	s.cleanupStaleSessions()
+	if got := collectEvents(t, events, EventTransferFailed); len(got) != 1 || got[0].Filename != "gone.txt" {
+		t.Errorf("events = %+v", got)
+	}
+}
+
+func TestEventsFailedTransfer(t *testing.T) {
+	s := &Server{}
+	events := s.Events()
+	s.trackTransfer("t1", "a.bin", protocol.DirectionUpload, 10, "10.0.0.2")
+	s.finishTransfer("t1", false)
+
+	got := collectEvents(t, events, EventTransferFailed)
+	if len(got) != 2 || got[1].Err != errTransferIncomplete || got[1].ClientIP != "10.0.0.2" {
+		t.Errorf("events = %+v", got)
+	}
+}
+
+func TestEventBusDropsOldest(t *testing.T) {
+	s := &Server{}
+	slow := s.Events()
+	const extra = 10
+	for i := range eventBufferSize + extra {
+		s.events.publish(Event{Type: EventProgress, Bytes: int64(i)})
+	}
+	if n := len(slow); n != eventBufferSize {
+		t.Fatalf("backlog %d, want %d", n, eventBufferSize)
+	}
+	if first := <-slow; first.Bytes != extra {
+		t.Errorf("oldest kept event is #%d, want #%d", first.Bytes, extra)
+	}
+
+	s.events.close()
+	for range slow {
+		// Drain until closed
+	}
+	if _, ok := <-s.Events(); ok {
+		t.Error("subscribing after shutdown should return a closed channel")
+	}
+	s.events.publish(Event{Type: EventProgress}) // Must not panic
+}
@@ -0,0 +1,137 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/zulfikawr/warp/internal/crypto"
+	"github.com/zulfikawr/warp/internal/metrics"
+	"github.com/zulfikawr/warp/internal/protocol"
+)
+
+// FollowPollInterval is how often a followed file is checked for new bytes
+const FollowPollInterval = 250 * time.Millisecond
+
+// followBufferSize is the most read from a followed file per write
+const followBufferSize = 32 << 10
+
+// followReader reads a file that is still being written. At the end of the
+// file it waits for more instead of returning io.EOF, until ctx or done ends
+// the stream. A file truncated in place, as by copytruncate log rotation, is
+// read again from the start.
+type followReader struct {
+	f        *os.File
+	ctx      context.Context
+	done     <-chan struct{}
+	interval time.Duration
+	offset   int64
+}
+
+func (r *followReader) Read(p []byte) (int, error) {
+	for {
+		n, err := r.f.Read(p)
+		r.offset += int64(n)
+		if n > 0 || (err != nil && !errors.Is(err, io.EOF)) {
+			return n, err
+		}
+		if fi, err := r.f.Stat(); err == nil && fi.Size() < r.offset {
+			if _, err := r.f.Seek(0, io.SeekStart); err != nil {
+				return 0, err
+			}
+			r.offset = 0
+			continue
+		}
+		select {
+		case <-r.ctx.Done():
+			return 0, io.EOF
+		case <-r.done:
+			return 0, io.EOF
+		case <-time.After(r.interval):
+		}
+	}
+}
+
+// serveFollow streams SrcPath like tail -f: what is there now, then whatever
+// is appended, flushed as it arrives, until the client disconnects or the
+// server stops. The length isn't known, so there is no Content-Length,
+// checksum, range or compression. A receiver that did the PAKE handshake
+// still gets the stream encrypted.
+func (s *Server) serveFollow(w http.ResponseWriter, r *http.Request, id string, log *zap.Logger) {
+	f, err := os.Open(s.SrcPath)
+	if err != nil {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	defer func() { _ = f.Close() }()
+
+	name := filepath.Base(s.SrcPath)
+	var reader io.Reader = &followReader{f: f, ctx: r.Context(), done: s.Done(), interval: FollowPollInterval}
+	contentType := contentTypeFor(s.SrcPath, f)
+	if val, ok := s.tokenKeys.Load(s.Token); ok {
+		encReader, err := crypto.NewEncryptReader(reader, val.([]byte))
+		if err != nil {
+			log.Error("Failed to create encrypt reader", zap.Error(err))
+			http.Error(w, "encryption error", http.StatusInternalServerError)
+			return
+		}
+		reader = encReader
+		contentType = "application/octet-stream"
+		w.Header().Set(protocol.EncryptionHeader, "true")
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Disposition", contentDisposition(s.Inline && isPreviewable(contentType), name))
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set(protocol.FollowHeader, "1")
+	// Reverse proxies such as nginx would otherwise hold the stream back
+	w.Header().Set("X-Accel-Buffering", "no")
+
+	pt := s.trackTransfer(id, name, protocol.DirectionDownload, 0, s.clientIP(r))
+	completed := false
+	defer func() { s.finishDownload(id, completed, nil, log) }()
+
+	clientIP := s.clientIP(r)
+	var writer io.Writer = w
+	if limiter := s.getRateLimiter(clientIP); limiter != nil {
+		writer = &RateLimitedWriter{w: w, limiter: limiter}
+		metrics.RateLimitedRequests.WithLabelValues(clientIP).Inc()
+	}
+	writer = &progressWriter{w: writer, pt: pt}
+
+	rc := http.NewResponseController(w)
+	w.WriteHeader(http.StatusOK)
+	_ = rc.Flush()
+	log.Info("Following file", zap.String("filename", name))
+
+	buf := make([]byte, followBufferSize)
+	for {
+		n, err := reader.Read(buf)
+		if n > 0 {
+			// The stream has no end, so only each write is bounded
+			_ = rc.SetWriteDeadline(time.Now().Add(protocol.WriteTimeout))
+			if _, werr := writer.Write(buf[:n]); werr != nil {
+				log.Info("Follower disconnected", zap.String("filename", name), zap.Error(werr))
+				completed = true
+				return
+			}
+			_ = rc.Flush()
+		}
+		if errors.Is(err, io.EOF) {
+			log.Info("Stopped following file", zap.String("filename", name), zap.Int64("bytes", atomic.LoadInt64(&pt.BytesWritten)))
+			completed = true
+			return
+		}
+		if err != nil {
+			log.Error("Failed to read followed file", zap.String("filename", name), zap.Error(err))
+			return
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/zulfikawr/warp/internal/crypto"
+	"github.com/zulfikawr/warp/internal/protocol"
+)
+
+// readLine reads one line from br, failing the test if none arrives in time
+func readLine(t *testing.T, br *bufio.Reader) string {
+	t.Helper()
+	got := make(chan string, 1)
+	go func() {
+		line, _ := br.ReadString('\n')
+		got <- line
+	}()
+	select {
+	case line := <-got:
+		return line
+	case <-time.After(3 * time.Second):
+		t.Fatal("no new line arrived from the followed file")
+		return ""
+	}
+}
+
+func TestFollowStreamsAppendedBytes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	if err := os.WriteFile(path, []byte("first\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tok, _ := crypto.GenerateToken(nil)
+	s := &Server{Token: tok, SrcPath: path, Follow: true}
+	ts := httptest.NewServer(s.routes())
+	defer ts.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL+"/d/"+tok, nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.Header.Get(protocol.FollowHeader) != "1" {
+		t.Errorf("%s header missing", protocol.FollowHeader)
+	}
+	for _, h := range []string{"Content-Length", "Content-Encoding", "Accept-Ranges", "X-Checksum-SHA256"} {
+		if v := resp.Header.Get(h); v != "" {
+			t.Errorf("%s = %q on a followed file", h, v)
+		}
+	}
+
+	br := bufio.NewReader(resp.Body)
+	if line := readLine(t, br); line != "first\n" {
+		t.Fatalf("first line = %q", line)
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.WriteString("second\n")
+	_ = f.Close()
+	if line := readLine(t, br); line != "second\n" {
+		t.Fatalf("appended line = %q", line)
+	}
+
+	// copytruncate rotation empties the file in place
+	if err := os.WriteFile(path, []byte("rotated\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if line := readLine(t, br); line != "rotated\n" {
+		t.Fatalf("line after truncation = %q", line)
+	}
+}
+
+func TestFollowEndsWhenServerStops(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	if err := os.WriteFile(path, []byte("only\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tok, _ := crypto.GenerateToken(nil)
+	s := &Server{Token: tok, SrcPath: path, Follow: true}
+	s.shutdownCtx, s.shutdownCancel = context.WithCancel(context.Background())
+	ts := httptest.NewServer(s.routes())
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/d/" + tok)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	done := make(chan string, 1)
+	go func() {
+		b, _ := io.ReadAll(resp.Body)
+		done <- string(b)
+	}()
+	time.Sleep(2 * FollowPollInterval)
+	s.shutdownCancel()
+	select {
+	case body := <-done:
+		if body != "only\n" {
+			t.Errorf("body = %q", body)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("stream kept going after the server stopped")
+	}
+}
@@ -1,8 +1,13 @@
 package server
 
 import (
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"unicode/utf8"
+
+	"github.com/zulfikawr/warp/internal/naming"
 )
 
 // FuzzSanitizeFilename tests filename sanitization with random inputs
@@ -14,6 +19,10 @@ func FuzzSanitizeFilename(f *testing.F) {
 	f.Add(".")
 	f.Add("..")
 	f.Add(strings.Repeat("a", 300))
+	f.Add(strings.Repeat("文", 200) + ".txt")
+	f.Add(strings.Repeat("🎉", 80) + ".tar.gz")
+	f.Add(strings.Repeat("é", 130))
+	f.Add(strings.Repeat("a", 250) + "." + strings.Repeat("b", 200))
 	f.Add("file/with/path.txt")
 	f.Add("file\\windows\\path.txt")
 	f.Add("   ")
@@ -38,9 +47,12 @@ func FuzzSanitizeFilename(f *testing.F) {
 			if strings.Contains(result, "\x00") {
 				t.Errorf("Accepted null byte: input=%q, result=%q", input, result)
 			}
-			if len(result) > 255 {
+			if len(result) > naming.MaxBytes {
 				t.Errorf("Accepted overlong filename: input=%q, result=%q (len=%d)", input, result, len(result))
 			}
+			if utf8.ValidString(input) && !utf8.ValidString(result) {
+				t.Errorf("Split a rune: input=%q, result=%q", input, result)
+			}
 			if result == "" || result == "." || result == ".." {
 				t.Errorf("Accepted dangerous name: input=%q, result=%q", input, result)
 			}
@@ -93,21 +105,19 @@ func TestSanitizeFilename_KnownGood(t *testing.T) {
 // TestSanitizeFilename_KnownBad tests invalid filenames that should fail
 func TestSanitizeFilename_KnownBad(t *testing.T) {
 	invalidNames := map[string]string{
-		"":                       "empty",
-		".":                      "dot",
-		"..":                     "dotdot",
-		"../etc/passwd":          "traversal",
-		"../../file.txt":         "traversal",
-		"/etc/passwd":            "absolute path",
-		"C:\\Windows\\file.txt":  "windows path",
-		"file/with/slash.txt":    "slash",
-		"file\\with\\back.txt":   "backslash",
-		"file\x00name.txt":       "null byte",
-		"file\x01name.txt":       "control char",
-		"   ":                    "whitespace only",
-		"\t\n\r":                 "whitespace only",
-		strings.Repeat("a", 256): "too long",
-		strings.Repeat("x", 500): "way too long",
+		"":                      "empty",
+		".":                     "dot",
+		"..":                    "dotdot",
+		"../etc/passwd":         "traversal",
+		"../../file.txt":        "traversal",
+		"/etc/passwd":           "absolute path",
+		"C:\\Windows\\file.txt": "windows path",
+		"file/with/slash.txt":   "slash",
+		"file\\with\\back.txt":  "backslash",
+		"file\x00name.txt":      "null byte",
+		"file\x01name.txt":      "control char",
+		"   ":                   "whitespace only",
+		"\t\n\r":                "whitespace only",
 	}
 
 	for name, reason := range invalidNames {
@@ -135,3 +145,76 @@ func TestSanitizeFilename_Normalization(t *testing.T) {
 		}
 	}
 }
+
+// TestSanitizeFilename_Long tests that overlong names are shortened on a rune
+// boundary, keeping their extension
+func TestSanitizeFilename_Long(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		ext   string
+	}{
+		{"ascii", strings.Repeat("a", 256) + ".txt", ".txt"},
+		{"no extension", strings.Repeat("x", 500), ""},
+		{"cjk", strings.Repeat("文件", 100) + ".txt", ".txt"},
+		{"emoji", strings.Repeat("🎉", 80) + ".png", ".png"},
+		{"combining accents", strings.Repeat("e\u0301", 120) + ".md", ".md"},
+		{"mixed", strings.Repeat("naïve-файл-文件-", 20) + ".pdf", ".pdf"},
+		{"dot before cut", strings.Repeat("a.", 200) + "b.txt", ".txt"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := sanitizeFilename(tt.input)
+			if err != nil {
+				t.Fatalf("Rejected long filename: %v", err)
+			}
+			if len(result) > naming.MaxBytes {
+				t.Errorf("Result is %d bytes, want at most %d", len(result), naming.MaxBytes)
+			}
+			if !utf8.ValidString(result) {
+				t.Errorf("Result splits a rune: %q", result)
+			}
+			if filepath.Ext(result) != tt.ext || !strings.HasPrefix(tt.input, strings.TrimSuffix(result, tt.ext)) {
+				t.Errorf("Result %q is not a prefix of the input ending in %q", result, tt.ext)
+			}
+			if len(result) < naming.MaxBytes-utf8.UTFMax-1 {
+				t.Errorf("Result is only %d bytes; shortened more than needed", len(result))
+			}
+		})
+	}
+}
+
+// TestFindUniqueFilename_Long tests that collision suffixes shorten the base
+// instead of pushing a name past the limit
+func TestFindUniqueFilename_Long(t *testing.T) {
+	dir := t.TempDir()
+	limit := naming.Max(dir)
+	for _, unit := range []string{"a", "文", "🎉"} {
+		name, err := sanitizeFilename(strings.Repeat(unit, limit) + ".txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		name = naming.Fit(name, limit)
+		seen := map[string]bool{}
+		for i := 0; i < 3; i++ {
+			path := findUniqueFilename(dir, name)
+			got := filepath.Base(path)
+			if len(got) > limit || !utf8.ValidString(got) || filepath.Ext(got) != ".txt" || seen[got] {
+				t.Fatalf("%s: attempt %d gave %q (%d bytes)", unit, i, got, len(got))
+			}
+			seen[got] = true
+			if err := os.WriteFile(path, nil, 0o600); err != nil {
+				t.Fatalf("%s: writing %q: %v", unit, got, err)
+			}
+		}
+		var suffixed int
+		for got := range seen {
+			if strings.HasSuffix(got, " (1).txt") || strings.HasSuffix(got, " (2).txt") {
+				suffixed++
+			}
+		}
+		if !seen[name] || suffixed != 2 {
+			t.Errorf("%s: names %v, want the original, (1) and (2)", unit, seen)
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package server
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	werrors "github.com/zulfikawr/warp/internal/errors"
+)
+
+// defaultArchiveName is used when matched files share neither a name prefix
+// nor a named directory
+const defaultArchiveName = "warp-files"
+
+// HasGlobMeta reports whether p contains glob syntax. Only checked once the
+// literal path turned out not to exist, so odd file names still work.
+func HasGlobMeta(p string) bool {
+	return strings.ContainsAny(p, "*?[")
+}
+
+// ExpandGlob returns the regular files matching pattern, in lexical order.
+// Besides the filepath.Match syntax, a "**" segment matches any number of
+// directories, including none, so "logs/**/*.log" also matches logs/a.log.
+// No match is a UserError naming the pattern and the directory searched.
+func ExpandGlob(pattern string) ([]string, error) {
+	base, rest := splitGlob(filepath.ToSlash(pattern))
+	segs := strings.Split(rest, "/")
+	for _, seg := range segs {
+		if _, err := path.Match(seg, ""); err != nil {
+			return nil, werrors.NewUserError(fmt.Sprintf("Invalid pattern: %s", pattern), nil, err)
+		}
+	}
+	recursive := false
+	for _, seg := range segs {
+		recursive = recursive || seg == "**"
+	}
+
+	root := filepath.FromSlash(base)
+	var matches []string
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// The root itself missing is the same as no match
+			if p == root {
+				return fs.SkipAll
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil || rel == "." {
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+		if d.IsDir() {
+			// Without ** nothing deeper than the pattern can match
+			if !recursive && strings.Count(rel, "/")+1 >= len(segs) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.Type().IsRegular() && matchSegments(segs, strings.Split(rel, "/")) {
+			matches = append(matches, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(matches) == 0 {
+		dir, _ := filepath.Abs(root)
+		return nil, werrors.NewUserError(
+			fmt.Sprintf("No files match %s (searched %s)", pattern, dir),
+			[]string{
+				"Check the pattern for typos",
+				"Use ** to match files in subdirectories, e.g. logs/**/*.log",
+				"Quote the pattern so the shell passes it to warp unchanged",
+			},
+			nil,
+		)
+	}
+	return matches, nil
+}
+
+// splitGlob separates the leading directories without glob syntax, which is
+// where the walk starts, from the rest of the pattern
+func splitGlob(pattern string) (base, rest string) {
+	segs := strings.Split(pattern, "/")
+	i := 0
+	for i < len(segs)-1 && !HasGlobMeta(segs[i]) {
+		i++
+	}
+	base = strings.Join(segs[:i], "/")
+	switch {
+	case base == "" && i > 0:
+		base = "/"
+	case base == "":
+		base = "."
+	}
+	return base, strings.Join(segs[i:], "/")
+}
+
+// matchSegments matches a slash-separated path against pattern segments,
+// letting "**" stand for zero or more whole segments
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// CommonDir returns the deepest directory containing every file
+func CommonDir(files []string) string {
+	if len(files) == 0 {
+		return "."
+	}
+	common := filepath.Dir(filepath.Clean(files[0]))
+	for _, f := range files[1:] {
+		dir := filepath.Dir(filepath.Clean(f))
+		for !withinDir(dir, common) {
+			parent := filepath.Dir(common)
+			if parent == common {
+				// Relative paths that share nothing meet at "."
+				break
+			}
+			common = parent
+		}
+	}
+	return common
+}
+
+// withinDir reports whether dir is base or below it
+func withinDir(dir, base string) bool {
+	if base == "." {
+		return !filepath.IsAbs(dir) && dir != ".." && !strings.HasPrefix(dir, ".."+string(filepath.Separator))
+	}
+	return dir == base || strings.HasPrefix(dir, strings.TrimSuffix(base, string(filepath.Separator))+string(filepath.Separator))
+}
+
+// ArchiveName names the zip several files are shared in after the prefix
+// their names share, cut back to a word boundary: app-2024-01.log and
+// app-2024-02.log become app-2024.zip. Without a usable prefix it falls back
+// to the name of their common directory.
+func ArchiveName(files []string) string {
+	if len(files) == 0 {
+		return defaultArchiveName + ".zip"
+	}
+	prefix := filepath.Base(files[0])
+	for _, f := range files[1:] {
+		prefix = commonPrefix(prefix, filepath.Base(f))
+	}
+	// A prefix ending mid-word ("app-2024-0") is cut at its last separator
+	for _, f := range files {
+		name := filepath.Base(f)
+		if len(name) == len(prefix) || prefix == "" {
+			continue
+		}
+		last, _ := utf8.DecodeLastRuneInString(prefix)
+		next, _ := utf8.DecodeRuneInString(name[len(prefix):])
+		if isWordRune(last) && isWordRune(next) {
+			prefix = prefix[:strings.LastIndexFunc(prefix, isNameSeparator)+1]
+			break
+		}
+	}
+	prefix = strings.TrimRightFunc(prefix, isNameSeparator)
+	if prefix == "" {
+		prefix = defaultArchiveName
+		if dir, err := filepath.Abs(CommonDir(files)); err == nil {
+			if base := filepath.Base(dir); base != string(filepath.Separator) && base != "." {
+				prefix = base
+			}
+		}
+	}
+	return prefix + ".zip"
+}
+
+func commonPrefix(a, b string) string {
+	n := min(len(a), len(b))
+	i := 0
+	for i < n && a[i] == b[i] {
+		i++
+	}
+	// Never split a multi-byte character
+	for i > 0 && i < len(a) && !utf8.RuneStart(a[i]) {
+		i--
+	}
+	return a[:i]
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func isNameSeparator(r rune) bool {
+	return r == '-' || r == '_' || r == '.' || r == ' '
+}
@@ -0,0 +1,168 @@
+package server
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/zulfikawr/warp/internal/crypto"
+	"github.com/zulfikawr/warp/internal/errors"
+	"github.com/zulfikawr/warp/internal/protocol"
+)
+
+func writeTree(t *testing.T, root string, files ...string) {
+	t.Helper()
+	for _, f := range files {
+		p := filepath.Join(root, filepath.FromSlash(f))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(f), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestExpandGlob(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root,
+		"logs/app-2024-01.log",
+		"logs/app-2024-02.log",
+		"logs/app-2023-12.log",
+		"logs/old/app-2024-03.log",
+		"logs/old/deep/app-2024-04.log",
+		"notes.txt",
+	)
+
+	tests := []struct {
+		pattern string
+		want    []string
+	}{
+		{"logs/app-2024-*.log", []string{"logs/app-2024-01.log", "logs/app-2024-02.log"}},
+		{"logs/*/app-*.log", []string{"logs/old/app-2024-03.log"}},
+		{"logs/**/app-2024-*.log", []string{"logs/app-2024-01.log", "logs/app-2024-02.log", "logs/old/app-2024-03.log", "logs/old/deep/app-2024-04.log"}},
+		{"**/deep/*.log", []string{"logs/old/deep/app-2024-04.log"}},
+		{"logs/app-202[3]-??.log", []string{"logs/app-2023-12.log"}},
+		{"*.txt", []string{"notes.txt"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			got, err := ExpandGlob(filepath.Join(root, filepath.FromSlash(tt.pattern)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := make([]string, len(tt.want))
+			for i, w := range tt.want {
+				want[i] = filepath.Join(root, filepath.FromSlash(w))
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("got %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestExpandGlobNoMatch(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, "logs/app.log")
+
+	for _, pattern := range []string{
+		filepath.Join(root, "logs", "*.txt"),
+		filepath.Join(root, "missing", "*.log"),
+	} {
+		_, err := ExpandGlob(pattern)
+		if !errors.IsUserError(err) {
+			t.Fatalf("%s: want a UserError, got %v", pattern, err)
+		}
+		dir := filepath.Dir(pattern)
+		if msg := err.Error(); !strings.Contains(msg, pattern) || !strings.Contains(msg, dir) {
+			t.Errorf("error should name the pattern and %s, got %q", dir, msg)
+		}
+	}
+}
+
+func TestArchiveName(t *testing.T) {
+	tests := []struct {
+		files []string
+		want  string
+	}{
+		{[]string{"logs/app-2024-01.log", "logs/app-2024-02.log"}, "app-2024.zip"},
+		{[]string{"logs/app-2024-01.log", "logs/app-2024-11.log"}, "app-2024.zip"},
+		{[]string{"report.pdf", "report.docx"}, "report.zip"},
+		{[]string{"IMG_0001.jpg", "IMG_0002.jpg"}, "IMG.zip"},
+		{[]string{"photos/beach.jpg", "photos/city.jpg"}, "photos.zip"},
+		{[]string{"a/x.txt", "b/x.txt"}, "x.txt.zip"},
+		{[]string{"/a.txt", "/b.txt"}, "warp-files.zip"},
+	}
+	for _, tt := range tests {
+		if got := ArchiveName(tt.files); got != tt.want {
+			t.Errorf("ArchiveName(%v) = %q, want %q", tt.files, got, tt.want)
+		}
+	}
+}
+
+func TestCommonDir(t *testing.T) {
+	tests := []struct {
+		files []string
+		want  string
+	}{
+		{[]string{"/srv/logs/a.log", "/srv/logs/b.log"}, "/srv/logs"},
+		{[]string{"/srv/logs/a.log", "/srv/logs/old/b.log"}, "/srv/logs"},
+		{[]string{"/srv/logs/a.log", "/srv/logsold/b.log"}, "/srv"},
+		{[]string{"/a.log", "/srv/b.log"}, "/"},
+		{[]string{"a/x.log", "b/y.log"}, "."},
+	}
+	for _, tt := range tests {
+		files := make([]string, len(tt.files))
+		for i, f := range tt.files {
+			files[i] = filepath.FromSlash(f)
+		}
+		if got := CommonDir(files); got != filepath.FromSlash(tt.want) {
+			t.Errorf("CommonDir(%v) = %q, want %q", tt.files, got, tt.want)
+		}
+	}
+}
+
+func TestDownloadFileList(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, "logs/app-01.log", "logs/old/app-02.log", "logs/skip.log")
+	files := []string{
+		filepath.Join(root, "logs", "app-01.log"),
+		filepath.Join(root, "logs", "old", "app-02.log"),
+	}
+	tok, _ := crypto.GenerateToken(nil)
+	s := &Server{Token: tok, SrcPath: CommonDir(files), SrcFiles: files, ArchiveName: ArchiveName(files)}
+	ts := httptest.NewServer(s.routes())
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + protocol.PathPrefix + tok)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d", resp.StatusCode)
+	}
+	if cd := resp.Header.Get("Content-Disposition"); !strings.Contains(cd, `"app.zip"`) {
+		t.Errorf("Content-Disposition = %q, want app.zip", cd)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+	}
+	if want := []string{"app-01.log", "old/app-02.log"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("zip entries = %v, want %v", names, want)
+	}
+}
@@ -0,0 +1,183 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/zulfikawr/warp/internal/logging"
+	"github.com/zulfikawr/warp/internal/metrics"
+)
+
+// ParseIPList parses --allow-ip/--deny-ip values: CIDRs ("10.1.2.0/24") or
+// single addresses ("10.1.2.7"), which match only themselves
+func ParseIPList(values []string) ([]netip.Prefix, error) {
+	out := make([]netip.Prefix, 0, len(values))
+	for _, v := range values {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		if strings.Contains(v, "/") {
+			p, err := netip.ParsePrefix(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid CIDR %q: %w", v, err)
+			}
+			out = append(out, p.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid IP %q: %w", v, err)
+		}
+		addr = addr.Unmap()
+		out = append(out, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return out, nil
+}
+
+// clientIP returns the address a request came from, in canonical form so
+// that one client always gets the same rate limiter, PAKE attempt counter
+// and quota. X-Forwarded-For and X-Real-IP are client-controlled, so they are
+// only honoured from a peer in TrustedProxies, or from any peer with
+// TrustProxy set, i.e. when warp sits behind a reverse proxy that overwrites
+// them.
+func (s *Server) clientIP(r *http.Request) string {
+	peer, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		peer = r.RemoteAddr
+	}
+	peer = canonicalIP(peer)
+	if !s.trustsPeer(peer) {
+		if r.Header.Get("X-Forwarded-For") != "" || r.Header.Get("X-Real-IP") != "" {
+			logging.Debug("Ignoring forwarded client IP from an untrusted peer", zap.String("peer", peer))
+		}
+		return peer
+	}
+	if ip, ok := s.forwardedIP(r.Header); ok {
+		return ip
+	}
+	return peer
+}
+
+// trustsPeer reports whether the forwarding headers of a connection from
+// peer name the client
+func (s *Server) trustsPeer(peer string) bool {
+	if len(s.TrustedProxies) == 0 {
+		return s.TrustProxy
+	}
+	return s.trustedProxy(peer)
+}
+
+func (s *Server) trustedProxy(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	for _, p := range s.TrustedProxies {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// forwardedIP takes the client from X-Forwarded-For, or X-Real-IP without
+// one. Proxies append to X-Forwarded-For, so the client is the last hop that
+// isn't a trusted proxy, or simply the last hop without TrustedProxies.
+// Hops are read from the right up to that one; anything before it is
+// whatever the client sent and isn't parsed. A client hop that isn't an
+// address is ignored, and logged only at debug level since any client can
+// send one.
+func (s *Server) forwardedIP(h http.Header) (string, bool) {
+	if forwarded := h.Get("X-Forwarded-For"); forwarded != "" {
+		hops := strings.Split(forwarded, ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			ip, ok := parseIP(strings.TrimSpace(hops[i]))
+			if !ok {
+				logging.Debug("Ignoring malformed X-Forwarded-For", zap.String("value", forwarded))
+				return "", false
+			}
+			if i == 0 || len(s.TrustedProxies) == 0 || !s.trustedProxy(ip) {
+				return ip, true
+			}
+		}
+	}
+	if realIP := h.Get("X-Real-IP"); realIP != "" {
+		ip, ok := parseIP(strings.TrimSpace(realIP))
+		if !ok {
+			logging.Debug("Ignoring malformed X-Real-IP", zap.String("value", realIP))
+		}
+		return ip, ok
+	}
+	return "", false
+}
+
+// canonicalIP returns ip in canonical form, or as is when it isn't an address
+func canonicalIP(ip string) string {
+	if c, ok := parseIP(ip); ok {
+		return c
+	}
+	return ip
+}
+
+// parseIP canonicalizes an address: no zone, IPv4-mapped IPv6 as IPv4, and
+// IPv6 in its shortest form, so ::1 and 0:0:0:0:0:0:0:1 are one client
+func parseIP(ip string) (string, bool) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return "", false
+	}
+	return addr.WithZone("").Unmap().String(), true
+}
+
+// ipFilterEnabled reports whether any allow or deny rule is configured
+func (s *Server) ipFilterEnabled() bool {
+	return len(s.AllowIPs) > 0 || len(s.DenyIPs) > 0
+}
+
+// checkIP applies the lists to ip: a deny match always wins, and with an
+// allow list only listed addresses get through. reason is empty when allowed.
+func (s *Server) checkIP(ip string) (reason string) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return "not_allowed" // Unparseable addresses can't match any rule
+	}
+	addr = addr.Unmap()
+	for _, p := range s.DenyIPs {
+		if p.Contains(addr) {
+			return "denied"
+		}
+	}
+	if len(s.AllowIPs) == 0 {
+		return ""
+	}
+	for _, p := range s.AllowIPs {
+		if p.Contains(addr) {
+			return ""
+		}
+	}
+	return "not_allowed"
+}
+
+// filterIPs wraps the whole mux so refused clients can't reach any endpoint,
+// health and metrics included
+func (s *Server) filterIPs(next http.Handler) http.Handler {
+	if !s.ipFilterEnabled() {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := s.clientIP(r)
+		if reason := s.checkIP(ip); reason != "" {
+			metrics.IPFilterDenied.WithLabelValues(reason).Inc()
+			logging.Warn("Request refused by IP filter", zap.String("client_ip", ip), zap.String("reason", reason), zap.String("path", r.URL.Path))
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,180 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/zulfikawr/warp/internal/crypto"
+)
+
+func mustParseIPList(t *testing.T, values ...string) []netip.Prefix {
+	t.Helper()
+	list, err := ParseIPList(values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return list
+}
+
+func TestParseIPList(t *testing.T) {
+	list := mustParseIPList(t, "10.1.2.7/24", " 192.168.1.5 ", "", "::ffff:172.16.0.1", "fd00::/8")
+	want := []string{"10.1.2.0/24", "192.168.1.5/32", "172.16.0.1/32", "fd00::/8"}
+	if len(list) != len(want) {
+		t.Fatalf("got %v, want %v", list, want)
+	}
+	for i, p := range list {
+		if p.String() != want[i] {
+			t.Errorf("entry %d = %s, want %s", i, p, want[i])
+		}
+	}
+
+	for _, bad := range []string{"10.1.2.0/33", "not-an-ip", "10.1.2"} {
+		if _, err := ParseIPList([]string{bad}); err == nil {
+			t.Errorf("ParseIPList(%q) succeeded, want error", bad)
+		}
+	}
+}
+
+func TestCheckIP(t *testing.T) {
+	s := &Server{
+		AllowIPs: mustParseIPList(t, "10.1.2.0/24", "192.168.1.5"),
+		DenyIPs:  mustParseIPList(t, "10.1.2.66"),
+	}
+	tests := []struct {
+		ip     string
+		reason string
+	}{
+		{"10.1.2.1", ""},
+		{"10.1.2.254", ""},
+		{"::ffff:10.1.2.9", ""},
+		{"192.168.1.5", ""},
+		{"192.168.1.6", "not_allowed"},
+		{"10.1.3.1", "not_allowed"},
+		{"10.1.2.66", "denied"}, // Deny wins over the allowed subnet
+		{"garbage", "not_allowed"},
+	}
+	for _, tt := range tests {
+		if got := s.checkIP(tt.ip); got != tt.reason {
+			t.Errorf("checkIP(%s) = %q, want %q", tt.ip, got, tt.reason)
+		}
+	}
+
+	// Without an allow list everyone but the denied is served
+	s.AllowIPs = nil
+	if got := s.checkIP("203.0.113.9"); got != "" {
+		t.Errorf("checkIP with deny list only = %q, want allowed", got)
+	}
+}
+
+func TestFilterIPsTrustProxy(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	request := func(s *Server, remote, forwarded string) int {
+		req := httptest.NewRequest(http.MethodGet, "/health", nil)
+		req.RemoteAddr = remote
+		if forwarded != "" {
+			req.Header.Set("X-Forwarded-For", forwarded)
+		}
+		rec := httptest.NewRecorder()
+		s.filterIPs(ok).ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	s := &Server{AllowIPs: mustParseIPList(t, "10.1.2.0/24")}
+	// A spoofed header must not get an outside client in
+	if code := request(s, "203.0.113.9:5000", "10.1.2.3"); code != http.StatusForbidden {
+		t.Errorf("untrusted X-Forwarded-For: status %d, want 403", code)
+	}
+	if code := request(s, "10.1.2.3:5000", "203.0.113.9"); code != http.StatusOK {
+		t.Errorf("untrusted X-Forwarded-For from allowed peer: status %d, want 200", code)
+	}
+
+	// Behind a trusted proxy the header is the client
+	s.TrustProxy = true
+	if code := request(s, "127.0.0.1:5000", "203.0.113.9, 10.1.2.3"); code != http.StatusOK {
+		t.Errorf("trusted X-Forwarded-For: status %d, want 200", code)
+	}
+	if code := request(s, "10.1.2.3:5000", "203.0.113.9"); code != http.StatusForbidden {
+		t.Errorf("trusted X-Forwarded-For outside allow list: status %d, want 403", code)
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	trusted := &Server{TrustedProxies: mustParseIPList(t, "10.0.0.0/8")}
+	tests := []struct {
+		name      string
+		s         *Server
+		remote    string
+		forwarded string
+		realIP    string
+		want      string
+	}{
+		{"socket address", &Server{}, "192.0.2.7:5000", "", "", "192.0.2.7"},
+		{"spoofed header ignored", &Server{}, "192.0.2.7:5000", "198.51.100.1", "198.51.100.2", "192.0.2.7"},
+		{"IPv6 long form", &Server{}, "[0:0:0:0:0:0:0:1]:5000", "", "", "::1"},
+		{"IPv6 zone", &Server{}, "[fe80::1%eth0]:5000", "", "", "fe80::1"},
+		{"IPv4-mapped", &Server{}, "[::ffff:192.0.2.7]:5000", "", "", "192.0.2.7"},
+		{"trust any proxy", &Server{TrustProxy: true}, "192.0.2.7:5000", "198.51.100.1", "", "198.51.100.1"},
+		{"trust any proxy takes the last hop", &Server{TrustProxy: true}, "192.0.2.7:5000", "203.0.113.9, 198.51.100.1", "", "198.51.100.1"},
+		{"trusted proxy", trusted, "10.1.2.3:5000", "198.51.100.1", "", "198.51.100.1"},
+		{"trusted proxy IPv6 form", trusted, "10.1.2.3:5000", "2001:db8:0:0:0:0:0:1", "", "2001:db8::1"},
+		{"untrusted peer", trusted, "192.0.2.7:5000", "198.51.100.1", "", "192.0.2.7"},
+		{"TrustProxy needs the CIDR", &Server{TrustProxy: true, TrustedProxies: trusted.TrustedProxies}, "192.0.2.7:5000", "198.51.100.1", "", "192.0.2.7"},
+		// The client prepends a fake hop; the proxy appends the real one
+		{"prepended hop", trusted, "10.1.2.3:5000", "203.0.113.9, 198.51.100.1", "", "198.51.100.1"},
+		{"chained proxies", trusted, "10.1.2.3:5000", "198.51.100.1, 10.9.9.9", "", "198.51.100.1"},
+		{"only proxies", trusted, "10.1.2.3:5000", "10.9.9.9", "", "10.9.9.9"},
+		{"real IP", trusted, "10.1.2.3:5000", "", "198.51.100.1", "198.51.100.1"},
+		{"malformed header", trusted, "10.1.2.3:5000", "198.51.100.1, not-an-ip", "", "10.1.2.3"},
+		{"malformed prepended hop", trusted, "10.1.2.3:5000", "not-an-ip, 198.51.100.1, 10.9.9.9", "", "198.51.100.1"},
+		{"malformed hop before the last", &Server{TrustProxy: true}, "192.0.2.7:5000", "203.0.113.9 x, 198.51.100.1", "", "198.51.100.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remote
+			if tt.forwarded != "" {
+				req.Header.Set("X-Forwarded-For", tt.forwarded)
+			}
+			if tt.realIP != "" {
+				req.Header.Set("X-Real-IP", tt.realIP)
+			}
+			if got := tt.s.clientIP(req); got != tt.want {
+				t.Errorf("clientIP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSpoofedHeaderKeepsRateLimit(t *testing.T) {
+	tok, _ := crypto.GenerateToken(nil)
+	guess := func(s *Server, remote, forwarded string) int {
+		req := httptest.NewRequest(http.MethodGet, "/s/wrong", nil)
+		req.RemoteAddr = remote
+		req.Header.Set("X-Forwarded-For", forwarded)
+		rec := httptest.NewRecorder()
+		s.routes().ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	// A fresh forwarded address per request used to mean a fresh limiter
+	s := &Server{Token: tok, ShortAlias: true}
+	for i := range shortAliasBurst + 1 {
+		code := guess(s, "192.0.2.7:5000", fmt.Sprintf("198.51.100.%d", i))
+		if i == shortAliasBurst && code != http.StatusTooManyRequests {
+			t.Errorf("guess %d with a rotated header: status %d, want 429", i, code)
+		}
+	}
+
+	// Behind a trusted proxy, each forwarded client has its own allowance
+	s = &Server{Token: tok, ShortAlias: true, TrustedProxies: mustParseIPList(t, "10.0.0.0/8")}
+	for i := range shortAliasBurst + 1 {
+		if code := guess(s, "10.1.2.3:5000", fmt.Sprintf("198.51.100.%d", i)); code == http.StatusTooManyRequests {
+			t.Errorf("client %d behind the proxy limited by the others", i)
+		}
+	}
+}
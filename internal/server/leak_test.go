@@ -203,3 +203,39 @@ func TestChecksumCache(t *testing.T) {
 		t.Error("Checksum should have changed after file modification")
 	}
 }
+
+// TestWarmChecksum verifies a single-file share's checksum is cached ahead of
+// the first download, and that other shares are left alone
+func TestWarmChecksum(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := tmpDir + "/test.txt"
+	if err := writeFile(testFile, []byte("warm me")); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	srv := &Server{SrcPath: testFile}
+	if err := srv.WarmChecksum(); err != nil {
+		t.Fatalf("WarmChecksum failed: %v", err)
+	}
+	if _, ok := srv.checksumCache.Load(testFile); !ok {
+		t.Error("Checksum not cached by WarmChecksum")
+	}
+
+	for _, srv := range []*Server{{SrcPath: tmpDir}, {SrcPath: tmpDir, SrcFiles: []string{testFile}}, {TextContent: "hi"}} {
+		if err := srv.WarmChecksum(); err != nil {
+			t.Errorf("WarmChecksum for %q failed: %v", srv.SrcPath, err)
+		}
+		count := 0
+		srv.checksumCache.Range(func(key, value interface{}) bool {
+			count++
+			return true
+		})
+		if count != 0 {
+			t.Errorf("Expected no cached checksums for %q, got %d", srv.SrcPath, count)
+		}
+	}
+
+	if err := (&Server{SrcPath: tmpDir + "/missing"}).WarmChecksum(); err == nil {
+		t.Error("Expected an error for a missing file")
+	}
+}
@@ -0,0 +1,76 @@
+package server
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/zulfikawr/warp/internal/logging"
+	"go.uber.org/zap"
+)
+
+// Retry-After bounds sent when the server is at MaxTransfers
+const (
+	minRetryAfter = 1 * time.Second
+	maxRetryAfter = 60 * time.Second
+)
+
+// transferEMAWeight is the weight of the newest sample in the duration average
+const transferEMAWeight = 0.2
+
+// acquireTransfer takes a transfer slot when MaxTransfers is set. When all slots
+// are busy it writes 503 with a Retry-After estimate and returns ok=false.
+// The returned release must be called when the transfer ends.
+func (s *Server) acquireTransfer(w http.ResponseWriter) (release func(), ok bool) {
+	if s.MaxTransfers <= 0 {
+		return func() {}, true
+	}
+	s.slotsOnce.Do(func() {
+		s.transferSlots = make(chan struct{}, s.MaxTransfers)
+	})
+
+	select {
+	case s.transferSlots <- struct{}{}:
+	default:
+		retry := s.retryAfter()
+		logging.Info("Max concurrent transfers reached", zap.Int("max_transfers", s.MaxTransfers), zap.Duration("retry_after", retry))
+		w.Header().Set("Retry-After", strconv.Itoa(int(retry/time.Second)))
+		http.Error(w, "server busy", http.StatusServiceUnavailable)
+		return nil, false
+	}
+
+	start := time.Now()
+	return func() {
+		s.recordTransferDuration(time.Since(start))
+		<-s.transferSlots
+	}, true
+}
+
+// recordTransferDuration folds d into the moving average used for Retry-After
+func (s *Server) recordTransferDuration(d time.Duration) {
+	s.transferStatsMu.Lock()
+	defer s.transferStatsMu.Unlock()
+	if s.transferAvg == 0 {
+		s.transferAvg = d
+		return
+	}
+	s.transferAvg = time.Duration(transferEMAWeight*float64(d) + (1-transferEMAWeight)*float64(s.transferAvg))
+}
+
+// retryAfter estimates when a slot frees up from the average transfer duration
+func (s *Server) retryAfter() time.Duration {
+	s.transferStatsMu.Lock()
+	avg := s.transferAvg
+	s.transferStatsMu.Unlock()
+
+	secs := math.Ceil(avg.Seconds())
+	d := time.Duration(secs) * time.Second
+	if d < minRetryAfter {
+		return minRetryAfter
+	}
+	if d > maxRetryAfter {
+		return maxRetryAfter
+	}
+	return d
+}
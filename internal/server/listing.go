@@ -0,0 +1,198 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/zulfikawr/warp/internal/archive"
+	"github.com/zulfikawr/warp/internal/logging"
+	"github.com/zulfikawr/warp/internal/metrics"
+	"github.com/zulfikawr/warp/internal/protocol"
+)
+
+// mirrorable reports whether the share can be fetched file by file: a
+// directory or SrcFiles share without a password or PAKE code, since the
+// files are served unencrypted
+func (s *Server) mirrorable() bool {
+	if s.TextContent != "" || s.Password != "" || s.PAKECode != "" {
+		return false
+	}
+	if len(s.SrcFiles) > 0 {
+		return true
+	}
+	fi, err := os.Stat(s.SrcPath)
+	return err == nil && fi.IsDir()
+}
+
+// shareFiles lists the regular files of a directory share, slash-separated
+// and relative to SrcPath, in the order the zip holds them
+func (s *Server) shareFiles() ([]string, error) {
+	if len(s.SrcFiles) > 0 {
+		files := make([]string, 0, len(s.SrcFiles))
+		for _, p := range s.SrcFiles {
+			rel, err := filepath.Rel(s.SrcPath, p)
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, filepath.ToSlash(rel))
+		}
+		return files, nil
+	}
+	// Symlinks are left out: a mirror recreates regular files only, and
+	// openShareFile refuses links that leave the directory
+	opts := s.Archive
+	opts.Symlinks = archive.SymlinksSkip
+	return archive.List(s.SrcPath, opts)
+}
+
+// handleList serves the files of a directory share with their sizes and
+// SHA256, for warp receive --mirror. Checksums come from the checksum cache,
+// so only the first listing of a tree reads all of it.
+func (s *Server) handleList(w http.ResponseWriter, r *http.Request) {
+	if !s.mirrorable() {
+		http.NotFound(w, r)
+		return
+	}
+	s.lastAccess.Store(time.Now().UnixNano())
+
+	files, err := s.shareFiles()
+	if err != nil {
+		logging.Error("Failed to list share", zap.Error(err))
+		http.Error(w, "failed to list files", http.StatusInternalServerError)
+		return
+	}
+	listing := protocol.Listing{Name: filepath.Base(s.SrcPath), Files: make([]protocol.ListingEntry, 0, len(files))}
+	for _, rel := range files {
+		p := filepath.Join(s.SrcPath, filepath.FromSlash(rel))
+		fi, err := os.Stat(p)
+		if err != nil {
+			// Removed since the walk; it would only fail to download
+			continue
+		}
+		sum, err := s.getCachedChecksum(p)
+		if err != nil {
+			logging.Warn("Left a file out of the listing", zap.String("path", rel), zap.Error(err))
+			continue
+		}
+		listing.Files = append(listing.Files, protocol.ListingEntry{Path: rel, Size: fi.Size(), SHA256: sum})
+	}
+
+	w.Header().Set("Content-Type", jsonContentType)
+	w.Header().Set("Cache-Control", noCacheControl)
+	_ = json.NewEncoder(w).Encode(listing)
+}
+
+// openShareFile opens the file of a directory share at the slash-separated
+// path rel. Only files the listing would name are served: rel must be local,
+// and resolving it through an os.Root keeps symlinks from leading out of the
+// shared directory.
+func (s *Server) openShareFile(rel string) (*os.File, os.FileInfo, error) {
+	if !fs.ValidPath(rel) || rel == "." {
+		return nil, nil, fs.ErrNotExist
+	}
+	if len(s.SrcFiles) > 0 {
+		files, err := s.shareFiles()
+		if err != nil {
+			return nil, nil, err
+		}
+		if !slices.Contains(files, rel) {
+			return nil, nil, fs.ErrNotExist
+		}
+	}
+	root, err := os.OpenRoot(s.SrcPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() { _ = root.Close() }()
+	f, err := root.Open(filepath.FromSlash(rel))
+	if err != nil {
+		return nil, nil, err
+	}
+	fi, err := f.Stat()
+	if err != nil || !fi.Mode().IsRegular() {
+		_ = f.Close()
+		return nil, nil, fs.ErrNotExist
+	}
+	return f, fi, nil
+}
+
+// handleShareFile serves one file of a directory share, named by the path
+// query parameter, with its SHA256 and attributes. A single byte range is
+// honoured, so players of a --media playlist can seek.
+func (s *Server) handleShareFile(w http.ResponseWriter, r *http.Request) {
+	if !s.mirrorable() {
+		http.NotFound(w, r)
+		return
+	}
+	rel := r.URL.Query().Get("path")
+	f, fi, err := s.openShareFile(rel)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer func() { _ = f.Close() }()
+
+	s.lastAccess.Store(time.Now().UnixNano())
+	if !s.checkQuota(w, r) {
+		return
+	}
+	release, ok := s.acquireTransfer(w)
+	if !ok {
+		return
+	}
+	defer release()
+	id, log := startTransfer(w, r, "")
+	clientIP := s.clientIP(r)
+	pt := s.trackTransfer(id, rel, protocol.DirectionDownload, fi.Size(), clientIP)
+	completed := false
+	defer func() { s.finishDownload(id, completed, nil, log) }()
+
+	if sum, err := s.getCachedChecksum(filepath.Join(s.SrcPath, filepath.FromSlash(rel))); err == nil {
+		w.Header().Set(protocol.ContentSHA256Header, sum)
+	}
+	protocol.SetFileAttrHeaders(w.Header(), fi)
+	// Players of a --media playlist go by the type; anything else stays a
+	// download so shared HTML can't run from the share's origin
+	contentType := "application/octet-stream"
+	if ct := mediaType(rel); s.Media && ct != "" {
+		contentType = ct
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Accept-Ranges", "bytes")
+
+	var writer io.Writer = w
+	if limiter := s.getRateLimiter(clientIP); limiter != nil {
+		writer = &RateLimitedWriter{w: w, limiter: limiter}
+		metrics.RateLimitedRequests.WithLabelValues(clientIP).Inc()
+	}
+	writer = &progressWriter{w: writer, pt: pt}
+
+	// Seeking players ask for ranges; a whole-file range is a plain 200
+	length := fi.Size()
+	w.Header().Set("Content-Length", fmt.Sprintf("%d", length))
+	if start, end, ok := parseByteRange(r.Header.Get("Range"), fi.Size()); ok && (start > 0 || end < fi.Size()-1) {
+		if _, err := f.Seek(start, io.SeekStart); err == nil {
+			length = end - start + 1
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, fi.Size()))
+			w.Header().Set("Content-Length", fmt.Sprintf("%d", length))
+			w.WriteHeader(http.StatusPartialContent)
+		}
+	}
+	n, err := io.CopyN(writer, f, length)
+	if errors.Is(err, io.EOF) {
+		log.Warn("Share file shrank while being served", zap.String("path", rel), zap.Int64("sent", n), zap.Int64("expected", length))
+		return
+	}
+	completed = err == nil
+}
@@ -0,0 +1,187 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/zulfikawr/warp/internal/crypto"
+	"github.com/zulfikawr/warp/internal/protocol"
+)
+
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// mirrorTree creates a shared directory with two files and symlinks leading
+// out of it, next to a secret file that must never be served
+func mirrorTree(t *testing.T) (dir string, files map[string][]byte) {
+	t.Helper()
+	parent := t.TempDir()
+	dir = filepath.Join(parent, "share")
+	files = map[string][]byte{"a.txt": []byte("alpha"), "sub/b.bin": []byte("bravo bravo")}
+	for rel, data := range files {
+		p := filepath.Join(dir, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(parent, "secret"), []byte("secret"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(parent, "secret"), filepath.Join(dir, "link")); err != nil {
+		t.Skipf("symlinks unavailable: %v", err)
+	}
+	if err := os.Symlink(parent, filepath.Join(dir, "linkdir")); err != nil {
+		t.Fatal(err)
+	}
+	return dir, files
+}
+
+func getListing(t *testing.T, u string) (int, protocol.Listing) {
+	t.Helper()
+	resp, err := http.Get(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	var listing protocol.Listing
+	if resp.StatusCode == http.StatusOK {
+		if err := json.NewDecoder(resp.Body).Decode(&listing); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return resp.StatusCode, listing
+}
+
+func getShareFile(t *testing.T, base, rel string) (*http.Response, []byte) {
+	t.Helper()
+	resp, err := http.Get(base + protocol.FilePathSuffix + "?path=" + url.QueryEscape(rel))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, body
+}
+
+func TestListDirectoryShare(t *testing.T) {
+	dir, files := mirrorTree(t)
+	tok, _ := crypto.GenerateToken(nil)
+	s := &Server{Token: tok, SrcPath: dir}
+	ts := httptest.NewServer(s.routes())
+	defer ts.Close()
+	base := ts.URL + protocol.PathPrefix + tok
+
+	status, listing := getListing(t, base+protocol.ListPathSuffix)
+	if status != http.StatusOK {
+		t.Fatalf("ls status = %d", status)
+	}
+	want := protocol.Listing{Name: "share", Files: []protocol.ListingEntry{
+		{Path: "a.txt", Size: 5, SHA256: sha256Hex(files["a.txt"])},
+		{Path: "sub/b.bin", Size: 11, SHA256: sha256Hex(files["sub/b.bin"])},
+	}}
+	if !reflect.DeepEqual(listing, want) {
+		t.Errorf("listing = %+v, want %+v (symlinks left out)", listing, want)
+	}
+
+	for _, e := range listing.Files {
+		resp, body := getShareFile(t, base, e.Path)
+		if resp.StatusCode != http.StatusOK || string(body) != string(files[e.Path]) {
+			t.Errorf("file %s: status %d, body %q", e.Path, resp.StatusCode, body)
+		}
+		if got := resp.Header.Get(protocol.ContentSHA256Header); got != e.SHA256 {
+			t.Errorf("file %s: %s = %q, want %q", e.Path, protocol.ContentSHA256Header, got, e.SHA256)
+		}
+	}
+
+	caps := getCapabilities(t, base+protocol.InfoPathSuffix)
+	if !caps.Has(protocol.FeatureMirror) {
+		t.Errorf("info features = %v, want %s for a directory share", caps.Features, protocol.FeatureMirror)
+	}
+}
+
+func TestShareFileStaysInShare(t *testing.T) {
+	dir, _ := mirrorTree(t)
+	tok, _ := crypto.GenerateToken(nil)
+	s := &Server{Token: tok, SrcPath: dir}
+	ts := httptest.NewServer(s.routes())
+	defer ts.Close()
+	base := ts.URL + protocol.PathPrefix + tok
+
+	for _, rel := range []string{"", ".", "sub", "../secret", "sub/../../secret", "/etc/passwd", "link", "linkdir/secret", `sub\..\..\secret`} {
+		if resp, body := getShareFile(t, base, rel); resp.StatusCode != http.StatusNotFound {
+			t.Errorf("path %q: status %d, body %q; want 404", rel, resp.StatusCode, body)
+		}
+	}
+}
+
+func TestListOnlyMirrorableShares(t *testing.T) {
+	dir, _ := mirrorTree(t)
+	file := filepath.Join(dir, "a.txt")
+	tests := []struct {
+		name string
+		srv  *Server
+	}{
+		{"single file", &Server{SrcPath: file}},
+		{"text", &Server{TextContent: "hello"}},
+		{"password", &Server{SrcPath: dir, Password: "hunter2"}},
+		{"pake", &Server{SrcPath: dir, PAKECode: "7-apple-velocity"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := tt.srv
+			s.Token, _ = crypto.GenerateToken(nil)
+			ts := httptest.NewServer(s.routes())
+			defer ts.Close()
+			base := ts.URL + protocol.PathPrefix + s.Token
+
+			if status, _ := getListing(t, base+protocol.ListPathSuffix); status != http.StatusNotFound {
+				t.Errorf("ls status = %d, want 404", status)
+			}
+			if resp, _ := getShareFile(t, base, "a.txt"); resp.StatusCode != http.StatusNotFound {
+				t.Errorf("file status = %d, want 404", resp.StatusCode)
+			}
+		})
+	}
+}
+
+func TestListSrcFilesShare(t *testing.T) {
+	dir, files := mirrorTree(t)
+	tok, _ := crypto.GenerateToken(nil)
+	s := &Server{Token: tok, SrcPath: dir, SrcFiles: []string{filepath.Join(dir, "sub", "b.bin")}}
+	ts := httptest.NewServer(s.routes())
+	defer ts.Close()
+	base := ts.URL + protocol.PathPrefix + tok
+
+	_, listing := getListing(t, base+protocol.ListPathSuffix)
+	paths := make([]string, 0, len(listing.Files))
+	for _, e := range listing.Files {
+		paths = append(paths, e.Path)
+	}
+	if !slices.Equal(paths, []string{"sub/b.bin"}) {
+		t.Errorf("listed %v, want only the shared file", paths)
+	}
+	if resp, body := getShareFile(t, base, "sub/b.bin"); resp.StatusCode != http.StatusOK || string(body) != string(files["sub/b.bin"]) {
+		t.Errorf("shared file: status %d, body %q", resp.StatusCode, body)
+	}
+	if resp, _ := getShareFile(t, base, "a.txt"); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("unshared file in the same directory: status %d, want 404", resp.StatusCode)
+	}
+}
@@ -0,0 +1,147 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/time/rate"
+
+	"github.com/zulfikawr/warp/internal/crypto"
+	"github.com/zulfikawr/warp/internal/logging"
+	"github.com/zulfikawr/warp/internal/protocol"
+)
+
+// noCacheControl is the Cache-Control of responses that must never be reused
+const noCacheControl = "no-store, no-cache, must-revalidate, max-age=0"
+
+// jsonContentType is the Content-Type of JSON API responses
+const jsonContentType = "application/json; charset=utf-8"
+
+// middleware wraps a handler with behavior shared by several endpoints
+type middleware func(http.HandlerFunc) http.HandlerFunc
+
+// chain wraps h in mws, the first outermost, so chain(h, a, b) runs a, then
+// b, then h
+func chain(h http.HandlerFunc, mws ...middleware) http.HandlerFunc {
+	for i := len(mws) - 1; i >= 0; i-- {
+		h = mws[i](h)
+	}
+	return h
+}
+
+// setNoCache keeps browsers and proxies, HTTP/1.0 ones included, from
+// storing a response. For handlers that can fail before they know the
+// response is theirs to mark; the others use noCache.
+func setNoCache(h http.Header) {
+	h.Set("Cache-Control", noCacheControl)
+	h.Set("Pragma", "no-cache")
+	h.Set("Expires", "0")
+}
+
+// noCache marks every response of next as not to be stored
+func noCache(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		setNoCache(w.Header())
+		next(w, r)
+	}
+}
+
+// cacheControl sets the Cache-Control header alone, for responses only warp's
+// own clients read
+func cacheControl(value string) middleware {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Cache-Control", value)
+			next(w, r)
+		}
+	}
+}
+
+// jsonResponse declares the response of next to be JSON. An http.Error
+// from next still replaces it with text/plain.
+func jsonResponse(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", jsonContentType)
+		next(w, r)
+	}
+}
+
+// requireMethod answers 405 to requests with any other method
+func requireMethod(methods ...string) middleware {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if !slices.Contains(methods, r.Method) {
+				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			next(w, r)
+		}
+	}
+}
+
+// tokenParser finds the token in a request's path, along with the rest of
+// the path after it
+type tokenParser func(r *http.Request) (token, rest string, err error)
+
+// shareToken parses /d/{token}[/rest] and /u/{token}[/rest], see
+// protocol.ParseSharePath
+func shareToken(r *http.Request) (string, string, error) {
+	_, token, rest, err := protocol.ParseSharePath(r.URL.EscapedPath())
+	return token, rest, err
+}
+
+// progressToken parses /ws/progress/{token}
+func progressToken(r *http.Request) (string, string, error) {
+	return strings.TrimPrefix(r.URL.Path, protocol.ProgressPathPrefix), "", nil
+}
+
+// shareRestKey is the context key of the path after the token
+type shareRestKey struct{}
+
+// requireToken answers 403 unless the path holds the share token, compared
+// in constant time. next finds the rest of the path with shareRest.
+func (s *Server) requireToken(parse tokenParser) middleware {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			token, rest, err := parse(r)
+			if err != nil || !crypto.TokenEqual(token, s.Token) {
+				s.rejectToken(w, r)
+				return
+			}
+			if rest != "" {
+				r = r.WithContext(context.WithValue(r.Context(), shareRestKey{}, rest))
+			}
+			next(w, r)
+		}
+	}
+}
+
+// shareRest returns the path after the token checked by requireToken, e.g.
+// "/stats"; "" for the share itself
+func shareRest(r *http.Request) string {
+	rest, _ := r.Context().Value(shareRestKey{}).(string)
+	return rest
+}
+
+// clientIPRateLimit answers 429 with a Retry-After of retry when the
+// client's limiter, from limiterFor, has no token left. what names the
+// requests in the log.
+func (s *Server) clientIPRateLimit(what string, limiterFor func(clientIP string) *rate.Limiter, retry time.Duration) middleware {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			clientIP := s.clientIP(r)
+			if !limiterFor(clientIP).Allow() {
+				logging.Warn(what+" rate limited", zap.String("client_ip", clientIP))
+				w.Header().Set("Retry-After", strconv.Itoa(int(retry/time.Second)))
+				http.Error(w, "too many requests", http.StatusTooManyRequests)
+				return
+			}
+			next(w, r)
+		}
+	}
+}
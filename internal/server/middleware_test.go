@@ -0,0 +1,145 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+func TestChainOrder(t *testing.T) {
+	var order []string
+	mw := func(name string) middleware {
+		return func(next http.HandlerFunc) http.HandlerFunc {
+			return func(w http.ResponseWriter, r *http.Request) {
+				order = append(order, name)
+				next(w, r)
+			}
+		}
+	}
+	h := chain(func(http.ResponseWriter, *http.Request) { order = append(order, "handler") }, mw("a"), mw("b"))
+	h(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	if got := strings.Join(order, ","); got != "a,b,handler" {
+		t.Fatalf("order = %s", got)
+	}
+}
+
+func TestRequireTokenPassesRest(t *testing.T) {
+	s := &Server{Token: "tok123"}
+	var rest string
+	h := chain(func(w http.ResponseWriter, r *http.Request) { rest = shareRest(r) }, s.requireToken(shareToken))
+	for path, want := range map[string]string{"/d/tok123": "", "/d/tok123/": "", "/u/tok123/verify/job-1": "/verify/job-1"} {
+		rest = "unset"
+		rec := httptest.NewRecorder()
+		h(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusOK || rest != want {
+			t.Errorf("%s: status %d, rest %q, want %q", path, rec.Code, rest, want)
+		}
+	}
+	rec := httptest.NewRecorder()
+	h(rec, httptest.NewRequest(http.MethodGet, "/d/tok124/stats", nil))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("wrong token: status %d, want 403", rec.Code)
+	}
+}
+
+func TestClientIPRateLimit(t *testing.T) {
+	s := &Server{}
+	limiter := rate.NewLimiter(rate.Every(time.Hour), 1)
+	h := chain(func(http.ResponseWriter, *http.Request) {}, s.clientIPRateLimit("Test requests", func(string) *rate.Limiter { return limiter }, 10*time.Second))
+	codes := make([]int, 2)
+	var last *httptest.ResponseRecorder
+	for i := range codes {
+		last = httptest.NewRecorder()
+		h(last, httptest.NewRequest(http.MethodGet, "/", nil))
+		codes[i] = last.Code
+	}
+	if codes[0] != http.StatusOK || codes[1] != http.StatusTooManyRequests || last.Header().Get("Retry-After") != "10" {
+		t.Fatalf("codes = %v, Retry-After %q", codes, last.Header().Get("Retry-After"))
+	}
+}
+
+// TestRouteHeaders pins the headers each endpoint answered with before its
+// boilerplate moved into middleware
+func TestRouteHeaders(t *testing.T) {
+	src := t.TempDir()
+	if err := os.WriteFile(filepath.Join(src, "a.txt"), []byte("hello"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	const tok = "tok123"
+	send := &Server{Token: tok, SrcPath: src, ManagementSecret: "secret", ShortAlias: true}
+	send.tokens.add("abc123", tok)
+	host := &Server{Token: tok, HostMode: true, UploadDir: t.TempDir(), ManagementSecret: "secret"}
+
+	const (
+		json        = "Content-Type=" + jsonContentType
+		noCacheJSON = "Cache-Control=" + noCacheControl + "|" + json + "|Expires=0|Pragma=no-cache"
+		plainError  = "Content-Type=text/plain; charset=utf-8|X-Content-Type-Options=nosniff"
+	)
+	tests := []struct {
+		srv          *Server
+		method, path string
+		status       int
+		headers      string // Sorted name=value pairs, Date and transfer IDs left out
+	}{
+		{send, "GET", "/health", 200, noCacheJSON},
+		{send, "GET", "/d/encrypt-info", 200, noCacheJSON},
+		{send, "POST", "/d/encrypt-info", 405, plainError},
+		{send, "GET", "/speedtest/download?size=10", 200, "Cache-Control=" + noCacheControl + "|Content-Length=10|Content-Type=application/octet-stream|Pragma=no-cache"},
+		{send, "POST", "/speedtest/download", 405, plainError},
+		{send, "GET", "/speedtest/download?size=0", 400, plainError},
+		{send, "POST", "/speedtest/upload", 200, "Content-Type=application/json"},
+		{send, "GET", "/speedtest/upload", 405, plainError},
+		{send, "GET", "/pake/init", 405, plainError},
+		{send, "GET", "/d/" + tok + "/info", 200, noCacheJSON},
+		{send, "POST", "/d/" + tok + "/info", 405, plainError},
+		{send, "GET", "/d/" + tok + "/stats", 200, "Cache-Control=" + noCacheControl + "|" + json},
+		{send, "POST", "/d/" + tok + "/stats", 405, plainError},
+		{send, "GET", "/d/" + tok + "/ls", 200, "Cache-Control=" + noCacheControl + "|" + json},
+		{send, "POST", "/d/" + tok + "/file?path=a.txt", 405, plainError},
+		{send, "GET", "/d/" + tok + "/file?path=missing", 404, plainError},
+		{send, "PUT", "/d/" + tok + "/playlist.m3u8", 405, plainError},
+		{send, "GET", "/d/" + tok + "/stop", 405, plainError},
+		{send, "POST", "/d/" + tok + "/stop", 403, plainError},
+		{send, "GET", "/d/" + tok + "/nope", 404, plainError},
+		{send, "GET", "/d/wrong/stats", 403, plainError},
+		{send, "GET", "/s/abc123", 302, "Content-Type=text/html; charset=utf-8|Location=/d/" + tok},
+		{send, "POST", "/s/abc123", 405, "Allow=GET, HEAD|" + plainError},
+		{send, "GET", "/s/zzzzzz", 403, plainError},
+		{host, "GET", "/u/" + tok + "/manifest", 200, noCacheJSON},
+		{host, "POST", "/u/" + tok + "/manifest", 405, plainError},
+		{host, "GET", "/u/" + tok + "/stats", 200, "Cache-Control=" + noCacheControl + "|" + json},
+		{host, "GET", "/u/" + tok + "/finalize", 405, plainError},
+		{host, "POST", "/u/" + tok + "/finalize", 400, plainError},
+		{host, "GET", "/u/" + tok + "/verify/x", 404, plainError},
+		{host, "POST", "/u/" + tok + "/verify/x", 405, plainError},
+		{host, "GET", "/u/" + tok + "/session/x", 400, plainError},
+		{host, "POST", "/u/" + tok + "/session/x", 405, plainError},
+		{host, "GET", "/u/" + tok + "/session/0123456789abcdef", 404, plainError},
+		{host, "PUT", "/u/" + tok, 405, plainError},
+		{host, "GET", "/u/" + tok + "/verify/", 404, plainError},
+		{host, "GET", "/u/wrong", 403, plainError},
+		{host, "GET", "/ws/progress/wrong", 403, plainError},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		tt.srv.routes().ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, nil))
+		var got []string
+		for name, values := range rec.Header() {
+			if name == "Date" || strings.HasSuffix(name, "Transfer-Id") {
+				continue
+			}
+			got = append(got, name+"="+strings.Join(values, ","))
+		}
+		slices.Sort(got)
+		if rec.Code != tt.status || strings.Join(got, "|") != tt.headers {
+			t.Errorf("%s %s = %d\n  %s\nwant %d\n  %s", tt.method, tt.path, rec.Code, strings.Join(got, "|"), tt.status, tt.headers)
+		}
+	}
+}
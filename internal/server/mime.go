@@ -0,0 +1,58 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// sniffLen is how much of a file http.DetectContentType looks at
+const sniffLen = 512
+
+// contentTypeFor names the media type of the file at path, by extension when
+// it has a known one and by sniffing the first bytes of f otherwise. ReadAt
+// leaves f's offset alone.
+func contentTypeFor(path string, f *os.File) string {
+	if ct := mime.TypeByExtension(strings.ToLower(filepath.Ext(path))); ct != "" {
+		return ct
+	}
+	buf := make([]byte, sniffLen)
+	n, err := f.ReadAt(buf, 0)
+	if err != nil && err != io.EOF {
+		return "application/octet-stream"
+	}
+	if n == 0 {
+		return "application/octet-stream"
+	}
+	return http.DetectContentType(buf[:n])
+}
+
+// isPreviewable reports whether a browser can show the type in place without
+// running anything from it. HTML and SVG carry script, so they always download.
+func isPreviewable(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	switch {
+	case mediaType == "image/svg+xml":
+		return false
+	case strings.HasPrefix(mediaType, "image/"),
+		strings.HasPrefix(mediaType, "video/"),
+		strings.HasPrefix(mediaType, "audio/"):
+		return true
+	}
+	return mediaType == "application/pdf" || mediaType == "text/plain"
+}
+
+// contentDisposition builds the Content-Disposition for a file download
+func contentDisposition(inline bool, name string) string {
+	if inline {
+		return fmt.Sprintf("inline; filename=\"%s\"", name)
+	}
+	return fmt.Sprintf("attachment; filename=\"%s\"", name)
+}
@@ -0,0 +1,133 @@
+package server
+
+import (
+	"io"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/zulfikawr/warp/internal/crypto"
+	"github.com/zulfikawr/warp/internal/protocol"
+)
+
+func TestContentTypeFor(t *testing.T) {
+	// Go knows .mp4 only from the system's mime.types, which may be missing
+	if err := mime.AddExtensionType(".mp4", "video/mp4"); err != nil {
+		t.Fatal(err)
+	}
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x0dIHDR")
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"photo.png", png, "image/png"},
+		{"photo.JPG", []byte("not really a jpeg"), "image/jpeg"},
+		{"report.pdf", []byte("%PDF-1.7"), "application/pdf"},
+		{"clip.mp4", []byte{0, 0, 0, 0x18}, "video/mp4"},
+		{"notes.txt", []byte("hello"), "text/plain; charset=utf-8"},
+		{"archive.zip", []byte("PK\x03\x04"), "application/zip"},
+		// No extension: the first bytes decide
+		{"screenshot", png, "image/png"},
+		{"README", []byte("just some words\n"), "text/plain; charset=utf-8"},
+		{"blob", []byte{0x00, 0x01, 0x02, 0xfe}, "application/octet-stream"},
+		{"empty", nil, "application/octet-stream"},
+	}
+	dir := t.TempDir()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.name)
+			if err := os.WriteFile(path, tt.data, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			f, err := os.Open(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() { _ = f.Close() }()
+
+			if got := contentTypeFor(path, f); got != tt.want {
+				t.Errorf("contentTypeFor = %q, want %q", got, tt.want)
+			}
+			if off, _ := f.Seek(0, io.SeekCurrent); off != 0 {
+				t.Errorf("sniffing moved the offset to %d", off)
+			}
+		})
+	}
+}
+
+func TestIsPreviewable(t *testing.T) {
+	tests := map[string]bool{
+		"image/png":                 true,
+		"video/mp4":                 true,
+		"audio/mpeg":                true,
+		"application/pdf":           true,
+		"text/plain; charset=utf-8": true,
+		"image/svg+xml":             false,
+		"text/html; charset=utf-8":  false,
+		"application/zip":           false,
+		"application/octet-stream":  false,
+		"":                          false,
+	}
+	for ct, want := range tests {
+		if got := isPreviewable(ct); got != want {
+			t.Errorf("isPreviewable(%q) = %v, want %v", ct, got, want)
+		}
+	}
+}
+
+func TestDownloadContentTypeAndDisposition(t *testing.T) {
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x0dIHDR")
+	tests := []struct {
+		name       string
+		file       string
+		data       []byte
+		inline     bool
+		wantType   string
+		wantInline bool
+	}{
+		{"attachment by default", "photo.png", png, false, "image/png", false},
+		{"inline image", "photo.png", png, true, "image/png", true},
+		{"sniffed inline", "screenshot", png, true, "image/png", true},
+		{"html never inline", "page.html", []byte("<html></html>"), true, "text/html; charset=utf-8", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tt.file)
+			if err := os.WriteFile(path, tt.data, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			tok, _ := crypto.GenerateToken(nil)
+			s := &Server{Token: tok, SrcPath: path, Inline: tt.inline}
+			ts := httptest.NewServer(s.routes())
+			defer ts.Close()
+
+			req, _ := http.NewRequest(http.MethodGet, ts.URL+protocol.PathPrefix+tok, nil)
+			req.Header.Set("Accept-Encoding", "identity")
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, _ = io.Copy(io.Discard, resp.Body)
+			_ = resp.Body.Close()
+
+			if ct := resp.Header.Get("Content-Type"); ct != tt.wantType {
+				t.Errorf("Content-Type = %q, want %q", ct, tt.wantType)
+			}
+			if nosniff := resp.Header.Get("X-Content-Type-Options"); nosniff != "nosniff" {
+				t.Errorf("X-Content-Type-Options = %q", nosniff)
+			}
+			cd := resp.Header.Get("Content-Disposition")
+			if got := strings.HasPrefix(cd, "inline;"); got != tt.wantInline {
+				t.Errorf("Content-Disposition = %q, want inline %v", cd, tt.wantInline)
+			}
+			if !strings.Contains(cd, `filename="`+tt.file+`"`) {
+				t.Errorf("Content-Disposition = %q lacks the file name", cd)
+			}
+		})
+	}
+}
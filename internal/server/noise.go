@@ -0,0 +1,56 @@
+package server
+
+import (
+	"net/http"
+	"path"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/zulfikawr/warp/internal/logging"
+	"github.com/zulfikawr/warp/internal/metrics"
+)
+
+// robotsTxt keeps crawlers away from share URLs
+const robotsTxt = "User-agent: *\nDisallow: /\n"
+
+// handleFavicon serves the embedded icon browsers ask for on every visit
+func (s *Server) handleFavicon(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "image/x-icon")
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	_, _ = w.Write(faviconICO)
+}
+
+// handleRobots disallows everything
+func (s *Server) handleRobots(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_, _ = w.Write([]byte(robotsTxt))
+}
+
+// handleWellKnown answers /.well-known/* probes with an empty 204
+func (s *Server) handleWellKnown(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// isNoisePath reports whether p is something browsers fetch on their own,
+// e.g. favicon.ico relative to a share page, rather than a guessed token
+func isNoisePath(p string) bool {
+	if strings.Contains(p, "/.well-known/") {
+		return true
+	}
+	base := path.Base(p)
+	return base == "favicon.ico" || base == "robots.txt" || strings.HasPrefix(base, "apple-touch-icon")
+}
+
+// rejectToken answers 403 for a path whose token doesn't match. Wrong tokens
+// are logged at warn and counted; browser noise only shows up at debug.
+func (s *Server) rejectToken(w http.ResponseWriter, r *http.Request) {
+	fields := []zap.Field{zap.String("client_ip", s.clientIP(r)), zap.String("path", r.URL.Path)}
+	if isNoisePath(r.URL.Path) {
+		logging.Debug("Ignored browser request without a token", fields...)
+	} else {
+		logging.Warn("Rejected request with wrong token", fields...)
+		metrics.TokenRejectedTotal.Inc()
+	}
+	http.Error(w, "forbidden", http.StatusForbidden)
+}
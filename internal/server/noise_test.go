@@ -0,0 +1,101 @@
+package server
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/zulfikawr/warp/internal/crypto"
+	"github.com/zulfikawr/warp/internal/logging"
+	"github.com/zulfikawr/warp/internal/metrics"
+)
+
+func TestBrowserNoiseEndpoints(t *testing.T) {
+	tok, _ := crypto.GenerateToken(nil)
+	ts := httptest.NewServer((&Server{Token: tok, TextContent: "hi"}).routes())
+	defer ts.Close()
+
+	tests := []struct {
+		path       string
+		wantStatus int
+		wantType   string
+		wantBody   []byte
+	}{
+		{"/favicon.ico", http.StatusOK, "image/x-icon", []byte{0, 0, 1, 0}},
+		{"/robots.txt", http.StatusOK, "text/plain; charset=utf-8", []byte("User-agent: *\nDisallow: /\n")},
+		{"/.well-known/security.txt", http.StatusNoContent, "", nil},
+		{"/.well-known/appspecific/com.chrome.devtools.json", http.StatusNoContent, "", nil},
+	}
+	for _, tt := range tests {
+		resp, err := http.Get(ts.URL + tt.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		if resp.StatusCode != tt.wantStatus {
+			t.Errorf("%s: status %d, want %d", tt.path, resp.StatusCode, tt.wantStatus)
+		}
+		if ct := resp.Header.Get("Content-Type"); tt.wantType != "" && ct != tt.wantType {
+			t.Errorf("%s: Content-Type = %q, want %q", tt.path, ct, tt.wantType)
+		}
+		if !bytes.HasPrefix(body, tt.wantBody) {
+			t.Errorf("%s: body starts %q, want %q", tt.path, body[:min(len(body), 8)], tt.wantBody)
+		}
+		if tt.wantBody == nil && len(body) != 0 {
+			t.Errorf("%s: body = %q, want empty", tt.path, body)
+		}
+	}
+}
+
+func TestWrongTokenLogLevel(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	defer logging.ReplaceLogger(zap.New(core))()
+
+	tok, _ := crypto.GenerateToken(nil)
+	download := httptest.NewServer((&Server{Token: tok, TextContent: "hi"}).routes())
+	defer download.Close()
+	upload := httptest.NewServer((&Server{Token: tok, HostMode: true}).routes())
+	defer upload.Close()
+
+	tests := []struct {
+		url       string
+		wantLevel zapcore.Level
+		counted   bool
+	}{
+		{download.URL + "/d/favicon.ico", zapcore.DebugLevel, false},
+		{upload.URL + "/u/apple-touch-icon-precomposed.png", zapcore.DebugLevel, false},
+		{upload.URL + "/u/.well-known/change-password", zapcore.DebugLevel, false},
+		{download.URL + "/d/not-the-token", zapcore.WarnLevel, true},
+		{upload.URL + "/u/not-the-token/manifest", zapcore.WarnLevel, true},
+	}
+	for _, tt := range tests {
+		logs.TakeAll()
+		before := testutil.ToFloat64(metrics.TokenRejectedTotal)
+
+		resp, err := http.Get(tt.url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = resp.Body.Close()
+		if resp.StatusCode != http.StatusForbidden {
+			t.Errorf("%s: status %d, want 403", tt.url, resp.StatusCode)
+		}
+
+		entries := logs.TakeAll()
+		if len(entries) != 1 || entries[0].Level != tt.wantLevel {
+			t.Errorf("%s: logged %v, want one %s entry", tt.url, entries, tt.wantLevel)
+		}
+		counted := testutil.ToFloat64(metrics.TokenRejectedTotal) == before+1
+		if counted != tt.counted {
+			t.Errorf("%s: counted as a wrong token = %v, want %v", tt.url, counted, tt.counted)
+		}
+	}
+}
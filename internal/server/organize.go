@@ -0,0 +1,102 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Organize controls which subdirectory of UploadDir an upload lands in
+type Organize string
+
+const (
+	// OrganizeNone keeps every upload directly in UploadDir (the default)
+	OrganizeNone Organize = "none"
+	// OrganizeDate files uploads under <dest>/YYYY-MM-DD/ by local date
+	OrganizeDate Organize = "date"
+	// OrganizeSender files uploads under <dest>/<client-ip>/
+	OrganizeSender Organize = "sender"
+)
+
+// dateLayout names the per-day directories of OrganizeDate
+const dateLayout = "2006-01-02"
+
+// ParseOrganize validates an --organize value; empty means none
+func ParseOrganize(s string) (Organize, error) {
+	switch o := Organize(s); o {
+	case "":
+		return OrganizeNone, nil
+	case OrganizeNone, OrganizeDate, OrganizeSender:
+		return o, nil
+	}
+	return "", fmt.Errorf("invalid organize mode %q (want date, sender or none)", s)
+}
+
+// now is the clock behind OrganizeDate and PAKE session expiry; tests
+// replace it through s.clock
+func (s *Server) now() time.Time {
+	if s.clock != nil {
+		return s.clock()
+	}
+	return time.Now()
+}
+
+// uploadDir resolves the directory an upload from r is written to, and its
+// path relative to UploadDir ("" when uploads are not organized). Callers
+// create it when they write the file, so no empty directories pile up.
+func (s *Server) uploadDir(r *http.Request) (dir, rel string) {
+	dest := s.UploadDir
+	if dest == "" {
+		dest = "."
+	}
+	switch s.Organize {
+	case OrganizeDate:
+		rel = s.now().Format(dateLayout)
+	case OrganizeSender:
+		rel = senderDir(s.clientIP(r))
+	}
+	return filepath.Join(dest, rel), rel
+}
+
+// senderDir turns a client IP into a directory name. IPv6 colons and zone
+// separators become dashes so the name is valid on every filesystem.
+func senderDir(ip string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= '0' && r <= '9', r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r == '.':
+			return r
+		}
+		return '-'
+	}, ip)
+	if name, err := sanitizeFilename(name); err == nil {
+		return name
+	}
+	return "unknown"
+}
+
+// resumeDir finds the directory a legacy chunked upload already writes to.
+// One that started before midnight keeps going in the previous day's
+// directory rather than restarting in today's.
+func (s *Server) resumeDir(dir, rel, name string) (string, string) {
+	if s.Organize != OrganizeDate {
+		return dir, rel
+	}
+	if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+		return dir, rel
+	}
+	prevRel := s.now().AddDate(0, 0, -1).Format(dateLayout)
+	prev := filepath.Join(filepath.Dir(dir), prevRel)
+	if _, err := os.Stat(filepath.Join(prev, name)); err == nil {
+		return prev, prevRel
+	}
+	return dir, rel
+}
+
+// relPath is a saved file's path relative to UploadDir, as reported to
+// clients and logs
+func relPath(rel, filename string) string {
+	return filepath.ToSlash(filepath.Join(rel, filename))
+}
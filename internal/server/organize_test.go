@@ -0,0 +1,184 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/zulfikawr/warp/internal/crypto"
+	"github.com/zulfikawr/warp/internal/protocol"
+)
+
+func TestParseOrganize(t *testing.T) {
+	for in, want := range map[string]Organize{"": OrganizeNone, "none": OrganizeNone, "date": OrganizeDate, "sender": OrganizeSender} {
+		if got, err := ParseOrganize(in); err != nil || got != want {
+			t.Errorf("ParseOrganize(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	if _, err := ParseOrganize("month"); err == nil {
+		t.Error("ParseOrganize accepted an unknown mode")
+	}
+}
+
+func TestSenderDir(t *testing.T) {
+	tests := map[string]string{
+		"192.168.1.20":     "192.168.1.20",
+		"2001:db8::1":      "2001-db8--1",
+		"fe80::1%eth0":     "fe80--1-eth0",
+		"":                 "unknown",
+		"../../etc/passwd": "unknown",
+	}
+	for ip, want := range tests {
+		if got := senderDir(ip); got != want {
+			t.Errorf("senderDir(%q) = %q, want %q", ip, got, want)
+		}
+	}
+}
+
+// organizedServer runs a host-mode server over a temp dir whose clock reads
+// from the returned value
+func organizedServer(t *testing.T, mode Organize) (*Server, *httptest.Server, *atomic.Int64) {
+	t.Helper()
+	tok, _ := crypto.GenerateToken(nil)
+	var clock atomic.Int64
+	s := &Server{Token: tok, HostMode: true, UploadDir: t.TempDir(), Organize: mode}
+	s.clock = func() time.Time { return time.Unix(0, clock.Load()) }
+	ts := httptest.NewServer(s.routes())
+	t.Cleanup(ts.Close)
+	return s, ts, &clock
+}
+
+// rawUpload sends body as a raw upload and returns the filename the server reports
+func rawUpload(t *testing.T, ts *httptest.Server, tok, name string, body []byte, headers map[string]string) string {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodPost, ts.URL+protocol.UploadPathPrefix+tok, bytes.NewReader(body))
+	req.Header.Set("X-File-Name", name)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("upload %s: status %d", name, resp.StatusCode)
+	}
+	var out struct {
+		Filename string `json:"filename"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		t.Fatal(err)
+	}
+	return out.Filename
+}
+
+func TestOrganizeDateRollsOverAtMidnight(t *testing.T) {
+	s, ts, clock := organizedServer(t, OrganizeDate)
+	beforeMidnight := time.Date(2025, 6, 12, 23, 59, 58, 0, time.Local)
+	afterMidnight := time.Date(2025, 6, 13, 0, 0, 1, 0, time.Local)
+
+	clock.Store(beforeMidnight.UnixNano())
+	if got := rawUpload(t, ts, s.Token, "notes.txt", []byte("first"), nil); got != "2025-06-12/notes.txt" {
+		t.Errorf("reported %q, want 2025-06-12/notes.txt", got)
+	}
+	// A parallel upload starts before midnight...
+	const chunkSize = 64 << 10
+	chunk := func(id int, offset int64, length int) string {
+		return rawUpload(t, ts, s.Token, "video.bin", bytes.Repeat([]byte{'v'}, length), map[string]string{
+			"X-Upload-Session":       "midnight-session-1",
+			"X-Upload-Offset":        fmt.Sprint(offset),
+			"X-Upload-Total":         fmt.Sprint(chunkSize + 10),
+			"X-Chunk-Id":             fmt.Sprint(id),
+			"X-Chunk-Total":          "2",
+			protocol.ChunkSizeHeader: fmt.Sprint(chunkSize),
+		})
+	}
+	chunk(0, 0, chunkSize)
+	// ...and so does a legacy sequential one
+	legacy := func(offset int64, data string) string {
+		return rawUpload(t, ts, s.Token, "log.txt", []byte(data), map[string]string{"X-Upload-Offset": fmt.Sprint(offset)})
+	}
+	legacy(0, "01234")
+
+	clock.Store(afterMidnight.UnixNano())
+	if got := rawUpload(t, ts, s.Token, "notes.txt", []byte("second"), nil); got != "2025-06-13/notes.txt" {
+		t.Errorf("reported %q after midnight, want 2025-06-13/notes.txt", got)
+	}
+	if got := chunk(1, chunkSize, 10); got != "2025-06-12/video.bin" {
+		t.Errorf("session finished as %q, want it to stay in 2025-06-12", got)
+	}
+	if got := legacy(5, "56789"); got != "2025-06-12/log.txt" {
+		t.Errorf("legacy upload finished as %q, want it to stay in 2025-06-12", got)
+	}
+
+	// Multipart uploads from the browser page
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, _ := mw.CreateFormFile("file", "photo.jpg")
+	_, _ = fw.Write([]byte("jpeg"))
+	_ = mw.Close()
+	req, _ := http.NewRequest(http.MethodPost, ts.URL+protocol.UploadPathPrefix+s.Token, &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("multipart upload: status %d", resp.StatusCode)
+	}
+
+	want := map[string]string{
+		"2025-06-12/notes.txt": "first",
+		"2025-06-13/notes.txt": "second",
+		"2025-06-12/log.txt":   "0123456789",
+		"2025-06-13/photo.jpg": "jpeg",
+	}
+	for rel, content := range want {
+		b, err := os.ReadFile(filepath.Join(s.UploadDir, rel))
+		if err != nil || string(b) != content {
+			t.Errorf("%s = %q (%v), want %q", rel, b, err, content)
+		}
+	}
+	if fi, err := os.Stat(filepath.Join(s.UploadDir, "2025-06-12", "video.bin")); err != nil || fi.Size() != chunkSize+10 {
+		t.Errorf("video.bin: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(s.UploadDir, "2025-06-13", "video.bin")); !os.IsNotExist(err) {
+		t.Error("session also created a file in the new day's directory")
+	}
+}
+
+func TestOrganizeSender(t *testing.T) {
+	s, ts, _ := organizedServer(t, OrganizeSender)
+	if got := rawUpload(t, ts, s.Token, "a.txt", []byte("one"), nil); got != "127.0.0.1/a.txt" {
+		t.Errorf("reported %q, want 127.0.0.1/a.txt", got)
+	}
+	// Unique names are per sender directory
+	if got := rawUpload(t, ts, s.Token, "a.txt", []byte("two"), nil); got != "127.0.0.1/a (1).txt" {
+		t.Errorf("reported %q, want 127.0.0.1/a (1).txt", got)
+	}
+
+	s.TrustProxy = true
+	if got := rawUpload(t, ts, s.Token, "a.txt", []byte("three"), map[string]string{"X-Forwarded-For": "2001:db8::1"}); got != "2001-db8--1/a.txt" {
+		t.Errorf("reported %q, want 2001-db8--1/a.txt", got)
+	}
+	if _, err := os.Stat(filepath.Join(s.UploadDir, "a.txt")); !os.IsNotExist(err) {
+		t.Error("upload landed in the top-level directory")
+	}
+}
+
+func TestOrganizeNoneKeepsFlatLayout(t *testing.T) {
+	s, ts, _ := organizedServer(t, OrganizeNone)
+	if got := rawUpload(t, ts, s.Token, "a.txt", []byte("one"), nil); got != "a.txt" {
+		t.Errorf("reported %q, want a.txt", got)
+	}
+}
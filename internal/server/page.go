@@ -0,0 +1,141 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"net/http"
+	"os"
+	"path/filepath"
+	"text/template/parse"
+
+	"go.uber.org/zap"
+
+	"github.com/zulfikawr/warp/internal/logging"
+	"github.com/zulfikawr/warp/internal/protocol"
+	"github.com/zulfikawr/warp/internal/ui"
+)
+
+// PageData feeds the upload page template, the embedded one or a
+// --page-template of the user's. Its paths are relative to the page at
+// /u/{token}, so they still resolve when a reverse proxy serves the host
+// under a path prefix.
+type PageData struct {
+	UploadPath   string // Where the form and the chunk uploads POST: {token}
+	ManifestPath string // The upload manifest with chunk size and concurrency
+	ProgressPath string // The progress WebSocket, ../ws/progress/{token}
+	MaxSize      string // Largest file accepted, e.g. "10.0 GiB"
+	MaxSizeBytes int64
+	RecentSpeed  int64 // Bytes per second of recent uploads, for a time estimate; 0 = no history
+}
+
+// requiredPageFields are the PageData fields a custom upload page must use:
+// without them it can't upload, or hides the limit from the person uploading
+var requiredPageFields = []string{"UploadPath", "MaxSize"}
+
+// defaultUploadPage is the embedded upload page
+var defaultUploadPage = template.Must(template.New("upload.html").Parse(uploadPageHTML))
+
+// LoadPageTemplate parses the upload page template at path and checks it
+// uses the required PageData fields and renders with sample data. Errors name
+// the file and, for syntax and field errors, the line.
+func LoadPageTemplate(path string) (*template.Template, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	tmpl, err := template.New(filepath.Base(path)).Parse(string(data))
+	if err != nil {
+		return nil, err
+	}
+	used := make(map[string]bool)
+	for _, t := range tmpl.Templates() {
+		if t.Tree != nil {
+			pageFields(t.Tree.Root, used)
+		}
+	}
+	for _, field := range requiredPageFields {
+		if !used[field] {
+			return nil, fmt.Errorf("%s: missing {{.%s}}", tmpl.Name(), field)
+		}
+	}
+	// Unknown fields and escaping errors only show up when executed
+	sample := PageData{UploadPath: "token", MaxSize: ui.FormatBytes(1 << 30), MaxSizeBytes: 1 << 30}
+	if err := tmpl.Execute(&bytes.Buffer{}, sample); err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+// pageFields records the top-level field names a template node refers to,
+// such as UploadPath for {{.UploadPath}}
+func pageFields(node parse.Node, used map[string]bool) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, c := range n.Nodes {
+			pageFields(c, used)
+		}
+	case *parse.ActionNode:
+		pageFields(n.Pipe, used)
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		for _, cmd := range n.Cmds {
+			for _, arg := range cmd.Args {
+				pageFields(arg, used)
+			}
+		}
+	case *parse.FieldNode:
+		used[n.Ident[0]] = true
+	case *parse.IfNode:
+		pageFields(&n.BranchNode, used)
+	case *parse.RangeNode:
+		pageFields(&n.BranchNode, used)
+	case *parse.WithNode:
+		pageFields(&n.BranchNode, used)
+	case *parse.BranchNode:
+		pageFields(n.Pipe, used)
+		pageFields(n.List, used)
+		pageFields(n.ElseList, used)
+	case *parse.TemplateNode:
+		pageFields(n.Pipe, used)
+	}
+}
+
+// pageData fills in PageData for this server
+func (s *Server) pageData() PageData {
+	limits := s.uploadLimits()
+	maxSize := limits.MaxTotalSize
+	if limits.MaxFileSize > 0 && limits.MaxFileSize < maxSize {
+		maxSize = limits.MaxFileSize
+	}
+	// The page is one level below the root, in /u/
+	return PageData{
+		UploadPath:   s.Token,
+		ManifestPath: s.Token + protocol.ManifestPathSuffix,
+		ProgressPath: ".." + protocol.ProgressPathPrefix + s.Token,
+		MaxSize:      ui.FormatBytes(maxSize),
+		MaxSizeBytes: maxSize,
+		RecentSpeed:  int64(s.uploadRate.rate()),
+	}
+}
+
+// serveUploadPage renders UploadPage, or the embedded page when it's nil
+func (s *Server) serveUploadPage(w http.ResponseWriter) {
+	tmpl := s.UploadPage
+	if tmpl == nil {
+		tmpl = defaultUploadPage
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, s.pageData()); err != nil {
+		logging.Error("Failed to render upload page", zap.String("template", tmpl.Name()), zap.Error(err))
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, _ = w.Write(buf.Bytes())
+}
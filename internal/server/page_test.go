@@ -0,0 +1,97 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/zulfikawr/warp/internal/crypto"
+	"github.com/zulfikawr/warp/internal/protocol"
+)
+
+func writePage(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "custom.html")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestCustomUploadPage(t *testing.T) {
+	page, err := LoadPageTemplate(writePage(t, `<h1>ACME drop box</h1>
+{{define "limit"}}at most {{.MaxSize}}{{end}}
+<form method="POST" action="{{.UploadPath}}">{{template "limit" .}}</form>
+<script>const target = {{.UploadPath}};</script>
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tok, _ := crypto.GenerateToken(nil)
+	s := &Server{Token: tok, HostMode: true, UploadDir: t.TempDir(), UploadPage: page, MaxFileSize: 5 << 20}
+	ts := httptest.NewServer(s.routes())
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + protocol.UploadPathPrefix + tok)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/html; charset=utf-8" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	for _, want := range []string{
+		"<h1>ACME drop box</h1>",
+		`action="` + tok + `"`,
+		"at most 5.0 MiB",
+		`const target = "` + tok + `";`,
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("page lacks %q:\n%s", want, body)
+		}
+	}
+}
+
+func TestDefaultUploadPage(t *testing.T) {
+	s := &Server{Token: "abc123"}
+	rec := httptest.NewRecorder()
+	s.serveUploadPage(rec)
+	body := rec.Body.String()
+	for _, want := range []string{`action="abc123"`, `progressPath: "../ws/progress/abc123"`, "max 10.0 GiB per file"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("embedded page lacks %q", want)
+		}
+	}
+	if strings.Contains(body, "{{") {
+		t.Error("embedded page has an unrendered action")
+	}
+}
+
+func TestLoadPageTemplateErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"syntax", "<p>{{.MaxSize}}</p>\n<form action=\"{{.UploadPath}\">", "custom.html:2:"},
+		{"missing upload path", "<p>{{.MaxSize}}</p>", "missing {{.UploadPath}}"},
+		{"missing max size", `<form action="{{.UploadPath}}"></form>`, "missing {{.MaxSize}}"},
+		{"unknown field", "{{.UploadPath}} {{.MaxSize}}\n{{.Logo}}", "custom.html:2:"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadPageTemplate(writePage(t, tt.content))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("err = %v, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+	if _, err := LoadPageTemplate(filepath.Join(t.TempDir(), "none.html")); err == nil {
+		t.Error("missing file loaded")
+	}
+}
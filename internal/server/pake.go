@@ -1,13 +1,40 @@
 package server
 
 import (
+	"bytes"
 	"encoding/json"
 	"net/http"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/zulfikawr/warp/internal/crypto"
+	"github.com/zulfikawr/warp/internal/metrics"
 )
 
+// maxPAKEAttempts is how many failed confirmations a client IP gets before lockout
+const maxPAKEAttempts = 5
+
+// maxPendingPAKE is how many handshakes a client IP may have between init
+// and verify at once. Each holds key material and costs the server a
+// scalar multiplication, and a client never needs more than one.
+const maxPendingPAKE = 3
+
+// relayGuessInterval is how often a failed handshake through a relay is
+// allowed once maxPAKEAttempts have been spent: relayed receivers share the
+// relay's address, so a lockout by IP would lock all of them out, while
+// unlimited guesses would let the relay try codes one handshake at a time
+const relayGuessInterval = 12 * time.Second
+
+// relayConnKey is the context key of the number ServeRelay gives each
+// relayed connection
+type relayConnKey struct{}
+
+// pakeSessionTTL is how long a client has between init and verify. It is
+// timed on the server's monotonic clock alone, so neither a skewed client
+// nor the server's wall clock being stepped can stretch or cut it.
+const pakeSessionTTL = 60 * time.Second
+
 type pakeInitRequest struct {
 	Message []byte `json:"message"`
 }
@@ -23,6 +50,9 @@ type pakeVerifyRequest struct {
 type pakeVerifyResponse struct {
 	Confirmation []byte `json:"confirmation"`
 	Token        string `json:"token,omitempty"`
+	// CertConfirmation binds the server's TLS certificate to the key when
+	// the handshake runs over TLS; see crypto.CertConfirmation
+	CertConfirmation []byte `json:"cert_confirmation,omitempty"`
 }
 
 func (s *Server) handlePAKEInit(w http.ResponseWriter, r *http.Request) {
@@ -31,9 +61,14 @@ func (s *Server) handlePAKEInit(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	clientIP := getClientIP(r)
-	attempts, _ := s.pakeAttempts.LoadOrStore(clientIP, 0)
-	if attempts.(int) >= 5 {
+	now := s.now()
+	sessionID, clientIP, relayed := s.pakePeer(r)
+	if relayed {
+		if s.relayGuesses.TokensAt(now) < 1 {
+			http.Error(w, "Too many attempts", http.StatusTooManyRequests)
+			return
+		}
+	} else if attempts, _ := s.pakeAttempts.LoadOrStore(clientIP, 0); attempts.(int) >= maxPAKEAttempts {
 		http.Error(w, "Too many attempts", http.StatusTooManyRequests)
 		return
 	}
@@ -44,6 +79,21 @@ func (s *Server) handlePAKEInit(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !addCount(&s.pakePending, clientIP, 1, maxPendingPAKE) {
+		// Sessions past their TTL still count until swept
+		s.cleanupPAKESessions()
+		if !addCount(&s.pakePending, clientIP, 1, maxPendingPAKE) {
+			http.Error(w, "Too many pending handshakes", http.StatusTooManyRequests)
+			return
+		}
+	}
+	stored := false
+	defer func() {
+		if !stored {
+			addCount(&s.pakePending, clientIP, -1, 0)
+		}
+	}()
+
 	state, err := crypto.InitializePAKE(s.PAKECode, true)
 	if err != nil {
 		http.Error(w, "Failed to initialize PAKE", http.StatusInternalServerError)
@@ -60,15 +110,20 @@ func (s *Server) handlePAKEInit(w http.ResponseWriter, r *http.Request) {
 
 	serverMessage := state.Bytes()
 
-	// Store session
-	sessionID := r.RemoteAddr
-	s.pakeSessions.Store(sessionID, &pakeSession{
+	// Store session, replacing one the same connection left unfinished
+	old, replaced := s.pakeSessions.Swap(sessionID, &pakeSession{
 		State:         state,
 		Key:           key,
 		ClientMessage: req.Message,
 		ServerMessage: serverMessage,
-		Expiry:        time.Now().Add(60 * time.Second),
+		Started:       now,
+		ClientIP:      clientIP,
 	})
+	stored = true
+	metrics.PAKESessionsPending.Inc()
+	if replaced {
+		s.closePAKESession(old.(*pakeSession))
+	}
 
 	resp := pakeInitResponse{
 		Message: serverMessage,
@@ -83,7 +138,7 @@ func (s *Server) handlePAKEVerify(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	sessionID := r.RemoteAddr
+	sessionID, clientIP, relayed := s.pakePeer(r)
 	val, ok := s.pakeSessions.Load(sessionID)
 	if !ok {
 		http.Error(w, "Session not found", http.StatusNotFound)
@@ -91,8 +146,10 @@ func (s *Server) handlePAKEVerify(w http.ResponseWriter, r *http.Request) {
 	}
 	session := val.(*pakeSession)
 
-	if time.Now().After(session.Expiry) {
-		s.pakeSessions.Delete(sessionID)
+	if session.expired(s.now()) {
+		if s.dropPAKESession(sessionID, session) {
+			metrics.PAKESessionsExpired.Inc()
+		}
 		http.Error(w, "Session expired", http.StatusGone)
 		return
 	}
@@ -103,27 +160,125 @@ func (s *Server) handlePAKEVerify(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Either way the session is used up. Taking it first keeps two
+	// verifies racing on one session from both getting through.
+	key := bytes.Clone(session.Key)
+	if !s.dropPAKESession(sessionID, session) {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+
 	// Verify client's confirmation: HMAC(key, ServerMessage)
-	if err := crypto.VerifyConfirmation(session.Key, session.ServerMessage, req.Confirmation); err != nil {
-		s.pakeSessions.Delete(sessionID)
-		clientIP := getClientIP(r)
-		if val, ok := s.pakeAttempts.Load(clientIP); ok {
-			s.pakeAttempts.Store(clientIP, val.(int)+1)
+	if err := crypto.VerifyConfirmation(key, session.ServerMessage, req.Confirmation); err != nil {
+		clear(key)
+		if relayed {
+			s.relayGuesses.AllowN(s.now(), 1)
+		} else {
+			s.recordPAKEFailure(clientIP)
 		}
 		http.Error(w, "Invalid confirmation", http.StatusUnauthorized)
 		return
 	}
 
 	// Generate server's confirmation: HMAC(key, ClientMessage)
-	serverConfirmation := crypto.GenerateConfirmation(session.Key, session.ClientMessage)
+	serverConfirmation := crypto.GenerateConfirmation(key, session.ClientMessage)
 
 	// Store the key for the token
-	s.tokenKeys.Store(s.Token, session.Key)
+	s.tokenKeys.Store(s.Token, key)
+
+	// The sender compares these words with the ones the receiver is shown
+	s.events.publish(Event{
+		Type:       EventPeerVerified,
+		ClientIP:   s.clientIP(r),
+		AuthString: crypto.AuthString(key),
+	})
 
 	resp := pakeVerifyResponse{
 		Confirmation: serverConfirmation,
 		Token:        s.Token,
 	}
+	if r.TLS != nil && s.tlsCert != nil {
+		resp.CertConfirmation = crypto.CertConfirmation(key, s.tlsCert.Certificate[0])
+	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(resp)
 }
+
+// pakePeer identifies the client of a PAKE request: the key its session is
+// stored under, the key its pending handshakes and failures count against,
+// and whether it came through the relay. A direct client is its connection's
+// address and its IP. Every relayed receiver comes from the relay's one
+// address, so a relayed one is its connection for both, and its failures go
+// against relayGuesses instead.
+func (s *Server) pakePeer(r *http.Request) (sessionID, limitKey string, relayed bool) {
+	if id, ok := r.Context().Value(relayConnKey{}).(uint64); ok && s.relayGuesses != nil {
+		key := "relay#" + strconv.FormatUint(id, 10)
+		return key, key, true
+	}
+	return r.RemoteAddr, s.clientIP(r), false
+}
+
+// expired reports whether the session's client has run out of time to
+// verify. A clock stepped back doesn't expire it.
+func (p *pakeSession) expired(now time.Time) bool {
+	return now.Sub(p.Started) > pakeSessionTTL
+}
+
+// dropPAKESession removes session from under sessionID and closes it, unless
+// another request already did. It reports whether this call removed it.
+func (s *Server) dropPAKESession(sessionID string, session *pakeSession) bool {
+	if !s.pakeSessions.CompareAndDelete(sessionID, session) {
+		return false
+	}
+	s.closePAKESession(session)
+	return true
+}
+
+// closePAKESession releases a session no longer in pakeSessions: its client
+// IP's pending slot, and its key material, which is zeroed
+func (s *Server) closePAKESession(session *pakeSession) {
+	metrics.PAKESessionsPending.Dec()
+	addCount(&s.pakePending, session.ClientIP, -1, 0)
+	clear(session.Key)
+	session.State = nil
+}
+
+// cleanupPAKESessions drops the handshakes whose clients never verified
+// within pakeSessionTTL
+func (s *Server) cleanupPAKESessions() {
+	now := s.now()
+	s.pakeSessions.Range(func(k, v any) bool {
+		if session := v.(*pakeSession); session.expired(now) && s.dropPAKESession(k.(string), session) {
+			metrics.PAKESessionsExpired.Inc()
+		}
+		return true
+	})
+}
+
+// recordPAKEFailure counts a failed confirmation for clientIP
+func (s *Server) recordPAKEFailure(clientIP string) {
+	addCount(&s.pakeAttempts, clientIP, 1, 0)
+}
+
+// addCount adds delta to the count m holds for key, unless that would take
+// it over limit (0 = no limit), and reports whether it did. A count that
+// reaches zero is deleted. The compare-and-swap loop keeps concurrent
+// updates from being lost.
+func addCount(m *sync.Map, key string, delta, limit int) bool {
+	for {
+		val, _ := m.LoadOrStore(key, 0)
+		n := val.(int) + delta
+		if limit > 0 && n > limit {
+			return false
+		}
+		if n <= 0 {
+			if m.CompareAndDelete(key, val) {
+				return true
+			}
+			continue
+		}
+		if m.CompareAndSwap(key, val, n) {
+			return true
+		}
+	}
+}
@@ -0,0 +1,376 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"golang.org/x/time/rate"
+
+	"github.com/zulfikawr/warp/internal/crypto"
+	"github.com/zulfikawr/warp/internal/metrics"
+	"github.com/zulfikawr/warp/internal/protocol"
+)
+
+// pakeAttempt runs one client handshake with code and returns the verify status
+func pakeAttempt(t *testing.T, c *http.Client, baseURL, code string) int {
+	t.Helper()
+	status, _ := pakeHandshake(t, c, baseURL, code)
+	return status
+}
+
+// pakeHandshake runs one client handshake with code and returns the verify
+// status and the client's session key
+func pakeHandshake(t *testing.T, c *http.Client, baseURL, code string) (int, []byte) {
+	t.Helper()
+	status, state, serverMessage := pakeInit(t, c, baseURL, code)
+	if status != http.StatusOK {
+		return status, nil
+	}
+	key, err := state.ComputeSharedKey(serverMessage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := json.Marshal(pakeVerifyRequest{Confirmation: crypto.GenerateConfirmation(key, serverMessage)})
+	resp, err := c.Post(baseURL+protocol.PAKEVerifyPath, "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	return resp.StatusCode, key
+}
+
+// pakeInit runs the first half of a handshake with code and returns the init
+// status, the client's state and the server's message
+func pakeInit(t *testing.T, c *http.Client, baseURL, code string) (int, *crypto.PAKEState, []byte) {
+	t.Helper()
+	state, err := crypto.InitializePAKE(code, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := json.Marshal(pakeInitRequest{Message: state.Bytes()})
+	resp, err := c.Post(baseURL+protocol.PAKEInitPath, "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return resp.StatusCode, nil, nil
+	}
+	var initResp pakeInitResponse
+	_ = json.NewDecoder(resp.Body).Decode(&initResp)
+	return resp.StatusCode, state, initResp.Message
+}
+
+// pendingPAKE counts the sessions waiting for verify and the pending slots
+// held per client IP
+func pendingPAKE(s *Server) (sessions, slots int) {
+	s.pakeSessions.Range(func(_, _ any) bool { sessions++; return true })
+	s.pakePending.Range(func(_, v any) bool { slots += v.(int); return true })
+	return sessions, slots
+}
+
+func TestPAKELockoutAfterFailedConfirmations(t *testing.T) {
+	tok, _ := crypto.GenerateToken(nil)
+	s := &Server{Token: tok, PAKECode: "7-apple-velocity"}
+	ts := httptest.NewServer(s.routes())
+	defer ts.Close()
+	c := ts.Client() // one keep-alive connection keeps RemoteAddr stable across init/verify
+
+	if got := pakeAttempt(t, c, ts.URL, "7-apple-velocity"); got != http.StatusOK {
+		t.Fatalf("correct code: status %d, want 200", got)
+	}
+	for i := 0; i < maxPAKEAttempts; i++ {
+		if got := pakeAttempt(t, c, ts.URL, "8-wrong-guess"); got != http.StatusUnauthorized {
+			t.Fatalf("wrong code attempt %d: status %d, want 401", i+1, got)
+		}
+	}
+	if got := pakeAttempt(t, c, ts.URL, "7-apple-velocity"); got != http.StatusTooManyRequests {
+		t.Fatalf("after %d failures: status %d, want 429", maxPAKEAttempts, got)
+	}
+}
+
+func TestPAKEPublishesAuthString(t *testing.T) {
+	tok, _ := crypto.GenerateToken(nil)
+	s := &Server{Token: tok, PAKECode: "7-apple-velocity"}
+	events := s.Events()
+	ts := httptest.NewServer(s.routes())
+	defer ts.Close()
+
+	status, key := pakeHandshake(t, ts.Client(), ts.URL, "7-apple-velocity")
+	if status != http.StatusOK {
+		t.Fatalf("handshake: status %d, want 200", status)
+	}
+	select {
+	case ev := <-events:
+		if ev.Type != EventPeerVerified {
+			t.Fatalf("event %q, want %q", ev.Type, EventPeerVerified)
+		}
+		if want := crypto.AuthString(key); ev.AuthString != want {
+			t.Errorf("AuthString = %q, want the receiver's %q", ev.AuthString, want)
+		}
+		if ev.ClientIP == "" {
+			t.Error("PeerVerified event has no client IP")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no PeerVerified event after a successful handshake")
+	}
+
+	// A failed handshake announces nothing
+	if got := pakeAttempt(t, ts.Client(), ts.URL, "8-wrong-guess"); got != http.StatusUnauthorized {
+		t.Fatalf("wrong code: status %d, want 401", got)
+	}
+	select {
+	case ev := <-events:
+		t.Fatalf("unexpected %q event after a failed handshake", ev.Type)
+	default:
+	}
+}
+
+func TestPAKESessionExpiryUsesServerClock(t *testing.T) {
+	tests := []struct {
+		name string
+		step time.Duration // How far the server clock moves between init and verify
+		want int
+	}{
+		{"within ttl", pakeSessionTTL - time.Second, http.StatusOK},
+		{"past ttl", pakeSessionTTL + time.Second, http.StatusGone},
+		// A clock stepped back, as by NTP correcting a fast clock, must not
+		// expire the session
+		{"clock stepped back", -time.Hour, http.StatusOK},
+	}
+	for _, tt := range tests {
+		tok, _ := crypto.GenerateToken(nil)
+		s := &Server{Token: tok, PAKECode: "7-apple-velocity"}
+		base := time.Now()
+		var calls atomic.Int64
+		s.clock = func() time.Time { return base.Add(time.Duration(calls.Add(1)-1) * tt.step) }
+		ts := httptest.NewServer(s.routes())
+		if got := pakeAttempt(t, ts.Client(), ts.URL, "7-apple-velocity"); got != tt.want {
+			t.Errorf("%s: status %d, want %d", tt.name, got, tt.want)
+		}
+		ts.Close()
+	}
+}
+
+func TestPAKESessionsExpireAndAreSwept(t *testing.T) {
+	tok, _ := crypto.GenerateToken(nil)
+	s := &Server{Token: tok, PAKECode: "7-apple-velocity"}
+	var clock atomic.Int64
+	clock.Store(time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC).UnixNano())
+	s.clock = func() time.Time { return time.Unix(0, clock.Load()) }
+	ts := httptest.NewServer(s.routes())
+	defer ts.Close()
+
+	pending := testutil.ToFloat64(metrics.PAKESessionsPending)
+	expired := testutil.ToFloat64(metrics.PAKESessionsExpired)
+	// Two clients start a handshake and never verify
+	for range 2 {
+		c := &http.Client{Transport: &http.Transport{}}
+		if status, _, _ := pakeInit(t, c, ts.URL, "7-apple-velocity"); status != http.StatusOK {
+			t.Fatalf("init: status %d", status)
+		}
+	}
+	if sessions, slots := pendingPAKE(s); sessions != 2 || slots != 2 {
+		t.Fatalf("after init: %d sessions, %d slots, want 2 and 2", sessions, slots)
+	}
+	if got := testutil.ToFloat64(metrics.PAKESessionsPending) - pending; got != 2 {
+		t.Errorf("pending gauge rose by %v, want 2", got)
+	}
+
+	clock.Add(int64(pakeSessionTTL))
+	s.cleanupPAKESessions()
+	if sessions, _ := pendingPAKE(s); sessions != 2 {
+		t.Fatalf("swept at exactly the TTL: %d sessions left", sessions)
+	}
+	clock.Add(int64(time.Second))
+	s.cleanupPAKESessions()
+	if sessions, slots := pendingPAKE(s); sessions != 0 || slots != 0 {
+		t.Errorf("after sweep: %d sessions, %d slots", sessions, slots)
+	}
+	if got := testutil.ToFloat64(metrics.PAKESessionsPending); got != pending {
+		t.Errorf("pending gauge %v after sweep, want %v", got, pending)
+	}
+	if got := testutil.ToFloat64(metrics.PAKESessionsExpired) - expired; got != 2 {
+		t.Errorf("expired counter rose by %v, want 2", got)
+	}
+}
+
+func TestPAKEPendingCapPerIP(t *testing.T) {
+	tok, _ := crypto.GenerateToken(nil)
+	s := &Server{Token: tok, PAKECode: "7-apple-velocity"}
+	var clock atomic.Int64
+	clock.Store(time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC).UnixNano())
+	s.clock = func() time.Time { return time.Unix(0, clock.Load()) }
+	ts := httptest.NewServer(s.routes())
+	defer ts.Close()
+
+	// Each client is its own connection, so its own session; all share an IP
+	clients := make([]*http.Client, maxPendingPAKE+1)
+	for i := range clients {
+		clients[i] = &http.Client{Transport: &http.Transport{}}
+	}
+	for _, c := range clients[:maxPendingPAKE] {
+		if status, _, _ := pakeInit(t, c, ts.URL, "7-apple-velocity"); status != http.StatusOK {
+			t.Fatalf("init within the cap: status %d", status)
+		}
+	}
+	extra := clients[maxPendingPAKE]
+	if status, _, _ := pakeInit(t, extra, ts.URL, "7-apple-velocity"); status != http.StatusTooManyRequests {
+		t.Fatalf("init over the cap: status %d, want 429", status)
+	}
+	// A connection restarting its own handshake waits for a slot too
+	if status, _, _ := pakeInit(t, clients[0], ts.URL, "7-apple-velocity"); status != http.StatusTooManyRequests {
+		t.Fatalf("restart at the cap: status %d, want 429", status)
+	}
+	if sessions, slots := pendingPAKE(s); sessions != maxPendingPAKE || slots != maxPendingPAKE {
+		t.Fatalf("%d sessions, %d slots, want %d", sessions, slots, maxPendingPAKE)
+	}
+
+	// Expired sessions give their slots back without waiting for the sweep
+	clock.Add(int64(pakeSessionTTL + time.Second))
+	if status, _ := pakeHandshake(t, extra, ts.URL, "7-apple-velocity"); status != http.StatusOK {
+		t.Fatalf("handshake after the others expired: status %d", status)
+	}
+	if sessions, slots := pendingPAKE(s); sessions != 0 || slots != 0 {
+		t.Errorf("after a verified handshake: %d sessions, %d slots", sessions, slots)
+	}
+}
+
+func TestPAKEFailedVerifyDropsSession(t *testing.T) {
+	tok, _ := crypto.GenerateToken(nil)
+	s := &Server{Token: tok, PAKECode: "7-apple-velocity"}
+	ts := httptest.NewServer(s.routes())
+	defer ts.Close()
+	c := ts.Client()
+
+	status, state, serverMessage := pakeInit(t, c, ts.URL, "8-wrong-guess")
+	if status != http.StatusOK {
+		t.Fatalf("init: status %d", status)
+	}
+	var session *pakeSession
+	s.pakeSessions.Range(func(_, v any) bool { session = v.(*pakeSession); return false })
+	if session == nil || len(session.Key) == 0 {
+		t.Fatal("no session after init")
+	}
+
+	key, err := state.ComputeSharedKey(serverMessage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := json.Marshal(pakeVerifyRequest{Confirmation: crypto.GenerateConfirmation(key, serverMessage)})
+	resp, err := c.Post(ts.URL+protocol.PAKEVerifyPath, "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("verify with the wrong code: status %d, want 401", resp.StatusCode)
+	}
+	if sessions, slots := pendingPAKE(s); sessions != 0 || slots != 0 {
+		t.Errorf("after a failed verify: %d sessions, %d slots", sessions, slots)
+	}
+	if !bytes.Equal(session.Key, make([]byte, len(session.Key))) || session.State != nil {
+		t.Error("failed session's key material wasn't wiped")
+	}
+
+	// The session is gone, so the confirmation can't be retried on it
+	resp, err = c.Post(ts.URL+protocol.PAKEVerifyPath, "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("second verify: status %d, want 404", resp.StatusCode)
+	}
+}
+
+// relayAddrListener gives every connection the same remote address, the way
+// connections paired through a relay all come from the relay
+type relayAddrListener struct{ net.Listener }
+
+type relayAddrConn struct{ net.Conn }
+
+func (l relayAddrListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return relayAddrConn{c}, nil
+}
+
+func (relayAddrConn) RemoteAddr() net.Addr {
+	return &net.TCPAddr{IP: net.IPv4(192, 0, 2, 9), Port: 9000}
+}
+
+func TestPAKEThroughRelay(t *testing.T) {
+	tok, _ := crypto.GenerateToken(nil)
+	s := &Server{Token: tok, PAKECode: "7-apple-velocity"}
+	var clock atomic.Int64
+	clock.Store(time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC).UnixNano())
+	s.clock = func() time.Time { return time.Unix(0, clock.Load()) }
+	s.relayGuesses = rate.NewLimiter(rate.Every(relayGuessInterval), maxPAKEAttempts)
+	ts := httptest.NewUnstartedServer(s.routes())
+	ts.Listener = relayAddrListener{ts.Listener}
+	ts.Config.ConnContext = s.relayConnContext
+	ts.Start()
+	defer ts.Close()
+	receiver := func() *http.Client { return &http.Client{Transport: &http.Transport{}} }
+
+	// More receivers than one IP may have pending handshakes, interleaved,
+	// each on its own connection from the same address
+	type started struct {
+		c             *http.Client
+		state         *crypto.PAKEState
+		serverMessage []byte
+	}
+	var all []started
+	for range maxPendingPAKE + 2 {
+		c := receiver()
+		status, state, msg := pakeInit(t, c, ts.URL, "7-apple-velocity")
+		if status != http.StatusOK {
+			t.Fatalf("init %d: status %d", len(all)+1, status)
+		}
+		all = append(all, started{c, state, msg})
+	}
+	for i, st := range all {
+		key, err := st.state.ComputeSharedKey(st.serverMessage)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := json.Marshal(pakeVerifyRequest{Confirmation: crypto.GenerateConfirmation(key, st.serverMessage)})
+		resp, err := st.c.Post(ts.URL+protocol.PAKEVerifyPath, "application/json", bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("receiver %d: verify status %d; another receiver's handshake replaced its session", i+1, resp.StatusCode)
+		}
+	}
+
+	// Wrong guesses slow relayed handshakes down for a while rather than
+	// locking the relay's address out for good
+	guesser := receiver()
+	for i := range maxPAKEAttempts {
+		if got := pakeAttempt(t, guesser, ts.URL, "8-wrong-guess"); got != http.StatusUnauthorized {
+			t.Fatalf("wrong code attempt %d: status %d, want 401", i+1, got)
+		}
+	}
+	if got := pakeAttempt(t, receiver(), ts.URL, "7-apple-velocity"); got != http.StatusTooManyRequests {
+		t.Fatalf("right after %d failures: status %d, want 429", maxPAKEAttempts, got)
+	}
+	clock.Add(int64(relayGuessInterval))
+	if got := pakeAttempt(t, receiver(), ts.URL, "7-apple-velocity"); got != http.StatusOK {
+		t.Errorf("%v later: status %d, want 200", relayGuessInterval, got)
+	}
+	if _, locked := s.pakeAttempts.Load("192.0.2.9"); locked {
+		t.Error("relayed failures counted against the relay's IP")
+	}
+}
@@ -0,0 +1,118 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/zulfikawr/warp/internal/logging"
+	"github.com/zulfikawr/warp/internal/protocol"
+)
+
+// playlistContentType is what players such as VLC and smart TVs expect of
+// an M3U playlist
+const playlistContentType = "audio/x-mpegurl"
+
+// mediaTypes are the files a --media playlist lists, by extension. They are
+// fixed here rather than read from the system's MIME table, which often
+// lacks video types such as .mkv. MPEG-TS is left out: .ts is far more
+// often TypeScript.
+var mediaTypes = map[string]string{
+	".aac":  "audio/aac",
+	".flac": "audio/flac",
+	".m4a":  "audio/mp4",
+	".mp3":  "audio/mpeg",
+	".oga":  "audio/ogg",
+	".ogg":  "audio/ogg",
+	".opus": "audio/ogg",
+	".wav":  "audio/wav",
+	".avi":  "video/x-msvideo",
+	".m4v":  "video/x-m4v",
+	".mkv":  "video/x-matroska",
+	".mov":  "video/quicktime",
+	".mp4":  "video/mp4",
+	".webm": "video/webm",
+}
+
+// mediaType returns the media type of an audio or video file by its name,
+// or "" for anything else
+func mediaType(name string) string {
+	return mediaTypes[strings.ToLower(path.Ext(name))]
+}
+
+// shareFileURL is the /file URL of rel in a directory share. Spaces are
+// escaped as %20 rather than +, which some players pass on as it is.
+func shareFileURL(base, token, rel string) string {
+	q := strings.ReplaceAll(url.QueryEscape(rel), "+", "%20")
+	return base + protocol.PathPrefix + token + protocol.FilePathSuffix + "?path=" + q
+}
+
+// writePlaylist writes an extended M3U playlist of files, whose entries
+// point at their /file URLs under base
+func writePlaylist(w *strings.Builder, base, token string, files []string) {
+	w.WriteString("#EXTM3U\n")
+	for _, rel := range files {
+		title := strings.TrimSuffix(path.Base(rel), path.Ext(rel))
+		fmt.Fprintf(w, "#EXTINF:-1,%s\n%s\n", title, shareFileURL(base, token, rel))
+	}
+}
+
+// requestBase is the scheme and host a client reached the server at, so
+// playlist entries use the same address whatever the LAN IP
+func requestBase(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+// handlePlaylist serves an M3U playlist of the audio and video files of a
+// directory share sent with --media, so a TV or VLC streams them file by
+// file instead of downloading the zip. The entries are served with ranges,
+// so players can seek.
+func (s *Server) handlePlaylist(w http.ResponseWriter, r *http.Request) {
+	if !s.Media || !s.mirrorable() {
+		http.NotFound(w, r)
+		return
+	}
+	s.lastAccess.Store(time.Now().UnixNano())
+
+	files, err := s.shareFiles()
+	if err != nil {
+		logging.Error("Failed to list share", zap.Error(err))
+		http.Error(w, "failed to list files", http.StatusInternalServerError)
+		return
+	}
+	media := files[:0]
+	for _, rel := range files {
+		if mediaType(rel) != "" {
+			media = append(media, rel)
+		}
+	}
+	var b strings.Builder
+	writePlaylist(&b, requestBase(r), s.Token, media)
+
+	w.Header().Set("Content-Type", playlistContentType)
+	w.Header().Set("Content-Disposition", contentDisposition(true, filepath.Base(s.SrcPath)+".m3u8"))
+	w.Header().Set("Cache-Control", noCacheControl)
+	w.Header().Set("Content-Length", fmt.Sprint(b.Len()))
+	if r.Method == http.MethodGet {
+		_, _ = w.Write([]byte(b.String()))
+	}
+}
+
+// PlaylistURL returns the playlist URL of a started --media server, or ""
+// when there is none
+func (s *Server) PlaylistURL() string {
+	if !s.Media || s.IP == nil {
+		return ""
+	}
+	return fmt.Sprintf("http://%s:%d%s%s%s", s.IP.String(), s.Port, protocol.PathPrefix, s.Token, protocol.PlaylistPathSuffix)
+}
@@ -0,0 +1,166 @@
+package server
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/zulfikawr/warp/internal/crypto"
+	"github.com/zulfikawr/warp/internal/protocol"
+)
+
+// mediaTree creates a nested directory of media and other files
+func mediaTree(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := filepath.Join(t.TempDir(), "Holiday")
+	for rel, data := range files {
+		p := filepath.Join(dir, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestPlaylistListsNestedMedia(t *testing.T) {
+	dir := mediaTree(t, map[string]string{
+		"Day 1/Beach walk.MP4":  "video one",
+		"Day 1/notes.txt":       "not media",
+		"Day 2/夕焼け & waves.mkv": "video two",
+		"music/100% song+1.mp3": "audio",
+		"index.ts":              "TypeScript, not a stream",
+	})
+	tok, _ := crypto.GenerateToken(nil)
+	s := &Server{Token: tok, SrcPath: dir, Media: true}
+	ts := httptest.NewServer(s.routes())
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/d/" + tok + protocol.PlaylistPathSuffix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d", resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != playlistContentType {
+		t.Errorf("Content-Type = %q, want %q", ct, playlistContentType)
+	}
+
+	var lines []string
+	sc := bufio.NewScanner(resp.Body)
+	for sc.Scan() {
+		lines = append(lines, sc.Text())
+	}
+	if len(lines) == 0 || lines[0] != "#EXTM3U" {
+		t.Fatalf("playlist %q doesn't start with #EXTM3U", lines)
+	}
+	var titles, entries []string
+	for _, l := range lines[1:] {
+		if title, ok := strings.CutPrefix(l, "#EXTINF:-1,"); ok {
+			titles = append(titles, title)
+		} else {
+			entries = append(entries, l)
+		}
+	}
+	wantPaths := []string{"Day 1/Beach walk.MP4", "Day 2/夕焼け & waves.mkv", "music/100% song+1.mp3"}
+	if want := []string{"Beach walk", "夕焼け & waves", "100% song+1"}; !slices.Equal(titles, want) {
+		t.Errorf("titles = %q, want %q", titles, want)
+	}
+	if len(entries) != len(wantPaths) {
+		t.Fatalf("entries = %q, want one per media file", entries)
+	}
+	for i, e := range entries {
+		if strings.ContainsAny(e, " +&") || !strings.HasPrefix(e, ts.URL+"/d/"+tok+protocol.FilePathSuffix+"?path=") {
+			t.Errorf("entry %q isn't an escaped /file URL", e)
+		}
+		u, err := url.Parse(e)
+		if err != nil {
+			t.Fatalf("entry %q: %v", e, err)
+		}
+		if got := u.Query().Get("path"); got != wantPaths[i] {
+			t.Errorf("entry %q names %q, want %q", e, got, wantPaths[i])
+		}
+		resp, err := http.Get(e)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		want, _ := os.ReadFile(filepath.Join(dir, filepath.FromSlash(wantPaths[i])))
+		if resp.StatusCode != http.StatusOK || string(body) != string(want) {
+			t.Errorf("entry %q: status %d, body %q", e, resp.StatusCode, body)
+		}
+		if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "video/") && !strings.HasPrefix(ct, "audio/") {
+			t.Errorf("entry %q served as %q", e, ct)
+		}
+	}
+}
+
+func TestPlaylistNeedsMedia(t *testing.T) {
+	dir := mediaTree(t, map[string]string{"a.mp4": "video"})
+	tok, _ := crypto.GenerateToken(nil)
+	for _, s := range []*Server{
+		{Token: tok, SrcPath: dir},
+		{Token: tok, SrcPath: dir, Media: true, Password: "secret"},
+	} {
+		ts := httptest.NewServer(s.routes())
+		resp, err := http.Get(ts.URL + "/d/" + tok + protocol.PlaylistPathSuffix)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = resp.Body.Close()
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("media=%v password=%q: status %d, want 404", s.Media, s.Password, resp.StatusCode)
+		}
+		ts.Close()
+	}
+}
+
+func TestShareFileRange(t *testing.T) {
+	dir := mediaTree(t, map[string]string{"clip.mp4": "0123456789"})
+	tok, _ := crypto.GenerateToken(nil)
+	s := &Server{Token: tok, SrcPath: dir, Media: true}
+	ts := httptest.NewServer(s.routes())
+	defer ts.Close()
+
+	tests := []struct {
+		rng    string
+		status int
+		body   string
+		cr     string
+	}{
+		{"", http.StatusOK, "0123456789", ""},
+		{"bytes=4-", http.StatusPartialContent, "456789", "bytes 4-9/10"},
+		{"bytes=2-5", http.StatusPartialContent, "2345", "bytes 2-5/10"},
+		{"bytes=0-99", http.StatusOK, "0123456789", ""},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest(http.MethodGet, ts.URL+"/d/"+tok+protocol.FilePathSuffix+"?path=clip.mp4", nil)
+		if tt.rng != "" {
+			req.Header.Set("Range", tt.rng)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		if resp.StatusCode != tt.status || string(body) != tt.body || resp.Header.Get("Content-Range") != tt.cr {
+			t.Errorf("Range %q: status %d, body %q, Content-Range %q", tt.rng, resp.StatusCode, body, resp.Header.Get("Content-Range"))
+		}
+		if resp.Header.Get("Accept-Ranges") != "bytes" {
+			t.Errorf("Range %q: no Accept-Ranges", tt.rng)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/zulfikawr/warp/internal/logging"
+	"github.com/zulfikawr/warp/internal/platform"
+	"go.uber.org/zap"
+)
+
+// Preallocation controls how the file of a chunked upload is sized before its
+// chunks arrive
+type Preallocation string
+
+const (
+	// PreallocOff leaves the file empty; WriteAt extends it as chunks land
+	PreallocOff Preallocation = "off"
+	// PreallocSparse truncates the file to its full size when the session is
+	// created: instant, but chunks written out of order may fragment it
+	PreallocSparse Preallocation = "sparse"
+	// PreallocFull allocates the file's blocks (fallocate on Linux) in the
+	// background once the first chunk has been answered
+	PreallocFull Preallocation = "full"
+)
+
+// ParsePreallocation validates a preallocate value; empty means sparse
+func ParsePreallocation(s string) (Preallocation, error) {
+	switch p := Preallocation(s); p {
+	case "":
+		return PreallocSparse, nil
+	case PreallocOff, PreallocSparse, PreallocFull:
+		return p, nil
+	}
+	return "", fmt.Errorf("invalid preallocate mode %q (want off, sparse or full)", s)
+}
+
+// prepare sizes a new upload file of size bytes. Only sparse (or "") does
+// anything here; full waits for startPreallocation so it never delays a
+// response.
+func (p Preallocation) prepare(f *os.File, size int64) error {
+	if (p != PreallocSparse && p != "") || size <= 0 {
+		return nil
+	}
+	if err := f.Truncate(size); err != nil {
+		return fmt.Errorf("failed to pre-allocate space: %w", err)
+	}
+	return nil
+}
+
+// startPreallocation allocates the session's file in the background under
+// PreallocFull, once per session. Chunks keep landing meanwhile: allocation
+// only fills holes, so it never overwrites their bytes.
+func (session *uploadSession) startPreallocation() {
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	if session.preallocation != PreallocFull || session.preallocated != nil ||
+		session.FileHandle == nil || session.TotalSize <= 0 || session.complete {
+		return
+	}
+	done := make(chan struct{})
+	session.preallocated = done
+	f, size := session.FileHandle, session.TotalSize
+	go func() {
+		defer close(done)
+		start := time.Now()
+		if err := allocateFile(f, size); err != nil {
+			// The upload still works; WriteAt extends the file instead
+			logging.Warn("Failed to pre-allocate upload", zap.String("session_id", session.SessionID[:8]), zap.Error(err))
+			return
+		}
+		logging.Debug("Pre-allocated upload", zap.String("session_id", session.SessionID[:8]), zap.Duration("took", time.Since(start)))
+	}()
+}
+
+// waitPreallocation blocks until a background allocation has finished, so
+// the file isn't closed under it. The caller holds session.mu, which keeps a
+// new one from starting.
+func (session *uploadSession) waitPreallocation() {
+	if session.preallocated != nil {
+		<-session.preallocated
+	}
+}
+
+// allocateFile reserves the blocks of f's first size bytes, extending it to
+// size. Platforms and filesystems without fallocate get a sparse file instead.
+func allocateFile(f *os.File, size int64) error {
+	err := platform.Current.Fallocate(f, size)
+	if errors.Is(err, errors.ErrUnsupported) {
+		return f.Truncate(size)
+	}
+	return err
+}
@@ -0,0 +1,119 @@
+package server
+
+import (
+	"context"
+	"io"
+	"math/rand"
+	"os"
+	"testing"
+
+	"github.com/zulfikawr/warp/internal/ui"
+)
+
+func TestParsePreallocation(t *testing.T) {
+	for in, want := range map[string]Preallocation{"": PreallocSparse, "off": PreallocOff, "sparse": PreallocSparse, "full": PreallocFull} {
+		got, err := ParsePreallocation(in)
+		if err != nil || got != want {
+			t.Errorf("ParsePreallocation(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	if _, err := ParsePreallocation("eager"); err == nil {
+		t.Error("ParsePreallocation accepted an unknown mode")
+	}
+}
+
+// newPreallocSession starts an upload of size bytes in chunks chunks under p
+func newPreallocSession(t testing.TB, p Preallocation, size int64, chunks int) (*Server, *uploadSession) {
+	t.Helper()
+	s := &Server{Preallocation: p, Renderer: ui.NewJSONRenderer(io.Discard)}
+	s.shutdownCtx, s.shutdownCancel = context.WithCancel(context.Background())
+	t.Cleanup(s.shutdownCancel)
+	session, err := s.getOrCreateSession("0123456789abcdef", "prealloc.bin", size, chunks, t.TempDir(), "", clientInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, session
+}
+
+func fileSize(t *testing.T, path string) int64 {
+	t.Helper()
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fi.Size()
+}
+
+func TestPreallocationModes(t *testing.T) {
+	const chunk = 1 << 20
+	tests := []struct {
+		mode          Preallocation
+		atStart       int64 // Size once the session exists
+		afterPrealloc int64 // Size once the second chunk (the file's tail) is still missing
+	}{
+		{PreallocOff, 0, chunk},
+		{PreallocSparse, 2 * chunk, 2 * chunk},
+		{PreallocFull, 0, 2 * chunk},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.mode), func(t *testing.T) {
+			s, session := newPreallocSession(t, tt.mode, 2*chunk, 2)
+			if got := fileSize(t, session.FilePath); got != tt.atStart {
+				t.Errorf("size after creation = %d, want %d", got, tt.atStart)
+			}
+
+			if err := session.writeChunk(0, 0, make([]byte, chunk)); err != nil {
+				t.Fatal(err)
+			}
+			session.startPreallocation()
+			session.startPreallocation() // At most once per session
+			session.mu.Lock()
+			session.waitPreallocation()
+			session.mu.Unlock()
+			if got := fileSize(t, session.FilePath); got != tt.afterPrealloc {
+				t.Errorf("size after the first chunk = %d, want %d", got, tt.afterPrealloc)
+			}
+
+			if err := session.writeChunk(1, chunk, make([]byte, chunk)); err != nil {
+				t.Fatal(err)
+			}
+			s.cleanupSession(session.SessionID)
+			if got := fileSize(t, session.FilePath); got != 2*chunk {
+				t.Errorf("size of the finished upload = %d, want %d", got, 2*chunk)
+			}
+		})
+	}
+}
+
+// BenchmarkUploadPreallocation writes a 2GB parallel upload in 2MB chunks,
+// in shuffled order, under each preallocate mode. Run with -benchtime=1x;
+// -short shrinks the upload to 64MB.
+func BenchmarkUploadPreallocation(b *testing.B) {
+	size := int64(2 << 30)
+	if testing.Short() {
+		size = 64 << 20
+	}
+	const chunkSize = ManifestChunkSize
+	chunks := int(size / chunkSize)
+	data := make([]byte, chunkSize)
+	order := rand.New(rand.NewSource(1)).Perm(chunks)
+
+	for _, p := range []Preallocation{PreallocOff, PreallocSparse, PreallocFull} {
+		b.Run(string(p), func(b *testing.B) {
+			b.SetBytes(size)
+			for i := 0; i < b.N; i++ {
+				s, session := newPreallocSession(b, p, size, chunks)
+				for n, c := range order {
+					if err := session.writeChunk(c, int64(c)*chunkSize, data); err != nil {
+						b.Fatal(err)
+					}
+					if n == 0 {
+						session.startPreallocation()
+					}
+				}
+				// Closing waits for a background allocation
+				s.cleanupSession(session.SessionID)
+			}
+		})
+	}
+}
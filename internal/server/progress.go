@@ -1,219 +1,326 @@
 package server
 
 import (
+	"context"
 	"fmt"
+	"os"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/zulfikawr/warp/internal/ui"
 )
 
-// MultiFileProgress tracks progress for multiple concurrent file downloads
+// progressEventBuffer is how many events can queue before chunk writers wait
+const progressEventBuffer = 256
+
+// MultiFileProgress tracks progress for multiple concurrent file uploads. Its
+// state belongs to a single display goroutine (run): upload handlers only send
+// events, so chunk writers never hold a lock the renderer needs.
 type MultiFileProgress struct {
-	mu             sync.Mutex
+	events  chan progressEvent
+	stopped chan struct{} // Closed when the display goroutine exits
+
+	// Owned by the display goroutine
 	files          map[string]*FileProgress // sessionID -> progress
 	fileOrder      []string                 // maintain display order
 	totalSize      int64
 	totalReceived  int64
 	startTime      time.Time
-	lastUpdate     time.Time
-	displayActive  bool
-	summaryPrinted bool // prevents duplicate summary display
+	dirty          bool        // state changed since the last frame
+	displayActive  bool        // renderer.Start has been called
+	summaryPrinted bool        // prevents duplicate summary display
+	renderer       ui.Renderer // where progress and the summary are shown
+	pacer          *ui.ProgressPacer
 }
 
-// FileProgress tracks individual file download progress
-type FileProgress struct {
-	filename  string
-	size      int64
+// progressEvent registers a new file (added set) or reports the bytes
+// received so far for one
+type progressEvent struct {
+	sessionID string
+	added     *FileProgress
 	received  int64
 	complete  bool
-	startTime time.Time
-	endTime   time.Time
+	// Session totals of duplicate chunk receipts
+	duplicates int
+	wasted     int64
+	at         time.Time
 }
 
-// printMultiFileProgress displays a dynamic multi-file progress UI
-func (s *Server) printMultiFileProgress() {
-	if s.multiFileDisplay == nil {
-		return
-	}
-
-	display := s.multiFileDisplay
-	display.mu.Lock()
-	defer display.mu.Unlock()
-
-	if len(display.files) == 0 {
-		return
+// newMultiFileProgress starts a display that renders to r until ctx is done
+func newMultiFileProgress(ctx context.Context, r ui.Renderer, start time.Time) *MultiFileProgress {
+	display := &MultiFileProgress{
+		events:    make(chan progressEvent, progressEventBuffer),
+		stopped:   make(chan struct{}),
+		files:     make(map[string]*FileProgress),
+		startTime: start,
+		renderer:  r,
+		pacer:     ui.NewProgressPacer(0, nil),
 	}
+	go display.run(ctx)
+	return display
+}
 
-	// Skip if summary was already printed (prevents duplicate display)
-	if display.summaryPrinted {
-		return
-	}
-
-	if !display.displayActive {
-		fmt.Printf("\n")
-		display.displayActive = true
+// send queues ev for the display goroutine; it is dropped once the display has stopped
+func (display *MultiFileProgress) send(ev progressEvent) {
+	select {
+	case display.events <- ev:
+	case <-display.stopped:
 	}
+}
 
-	fmt.Printf("Receiving %d file(s) (%s total):\033[K\n", len(display.files), ui.FormatBytes(display.totalSize))
+// run applies events and redraws at the pacer's cadence while anything
+// changes; an idle display doesn't wake up. The frame that completes the last
+// file, and the summary, are drawn immediately.
+func (display *MultiFileProgress) run(ctx context.Context) {
+	defer close(display.stopped)
+	var frame <-chan time.Time // nil while there is nothing new to draw
 
-	for _, sessionID := range display.fileOrder {
-		fileProgress := display.files[sessionID]
-		percent := float64(0)
-		if fileProgress.size > 0 {
-			percent = float64(fileProgress.received) / float64(fileProgress.size) * 100
-			if percent > 100 {
-				percent = 100
+	for {
+		select {
+		case ev := <-display.events:
+			if display.apply(ev) && display.allComplete() {
+				display.render(ev.at)
+			} else if display.dirty && frame == nil {
+				frame = time.After(display.pacer.Interval())
 			}
-		}
-
-		barWidth := 20
-		var filled int
-		if fileProgress.complete {
-			filled = barWidth
-			percent = 100
-		} else {
-			filled = int(percent / 5)
-			if filled < 0 {
-				filled = 0
+		case now := <-frame:
+			frame = nil
+			if !display.dirty {
+				continue
 			}
-			if filled > barWidth {
-				filled = barWidth
+			if display.pacer.Ready(display.totalReceived) {
+				display.render(now)
+			} else {
+				frame = time.After(display.pacer.Interval())
 			}
+		case <-ctx.Done():
+			return
 		}
-		bar := strings.Repeat("=", filled) + strings.Repeat(" ", barWidth-filled)
+	}
+}
 
-		displayName := fileProgress.filename
-		if len(displayName) > 35 {
-			displayName = displayName[:32] + "..."
+// apply folds ev into the display state and reports whether a file completed
+func (display *MultiFileProgress) apply(ev progressEvent) bool {
+	if ev.added != nil {
+		if _, exists := display.files[ev.sessionID]; !exists {
+			display.files[ev.sessionID] = ev.added
+			display.fileOrder = append(display.fileOrder, ev.sessionID)
+			// Accumulate total size for overall progress calculation
+			display.totalSize += ev.added.size
+			display.pacer.SetTotal(display.totalSize)
+			display.dirty = true
 		}
-
-		fmt.Printf("%-39s [%s%s%s] %s%3.0f%%%s\033[K\n",
-			displayName,
-			ui.Colors.Green, bar, ui.Colors.Reset,
-			ui.Colors.Green, percent, ui.Colors.Reset)
+		return false
 	}
 
-	fmt.Printf("---------------------------------------------------------------------------------\033[K\n")
-
-	allComplete := true
-	for _, fileProgress := range display.files {
-		if !fileProgress.complete {
-			allComplete = false
-			break
-		}
+	fp, exists := display.files[ev.sessionID]
+	if !exists || fp.complete {
+		return false
+	}
+	oldReceived := fp.received
+	fp.update(ev.received, ev.at)
+	fp.duplicates, fp.wasted = ev.duplicates, ev.wasted
+	display.totalReceived += fp.received - oldReceived
+	display.dirty = true
+	if !ev.complete {
+		return false
 	}
+	fp.complete = true
+	display.totalReceived += fp.size - fp.received
+	fp.received = fp.size
+	fp.endTime = ev.at
+	return true
+}
 
-	overallPercent := float64(0)
-	if allComplete {
-		overallPercent = 100
-		display.totalReceived = display.totalSize
-	} else if display.totalSize > 0 {
-		overallPercent = float64(display.totalReceived) / float64(display.totalSize) * 100
-		if overallPercent > 100 {
-			overallPercent = 100
+// allComplete reports whether every tracked file has finished
+func (display *MultiFileProgress) allComplete() bool {
+	for _, fp := range display.files {
+		if !fp.complete {
+			return false
 		}
 	}
+	return len(display.files) > 0
+}
 
-	overallBarWidth := 20
-	var overallFilled int
-	if allComplete {
-		overallFilled = overallBarWidth
+// FileProgress tracks individual file download progress
+type FileProgress struct {
+	filename  string
+	size      int64
+	received  int64
+	complete  bool
+	startTime time.Time
+	endTime   time.Time
+	client    string // clientInfo label of the uploader
+	chunks    int    // Chunks in the upload
+	// Chunks received more than once, and their bytes
+	duplicates int
+	wasted     int64
+	// Moving-average speed, sampled from byte deltas between updates
+	speed      float64 // bytes per second
+	lastSample time.Time
+	lastBytes  int64
+}
+
+const (
+	// speedSampleInterval is the minimum gap between per-file speed samples,
+	// so bursts of chunk writes don't swing the average
+	speedSampleInterval = 250 * time.Millisecond
+	// speedSmoothing is the weight of the newest sample in the moving average
+	speedSmoothing = 0.3
+)
+
+// update records the bytes received so far and folds the rate since the
+// previous sample into the file's moving-average speed
+func (fp *FileProgress) update(received int64, now time.Time) {
+	fp.received = received
+	if fp.lastSample.IsZero() {
+		fp.lastSample = fp.startTime
+	}
+	dt := now.Sub(fp.lastSample)
+	if dt < speedSampleInterval {
+		return
+	}
+	rate := float64(received-fp.lastBytes) / dt.Seconds()
+	if fp.speed == 0 {
+		fp.speed = rate
 	} else {
-		overallFilled = int(overallPercent / 5)
-		if overallFilled < 0 {
-			overallFilled = 0
+		fp.speed = speedSmoothing*rate + (1-speedSmoothing)*fp.speed
+	}
+	fp.lastSample = now
+	fp.lastBytes = received
+}
+
+// state returns the file's display row. Completed files report their average
+// speed and total time; active files their moving-average speed and ETA.
+func (fp *FileProgress) state(now time.Time) ui.FileState {
+	st := ui.FileState{Name: fp.filename, Current: fp.received, Total: fp.size, Complete: fp.complete}
+	if fp.complete {
+		st.Elapsed = fp.endTime.Sub(fp.startTime)
+		if st.Elapsed > 0 {
+			st.Speed = float64(fp.size) / st.Elapsed.Seconds()
 		}
-		if overallFilled > overallBarWidth {
-			overallFilled = overallBarWidth
+		return st
+	}
+	st.Elapsed = now.Sub(fp.startTime)
+	st.Speed = fp.speed
+	if fp.speed > 0 && fp.size > fp.received {
+		st.ETA = time.Duration(float64(fp.size-fp.received) / fp.speed * float64(time.Second))
+	}
+	return st
+}
+
+// clients returns the distinct uploader labels in display order
+func (display *MultiFileProgress) clients() []string {
+	var out []string
+	seen := make(map[string]bool)
+	for _, id := range display.fileOrder {
+		fp := display.files[id]
+		if fp == nil || fp.client == "" || seen[fp.client] {
+			continue
 		}
+		seen[fp.client] = true
+		out = append(out, fp.client)
 	}
-	overallBar := strings.Repeat("=", overallFilled) + strings.Repeat(" ", overallBarWidth-overallFilled)
+	return out
+}
 
-	elapsed := time.Since(display.startTime)
-	speed := float64(0)
-	if elapsed.Seconds() > 0 {
-		speed = float64(display.totalReceived) / elapsed.Seconds()
+// retransmitFields reports duplicate chunks across all files, with a hint when
+// retries wasted a large share of the transfer
+func (display *MultiFileProgress) retransmitFields() []ui.Field {
+	var chunks, duplicates int
+	var wasted int64
+	for _, fp := range display.files {
+		chunks += fp.chunks
+		duplicates += fp.duplicates
+		wasted += fp.wasted
+	}
+	if duplicates == 0 {
+		return nil
 	}
+	fields := []ui.Field{{Label: "Retransmitted", Value: ui.FormatRetransmits(duplicates, wasted)}}
+	if ui.HighRetransmitRatio(duplicates, chunks) {
+		fields = append(fields, ui.Field{Label: "Hint", Value: "Senders keep retrying chunks; a smaller --chunk-size suits this network better"})
+	}
+	return fields
+}
 
-	fmt.Printf("%sOverall:%s [%s%s%s] %s%3.0f%%%s | %s/%s | %s\033[K\n",
-		ui.Colors.Dim, ui.Colors.Reset,
-		ui.Colors.Green, overallBar, ui.Colors.Reset,
-		ui.Colors.Green, overallPercent, ui.Colors.Reset,
-		ui.FormatBytes(display.totalReceived), ui.FormatBytes(display.totalSize),
-		ui.FormatSpeed(speed))
+// render reports the combined state of all incoming files to the renderer,
+// and the summary once every file is complete
+func (display *MultiFileProgress) render(now time.Time) {
+	display.dirty = false
+	// Skip if summary was already printed (prevents duplicate display)
+	if len(display.files) == 0 || display.summaryPrinted {
+		return
+	}
 
+	allComplete := true
+	files := make([]ui.FileState, 0, len(display.fileOrder))
+	for _, sessionID := range display.fileOrder {
+		fp := display.files[sessionID]
+		files = append(files, fp.state(now))
+		if !fp.complete {
+			allComplete = false
+		}
+	}
 	if allComplete {
-		// Only print summary once (check if we haven't already printed it)
-		if display.displayActive {
-			fmt.Printf("\n%s✓ All Downloads Complete%s\n\n", ui.Colors.Green, ui.Colors.Reset)
-
-			wallTime := time.Since(display.startTime)
-			avgSpeed := float64(0)
-			if wallTime.Seconds() > 0 {
-				avgSpeed = float64(display.totalSize) / wallTime.Seconds()
-			}
+		display.totalReceived = display.totalSize
+	}
 
-			fmt.Printf("%sSummary:%s\n", ui.Colors.Dim, ui.Colors.Reset)
-			fmt.Printf("  Files:        %d\n", len(display.files))
-			fmt.Printf("  Total Size:   %s\n", ui.FormatBytes(display.totalSize))
-			fmt.Printf("  Time:         %s\n", ui.FormatDuration(wallTime))
-			fmt.Printf("  Avg Speed:    %s\n", ui.FormatSpeed(avgSpeed))
-			fmt.Println()
-			// Mark summary as printed to prevent duplicates
-			display.summaryPrinted = true
-			display.displayActive = false
-		}
-	} else {
-		// Move cursor back up to redraw progress (header + files + separator + overall)
-		numLines := 1 + len(display.fileOrder) + 1 + 1
-		fmt.Printf("\033[%dA", numLines)
+	state := ui.TransferState{
+		Name:    fmt.Sprintf("%d file(s)", len(files)),
+		Current: display.totalReceived,
+		Total:   display.totalSize,
+		Elapsed: now.Sub(display.startTime),
+		Files:   files,
 	}
-}
+	if !display.displayActive {
+		display.renderer.Start(state)
+		display.displayActive = true
+	}
+	display.renderer.Update(state)
 
-// removeFileFromDisplay removes a file from the multi-file progress display
-func (s *Server) removeFileFromDisplay(sessionID string) {
-	if s.multiFileDisplay == nil {
+	if !allComplete {
 		return
 	}
 
-	display := s.multiFileDisplay
-	display.mu.Lock()
-	defer display.mu.Unlock()
-
-	if fileProgress, exists := display.files[sessionID]; exists {
-		// Subtract from totals
-		display.totalSize -= fileProgress.size
-		display.totalReceived -= fileProgress.received
-
-		// Remove from map
-		delete(display.files, sessionID)
+	wallTime := now.Sub(display.startTime)
+	avgSpeed := float64(0)
+	if wallTime.Seconds() > 0 {
+		avgSpeed = float64(display.totalSize) / wallTime.Seconds()
+	}
+	summary := ui.Summary{Title: "All Downloads Complete", Fields: []ui.Field{
+		{Label: "Files", Value: fmt.Sprintf("%d", len(files))},
+		{Label: "Total Size", Value: ui.FormatBytes(display.totalSize)},
+		{Label: "Time", Value: ui.FormatDuration(wallTime)},
+		{Label: "Avg Speed", Value: ui.FormatSpeed(avgSpeed)},
+	}}
+	if clients := display.clients(); len(clients) > 0 {
+		summary.Fields = append(summary.Fields, ui.Field{Label: "Client", Value: strings.Join(clients, ", ")})
+	}
+	summary.Fields = append(summary.Fields, display.retransmitFields()...)
+	display.renderer.Finish(summary)
+	// Mark summary as printed to prevent duplicates
+	display.summaryPrinted = true
+	display.displayActive = false
+}
 
-		// Remove from order slice
-		for i, id := range display.fileOrder {
-			if id == sessionID {
-				display.fileOrder = append(display.fileOrder[:i], display.fileOrder[i+1:]...)
-				break
-			}
+// progressDisplay returns the server's multi-file display, starting it on
+// first use. It stops with the server.
+func (s *Server) progressDisplay() *MultiFileProgress {
+	s.displayOnce.Do(func() {
+		ctx := s.shutdownCtx
+		if ctx == nil {
+			ctx = context.Background()
 		}
+		s.multiFileDisplay = newMultiFileProgress(ctx, s.progressRenderer(), time.Now())
+	})
+	return s.multiFileDisplay
+}
 
-		// Clear and redraw if display is active
-		if display.displayActive {
-			// Clear the current display
-			numLines := 1 + len(display.fileOrder) + 1 + 2 // header + old files + separator + overall + removed file
-			for i := 0; i < numLines; i++ {
-				fmt.Print("\033[2K") // Clear line
-				if i < numLines-1 {
-					fmt.Print("\n")
-				}
-			}
-			fmt.Printf("\033[%dA", numLines-1) // Move back up
-
-			// If no files left, reset display
-			if len(display.files) == 0 {
-				display.displayActive = false
-			}
-		}
+// progressRenderer returns the configured renderer or one suited to stdout
+func (s *Server) progressRenderer() ui.Renderer {
+	if s.Renderer != nil {
+		return s.Renderer
 	}
+	return ui.NewRenderer(os.Stdout, false)
 }
@@ -0,0 +1,113 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/zulfikawr/warp/internal/ui"
+)
+
+// serialRenderer records renderer calls and flags any that overlap
+type serialRenderer struct {
+	busy       atomic.Bool
+	overlapped atomic.Bool
+	last       ui.TransferState
+	updates    int
+	summary    ui.Summary
+	finished   chan struct{}
+}
+
+func (r *serialRenderer) enter() func() {
+	if !r.busy.CompareAndSwap(false, true) {
+		r.overlapped.Store(true)
+	}
+	return func() { r.busy.Store(false) }
+}
+
+func (r *serialRenderer) Start(ui.TransferState) { defer r.enter()() }
+
+func (r *serialRenderer) Update(s ui.TransferState) {
+	defer r.enter()()
+	r.last = s
+	r.updates++
+}
+
+func (r *serialRenderer) Finish(s ui.Summary) {
+	defer r.enter()()
+	r.summary = s
+	close(r.finished)
+}
+
+func TestMultiFileProgressConcurrentSessions(t *testing.T) {
+	const (
+		sessions  = 8
+		chunks    = 100
+		chunkSize = 16
+	)
+	r := &serialRenderer{finished: make(chan struct{})}
+	s := &Server{Renderer: r}
+	s.shutdownCtx, s.shutdownCancel = context.WithCancel(context.Background())
+	defer s.shutdownCancel()
+	dir := t.TempDir()
+
+	var wg sync.WaitGroup
+	for i := 0; i < sessions; i++ {
+		sessionID := fmt.Sprintf("%016x", i+1)
+		for w := 0; w < 4; w++ {
+			wg.Add(1)
+			go func(worker int) {
+				defer wg.Done()
+				for c := worker; c < chunks; c += 4 {
+					session, err := s.getOrCreateSession(sessionID, fmt.Sprintf("file%d.bin", i), chunks*chunkSize, chunks, dir, "", clientInfo{})
+					if err != nil {
+						t.Error(err)
+						return
+					}
+					if err := session.writeChunk(c, int64(c*chunkSize), make([]byte, chunkSize)); err != nil {
+						t.Error(err)
+						return
+					}
+				}
+			}(w)
+		}
+	}
+	wg.Wait()
+
+	select {
+	case <-r.finished:
+	case <-time.After(5 * time.Second):
+		t.Fatal("display never flushed the final frame")
+	}
+	if r.overlapped.Load() {
+		t.Error("renderer was called from more than one goroutine at a time")
+	}
+	if len(r.last.Files) != sessions {
+		t.Fatalf("last frame shows %d files, want %d", len(r.last.Files), sessions)
+	}
+	for _, f := range r.last.Files {
+		if !f.Complete || f.Current != f.Total {
+			t.Errorf("%s not complete in the final frame: %+v", f.Name, f)
+		}
+	}
+	if r.last.Current != sessions*chunks*chunkSize || r.last.Current != r.last.Total {
+		t.Errorf("final frame at %d/%d bytes", r.last.Current, r.last.Total)
+	}
+	if r.summary.Title != "All Downloads Complete" {
+		t.Errorf("summary title = %q", r.summary.Title)
+	}
+	// Paced: a handful of frames, not one per chunk
+	if r.updates >= sessions*chunks/2 {
+		t.Errorf("%d frames for %d chunks; updates should be throttled", r.updates, sessions*chunks)
+	}
+
+	s.shutdownCancel()
+	select {
+	case <-s.multiFileDisplay.stopped:
+	case <-time.After(time.Second):
+		t.Error("display goroutine did not stop on shutdown")
+	}
+}
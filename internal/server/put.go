@@ -0,0 +1,161 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/zulfikawr/warp/internal/naming"
+	"github.com/zulfikawr/warp/internal/protocol"
+	"github.com/zulfikawr/warp/internal/ui"
+	"go.uber.org/zap"
+)
+
+// putTempPrefix names PUT uploads still being received; they get their
+// real, unique name only once the whole body is on disk
+const putTempPrefix = ".warp-put-"
+
+// putResult is the JSON answer to a PUT upload, the same fields a raw
+// upload answers with
+type putResult struct {
+	Success  bool   `json:"success"`
+	Filename string `json:"filename"` // Relative to the upload directory
+	Size     int64  `json:"size"`
+}
+
+// handlePut takes a PUT to /u/{token}/{filename}, so that
+// `curl -T report.pdf http://host/u/TOKEN/` works without any warp headers.
+// The body streams to a temporary file next to its destination, with or
+// without a Content-Length, and is renamed to a free name for filename once
+// complete, so a failed or rejected upload leaves nothing behind.
+func (s *Server) handlePut(w http.ResponseWriter, r *http.Request) {
+	if !s.checkQuota(w, r) {
+		return
+	}
+	release, ok := s.acquireTransfer(w)
+	if !ok {
+		return
+	}
+	defer release()
+	transferID, log := startTransfer(w, r, "")
+	setNoCache(w.Header())
+
+	// The rest of the path is already unescaped, so an encoded slash shows
+	// up here and is refused along with any other separator
+	filename := strings.TrimPrefix(shareRest(r), "/")
+	name, err := sanitizeFilename(filename)
+	if err != nil {
+		log.Warn("Invalid filename", zap.String("filename", filename), zap.Error(err))
+		http.Error(w, "invalid filename", http.StatusBadRequest)
+		return
+	}
+
+	// Without a Content-Length (chunked) the size is only known at the end
+	limits := s.uploadLimits()
+	if err := limits.ValidateTotalSize(max(r.ContentLength, 0)); err != nil {
+		log.Warn("Upload rejected by limits", zap.String("filename", name), zap.Int64("size", r.ContentLength), zap.Error(err))
+		http.Error(w, fmt.Sprintf("file too large: %v", err), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if !s.checkUploadLimits(w, name, r.ContentLength) {
+		log.Warn("Upload rejected by limits", zap.String("filename", name), zap.Int64("size", r.ContentLength))
+		return
+	}
+
+	dir, rel := s.uploadDir(r)
+	if err := s.mkdirUpload(dir); err != nil {
+		log.Error("Failed to create upload directory", zap.String("dir", rel), zap.Error(err))
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	releaseDisk, err := s.reserveDisk(dir, r.ContentLength)
+	if err != nil {
+		log.Warn("Disk space check failed", zap.Error(err))
+		http.Error(w, "insufficient disk space", http.StatusInsufficientStorage)
+		return
+	}
+	defer releaseDisk()
+
+	f, err := os.CreateTemp(dir, putTempPrefix+"*-"+naming.Fit(name, naming.Max(dir)-32))
+	if err != nil {
+		log.Error("Failed to open file", zap.String("filename", relPath(rel, name)), zap.Error(err))
+		http.Error(w, "disk error", http.StatusInternalServerError)
+		return
+	}
+	tmpPath := f.Name()
+	// Gone once promoted; otherwise the upload failed
+	defer func() { _ = os.Remove(tmpPath) }()
+	if r.ContentLength > 0 {
+		_ = f.Truncate(r.ContentLength)
+		log.Info("Receiving file", zap.String("filename", relPath(rel, name)), zap.String("size", ui.FormatBytes(r.ContentLength)))
+	} else {
+		log.Info("Receiving file", zap.String("filename", relPath(rel, name)))
+	}
+
+	// A chunked body is held to the upload size limits as it arrives; one
+	// byte over --max-file-size is enough to tell it was exceeded
+	body := http.MaxBytesReader(w, r.Body, limits.MaxTotalSize)
+	src := body
+	if s.MaxFileSize > 0 {
+		src = http.MaxBytesReader(w, body, s.MaxFileSize+1)
+	}
+
+	pt := s.trackTransfer(transferID, relPath(rel, name), protocol.DirectionUpload, max(r.ContentLength, 0), s.clientIP(r))
+	completed := false
+	var outPath string
+	defer func() {
+		if completed {
+			s.finishUpload(transferID, outPath)
+		} else {
+			s.finishTransfer(transferID, false)
+		}
+	}()
+
+	start := time.Now()
+	n, err := stepCopy(f, src, pt.UpdateProgress)
+	if err == nil {
+		err = s.SyncPolicy.finishFile(f)
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	duration := time.Since(start).Seconds()
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge) || (s.MaxFileSize > 0 && n > s.MaxFileSize):
+		log.Warn("Upload rejected by limits", zap.String("filename", name), zap.Int64("bytes", n))
+		http.Error(w, "file too large", http.StatusRequestEntityTooLarge)
+		return
+	case err != nil:
+		log.Error("Upload stream failed", zap.String("filename", relPath(rel, name)), zap.Int64("bytes", n), zap.Error(err))
+		http.Error(w, "write error", http.StatusInternalServerError)
+		return
+	}
+
+	if s.scanning() {
+		if err := s.screenUpload(log, tmpPath, relPath(rel, name)); err != nil {
+			writeScanRejection(w, relPath(rel, name), err)
+			return
+		}
+	}
+	if outPath, err = promoteUpload(tmpPath, dir, name); err != nil {
+		log.Error("Failed to move upload into place", zap.String("filename", relPath(rel, name)), zap.Error(err))
+		http.Error(w, "write error", http.StatusInternalServerError)
+		return
+	}
+	s.applyUploadAttrs(log, r, outPath)
+	actualFilename := relPath(rel, filepath.Base(outPath))
+
+	mbps := throughputMbps(n, duration)
+	log.Info("File received", zap.String("filename", actualFilename), zap.String("size", ui.FormatBytes(n)), zap.Float64("duration", duration), zap.Float64("mbps", mbps), zap.String("speed", ui.FormatSpeed(mbps*1e6/8)))
+	completed = true
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(putResult{Success: true, Filename: actualFilename, Size: n})
+}
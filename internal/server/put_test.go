@@ -0,0 +1,146 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/zulfikawr/warp/internal/crypto"
+	"github.com/zulfikawr/warp/internal/protocol"
+)
+
+// putServer hosts uploads into a directory of its own inside a temporary
+// one, so a test can tell nothing landed beside it
+func putServer(t *testing.T, allowExt ...string) (*Server, *httptest.Server) {
+	t.Helper()
+	tok, _ := crypto.GenerateToken(nil)
+	s := &Server{Token: tok, HostMode: true, UploadDir: filepath.Join(t.TempDir(), "uploads"), AllowedExtensions: allowExt}
+	ts := httptest.NewServer(s.routes())
+	t.Cleanup(ts.Close)
+	return s, ts
+}
+
+// put uploads body to the escaped name under the share. A negative length
+// sends the body chunked, the way curl does when reading from stdin.
+func put(t *testing.T, s *Server, ts *httptest.Server, name, body string, length int64) (*http.Response, putResult) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPut, ts.URL+protocol.UploadPathPrefix+s.Token+"/"+name, io.NopCloser(strings.NewReader(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.ContentLength = length
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	var res putResult
+	if resp.StatusCode == http.StatusCreated {
+		if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return resp, res
+}
+
+// uploaded lists the names in the server's upload directory
+func uploaded(t *testing.T, s *Server) []string {
+	t.Helper()
+	entries, err := os.ReadDir(s.UploadDir)
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	return names
+}
+
+func TestPutUpload(t *testing.T) {
+	s, ts := putServer(t)
+	tests := []struct {
+		name   string
+		path   string
+		length int64
+		want   string
+	}{
+		{"content length", "report.pdf", 5, "report.pdf"},
+		{"chunked", "report.pdf", -1, "report (1).pdf"},
+		{"escaped name", "my%20notes.txt", 5, "my notes.txt"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, res := put(t, s, ts, tt.path, "hello", tt.length)
+			if resp.StatusCode != http.StatusCreated {
+				t.Fatalf("status %d", resp.StatusCode)
+			}
+			if want := (putResult{Success: true, Filename: tt.want, Size: 5}); res != want {
+				t.Errorf("result %+v, want %+v", res, want)
+			}
+			got, err := os.ReadFile(filepath.Join(s.UploadDir, tt.want))
+			if err != nil || string(got) != "hello" {
+				t.Errorf("saved %q, %v", got, err)
+			}
+		})
+	}
+	// No temporary files are left beside the uploads
+	if names := uploaded(t, s); len(names) != len(tests) {
+		t.Errorf("upload directory holds %q", names)
+	}
+}
+
+func TestPutUploadTraversal(t *testing.T) {
+	s, ts := putServer(t)
+	for _, name := range []string{"..%2Fevil.txt", "..%5Cevil.txt", "a%2F..%2F..%2Fevil.txt", "..."} {
+		resp, _ := put(t, s, ts, name, "evil", 4)
+		if resp.StatusCode < 400 {
+			t.Errorf("PUT %s: status %d", name, resp.StatusCode)
+		}
+	}
+	if names := uploaded(t, s); len(names) != 0 {
+		t.Errorf("upload directory holds %q", names)
+	}
+	parent, err := os.ReadDir(filepath.Dir(s.UploadDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range parent {
+		if e.Name() != filepath.Base(s.UploadDir) {
+			t.Errorf("%s written outside the upload directory", e.Name())
+		}
+	}
+}
+
+func TestPutUploadAllowedExtensions(t *testing.T) {
+	s, ts := putServer(t, ".txt")
+	for _, length := range []int64{5, -1} {
+		if resp, _ := put(t, s, ts, "tool.exe", "hello", length); resp.StatusCode != http.StatusUnsupportedMediaType {
+			t.Errorf("length %d: status %d, want 415", length, resp.StatusCode)
+		}
+	}
+	if names := uploaded(t, s); len(names) != 0 {
+		t.Errorf("rejected upload left %q", names)
+	}
+	if resp, res := put(t, s, ts, "notes.txt", "hello", -1); resp.StatusCode != http.StatusCreated || res.Filename != "notes.txt" {
+		t.Errorf("allowed extension: status %d, %+v", resp.StatusCode, res)
+	}
+}
+
+func TestPutUploadTooLarge(t *testing.T) {
+	s, ts := putServer(t)
+	s.MaxFileSize = 4
+	for _, length := range []int64{5, -1} {
+		if resp, _ := put(t, s, ts, "big.bin", "hello", length); resp.StatusCode != http.StatusRequestEntityTooLarge {
+			t.Errorf("length %d: status %d, want 413", length, resp.StatusCode)
+		}
+	}
+	if names := uploaded(t, s); len(names) != 0 {
+		t.Errorf("rejected upload left %q", names)
+	}
+}
@@ -0,0 +1,134 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/quic-go/quic-go/http3"
+	"github.com/zulfikawr/warp/internal/logging"
+	"go.uber.org/zap"
+)
+
+// altSvcMaxAge is how long, in seconds, clients may remember the Alt-Svc
+// advertisement. Kept short since every warp session picks new ports.
+const altSvcMaxAge = 3600
+
+// QUICMode selects whether the HTTP/3 listener runs and on which UDP port.
+// The zero value is auto: QUIC shares the TCP port number.
+type QUICMode struct {
+	Off  bool // No UDP listener at all
+	Port int  // Fixed UDP port; 0 = the TCP port
+}
+
+// ParseQUIC validates a --quic / quic value: off, auto or a UDP port.
+// Empty means auto.
+func ParseQUIC(s string) (QUICMode, error) {
+	switch s {
+	case "", "auto":
+		return QUICMode{}, nil
+	case "off":
+		return QUICMode{Off: true}, nil
+	}
+	port, err := strconv.Atoi(s)
+	if err != nil || port < 1 || port > 65535 {
+		return QUICMode{}, fmt.Errorf("invalid quic setting %q (want off, auto or a port from 1 to 65535)", s)
+	}
+	return QUICMode{Port: port}, nil
+}
+
+// String returns the setting as it is written on the command line
+func (m QUICMode) String() string {
+	switch {
+	case m.Off:
+		return "off"
+	case m.Port > 0:
+		return strconv.Itoa(m.Port)
+	}
+	return "auto"
+}
+
+// QUICPort returns the UDP port HTTP/3 is served on, or 0 when QUIC is off
+// or failed to start
+func (s *Server) QUICPort() int {
+	return s.quicPort
+}
+
+// startQUIC serves handler over HTTP/3 on ip according to s.QUIC, next to
+// the TCP listener on tcpPort. Binding the UDP socket here rather than in the
+// serving goroutine lets a busy port be reported before Start returns. With
+// auto, a failure only leaves QUIC unavailable; a port the user chose must
+// bind or Start fails. The outcome is logged once.
+func (s *Server) startQUIC(ip net.IP, tcpPort int, handler http.Handler) error {
+	if s.QUIC.Off {
+		logging.Info("QUIC/HTTP3 disabled")
+		return nil
+	}
+	port := s.QUIC.Port
+	if port == 0 {
+		port = tcpPort
+	}
+	addr := net.JoinHostPort(ip.String(), strconv.Itoa(port))
+
+	tlsConfig, err := s.getQuicTLSConfig()
+	if err != nil {
+		return s.quicUnavailable(addr, fmt.Errorf("failed to create TLS config for QUIC: %w", err))
+	}
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return s.quicUnavailable(addr, fmt.Errorf("failed to listen on udp %s: %w", addr, err))
+	}
+
+	s.quicConn = conn
+	s.quicPort = conn.LocalAddr().(*net.UDPAddr).Port
+	s.http3Server = &http3.Server{
+		Handler:   handler,
+		Addr:      addr,
+		TLSConfig: tlsConfig,
+	}
+	srv := s.http3Server
+	go func() {
+		if err := srv.Serve(conn); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logging.Warn("QUIC server error", zap.Error(err))
+		}
+	}()
+
+	logging.Info("QUIC/HTTP3 listener started", zap.String("addr", conn.LocalAddr().String()))
+	return nil
+}
+
+// quicUnavailable logs why QUIC isn't running, and turns the failure into a
+// Start error when the user asked for a specific port
+func (s *Server) quicUnavailable(addr string, err error) error {
+	if s.QUIC.Port > 0 {
+		return err
+	}
+	logging.Warn("QUIC/HTTP3 unavailable, serving TCP only", zap.String("addr", addr), zap.Error(err))
+	return nil
+}
+
+// stopQUIC closes the HTTP/3 server and its UDP socket, if they were started
+func (s *Server) stopQUIC() {
+	if s.http3Server != nil {
+		if err := s.http3Server.Close(); err != nil {
+			logging.Warn("Error closing HTTP/3 server", zap.Error(err))
+		}
+	}
+	// http3.Server.Serve leaves the socket it was given open
+	if s.quicConn != nil {
+		_ = s.quicConn.Close()
+	}
+}
+
+// advertiseQUIC points clients at the HTTP/3 listener with an Alt-Svc header
+// on every response while QUIC is running
+func (s *Server) advertiseQUIC(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if port := s.quicPort; port > 0 {
+			w.Header().Set("Alt-Svc", fmt.Sprintf(`h3=":%d"; ma=%d`, port, altSvcMaxAge))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
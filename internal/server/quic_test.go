@@ -0,0 +1,165 @@
+package server
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go/http3"
+	"github.com/zulfikawr/warp/internal/protocol"
+)
+
+func TestParseQUIC(t *testing.T) {
+	for in, want := range map[string]QUICMode{"": {}, "auto": {}, "off": {Off: true}, "8443": {Port: 8443}} {
+		if got, err := ParseQUIC(in); err != nil || got != want {
+			t.Errorf("ParseQUIC(%q) = %+v, %v; want %+v", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"on", "0", "65536", "-1", "udp"} {
+		if _, err := ParseQUIC(in); err == nil {
+			t.Errorf("ParseQUIC(%q) accepted an invalid setting", in)
+		}
+	}
+	if s := (QUICMode{Port: 8443}).String(); s != "8443" {
+		t.Errorf("String() = %q, want 8443", s)
+	}
+}
+
+// freeUDPPort returns a UDP port on loopback that nothing is bound to
+func freeUDPPort(t *testing.T) int {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := conn.LocalAddr().(*net.UDPAddr).Port
+	_ = conn.Close()
+	return port
+}
+
+// udpBound reports whether something already holds the loopback UDP port
+func udpBound(t *testing.T, port int) bool {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+	if err != nil {
+		return true
+	}
+	_ = conn.Close()
+	return false
+}
+
+func TestQUICOffBindsNothing(t *testing.T) {
+	ip := net.ParseIP("127.0.0.1")
+	s := &Server{Token: "tok", IP: ip, QUIC: QUICMode{Off: true}}
+	port := freeUDPPort(t)
+	if err := s.startQUIC(ip, port, s.routes()); err != nil {
+		t.Fatal(err)
+	}
+	if s.http3Server != nil || s.QUICPort() != 0 {
+		t.Fatalf("QUIC started while off (port %d)", s.QUICPort())
+	}
+	if udpBound(t, port) {
+		t.Fatal("UDP port bound with --quic off")
+	}
+	s.stopQUIC() // nothing to close, must not panic
+
+	ts := httptest.NewServer(s.routes())
+	defer ts.Close()
+	resp, err := http.Get(ts.URL + protocol.HealthPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if alt := resp.Header.Get("Alt-Svc"); alt != "" {
+		t.Errorf("Alt-Svc = %q with QUIC off, want none", alt)
+	}
+}
+
+func TestQUICCustomPort(t *testing.T) {
+	ip := net.ParseIP("127.0.0.1")
+	port := freeUDPPort(t)
+	s := &Server{Token: "tok", IP: ip, QUIC: QUICMode{Port: port}}
+	// The TCP port is deliberately different; QUIC must not follow it
+	if err := s.startQUIC(ip, 1, s.routes()); err != nil {
+		t.Fatal(err)
+	}
+	if s.QUICPort() != port {
+		t.Fatalf("QUICPort() = %d, want %d", s.QUICPort(), port)
+	}
+	if !udpBound(t, port) {
+		t.Fatal("custom QUIC port is not bound")
+	}
+
+	tr := &http3.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
+	defer tr.Close()
+	resp, err := (&http.Client{Transport: tr}).Get("https://" + net.JoinHostPort(ip.String(), strconv.Itoa(port)) + protocol.HealthPath)
+	if err != nil {
+		t.Fatalf("HTTP/3 request: %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.ProtoMajor != 3 {
+		t.Fatalf("got %d over HTTP/%d, want 200 over HTTP/3", resp.StatusCode, resp.ProtoMajor)
+	}
+
+	ts := httptest.NewServer(s.routes())
+	defer ts.Close()
+	resp, err = http.Get(ts.URL + protocol.HealthPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if want := `h3=":` + strconv.Itoa(port) + `"; ma=3600`; resp.Header.Get("Alt-Svc") != want {
+		t.Errorf("Alt-Svc = %q, want %q", resp.Header.Get("Alt-Svc"), want)
+	}
+
+	s.stopQUIC()
+	if udpBound(t, port) {
+		t.Fatal("UDP port still bound after shutdown")
+	}
+}
+
+func TestQUICPortInUse(t *testing.T) {
+	ip := net.ParseIP("127.0.0.1")
+	taken, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer taken.Close()
+	port := taken.LocalAddr().(*net.UDPAddr).Port
+
+	// A port the user chose must bind
+	s := &Server{Token: "tok", IP: ip, QUIC: QUICMode{Port: port}}
+	if err := s.startQUIC(ip, port, s.routes()); err == nil {
+		s.stopQUIC()
+		t.Fatal("startQUIC succeeded on a taken port")
+	}
+
+	// auto only loses QUIC
+	s = &Server{Token: "tok", IP: ip}
+	if err := s.startQUIC(ip, port, s.routes()); err != nil {
+		t.Fatalf("auto failed Start: %v", err)
+	}
+	if s.QUICPort() != 0 {
+		t.Fatalf("QUICPort() = %d after a failed bind, want 0", s.QUICPort())
+	}
+}
+
+func TestSelfSignedCertToleratesClockSkew(t *testing.T) {
+	s := &Server{IP: net.ParseIP("127.0.0.1")}
+	cert, err := s.generateSelfSignedCert()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A client whose clock runs most of an hour ahead, or a host left
+	// running for days, still finds the certificate valid
+	for _, at := range []time.Duration{-59 * time.Minute, 59 * time.Minute, 6 * 24 * time.Hour} {
+		now := time.Now().Add(at)
+		if now.Before(cert.Leaf.NotBefore) || now.After(cert.Leaf.NotAfter) {
+			t.Errorf("certificate invalid at now%+v: valid %v to %v", at, cert.Leaf.NotBefore, cert.Leaf.NotAfter)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/zulfikawr/warp/internal/logging"
+	"github.com/zulfikawr/warp/internal/metrics"
+	"github.com/zulfikawr/warp/internal/ui"
+)
+
+// DefaultQuotaReset is how often per-IP usage starts over when QuotaReset is 0
+const DefaultQuotaReset = 24 * time.Hour
+
+// ipUsage counts the bytes one client IP moved in the current quota period.
+// Transfers add to it as bytes pass, so it costs one atomic add per write.
+type ipUsage struct {
+	bytes atomic.Int64
+}
+
+// add counts n more bytes; a nil ipUsage counts nothing
+func (u *ipUsage) add(n int64) {
+	if u != nil && n > 0 {
+		u.bytes.Add(n)
+	}
+}
+
+// quotaExceeded is the 429 body for a client over QuotaPerIP
+type quotaExceeded struct {
+	Error    string    `json:"error"`
+	Quota    int64     `json:"quota"`     // Bytes allowed per period
+	Used     int64     `json:"used"`      // Bytes this client moved this period
+	ResetsAt time.Time `json:"resets_at"` // When usage starts over
+}
+
+// usageFor returns the usage counter of clientIP, creating it on first use.
+// Counters live for the whole run, like the rate limiter entries.
+func (s *Server) usageFor(clientIP string) *ipUsage {
+	if val, ok := s.ipUsage.Load(clientIP); ok {
+		return val.(*ipUsage)
+	}
+	val, _ := s.ipUsage.LoadOrStore(clientIP, &ipUsage{})
+	return val.(*ipUsage)
+}
+
+// quotaReset is the length of a quota period
+func (s *Server) quotaReset() time.Duration {
+	if s.QuotaReset > 0 {
+		return s.QuotaReset
+	}
+	return DefaultQuotaReset
+}
+
+// rollQuotaPeriod starts a new quota period, with every counter at zero,
+// once the current one is over, and returns when the current one ends.
+// Periods follow on from the first without drifting.
+func (s *Server) rollQuotaPeriod() time.Time {
+	s.quotaMu.Lock()
+	defer s.quotaMu.Unlock()
+	now, period := s.now(), s.quotaReset()
+	if s.quotaStart.IsZero() {
+		s.quotaStart = now
+	}
+	if elapsed := now.Sub(s.quotaStart); elapsed >= period {
+		s.quotaStart = s.quotaStart.Add(elapsed / period * period)
+		// Counters stay in place, so transfers still running count into
+		// the new period
+		s.ipUsage.Range(func(_, val interface{}) bool {
+			val.(*ipUsage).bytes.Store(0)
+			return true
+		})
+		metrics.ClientBytes.Reset()
+	}
+	return s.quotaStart.Add(period)
+}
+
+// Usage returns the bytes each client IP moved, uploads and downloads
+// together, in the current quota period
+func (s *Server) Usage() map[string]int64 {
+	s.rollQuotaPeriod()
+	usage := make(map[string]int64)
+	s.ipUsage.Range(func(key, val interface{}) bool {
+		if n := val.(*ipUsage).bytes.Load(); n > 0 {
+			usage[key.(string)] = n
+		}
+		return true
+	})
+	return usage
+}
+
+// publishUsage updates the warp_client_bytes gauge for clientIP
+func (s *Server) publishUsage(clientIP string) {
+	if val, ok := s.ipUsage.Load(clientIP); ok {
+		metrics.ClientBytes.WithLabelValues(clientIP).Set(float64(val.(*ipUsage).bytes.Load()))
+	}
+}
+
+// checkQuota refuses a transfer with 429 and a JSON body when the client has
+// used up QuotaPerIP this period, and reports whether it may go ahead. A
+// transfer already running finishes even if it takes the client past the
+// quota; the next one is refused.
+func (s *Server) checkQuota(w http.ResponseWriter, r *http.Request) bool {
+	if s.QuotaPerIP <= 0 {
+		return true
+	}
+	resetsAt := s.rollQuotaPeriod()
+	clientIP := s.clientIP(r)
+	used := s.usageFor(clientIP).bytes.Load()
+	if used < s.QuotaPerIP {
+		return true
+	}
+	metrics.QuotaExceeded.WithLabelValues(clientIP).Inc()
+	logging.Info("Transfer quota exceeded", zap.String("client_ip", clientIP), zap.String("used", ui.FormatBytes(used)), zap.String("quota", ui.FormatBytes(s.QuotaPerIP)))
+	retry := max(resetsAt.Sub(s.now()), time.Second)
+	w.Header().Set("Retry-After", strconv.Itoa(int(retry.Round(time.Second)/time.Second)))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusTooManyRequests)
+	_ = json.NewEncoder(w).Encode(quotaExceeded{
+		Error:    "transfer quota exceeded: " + ui.FormatBytes(used) + " of " + ui.FormatBytes(s.QuotaPerIP) + " used",
+		Quota:    s.QuotaPerIP,
+		Used:     used,
+		ResetsAt: resetsAt.UTC(),
+	})
+	return false
+}
@@ -0,0 +1,124 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/zulfikawr/warp/internal/crypto"
+	"github.com/zulfikawr/warp/internal/protocol"
+)
+
+// getShare downloads the share and returns the status and body
+func getShare(t *testing.T, url string) (int, []byte) {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	body, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, body
+}
+
+func TestQuotaPerIP(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "file.bin")
+	if err := os.WriteFile(path, bytes.Repeat([]byte{'q'}, 600), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var clock atomic.Int64
+	start := time.Date(2026, 5, 1, 9, 0, 0, 0, time.UTC)
+	clock.Store(start.UnixNano())
+	tok, _ := crypto.GenerateToken(nil)
+	s := &Server{Token: tok, SrcPath: path, QuotaPerIP: 1000, QuotaReset: time.Hour}
+	s.clock = func() time.Time { return time.Unix(0, clock.Load()) }
+	ts := httptest.NewServer(s.routes())
+	defer ts.Close()
+	url := ts.URL + protocol.PathPrefix + tok
+
+	// The second download starts under the quota and may finish past it
+	for i := 0; i < 2; i++ {
+		if code, _ := getShare(t, url); code != http.StatusOK {
+			t.Fatalf("download %d: status %d, want 200", i+1, code)
+		}
+	}
+	code, body := getShare(t, url)
+	if code != http.StatusTooManyRequests {
+		t.Fatalf("download over quota: status %d, want 429", code)
+	}
+	var refused quotaExceeded
+	if err := json.Unmarshal(body, &refused); err != nil {
+		t.Fatalf("429 body %q: %v", body, err)
+	}
+	if refused.Quota != 1000 || refused.Used != 1200 || !refused.ResetsAt.Equal(start.Add(time.Hour)) {
+		t.Errorf("429 body = %+v, want quota 1000, used 1200, reset at %s", refused, start.Add(time.Hour))
+	}
+	if usage := s.Usage(); usage["127.0.0.1"] != 1200 {
+		t.Errorf("Usage() = %v, want 1200 for 127.0.0.1", usage)
+	}
+
+	// Still the same period a second before it ends
+	clock.Store(start.Add(time.Hour - time.Second).UnixNano())
+	if code, _ := getShare(t, url); code != http.StatusTooManyRequests {
+		t.Errorf("just before the reset: status %d, want 429", code)
+	}
+
+	// Periods follow on from the first, so 2h30m in is the third one
+	clock.Store(start.Add(150 * time.Minute).UnixNano())
+	if code, _ := getShare(t, url); code != http.StatusOK {
+		t.Fatalf("after the reset: status %d, want 200", code)
+	}
+	var h protocol.Health
+	_, body = getShare(t, ts.URL+protocol.HealthPath)
+	if err := json.Unmarshal(body, &h); err != nil {
+		t.Fatal(err)
+	}
+	if h.UsageTotal != 600 || h.Quota != 1000 || h.QuotaReset == nil || !h.QuotaReset.Equal(start.Add(3*time.Hour)) {
+		t.Errorf("health usage %d, quota %d, reset %v; want 600, 1000, %s", h.UsageTotal, h.Quota, h.QuotaReset, start.Add(3*time.Hour))
+	}
+	// Client IPs are listed only behind the token
+	if strings.Contains(string(body), "127.0.0.1") {
+		t.Errorf("health names a client IP: %s", body)
+	}
+	if st := getStats(t, url+protocol.StatsPathSuffix); st.Usage["127.0.0.1"] != 600 {
+		t.Errorf("stats usage %v, want 600 for 127.0.0.1", st.Usage)
+	}
+}
+
+func TestQuotaCountsUploads(t *testing.T) {
+	tok, _ := crypto.GenerateToken(nil)
+	s := &Server{Token: tok, HostMode: true, UploadDir: t.TempDir(), QuotaPerIP: 100}
+	ts := httptest.NewServer(s.routes())
+	defer ts.Close()
+
+	upload := func() int {
+		req, _ := http.NewRequest(http.MethodPost, ts.URL+protocol.UploadPathPrefix+tok, bytes.NewReader(make([]byte, 80)))
+		req.Header.Set("X-File-Name", "data.bin")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = resp.Body.Close()
+		return resp.StatusCode
+	}
+	if code := upload(); code != http.StatusOK {
+		t.Fatalf("first upload: status %d, want 200", code)
+	}
+	if got := s.Usage()["127.0.0.1"]; got != 80 {
+		t.Errorf("usage after one upload = %d, want 80", got)
+	}
+	if code := upload(); code != http.StatusOK {
+		t.Fatalf("second upload: status %d, want 200", code)
+	}
+	if code := upload(); code != http.StatusTooManyRequests {
+		t.Errorf("upload over quota: status %d, want 429", code)
+	}
+}
@@ -0,0 +1,182 @@
+package server
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/zulfikawr/warp/internal/logging"
+)
+
+const (
+	// rangeDownloadTTL is how long a download pieced together from Range
+	// requests may go without a request before it is abandoned
+	rangeDownloadTTL = time.Hour
+	// maxRangeDownloads bounds the downloads being pieced together at once;
+	// the longest idle is dropped to make room
+	maxRangeDownloads = 1024
+	// maxRangeSpans bounds the separate byte ranges one download may have
+	// served; one that scatters more is dropped
+	maxRangeSpans = 256
+)
+
+// rangeKey identifies one client's download of the share: download managers
+// fetch a file as many Range requests with the same address and user agent
+type rangeKey struct {
+	ip, userAgent, token string
+}
+
+// servedRange is what one download request served of the file
+type servedRange struct {
+	key   rangeKey
+	size  int64 // Of the file
+	start int64
+	n     int64 // Bytes served from start
+}
+
+// whole reports whether the request served the entire file by itself
+func (r *servedRange) whole() bool {
+	return r.start == 0 && r.n == r.size
+}
+
+// span is a half-open byte range [start, end)
+type span struct{ start, end int64 }
+
+// rangeDownload is a download being pieced together
+type rangeDownload struct {
+	size     int64
+	spans    []span // Sorted, disjoint and not adjacent
+	requests int
+	lastSeen time.Time
+}
+
+// covered is how many bytes of the file the download has been served
+func (d *rangeDownload) covered() int64 {
+	var n int64
+	for _, sp := range d.spans {
+		n += sp.end - sp.start
+	}
+	return n
+}
+
+// add merges [start, end) into the spans
+func (d *rangeDownload) add(start, end int64) {
+	merged := span{start, end}
+	kept := d.spans[:0]
+	var after []span
+	for _, sp := range d.spans {
+		switch {
+		case sp.end < merged.start:
+			kept = append(kept, sp)
+		case sp.start > merged.end:
+			after = append(after, sp)
+		default:
+			merged.start = min(merged.start, sp.start)
+			merged.end = max(merged.end, sp.end)
+		}
+	}
+	d.spans = append(append(kept, merged), after...)
+}
+
+// rangeDownloads tracks downloads served as several Range requests, so one
+// file fetched in pieces is counted once, when its last byte has gone out
+type rangeDownloads struct {
+	mu sync.Mutex
+	m  map[rangeKey]*rangeDownload
+}
+
+// add records a served range and reports how many requests the download
+// has taken and whether they now cover the whole file. A finished download
+// is forgotten.
+func (t *rangeDownloads) add(r *servedRange, now time.Time) (requests int, done bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.m == nil {
+		t.m = make(map[rangeKey]*rangeDownload)
+	}
+	d, ok := t.m[r.key]
+	if !ok || d.size != r.size {
+		// New, or the file changed size and the old pieces are of another file
+		if !ok && len(t.m) >= maxRangeDownloads {
+			t.evictLocked()
+		}
+		d = &rangeDownload{size: r.size}
+		t.m[r.key] = d
+	}
+	d.requests++
+	d.lastSeen = now
+	d.add(r.start, r.start+r.n)
+	if d.covered() >= d.size {
+		delete(t.m, r.key)
+		return d.requests, true
+	}
+	if len(d.spans) > maxRangeSpans {
+		delete(t.m, r.key)
+	}
+	return d.requests, false
+}
+
+// forget drops a client's download in progress, when it fetched the whole
+// file in one request after all
+func (t *rangeDownloads) forget(key rangeKey) {
+	t.mu.Lock()
+	delete(t.m, key)
+	t.mu.Unlock()
+}
+
+// evictLocked drops the download idle longest
+func (t *rangeDownloads) evictLocked() {
+	var oldest rangeKey
+	var oldestSeen time.Time
+	for k, d := range t.m {
+		if oldestSeen.IsZero() || d.lastSeen.Before(oldestSeen) {
+			oldest, oldestSeen = k, d.lastSeen
+		}
+	}
+	delete(t.m, oldest)
+}
+
+// abandonedRange describes a download given up on
+type abandonedRange struct {
+	key      rangeKey
+	covered  int64
+	size     int64
+	requests int
+}
+
+// expire drops downloads that have had no request for rangeDownloadTTL and
+// returns them, most covered first
+func (t *rangeDownloads) expire(now time.Time) []abandonedRange {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var out []abandonedRange
+	for k, d := range t.m {
+		if now.Sub(d.lastSeen) >= rangeDownloadTTL {
+			out = append(out, abandonedRange{key: k, covered: d.covered(), size: d.size, requests: d.requests})
+			delete(t.m, k)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].covered > out[j].covered })
+	return out
+}
+
+// len is how many downloads are being pieced together
+func (t *rangeDownloads) len() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.m)
+}
+
+// cleanupRangeDownloads abandons downloads whose client stopped requesting
+// ranges before it had the whole file; they are never counted
+func (s *Server) cleanupRangeDownloads() {
+	for _, a := range s.rangeDownloads.expire(s.now()) {
+		logging.Info("Abandoned download pieced from ranges",
+			zap.String("client_ip", a.key.ip),
+			zap.Int("requests", a.requests),
+			zap.Int64("covered", a.covered),
+			zap.Int64("size", a.size))
+	}
+}
@@ -0,0 +1,152 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/zulfikawr/warp/internal/crypto"
+	"github.com/zulfikawr/warp/internal/protocol"
+)
+
+func TestRangeDownloadSpans(t *testing.T) {
+	d := &rangeDownload{size: 100}
+	for _, sp := range []span{{40, 50}, {0, 10}, {80, 100}, {10, 20}, {45, 85}} {
+		d.add(sp.start, sp.end)
+	}
+	if want := []span{{0, 20}, {40, 100}}; !reflect.DeepEqual(d.spans, want) {
+		t.Errorf("spans = %v, want %v", d.spans, want)
+	}
+	if n := d.covered(); n != 80 {
+		t.Errorf("covered = %d, want 80", n)
+	}
+	d.add(15, 45)
+	if want := []span{{0, 100}}; !reflect.DeepEqual(d.spans, want) {
+		t.Errorf("spans after filling the gap = %v, want %v", d.spans, want)
+	}
+}
+
+// rangeServer shares a 4 KiB file from a server whose clock the test sets
+func rangeServer(t *testing.T) (*Server, *httptest.Server, *atomic.Int64) {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "data.bin")
+	if err := os.WriteFile(file, make([]byte, 4096), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tok, _ := crypto.GenerateToken(nil)
+	var clock atomic.Int64
+	clock.Store(time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC).UnixNano())
+	s := &Server{Token: tok, SrcPath: file}
+	s.clock = func() time.Time { return time.Unix(0, clock.Load()) }
+	ts := httptest.NewServer(s.routes())
+	t.Cleanup(ts.Close)
+	return s, ts, &clock
+}
+
+func getRange(t *testing.T, s *Server, ts *httptest.Server, start, end int) {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+protocol.PathPrefix+s.Token, nil)
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end))
+	req.Header.Set("User-Agent", "segmenter/1.0")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusPartialContent {
+		t.Fatalf("Range %d-%d: status %d", start, end, resp.StatusCode)
+	}
+}
+
+func TestSegmentedDownloadCountedOnce(t *testing.T) {
+	s, ts, _ := rangeServer(t)
+	events := s.Events()
+
+	// A download manager fetching four segments, out of order
+	for i, seg := range [][2]int{{0, 1023}, {2048, 3071}, {3072, 4095}, {1024, 2047}} {
+		getRange(t, s, ts, seg[0], seg[1])
+		want := DownloadActivity{}
+		if i == 3 {
+			want.Partial = 1
+		}
+		if a := s.DownloadActivity(); a.Full != want.Full || a.Partial != want.Partial {
+			t.Errorf("after segment %d: activity %+v, want %d partial", i+1, a, want.Partial)
+		}
+	}
+	if got := collectEvents(t, events, EventTransferCompleted); len(got) != 5 {
+		// One start per segment, then the completion
+		t.Errorf("events = %v, want 4 starts and a completion", eventTypes(got))
+	}
+	if n := s.rangeDownloads.len(); n != 0 {
+		t.Errorf("%d downloads still being pieced together", n)
+	}
+	st := s.stats()
+	if len(st.Recent) != 1 {
+		t.Errorf("recent = %+v, want the one download", st.Recent)
+	}
+	if st.BytesSent != 4096 {
+		t.Errorf("BytesSent = %d, want 4096", st.BytesSent)
+	}
+}
+
+func TestAbandonedSegmentedDownload(t *testing.T) {
+	s, ts, clock := rangeServer(t)
+	getRange(t, s, ts, 0, 1023)
+	getRange(t, s, ts, 1024, 2047)
+
+	if a := s.DownloadActivity(); a.Full != 0 || a.Partial != 0 {
+		t.Errorf("half a download counted: %+v", a)
+	}
+	if len(s.stats().Recent) != 0 {
+		t.Errorf("half a download listed as completed")
+	}
+
+	clock.Add(int64(rangeDownloadTTL - time.Minute))
+	s.cleanupRangeDownloads()
+	if n := s.rangeDownloads.len(); n != 1 {
+		t.Fatalf("download dropped before the TTL: %d left", n)
+	}
+	clock.Add(int64(time.Minute))
+	s.cleanupRangeDownloads()
+	if n := s.rangeDownloads.len(); n != 0 {
+		t.Fatalf("abandoned download kept: %d left", n)
+	}
+
+	// Coming back for the rest after that starts over
+	getRange(t, s, ts, 2048, 4095)
+	if a := s.DownloadActivity(); a.Partial != 0 {
+		t.Errorf("rest of an abandoned download counted: %+v", a)
+	}
+}
+
+func TestRangeDownloadsBounded(t *testing.T) {
+	var d rangeDownloads
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	for i := range maxRangeDownloads + 10 {
+		key := rangeKey{ip: fmt.Sprintf("10.0.%d.%d", i/256, i%256)}
+		d.add(&servedRange{key: key, size: 100, n: 10}, now.Add(time.Duration(i)*time.Second))
+	}
+	if n := d.len(); n != maxRangeDownloads {
+		t.Errorf("%d downloads tracked, want %d", n, maxRangeDownloads)
+	}
+	if _, ok := d.m[rangeKey{ip: "10.0.0.0"}]; ok {
+		t.Error("the longest idle download was kept")
+	}
+
+	// A client scattering tiny ranges is dropped rather than grown
+	key := rangeKey{ip: "192.0.2.1"}
+	for i := range maxRangeSpans + 1 {
+		d.add(&servedRange{key: key, size: 1 << 20, start: int64(i) * 10, n: 1}, now)
+	}
+	if _, ok := d.m[key]; ok {
+		t.Error("download with too many spans kept")
+	}
+}
@@ -5,11 +5,11 @@ import (
 	"fmt"
 	"io"
 	"net"
-	"net/http"
-	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/zulfikawr/warp/internal/ui"
 	"golang.org/x/time/rate"
 )
 
@@ -72,46 +72,32 @@ func (s *Server) getRateLimiter(clientIP string) *rate.Limiter {
 func (s *Server) cleanupRateLimiters() {
 	staleThreshold := time.Now().Add(-1 * time.Hour)
 
-	s.rateLimiters.Range(func(key, value interface{}) bool {
-		entry := value.(*rateLimiterEntry)
-		if entry.lastAccess.Before(staleThreshold) {
-			s.rateLimiters.Delete(key)
-		}
-		return true
-	})
-}
-
-// getClientIP extracts the client IP from the request
-func getClientIP(r *http.Request) string {
-	// Check X-Forwarded-For header (if behind proxy)
-	forwarded := r.Header.Get("X-Forwarded-For")
-	if forwarded != "" {
-		// Take the first IP in the list
-		ips := strings.Split(forwarded, ",")
-		return strings.TrimSpace(ips[0])
-	}
-
-	// Check X-Real-IP header
-	realIP := r.Header.Get("X-Real-IP")
-	if realIP != "" {
-		return realIP
+	for _, limiters := range []*sync.Map{&s.rateLimiters, &s.shortLimiters} {
+		limiters.Range(func(key, value interface{}) bool {
+			entry := value.(*rateLimiterEntry)
+			if entry.lastAccess.Before(staleThreshold) {
+				limiters.Delete(key)
+			}
+			return true
+		})
 	}
-
-	// Use RemoteAddr
-	host, _, err := net.SplitHostPort(r.RemoteAddr)
-	if err != nil {
-		return r.RemoteAddr
-	}
-	return host
 }
 
 // ProgressTracker tracks upload/download progress for real-time WebSocket updates
 type ProgressTracker struct {
+	ID           string // Transfer ID, or the session ID of a chunked upload
+	StatsID      string // Opaque ID published in /stats; unlike ID it unlocks nothing
 	Filename     string
+	Direction    string // protocol.DirectionDownload or protocol.DirectionUpload
 	TotalSize    int64
 	BytesWritten int64 // atomic
 	StartTime    time.Time
 	LastUpdate   time.Time
+	ClientIP     string
+	usage        *ipUsage          // Client's quota usage, counted with BytesWritten; nil = none
+	events       *eventBus         // Receives paced Progress events; nil = none
+	pacer        *ui.ProgressPacer // Paces Progress events and WebSocket updates
+	firstByte    atomic.Int64      // UnixNano when the first body byte went out; 0 before
 }
 
 // GetProgress returns current progress stats atomically
@@ -131,6 +117,7 @@ func (pt *ProgressTracker) GetProgress() map[string]interface{} {
 
 	return map[string]interface{}{
 		"filename":        pt.Filename,
+		"direction":       pt.Direction,
 		"total_size":      pt.TotalSize,
 		"bytes_written":   bytesWritten,
 		"percentage":      percentage,
@@ -142,7 +129,34 @@ func (pt *ProgressTracker) GetProgress() map[string]interface{} {
 // UpdateProgress atomically updates bytes written
 func (pt *ProgressTracker) UpdateProgress(bytes int64) {
 	atomic.AddInt64(&pt.BytesWritten, bytes)
+	pt.usage.add(bytes)
 	pt.LastUpdate = time.Now()
+	pt.progressed()
+}
+
+// SetProgress atomically replaces bytes written, for transfers whose chunks
+// may arrive out of order
+func (pt *ProgressTracker) SetProgress(bytes int64) {
+	atomic.StoreInt64(&pt.BytesWritten, bytes)
+	pt.LastUpdate = time.Now()
+	pt.progressed()
+}
+
+// markFirstByte records that the body has started, the first time only
+func (pt *ProgressTracker) markFirstByte() {
+	if pt.firstByte.Load() == 0 {
+		pt.firstByte.CompareAndSwap(0, time.Now().UnixNano())
+	}
+}
+
+// TTFB returns how long the transfer took to send its first body byte,
+// checksum computation included, or 0 when it hasn't sent one
+func (pt *ProgressTracker) TTFB() time.Duration {
+	ns := pt.firstByte.Load()
+	if ns == 0 {
+		return 0
+	}
+	return max(time.Unix(0, ns).Sub(pt.StartTime), 0)
 }
 
 // tcpKeepAliveListener sets TCP keepalive and optimizes socket for high throughput
@@ -0,0 +1,81 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/time/rate"
+
+	"github.com/zulfikawr/warp/internal/logging"
+	"github.com/zulfikawr/warp/internal/protocol"
+	"github.com/zulfikawr/warp/internal/relay"
+)
+
+// startRelay announces the share at the Relay in the room of its
+// nameplate, so a receiver that can't reach the LAN address gets there
+// through the relay. A relay that can't be reached fails Start.
+func (s *Server) startRelay() error {
+	if s.Relay == "" {
+		return nil
+	}
+	if s.PAKECode == "" {
+		return fmt.Errorf("relay mode needs a PAKE code: content through a relay must be end-to-end encrypted")
+	}
+	if s.RelayNameplate == "" {
+		return fmt.Errorf("relay mode needs a nameplate for the relay room")
+	}
+	ln, err := relay.Listen(s.Relay, relay.Room(s.RelayNameplate))
+	if err != nil {
+		return fmt.Errorf("failed to reach relay %s: %w", s.Relay, err)
+	}
+	go func() {
+		if err := s.ServeRelay(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logging.Warn("Relay server error", zap.String("relay", s.Relay), zap.Error(err))
+		}
+	}()
+	logging.Info("Serving through relay", zap.String("relay", s.Relay))
+	return nil
+}
+
+// ServeRelay serves the share's routes on connections paired through a
+// relay, as HTTP/2 over TLS so one connection carries every request of a
+// transfer and the relay sees neither paths nor headers. The certificate is
+// self-signed: receivers authenticate the sender with the PAKE handshake.
+func (s *Server) ServeRelay(ln net.Listener) error {
+	tlsConfig, err := s.getQuicTLSConfig()
+	if err != nil {
+		_ = ln.Close()
+		return fmt.Errorf("failed to create TLS config for the relay: %w", err)
+	}
+	tlsConfig.NextProtos = []string{"h2"}
+	s.relayGuesses = rate.NewLimiter(rate.Every(relayGuessInterval), maxPAKEAttempts)
+	srv := &http.Server{
+		ReadHeaderTimeout: 5 * time.Second,
+		WriteTimeout:      protocol.WriteTimeout,
+		IdleTimeout:       protocol.IdleTimeout,
+		MaxHeaderBytes:    1 << 20,
+		Handler:           s.routes(),
+		TLSConfig:         tlsConfig,
+		ConnContext:       s.relayConnContext,
+	}
+	s.relayServer.Store(srv)
+	select {
+	case <-s.Done():
+		// Shut down before the server was stored
+		_ = ln.Close()
+		return http.ErrServerClosed
+	default:
+	}
+	return srv.ServeTLS(ln, "", "")
+}
+
+// relayConnContext numbers each relayed connection, which tells the
+// receivers behind the relay's one address apart; see pakePeer
+func (s *Server) relayConnContext(ctx context.Context, _ net.Conn) context.Context {
+	return context.WithValue(ctx, relayConnKey{}, s.relayConns.Add(1))
+}
@@ -0,0 +1,94 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/zulfikawr/warp/internal/metrics"
+	"github.com/zulfikawr/warp/internal/platform"
+	"github.com/zulfikawr/warp/internal/ui"
+)
+
+// diskHeadroom is kept free for the system on top of every reservation
+const diskHeadroom = 1 << 30
+
+// errDiskFull means an upload would eat into space other uploads reserved
+var errDiskFull = errors.New("insufficient disk space")
+
+// diskReservations counts bytes promised to uploads that haven't finished.
+// Each upload is checked against the free space minus what is already
+// promised, so concurrent uploads can't all pass the check against the same
+// free bytes and run each other out of space. Bytes an upload has already
+// written are counted both as used and as reserved until it finishes, which
+// errs on the side of refusing.
+type diskReservations struct {
+	mu       sync.Mutex
+	reserved int64
+}
+
+// reserveDisk reserves n bytes under dir for an incoming upload, failing when
+// the free space left after outstanding reservations can't take them. The
+// returned release gives the bytes back and may be called more than once.
+// Where free space can't be read the reservation is still counted.
+func (s *Server) reserveDisk(dir string, n int64) (release func(), err error) {
+	if n <= 0 {
+		return func() {}, nil
+	}
+	r := &s.disk
+	r.mu.Lock()
+	if free := s.freeSpace(dir); free > 0 && free-r.reserved-n < diskHeadroom {
+		reserved := r.reserved
+		r.mu.Unlock()
+		return nil, fmt.Errorf("%w: need %s, have %s available (%s reserved by uploads in progress)",
+			errDiskFull, ui.FormatBytes(n), ui.FormatBytes(free), ui.FormatBytes(reserved))
+	}
+	r.reserved += n
+	metrics.ReservedUploadBytes.Set(float64(r.reserved))
+	r.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			r.mu.Lock()
+			r.reserved -= n
+			metrics.ReservedUploadBytes.Set(float64(r.reserved))
+			r.mu.Unlock()
+		})
+	}, nil
+}
+
+// ReservedBytes returns the disk space promised to uploads in progress
+func (s *Server) ReservedBytes() int64 {
+	s.disk.mu.Lock()
+	defer s.disk.mu.Unlock()
+	return s.disk.reserved
+}
+
+// freeSpace returns the bytes available at dir, or 0 if unknown
+func (s *Server) freeSpace(dir string) int64 {
+	if s.statfs != nil {
+		return s.statfs(dir)
+	}
+	return freeDiskSpace(dir)
+}
+
+// freeDiskSpace returns the bytes available to unprivileged users at dir, or
+// 0 if unknown
+func freeDiskSpace(dir string) int64 {
+	free, err := platform.Current.DiskFree(dir)
+	if err != nil {
+		return 0
+	}
+	return free
+}
+
+// availableSpace is the free space at dir not yet promised to an upload, or 0
+// if unknown. A fully reserved disk reports 1 byte rather than unknown.
+func (s *Server) availableSpace(dir string) int64 {
+	free := s.freeSpace(dir)
+	if free <= 0 {
+		return 0
+	}
+	return max(free-s.ReservedBytes(), 1)
+}
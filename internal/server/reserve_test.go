@@ -0,0 +1,165 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zulfikawr/warp/internal/crypto"
+	"github.com/zulfikawr/warp/internal/protocol"
+)
+
+func TestConcurrentSessionsReserveDisk(t *testing.T) {
+	const chunkSize = 64 << 10
+	const fileSize = 2 * chunkSize
+	tok, _ := crypto.GenerateToken(nil)
+	// Room for two files on top of the headroom, not five
+	s := &Server{Token: tok, HostMode: true, UploadDir: t.TempDir()}
+	s.statfs = func(string) int64 { return diskHeadroom + 2*fileSize + chunkSize }
+	ts := httptest.NewServer(s.routes())
+	defer ts.Close()
+
+	// Only the first chunk of each session, so every session stays open
+	statuses := make([]int, 5)
+	var wg sync.WaitGroup
+	for i := range statuses {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req, _ := http.NewRequest(http.MethodPost, ts.URL+protocol.UploadPathPrefix+tok, bytes.NewReader(make([]byte, chunkSize)))
+			req.Header.Set("X-File-Name", fmt.Sprintf("file%d.bin", i))
+			req.Header.Set("X-Upload-Session", fmt.Sprintf("reserve-session-%d", i))
+			req.Header.Set("X-Upload-Offset", "0")
+			req.Header.Set("X-Upload-Total", fmt.Sprint(fileSize))
+			req.Header.Set("X-Chunk-Id", "0")
+			req.Header.Set("X-Chunk-Total", "2")
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			_ = resp.Body.Close()
+			statuses[i] = resp.StatusCode
+		}()
+	}
+	wg.Wait()
+
+	accepted, refused := 0, 0
+	for _, code := range statuses {
+		switch code {
+		case http.StatusOK:
+			accepted++
+		case http.StatusInsufficientStorage:
+			refused++
+		default:
+			t.Errorf("unexpected status %d", code)
+		}
+	}
+	if accepted != 2 || refused != 3 {
+		t.Fatalf("accepted %d, refused %d sessions; want 2 and 3", accepted, refused)
+	}
+	if got := s.ReservedBytes(); got != 2*fileSize {
+		t.Errorf("ReservedBytes() = %d, want %d", got, 2*fileSize)
+	}
+
+	resp, err := http.Get(ts.URL + "/health")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var health protocol.Health
+	_ = json.NewDecoder(resp.Body).Decode(&health)
+	_ = resp.Body.Close()
+	if health.Reserved != 2*fileSize {
+		t.Errorf("/health reserved = %d, want %d", health.Reserved, 2*fileSize)
+	}
+
+	// Dropping a session gives its space back exactly once
+	for i, code := range statuses {
+		if code == http.StatusOK {
+			s.cleanupSession(fmt.Sprintf("reserve-session-%d", i))
+			s.cleanupSession(fmt.Sprintf("reserve-session-%d", i))
+			break
+		}
+	}
+	if got := s.ReservedBytes(); got != fileSize {
+		t.Errorf("after cleanup ReservedBytes() = %d, want %d", got, fileSize)
+	}
+}
+
+func TestReservationReleasedOnCompletion(t *testing.T) {
+	const chunkSize = 64 << 10
+	tok, _ := crypto.GenerateToken(nil)
+	s := &Server{Token: tok, HostMode: true, UploadDir: t.TempDir()}
+	s.statfs = func(string) int64 { return diskHeadroom + 4*chunkSize }
+	ts := httptest.NewServer(s.routes())
+	defer ts.Close()
+
+	for id := 0; id < 2; id++ {
+		req, _ := http.NewRequest(http.MethodPost, ts.URL+protocol.UploadPathPrefix+tok, bytes.NewReader(make([]byte, chunkSize)))
+		req.Header.Set("X-File-Name", "done.bin")
+		req.Header.Set("X-Upload-Session", "reserve-done")
+		req.Header.Set("X-Upload-Offset", fmt.Sprint(id*chunkSize))
+		req.Header.Set("X-Upload-Total", fmt.Sprint(2*chunkSize))
+		req.Header.Set("X-Chunk-Id", fmt.Sprint(id))
+		req.Header.Set("X-Chunk-Total", "2")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("chunk %d: status %d", id, resp.StatusCode)
+		}
+	}
+	if got := s.ReservedBytes(); got != 0 {
+		t.Errorf("ReservedBytes() = %d after the upload completed, want 0", got)
+	}
+
+	// A plain raw upload holds its Content-Length only while it runs
+	req, _ := http.NewRequest(http.MethodPost, ts.URL+protocol.UploadPathPrefix+tok, bytes.NewReader(make([]byte, chunkSize)))
+	req.Header.Set("X-File-Name", "raw.bin")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("raw upload: status %d", resp.StatusCode)
+	}
+	// The handler returns just after answering
+	deadline := time.Now().Add(2 * time.Second)
+	for s.ReservedBytes() != 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := s.ReservedBytes(); got != 0 {
+		t.Errorf("ReservedBytes() = %d after the raw upload, want 0", got)
+	}
+}
+
+func TestLegacyChunkReservesTotal(t *testing.T) {
+	const chunkSize = 64 << 10
+	tok, _ := crypto.GenerateToken(nil)
+	// Room for the first chunk, but not the whole file it pre-allocates
+	s := &Server{Token: tok, HostMode: true, UploadDir: t.TempDir()}
+	s.statfs = func(string) int64 { return diskHeadroom + 2*chunkSize }
+	ts := httptest.NewServer(s.routes())
+	defer ts.Close()
+
+	req, _ := http.NewRequest(http.MethodPost, ts.URL+protocol.UploadPathPrefix+tok, bytes.NewReader(make([]byte, chunkSize)))
+	req.Header.Set("X-File-Name", "legacy.bin")
+	req.Header.Set("X-Upload-Offset", "0")
+	req.Header.Set("X-Upload-Total", fmt.Sprint(4*chunkSize))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusInsufficientStorage {
+		t.Errorf("status %d, want 507 for a file larger than the free space", resp.StatusCode)
+	}
+}
@@ -0,0 +1,120 @@
+package server
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"go.uber.org/zap"
+
+	"github.com/zulfikawr/warp/internal/logging"
+)
+
+// collectReturns runs on Shutdown in send mode with AllowReturn. Upload
+// sessions still open are closed first, so nothing is written after this.
+// Files recorded as complete by finishUpload move from UploadDir to
+// ReturnDir; without one, or when a move fails, they stay where they are.
+// Anything else in UploadDir, a partial or abandoned upload, is discarded
+// along with the directory, which is warp's own temporary one.
+func (s *Server) collectReturns() {
+	if !s.AllowReturn || s.HostMode || s.UploadDir == "" {
+		return
+	}
+	s.uploadSessions.Range(func(key, _ any) bool {
+		s.cleanupSession(key.(string))
+		return true
+	})
+
+	var complete []string
+	s.completedUploads.Range(func(key, _ any) bool {
+		p := key.(string)
+		// A file moved away since, e.g. quarantined, isn't returned
+		if filepath.Dir(p) == filepath.Clean(s.UploadDir) {
+			if fi, err := os.Stat(p); err == nil && fi.Mode().IsRegular() {
+				complete = append(complete, p)
+			}
+		}
+		return true
+	})
+	sort.Strings(complete)
+	if len(complete) > 0 && s.ReturnDir != "" {
+		if err := os.MkdirAll(s.ReturnDir, 0o755); err != nil {
+			logging.Warn("Cannot create return directory", zap.String("dir", s.ReturnDir), zap.Error(err))
+		}
+	}
+
+	kept := make(map[string]bool)
+	for _, src := range complete {
+		name := filepath.Base(src)
+		if s.ReturnDir == "" {
+			s.returned = append(s.returned, src)
+			kept[name] = true
+			continue
+		}
+		dst := findUniqueFilename(s.ReturnDir, name)
+		if err := moveFile(src, dst); err != nil {
+			logging.Warn("Cannot move returned file", zap.String("filename", name), zap.Error(err))
+			s.returned = append(s.returned, src)
+			kept[name] = true
+			continue
+		}
+		s.returned = append(s.returned, dst)
+	}
+
+	entries, err := os.ReadDir(s.UploadDir)
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		if kept[e.Name()] || e.Name() == QuarantineDir {
+			continue
+		}
+		logging.Info("Discarding incomplete returned file", zap.String("filename", e.Name()))
+		_ = os.RemoveAll(filepath.Join(s.UploadDir, e.Name()))
+	}
+	// Only succeeds when everything moved out
+	_ = os.Remove(s.UploadDir)
+}
+
+// Returned lists where the files sent back with AllowReturn ended up. It is
+// filled by Shutdown; paths still inside UploadDir were not moved.
+func (s *Server) Returned() []string {
+	return s.returned
+}
+
+// moveFile renames src to dst, copying across filesystems when the upload
+// directory lives on a different one (e.g. a tmpfs /tmp)
+func moveFile(src, dst string) error {
+	err := os.Rename(src, dst)
+	if err == nil {
+		return nil
+	}
+	var linkErr *os.LinkError
+	fi, statErr := os.Stat(src)
+	if !errors.As(err, &linkErr) || statErr != nil || !fi.Mode().IsRegular() {
+		return err
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = in.Close() }()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, fi.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		_ = out.Close()
+		_ = os.Remove(dst)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		_ = os.Remove(dst)
+		return err
+	}
+	_ = os.Chtimes(dst, fi.ModTime(), fi.ModTime())
+	return os.Remove(src)
+}
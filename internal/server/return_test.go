@@ -0,0 +1,177 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/zulfikawr/warp/internal/crypto"
+	"github.com/zulfikawr/warp/internal/protocol"
+)
+
+// returnServer shares a file with AllowReturn and serves it over httptest
+func returnServer(t *testing.T, returnDir string) (*Server, *httptest.Server) {
+	t.Helper()
+	src := filepath.Join(t.TempDir(), "draft.txt")
+	if err := os.WriteFile(src, []byte("first draft"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tok, _ := crypto.GenerateToken(nil)
+	s := &Server{Token: tok, SrcPath: src, AllowReturn: true, UploadDir: t.TempDir(), ReturnDir: returnDir}
+	ts := httptest.NewServer(s.routes())
+	t.Cleanup(ts.Close)
+	return s, ts
+}
+
+func sendBack(t *testing.T, ts *httptest.Server, s *Server, name, body string) {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodPost, ts.URL+protocol.UploadPathPrefix+s.Token, strings.NewReader(body))
+	req.Header.Set("X-File-Name", name)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("upload %s: status %d", name, resp.StatusCode)
+	}
+}
+
+func TestAllowReturnServesBothDirections(t *testing.T) {
+	s, ts := returnServer(t, "")
+
+	resp, err := http.Get(ts.URL + protocol.PathPrefix + s.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(body) != "first draft" {
+		t.Fatalf("download: status %d, body %q", resp.StatusCode, body)
+	}
+
+	resp, err = http.Get(ts.URL + protocol.UploadPathPrefix + s.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/html") {
+		t.Errorf("upload page: status %d, type %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	// Without AllowReturn the upload path doesn't exist in send mode
+	plain := httptest.NewServer((&Server{Token: s.Token, SrcPath: s.SrcPath}).routes())
+	defer plain.Close()
+	resp, err = http.Get(plain.URL + protocol.UploadPathPrefix + s.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("upload path without AllowReturn: status %d, want 404", resp.StatusCode)
+	}
+}
+
+func TestReturnedFilesMoveOnShutdown(t *testing.T) {
+	returnDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(returnDir, "draft.txt"), []byte("original"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s, ts := returnServer(t, returnDir)
+	sendBack(t, ts, s, "draft.txt", "second draft")
+	sendBack(t, ts, s, "notes.md", "comments")
+
+	if err := s.Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		filepath.Join(returnDir, "draft (1).txt"): "second draft",
+		filepath.Join(returnDir, "notes.md"):      "comments",
+	}
+	returned := s.Returned()
+	if len(returned) != len(want) {
+		t.Fatalf("Returned() = %v", returned)
+	}
+	for _, p := range returned {
+		got, err := os.ReadFile(p)
+		if err != nil || string(got) != want[p] {
+			t.Errorf("%s = %q (%v), want %q", p, got, err, want[p])
+		}
+	}
+	if _, err := os.Stat(s.UploadDir); !os.IsNotExist(err) {
+		t.Errorf("upload dir not removed: %v", err)
+	}
+}
+
+func TestReturnedFilesStayWithoutReturnDir(t *testing.T) {
+	s, ts := returnServer(t, "")
+	sendBack(t, ts, s, "reply.txt", "hello back")
+	if err := s.Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+	returned := s.Returned()
+	if len(returned) != 1 || returned[0] != filepath.Join(s.UploadDir, "reply.txt") {
+		t.Fatalf("Returned() = %v, want the file in %s", returned, s.UploadDir)
+	}
+}
+
+func TestEmptyReturnDirIsRemoved(t *testing.T) {
+	s, _ := returnServer(t, t.TempDir())
+	if err := s.Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Returned()) != 0 {
+		t.Errorf("Returned() = %v, want none", s.Returned())
+	}
+	if _, err := os.Stat(s.UploadDir); !os.IsNotExist(err) {
+		t.Errorf("empty upload dir not removed: %v", err)
+	}
+}
+
+func TestIncompleteReturnsAreNotCollected(t *testing.T) {
+	returnDir := t.TempDir()
+	s, ts := returnServer(t, returnDir)
+	sendBack(t, ts, s, "done.txt", "finished")
+
+	// First of two parallel chunks: the session stays open
+	const chunkSize = 64 << 10
+	req, _ := http.NewRequest(http.MethodPost, ts.URL+protocol.UploadPathPrefix+s.Token, bytes.NewReader(make([]byte, chunkSize)))
+	req.Header.Set("X-File-Name", "partial.bin")
+	req.Header.Set("X-Upload-Session", "partial-session-1")
+	req.Header.Set("X-Upload-Offset", "0")
+	req.Header.Set("X-Upload-Total", fmt.Sprint(2*chunkSize))
+	req.Header.Set("X-Chunk-Id", "0")
+	req.Header.Set("X-Chunk-Total", "2")
+	req.Header.Set(protocol.ChunkSizeHeader, fmt.Sprint(chunkSize))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("chunk: status %d", resp.StatusCode)
+	}
+
+	if err := s.Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+	if returned := s.Returned(); len(returned) != 1 || returned[0] != filepath.Join(returnDir, "done.txt") {
+		t.Errorf("Returned() = %v, want only done.txt", returned)
+	}
+	if _, err := os.Stat(filepath.Join(returnDir, "partial.bin")); !os.IsNotExist(err) {
+		t.Errorf("partial upload moved to the return directory: %v", err)
+	}
+	if _, ok := s.uploadSessions.Load("partial-session-1"); ok {
+		t.Error("upload session left open")
+	}
+	if _, err := os.Stat(s.UploadDir); !os.IsNotExist(err) {
+		t.Errorf("upload dir not removed: %v", err)
+	}
+}
@@ -0,0 +1,87 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// shareRoutes dispatches the requests under a share token, checked by
+// requireToken, by the rest of the path
+type shareRoutes struct {
+	share    http.HandlerFunc            // The share itself
+	exact    map[string]http.HandlerFunc // By the whole rest, e.g. "/stats"
+	segments map[string]http.HandlerFunc // By a segment followed by an ID, e.g. "/verify/"; see subRouteID
+	put      http.HandlerFunc            // Any PUT below the share, e.g. "/report.pdf", if set
+}
+
+func (sr shareRoutes) serve(w http.ResponseWriter, r *http.Request) {
+	rest := shareRest(r)
+	if rest == "" {
+		sr.share(w, r)
+		return
+	}
+	if r.Method == http.MethodPut && sr.put != nil {
+		sr.put(w, r)
+		return
+	}
+	if h, ok := sr.exact[rest]; ok {
+		h(w, r)
+		return
+	}
+	for segment, h := range sr.segments {
+		if _, ok := subRouteID(rest, segment); ok {
+			h(w, r)
+			return
+		}
+	}
+	http.NotFound(w, r)
+}
+
+// subRouteID returns the single-segment ID that follows segment in rest, e.g.
+// "job-1" for "/verify/job-1"
+func subRouteID(rest, segment string) (string, bool) {
+	id, ok := strings.CutPrefix(rest, segment)
+	return id, ok && id != "" && !strings.Contains(id, "/")
+}
+
+// tokenRoutes maps the extra path keys a share answers to, such as its --short
+// alias, onto the share token they stand for
+type tokenRoutes struct {
+	mu     sync.RWMutex
+	routes map[string]string // key -> token
+}
+
+// add maps key to token, reporting false when key is already taken
+func (t *tokenRoutes) add(key, token string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, taken := t.routes[key]; taken {
+		return false
+	}
+	if t.routes == nil {
+		t.routes = make(map[string]string)
+	}
+	t.routes[key] = token
+	return true
+}
+
+// resolve returns the token key stands for
+func (t *tokenRoutes) resolve(key string) (string, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	token, ok := t.routes[key]
+	return token, ok
+}
+
+// keyFor returns a key routed to token, or "" when there is none
+func (t *tokenRoutes) keyFor(token string) string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	for key, tok := range t.routes {
+		if tok == token {
+			return key
+		}
+	}
+	return ""
+}
@@ -0,0 +1,56 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/zulfikawr/warp/internal/crypto"
+)
+
+func TestShareSubRoutes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.txt")
+	if err := os.WriteFile(path, []byte("hello"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tok, _ := crypto.GenerateToken(nil)
+	send := httptest.NewServer((&Server{Token: tok, SrcPath: path}).routes())
+	defer send.Close()
+	host := httptest.NewServer((&Server{Token: tok, HostMode: true, UploadDir: t.TempDir()}).routes())
+	defer host.Close()
+
+	tests := []struct {
+		name string
+		base string
+		path string
+		want int
+	}{
+		{"download", send.URL, "/d/" + tok, http.StatusOK},
+		{"download with trailing slash", send.URL, "/d/" + tok + "/", http.StatusOK},
+		{"info", send.URL, "/d/" + tok + "/info", http.StatusOK},
+		{"info with trailing slash", send.URL, "/d/" + tok + "/info/", http.StatusOK},
+		{"unknown download sub-route", send.URL, "/d/" + tok + "/anything", http.StatusNotFound},
+		{"wrong token with sub-route", send.URL, "/d/wrong/info", http.StatusForbidden},
+		{"empty token", send.URL, "/d//info", http.StatusForbidden},
+		{"upload page", host.URL, "/u/" + tok, http.StatusOK},
+		{"manifest", host.URL, "/u/" + tok + "/manifest", http.StatusOK},
+		{"unknown session", host.URL, "/u/" + tok + "/session/no-such-session-1", http.StatusNotFound},
+		{"verify without a job", host.URL, "/u/" + tok + "/verify/", http.StatusNotFound},
+		{"unknown upload sub-route", host.URL, "/u/" + tok + "/anything", http.StatusNotFound},
+		{"wrong upload token", host.URL, "/u/wrong/manifest", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := http.Get(tt.base + tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_ = resp.Body.Close()
+			if resp.StatusCode != tt.want {
+				t.Errorf("GET %s: status %d, want %d", tt.path, resp.StatusCode, tt.want)
+			}
+		})
+	}
+}
@@ -3,10 +3,11 @@ package server
 import (
 	"errors"
 	"fmt"
-	"os"
 	"path/filepath"
 	"strings"
 	"time"
+
+	"github.com/zulfikawr/warp/internal/naming"
 )
 
 // sanitizeFilename validates and sanitizes a filename for secure filesystem operations
@@ -30,6 +31,10 @@ func sanitizeFilename(name string) (string, error) {
 		return "", errors.New("filename contains directory traversal sequence")
 	}
 
+	// Shorten overlong names rather than refusing them; the checks below
+	// apply to what will actually be written
+	name = naming.Fit(name, naming.MaxBytes)
+
 	// Clean and get base
 	cleaned := filepath.Base(filepath.Clean(name))
 
@@ -55,11 +60,6 @@ func sanitizeFilename(name string) (string, error) {
 		return "", errors.New("filename is only whitespace")
 	}
 
-	// Limit length to 255 bytes (common filesystem limit)
-	if len(cleaned) > 255 {
-		return "", errors.New("filename too long (max 255 bytes)")
-	}
-
 	return cleaned, nil
 }
 
@@ -70,25 +70,5 @@ func findUniqueFilename(dir, name string) string {
 		// Fallback to timestamp-based name if sanitization fails
 		name = fmt.Sprintf("upload_%d", time.Now().UnixNano())
 	}
-
-	ext := filepath.Ext(name)
-	base := strings.TrimSuffix(name, ext)
-
-	// First try: exact match
-	path := filepath.Join(dir, name)
-	if _, err := os.Stat(path); os.IsNotExist(err) {
-		return path
-	}
-
-	// Collision found: try "file (1).ext", "file (2).ext", etc.
-	for i := 1; i < 1000; i++ {
-		newName := fmt.Sprintf("%s (%d)%s", base, i, ext)
-		path = filepath.Join(dir, newName)
-		if _, err := os.Stat(path); os.IsNotExist(err) {
-			return path
-		}
-	}
-
-	// Fallback: Use timestamp if 1000 collisions (unlikely)
-	return filepath.Join(dir, fmt.Sprintf("%s_%d%s", base, time.Now().UnixNano(), ext))
+	return naming.Unique(dir, name)
 }
@@ -0,0 +1,219 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/zulfikawr/warp/internal/metrics"
+	"github.com/zulfikawr/warp/internal/naming"
+)
+
+// ScanPathPlaceholder stands for the uploaded file's path in ScanCmd
+const ScanPathPlaceholder = "{path}"
+
+// DefaultScanTimeout bounds one scan when ScanTimeout is 0
+const DefaultScanTimeout = 5 * time.Minute
+
+// scanOutputLimit is how much scanner output is kept to find its first line
+const scanOutputLimit = 4 << 10
+
+// scanTempPrefix names uploads held back until they scan clean
+const scanTempPrefix = ".warp-scan-"
+
+// ScanError is why ScanCmd didn't pass an upload: the scanner's first line
+// of output, a timeout or a scanner that failed to run
+type ScanError struct {
+	Reason string
+}
+
+func (e *ScanError) Error() string {
+	return "rejected by scan: " + e.Reason
+}
+
+// ParseScanCmd splits a --scan-cmd value on spaces into the command and its
+// arguments; empty means no scanning. It runs without a shell, so a file
+// name can't inject anything. Without a {path} argument the file's path is
+// appended.
+func ParseScanCmd(s string) ([]string, error) {
+	args := strings.Fields(s)
+	if len(args) == 0 {
+		return nil, nil
+	}
+	if _, err := exec.LookPath(args[0]); err != nil {
+		return nil, fmt.Errorf("scan command %q not found", args[0])
+	}
+	if !slices.ContainsFunc(args[1:], func(a string) bool { return strings.Contains(a, ScanPathPlaceholder) }) {
+		args = append(args, ScanPathPlaceholder)
+	}
+	return args, nil
+}
+
+// scanning reports whether finished uploads go through ScanCmd
+func (s *Server) scanning() bool {
+	return len(s.ScanCmd) > 0
+}
+
+// acquireScan waits for one of ScanWorkers slots, so a slow scanner holds up
+// only that many uploads at a time
+func (s *Server) acquireScan(ctx context.Context) (release func(), err error) {
+	s.scanOnce.Do(func() {
+		n := s.ScanWorkers
+		if n <= 0 {
+			n = runtime.NumCPU()
+		}
+		s.scanSlots = make(chan struct{}, n)
+	})
+	select {
+	case s.scanSlots <- struct{}{}:
+		return func() { <-s.scanSlots }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// scanFile runs ScanCmd on path. Only an exit status of 0 passes the file;
+// a scan that runs past ScanTimeout is killed and fails it.
+func (s *Server) scanFile(path string) error {
+	ctx := s.shutdownCtx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	release, err := s.acquireScan(ctx)
+	if err != nil {
+		metrics.UploadScans.WithLabelValues("error").Inc()
+		return &ScanError{Reason: "not scanned: " + err.Error()}
+	}
+	defer release()
+
+	timeout := s.ScanTimeout
+	if timeout <= 0 {
+		timeout = DefaultScanTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	args := make([]string, len(s.ScanCmd))
+	for i, a := range s.ScanCmd {
+		args[i] = strings.ReplaceAll(a, ScanPathPlaceholder, path)
+	}
+	var out headBuffer
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stdout, cmd.Stderr = &out, &out
+	// Children of a killed scanner may still hold its output open
+	cmd.WaitDelay = time.Second
+	err = cmd.Run()
+
+	var exitErr *exec.ExitError
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		metrics.UploadScans.WithLabelValues("timeout").Inc()
+		return &ScanError{Reason: fmt.Sprintf("scan timed out after %v", timeout)}
+	case err == nil:
+		metrics.UploadScans.WithLabelValues("clean").Inc()
+		return nil
+	case errors.As(err, &exitErr):
+		metrics.UploadScans.WithLabelValues("rejected").Inc()
+		reason := firstLine(out.Bytes())
+		if reason == "" {
+			reason = fmt.Sprintf("scanner exited with status %d", exitErr.ExitCode())
+		}
+		return &ScanError{Reason: reason}
+	default:
+		metrics.UploadScans.WithLabelValues("error").Inc()
+		return &ScanError{Reason: "scanner failed: " + err.Error()}
+	}
+}
+
+// screenUpload scans the finished upload at path, which clients know as name.
+// A file that doesn't pass is moved to the quarantine directory and the
+// returned *ScanError says why; nil means the file may be kept.
+func (s *Server) screenUpload(log *zap.Logger, path, name string) error {
+	if !s.scanning() {
+		return nil
+	}
+	start := time.Now()
+	err := s.scanFile(path)
+	if err == nil {
+		log.Info("Upload scanned clean", zap.String("filename", name), zap.Duration("took", time.Since(start)))
+		return nil
+	}
+	// Scanners name the file they flag; clients only know it as name
+	scanErr := err.(*ScanError)
+	scanErr.Reason = strings.ReplaceAll(scanErr.Reason, path, name)
+	quarantined, qerr := s.quarantineAs(path, filepath.Base(name))
+	if qerr != nil {
+		// Never leave a rejected file where it would be taken for accepted
+		log.Error("Failed to quarantine file", zap.String("filename", name), zap.Error(qerr))
+		_ = os.Remove(path)
+	}
+	log.Warn("Upload rejected by scan", zap.String("filename", name), zap.String("reason", scanErr.Reason), zap.String("quarantined", quarantined))
+	return scanErr
+}
+
+// scanTemp creates the file an upload is written to until it scans clean. It
+// keeps name as a suffix for scanners that go by the extension, shortened
+// to leave room for the prefix and random part.
+func scanTemp(dir, name string) (*os.File, error) {
+	return os.CreateTemp(dir, scanTempPrefix+"*-"+naming.Fit(name, naming.Max(dir)-32))
+}
+
+// promoteUpload moves an upload that scanned clean from tmp to a free name
+// for name in dir, returning its path
+func promoteUpload(tmp, dir, name string) (string, error) {
+	outPath := findUniqueFilename(dir, name)
+	if err := os.Rename(tmp, outPath); err != nil {
+		return "", err
+	}
+	return outPath, nil
+}
+
+// scanRejection is the 422 body for an upload the scan didn't pass
+type scanRejection struct {
+	Success  bool   `json:"success"`
+	Filename string `json:"filename"`
+	Error    string `json:"error"`
+}
+
+// writeScanRejection answers 422 with why the scan didn't pass name
+func writeScanRejection(w http.ResponseWriter, name string, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	_ = json.NewEncoder(w).Encode(scanRejection{Filename: name, Error: err.Error()})
+}
+
+// headBuffer keeps the first scanOutputLimit bytes written to it
+type headBuffer struct {
+	bytes.Buffer
+}
+
+func (h *headBuffer) Write(p []byte) (int, error) {
+	if room := scanOutputLimit - h.Len(); room > 0 {
+		_, _ = h.Buffer.Write(p[:min(len(p), room)])
+	}
+	return len(p), nil
+}
+
+// firstLine returns the first non-blank line of out
+func firstLine(out []byte) string {
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	for sc.Scan() {
+		if line := strings.TrimSpace(sc.Text()); line != "" {
+			return line
+		}
+	}
+	return ""
+}
@@ -0,0 +1,243 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zulfikawr/warp/internal/crypto"
+	"github.com/zulfikawr/warp/internal/protocol"
+)
+
+// stubScanner writes a scanner that goes by the file name: "infected" files
+// fail with a signature line, "slow" ones hang and the rest pass
+func stubScanner(t *testing.T) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("stub scanner is a shell script")
+	}
+	path := filepath.Join(t.TempDir(), "scan.sh")
+	script := `#!/bin/sh
+case "$1" in
+*infected*) echo "$1: Eicar-Test-Signature FOUND"; exit 1 ;;
+*slow*) exec sleep 10 ;;
+esac
+echo "$1: OK"
+`
+	if err := os.WriteFile(path, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func scanServer(t *testing.T) (*Server, *httptest.Server) {
+	t.Helper()
+	tok, _ := crypto.GenerateToken(nil)
+	s := &Server{Token: tok, HostMode: true, UploadDir: t.TempDir(), ScanTimeout: 300 * time.Millisecond}
+	s.ScanCmd = []string{stubScanner(t), ScanPathPlaceholder}
+	ts := httptest.NewServer(s.routes())
+	t.Cleanup(ts.Close)
+	return s, ts
+}
+
+// uploadedNames lists the upload directory, leaving out the quarantine
+func uploadedNames(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		if e.Name() != QuarantineDir {
+			names = append(names, e.Name())
+		}
+	}
+	return names
+}
+
+func TestParseScanCmd(t *testing.T) {
+	if args, err := ParseScanCmd(""); err != nil || args != nil {
+		t.Errorf(`ParseScanCmd("") = %v, %v; want no scanning`, args, err)
+	}
+	if args, err := ParseScanCmd("go vet"); err != nil || !slices.Equal(args, []string{"go", "vet", ScanPathPlaceholder}) {
+		t.Errorf("ParseScanCmd without {path} = %v, %v; want the path appended", args, err)
+	}
+	if args, err := ParseScanCmd("go vet --file={path}"); err != nil || !slices.Equal(args, []string{"go", "vet", "--file={path}"}) {
+		t.Errorf("ParseScanCmd with {path} = %v, %v", args, err)
+	}
+	if _, err := ParseScanCmd("warp-no-such-scanner {path}"); err == nil {
+		t.Error("ParseScanCmd accepted a command that doesn't exist")
+	}
+}
+
+func TestScanMultipartUploads(t *testing.T) {
+	s, ts := scanServer(t)
+	tests := []struct {
+		name   string
+		status int
+		reason string
+	}{
+		{"clean.txt", http.StatusOK, ""},
+		{"infected.txt", http.StatusUnprocessableEntity, "Eicar-Test-Signature FOUND"},
+		{"slow.txt", http.StatusUnprocessableEntity, "scan timed out after 300ms"},
+	}
+	for _, tt := range tests {
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		fw, _ := mw.CreateFormFile("file", tt.name)
+		_, _ = io.WriteString(fw, "payload of "+tt.name)
+		_ = mw.Close()
+		req, _ := http.NewRequest(http.MethodPost, ts.URL+protocol.UploadPathPrefix+s.Token, &body)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var rejection scanRejection
+		if resp.StatusCode == http.StatusUnprocessableEntity {
+			_ = json.NewDecoder(resp.Body).Decode(&rejection)
+		}
+		_ = resp.Body.Close()
+		if resp.StatusCode != tt.status {
+			t.Errorf("%s: status %d, want %d", tt.name, resp.StatusCode, tt.status)
+		}
+		if tt.reason != "" && (rejection.Filename != tt.name || !strings.Contains(rejection.Error, tt.reason) || strings.Contains(rejection.Error, s.UploadDir)) {
+			t.Errorf("%s: rejection %+v, want %q", tt.name, rejection, tt.reason)
+		}
+	}
+
+	if names := uploadedNames(t, s.UploadDir); !slices.Equal(names, []string{"clean.txt"}) {
+		t.Errorf("upload directory holds %v, want only clean.txt and no temporary files", names)
+	}
+	for _, name := range []string{"infected.txt", "slow.txt"} {
+		b, err := os.ReadFile(filepath.Join(s.UploadDir, QuarantineDir, name))
+		if err != nil || string(b) != "payload of "+name {
+			t.Errorf("quarantined %s = %q, %v", name, b, err)
+		}
+	}
+}
+
+func TestScanRawUpload(t *testing.T) {
+	s, ts := scanServer(t)
+	post := func(name string) (int, []byte) {
+		req, _ := http.NewRequest(http.MethodPost, ts.URL+protocol.UploadPathPrefix+s.Token, strings.NewReader("raw "+name))
+		req.Header.Set("X-File-Name", name)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = resp.Body.Close() }()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, body
+	}
+
+	if status, body := post("report.pdf"); status != http.StatusOK || !strings.Contains(string(body), `"filename":"report.pdf"`) {
+		t.Errorf("clean upload: status %d, body %s", status, body)
+	}
+	status, body := post("infected.exe")
+	var rejection scanRejection
+	if err := json.Unmarshal(body, &rejection); err != nil || status != http.StatusUnprocessableEntity || !strings.Contains(rejection.Error, "Eicar-Test-Signature FOUND") {
+		t.Errorf("infected upload: status %d, body %s", status, body)
+	}
+	if names := uploadedNames(t, s.UploadDir); !slices.Equal(names, []string{"report.pdf"}) {
+		t.Errorf("upload directory holds %v, want only report.pdf", names)
+	}
+	if _, err := os.Stat(filepath.Join(s.UploadDir, QuarantineDir, "infected.exe")); err != nil {
+		t.Errorf("infected.exe not quarantined: %v", err)
+	}
+}
+
+func TestScanParallelUpload(t *testing.T) {
+	s, ts := scanServer(t)
+	const session = "scan-session-1"
+	const chunkSize = 64 << 10
+	chunk := bytes.Repeat([]byte{'x'}, chunkSize)
+	sendAs := func(name, session string, id int) int {
+		req, _ := http.NewRequest(http.MethodPost, ts.URL+protocol.UploadPathPrefix+s.Token, bytes.NewReader(chunk))
+		req.Header.Set("X-File-Name", name)
+		req.Header.Set("X-Upload-Session", session)
+		req.Header.Set("X-Upload-Offset", fmt.Sprint(id*chunkSize))
+		req.Header.Set("X-Upload-Total", fmt.Sprint(2*chunkSize))
+		req.Header.Set("X-Chunk-Id", fmt.Sprint(id))
+		req.Header.Set("X-Chunk-Total", "2")
+		req.Header.Set(protocol.ChunkSizeHeader, fmt.Sprint(chunkSize))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = resp.Body.Close()
+		return resp.StatusCode
+	}
+	send := func(id int) int { return sendAs("infected.bin", session, id) }
+
+	if code := send(0); code != http.StatusOK {
+		t.Fatalf("chunk 0: status %d", code)
+	}
+	if code := send(1); code != http.StatusUnprocessableEntity {
+		t.Errorf("last chunk: status %d, want 422 from the scan", code)
+	}
+	// A retry must not turn the rejection into success
+	if code := send(1); code != http.StatusUnprocessableEntity {
+		t.Errorf("retried last chunk: status %d, want 422", code)
+	}
+	resp, err := http.Get(ts.URL + protocol.UploadPathPrefix + s.Token + protocol.SessionPathSegment + session)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusUnprocessableEntity {
+		t.Errorf("session status: %d, want 422", resp.StatusCode)
+	}
+	if names := uploadedNames(t, s.UploadDir); len(names) != 0 {
+		t.Errorf("upload directory holds %v after the scan rejected the file", names)
+	}
+	if fi, err := os.Stat(filepath.Join(s.UploadDir, QuarantineDir, "infected.bin")); err != nil || fi.Size() != 2*chunkSize {
+		t.Errorf("infected.bin not quarantined whole: %v", err)
+	}
+
+	// A clean file is hidden until its scan passes
+	if code := sendAs("clean.bin", "scan-session-2", 0); code != http.StatusOK {
+		t.Fatalf("clean chunk 0: status %d", code)
+	}
+	if names := uploadedNames(t, s.UploadDir); len(names) != 1 || !strings.HasPrefix(names[0], scanTempPrefix) {
+		t.Errorf("upload directory holds %v before the scan, want only a hidden file", names)
+	}
+	if code := sendAs("clean.bin", "scan-session-2", 1); code != http.StatusOK {
+		t.Fatalf("clean last chunk: status %d", code)
+	}
+	if names := uploadedNames(t, s.UploadDir); !slices.Equal(names, []string{"clean.bin"}) {
+		t.Errorf("upload directory holds %v after the scan passed, want [clean.bin]", names)
+	}
+}
+
+func TestScanWorkersBounded(t *testing.T) {
+	s := &Server{ScanWorkers: 1}
+	release, err := s.acquireScan(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := s.acquireScan(ctx); err == nil {
+		t.Fatal("a second scan started while the only worker was busy")
+	}
+	release()
+	next, err := s.acquireScan(context.Background())
+	if err != nil {
+		t.Fatalf("scan slot not given back: %v", err)
+	}
+	next()
+}
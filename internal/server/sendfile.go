@@ -1,25 +1,31 @@
-//go:build linux
-
 package server
 
 import (
 	"errors"
 	"fmt"
-	"github.com/zulfikawr/warp/internal/logging"
-	"github.com/zulfikawr/warp/internal/ui"
-	"go.uber.org/zap"
 	"io"
 	"net"
 	"net/http"
 	"os"
+	"strings"
 	"syscall"
+
+	"github.com/zulfikawr/warp/internal/logging"
+	"github.com/zulfikawr/warp/internal/platform"
+	"go.uber.org/zap"
 )
 
-// sendfileZeroCopy uses the sendfile(2) syscall for zero-copy transfer on Linux
-// This bypasses user-space copying and significantly improves performance for large files
+// headerValueSanitizer strips line breaks so header values can't split the raw response
+var headerValueSanitizer = strings.NewReplacer("\r", " ", "\n", " ")
+
+// sendfileZeroCopy uses the sendfile(2) syscall for zero-copy transfer where
+// the platform has it. This bypasses user-space copying and significantly
+// improves performance for large files; elsewhere it fails before touching
+// the response, so the caller can copy instead.
 func sendfileZeroCopy(w http.ResponseWriter, f *os.File, offset int64, length int64) error {
-	// Get checksum header if it was set
-	checksumHeader := w.Header().Get("X-Content-SHA256")
+	if !platform.Current.HasSendfile {
+		return fmt.Errorf("sendfile not available: %w", errors.ErrUnsupported)
+	}
 
 	// Try to hijack the connection to get the underlying socket
 	hijacker, ok := w.(http.Hijacker)
@@ -41,9 +47,19 @@ func sendfileZeroCopy(w http.ResponseWriter, f *os.File, offset int64, length in
 	}()
 
 	// Write HTTP response headers manually
-	headers := fmt.Sprintf("HTTP/1.1 200 OK\r\nContent-Length: %d\r\nContent-Type: application/octet-stream\r\n", length)
-	if checksumHeader != "" {
-		headers += fmt.Sprintf("X-Content-SHA256: %s\r\n", checksumHeader)
+	// carrying over headers already set on w (checksum, transfer ID, file attributes)
+	contentType := w.Header().Get("Content-Type")
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	headers := fmt.Sprintf("HTTP/1.1 200 OK\r\nContent-Length: %d\r\nContent-Type: %s\r\n", length, headerValueSanitizer.Replace(contentType))
+	for k, vs := range w.Header() {
+		if k == "Content-Length" || k == "Content-Type" {
+			continue
+		}
+		for _, v := range vs {
+			headers += fmt.Sprintf("%s: %s\r\n", k, headerValueSanitizer.Replace(v))
+		}
 	}
 	headers += "\r\n"
 
@@ -69,6 +85,8 @@ func sendfileZeroCopy(w http.ResponseWriter, f *os.File, offset int64, length in
 	var sendErr error
 	var totalSent int64
 
+	// The callback returns false only to wait for the socket to become writable;
+	// returning true ends the write, including on error
 	err = rawConn.Write(func(socketFD uintptr) bool {
 		for totalSent < length {
 			remaining := length - totalSent
@@ -82,21 +100,21 @@ func sendfileZeroCopy(w http.ResponseWriter, f *os.File, offset int64, length in
 			// Calculate offset fresh each iteration to prevent corruption
 			// sendfile modifies the offset pointer, so we must use a local copy
 			useOffset := offset + totalSent
-			n, err := syscall.Sendfile(int(socketFD), int(f.Fd()), &useOffset, int(chunkSize))
+			n, err := platform.Current.Sendfile(socketFD, f, &useOffset, int(chunkSize))
 			if err != nil {
 				if err == syscall.EAGAIN {
-					// Would block, try again
-					continue
+					// Would block, wait until the socket is writable
+					return false
 				}
 				sendErr = err
-				return false
+				return true
 			}
 
 			totalSent += int64(n)
 			if n == 0 && totalSent < length {
 				// EOF before expected length
 				sendErr = io.ErrUnexpectedEOF
-				return false
+				return true
 			}
 		}
 		return true
@@ -111,19 +129,3 @@ func sendfileZeroCopy(w http.ResponseWriter, f *os.File, offset int64, length in
 
 	return nil
 }
-
-// checkDiskSpace verifies sufficient disk space is available before upload (Linux-specific)
-func checkDiskSpace(path string, required int64) error {
-	var stat syscall.Statfs_t
-	if err := syscall.Statfs(path, &stat); err != nil {
-		// If we can't check, allow the operation (fail gracefully later)
-		return nil
-	}
-	available := int64(stat.Bavail) * int64(stat.Bsize)
-	// Keep 1GB buffer for system operations
-	if available-required < 1<<30 {
-		return fmt.Errorf("insufficient disk space: need %s, have %s available",
-			ui.FormatBytes(required), ui.FormatBytes(available))
-	}
-	return nil
-}
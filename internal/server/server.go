@@ -13,20 +13,29 @@ import (
 	"fmt"
 	"github.com/zulfikawr/warp/internal/logging"
 	"go.uber.org/zap"
+	"html/template"
 	"math/big"
 	"net"
 	"net/http"
+	"net/netip"
+	"os"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/quic-go/quic-go/http3"
+	"golang.org/x/time/rate"
 
+	"github.com/zulfikawr/warp/internal/archive"
 	"github.com/zulfikawr/warp/internal/crypto"
 	"github.com/zulfikawr/warp/internal/discovery"
+	"github.com/zulfikawr/warp/internal/discovery/broadcast"
 	"github.com/zulfikawr/warp/internal/network"
 	"github.com/zulfikawr/warp/internal/protocol"
+	"github.com/zulfikawr/warp/internal/ui"
 )
 
 // Server represents the HTTP server for file transfer
@@ -34,40 +43,168 @@ type Server struct {
 	InterfaceName string
 	Token         string
 	SrcPath       string
+	SrcFiles      []string // Shared together as one zip; SrcPath is then their common directory
+	ArchiveName   string   // Download name of the SrcFiles zip; "" = SrcPath's name
+	// Symlinks, hidden files and timestamps of the zip (send --archive-opts)
+	Archive archive.Options
 	// Host mode (reverse drop)
-	HostMode         bool
-	UploadDir        string
-	TextContent      string // If set, serves text instead of file
-	IP               net.IP // Server's IP address (exported for CLI display)
-	Port             int
-	httpServer       *http.Server
-	http3Server      *http3.Server
-	advertiser       *discovery.Advertiser
-	chunkTimes       sync.Map           // filename -> *chunkStat
-	uploadSessions   sync.Map           // sessionID -> *uploadSession
-	multiFileDisplay *MultiFileProgress // Tracks multiple file downloads for unified display
+	HostMode          bool
+	UploadDir         string
+	PreserveAttrs     bool // Apply X-File-Mtime/X-File-Mode from CLI uploads to received files
+	AllowAppend       bool // Raw uploads with X-Append: true extend the existing file (host --allow-append)
+	appendMu          sync.Mutex
+	appendLocks       map[string]*pathLock // One append to a file at a time; guarded by appendMu
+	UploadPage        *template.Template   // Upload page (host --page-template); nil = the embedded page
+	MaxFileSize       int64                // Per-file upload limit in host mode; 0 = Limits.MaxTotalSize
+	AllowedExtensions []string             // Accepted upload extensions (".jpg"); empty = any
+	TextContent       string               // If set, serves text instead of file
+	ServeAsText       bool                 // Serve SrcPath as text/plain like TextContent (spooled --stdin)
+	Follow            bool                 // Stream SrcPath as it grows until the client or server stops (send --follow)
+	TempFile          string               // Removed on Shutdown (spooled --stdin)
+	ProgressEndpoint  bool                 // Expose the progress WebSocket in send mode (always on in host mode)
+	Inline            bool                 // Serve previewable files with Content-Disposition: inline
+	Media             bool                 // Serve an M3U playlist of a directory share's audio and video (send --media)
+	AllowReturn       bool                 // Send mode also takes uploads at /u/{token} into UploadDir
+	ReturnDir         string               // Where returned files move on Shutdown; "" leaves them in UploadDir
+	returned          []string             // Final paths of returned files, see Returned
+	completedUploads  sync.Map             // path -> struct{}, uploads finishUpload recorded, for collectReturns
+	IP                net.IP               // Server's IP address (exported for CLI display)
+	Port              int
+	httpServer        *http.Server
+	QUIC              QUICMode // HTTP/3 listener: off, auto (TCP port) or a fixed UDP port
+	quicPort          int      // UDP port HTTP/3 is served on; 0 = not running
+	quicConn          net.PacketConn
+	http3Server       *http3.Server
+	advertiser        *discovery.Advertiser
+	chunkTimes        sync.Map // filename -> *chunkStat
+	uploadSessions    sync.Map // sessionID -> *uploadSession
+	disk              diskReservations
+	statfs            func(dir string) int64 // Free bytes at dir; freeDiskSpace when nil
+	AsyncVerify       bool                   // Finalize answers 202 and verifies in the background
+	SyncPolicy        SyncPolicy             // When uploads are fsynced; "" = SyncNone
+	Preallocation     Preallocation          // How chunked upload files are sized up front; "" = PreallocSparse
+	NoSplice          bool                   // Copy raw uploads through a user-space buffer rather than letting the file splice them from the socket
+	Organize          Organize               // Subdirectory uploads land in; "" = OrganizeNone
+	DirMode           os.FileMode            // Mode of directories created for uploads; 0 = DefaultDirMode
+	verifyJobs        sync.Map               // jobID -> *verifyJob
+	verifySlot        chan struct{}          // Bounds verification to one at a time
+	verifyOnce        sync.Once
+	multiFileDisplay  *MultiFileProgress // Tracks multiple file downloads for unified display
+	displayOnce       sync.Once
+	Renderer          ui.Renderer // Host-mode progress display; chosen for stdout when nil
+	// Upload scanning (--scan-cmd): a finished upload is only kept once the
+	// command, with {path} replaced by the file, exits 0
+	ScanCmd     []string
+	ScanTimeout time.Duration // Per scan; 0 = DefaultScanTimeout
+	ScanWorkers int           // Scans run at once; 0 = runtime.NumCPU()
+	scanSlots   chan struct{}
+	scanOnce    sync.Once
 	// Progress tracking for WebSocket updates
-	activeUploads sync.Map // filename -> *ProgressTracker
+	activeUploads sync.Map // transfer ID -> *ProgressTracker, uploads and downloads
+	legacyUploads sync.Map // Destination path -> legacyUpload between the requests of a legacy chunked upload
+	// Live transfer stats served at /stats
+	startedAt     time.Time
+	bytesSent     atomic.Int64 // Finished downloads
+	bytesReceived atomic.Int64 // Finished uploads
+	recentMu      sync.Mutex
+	recent        []protocol.CompletedTransfer // Newest first
+	// Recent speeds behind the time estimates of /info and the upload page
+	downloadRate throughput
+	uploadRate   throughput
+	// Download activity shown on the sender console and in /health
+	fullDownloads    atomic.Int64 // Whole-file downloads served to the end
+	partialDownloads atomic.Int64 // Downloads pieced together from several requests
+	lastAccess       atomic.Int64 // Unix nanoseconds of the latest download request; 0 = none yet
+	// Downloads being pieced together from Range requests, per client
+	rangeDownloads rangeDownloads
+	// Lifecycle events for embedders, see Events
+	events eventBus
+	// OnUpload, if set, is called with the TransferCompleted event of every
+	// saved upload, from the request that saved it. Unlike Events it never
+	// misses one, so it must hand slow work off rather than block.
+	OnUpload func(Event)
+	// Upload bounds: chunk count and size, upload size and how long an idle
+	// session lives. Zero fields take protocol.DefaultLimits.
+	Limits protocol.Limits
+	// Concurrency limit (exported for CLI configuration)
+	MaxTransfers    int // 0 = unlimited
+	transferSlots   chan struct{}
+	slotsOnce       sync.Once
+	transferStatsMu sync.Mutex
+	transferAvg     time.Duration // moving average, drives Retry-After
 	// Rate limiting (exported for CLI configuration)
 	RateLimitMbps float64  // 0 = no limit
 	rateLimiters  sync.Map // clientIP -> *rateLimiterEntry
-	// Checksum caching for performance
-	checksumCache sync.Map // filepath -> *checksumCacheEntry
+	shortLimiters sync.Map // clientIP -> *rateLimiterEntry, for /s/ lookups
+	// Per-IP transfer quota (--quota-per-ip): bytes a client may move each
+	// QuotaReset before further transfers get 429. Usage is counted either way.
+	QuotaPerIP int64         // 0 = no quota
+	QuotaReset time.Duration // 0 = DefaultQuotaReset
+	ipUsage    sync.Map      // clientIP -> *ipUsage
+	quotaMu    sync.Mutex
+	quotaStart time.Time // Start of the current quota period
+	// Checksum caching for performance. A checksum taken within
+	// MtimeGranularity of the file's mtime is taken again on use, since a
+	// write in the same mtime step wouldn't show (send --mtime-granularity).
+	checksumCache    sync.Map      // filepath -> *checksumCacheEntry
+	MtimeGranularity time.Duration // 0 = DefaultMtimeGranularity
+	compressionCache sync.Map      // filepath -> *compressionCacheEntry
+	// Leaves brotli out of Content-Encoding negotiation, for CPUs too weak
+	// to encode it at link speed; browsers then get gzip
+	NoBrotli bool
 	// File caching (exported for CLI configuration)
 	MaxCacheSize int64 // max cache size in bytes (default 100MB)
+	// Small devices: 64KB buffers, no compression, one upload worker and
+	// slower progress updates
+	LowMemory bool
+	// HTTP Basic auth on token paths, independent of the encryption Password
+	BasicAuthUser     string
+	BasicAuthPassword string
 	// Encryption (exported for CLI configuration)
 	Password       string // If set, enables encryption
 	EncryptionSalt []byte // Salt for key derivation
 	// PAKE (Password-Authenticated Key Exchange)
-	PAKECode     string
-	pakeSessions sync.Map // sessionID -> *pakeSession
-	pakeAttempts sync.Map // clientIP -> int
-	tokenKeys    sync.Map // token -> []byte (shared key)
+	PAKECode string
+	// Relay is the host:port of a warp relay the share is also served
+	// through (send --relay), in the room of RelayNameplate, which receivers
+	// type in front of PAKECode (see relay.Code)
+	Relay          string
+	RelayNameplate string
+	relayServer    atomic.Pointer[http.Server]
+	relayConns     atomic.Uint64 // Numbers relayed connections for pakePeer
+	relayGuesses   *rate.Limiter // Failed relayed handshakes; set by ServeRelay
+	pakeSessions   sync.Map      // sessionID -> *pakeSession
+	pakeAttempts   sync.Map      // clientIP -> int
+	pakePending    sync.Map      // clientIP -> int, sessions between init and verify
+	tokenKeys      sync.Map      // token -> []byte (shared key)
+	// Access control (exported for CLI configuration)
+	AllowIPs   []netip.Prefix // If set, only these clients are served
+	DenyIPs    []netip.Prefix // Always refused, even when also allowed
+	TrustProxy bool           // Take the client IP from X-Forwarded-For/X-Real-IP, whoever sends them
+	// Take the client IP from those headers only when the connection comes
+	// from one of these proxies; wins over TrustProxy
+	TrustedProxies []netip.Prefix
+	// Remote stop (POST /d/{token}/stop); generated at Start if empty
+	ManagementSecret string
+	// Short alias (--short): /s/{alias} leads to the share; generated at Start
+	ShortAlias bool
+	tokens     tokenRoutes
+	// Discovery (exported for CLI configuration)
+	Discovery     discovery.Mode // mDNS, broadcast probes or both; "" = mDNS
+	DiscoveryPort int            // UDP port answering broadcast probes; 0 = broadcast.DefaultPort
+	responder     *broadcast.Responder
 	// Graceful shutdown support
 	shutdownCtx    context.Context
 	shutdownCancel context.CancelFunc
+	shutdownOnce   sync.Once
+	shutdownErr    error
 	// Self-signed certificate for QUIC/HTTP3
 	tlsCert *tls.Certificate
+	// Test hook run after download headers are set, before the body is copied
+	beforeBody func()
+	// Clock behind --organize date, PAKE session expiry and quota periods;
+	// time.Now when nil
+	clock func() time.Time
 }
 
 type pakeSession struct {
@@ -75,7 +212,8 @@ type pakeSession struct {
 	Key           []byte
 	ClientMessage []byte
 	ServerMessage []byte
-	Expiry        time.Time
+	Started       time.Time // s.now at init, for pakeSessionTTL
+	ClientIP      string    // Whose maxPendingPAKE slot the session holds; see pakePeer
 }
 
 // Start initializes and starts the HTTP server
@@ -85,27 +223,9 @@ func (s *Server) Start() (string, error) {
 		return "", fmt.Errorf("failed to discover LAN IP: %w", err)
 	}
 	s.IP = ip
+	s.startedAt = time.Now()
 
-	mux := http.NewServeMux()
-	// Health endpoint for realtime status checks
-	mux.HandleFunc("/health", s.handleHealth)
-	// Prometheus metrics endpoint
-	mux.Handle("/metrics", promhttp.Handler())
-	// WebSocket endpoint for real-time progress updates
-	mux.HandleFunc("/ws/progress", s.handleProgressWebSocket)
-	// Encryption info endpoint (returns salt if encryption is enabled)
-	mux.HandleFunc("/d/encrypt-info", s.handleEncryptInfo)
-	// Speed test endpoints for network performance testing
-	mux.HandleFunc("/speedtest/download", s.handleSpeedTestDownload)
-	mux.HandleFunc("/speedtest/upload", s.handleSpeedTestUpload)
-	// PAKE endpoints
-	mux.HandleFunc(protocol.PAKEInitPath, s.handlePAKEInit)
-	mux.HandleFunc(protocol.PAKEVerifyPath, s.handlePAKEVerify)
-	if s.HostMode {
-		mux.HandleFunc(protocol.UploadPathPrefix, s.handleUpload)
-	} else {
-		mux.HandleFunc(protocol.PathPrefix, s.handleDownload)
-	}
+	mux := s.routes()
 
 	s.httpServer = &http.Server{
 		ReadTimeout:       0, // unlimited body time; rely on IdleTimeout
@@ -143,52 +263,58 @@ func (s *Server) Start() (string, error) {
 	_, _ = fmt.Sscanf(portStr, "%d", &port)
 	s.Port = port
 
+	// Management secret guards the remote stop endpoint; it is never the share token
+	if s.ManagementSecret == "" {
+		secret, err := crypto.GenerateTokenSize(nil, crypto.MinTokenBytes)
+		if err != nil {
+			_ = optimizedListener.Close()
+			return "", fmt.Errorf("failed to generate management secret: %w", err)
+		}
+		s.ManagementSecret = secret
+	}
+	if s.ShortAlias && s.shortAlias() == "" {
+		if _, err := s.addShortAlias(nil); err != nil {
+			_ = optimizedListener.Close()
+			return "", fmt.Errorf("failed to generate short alias: %w", err)
+		}
+	}
+
 	// Initialize shutdown context for graceful termination of background goroutines
 	s.shutdownCtx, s.shutdownCancel = context.WithCancel(context.Background())
 
+	// HTTP/3 comes up first so a --quic port that is taken fails Start
+	if err := s.startQUIC(ip, s.Port, mux); err != nil {
+		_ = optimizedListener.Close()
+		return "", err
+	}
+
+	if err := s.startRelay(); err != nil {
+		s.stopQUIC()
+		_ = optimizedListener.Close()
+		return "", err
+	}
+
 	// Start TCP server
 	go func() {
 		_ = s.httpServer.Serve(optimizedListener)
 	}()
 
-	// Set up QUIC/HTTP3 server on the same port
-	// HTTP/3 uses UDP, quic-go will handle the listener setup
-	quicAddr := fmt.Sprintf("%s:%d", ip.String(), s.Port)
-
-	// Create TLS config for QUIC
-	tlsConfig, err := s.getQuicTLSConfig()
-	if err != nil {
-		logging.Warn("Failed to create TLS config for QUIC", zap.Error(err))
-	} else {
-		// Set up HTTP/3 server
-		s.http3Server = &http3.Server{
-			Handler:   mux,
-			Addr:      quicAddr,
-			TLSConfig: tlsConfig,
-		}
-
-		// Start QUIC server in background
-		go func() {
-			if err := s.http3Server.ListenAndServe(); err != nil &&
-				err.Error() != "quic: Server closed" &&
-				err.Error() != "http3: Server closed" &&
-				err.Error() != "http: Server closed" {
-				logging.Warn("QUIC server error", zap.Error(err))
-			}
-		}()
-
-		logging.Info("QUIC/HTTP3 listener started successfully", zap.String("addr", quicAddr))
-	}
-
 	// Start session cleanup routine with proper shutdown support
 	go func() {
 		ticker := time.NewTicker(SessionCleanupInterval)
 		defer ticker.Stop()
+		// Unverified handshakes hold key material, so they go sooner
+		pakeTicker := time.NewTicker(pakeSessionTTL)
+		defer pakeTicker.Stop()
 
 		for {
 			select {
 			case <-ticker.C:
 				s.cleanupStaleSessions()
+				s.cleanupVerifyJobs()
+				s.cleanupRangeDownloads()
+			case <-pakeTicker.C:
+				s.cleanupPAKESessions()
 			case <-s.shutdownCtx.Done():
 				logging.Info("Stopping session cleanup goroutine")
 				return
@@ -212,7 +338,7 @@ func (s *Server) Start() (string, error) {
 		}
 	}()
 
-	// Advertise via mDNS for discovery (best-effort)
+	// Advertise via mDNS and/or broadcast probes for discovery (best-effort)
 	mode := "send"
 	path := protocol.PathPrefix + s.Token
 	if s.HostMode {
@@ -220,11 +346,27 @@ func (s *Server) Start() (string, error) {
 		path = protocol.UploadPathPrefix + s.Token
 	}
 	instance := fmt.Sprintf("warp-%s", s.Token[:6])
-	adv, err := discovery.Advertise(instance, mode, s.Token, path, s.IP, s.Port)
-	if err != nil {
-		logging.Warn("mDNS advertise failed", zap.Error(err))
-	} else {
-		s.advertiser = adv
+	if s.Discovery.UsesMDNS() {
+		adv, err := discovery.Advertise(instance, mode, s.Token, path, s.IP, s.Port, s.quicPort)
+		if err != nil {
+			logging.Warn("mDNS advertise failed", zap.Error(err))
+		} else {
+			s.advertiser = adv
+		}
+	}
+	if s.Discovery.UsesBroadcast() {
+		port := s.DiscoveryPort
+		if port == 0 {
+			port = broadcast.DefaultPort
+		}
+		resp, err := broadcast.Listen(fmt.Sprintf(":%d", port), broadcast.Announcement{
+			Name: instance, Mode: mode, Token: s.Token, Path: path, IP: s.IP.String(), Port: s.Port,
+		})
+		if err != nil {
+			logging.Warn("Broadcast discovery listen failed", zap.Int("port", port), zap.Error(err))
+		} else {
+			s.responder = resp
+		}
 	}
 
 	if s.HostMode {
@@ -233,33 +375,116 @@ func (s *Server) Start() (string, error) {
 	return fmt.Sprintf("http://%s:%d%s%s", ip.String(), s.Port, protocol.PathPrefix, s.Token), nil
 }
 
-// handleHealth returns a simple JSON payload indicating the server is alive
+// routes builds the request multiplexer for the current server mode. Shared
+// behavior comes from the middleware in middleware.go, outermost first.
+func (s *Server) routes() http.Handler {
+	get, post := requireMethod(http.MethodGet), requireMethod(http.MethodPost)
+	share := s.requireToken(shareToken)
+	stats := chain(s.handleStats, get, cacheControl(noCacheControl), jsonResponse)
+
+	mux := http.NewServeMux()
+	// Health endpoint for realtime status checks, never cached
+	mux.HandleFunc(protocol.HealthPath, chain(s.handleHealth, noCache, jsonResponse))
+	// Requests browsers and crawlers make on their own
+	mux.HandleFunc("/favicon.ico", s.handleFavicon)
+	mux.HandleFunc("/robots.txt", s.handleRobots)
+	mux.HandleFunc("/.well-known/", s.handleWellKnown)
+	// Prometheus metrics endpoint; serves OpenMetrics to scrapers that ask for it
+	mux.Handle("/metrics", promhttp.InstrumentMetricHandler(prometheus.DefaultRegisterer,
+		promhttp.HandlerFor(prometheus.DefaultGatherer, promhttp.HandlerOpts{EnableOpenMetrics: true})))
+	// WebSocket endpoint for real-time progress updates. Only registered when
+	// someone is expected to watch it: the upload page in host mode, or an
+	// explicit opt-in for send mode.
+	if s.HostMode || s.AllowReturn || s.ProgressEndpoint {
+		mux.HandleFunc(protocol.ProgressPathPrefix, chain(s.handleProgressWebSocket, s.requireBasicAuth, s.requireToken(progressToken)))
+	}
+	// Encryption info endpoint (returns salt if encryption is enabled)
+	mux.HandleFunc(protocol.EncryptInfoPath, chain(s.handleEncryptInfo, s.requireBasicAuth, get, noCache, jsonResponse))
+	// Speed test endpoints for network performance testing
+	mux.HandleFunc("/speedtest/download", chain(s.handleSpeedTestDownload, get))
+	mux.HandleFunc("/speedtest/upload", chain(s.handleSpeedTestUpload, post))
+	// PAKE endpoints
+	mux.HandleFunc(protocol.PAKEInitPath, s.handlePAKEInit)
+	mux.HandleFunc(protocol.PAKEVerifyPath, s.handlePAKEVerify)
+	// Send mode with AllowReturn serves both under the same token
+	if s.HostMode || s.AllowReturn {
+		uploads := shareRoutes{
+			share: chain(s.handleUpload, requireMethod(http.MethodGet, http.MethodPost)),
+			exact: map[string]http.HandlerFunc{
+				protocol.ManifestPathSuffix: chain(s.handleManifest, get),
+				protocol.StopPathSuffix:     chain(s.handleStop, post),
+				protocol.StatsPathSuffix:    stats,
+				protocol.FinalizePathSuffix: chain(s.handleFinalize, post),
+			},
+			segments: map[string]http.HandlerFunc{
+				protocol.VerifyPathSegment:  chain(s.handleVerifyStatus, get),
+				protocol.SessionPathSegment: chain(s.handleSessionStatus, get),
+			},
+			put: s.handlePut,
+		}
+		mux.HandleFunc(protocol.UploadPathPrefix, chain(uploads.serve, s.requireBasicAuth, share))
+	}
+	if !s.HostMode {
+		downloads := shareRoutes{
+			share: s.handleDownload,
+			exact: map[string]http.HandlerFunc{
+				protocol.StopPathSuffix:     chain(s.handleStop, post),
+				protocol.InfoPathSuffix:     chain(s.handleInfo, get),
+				protocol.StatsPathSuffix:    stats,
+				protocol.ListPathSuffix:     chain(s.handleList, get),
+				protocol.FilePathSuffix:     chain(s.handleShareFile, get),
+				protocol.PlaylistPathSuffix: chain(s.handlePlaylist, requireMethod(http.MethodGet, http.MethodHead)),
+			},
+		}
+		mux.HandleFunc(protocol.PathPrefix, chain(downloads.serve, activeDownload, s.requireBasicAuth, share))
+	}
+	if s.ShortAlias {
+		// Every lookup, right or wrong, counts against the client's limiter so
+		// aliases can't be enumerated
+		mux.HandleFunc(protocol.ShortPathPrefix, chain(s.handleShortAlias, s.requireBasicAuth,
+			s.clientIPRateLimit("Short alias lookups", s.shortLimiter, shortAliasInterval)))
+	}
+	return s.advertiseQUIC(s.filterIPs(mux))
+}
+
+// handleHealth reports that the server is alive, with its mode, version and
+// clock for warp ping
 func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json; charset=utf-8")
-	// Prevent caching to ensure fresh status on each request
-	w.Header().Set("Cache-Control", "no-store, no-cache, must-revalidate, max-age=0")
-	w.Header().Set("Pragma", "no-cache")
-	w.Header().Set("Expires", "0")
-	resp := map[string]interface{}{
-		"status": "ok",
+	mode := "send"
+	if s.HostMode {
+		mode = "host"
 	}
-	_ = json.NewEncoder(w).Encode(resp)
+	health := protocol.Health{
+		Status:    "ok",
+		Version:   protocol.Version,
+		Mode:      mode,
+		Time:      time.Now().UTC(),
+		Encrypted: s.Password != "",
+		PAKE:      s.PAKECode != "",
+		Reserved:  s.ReservedBytes(),
+	}
+	for _, n := range s.Usage() {
+		health.UsageTotal += n
+	}
+	if s.QuotaPerIP > 0 {
+		reset := s.rollQuotaPeriod().UTC()
+		health.Quota, health.QuotaReset = s.QuotaPerIP, &reset
+	}
+	activity := s.DownloadActivity()
+	health.Downloads, health.PartialDownloads = activity.Full, activity.Partial
+	if !activity.LastAccess.IsZero() {
+		last := activity.LastAccess.UTC()
+		health.LastAccess = &last
+	}
+	_ = json.NewEncoder(w).Encode(health)
 }
 
 // handleEncryptInfo provides encryption metadata for clients
 func (s *Server) handleEncryptInfo(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
-	w.Header().Set("Content-Type", "application/json; charset=utf-8")
-	w.Header().Set("Cache-Control", "no-store, no-cache, must-revalidate, max-age=0")
-	w.Header().Set("Pragma", "no-cache")
-	w.Header().Set("Expires", "0")
-
+	// Downloads are encrypted once a receiver agreed a key over PAKE
+	_, agreed := s.tokenKeys.Load(s.Token)
 	resp := map[string]interface{}{
-		"encrypted": s.Password != "",
+		"encrypted": s.Password != "" || agreed,
 	}
 
 	if s.Password != "" && len(s.EncryptionSalt) > 0 {
@@ -269,53 +494,64 @@ func (s *Server) handleEncryptInfo(w http.ResponseWriter, r *http.Request) {
 	_ = json.NewEncoder(w).Encode(resp)
 }
 
-// handleManifest advertises upload parameters (chunk size, max concurrency)
-func (s *Server) handleManifest(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-	w.Header().Set("Content-Type", "application/json; charset=utf-8")
-	w.Header().Set("Cache-Control", "no-store, no-cache, must-revalidate, max-age=0")
-	w.Header().Set("Pragma", "no-cache")
-	w.Header().Set("Expires", "0")
-	resp := map[string]interface{}{
-		"chunk_size":     2 * 1024 * 1024, // 2MB default chunk size
-		"max_concurrent": 3,               // parallel workers hint
+// Shutdown stops the server gracefully. It is safe to call more than once
+// (e.g. from the CLI after a remote stop already shut the server down).
+func (s *Server) Shutdown() error {
+	s.shutdownOnce.Do(func() { s.shutdownErr = s.shutdown() })
+	return s.shutdownErr
+}
+
+// Done returns a channel that is closed once the server begins shutting down,
+// including shutdowns triggered through the stop endpoint
+func (s *Server) Done() <-chan struct{} {
+	if s.shutdownCtx == nil {
+		return nil
 	}
-	_ = json.NewEncoder(w).Encode(resp)
+	return s.shutdownCtx.Done()
 }
 
-// Shutdown stops the server gracefully
-func (s *Server) Shutdown() error {
+func (s *Server) shutdown() error {
 	// Cancel shutdown context to stop background goroutines
 	if s.shutdownCancel != nil {
 		s.shutdownCancel()
 	}
+	defer s.removeTempFile()
+	defer s.events.close()
+	// Runs once uploads have drained, so returned files are complete
+	defer s.collectReturns()
 
 	if s.advertiser != nil {
 		s.advertiser.Close()
 	}
+	s.responder.Close()
 
-	// Close HTTP/3 server if it exists
-	if s.http3Server != nil {
-		if err := s.http3Server.Close(); err != nil {
-			logging.Warn("Error closing HTTP/3 server", zap.Error(err))
-		}
-	}
+	s.stopQUIC()
 
+	// Use context with timeout for graceful HTTP server shutdown
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if srv := s.relayServer.Load(); srv != nil {
+		_ = srv.Shutdown(ctx)
+	}
 	if s.httpServer == nil {
 		return nil
 	}
 
-	// Use context with timeout for graceful HTTP server shutdown
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
 	return s.httpServer.Shutdown(ctx)
 }
 
+// The QUIC certificate's NotBefore is moved certBackdate into the past to
+// tolerate clock skew: a client whose clock runs behind the host's, as on
+// devices without a real-time clock, doesn't find it not yet valid. It lasts
+// certLifetime so long-running hosts outlive a day.
+const (
+	certBackdate = time.Hour
+	certLifetime = 7 * 24 * time.Hour
+)
+
 // generateSelfSignedCert creates a self-signed certificate for QUIC/HTTP3
 func (s *Server) generateSelfSignedCert() (*tls.Certificate, error) {
+	now := time.Now()
 	// Generate ECDSA private key (more efficient for QUIC)
 	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
 	if err != nil {
@@ -335,12 +571,17 @@ func (s *Server) generateSelfSignedCert() (*tls.Certificate, error) {
 			Organization:       []string{"warp"},
 			OrganizationalUnit: []string{"local"},
 		},
-		NotBefore:   time.Now(),
-		NotAfter:    time.Now().Add(24 * time.Hour), // Valid for 24 hours
+		NotBefore:   now.Add(-certBackdate),
+		NotAfter:    now.Add(certLifetime),
 		KeyUsage:    x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature,
 		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
-		DNSNames:    []string{s.IP.String(), "localhost", "127.0.0.1"},
-		IPAddresses: []net.IP{s.IP, net.ParseIP("127.0.0.1")},
+		DNSNames:    []string{"localhost", "127.0.0.1"},
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	// Embedders serving only through a relay have no LAN address
+	if s.IP != nil {
+		template.DNSNames = append([]string{s.IP.String()}, template.DNSNames...)
+		template.IPAddresses = append([]net.IP{s.IP}, template.IPAddresses...)
 	}
 
 	// Self-sign the certificate
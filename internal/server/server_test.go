@@ -1,16 +1,28 @@
 package server
 
 import (
+	"bufio"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
+	"unicode/utf8"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
 
 	"github.com/zulfikawr/warp/internal/crypto"
+	"github.com/zulfikawr/warp/internal/logging"
 	"github.com/zulfikawr/warp/internal/protocol"
-	"github.com/zulfikawr/warp/internal/ui"
 )
 
 func TestServerValidAndInvalidToken(t *testing.T) {
@@ -81,6 +93,72 @@ func TestServerHealthEndpoint(t *testing.T) {
 	}
 }
 
+func TestHealthPayload(t *testing.T) {
+	tests := []struct {
+		name string
+		s    *Server
+		want protocol.Health
+	}{
+		{"send", &Server{}, protocol.Health{Mode: "send"}},
+		{"send with PAKE and password", &Server{PAKECode: "7-apple-velocity", Password: "secret"}, protocol.Health{Mode: "send", Encrypted: true, PAKE: true}},
+		{"host", &Server{HostMode: true}, protocol.Health{Mode: "host"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.s.Token, _ = crypto.GenerateToken(nil)
+			ts := httptest.NewServer(tt.s.routes())
+			defer ts.Close()
+
+			before := time.Now()
+			resp, err := http.Get(ts.URL + protocol.HealthPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() { _ = resp.Body.Close() }()
+			var h protocol.Health
+			if err := json.NewDecoder(resp.Body).Decode(&h); err != nil {
+				t.Fatal(err)
+			}
+			if h.Status != "ok" || h.Version != protocol.Version || h.Mode != tt.want.Mode || h.Encrypted != tt.want.Encrypted || h.PAKE != tt.want.PAKE {
+				t.Errorf("health = %+v, want mode %s, encrypted %v, pake %v", h, tt.want.Mode, tt.want.Encrypted, tt.want.PAKE)
+			}
+			if h.Time.Before(before.Add(-time.Second)) || h.Time.After(time.Now().Add(time.Second)) {
+				t.Errorf("server time %s is not the current time", h.Time)
+			}
+		})
+	}
+}
+
+func TestEncryptInfoAfterPAKE(t *testing.T) {
+	s := &Server{PAKECode: "7-apple-velocity"}
+	s.Token, _ = crypto.GenerateToken(nil)
+	ts := httptest.NewServer(s.routes())
+	defer ts.Close()
+
+	encrypted := func() bool {
+		t.Helper()
+		resp, err := http.Get(ts.URL + protocol.EncryptInfoPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = resp.Body.Close() }()
+		var info struct {
+			Encrypted bool `json:"encrypted"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+			t.Fatal(err)
+		}
+		return info.Encrypted
+	}
+	if encrypted() {
+		t.Fatal("encrypted before any key was agreed")
+	}
+	s.tokenKeys.Store(s.Token, make([]byte, 32))
+	if !encrypted() {
+		t.Fatal("not encrypted after a key was agreed over PAKE")
+	}
+}
+
 func TestServerMetricsEndpoint(t *testing.T) {
 	tmpFile, err := os.CreateTemp("", "warp-test")
 	if err != nil {
@@ -151,26 +229,6 @@ func TestHostMode(t *testing.T) {
 	}
 }
 
-func TestFormatBytes(t *testing.T) {
-	tests := []struct {
-		bytes int64
-		want  string
-	}{
-		{512, "512 B"},
-		{1024, "1.0 KB"},
-		{1536, "1.5 KB"},
-		{1048576, "1.0 MB"},
-		{1073741824, "1.0 GB"},
-	}
-
-	for _, tt := range tests {
-		got := ui.FormatBytes(tt.bytes)
-		if got != tt.want {
-			t.Errorf("ui.FormatBytes(%d) = %s, want %s", tt.bytes, got, tt.want)
-		}
-	}
-}
-
 func TestSanitizeFilename(t *testing.T) {
 	tests := []struct {
 		input     string
@@ -280,3 +338,355 @@ func TestChunkStat(t *testing.T) {
 		t.Errorf("Second add returned %v, want 150ms", d2)
 	}
 }
+
+func TestProgressWebSocketGating(t *testing.T) {
+	tok, _ := crypto.GenerateToken(nil)
+
+	// Send mode hides the progress endpoint unless explicitly enabled
+	send := httptest.NewServer((&Server{Token: tok, TextContent: "hi"}).routes())
+	defer send.Close()
+	for _, path := range []string{"/ws/progress", "/ws/progress/" + tok} {
+		resp, err := http.Get(send.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = resp.Body.Close()
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("send mode GET %s status = %d, want 404", path, resp.StatusCode)
+		}
+	}
+
+	// Host mode requires the token in the path
+	host := httptest.NewServer((&Server{Token: tok, HostMode: true, UploadDir: t.TempDir()}).routes())
+	defer host.Close()
+	resp, err := http.Get(host.URL + "/ws/progress/wrong")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("host mode wrong token status = %d, want 403", resp.StatusCode)
+	}
+}
+
+func TestCheckProgressOrigin(t *testing.T) {
+	tests := []struct {
+		origin string
+		want   bool
+	}{
+		{"", true},
+		{"http://192.168.1.5:8080", true},
+		{"http://localhost:3000", true},
+		{"http://127.0.0.1:9000", true},
+		{"https://evil.example.com", false},
+		{"null", false},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "http://192.168.1.5:8080/ws/progress/x", nil)
+		if tt.origin != "" {
+			r.Header.Set("Origin", tt.origin)
+		}
+		if got := checkProgressOrigin(r); got != tt.want {
+			t.Errorf("checkProgressOrigin(%q) = %v, want %v", tt.origin, got, tt.want)
+		}
+	}
+}
+
+func TestTransferIDHeaderMatchesLogs(t *testing.T) {
+	core, logs := observer.New(zapcore.InfoLevel)
+	defer logging.ReplaceLogger(zap.New(core))()
+
+	path := filepath.Join(t.TempDir(), "file.bin")
+	if err := os.WriteFile(path, []byte("transfer id payload"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	tok, _ := crypto.GenerateToken(nil)
+	ts := httptest.NewServer((&Server{Token: tok, SrcPath: path}).routes())
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + protocol.PathPrefix + tok)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+
+	id := resp.Header.Get(protocol.TransferIDHeader)
+	if id == "" {
+		t.Fatalf("missing %s header", protocol.TransferIDHeader)
+	}
+	tagged := logs.FilterField(zap.String("transfer_id", id))
+	if tagged.Len() == 0 {
+		t.Fatalf("no log entries tagged with transfer_id %s (got %d entries)", id, logs.Len())
+	}
+	if tagged.Len() != logs.Len() {
+		t.Errorf("%d of %d log entries carry transfer_id", tagged.Len(), logs.Len())
+	}
+}
+
+func TestStopEndpoint(t *testing.T) {
+	tok, _ := crypto.GenerateToken(nil)
+	s := &Server{Token: tok, TextContent: "hello"}
+	url, err := s.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = s.Shutdown() }()
+
+	stop := func(secret string) int {
+		req, _ := http.NewRequest(http.MethodPost, url+protocol.StopPathSuffix, nil)
+		req.Header.Set(protocol.ManagementSecretHeader, secret)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	// The share token is not the management secret
+	if code := stop(tok); code != http.StatusForbidden {
+		t.Fatalf("stop with wrong secret = %d, want 403", code)
+	}
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("server stopped after rejected stop: %v", err)
+	}
+	_ = resp.Body.Close()
+
+	if code := stop(s.ManagementSecret); code != http.StatusOK {
+		t.Fatalf("stop with correct secret = %d, want 200", code)
+	}
+	select {
+	case <-s.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("server did not begin shutdown")
+	}
+
+	// The listener should close shortly after the response was delivered
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		c := &http.Client{Timeout: time.Second, Transport: &http.Transport{DisableKeepAlives: true}}
+		resp, err := c.Get(url)
+		if err != nil {
+			break
+		}
+		_ = resp.Body.Close()
+		if time.Now().After(deadline) {
+			t.Fatal("listener still accepting connections after stop")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func TestClientInfoFrom(t *testing.T) {
+	tests := []struct {
+		ua, version string
+		wantClass   string
+	}{
+		{"warp/1.1.0 (linux; amd64)", "1.1.0", "cli"},
+		{"Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) Safari/604.1", "", "browser"},
+		{"curl/8.5.0", "", "other"},
+		{"", "", "other"},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("User-Agent", tt.ua)
+		if tt.version != "" {
+			r.Header.Set(protocol.VersionHeader, tt.version)
+		}
+		if got := clientInfoFrom(r); got.Class != tt.wantClass {
+			t.Errorf("clientInfoFrom(%q).Class = %s, want %s", tt.ua, got.Class, tt.wantClass)
+		}
+	}
+}
+
+func TestClientInfoFromTruncatesOnRunes(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	// A 199-byte prefix leaves the 200-byte bound inside the two-byte é
+	r.Header.Set("User-Agent", "Mozilla/"+strings.Repeat("a", 191)+strings.Repeat("é", 10))
+	r.Header.Set(protocol.VersionHeader, strings.Repeat("é", 150))
+	info := clientInfoFrom(r)
+	if len(info.UserAgent) != 199 || !utf8.ValidString(info.UserAgent) {
+		t.Errorf("User-Agent cut to %d bytes, valid UTF-8 %v; want 199, true", len(info.UserAgent), utf8.ValidString(info.UserAgent))
+	}
+	if len(info.Version) != maxUserAgentLen || !utf8.ValidString(info.Version) {
+		t.Errorf("version cut to %d bytes, valid UTF-8 %v; want %d, true", len(info.Version), utf8.ValidString(info.Version), maxUserAgentLen)
+	}
+}
+
+func TestTransferLogsClientIdentity(t *testing.T) {
+	core, logs := observer.New(zapcore.InfoLevel)
+	defer logging.ReplaceLogger(zap.New(core))()
+
+	path := filepath.Join(t.TempDir(), "file.bin")
+	if err := os.WriteFile(path, []byte("payload"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	tok, _ := crypto.GenerateToken(nil)
+	ts := httptest.NewServer((&Server{Token: tok, SrcPath: path}).routes())
+	defer ts.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+protocol.PathPrefix+tok, nil)
+	req.Header.Set("User-Agent", protocol.UserAgent())
+	req.Header.Set(protocol.VersionHeader, protocol.Version)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+
+	if logs.FilterField(zap.String("user_agent", protocol.UserAgent())).Len() == 0 {
+		t.Error("no log entries carry the client User-Agent")
+	}
+	if logs.FilterField(zap.String("client_version", protocol.Version)).Len() == 0 {
+		t.Error("no log entries carry the client version")
+	}
+}
+
+func TestMaxTransfersReturnsBusy(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "big.bin")
+	// Random bytes, so the downloads aren't compressed into a few kilobytes
+	// that finish before the slots can be held
+	data := make([]byte, 32<<20)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tok, _ := crypto.GenerateToken(nil)
+	s := &Server{Token: tok, SrcPath: path, MaxTransfers: 2}
+	ts := httptest.NewServer(s.routes())
+	defer ts.Close()
+	url := ts.URL + protocol.PathPrefix + tok
+
+	// Two slow readers hold both slots by never draining their bodies
+	var held []*http.Response
+	for i := 0; i < 2; i++ {
+		resp, err := http.Get(url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("request %d: status %d, want 200", i, resp.StatusCode)
+		}
+		held = append(held, resp)
+	}
+
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("third request: status %d, want 503", resp.StatusCode)
+	}
+	if ra := resp.Header.Get("Retry-After"); ra == "" {
+		t.Error("503 response missing Retry-After")
+	}
+
+	_ = held[0].Body.Close()
+	defer func() { _ = held[1].Body.Close() }()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		resp, err := http.Get(url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = resp.Body.Close()
+		if resp.StatusCode == http.StatusOK {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("slot not released: last status %d", resp.StatusCode)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func TestRawUploadExpectContinue(t *testing.T) {
+	dir := t.TempDir()
+	tok, _ := crypto.GenerateToken(nil)
+	s := &Server{Token: tok, HostMode: true, UploadDir: dir}
+	ts := httptest.NewServer(s.routes())
+	defer ts.Close()
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(ts.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+	_ = conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+	body := strings.Repeat("x", 64<<10)
+	start := time.Now()
+	_, err = fmt.Fprintf(conn, "POST %s%s HTTP/1.1\r\nHost: %s\r\nX-File-Name: expect.bin\r\nContent-Length: %d\r\nExpect: 100-continue\r\n\r\n",
+		protocol.UploadPathPrefix, tok, conn.RemoteAddr(), len(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Like curl, hold the body until the server answers, giving up after 1s
+	br := bufio.NewReader(conn)
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	status, err := br.ReadString('\n')
+	if err != nil {
+		t.Fatalf("no interim response within 1s: %v", err)
+	}
+	if !strings.HasPrefix(status, "HTTP/1.1 100") {
+		t.Fatalf("interim status = %q, want 100 Continue", status)
+	}
+	if blank, _ := br.ReadString('\n'); blank != "\r\n" {
+		t.Fatalf("interim response not terminated: %q", blank)
+	}
+
+	if _, err := io.WriteString(conn, body); err != nil {
+		t.Fatal(err)
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want 200", resp.StatusCode)
+	}
+	if elapsed := time.Since(start); elapsed >= time.Second {
+		t.Errorf("upload took %v; the client stalled waiting for 100 Continue", elapsed)
+	}
+
+	got, err := os.ReadFile(filepath.Join(dir, "expect.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(body) {
+		t.Errorf("saved %d bytes, want %d", len(got), len(body))
+	}
+}
+
+func TestZipProgressWithoutTerminal(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(name), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var progress strings.Builder
+	if err := (&Server{SrcPath: dir}).zipSource(io.Discard, &progress); err != nil {
+		t.Fatal(err)
+	}
+	got := progress.String()
+	if strings.ContainsAny(got, "\r\033") {
+		t.Errorf("zip progress to a non-terminal contains redraws: %q", got)
+	}
+	if want := "\nPreparing 3 files (15 B total)...\n✓ Compressed 3 files (15 B total)\n"; got != want {
+		t.Errorf("zip progress = %q, want %q", got, want)
+	}
+}
@@ -1,12 +1,17 @@
 package server
 
 import (
+	"encoding/json"
 	"fmt"
+	"net/http"
 	"os"
+	"path/filepath"
 	"sync"
 	"time"
 
 	"github.com/zulfikawr/warp/internal/logging"
+	"github.com/zulfikawr/warp/internal/metrics"
+	"github.com/zulfikawr/warp/internal/protocol"
 	"go.uber.org/zap"
 )
 
@@ -16,15 +21,29 @@ type uploadSession struct {
 	Filename      string
 	TotalSize     int64
 	TotalChunks   int
+	ChunkSize     int64 // Fixed by X-Chunk-Size or the first full chunk; 0 until known
 	ChunksWritten map[int]bool
+	BytesWritten  int64 // Bytes of the chunks in ChunksWritten
+	Duplicates    int   // Chunks received again after they were written (client retries)
+	DuplicateSize int64 // Bytes of those duplicate chunks
 	FilePath      string
+	RelPath       string // FilePath relative to UploadDir, as reported to the client
+	heldName      string // Name FilePath gets once it scans clean; "" when written in place or already promoted
+	relDir        string // Directory of RelPath
 	FileHandle    *os.File
 	CreatedAt     time.Time
 	StartTime     time.Time
 	LastActivity  time.Time
 	mu            sync.Mutex
 	complete      bool
-	server        *Server // Reference to server for multi-file progress
+	syncPolicy    SyncPolicy
+	preallocation Preallocation
+	preallocated  chan struct{}    // Closed when a background allocation ends; nil if none started
+	server        *Server          // Reference to server for multi-file progress
+	tracker       *ProgressTracker // Progress reported to the WebSocket and /stats
+	releaseDisk   func()           // Gives back the TotalSize reserved at creation
+	rejected      error            // Why the scan didn't pass the finished file; later requests get it too
+	verify        *verifyJob       // The checksum verification of the first finalize; nil before it
 }
 
 // isComplete checks if all chunks have been received
@@ -34,6 +53,109 @@ func (session *uploadSession) isComplete() bool {
 	return session.complete
 }
 
+// promote gives a held file that scanned clean a free name for the one it
+// was uploaded as; a file written in place is left where it is
+func (session *uploadSession) promote() error {
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	if session.heldName == "" {
+		return nil
+	}
+	outPath, err := promoteUpload(session.FilePath, filepath.Dir(session.FilePath), session.heldName)
+	if err != nil {
+		return err
+	}
+	session.FilePath = outPath
+	session.RelPath = relPath(session.relDir, filepath.Base(outPath))
+	session.heldName = ""
+	return nil
+}
+
+// scanRejected returns why the scan didn't pass the session's file, or nil
+func (session *uploadSession) scanRejected() error {
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	return session.rejected
+}
+
+// checkChunkLayout settles the session's chunk size from declared (the
+// X-Chunk-Size header; 0 if absent) or the first full chunk, then checks that
+// the chunk's offset and length match it, so no chunk can overwrite another's
+// byte range
+func (session *uploadSession) checkChunkLayout(chunkID int, offset, length, declared int64) error {
+	session.mu.Lock()
+	defer session.mu.Unlock()
+
+	size := declared
+	if size == 0 && chunkID < session.TotalChunks-1 {
+		size = length
+	}
+	switch {
+	case session.ChunkSize == 0 && size > 0:
+		if session.TotalSize > 0 && (session.TotalSize+size-1)/size != int64(session.TotalChunks) {
+			return fmt.Errorf("chunk size %d does not split %d bytes into %d chunks", size, session.TotalSize, session.TotalChunks)
+		}
+		session.ChunkSize = size
+	case declared > 0 && declared != session.ChunkSize:
+		return fmt.Errorf("chunk size %d differs from the session's %d", declared, session.ChunkSize)
+	}
+
+	if session.ChunkSize == 0 {
+		// Only the undeclared last chunk so far: all we know is where the file ends
+		if session.TotalSize > 0 && offset+length != session.TotalSize {
+			return fmt.Errorf("last chunk ends at %d, want the file size %d", offset+length, session.TotalSize)
+		}
+		return nil
+	}
+	return protocol.ValidateChunkOffset(chunkID, session.TotalChunks, offset, length, session.ChunkSize, session.TotalSize)
+}
+
+// status snapshots which chunks are committed. Only the copy is made under the
+// lock; callers encode it after it is released.
+func (session *uploadSession) status() protocol.SessionStatus {
+	session.mu.Lock()
+	defer session.mu.Unlock()
+
+	bitmap := make([]byte, (session.TotalChunks+7)/8)
+	for id := range session.ChunksWritten {
+		if id >= 0 && id < session.TotalChunks {
+			bitmap[id/8] |= 1 << (id % 8)
+		}
+	}
+	return protocol.SessionStatus{
+		TotalChunks:    session.TotalChunks,
+		ReceivedChunks: len(session.ChunksWritten),
+		ReceivedBitmap: bitmap,
+		BytesWritten:   session.BytesWritten,
+		Complete:       session.complete,
+	}
+}
+
+// handleSessionStatus serves GET /u/{token}/session/{sessionID}, so clients
+// can tell which chunks landed even when a response was lost
+func (s *Server) handleSessionStatus(w http.ResponseWriter, r *http.Request) {
+	sessionID, _ := subRouteID(shareRest(r), protocol.SessionPathSegment)
+	if err := protocol.ValidateSessionID(sessionID); err != nil {
+		http.Error(w, fmt.Sprintf("invalid session ID: %v", err), http.StatusBadRequest)
+		return
+	}
+	val, ok := s.uploadSessions.Load(sessionID)
+	if !ok {
+		http.Error(w, "unknown upload session", http.StatusNotFound)
+		return
+	}
+	session := val.(*uploadSession)
+	if err := session.scanRejected(); err != nil {
+		writeScanRejection(w, session.RelPath, err)
+		return
+	}
+	status := session.status()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	_ = json.NewEncoder(w).Encode(status)
+}
+
 // chunkStat tracks chunk upload performance
 type chunkStat struct {
 	mu       sync.Mutex
@@ -49,7 +171,7 @@ func (c *chunkStat) add(d time.Duration) time.Duration {
 }
 
 // getOrCreateSession retrieves an existing session or creates a new one
-func (s *Server) getOrCreateSession(sessionID, filename string, totalSize int64, totalChunks int, destDir string) (*uploadSession, error) {
+func (s *Server) getOrCreateSession(sessionID, filename string, totalSize int64, totalChunks int, destDir, relDir string, client clientInfo) (*uploadSession, error) {
 	// Check if session already exists (fast path)
 	if val, ok := s.uploadSessions.Load(sessionID); ok {
 		session := val.(*uploadSession)
@@ -71,59 +193,78 @@ func (s *Server) getOrCreateSession(sessionID, filename string, totalSize int64,
 		CreatedAt:     now,
 		StartTime:     now,
 		LastActivity:  now,
+		syncPolicy:    s.SyncPolicy,
+		preallocation: s.Preallocation,
 		server:        s,
+		tracker:       newProgressTracker(sessionID, filename, protocol.DirectionUpload, totalSize),
 	}
+	session.tracker.ClientIP = client.IP
+	session.tracker.events = &s.events
 
 	sanitized, err := sanitizeFilename(filename)
 	if err != nil {
 		return nil, fmt.Errorf("failed to sanitize filename: %w", err)
 	}
-	outPath := findUniqueFilename(destDir, sanitized)
-	session.FilePath = outPath
+	// Created on demand; with --organize the directory may be new
+	if err := s.mkdirUpload(destDir); err != nil {
+		return nil, fmt.Errorf("failed to create upload directory: %w", err)
+	}
+	// The whole file is reserved up front; chunks aren't checked one by one
+	release, err := s.reserveDisk(destDir, totalSize)
+	if err != nil {
+		return nil, err
+	}
+	session.releaseDisk = release
 
-	f, err := os.OpenFile(outPath, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0o600)
+	var f *os.File
+	session.relDir = relDir
+	if s.scanning() {
+		// Hidden until the finished file scans clean; see promote
+		f, err = scanTemp(destDir, sanitized)
+		session.heldName = sanitized
+		session.RelPath = relPath(relDir, sanitized)
+	} else {
+		outPath := findUniqueFilename(destDir, sanitized)
+		f, err = os.OpenFile(outPath, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0o600)
+		session.RelPath = relPath(relDir, filepath.Base(outPath))
+	}
 	if err != nil {
+		release()
 		return nil, fmt.Errorf("failed to create file: %w", err)
 	}
+	outPath := f.Name()
+	session.FilePath = outPath
 
-	if totalSize > 0 {
-		if err := f.Truncate(totalSize); err != nil {
-			_ = f.Close()
-			return nil, fmt.Errorf("failed to pre-allocate space: %w", err)
-		}
+	if err := session.preallocation.prepare(f, totalSize); err != nil {
+		_ = f.Close()
+		release()
+		return nil, err
 	}
 
 	session.FileHandle = f
 
+	// Register with the display before the session becomes visible, so its
+	// chunk events never arrive ahead of the file; duplicates are ignored
+	s.progressDisplay().send(progressEvent{sessionID: sessionID, at: now, added: &FileProgress{
+		filename:  filename,
+		size:      totalSize,
+		chunks:    totalChunks,
+		startTime: now,
+		client:    client.String(),
+	}})
+
 	// Atomically store the session - if another goroutine created it first, use theirs
 	if actual, loaded := s.uploadSessions.LoadOrStore(sessionID, session); loaded {
 		// Another goroutine created the session first, close our file and use theirs
 		_ = f.Close()
 		_ = os.Remove(outPath)
+		release()
 		return actual.(*uploadSession), nil
 	}
-
-	if s.multiFileDisplay == nil {
-		s.multiFileDisplay = &MultiFileProgress{
-			files:      make(map[string]*FileProgress),
-			fileOrder:  make([]string, 0),
-			startTime:  now,
-			lastUpdate: now,
-		}
-	}
-
-	s.multiFileDisplay.mu.Lock()
-	if _, exists := s.multiFileDisplay.files[sessionID]; !exists {
-		s.multiFileDisplay.files[sessionID] = &FileProgress{
-			filename:  filename,
-			size:      totalSize,
-			startTime: now,
-		}
-		s.multiFileDisplay.fileOrder = append(s.multiFileDisplay.fileOrder, sessionID)
-		// Accumulate total size for overall progress calculation
-		s.multiFileDisplay.totalSize += totalSize
-	}
-	s.multiFileDisplay.mu.Unlock()
+	metrics.TransfersByClient.WithLabelValues(client.Class).Inc()
+	s.activeUploads.Store(sessionID, session.tracker)
+	s.events.publish(session.tracker.event(EventSessionCreated))
+	s.events.publish(session.tracker.event(EventTransferStarted))
 
 	// Session was successfully stored by LoadOrStore above
 	return session, nil
@@ -134,16 +275,26 @@ func (s *Server) cleanupSession(sessionID string) {
 	if val, ok := s.uploadSessions.LoadAndDelete(sessionID); ok {
 		session := val.(*uploadSession)
 		session.mu.Lock()
+		session.waitPreallocation()
 		if session.FileHandle != nil {
 			_ = session.FileHandle.Close()
 		}
+		// A held file that never passed a scan isn't an upload
+		if session.heldName != "" {
+			_ = os.Remove(session.FilePath)
+		}
 		session.mu.Unlock()
+		if session.releaseDisk != nil {
+			session.releaseDisk()
+		}
 	}
+	// No-op when the upload already completed
+	s.finishTransfer(sessionID, false)
 }
 
 // cleanupStaleSessions removes sessions that haven't been active recently
 func (s *Server) cleanupStaleSessions() {
-	staleThreshold := StaleSessionThreshold
+	staleThreshold := s.uploadLimits().MaxSessionIdleTime
 	s.uploadSessions.Range(func(key, value interface{}) bool {
 		session := value.(*uploadSession)
 		session.mu.Lock()
@@ -153,10 +304,18 @@ func (s *Server) cleanupStaleSessions() {
 		if isStale {
 			sessionID := key.(string)
 			logging.Info("Cleaning up stale session", zap.String("session_id", sessionID[:8]))
+			s.events.publish(session.tracker.event(EventSessionExpired))
 			s.cleanupSession(sessionID)
 		}
 		return true
 	})
+	// A legacy chunked upload whose next request never came failed
+	s.legacyUploads.Range(func(key, value interface{}) bool {
+		if u := value.(legacyUpload); time.Since(u.since) > staleThreshold && s.legacyUploads.CompareAndDelete(key, value) {
+			s.finishTransfer(u.pt.ID, false)
+		}
+		return true
+	})
 }
 
 // addChunkDuration adds chunk upload duration for performance tracking
@@ -0,0 +1,120 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/zulfikawr/warp/internal/crypto"
+	"github.com/zulfikawr/warp/internal/protocol"
+	"golang.org/x/time/rate"
+)
+
+// shortAliasLen is the length of a --short alias. Being far easier to guess
+// than the token, it is only served behind shortAliasInterval.
+const shortAliasLen = 6
+
+// shortAliasAlphabet leaves out characters that are easy to misread or
+// mistype from a screen: 0/o, 1/l/i
+const shortAliasAlphabet = "23456789abcdefghjkmnpqrstuvwxyz"
+
+// shortAliasAttempts bounds how often addShortAlias redraws on a collision
+const shortAliasAttempts = 10
+
+// Each client may look up /s/ aliases once per shortAliasInterval, after an
+// initial burst of shortAliasBurst
+const (
+	shortAliasInterval = 6 * time.Second
+	shortAliasBurst    = 5
+)
+
+// shortAliasGenerator draws shortAliasLen characters of shortAliasAlphabet
+// from randReader, crypto/rand when nil, offering each to unique if set
+func shortAliasGenerator(randReader io.Reader, unique func(string) bool) (*crypto.TokenGenerator, error) {
+	return crypto.NewTokenGenerator(crypto.TokenOptions{
+		Length:   shortAliasLen,
+		Alphabet: shortAliasAlphabet,
+		Rand:     randReader,
+		Unique:   unique,
+		Attempts: shortAliasAttempts,
+	})
+}
+
+// generateShortAlias draws a short alias without checking it is free
+func generateShortAlias(randReader io.Reader) (string, error) {
+	g, err := shortAliasGenerator(randReader, nil)
+	if err != nil {
+		return "", err
+	}
+	return g.Generate()
+}
+
+// addShortAlias routes a new short alias to the share token, drawing again
+// when the alias is already taken
+func (s *Server) addShortAlias(randReader io.Reader) (string, error) {
+	g, err := shortAliasGenerator(randReader, func(alias string) bool {
+		return s.tokens.add(alias, s.Token)
+	})
+	if err != nil {
+		return "", err
+	}
+	return g.Generate()
+}
+
+// shortAlias returns the share's short alias, or "" without --short
+func (s *Server) shortAlias() string {
+	return s.tokens.keyFor(s.Token)
+}
+
+// ShortURL returns the /s/ URL of a started server, or "" without --short
+func (s *Server) ShortURL() string {
+	alias := s.shortAlias()
+	if alias == "" || s.IP == nil {
+		return ""
+	}
+	return fmt.Sprintf("http://%s:%d%s%s", s.IP.String(), s.Port, protocol.ShortPathPrefix, alias)
+}
+
+// shortLimiter returns the client's limiter for /s/ lookups
+func (s *Server) shortLimiter(clientIP string) *rate.Limiter {
+	entry := &rateLimiterEntry{
+		limiter:    rate.NewLimiter(rate.Every(shortAliasInterval), shortAliasBurst),
+		lastAccess: time.Now(),
+	}
+	if val, loaded := s.shortLimiters.LoadOrStore(clientIP, entry); loaded {
+		entry = val.(*rateLimiterEntry)
+		entry.lastAccess = time.Now()
+	}
+	return entry.limiter
+}
+
+// handleShortAlias redirects /s/{alias}[/rest] to the share the alias
+// stands for. Lookups are rate limited per client by the route, see routes.
+func (s *Server) handleShortAlias(w http.ResponseWriter, r *http.Request) {
+	alias, rest, _ := strings.Cut(strings.TrimPrefix(r.URL.EscapedPath(), protocol.ShortPathPrefix), "/")
+	token, ok := s.tokens.resolve(alias)
+	if !ok {
+		s.rejectToken(w, r)
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	prefix := protocol.PathPrefix
+	if s.HostMode {
+		prefix = protocol.UploadPathPrefix
+	}
+	target := prefix + token
+	if rest != "" {
+		target += "/" + rest
+	}
+	if r.URL.RawQuery != "" {
+		target += "?" + r.URL.RawQuery
+	}
+	http.Redirect(w, r, target, http.StatusFound)
+}
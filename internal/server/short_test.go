@@ -0,0 +1,164 @@
+package server
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/zulfikawr/warp/internal/crypto"
+)
+
+// noRedirects keeps the client on the /s/ response
+func noRedirects(req *http.Request, via []*http.Request) error {
+	return http.ErrUseLastResponse
+}
+
+func TestGenerateShortAlias(t *testing.T) {
+	// 0xff and 0xf8 would bias the draw and are skipped
+	alias, err := generateShortAlias(bytes.NewReader([]byte{0xff, 0, 1, 0xf8, 30, 31, 40, 2}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if alias != "23z2b4" {
+		t.Errorf("alias = %q, want 23z2b4", alias)
+	}
+
+	alias, err = generateShortAlias(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(alias) != shortAliasLen || strings.Trim(alias, shortAliasAlphabet) != "" {
+		t.Errorf("alias %q isn't %d characters of the alphabet", alias, shortAliasLen)
+	}
+}
+
+func TestAddShortAliasRegeneratesOnCollision(t *testing.T) {
+	s := &Server{Token: "token-b"}
+	s.tokens.add("222222", "token-a")
+
+	// The first draw collides with token-a's alias; the second is free
+	draws := append(bytes.Repeat([]byte{0}, 6), bytes.Repeat([]byte{1}, 6)...)
+	alias, err := s.addShortAlias(bytes.NewReader(draws))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if alias != "333333" {
+		t.Errorf("alias = %q, want 333333", alias)
+	}
+	if tok, _ := s.tokens.resolve("222222"); tok != "token-a" {
+		t.Errorf("existing alias now routes to %q", tok)
+	}
+	if got := s.shortAlias(); got != "333333" {
+		t.Errorf("shortAlias() = %q", got)
+	}
+
+	// Nothing but collisions gives up
+	_, err = s.addShortAlias(bytes.NewReader(bytes.Repeat([]byte{0}, 6*shortAliasAttempts)))
+	if err == nil {
+		t.Error("addShortAlias succeeded with every draw taken")
+	}
+}
+
+func TestShortAliasRedirects(t *testing.T) {
+	tok, _ := crypto.GenerateToken(nil)
+	send := &Server{Token: tok, ShortAlias: true}
+	sendAlias, _ := send.addShortAlias(nil)
+	host := &Server{Token: tok, ShortAlias: true, HostMode: true, UploadDir: t.TempDir()}
+	hostAlias, _ := host.addShortAlias(nil)
+
+	tests := []struct {
+		name     string
+		srv      *Server
+		method   string
+		path     string
+		want     int
+		location string
+	}{
+		{"download", send, http.MethodGet, "/s/" + sendAlias, http.StatusFound, "/d/" + tok},
+		{"sub-route and query", send, http.MethodGet, "/s/" + sendAlias + "/info?x=1", http.StatusFound, "/d/" + tok + "/info?x=1"},
+		{"head", send, http.MethodHead, "/s/" + sendAlias, http.StatusFound, "/d/" + tok},
+		{"upload page", host, http.MethodGet, "/s/" + hostAlias, http.StatusFound, "/u/" + tok},
+		{"post", send, http.MethodPost, "/s/" + sendAlias, http.StatusMethodNotAllowed, ""},
+		{"unknown alias", send, http.MethodGet, "/s/zzzzzz", http.StatusForbidden, ""},
+		{"the token itself", send, http.MethodGet, "/s/" + tok, http.StatusForbidden, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.path, nil)
+			w := httptest.NewRecorder()
+			tt.srv.routes().ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+			if loc := w.Header().Get("Location"); loc != tt.location {
+				t.Errorf("Location = %q, want %q", loc, tt.location)
+			}
+			// Each subtest is its own client as far as the limiter goes
+			tt.srv.shortLimiters.Clear()
+		})
+	}
+}
+
+func TestShortAliasDisabledByDefault(t *testing.T) {
+	tok, _ := crypto.GenerateToken(nil)
+	s := &Server{Token: tok}
+	ts := httptest.NewServer(s.routes())
+	defer ts.Close()
+
+	resp, err := (&http.Client{CheckRedirect: noRedirects}).Get(ts.URL + "/s/abcdef")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode == http.StatusFound {
+		t.Error("/s/ redirected without --short")
+	}
+	if s.ShortURL() != "" {
+		t.Errorf("ShortURL() = %q without --short", s.ShortURL())
+	}
+}
+
+func TestShortAliasRateLimit(t *testing.T) {
+	tok, _ := crypto.GenerateToken(nil)
+	s := &Server{Token: tok, ShortAlias: true}
+	alias, _ := s.addShortAlias(nil)
+	ts := httptest.NewServer(s.routes())
+	defer ts.Close()
+	client := &http.Client{CheckRedirect: noRedirects}
+
+	get := func(path string) *http.Response {
+		t.Helper()
+		resp, err := client.Get(ts.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = resp.Body.Close()
+		return resp
+	}
+
+	// Wrong guesses use up the burst as much as right ones
+	for i := range shortAliasBurst {
+		if resp := get("/s/wrong" + string(shortAliasAlphabet[i])); resp.StatusCode != http.StatusForbidden {
+			t.Fatalf("guess %d: status %d, want 403", i, resp.StatusCode)
+		}
+	}
+	resp := get("/s/" + alias)
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("status = %d after the burst, want 429", resp.StatusCode)
+	}
+	if resp.Header.Get("Retry-After") == "" {
+		t.Error("429 response missing Retry-After")
+	}
+
+	// The full token path isn't held to the stricter limit
+	if resp := get("/d/" + tok + "/info"); resp.StatusCode == http.StatusTooManyRequests {
+		t.Error("/d/ limited along with /s/")
+	}
+
+	// Another client has its own allowance
+	if !s.shortLimiter("192.0.2.9").Allow() {
+		t.Error("second client limited by the first")
+	}
+}
@@ -0,0 +1,95 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"go.uber.org/zap"
+
+	"github.com/zulfikawr/warp/internal/metrics"
+)
+
+// errSourceChanged means the file being served no longer matches the snapshot
+// its headers were built from
+var errSourceChanged = errors.New("source file changed during transfer")
+
+// sourceChanged re-stats path and reports whether it was removed or its size
+// or modification time moved away from before
+func sourceChanged(path string, before os.FileInfo) bool {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return true
+	}
+	return fi.Size() != before.Size() || !fi.ModTime().Equal(before.ModTime())
+}
+
+// checksumFor returns the cached checksum of the source, but only when it was
+// recorded for the same size and modification time as fi, the snapshot whose
+// Content-Length is being served
+func (s *Server) checksumFor(fi os.FileInfo) (string, error) {
+	checksum, err := s.getCachedChecksum(s.SrcPath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return "", errSourceChanged
+		}
+		return "", err
+	}
+	val, ok := s.checksumCache.Load(s.SrcPath)
+	if !ok {
+		return "", errSourceChanged
+	}
+	entry := val.(*checksumCacheEntry)
+	if entry.size != fi.Size() || !entry.modTime.Equal(fi.ModTime()) {
+		return "", errSourceChanged
+	}
+	return checksum, nil
+}
+
+// startBody runs right before the first body byte. Nothing has been sent yet,
+// so a source that changed since fi was taken still gets a proper 409. The
+// body counts as started for pt's time to first byte, as sendfile reports
+// no progress until it's done.
+func (s *Server) startBody(w http.ResponseWriter, pt *ProgressTracker, fi os.FileInfo, log *zap.Logger) bool {
+	if s.beforeBody != nil {
+		s.beforeBody()
+	}
+	if !sourceChanged(s.SrcPath, fi) {
+		pt.markFirstByte()
+		return true
+	}
+	s.refuseChangedSource(w, log)
+	return false
+}
+
+// refuseChangedSource answers 409 for a source that changed before the body
+// was sent
+func (s *Server) refuseChangedSource(w http.ResponseWriter, log *zap.Logger) {
+	s.recordSourceChanged(log)
+	// Drop the headers that described the file body
+	for _, h := range []string{"Content-Encoding", "Content-Range", "Content-Disposition", "X-Content-SHA256", "X-Encryption"} {
+		w.Header().Del(h)
+	}
+	http.Error(w, errSourceChanged.Error(), http.StatusConflict)
+}
+
+// finishBody checks a completed body copy of want bytes. The headers are gone
+// by now, so a changed source can only be logged; the receiver notices the
+// short body.
+func (s *Server) finishBody(fi os.FileInfo, copied, want int64, copyErr error, log *zap.Logger) bool {
+	shortRead := copyErr == nil && copied < want
+	if !shortRead && !sourceChanged(s.SrcPath, fi) {
+		return true
+	}
+	s.recordSourceChanged(log, zap.Int64("sent", copied), zap.Int64("expected", want))
+	return false
+}
+
+// recordSourceChanged logs the change and counts the download as source_changed
+func (s *Server) recordSourceChanged(log *zap.Logger, fields ...zap.Field) {
+	fields = append([]zap.Field{zap.String("filename", filepath.Base(s.SrcPath))}, fields...)
+	log.Warn("Source file changed or was removed while being served", fields...)
+
+	metrics.DownloadsTotal.WithLabelValues(fileExtLabel(s.SrcPath), "source_changed").Inc()
+}
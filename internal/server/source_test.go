@@ -0,0 +1,177 @@
+package server
+
+import (
+	"crypto/rand"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/zap"
+
+	"github.com/zulfikawr/warp/internal/crypto"
+	"github.com/zulfikawr/warp/internal/metrics"
+	"github.com/zulfikawr/warp/internal/protocol"
+)
+
+// truncatingServer serves path and truncates it to half its size once the
+// download headers are set, before the body is copied
+func truncatingServer(t *testing.T, path string) (*Server, string) {
+	t.Helper()
+	tok, _ := crypto.GenerateToken(nil)
+	s := &Server{Token: tok, SrcPath: path}
+	s.beforeBody = func() {
+		fi, err := os.Stat(path)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if err := os.Truncate(path, fi.Size()/2); err != nil {
+			t.Error(err)
+		}
+		// Keep the change visible on filesystems with coarse timestamps
+		later := fi.ModTime().Add(time.Second)
+		_ = os.Chtimes(path, later, later)
+	}
+	return s, tok
+}
+
+func TestDownloadSourceTruncatedReturnsConflict(t *testing.T) {
+	tests := []struct {
+		name     string
+		file     string
+		encoding string
+	}{
+		{"plain", "data.bin", "identity"},
+		{"zstd", "notes.txt", "zstd"},
+		{"gzip", "notes.txt", "gzip"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tt.file)
+			data := []byte(strings.Repeat("warp source change test\n", 4096))
+			if err := os.WriteFile(path, data, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			s, tok := truncatingServer(t, path)
+			ts := httptest.NewServer(s.routes())
+			defer ts.Close()
+
+			ext := filepath.Ext(tt.file)
+			before := testutil.ToFloat64(metrics.DownloadsTotal.WithLabelValues(ext, "source_changed"))
+
+			req, _ := http.NewRequest(http.MethodGet, ts.URL+protocol.PathPrefix+tok, nil)
+			req.Header.Set("Accept-Encoding", tt.encoding)
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			_ = resp.Body.Close()
+
+			if resp.StatusCode != http.StatusConflict {
+				t.Fatalf("status %d, want 409", resp.StatusCode)
+			}
+			if ce := resp.Header.Get("Content-Encoding"); ce != "" {
+				t.Errorf("409 response still carries Content-Encoding %q", ce)
+			}
+			if !strings.Contains(string(body), errSourceChanged.Error()) {
+				t.Errorf("body = %q", body)
+			}
+			after := testutil.ToFloat64(metrics.DownloadsTotal.WithLabelValues(ext, "source_changed"))
+			if after != before+1 {
+				t.Errorf("source_changed count went from %v to %v, want +1", before, after)
+			}
+		})
+	}
+}
+
+func TestDownloadUnchangedSourceSucceeds(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.bin")
+	data := make([]byte, 64<<10)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tok, _ := crypto.GenerateToken(nil)
+	var calls atomic.Int32
+	s := &Server{Token: tok, SrcPath: path, beforeBody: func() { calls.Add(1) }}
+	ts := httptest.NewServer(s.routes())
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + protocol.PathPrefix + tok)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || len(body) != len(data) {
+		t.Fatalf("status %d with %d bytes, want 200 with %d", resp.StatusCode, len(body), len(data))
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("beforeBody ran %d times, want 1", n)
+	}
+}
+
+func TestChecksumForRejectsStaleSnapshot(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.bin")
+	if err := os.WriteFile(path, []byte("original contents"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{SrcPath: path}
+	if _, err := s.checksumFor(fi); err != nil {
+		t.Fatalf("checksumFor unchanged file: %v", err)
+	}
+
+	if err := os.WriteFile(path, []byte("short"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.checksumFor(fi); err != errSourceChanged {
+		t.Errorf("checksumFor after rewrite = %v, want errSourceChanged", err)
+	}
+
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.checksumFor(fi); err != errSourceChanged {
+		t.Errorf("checksumFor after removal = %v, want errSourceChanged", err)
+	}
+}
+
+func TestFinishBodyDetectsShortCopy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.bin")
+	if err := os.WriteFile(path, make([]byte, 1000), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{SrcPath: path}
+	log := zap.NewNop()
+
+	if !s.finishBody(fi, 1000, 1000, nil, log) {
+		t.Error("complete copy of an unchanged file reported as changed")
+	}
+	if s.finishBody(fi, 500, 1000, nil, log) {
+		t.Error("short copy not reported")
+	}
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if s.finishBody(fi, 1000, 1000, nil, log) {
+		t.Error("removed source not reported")
+	}
+}
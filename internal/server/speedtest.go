@@ -2,29 +2,55 @@ package server
 
 import (
 	"crypto/rand"
-	"crypto/sha256"
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
+
+	"github.com/zulfikawr/warp/internal/metrics"
 )
 
 const (
 	// Size of test data to generate for download tests
 	speedTestDownloadSize = 10485760 // 10 MB
+
+	// Largest download a client may ask for with ?size=
+	maxSpeedTestDownloadSize = 1 << 30 // 1 GiB
 )
 
-// handleSpeedTestDownload serves random data for download speed testing
+// speedTestSink discards everything written to it and counts the bytes. Each
+// upload gets its own sink and the shared counter is atomic, so concurrent
+// speed tests don't race.
+type speedTestSink struct {
+	n        int64
+	progress interface{ Add(float64) }
+}
+
+func (s *speedTestSink) Write(p []byte) (int, error) {
+	s.n += int64(len(p))
+	s.progress.Add(float64(len(p)))
+	return len(p), nil
+}
+
+// handleSpeedTestDownload serves random data for download speed testing,
+// 10 MB or the ?size= the client asks for
 func (s *Server) handleSpeedTestDownload(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
-		return
+
+	size := int64(speedTestDownloadSize)
+	if v := r.URL.Query().Get("size"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n <= 0 || n > maxSpeedTestDownloadSize {
+			http.Error(w, fmt.Sprintf("size must be between 1 and %d bytes", maxSpeedTestDownloadSize), http.StatusBadRequest)
+			return
+		}
+		size = n
 	}
 
 	// Set headers to prevent caching and compression
 	w.Header().Set("Content-Type", "application/octet-stream")
-	w.Header().Set("Cache-Control", "no-store, no-cache, must-revalidate, max-age=0")
+	w.Header().Set("Cache-Control", noCacheControl)
 	w.Header().Set("Pragma", "no-cache")
-	w.Header().Set("Content-Length", "10485760")
+	w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
 
 	// Generate random data once and reuse it
 	buffer := make([]byte, 65536) // 64 KB buffer
@@ -33,7 +59,8 @@ func (s *Server) handleSpeedTestDownload(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	remaining := int64(speedTestDownloadSize)
+	progress := metrics.SpeedTestBytes.WithLabelValues("download")
+	remaining := size
 
 	for remaining > 0 {
 		toWrite := int64(len(buffer))
@@ -43,6 +70,7 @@ func (s *Server) handleSpeedTestDownload(w http.ResponseWriter, r *http.Request)
 
 		// Write to response
 		n, err := w.Write(buffer[:toWrite])
+		progress.Add(float64(n))
 		if err != nil {
 			// Client disconnected or write error
 			return
@@ -52,17 +80,13 @@ func (s *Server) handleSpeedTestDownload(w http.ResponseWriter, r *http.Request)
 	}
 }
 
-// handleSpeedTestUpload receives and discards data for upload speed testing
+// handleSpeedTestUpload discards uploaded data as it arrives, without
+// buffering the body, so a client can stream one chunked request for as long
+// as it measures
 func (s *Server) handleSpeedTestUpload(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
 
-	// Read and hash all uploaded data to simulate real transfer overhead
-	hash := sha256.New()
-	bytesRead, err := io.Copy(hash, r.Body)
-	if err != nil {
+	sink := &speedTestSink{progress: metrics.SpeedTestBytes.WithLabelValues("upload")}
+	if _, err := io.Copy(sink, r.Body); err != nil {
 		http.Error(w, "failed to read upload data", http.StatusBadRequest)
 		return
 	}
@@ -70,5 +94,5 @@ func (s *Server) handleSpeedTestUpload(w http.ResponseWriter, r *http.Request) {
 	// Return success with bytes received
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	fmt.Fprintf(w, `{"status":"ok","bytes_received":%d}`, bytesRead)
+	fmt.Fprintf(w, `{"status":"ok","bytes_received":%d}`, sink.n)
 }
@@ -0,0 +1,59 @@
+package server
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSpeedTestUploadCountsStreamedBody(t *testing.T) {
+	s := &Server{}
+	ts := httptest.NewServer(s.routes())
+	defer ts.Close()
+
+	// A reader without a length is sent chunked
+	body := io.MultiReader(bytes.NewReader(make([]byte, 300_000)), strings.NewReader("tail"))
+	resp, err := http.Post(ts.URL+"/speedtest/upload", "application/octet-stream", body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	got, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(got), `"bytes_received":300004`) {
+		t.Fatalf("status %d, body %s; want 200 with 300004 bytes received", resp.StatusCode, got)
+	}
+}
+
+func TestSpeedTestDownloadSize(t *testing.T) {
+	s := &Server{}
+	ts := httptest.NewServer(s.routes())
+	defer ts.Close()
+
+	tests := []struct {
+		query    string
+		status   int
+		wantSize int64
+	}{
+		{"", http.StatusOK, speedTestDownloadSize},
+		{"?size=1000", http.StatusOK, 1000},
+		{"?size=0", http.StatusBadRequest, 0},
+		{"?size=abc", http.StatusBadRequest, 0},
+		{"?size=2147483648", http.StatusBadRequest, 0},
+	}
+	for _, tt := range tests {
+		resp, err := http.Get(ts.URL + "/speedtest/download" + tt.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		n, _ := io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+		if resp.StatusCode != tt.status {
+			t.Errorf("%q: status = %d, want %d", tt.query, resp.StatusCode, tt.status)
+		} else if tt.status == http.StatusOK && n != tt.wantSize {
+			t.Errorf("%q: got %d bytes, want %d", tt.query, n, tt.wantSize)
+		}
+	}
+}
@@ -0,0 +1,336 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/zulfikawr/warp/internal/crypto"
+	"github.com/zulfikawr/warp/internal/metrics"
+	"github.com/zulfikawr/warp/internal/protocol"
+	"github.com/zulfikawr/warp/internal/ui"
+)
+
+// maxRecentTransfers bounds the completions kept for /stats
+const maxRecentTransfers = 20
+
+// newProgressTracker starts tracking a transfer; total is 0 when the size is
+// unknown
+func newProgressTracker(id, name, direction string, total int64) *ProgressTracker {
+	now := time.Now()
+	// A session ID lets its holder add chunks to the upload or finalize it,
+	// so /stats names transfers by an ID of their own
+	statsID, err := crypto.GenerateTransferID(nil)
+	if err != nil {
+		statsID = "unknown"
+	}
+	return &ProgressTracker{
+		ID:         id,
+		StatsID:    statsID,
+		Filename:   name,
+		Direction:  direction,
+		TotalSize:  total,
+		StartTime:  now,
+		LastUpdate: now,
+		pacer:      ui.NewProgressPacer(total, nil),
+	}
+}
+
+// trackTransfer registers a transfer with the progress WebSocket, /stats and
+// Events
+func (s *Server) trackTransfer(id, name, direction string, total int64, clientIP string) *ProgressTracker {
+	pt := newProgressTracker(id, name, direction, total)
+	pt.ClientIP = clientIP
+	pt.usage = s.usageFor(clientIP)
+	pt.events = &s.events
+	s.activeUploads.Store(id, pt)
+	s.events.publish(pt.event(EventTransferStarted))
+	return pt
+}
+
+// ActiveTransfers counts the uploads and downloads in progress, including
+// chunked upload sessions waiting for their next chunk
+func (s *Server) ActiveTransfers() int {
+	n := 0
+	s.activeUploads.Range(func(_, _ interface{}) bool {
+		n++
+		return true
+	})
+	return n
+}
+
+// finishTransfer removes a tracked transfer, adds its bytes to the totals and
+// publishes its outcome. Completed transfers are listed as recent; calling it
+// again for the same id is a no-op.
+func (s *Server) finishTransfer(id string, completed bool) {
+	s.finish(id, completed, "")
+}
+
+// finishUpload completes a tracked upload like finishTransfer, naming where
+// the file was saved in its TransferCompleted event
+func (s *Server) finishUpload(id, path string) {
+	s.finish(id, true, path)
+}
+
+func (s *Server) finish(id string, completed bool, path string) {
+	val, ok := s.activeUploads.LoadAndDelete(id)
+	if !ok {
+		return
+	}
+	pt := val.(*ProgressTracker)
+	s.publishUsage(pt.ClientIP)
+	n := atomic.LoadInt64(&pt.BytesWritten)
+	if pt.Direction == protocol.DirectionUpload {
+		s.bytesReceived.Add(n)
+	} else {
+		s.bytesSent.Add(n)
+	}
+	if !completed {
+		ev := pt.event(EventTransferFailed)
+		ev.Err = errTransferIncomplete
+		s.events.publish(ev)
+		return
+	}
+	if pt.Direction == protocol.DirectionUpload && path != "" {
+		s.completedUploads.Store(path, struct{}{})
+	}
+	ev := pt.event(EventTransferCompleted)
+	ev.Time, ev.Path = time.Now(), path
+	ev.Duration = ev.Time.Sub(pt.StartTime)
+	s.events.publish(ev)
+	if pt.Direction == protocol.DirectionUpload && s.OnUpload != nil {
+		s.OnUpload(ev)
+	}
+	if pt.Direction == protocol.DirectionUpload {
+		s.uploadRate.add(n, time.Since(pt.StartTime))
+	} else {
+		s.downloadRate.add(n, time.Since(pt.StartTime)-pt.TTFB())
+	}
+
+	done := protocol.CompletedTransfer{
+		Name:            pt.Filename,
+		Direction:       pt.Direction,
+		Bytes:           n,
+		DurationSeconds: time.Since(pt.StartTime).Seconds(),
+		FinishedAt:      time.Now().Unix(),
+		TTFBSeconds:     pt.TTFB().Seconds(),
+	}
+	s.recentMu.Lock()
+	s.recent = append([]protocol.CompletedTransfer{done}, s.recent...)
+	if len(s.recent) > maxRecentTransfers {
+		s.recent = s.recent[:maxRecentTransfers]
+	}
+	s.recentMu.Unlock()
+}
+
+// stats builds the /stats snapshot. Byte totals include transfers still in
+// progress, so successive snapshots give the current throughput.
+func (s *Server) stats() protocol.Stats {
+	st := protocol.Stats{
+		Version:       protocol.Version,
+		Mode:          "send",
+		BytesSent:     s.bytesSent.Load(),
+		BytesReceived: s.bytesReceived.Load(),
+		Active:        []protocol.TransferStats{},
+		Usage:         s.Usage(),
+	}
+	if s.HostMode {
+		st.Mode = "host"
+	}
+	if !s.startedAt.IsZero() {
+		st.UptimeSeconds = time.Since(s.startedAt).Seconds()
+	}
+
+	s.activeUploads.Range(func(_, value interface{}) bool {
+		pt := value.(*ProgressTracker)
+		current := atomic.LoadInt64(&pt.BytesWritten)
+		if pt.Direction == protocol.DirectionUpload {
+			st.BytesReceived += current
+		} else {
+			st.BytesSent += current
+		}
+		st.Active = append(st.Active, protocol.TransferStats{
+			ID:             pt.StatsID,
+			Name:           pt.Filename,
+			Direction:      pt.Direction,
+			Current:        current,
+			Total:          pt.TotalSize,
+			ElapsedSeconds: time.Since(pt.StartTime).Seconds(),
+		})
+		return true
+	})
+	// Oldest first, so rows keep their place between polls
+	sort.Slice(st.Active, func(i, j int) bool {
+		return st.Active[i].ElapsedSeconds > st.Active[j].ElapsedSeconds
+	})
+
+	s.recentMu.Lock()
+	st.Recent = append([]protocol.CompletedTransfer{}, s.recent...)
+	s.recentMu.Unlock()
+	return st
+}
+
+// DownloadActivity counts the downloads a send server has served
+type DownloadActivity struct {
+	Full       int64     // Whole-file downloads served to the end
+	Partial    int64     // Downloads pieced together from several requests, such as resumes and segmented download managers
+	LastAccess time.Time // Latest download request; zero before the first
+}
+
+// DownloadActivity returns the download counters
+func (s *Server) DownloadActivity() DownloadActivity {
+	a := DownloadActivity{Full: s.fullDownloads.Load(), Partial: s.partialDownloads.Load()}
+	if ns := s.lastAccess.Load(); ns != 0 {
+		a.LastAccess = time.Unix(0, ns)
+	}
+	return a
+}
+
+// String reads like "downloads: 3, 1 resumed (last 12m ago)"
+func (a DownloadActivity) String() string {
+	return a.describe(time.Now())
+}
+
+func (a DownloadActivity) describe(now time.Time) string {
+	line := fmt.Sprintf("downloads: %d", a.Full)
+	if a.Partial > 0 {
+		line += fmt.Sprintf(", %d resumed", a.Partial)
+	}
+	if !a.LastAccess.IsZero() {
+		line += " (last " + ago(now.Sub(a.LastAccess)) + ")"
+	}
+	return line
+}
+
+// ago formats d coarsely: "just now", "40s ago", "12m ago", "3h05m ago"
+func ago(d time.Duration) string {
+	switch {
+	case d < time.Second:
+		return "just now"
+	case d < time.Minute:
+		return fmt.Sprintf("%ds ago", int(d/time.Second))
+	case d < time.Hour:
+		return fmt.Sprintf("%dm ago", int(d/time.Minute))
+	}
+	return fmt.Sprintf("%dh%02dm ago", int(d/time.Hour), int(d%time.Hour/time.Minute))
+}
+
+// countDownload records a download served to the end; partial marks one
+// pieced together from several requests
+func (s *Server) countDownload(partial bool) {
+	if partial {
+		s.partialDownloads.Add(1)
+		return
+	}
+	s.fullDownloads.Add(1)
+}
+
+// finishDownload finishes a tracked download like finishTransfer, and counts
+// and times it when it was served to the end. served, when known, is what of
+// a single file the request sent: a request that served only part of it is a
+// piece, and the client's download is only completed and counted once its
+// pieces cover the file.
+func (s *Server) finishDownload(id string, completed bool, served *servedRange, log *zap.Logger) {
+	partial := false
+	if served != nil {
+		if served.whole() {
+			if completed {
+				s.rangeDownloads.forget(served.key)
+			}
+		} else if served.n > 0 {
+			requests, done := s.rangeDownloads.add(served, s.now())
+			switch {
+			case done:
+				partial = true
+				log.Info("Download pieced together from ranges", zap.Int("requests", requests), zap.String("size", ui.FormatBytes(served.size)))
+			case completed:
+				// Its range went out in full, but the file hasn't yet
+				s.finishPiece(id)
+				return
+			}
+			completed = completed || done
+		}
+	}
+	if val, ok := s.activeUploads.Load(id); ok && completed {
+		recordTiming(val.(*ProgressTracker), log)
+	}
+	s.finishTransfer(id, completed)
+	if completed {
+		s.countDownload(partial)
+	}
+}
+
+// finishPiece removes a tracked download that served one range of a file
+// its client is still piecing together. Its bytes count towards the totals,
+// but it is neither completed nor failed.
+func (s *Server) finishPiece(id string) {
+	val, ok := s.activeUploads.LoadAndDelete(id)
+	if !ok {
+		return
+	}
+	pt := val.(*ProgressTracker)
+	s.publishUsage(pt.ClientIP)
+	s.bytesSent.Add(atomic.LoadInt64(&pt.BytesWritten))
+}
+
+// recordTiming logs and observes how long a finished download took to send
+// its first byte, and how long the rest took after that
+func recordTiming(pt *ProgressTracker, log *zap.Logger) {
+	ttfb := pt.TTFB()
+	if ttfb <= 0 {
+		return
+	}
+	transfer := time.Since(pt.StartTime) - ttfb
+	metrics.ObserveDownloadTiming(fileExtLabel(pt.Filename), ttfb, transfer)
+	log.Info("Download timing", zap.String("filename", pt.Filename), zap.Duration("ttfb", ttfb), zap.Duration("transfer", transfer))
+	if ui.SlowStart(ttfb, transfer) {
+		log.Info("Most of the download was spent before its first byte; warp send --precompute hashes the file before anyone connects",
+			zap.String("filename", pt.Filename))
+	}
+}
+
+// handleStats serves the live transfer snapshot polled by `warp top`
+func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
+	_ = json.NewEncoder(w).Encode(s.stats())
+}
+
+// progressWriter counts bytes written through it into a ProgressTracker
+type progressWriter struct {
+	w  io.Writer
+	pt *ProgressTracker
+}
+
+func (p *progressWriter) Write(b []byte) (int, error) {
+	p.pt.markFirstByte()
+	n, err := p.w.Write(b)
+	p.pt.UpdateProgress(int64(n))
+	return n, err
+}
+
+// ReadFrom lets io.Copy reach the ReadFrom of the writer underneath, so an
+// unwrapped http.ResponseWriter can still sendfile a file to the client
+func (p *progressWriter) ReadFrom(src io.Reader) (int64, error) {
+	p.pt.markFirstByte()
+	if _, ok := p.w.(io.ReaderFrom); !ok {
+		return io.Copy(struct{ io.Writer }{p}, src)
+	}
+	return stepCopy(p.w, src, p.pt.UpdateProgress)
+}
+
+// progressReader counts bytes read through it into a ProgressTracker
+type progressReader struct {
+	r  io.Reader
+	pt *ProgressTracker
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.pt.UpdateProgress(int64(n))
+	return n, err
+}
@@ -0,0 +1,239 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zulfikawr/warp/internal/crypto"
+	"github.com/zulfikawr/warp/internal/protocol"
+)
+
+func getStats(t *testing.T, url string) protocol.Stats {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("stats status %d", resp.StatusCode)
+	}
+	var st protocol.Stats
+	if err := json.NewDecoder(resp.Body).Decode(&st); err != nil {
+		t.Fatal(err)
+	}
+	return st
+}
+
+func TestStatsReportsDownloads(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.bin")
+	data := make([]byte, 32<<10)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tok, _ := crypto.GenerateToken(nil)
+	s := &Server{Token: tok, SrcPath: path}
+	ts := httptest.NewServer(s.routes())
+	defer ts.Close()
+	statsURL := ts.URL + protocol.PathPrefix + tok + protocol.StatsPathSuffix
+
+	// A transfer in progress counts towards the totals
+	pt := s.trackTransfer("live", "other.bin", protocol.DirectionDownload, 100, "")
+	pt.UpdateProgress(40)
+	st := getStats(t, statsURL)
+	if st.Mode != "send" || len(st.Active) != 1 || st.Active[0].Current != 40 || st.BytesSent != 40 {
+		t.Fatalf("stats with one active transfer = %+v", st)
+	}
+	// A session ID would let anyone with the token finalize the upload
+	if id := st.Active[0].ID; id == "" || id == "live" {
+		t.Errorf("active transfer listed as %q, want an ID of its own", id)
+	}
+	s.finishTransfer("live", false)
+
+	resp, err := http.Get(ts.URL + protocol.PathPrefix + tok)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+
+	st = getStats(t, statsURL)
+	if len(st.Active) != 0 {
+		t.Errorf("active after download = %+v", st.Active)
+	}
+	if want := int64(40 + len(data)); st.BytesSent != want {
+		t.Errorf("BytesSent = %d, want %d", st.BytesSent, want)
+	}
+	// The abandoned transfer is not a completion
+	if len(st.Recent) != 1 || st.Recent[0].Name != "data.bin" || st.Recent[0].Bytes != int64(len(data)) {
+		t.Errorf("recent = %+v", st.Recent)
+	}
+
+	if resp, err := http.Get(ts.URL + protocol.PathPrefix + "wrong" + protocol.StatsPathSuffix); err == nil {
+		_ = resp.Body.Close()
+		if resp.StatusCode != http.StatusForbidden {
+			t.Errorf("stats with a wrong token: status %d, want 403", resp.StatusCode)
+		}
+	}
+}
+
+func TestDownloadCounters(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "data.bin")
+	if err := os.WriteFile(file, []byte("0123456789abcdefghij"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tok, _ := crypto.GenerateToken(nil)
+	s := &Server{Token: tok, SrcPath: file}
+	ts := httptest.NewServer(s.routes())
+	defer ts.Close()
+
+	if a := s.DownloadActivity(); a != (DownloadActivity{}) {
+		t.Fatalf("activity before any request = %+v", a)
+	}
+	get := func(rng string) {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, ts.URL+protocol.PathPrefix+tok, nil)
+		if rng != "" {
+			req.Header.Set("Range", rng)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+	}
+	before := time.Now()
+	for _, tt := range []struct {
+		rng           string
+		full, partial int64
+	}{
+		{"", 1, 0},
+		{"bytes=10-", 1, 0}, // a piece, the client hasn't the rest yet
+		{"bytes=0-", 2, 0},  // whole-file range, served as a plain 200
+		{"bytes=0-9", 2, 0}, // a piece again, the whole file forgot the last
+		{"bytes=10-", 2, 1}, // resumed: the pieces now cover the file
+		{"bytes=30-", 3, 1}, // unsatisfiable, falls back to the full file
+	} {
+		get(tt.rng)
+		if a := s.DownloadActivity(); a.Full != tt.full || a.Partial != tt.partial {
+			t.Errorf("after Range %q: full %d, partial %d, want %d, %d", tt.rng, a.Full, a.Partial, tt.full, tt.partial)
+		}
+	}
+
+	// Wrong tokens and other share paths are neither counted nor an access
+	last := s.DownloadActivity().LastAccess
+	if last.Before(before) {
+		t.Errorf("last access %s is before the downloads", last)
+	}
+	for _, path := range []string{protocol.PathPrefix + "wrong-token", protocol.PathPrefix + tok + protocol.InfoPathSuffix} {
+		resp, err := http.Get(ts.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = resp.Body.Close()
+	}
+	if a := s.DownloadActivity(); a.Full != 3 || !a.LastAccess.Equal(last) {
+		t.Errorf("activity after non-download requests = %+v", a)
+	}
+
+	resp, err := http.Get(ts.URL + protocol.HealthPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	var h protocol.Health
+	if err := json.NewDecoder(resp.Body).Decode(&h); err != nil {
+		t.Fatal(err)
+	}
+	if h.Downloads != 3 || h.PartialDownloads != 1 || h.LastAccess == nil || !h.LastAccess.Equal(last) {
+		t.Errorf("health downloads = %d, partial %d, last access %v", h.Downloads, h.PartialDownloads, h.LastAccess)
+	}
+}
+
+func TestDownloadActivityString(t *testing.T) {
+	now := time.Date(2026, 3, 10, 18, 0, 0, 0, time.UTC)
+	tests := []struct {
+		a    DownloadActivity
+		want string
+	}{
+		{DownloadActivity{}, "downloads: 0"},
+		{DownloadActivity{Full: 1, LastAccess: now}, "downloads: 1 (last just now)"},
+		{DownloadActivity{Full: 3, LastAccess: now.Add(-12*time.Minute - 30*time.Second)}, "downloads: 3 (last 12m ago)"},
+		{DownloadActivity{Full: 2, Partial: 1, LastAccess: now.Add(-40 * time.Second)}, "downloads: 2, 1 resumed (last 40s ago)"},
+		{DownloadActivity{LastAccess: now.Add(-3*time.Hour - 5*time.Minute)}, "downloads: 0 (last 3h05m ago)"},
+	}
+	for _, tt := range tests {
+		if got := tt.a.describe(now); got != tt.want {
+			t.Errorf("describe(%+v) = %q, want %q", tt.a, got, tt.want)
+		}
+	}
+}
+
+func TestFinishTransferKeepsRecentBounded(t *testing.T) {
+	s := &Server{}
+	for range maxRecentTransfers + 5 {
+		s.trackTransfer("id", "f", protocol.DirectionUpload, 0, "").UpdateProgress(1)
+		s.finishTransfer("id", true)
+		s.finishTransfer("id", true) // Repeats are ignored
+	}
+	st := s.stats()
+	if len(st.Recent) != maxRecentTransfers {
+		t.Errorf("kept %d completions, want %d", len(st.Recent), maxRecentTransfers)
+	}
+	if st.BytesReceived != maxRecentTransfers+5 {
+		t.Errorf("BytesReceived = %d, want %d", st.BytesReceived, maxRecentTransfers+5)
+	}
+}
+
+func TestMetricsNegotiatesOpenMetrics(t *testing.T) {
+	s := &Server{Token: "tok"}
+	ts := httptest.NewServer(s.routes())
+	defer ts.Close()
+
+	for accept, want := range map[string]string{
+		"": "text/plain",
+		"application/openmetrics-text;version=1.0.0": "application/openmetrics-text",
+	} {
+		req, _ := http.NewRequest(http.MethodGet, ts.URL+"/metrics", nil)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, want) {
+			t.Errorf("Accept %q: Content-Type %q, want %s", accept, ct, want)
+		}
+		if want == "application/openmetrics-text" && !strings.HasSuffix(strings.TrimSpace(string(body)), "# EOF") {
+			t.Errorf("OpenMetrics body does not end with # EOF")
+		}
+	}
+}
+
+func TestActiveTransfers(t *testing.T) {
+	s := &Server{}
+	s.trackTransfer("a", "a.bin", protocol.DirectionDownload, 10, "")
+	s.trackTransfer("b", "b.bin", protocol.DirectionUpload, 10, "")
+	if n := s.ActiveTransfers(); n != 2 {
+		t.Errorf("ActiveTransfers() = %d, want 2", n)
+	}
+	s.finishTransfer("a", true)
+	if n := s.ActiveTransfers(); n != 1 {
+		t.Errorf("after one finished: %d, want 1", n)
+	}
+}
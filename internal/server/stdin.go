@@ -0,0 +1,78 @@
+package server
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/zulfikawr/warp/internal/logging"
+	"go.uber.org/zap"
+)
+
+// textSniffLen is how much of spooled stdin is inspected to decide whether it is text
+const textSniffLen = 512
+
+// StdinContent is stdin read for sharing. Input up to the spill threshold is kept
+// in Text; larger input is written to a temp file at Path so memory stays bounded.
+type StdinContent struct {
+	Text   string
+	Path   string // Temp file holding the input when it exceeded the threshold
+	IsText bool   // Spooled input looks like text and should be served as text/plain
+}
+
+// ReadStdin reads r for sharing, spilling to a temp file in tempDir (the system
+// default when empty) once more than threshold bytes have been read
+func ReadStdin(r io.Reader, threshold int64, tempDir string) (*StdinContent, error) {
+	br := bufio.NewReaderSize(r, DefaultBufferSize)
+
+	// Read at most threshold+1 bytes into memory to learn which side we're on
+	head, err := io.ReadAll(io.LimitReader(br, threshold+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from stdin: %w", err)
+	}
+	if int64(len(head)) <= threshold {
+		return &StdinContent{Text: string(head)}, nil
+	}
+
+	f, err := os.CreateTemp(tempDir, "warp-stdin-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp file for stdin: %w", err)
+	}
+	cleanup := func() {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+	}
+	if _, err := f.Write(head); err != nil {
+		cleanup()
+		return nil, fmt.Errorf("failed to spool stdin: %w", err)
+	}
+	if _, err := io.Copy(f, br); err != nil {
+		cleanup()
+		return nil, fmt.Errorf("failed to spool stdin: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		_ = os.Remove(f.Name())
+		return nil, fmt.Errorf("failed to spool stdin: %w", err)
+	}
+
+	sniff := head
+	if len(sniff) > textSniffLen {
+		sniff = sniff[:textSniffLen]
+	}
+	isText := strings.HasPrefix(http.DetectContentType(sniff), "text/")
+	return &StdinContent{Path: f.Name(), IsText: isText}, nil
+}
+
+// removeTempFile deletes the spooled stdin file, if any
+func (s *Server) removeTempFile() {
+	if s.TempFile == "" {
+		return
+	}
+	if err := os.Remove(s.TempFile); err != nil && !errors.Is(err, os.ErrNotExist) {
+		logging.Warn("Failed to remove temp file", zap.String("path", s.TempFile), zap.Error(err))
+	}
+}
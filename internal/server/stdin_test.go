@@ -0,0 +1,120 @@
+package server
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/zulfikawr/warp/internal/crypto"
+	"github.com/zulfikawr/warp/internal/protocol"
+)
+
+// repeatReader endlessly repeats a pattern without allocating
+type repeatReader struct{ pattern []byte }
+
+func (r *repeatReader) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		n += copy(p[n:], r.pattern)
+	}
+	return n, nil
+}
+
+func TestReadStdinSmallStaysInMemory(t *testing.T) {
+	content, err := ReadStdin(strings.NewReader("hello"), 1024, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if content.Text != "hello" || content.Path != "" {
+		t.Fatalf("got Text=%q Path=%q, want in-memory text", content.Text, content.Path)
+	}
+}
+
+func TestReadStdinLargeSpillsWithBoundedMemory(t *testing.T) {
+	const size = 100 << 20 // 100MB
+	const threshold = 8 << 20
+	src := io.LimitReader(&repeatReader{pattern: []byte("INSERT INTO t VALUES (1, 'row');\n")}, size)
+
+	runtime.GC()
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+
+	content, err := ReadStdin(src, threshold, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.Remove(content.Path) }()
+
+	runtime.ReadMemStats(&after)
+
+	if content.Path == "" {
+		t.Fatal("expected input to be spooled to a temp file")
+	}
+	if !content.IsText {
+		t.Error("SQL text should be detected as text")
+	}
+	fi, err := os.Stat(content.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Size() != size {
+		t.Fatalf("spooled size = %d, want %d", fi.Size(), size)
+	}
+
+	// Reading into memory would allocate at least the full 100MB; spooling should
+	// stay near the threshold plus buffers
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 48<<20 {
+		t.Errorf("allocated %d MB while spooling 100MB, want bounded memory", allocated>>20)
+	}
+}
+
+func TestReadStdinBinaryNotText(t *testing.T) {
+	data := bytes.Repeat([]byte{0x00, 0xff, 0x10, 0x80}, 1024)
+	content, err := ReadStdin(bytes.NewReader(data), 16, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.Remove(content.Path) }()
+	if content.IsText {
+		t.Error("binary input detected as text")
+	}
+}
+
+func TestSpooledTextServedAndRemovedOnShutdown(t *testing.T) {
+	content, err := ReadStdin(strings.NewReader(strings.Repeat("line\n", 100)), 16, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tok, _ := crypto.GenerateToken(nil)
+	s := &Server{Token: tok, SrcPath: content.Path, TempFile: content.Path, ServeAsText: content.IsText}
+	ts := httptest.NewServer(s.routes())
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + protocol.PathPrefix + tok)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("Content-Type = %q, want text/plain", ct)
+	}
+	if resp.Header.Get("Content-Disposition") != "" {
+		t.Error("spooled text should not be served as an attachment")
+	}
+	if len(body) != 500 {
+		t.Errorf("body length = %d, want 500", len(body))
+	}
+
+	if err := s.Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(content.Path); !os.IsNotExist(err) {
+		t.Errorf("temp file still exists after Shutdown: %v", err)
+	}
+}
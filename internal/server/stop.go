@@ -0,0 +1,33 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/zulfikawr/warp/internal/crypto"
+	"github.com/zulfikawr/warp/internal/logging"
+	"github.com/zulfikawr/warp/internal/protocol"
+	"go.uber.org/zap"
+)
+
+// handleStop shuts the server down when called with the management secret.
+// The secret is separate from the share token so recipients cannot end the share.
+func (s *Server) handleStop(w http.ResponseWriter, r *http.Request) {
+	secret := r.Header.Get(protocol.ManagementSecretHeader)
+	if s.ManagementSecret == "" || !crypto.TokenEqual(secret, s.ManagementSecret) {
+		logging.Warn("Rejected stop request", zap.String("client_ip", s.clientIP(r)))
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	// Respond before shutting down so the response is not cut off; Shutdown waits
+	// for this handler to return before closing the connection
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte("stopping"))
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+
+	logging.Info("Stop requested remotely", zap.String("client_ip", s.clientIP(r)))
+	go func() { _ = s.Shutdown() }()
+}
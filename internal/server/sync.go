@@ -0,0 +1,81 @@
+package server
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"github.com/zulfikawr/warp/internal/metrics"
+)
+
+// SyncPolicy controls when received uploads are flushed to stable storage
+type SyncPolicy string
+
+const (
+	// SyncNone leaves flushing to the OS page cache (fastest, the default)
+	SyncNone SyncPolicy = "none"
+	// SyncFile fsyncs each file and its directory once before reporting success
+	SyncFile SyncPolicy = "file"
+	// SyncChunk additionally fsyncs after every chunk of a chunked upload
+	SyncChunk SyncPolicy = "chunk"
+)
+
+// ParseSyncPolicy validates a --sync-policy / sync_policy value; empty means none
+func ParseSyncPolicy(s string) (SyncPolicy, error) {
+	switch p := SyncPolicy(s); p {
+	case "":
+		return SyncNone, nil
+	case SyncNone, SyncFile, SyncChunk:
+		return p, nil
+	}
+	return "", fmt.Errorf("invalid sync policy %q (want file, chunk or none)", s)
+}
+
+// syncsFiles reports whether finished uploads are fsynced before success
+func (p SyncPolicy) syncsFiles() bool {
+	return p == SyncFile || p == SyncChunk
+}
+
+// syncsChunks reports whether every chunk is fsynced as it is written
+func (p SyncPolicy) syncsChunks() bool {
+	return p == SyncChunk
+}
+
+// syncFile flushes f and records how long it took under the given target
+func (p SyncPolicy) syncFile(f *os.File, target string) error {
+	start := time.Now()
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("fsync %s: %w", filepath.Base(f.Name()), err)
+	}
+	metrics.UploadSyncDuration.WithLabelValues(string(p), target).Observe(time.Since(start).Seconds())
+	return nil
+}
+
+// syncDir flushes the directory entry of a newly created file so the file
+// itself survives a power cut, not just its contents
+func (p SyncPolicy) syncDir(dir string) error {
+	// Windows can't open directories for fsync; NTFS journals the entry
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = d.Close() }()
+	return p.syncFile(d, "dir")
+}
+
+// finishFile makes a completed upload durable according to the policy: the
+// file's data, then the directory entry that names it
+func (p SyncPolicy) finishFile(f *os.File) error {
+	if !p.syncsFiles() {
+		return nil
+	}
+	if err := p.syncFile(f, "file"); err != nil {
+		return err
+	}
+	return p.syncDir(filepath.Dir(f.Name()))
+}
@@ -0,0 +1,76 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/zulfikawr/warp/internal/ui"
+)
+
+func TestParseSyncPolicy(t *testing.T) {
+	for in, want := range map[string]SyncPolicy{"": SyncNone, "none": SyncNone, "file": SyncFile, "chunk": SyncChunk} {
+		got, err := ParseSyncPolicy(in)
+		if err != nil || got != want {
+			t.Errorf("ParseSyncPolicy(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	if _, err := ParseSyncPolicy("always"); err == nil {
+		t.Error("ParseSyncPolicy accepted an unknown policy")
+	}
+}
+
+func TestSyncPolicyFinishFile(t *testing.T) {
+	for _, p := range []SyncPolicy{SyncNone, SyncFile, SyncChunk} {
+		f, err := os.Create(filepath.Join(t.TempDir(), "upload.bin"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.WriteString("payload"); err != nil {
+			t.Fatal(err)
+		}
+		if err := p.finishFile(f); err != nil {
+			t.Errorf("%s: finishFile: %v", p, err)
+		}
+		_ = f.Close()
+	}
+}
+
+// BenchmarkUploadSyncPolicy writes a 1GB parallel upload in 2MB chunks under
+// each policy. Run with -benchtime=1x; -short shrinks the upload to 64MB.
+func BenchmarkUploadSyncPolicy(b *testing.B) {
+	size := int64(1 << 30)
+	if testing.Short() {
+		size = 64 << 20
+	}
+	const chunkSize = ManifestChunkSize
+	chunks := int(size / chunkSize)
+	data := make([]byte, chunkSize)
+
+	for _, p := range []SyncPolicy{SyncNone, SyncFile, SyncChunk} {
+		b.Run(string(p), func(b *testing.B) {
+			b.SetBytes(size)
+			for i := 0; i < b.N; i++ {
+				s := &Server{SyncPolicy: p, Renderer: ui.NewJSONRenderer(io.Discard)}
+				s.shutdownCtx, s.shutdownCancel = context.WithCancel(context.Background())
+				session, err := s.getOrCreateSession(fmt.Sprintf("%016x", i+1), "bench.bin", size, chunks, b.TempDir(), "", clientInfo{})
+				if err != nil {
+					b.Fatal(err)
+				}
+				for c := 0; c < chunks; c++ {
+					if err := session.writeChunk(c, int64(c)*chunkSize, data); err != nil {
+						b.Fatal(err)
+					}
+				}
+				if err := p.finishFile(session.FileHandle); err != nil {
+					b.Fatal(err)
+				}
+				_ = session.FileHandle.Close()
+				s.shutdownCancel()
+			}
+		})
+	}
+}
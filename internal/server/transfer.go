@@ -0,0 +1,72 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/zulfikawr/warp/internal/crypto"
+	"github.com/zulfikawr/warp/internal/logging"
+	"github.com/zulfikawr/warp/internal/metrics"
+	"github.com/zulfikawr/warp/internal/naming"
+	"github.com/zulfikawr/warp/internal/protocol"
+	"go.uber.org/zap"
+)
+
+// maxUserAgentLen bounds the User-Agent and X-Warp-Version copied into logs
+// and the console
+const maxUserAgentLen = 200
+
+// clientInfo identifies the software on the other end of a transfer
+type clientInfo struct {
+	UserAgent string
+	Version   string // X-Warp-Version, only sent by the CLI
+	Class     string // cli, browser or other
+	IP        string // Client address as resolved by the server; may be empty
+}
+
+// clientInfoFrom extracts the client's User-Agent and warp version
+func clientInfoFrom(r *http.Request) clientInfo {
+	ua := naming.TruncateUTF8(r.Header.Get("User-Agent"), maxUserAgentLen)
+	info := clientInfo{UserAgent: ua, Version: naming.TruncateUTF8(r.Header.Get(protocol.VersionHeader), maxUserAgentLen)}
+	switch {
+	case info.Version != "" || strings.HasPrefix(ua, "warp/"):
+		info.Class = "cli"
+	case strings.HasPrefix(ua, "Mozilla/"):
+		info.Class = "browser"
+	default:
+		info.Class = "other"
+	}
+	return info
+}
+
+// String returns a short label for the console summary
+func (c clientInfo) String() string {
+	if c.Class == "cli" && c.Version != "" {
+		return "warp " + c.Version
+	}
+	if c.UserAgent == "" {
+		return c.Class
+	}
+	return c.Class + " (" + c.UserAgent + ")"
+}
+
+// startTransfer assigns a transfer ID, advertises it in the response headers and
+// returns a logger that tags every line with it and the client's identity. A
+// non-empty id (the chunked upload session ID) is reused so all chunks of one
+// upload share an ID; such continuations are not counted again in metrics.
+func startTransfer(w http.ResponseWriter, r *http.Request, id string) (string, *zap.Logger) {
+	client := clientInfoFrom(r)
+	if id == "" {
+		var err error
+		if id, err = crypto.GenerateTransferID(nil); err != nil {
+			id = "unknown"
+		}
+		metrics.TransfersByClient.WithLabelValues(client.Class).Inc()
+	}
+	w.Header().Set(protocol.TransferIDHeader, id)
+	return id, logging.With(
+		zap.String("transfer_id", id),
+		zap.String("user_agent", client.UserAgent),
+		zap.String("client_version", client.Version),
+	)
+}
@@ -1,6 +1,7 @@
 package server
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -19,31 +20,21 @@ import (
 	"go.uber.org/zap"
 )
 
+// handleUpload serves the upload page on GET and takes uploads on POST
 func (s *Server) handleUpload(w http.ResponseWriter, r *http.Request) {
-	// Expect /u/{token} or /u/{token}/manifest
-	seg := strings.TrimPrefix(r.URL.Path, protocol.UploadPathPrefix)
-	seg = strings.TrimPrefix(seg, "/")
-	parts := strings.Split(seg, "/")
-	if len(parts) == 0 || parts[0] != s.Token {
-		http.Error(w, "forbidden", http.StatusForbidden)
-		return
-	}
-
-	if len(parts) > 1 && parts[1] == "manifest" {
-		s.handleManifest(w, r)
+	if r.Method == http.MethodGet {
+		s.serveUploadPage(w)
 		return
 	}
 
-	if r.Method == http.MethodGet {
-		w.Header().Set("Content-Type", "text/html; charset=utf-8")
-		_, _ = io.WriteString(w, uploadPageHTML)
+	if !s.checkQuota(w, r) {
 		return
 	}
-
-	if r.Method != http.MethodPost {
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	release, ok := s.acquireTransfer(w)
+	if !ok {
 		return
 	}
+	defer release()
 
 	// FAST PATH: Raw binary stream (zero parsing overhead)
 	if filename := r.Header.Get("X-File-Name"); filename != "" {
@@ -51,39 +42,39 @@ func (s *Server) handleUpload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	transferID, log := startTransfer(w, r, "")
+
 	// Basic upload security and limits: limit request size if Content-Length present
 	// and prevent caching of responses.
-	w.Header().Set("Cache-Control", "no-store, no-cache, must-revalidate, max-age=0")
-	w.Header().Set("Pragma", "no-cache")
-	w.Header().Set("Expires", "0")
+	setNoCache(w.Header())
 
 	// Ensure upload dir exists
 	dest := s.UploadDir
 	if dest == "" {
 		dest = "."
 	}
-	if err := os.MkdirAll(dest, 0o755); err != nil {
+	if err := s.mkdirUpload(dest); err != nil {
 		http.Error(w, "server error", http.StatusInternalServerError)
 		return
 	}
 
-	// Set max upload size to 10GB for large file support
-	r.Body = http.MaxBytesReader(w, r.Body, MaxUploadSize) // 10GB limit
+	// Cap the whole request at the configured upload size
+	r.Body = http.MaxBytesReader(w, r.Body, s.uploadLimits().MaxTotalSize)
 
-	// Check available disk space (best effort)
-	if r.ContentLength > 0 {
-		if err := checkDiskSpace(dest, r.ContentLength); err != nil {
-			logging.Warn("Disk space check failed", zap.Error(err))
-			http.Error(w, "insufficient disk space", http.StatusInsufficientStorage)
-			return
-		}
+	// Reserve disk space for the request (best effort without Content-Length)
+	release, err := s.reserveDisk(dest, r.ContentLength)
+	if err != nil {
+		log.Warn("Disk space check failed", zap.Error(err))
+		http.Error(w, "insufficient disk space", http.StatusInsufficientStorage)
+		return
 	}
+	defer release()
 
 	// Use streaming multipart reader for true zero-copy I/O
 	// This reads directly from network to disk without buffering entire files in RAM
 	reader, err := r.MultipartReader()
 	if err != nil {
-		logging.Error("Failed to create multipart reader", zap.Error(err))
+		log.Error("Failed to create multipart reader", zap.Error(err))
 		http.Error(w, "invalid form", http.StatusBadRequest)
 		return
 	}
@@ -95,6 +86,7 @@ func (s *Server) handleUpload(w http.ResponseWriter, r *http.Request) {
 		Size int64
 	}
 	var saved []savedInfo
+	var savedBytes int64
 
 	// Stream each file part directly to disk
 	for {
@@ -103,7 +95,7 @@ func (s *Server) handleUpload(w http.ResponseWriter, r *http.Request) {
 			break // No more parts
 		}
 		if err != nil {
-			logging.Error("Failed to read next part", zap.Error(err))
+			log.Error("Failed to read next part", zap.Error(err))
 			http.Error(w, "upload error", http.StatusInternalServerError)
 			return
 		}
@@ -128,63 +120,123 @@ func (s *Server) handleUpload(w http.ResponseWriter, r *http.Request) {
 			_ = part.Close()
 			continue
 		}
+		if !s.checkUploadLimits(w, name, -1) {
+			_ = part.Close()
+			metrics.ActiveUploads.Dec()
+			metrics.ActiveTransfers.Dec()
+			return
+		}
+		if s.MaxFileSize > 0 {
+			// One byte over the limit is enough to tell it was exceeded
+			limitedPart = io.LimitReader(part, s.MaxFileSize+1)
+		}
 
+		// Resolved per part, so a form that straddles midnight is split by date
+		dir, rel := s.uploadDir(r)
+		if err := s.mkdirUpload(dir); err != nil {
+			log.Error("Failed to create upload directory", zap.String("dir", rel), zap.Error(err))
+			_ = part.Close()
+			http.Error(w, "server error", http.StatusInternalServerError)
+			return
+		}
 		// Use unique filename to prevent overwriting existing files
-		outPath := findUniqueFilename(dest, name)
+		outPath := findUniqueFilename(dir, name)
 		filename := filepath.Base(outPath)
-		out, err := os.OpenFile(outPath, os.O_CREATE|os.O_WRONLY, 0o600)
+		var out *os.File
+		if s.scanning() {
+			// Held under a temporary name until the scan passes it
+			out, err = scanTemp(dir, name)
+		} else {
+			out, err = os.OpenFile(outPath, os.O_CREATE|os.O_WRONLY, 0o600)
+		}
 		if err != nil {
-			logging.Error("Failed to create file", zap.String("filename", name), zap.Error(err))
+			log.Error("Failed to create file", zap.String("filename", name), zap.Error(err))
 			_ = part.Close()
 			http.Error(w, "write error", http.StatusInternalServerError)
 			return
 		}
+		// Each file of the form is its own entry in /stats
+		partID := fmt.Sprintf("%s-%d", transferID, len(saved))
+		pt := s.trackTransfer(partID, filename, protocol.DirectionUpload, 0, s.clientIP(r))
 
-		// Use adaptive buffer sizing - default to 1MB for multipart uploads
+		// The multipart reader sits between the connection and the file, so
+		// there is no splice to preserve; copy through a pooled buffer
 		bufferSize := protocol.GetOptimalBufferSize(1024 * 1024) // Default to 1MB for unknown sizes
-		bufPtr := getBuffer(bufferSize)
+		bufPtr := getBuffer(s.bufferSize(bufferSize))
 		defer putBuffer(bufPtr) // Ensure buffer is returned even on error
 		buf := *bufPtr
 		// Use limited reader to prevent memory exhaustion
-		n, err := io.CopyBuffer(out, limitedPart, buf)
+		timer := &partTimer{r: limitedPart}
+		n, err := io.CopyBuffer(out, &progressReader{r: timer, pt: pt}, buf)
+		if err == nil {
+			err = s.SyncPolicy.finishFile(out)
+		}
 		cerr := out.Close()
 		_ = part.Close()
+		// Stopped once the file is on disk, so the time covers the write
+		duration := timer.elapsed().Seconds()
 
 		if err != nil || cerr != nil {
-			logging.Error("Failed to write file", zap.String("filename", name), zap.NamedError("write_err", err), zap.NamedError("close_err", cerr))
+			log.Error("Failed to write file", zap.String("filename", name), zap.Int64("bytes", n), zap.Float64("duration", duration), zap.NamedError("write_err", err), zap.NamedError("close_err", cerr))
+			if s.scanning() {
+				_ = os.Remove(out.Name())
+			}
+			s.finishTransfer(partID, false)
 			http.Error(w, "write error", http.StatusInternalServerError)
 			return
 		}
-
-		duration := time.Since(requestStart).Seconds()
-		mbps := 0.0
-		if duration > 0 {
-			mbps = (float64(n) * 8) / (duration * 1_000_000)
+		if s.MaxFileSize > 0 && n > s.MaxFileSize {
+			_ = os.Remove(out.Name())
+			s.finishTransfer(partID, false)
+			metrics.ActiveUploads.Dec()
+			metrics.ActiveTransfers.Dec()
+			http.Error(w, "file too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		if s.scanning() {
+			if err := s.screenUpload(log, out.Name(), relPath(rel, name)); err != nil {
+				s.finishTransfer(partID, false)
+				metrics.ActiveUploads.Dec()
+				metrics.ActiveTransfers.Dec()
+				writeScanRejection(w, relPath(rel, name), err)
+				return
+			}
+			if outPath, err = promoteUpload(out.Name(), dir, name); err != nil {
+				log.Error("Failed to move scanned file into place", zap.String("filename", name), zap.Error(err))
+				_ = os.Remove(out.Name())
+				s.finishTransfer(partID, false)
+				http.Error(w, "write error", http.StatusInternalServerError)
+				return
+			}
+			filename = filepath.Base(outPath)
 		}
-		logging.Info("File received", zap.String("filename", filename), zap.String("size", ui.FormatBytes(n)), zap.Float64("duration", duration), zap.Float64("mbps", mbps))
-		saved = append(saved, savedInfo{Name: filename, Size: n})
+
+		mbps := throughputMbps(n, duration)
+		log.Info("File received", zap.String("filename", relPath(rel, filename)), zap.String("size", ui.FormatBytes(n)), zap.Float64("duration", duration), zap.Float64("mbps", mbps), zap.String("speed", ui.FormatSpeed(mbps*1e6/8)))
+		saved = append(saved, savedInfo{Name: relPath(rel, filename), Size: n})
+		savedBytes += n
+		s.finishUpload(partID, outPath)
 
 		// Record metrics for this file
-		fileExt := strings.ToLower(filepath.Ext(filename))
-		if fileExt == "" {
-			fileExt = "no_ext"
-		}
-		metrics.UploadDuration.WithLabelValues(fileExt).Observe(duration)
-		metrics.UploadSize.WithLabelValues(fileExt).Observe(float64(n))
+		fileExt := fileExtLabel(filename)
+		metrics.ObserveTransfer(metrics.UploadDuration.WithLabelValues(fileExt), duration, partID)
+		metrics.ObserveTransfer(metrics.UploadSize.WithLabelValues(fileExt), float64(n), partID)
 		metrics.UploadThroughput.WithLabelValues(fileExt).Observe(mbps)
 		metrics.UploadsTotal.WithLabelValues(fileExt, "success").Inc()
 
 		// Decrement active counters
 		metrics.ActiveUploads.Dec()
 		metrics.ActiveTransfers.Dec()
-
-		requestStart = time.Now() // Reset for next file
 	}
 
 	if len(saved) == 0 {
 		http.Error(w, "no file provided", http.StatusBadRequest)
 		return
 	}
+	// The whole form, including headers and gaps between files
+	requestDuration := time.Since(requestStart).Seconds()
+	requestMbps := throughputMbps(savedBytes, requestDuration)
+	log.Info("Upload request complete", zap.Int("files", len(saved)), zap.String("size", ui.FormatBytes(savedBytes)), zap.Float64("duration", requestDuration), zap.Float64("mbps", requestMbps), zap.String("speed", ui.FormatSpeed(requestMbps*1e6/8)))
 
 	// Simple success response (client already manages state)
 	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
@@ -192,12 +244,55 @@ func (s *Server) handleUpload(w http.ResponseWriter, r *http.Request) {
 	_, _ = w.Write([]byte("ok"))
 }
 
+// partTimer times a multipart file part from the first byte of its body, so
+// the form's headers, earlier parts and a sender pausing between files don't
+// count toward it
+type partTimer struct {
+	r     io.Reader
+	start time.Time
+}
+
+func (p *partTimer) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	if n > 0 && p.start.IsZero() {
+		p.start = time.Now()
+	}
+	return n, err
+}
+
+// elapsed is the time since the part's first byte; zero for an empty part
+func (p *partTimer) elapsed() time.Duration {
+	if p.start.IsZero() {
+		return 0
+	}
+	return time.Since(p.start)
+}
+
+// throughputMbps is the rate of n bytes over seconds in megabits per second
+func throughputMbps(n int64, seconds float64) float64 {
+	if seconds <= 0 {
+		return 0
+	}
+	return (float64(n) * 8) / (seconds * 1_000_000)
+}
+
 // sanitizeFilename validates and cleans filenames to prevent security issues
 
 func (s *Server) handleRawUpload(w http.ResponseWriter, r *http.Request, encodedFilename string) {
-	const MaxUploadSize = 10 << 30 // 10GB
-	if r.ContentLength > MaxUploadSize {
-		http.Error(w, "file too large", http.StatusRequestEntityTooLarge)
+	// Validate session ID if provided; chunked uploads reuse it as the transfer ID
+	sessionIDHeader := r.Header.Get("X-Upload-Session")
+	if sessionIDHeader != "" {
+		if err := protocol.ValidateSessionID(sessionIDHeader); err != nil {
+			logging.Warn("Invalid session ID", zap.Error(err))
+			http.Error(w, fmt.Sprintf("invalid session ID: %v", err), http.StatusBadRequest)
+			return
+		}
+	}
+	transferID, log := startTransfer(w, r, sessionIDHeader)
+
+	limits := s.uploadLimits()
+	if err := limits.ValidateTotalSize(max(r.ContentLength, 0)); err != nil {
+		http.Error(w, fmt.Sprintf("file too large: %v", err), http.StatusRequestEntityTooLarge)
 		return
 	}
 
@@ -210,56 +305,76 @@ func (s *Server) handleRawUpload(w http.ResponseWriter, r *http.Request, encoded
 
 	name, err := sanitizeFilename(filename)
 	if err != nil {
-		logging.Warn("Invalid filename", zap.String("filename", filename), zap.Error(err))
+		log.Warn("Invalid filename", zap.String("filename", filename), zap.Error(err))
 		http.Error(w, "invalid filename", http.StatusBadRequest)
 		return
 	}
 
+	// Chunks carry the whole file's size in X-Upload-Total
+	declaredSize := r.ContentLength
+	if total, err := strconv.ParseInt(r.Header.Get("X-Upload-Total"), 10, 64); err == nil && total > declaredSize {
+		declaredSize = total
+	}
+	if err := limits.ValidateTotalSize(max(declaredSize, 0)); err != nil {
+		log.Warn("Upload rejected by limits", zap.String("filename", name), zap.Int64("size", declaredSize), zap.Error(err))
+		http.Error(w, fmt.Sprintf("file too large: %v", err), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if !s.checkUploadLimits(w, name, declaredSize) {
+		log.Warn("Upload rejected by limits", zap.String("filename", name), zap.Int64("size", declaredSize))
+		return
+	}
+
 	dest := s.UploadDir
 	if dest == "" {
 		dest = "."
 	}
-	if err := os.MkdirAll(dest, 0o755); err != nil {
+	if err := s.mkdirUpload(dest); err != nil {
 		http.Error(w, "server error", http.StatusInternalServerError)
 		return
 	}
 
 	// Chunk/resume metadata
-	sessionIDHeader := r.Header.Get("X-Upload-Session")
 	offsetHeader := r.Header.Get("X-Upload-Offset")
 	chunkIDHeader := r.Header.Get("X-Chunk-Id")
 	chunkTotalHeader := r.Header.Get("X-Chunk-Total")
 
-	// Validate session ID if provided
-	if sessionIDHeader != "" {
-		if err := ValidateSessionID(sessionIDHeader); err != nil {
-			logging.Warn("Invalid session ID", zap.Error(err))
-			http.Error(w, fmt.Sprintf("invalid session ID: %v", err), http.StatusBadRequest)
-			return
-		}
-	}
-
 	isParallelChunk := sessionIDHeader != "" && chunkIDHeader != "" && chunkTotalHeader != ""
 	chunked := offsetHeader != ""
 	var uploadOffset int64
 	var totalSize int64
 
 	// Validate Content-Length
-	if r.ContentLength < 0 || r.ContentLength > MaxUploadSize {
+	if r.ContentLength < 0 {
 		http.Error(w, "invalid or missing content length", http.StatusBadRequest)
 		return
 	}
 
-	// Check available disk space
-	if err := checkDiskSpace(dest, r.ContentLength); err != nil {
-		logging.Warn("Disk space check failed", zap.Error(err))
-		http.Error(w, "insufficient disk space", http.StatusInsufficientStorage)
+	// Only parallel chunks are sealed; anything else would be saved as ciphertext
+	if r.Header.Get(protocol.EncryptionHeader) != "" && !isParallelChunk {
+		http.Error(w, "only parallel upload chunks can be encrypted", http.StatusBadRequest)
 		return
 	}
 
-	// Handle parallel chunk upload (new fast path)
+	if wantsAppend(r) {
+		switch {
+		case !s.AllowAppend:
+			http.Error(w, "appending is not enabled on this host (start it with --allow-append)", http.StatusBadRequest)
+		case sessionIDHeader != "" || offsetHeader != "":
+			http.Error(w, "an append can't be part of a chunked upload", http.StatusBadRequest)
+		case s.scanning():
+			http.Error(w, "appending is not available while uploads are scanned", http.StatusBadRequest)
+		default:
+			s.handleAppend(w, r, log, transferID, name)
+		}
+		return
+	}
+
+	// Handle parallel chunk upload (new fast path); the session reserves
+	// disk space for the whole file when it is created
 	if isParallelChunk {
-		s.handleParallelChunk(w, r, name, sessionIDHeader, chunkIDHeader, chunkTotalHeader, offsetHeader, dest)
+		dir, rel := s.uploadDir(r)
+		s.handleParallelChunk(w, r, log, name, sessionIDHeader, chunkIDHeader, chunkTotalHeader, offsetHeader, dir, rel)
 		return
 	}
 
@@ -275,8 +390,8 @@ func (s *Server) handleRawUpload(w http.ResponseWriter, r *http.Request, encoded
 			if total, err := strconv.ParseInt(totalHeader, 10, 64); err == nil && total > 0 {
 				totalSize = total
 				// Validate offset against total size
-				if err := ValidateOffset(uploadOffset, totalSize); err != nil {
-					logging.Warn("Invalid offset", zap.Error(err))
+				if err := protocol.ValidateOffset(uploadOffset, totalSize); err != nil {
+					log.Warn("Invalid offset", zap.Error(err))
 					http.Error(w, fmt.Sprintf("invalid offset: %v", err), http.StatusBadRequest)
 					return
 				}
@@ -284,19 +399,45 @@ func (s *Server) handleRawUpload(w http.ResponseWriter, r *http.Request, encoded
 		}
 	}
 
+	// Reserve disk space for the request before anything is pre-allocated;
+	// the first request of a legacy chunked upload sizes the whole file
+	reserve := r.ContentLength
+	if chunked && uploadOffset == 0 && totalSize > reserve {
+		reserve = totalSize
+	}
+	release, err := s.reserveDisk(dest, reserve)
+	if err != nil {
+		log.Warn("Disk space check failed", zap.Error(err))
+		http.Error(w, "insufficient disk space", http.StatusInsufficientStorage)
+		return
+	}
+	defer release()
+
+	dir, rel := s.uploadDir(r)
+	if chunked && uploadOffset > 0 {
+		dir, rel = s.resumeDir(dir, rel, name)
+	}
+	if err := s.mkdirUpload(dir); err != nil {
+		log.Error("Failed to create upload directory", zap.String("dir", rel), zap.Error(err))
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+
+	// actualFilename is relative to the upload directory, as clients see it
 	var outPath string
 	var actualFilename string
 	if chunked {
 		// For chunked uploads, use consistent filename
-		outPath = filepath.Join(dest, name)
-		actualFilename = filepath.Base(outPath)
-		// Validate existing file size matches expected offset
+		outPath = filepath.Join(dir, name)
+		actualFilename = relPath(rel, name)
+		// Validate existing file size matches expected offset; the first
+		// request pre-allocates a file of known total size in full
 		if fi, err := os.Stat(outPath); err == nil {
-			if fi.Size() != uploadOffset {
+			if fi.Size() != uploadOffset && (totalSize == 0 || fi.Size() != totalSize) {
 				// File exists but offset doesn't match
 				// This shouldn't happen with proper parallel chunk handling
 				// Return error asking client to use proper session-based upload
-				logging.Warn("Legacy chunk upload with offset mismatch",
+				log.Warn("Legacy chunk upload with offset mismatch",
 					zap.Int64("file_offset", fi.Size()),
 					zap.Int64("expected_offset", uploadOffset),
 					zap.String("filename", actualFilename))
@@ -305,16 +446,29 @@ func (s *Server) handleRawUpload(w http.ResponseWriter, r *http.Request, encoded
 			}
 		}
 	} else {
-		outPath = findUniqueFilename(dest, name)
-		actualFilename = filepath.Base(outPath)
+		outPath = findUniqueFilename(dir, name)
+		actualFilename = relPath(rel, filepath.Base(outPath))
 	}
 
-	f, err := os.OpenFile(outPath, os.O_CREATE|os.O_WRONLY, 0o600)
+	// A single-request upload is held under a temporary name until the scan
+	// passes it; a legacy chunked one is scanned in place once complete
+	held := s.scanning() && !chunked
+	var f *os.File
+	if held {
+		f, err = scanTemp(dir, name)
+	} else {
+		f, err = os.OpenFile(outPath, os.O_CREATE|os.O_WRONLY, 0o600)
+	}
 	if err != nil {
-		logging.Error("Failed to open file", zap.String("filename", actualFilename), zap.Error(err))
+		log.Error("Failed to open file", zap.String("filename", actualFilename), zap.Error(err))
 		http.Error(w, "disk error", http.StatusInternalServerError)
 		return
 	}
+	if held {
+		tmpPath := f.Name()
+		// Gone once promoted; otherwise the upload failed
+		defer func() { _ = os.Remove(tmpPath) }()
+	}
 
 	// Pre-allocate when total known and offset zero
 	if chunked {
@@ -347,12 +501,12 @@ func (s *Server) handleRawUpload(w http.ResponseWriter, r *http.Request, encoded
 	defer func() {
 		if f != nil {
 			if err := f.Close(); err != nil {
-				logging.Warn("Failed to close file", zap.Error(err))
+				log.Warn("Failed to close file", zap.Error(err))
 			}
 		}
 		if conn != nil {
 			if err := conn.Close(); err != nil {
-				logging.Warn("Failed to close connection", zap.Error(err))
+				log.Warn("Failed to close connection", zap.Error(err))
 			}
 		}
 	}()
@@ -360,54 +514,172 @@ func (s *Server) handleRawUpload(w http.ResponseWriter, r *http.Request, encoded
 	// Manual deadlines since http.Server timeouts no longer apply post-hijack
 	_ = conn.SetReadDeadline(time.Now().Add(time.Hour))
 
+	// net/http sends the interim 100 Continue on the first r.Body read, which
+	// never happens once hijacked; without it clients such as curl stall
+	// before sending the body
+	if expectsContinue(r) {
+		_ = conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+		_, _ = bufrw.WriteString("HTTP/1.1 100 Continue\r\n\r\n")
+		if err := bufrw.Flush(); err != nil {
+			log.Warn("Failed to send 100 Continue", zap.Error(err))
+			return
+		}
+		_ = conn.SetWriteDeadline(time.Time{})
+	}
+
 	if chunked && uploadOffset == 0 {
 		if totalSize > 0 {
-			logging.Info("Receiving file", zap.String("filename", actualFilename), zap.String("size", ui.FormatBytes(totalSize)))
+			log.Info("Receiving file", zap.String("filename", actualFilename), zap.String("size", ui.FormatBytes(totalSize)))
 		} else {
-			logging.Info("Receiving file", zap.String("filename", actualFilename))
+			log.Info("Receiving file", zap.String("filename", actualFilename))
 		}
 	}
 	if !chunked {
 		if r.ContentLength > 0 {
-			logging.Info("Receiving file", zap.String("filename", actualFilename), zap.String("size", ui.FormatBytes(r.ContentLength)))
+			log.Info("Receiving file", zap.String("filename", actualFilename), zap.String("size", ui.FormatBytes(r.ContentLength)))
 		} else {
-			logging.Info("Receiving file", zap.String("filename", actualFilename))
+			log.Info("Receiving file", zap.String("filename", actualFilename))
 		}
 	}
 
-	// Use adaptive buffer sizing based on expected file size
-	expectedSize := totalSize
-	if expectedSize <= 0 && r.ContentLength > 0 {
-		expectedSize = r.ContentLength
-	}
-	bufferSize := protocol.GetOptimalBufferSize(expectedSize)
-	bufPtr := getBuffer(bufferSize)
-	buf := *bufPtr
-	defer putBuffer(bufPtr)
-
-	// Enforce size limit even when Content-Length is provided
+	// Content-Length was validated above; an empty file's 0 must not fall
+	// back to reading until the connection closes
 	maxRead := r.ContentLength
-	if maxRead <= 0 || maxRead > MaxUploadSize {
-		maxRead = MaxUploadSize
-	}
 
-	// Limit reader to prevent over-reading
-	reader := io.LimitReader(bufrw, maxRead)
+	// A legacy chunked upload is one transfer across its requests: it stays
+	// open between them and ends with the last one or the first that fails
+	pt := s.resumeLegacyUpload(outPath, chunked && uploadOffset > 0)
+	if pt == nil {
+		total := max(r.ContentLength, 0)
+		if chunked {
+			total = max(totalSize, total)
+		}
+		pt = s.trackTransfer(transferID, actualFilename, protocol.DirectionUpload, total, s.clientIP(r))
+	}
+	completed, pending := false, false
+	defer func() {
+		switch {
+		case completed:
+			s.finishUpload(pt.ID, outPath)
+		case pending:
+			s.legacyUploads.Store(outPath, legacyUpload{pt, time.Now()})
+		default:
+			s.finishTransfer(pt.ID, false)
+		}
+	}()
 
-	n, err := io.CopyBuffer(f, reader, buf)
+	// Whatever net/http read ahead of the hijack is still buffered in bufrw;
+	// the rest comes straight off the connection. Both are limited to
+	// prevent over-reading.
+	buffered := min(int64(bufrw.Reader.Buffered()), maxRead)
+	n, err := stepCopy(f, io.LimitReader(bufrw, buffered), pt.UpdateProgress)
+	if err == nil && n == buffered {
+		var m int64
+		m, err = s.receiveBody(f, conn, maxRead-n, pt)
+		n += m
+	}
 	if err != nil && !errors.Is(err, io.EOF) {
-		logging.Error("Upload stream failed", zap.String("filename", actualFilename), zap.Error(err))
+		log.Error("Upload stream failed", zap.String("filename", actualFilename), zap.Error(err))
+		_ = conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+		_, _ = bufrw.WriteString("HTTP/1.1 500 Internal Server Error\r\n" + protocol.TransferIDHeader + ": " + transferID + "\r\nConnection: close\r\n\r\n")
+		_ = bufrw.Flush()
+		return
+	}
+
+	// Flush per the sync policy before answering: every request of a legacy
+	// chunked upload is one chunk, and the last one completes the file
+	complete := !chunked || (totalSize > 0 && uploadOffset+n == totalSize)
+	var syncErr error
+	if complete {
+		syncErr = s.SyncPolicy.finishFile(f)
+	} else if s.SyncPolicy.syncsChunks() {
+		syncErr = s.SyncPolicy.syncFile(f, "chunk")
+	}
+	if syncErr != nil {
+		log.Error("Failed to sync upload", zap.String("filename", actualFilename), zap.Error(syncErr))
 		_ = conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
-		_, _ = bufrw.WriteString("HTTP/1.1 500 Internal Server Error\r\nConnection: close\r\n\r\n")
+		_, _ = bufrw.WriteString("HTTP/1.1 500 Internal Server Error\r\n" + protocol.TransferIDHeader + ": " + transferID + "\r\nConnection: close\r\n\r\n")
 		_ = bufrw.Flush()
 		return
 	}
 
-	// Manual HTTP/1.1 response
+	if complete && s.scanning() {
+		scanned := outPath
+		if held {
+			scanned = f.Name()
+			// Closed before the scanner reads it and it is renamed
+			_ = f.Close()
+			f = nil
+		}
+		if err := s.screenUpload(log, scanned, actualFilename); err != nil {
+			body, _ := json.Marshal(scanRejection{Filename: actualFilename, Error: err.Error()})
+			_ = conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+			_, _ = fmt.Fprintf(bufrw, "HTTP/1.1 422 Unprocessable Entity\r\nContent-Type: application/json\r\n%s: %s\r\nContent-Length: %d\r\nConnection: close\r\n\r\n%s", protocol.TransferIDHeader, transferID, len(body), body)
+			_ = bufrw.Flush()
+			return
+		}
+		if held {
+			if outPath, err = promoteUpload(scanned, dir, name); err != nil {
+				log.Error("Failed to move scanned file into place", zap.String("filename", actualFilename), zap.Error(err))
+				_ = conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+				_, _ = bufrw.WriteString("HTTP/1.1 500 Internal Server Error\r\n" + protocol.TransferIDHeader + ": " + transferID + "\r\nConnection: close\r\n\r\n")
+				_ = bufrw.Flush()
+				return
+			}
+			actualFilename = relPath(rel, filepath.Base(outPath))
+		}
+	}
+
+	// Apply the sender's mtime/mode once the whole file is in place
+	if complete {
+		s.applyUploadAttrs(log, r, outPath)
+	}
+
+	// Manual HTTP/1.1 response, with the body a PUT upload gets
+	body, _ := json.Marshal(putResult{Success: true, Filename: actualFilename, Size: n})
 	_ = conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
-	response := fmt.Sprintf("HTTP/1.1 200 OK\r\nContent-Type: application/json\r\nConnection: close\r\n\r\n{\"success\":true,\"filename\":\"%s\",\"size\":%d}", actualFilename, n)
-	_, _ = bufrw.WriteString(response)
+	_, _ = fmt.Fprintf(bufrw, "HTTP/1.1 200 OK\r\nContent-Type: application/json\r\n%s: %s\r\nContent-Length: %d\r\nConnection: close\r\n\r\n", protocol.TransferIDHeader, transferID, len(body))
+	_, _ = bufrw.Write(body)
 	_ = bufrw.Flush()
+	completed, pending = complete, !complete
+}
+
+// legacyUpload is the open transfer of a legacy chunked upload waiting for
+// its next request
+type legacyUpload struct {
+	pt    *ProgressTracker
+	since time.Time // When the previous request ended
+}
+
+// resumeLegacyUpload takes the transfer a legacy chunked upload to path left
+// open after its previous request when resume is set. A transfer left by an
+// upload that starts over instead failed.
+func (s *Server) resumeLegacyUpload(path string, resume bool) *ProgressTracker {
+	val, ok := s.legacyUploads.LoadAndDelete(path)
+	if !ok {
+		return nil
+	}
+	pt := val.(legacyUpload).pt
+	if !resume {
+		s.finishTransfer(pt.ID, false)
+		return nil
+	}
+	return pt
+}
+
+// expectsContinue reports whether the client is waiting for 100 Continue
+// before sending the request body
+func expectsContinue(r *http.Request) bool {
+	return strings.EqualFold(r.Header.Get("Expect"), "100-continue") && r.ProtoAtLeast(1, 1) && r.ContentLength != 0
 }
 
-// addChunkDuration adds chunk upload duration for performance tracking
+// applyUploadAttrs sets the mtime and mode sent by a CLI uploader on path when
+// PreserveAttrs is enabled. Failures are logged; the upload itself succeeded.
+func (s *Server) applyUploadAttrs(log *zap.Logger, r *http.Request, path string) {
+	if !s.PreserveAttrs {
+		return
+	}
+	if err := protocol.FileAttrsFromHeader(r.Header).Apply(path); err != nil {
+		log.Warn("Failed to preserve file attributes", zap.String("filename", filepath.Base(path)), zap.Error(err))
+	}
+}
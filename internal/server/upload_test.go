@@ -0,0 +1,105 @@
+package server
+
+import (
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/zulfikawr/warp/internal/crypto"
+	"github.com/zulfikawr/warp/internal/logging"
+	"github.com/zulfikawr/warp/internal/protocol"
+)
+
+func TestMultipartUploadTimesEachFile(t *testing.T) {
+	core, logs := observer.New(zapcore.InfoLevel)
+	defer logging.ReplaceLogger(zap.New(core))()
+
+	tok, _ := crypto.GenerateToken(nil)
+	s := &Server{Token: tok, HostMode: true, UploadDir: t.TempDir()}
+	ts := httptest.NewServer(s.routes())
+	defer ts.Close()
+
+	// The sender stalls before the first file's body, which must not count
+	// toward it, and in the middle of the second file's body, which must
+	const stall = 300 * time.Millisecond
+	pr, pw := io.Pipe()
+	mw := multipart.NewWriter(pw)
+	go func() {
+		write := func(name string, chunks ...string) {
+			fw, err := mw.CreateFormFile("file", name)
+			if err != nil {
+				_ = pw.CloseWithError(err)
+				return
+			}
+			for i, c := range chunks {
+				if i > 0 || name == "first.txt" {
+					time.Sleep(stall)
+				}
+				_, _ = io.WriteString(fw, c)
+			}
+		}
+		write("first.txt", "one")
+		write("slow.txt", strings.Repeat("a", 1024), strings.Repeat("b", 1024))
+		write("third.txt", "three")
+		_ = pw.CloseWithError(mw.Close())
+	}()
+
+	req, _ := http.NewRequest(http.MethodPost, ts.URL+protocol.UploadPathPrefix+tok, pr)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d", resp.StatusCode)
+	}
+
+	durations := make(map[string]float64)
+	for _, e := range logs.FilterMessage("File received").All() {
+		durations[e.ContextMap()["filename"].(string)] = e.ContextMap()["duration"].(float64)
+	}
+	// Half the stall tells the two apart without depending on exact timing
+	limit := stall.Seconds() / 2
+	if d := durations["first.txt"]; d >= limit {
+		t.Errorf("first.txt took %.3fs; the stall before its body was counted", d)
+	}
+	if d := durations["slow.txt"]; d < limit {
+		t.Errorf("slow.txt took %.3fs, want the %v stall in its body counted", d, stall)
+	}
+	if d := durations["third.txt"]; d >= limit {
+		t.Errorf("third.txt took %.3fs; the slow file before it was counted", d)
+	}
+
+	summary := logs.FilterMessage("Upload request complete").All()
+	if len(summary) != 1 {
+		t.Fatalf("got %d request summaries, want 1", len(summary))
+	}
+	if got := summary[0].ContextMap()["files"]; got != int64(3) {
+		t.Errorf("summary files = %v, want 3", got)
+	}
+	if d := summary[0].ContextMap()["duration"].(float64); d < 3*limit {
+		t.Errorf("request took %.3fs, want both stalls counted", d)
+	}
+}
+
+func TestRawUploadResponseEscapesFilename(t *testing.T) {
+	tok, _ := crypto.GenerateToken(nil)
+	s := &Server{Token: tok, HostMode: true, UploadDir: t.TempDir()}
+	ts := httptest.NewServer(s.routes())
+	defer ts.Close()
+
+	// rawUpload fails the test unless the body decodes as JSON
+	name := `say "hi".txt`
+	if got := rawUpload(t, ts, tok, name, []byte("hello"), nil); got != name {
+		t.Errorf("filename = %q, want %q", got, name)
+	}
+}
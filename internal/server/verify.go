@@ -0,0 +1,303 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zulfikawr/warp/internal/crypto"
+	"github.com/zulfikawr/warp/internal/metrics"
+	"github.com/zulfikawr/warp/internal/protocol"
+	"go.uber.org/zap"
+)
+
+// QuarantineDir is the directory under UploadDir where files that fail
+// verification are moved so they can be inspected
+const QuarantineDir = ".warp-quarantine"
+
+// Verification job states
+const (
+	verifyPending = "pending"
+	verifyPass    = "pass"
+	verifyFail    = "fail"
+)
+
+// sha256HexPattern matches a hex-encoded SHA256 digest
+var sha256HexPattern = regexp.MustCompile(`^[0-9a-fA-F]{64}$`)
+
+// verifyResult is the public state of a verification job
+type verifyResult struct {
+	ID          string `json:"job_id"`
+	Filename    string `json:"filename"`
+	Status      string `json:"status"`
+	Expected    string `json:"expected"`
+	Actual      string `json:"actual,omitempty"`
+	Quarantined string `json:"quarantined,omitempty"` // Where the file was moved on failure, relative to the upload directory
+	Error       string `json:"error,omitempty"`
+}
+
+// verifyJob is a full-file checksum verification for a finished parallel upload
+type verifyJob struct {
+	mu       sync.Mutex
+	result   verifyResult
+	path     string
+	finished time.Time
+}
+
+// snapshot returns a copy of the job's public state
+func (j *verifyJob) snapshot() verifyResult {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.result
+}
+
+// handleFinalize verifies a completed parallel upload against the client's
+// full-file SHA256. Synchronous by default; with AsyncVerify it answers 202 with
+// a job ID that the client polls at /u/{token}/verify/{id}. A session is
+// verified once: a repeat while that runs gets the same job, and one after it
+// is refused, so no one can have a verified upload hashed again against a
+// checksum of their choosing and quarantined.
+func (s *Server) handleFinalize(w http.ResponseWriter, r *http.Request) {
+	sessionID := r.Header.Get("X-Upload-Session")
+	if err := protocol.ValidateSessionID(sessionID); err != nil {
+		http.Error(w, fmt.Sprintf("invalid session ID: %v", err), http.StatusBadRequest)
+		return
+	}
+	_, log := startTransfer(w, r, sessionID)
+
+	expected := r.Header.Get(protocol.ContentSHA256Header)
+	if !sha256HexPattern.MatchString(expected) {
+		http.Error(w, "missing or invalid "+protocol.ContentSHA256Header, http.StatusBadRequest)
+		return
+	}
+
+	val, ok := s.uploadSessions.Load(sessionID)
+	if !ok {
+		http.Error(w, "unknown upload session", http.StatusNotFound)
+		return
+	}
+	session := val.(*uploadSession)
+	if err := session.scanRejected(); err != nil {
+		writeScanRejection(w, session.RelPath, err)
+		return
+	}
+	if !session.isComplete() {
+		http.Error(w, "upload not complete", http.StatusConflict)
+		return
+	}
+
+	job, created, err := session.verification(expected)
+	if err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	id := job.result.ID
+	w.Header().Set("Content-Type", jsonContentType)
+	if !created {
+		snap := job.snapshot()
+		if snap.Status != verifyPending {
+			log.Warn("Upload already verified", zap.String("job_id", id), zap.String("status", snap.Status))
+			w.WriteHeader(http.StatusConflict)
+			_ = json.NewEncoder(w).Encode(snap)
+			return
+		}
+		w.Header().Set("Location", protocol.UploadPathPrefix+s.Token+protocol.VerifyPathSegment+id)
+		w.WriteHeader(http.StatusAccepted)
+		_ = json.NewEncoder(w).Encode(snap)
+		return
+	}
+	s.verifyJobs.Store(id, job)
+
+	if s.AsyncVerify {
+		log.Info("Queued checksum verification", zap.String("job_id", id), zap.String("filename", job.result.Filename))
+		go s.runVerification(log, job)
+		w.Header().Set("Location", protocol.UploadPathPrefix+s.Token+protocol.VerifyPathSegment+id)
+		w.WriteHeader(http.StatusAccepted)
+		_ = json.NewEncoder(w).Encode(job.snapshot())
+		return
+	}
+
+	s.runVerification(log, job)
+	snap := job.snapshot()
+	if snap.Status != verifyPass {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+	}
+	_ = json.NewEncoder(w).Encode(snap)
+}
+
+// verification returns the session's verification job, creating it for
+// expected when this is the first finalize
+func (session *uploadSession) verification(expected string) (*verifyJob, bool, error) {
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	if session.verify != nil {
+		return session.verify, false, nil
+	}
+	id, err := crypto.GenerateTransferID(nil)
+	if err != nil {
+		return nil, false, err
+	}
+	session.verify = &verifyJob{
+		result: verifyResult{
+			ID:       id,
+			Filename: filepath.Base(session.FilePath),
+			Status:   verifyPending,
+			Expected: strings.ToLower(expected),
+		},
+		path: session.FilePath,
+	}
+	return session.verify, true, nil
+}
+
+// handleVerifyStatus reports the state of a verification job
+func (s *Server) handleVerifyStatus(w http.ResponseWriter, r *http.Request) {
+	id, _ := subRouteID(shareRest(r), protocol.VerifyPathSegment)
+	val, ok := s.verifyJobs.Load(id)
+	if !ok {
+		http.Error(w, "unknown verification job", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", jsonContentType)
+	w.Header().Set("Cache-Control", noCacheControl)
+	_ = json.NewEncoder(w).Encode(val.(*verifyJob).snapshot())
+}
+
+// runVerification hashes the job's file and records pass or fail. Only one
+// verification runs at a time; others wait for the slot. On mismatch the file
+// is quarantined rather than deleted.
+func (s *Server) runVerification(log *zap.Logger, job *verifyJob) {
+	ctx := s.shutdownCtx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	s.verifyOnce.Do(func() { s.verifySlot = make(chan struct{}, 1) })
+
+	select {
+	case s.verifySlot <- struct{}{}:
+		defer func() { <-s.verifySlot }()
+	case <-ctx.Done():
+		s.finishVerification(job, "", "", ctx.Err())
+		return
+	}
+
+	name, expected := job.result.Filename, job.result.Expected
+	start := time.Now()
+	actual, err := hashFileContext(ctx, job.path)
+	if err != nil {
+		log.Error("Checksum verification failed to run", zap.String("filename", name), zap.Error(err))
+		s.finishVerification(job, "", "", err)
+		return
+	}
+
+	if actual == expected {
+		metrics.ChecksumVerifications.WithLabelValues("match").Inc()
+		log.Info("Upload checksum verified", zap.String("filename", name), zap.Duration("took", time.Since(start)))
+		s.finishVerification(job, actual, "", nil)
+		return
+	}
+
+	metrics.ChecksumVerifications.WithLabelValues("mismatch").Inc()
+	quarantined, qerr := s.quarantine(job.path)
+	if qerr != nil {
+		log.Error("Failed to quarantine file", zap.String("filename", name), zap.Error(qerr))
+	}
+	log.Warn("Upload checksum mismatch",
+		zap.String("filename", name),
+		zap.String("expected", expected[:16]+"..."),
+		zap.String("actual", actual[:16]+"..."),
+		zap.String("quarantined", quarantined))
+	s.finishVerification(job, actual, quarantined, nil)
+}
+
+// finishVerification records the outcome of a job
+func (s *Server) finishVerification(job *verifyJob, actual, quarantined string, err error) {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+	job.result.Actual = actual
+	job.result.Quarantined = quarantined
+	job.finished = time.Now()
+	switch {
+	case err != nil:
+		job.result.Status = verifyFail
+		job.result.Error = err.Error()
+	case actual == job.result.Expected:
+		job.result.Status = verifyPass
+	default:
+		job.result.Status = verifyFail
+		job.result.Error = "checksum mismatch"
+	}
+}
+
+// hashFileContext computes a file's SHA256, stopping early if ctx is cancelled
+func hashFileContext(ctx context.Context, path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = f.Close() }()
+
+	h := sha256.New()
+	buf := make([]byte, protocol.BufferSizeLarge)
+	for {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		n, err := f.Read(buf)
+		h.Write(buf[:n])
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// quarantine moves path into QuarantineDir under the upload directory
+func (s *Server) quarantine(path string) (string, error) {
+	return s.quarantineAs(path, filepath.Base(path))
+}
+
+// quarantineAs moves path into QuarantineDir as name, or a free variant of
+// it, and returns where it went relative to the upload directory, as clients
+// see paths
+func (s *Server) quarantineAs(path, name string) (string, error) {
+	dest := s.UploadDir
+	if dest == "" {
+		dest = "."
+	}
+	dir := filepath.Join(dest, QuarantineDir)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", err
+	}
+	target := findUniqueFilename(dir, name)
+	if err := os.Rename(path, target); err != nil {
+		return "", err
+	}
+	return relPath(QuarantineDir, filepath.Base(target)), nil
+}
+
+// cleanupVerifyJobs forgets finished verification jobs after StaleSessionThreshold
+func (s *Server) cleanupVerifyJobs() {
+	s.verifyJobs.Range(func(key, value interface{}) bool {
+		job := value.(*verifyJob)
+		job.mu.Lock()
+		expired := !job.finished.IsZero() && time.Since(job.finished) > StaleSessionThreshold
+		job.mu.Unlock()
+		if expired {
+			s.verifyJobs.Delete(key)
+		}
+		return true
+	})
+}
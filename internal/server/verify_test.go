@@ -0,0 +1,82 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/zulfikawr/warp/internal/crypto"
+	"github.com/zulfikawr/warp/internal/protocol"
+)
+
+// finalize asks the host to verify session against sum
+func finalize(t *testing.T, ts *httptest.Server, tok, session, sum string) (int, verifyResult) {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodPost, ts.URL+protocol.UploadPathPrefix+tok+protocol.FinalizePathSuffix, nil)
+	req.Header.Set("X-Upload-Session", session)
+	req.Header.Set(protocol.ContentSHA256Header, sum)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	var res verifyResult
+	_ = json.NewDecoder(resp.Body).Decode(&res)
+	return resp.StatusCode, res
+}
+
+func TestFinalizeOncePerSession(t *testing.T) {
+	dir := t.TempDir()
+	tok, _ := crypto.GenerateToken(nil)
+	s := &Server{Token: tok, HostMode: true, UploadDir: dir}
+	ts := httptest.NewServer(s.routes())
+	defer ts.Close()
+
+	data := []byte("the whole file in one chunk")
+	req, _ := http.NewRequest(http.MethodPost, ts.URL+protocol.UploadPathPrefix+tok, bytes.NewReader(data))
+	req.Header.Set("X-File-Name", "report.pdf")
+	req.Header.Set("X-Upload-Session", "finalize-session-1")
+	req.Header.Set("X-Upload-Offset", "0")
+	req.Header.Set("X-Upload-Total", "27")
+	req.Header.Set("X-Chunk-Id", "0")
+	req.Header.Set("X-Chunk-Total", "1")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("chunk: status %d", resp.StatusCode)
+	}
+
+	h := sha256.Sum256(data)
+	sum := hex.EncodeToString(h[:])
+	status, first := finalize(t, ts, tok, "finalize-session-1", sum)
+	if status != http.StatusOK || first.Status != verifyPass {
+		t.Fatalf("finalize: status %d, %+v", status, first)
+	}
+
+	// A wrong checksum afterwards doesn't get the verified file quarantined
+	wrong := hex.EncodeToString(make([]byte, sha256.Size))
+	status, again := finalize(t, ts, tok, "finalize-session-1", wrong)
+	if status != http.StatusConflict || again.ID != first.ID || again.Status != verifyPass {
+		t.Errorf("second finalize: status %d, %+v, want 409 with the first job", status, again)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "report.pdf")); err != nil {
+		t.Errorf("verified file moved: %v", err)
+	}
+	jobs := 0
+	s.verifyJobs.Range(func(_, _ interface{}) bool {
+		jobs++
+		return true
+	})
+	if jobs != 1 {
+		t.Errorf("%d verification jobs, want 1", jobs)
+	}
+}
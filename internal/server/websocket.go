@@ -3,26 +3,48 @@ package server
 import (
 	"github.com/zulfikawr/warp/internal/logging"
 	"go.uber.org/zap"
+	"net"
 	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
 	"github.com/zulfikawr/warp/internal/metrics"
+	"github.com/zulfikawr/warp/internal/ui"
 )
 
 // WebSocket upgrader for real-time progress updates
 var wsUpgrader = websocket.Upgrader{
 	ReadBufferSize:  WebSocketReadBuffer,
 	WriteBufferSize: WebSocketWriteBuffer,
-	CheckOrigin: func(r *http.Request) bool {
-		// Allow connections from same origin only for security
-		origin := r.Header.Get("Origin")
-		if origin == "" {
-			return true // Allow non-browser clients
-		}
-		// In production, validate origin properly
+	CheckOrigin:     checkProgressOrigin,
+}
+
+// checkProgressOrigin accepts non-browser clients, same-origin pages and pages
+// served from localhost. Cross-site pages cannot subscribe to progress even if
+// they learn the token.
+func checkProgressOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true // Allow non-browser clients
+	}
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	if strings.EqualFold(u.Host, r.Host) {
 		return true
-	},
+	}
+	host := u.Hostname()
+	if host == "localhost" {
+		return true
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		return true
+	}
+	return false
 }
 
 // handleProgressWebSocket streams real-time progress updates via WebSocket
@@ -37,23 +59,25 @@ func (s *Server) handleProgressWebSocket(w http.ResponseWriter, r *http.Request)
 	metrics.ActiveWebSocketConnections.Inc()
 	defer metrics.ActiveWebSocketConnections.Dec()
 
-	// Send progress updates periodically
-	ticker := time.NewTicker(WebSocketUpdateInterval)
-	defer ticker.Stop()
+	// Send progress as each transfer's pacer makes it due, never more often
+	// than interval
+	interval := WebSocketUpdateInterval
+	if s.LowMemory {
+		interval = LowMemoryWebSocketInterval
+	}
+	feed := &progressFeed{interval: interval, pacers: make(map[string]*ui.ProgressPacer)}
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
 
 	for {
 		select {
-		case <-ticker.C:
+		case <-timer.C:
 			// Collect all active uploads/downloads
-			progress := make([]map[string]interface{}, 0)
-			s.activeUploads.Range(func(key, value interface{}) bool {
-				tracker := value.(*ProgressTracker)
-				progress = append(progress, tracker.GetProgress())
-				return true
-			})
+			progress, due, next := feed.collect(s)
+			timer.Reset(next)
 
 			// Send progress update
-			if len(progress) > 0 {
+			if due {
 				metrics.WebSocketMessagesTotal.WithLabelValues("progress").Inc()
 				if err := conn.WriteJSON(map[string]interface{}{
 					"type":      "progress",
@@ -70,3 +94,39 @@ func (s *Server) handleProgressWebSocket(w http.ResponseWriter, r *http.Request)
 		}
 	}
 }
+
+// progressFeed paces one WebSocket connection's progress messages with a
+// pacer per transfer
+type progressFeed struct {
+	interval time.Duration // Shortest gap between messages
+	pacers   map[string]*ui.ProgressPacer
+}
+
+// collect snapshots every active transfer. due reports whether any of them
+// has moved far enough to be worth a message, and next is when to look again.
+func (f *progressFeed) collect(s *Server) (progress []map[string]interface{}, due bool, next time.Duration) {
+	next = ui.DefaultPaceMax
+	seen := make(map[string]bool, len(f.pacers))
+	s.activeUploads.Range(func(key, value interface{}) bool {
+		tracker := value.(*ProgressTracker)
+		pacer := f.pacers[tracker.ID]
+		if pacer == nil {
+			pacer = ui.NewProgressPacer(tracker.TotalSize, nil)
+			pacer.MinInterval = f.interval
+			f.pacers[tracker.ID] = pacer
+		}
+		seen[tracker.ID] = true
+		if pacer.Ready(atomic.LoadInt64(&tracker.BytesWritten)) {
+			due = true
+		}
+		next = min(next, pacer.Interval())
+		progress = append(progress, tracker.GetProgress())
+		return true
+	})
+	for id := range f.pacers {
+		if !seen[id] {
+			delete(f.pacers, id)
+		}
+	}
+	return progress, due, max(next, f.interval)
+}
@@ -1,127 +1,71 @@
 package server
 
 import (
-	"archive/zip"
 	"fmt"
 	"io"
-	"os"
 	"path/filepath"
-	"sync/atomic"
+
+	"go.uber.org/zap"
+
+	"github.com/zulfikawr/warp/internal/archive"
+	"github.com/zulfikawr/warp/internal/logging"
+	"github.com/zulfikawr/warp/internal/ui"
 )
 
-// ZipProgress tracks compression progress for multi-file display
-type ZipProgress struct {
-	TotalFiles     int
-	ProcessedFiles atomic.Int32
-	TotalBytes     int64
-	ProcessedBytes atomic.Int64
-	CurrentFile    string
-	Output         io.Writer
+// liveOutput returns out when it is a terminal that "\r" updates can redraw,
+// and nil otherwise so logs get only the start and end lines
+func liveOutput(out io.Writer) io.Writer {
+	if out == nil || !ui.IsTerminal(out) {
+		return nil
+	}
+	return out
 }
 
-// Update prints the current progress
-func (zp *ZipProgress) Update() {
-	if zp.Output == nil {
-		return
+// compressedLine ends the zip progress, overwriting the live line if any
+func compressedLine(out io.Writer, files int, size int64) {
+	if liveOutput(out) != nil {
+		fmt.Fprint(out, "\r\033[K")
 	}
-	processed := zp.ProcessedFiles.Load()
-	fmt.Fprintf(zp.Output, "\rCompressing: %d/%d files | %s",
-		processed, zp.TotalFiles, zp.CurrentFile)
+	fmt.Fprintf(out, "✓ Compressed %d files (%s total)\n", files, ui.FormatBytes(size))
 }
 
-// ZipDirectory streams a zip of srcDir to w.
-func ZipDirectory(w io.Writer, srcDir string) error {
-	return ZipDirectoryWithProgress(w, srcDir, nil)
+// archiveName is the download name of a zipped source
+func (s *Server) archiveName() string {
+	if s.ArchiveName != "" {
+		return s.ArchiveName
+	}
+	return filepath.Base(s.SrcPath) + ".zip"
 }
 
-// ZipDirectoryWithProgress streams a zip of srcDir to w with progress tracking
-func ZipDirectoryWithProgress(w io.Writer, srcDir string, progressOut io.Writer) error {
-	// First pass: count files and total size
-	var fileCount int
-	var totalSize int64
-	filepath.Walk(srcDir, func(path string, info os.FileInfo, err error) error {
-		if err == nil && !info.IsDir() {
-			fileCount++
-			totalSize += info.Size()
-		}
-		return nil
-	})
-
-	progress := &ZipProgress{
-		TotalFiles: fileCount,
-		TotalBytes: totalSize,
-		Output:     progressOut,
+// zipSource streams the zip of a directory source, or of SrcFiles when set,
+// with Archive's options. Progress goes to progressOut: a line before and
+// after, and a live one in between on a terminal.
+func (s *Server) zipSource(w io.Writer, progressOut io.Writer) error {
+	opts := s.Archive
+	opts.Warn = func(path string, err error) {
+		logging.Warn("Left a file out of the zip", zap.String("path", path), zap.Error(err))
 	}
-
+	var last archive.Progress
+	live := liveOutput(progressOut)
 	if progressOut != nil {
-		fmt.Fprintf(progressOut, "\nPreparing %d files (%s total)...\n", fileCount, formatZipSize(totalSize))
-	}
-
-	zw := zip.NewWriter(w)
-	defer func() { _ = zw.Close() }()
-
-	err := filepath.Walk(srcDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
+		opts.Progress = func(p archive.Progress) {
+			last = p
+			if p.Current == "" {
+				fmt.Fprintf(progressOut, "\nPreparing %d files (%s total)...\n", p.TotalFiles, ui.FormatBytes(p.TotalBytes))
+			} else if live != nil {
+				fmt.Fprintf(live, "\rCompressing: %d/%d files | %s", p.Files, p.TotalFiles, p.Current)
+			}
 		}
-		if info.IsDir() {
-			return nil
-		}
-		rel, err := filepath.Rel(srcDir, path)
-		if err != nil {
-			return err
-		}
-
-		progress.CurrentFile = rel
-		progress.Update()
-
-		fh, err := zip.FileInfoHeader(info)
-		if err != nil {
-			return err
-		}
-		fh.Name = rel
-		fh.Method = zip.Deflate
-		f, err := zw.CreateHeader(fh)
-		if err != nil {
-			return err
-		}
-		file, err := os.Open(path)
-		if err != nil {
-			return err
-		}
-		// Close immediately to prevent file handle exhaustion
-		_, copyErr := io.Copy(f, file)
-		closeErr := file.Close()
-
-		progress.ProcessedFiles.Add(1)
-		progress.ProcessedBytes.Add(info.Size())
-
-		if copyErr != nil {
-			return copyErr
-		}
-		return closeErr
-	})
-
-	if progressOut != nil && err == nil {
-		fmt.Fprintf(progressOut, "\r✓ Compressed %d files (%s total)          \n",
-			fileCount, formatZipSize(totalSize))
 	}
 
-	return err
-}
-
-// formatZipSize formats bytes for zip progress display
-func formatZipSize(bytes int64) string {
-	const unit = 1024
-	if bytes < unit {
-		return fmt.Sprintf("%d B", bytes)
+	var err error
+	if len(s.SrcFiles) > 0 {
+		err = archive.ZipFiles(w, s.SrcPath, s.SrcFiles, opts)
+	} else {
+		err = archive.Zip(w, s.SrcPath, opts)
 	}
-	div := int64(unit)
-	exp := 0
-	units := []string{"KB", "MB", "GB", "TB"}
-	for bytes >= div*unit && exp < len(units)-1 {
-		div *= unit
-		exp++
+	if progressOut != nil && err == nil {
+		compressedLine(progressOut, last.TotalFiles, last.TotalBytes)
 	}
-	return fmt.Sprintf("%.1f %s", float64(bytes)/float64(div), units[exp])
+	return err
 }
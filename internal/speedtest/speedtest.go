@@ -1,7 +1,6 @@
 package speedtest
 
 import (
-	"bytes"
 	"context"
 	"crypto/rand"
 	"crypto/sha256"
@@ -13,12 +12,20 @@ import (
 	"time"
 
 	"github.com/zulfikawr/warp/internal/protocol"
+	"github.com/zulfikawr/warp/internal/ui"
 )
 
 const (
-	// Test payload sizes
-	uploadTestSize = 10485760 // 10 MB for upload test
-	testDuration   = 3 * time.Second
+	// DefaultDuration is how long each of the upload and download tests runs
+	DefaultDuration = 3 * time.Second
+
+	// DefaultPayloadSize is the size of each download request and of the
+	// random block the upload repeats
+	DefaultPayloadSize = 10485760 // 10 MB
+
+	// Warmup is left out at the start of each test, while TCP ramps up and
+	// the connection is set up
+	Warmup = 500 * time.Millisecond
 )
 
 // Result contains the results of a speed test
@@ -34,6 +41,9 @@ type Result struct {
 type SpeedTest struct {
 	targetHost string
 	client     *http.Client
+
+	Duration    time.Duration // Length of each test, warmup included; 0 means DefaultDuration
+	PayloadSize int64         // Bytes per download request and upload block; 0 means DefaultPayloadSize
 }
 
 // New creates a new SpeedTest instance
@@ -58,7 +68,8 @@ func New(targetHost string) *SpeedTest {
 				TLSHandshakeTimeout:   10 * time.Second,
 				ResponseHeaderTimeout: 30 * time.Second,
 			},
-			Timeout: 60 * time.Second,
+			// Each test streams for its Duration; the caller's context bounds the run
+			Timeout: 0,
 		},
 	}
 }
@@ -131,21 +142,75 @@ func (st *SpeedTest) measureLatency(ctx context.Context) (float64, error) {
 	return float64(avgLatency.Milliseconds()), nil
 }
 
-// measureDownload measures download speed from the target
+// duration is the length of each test
+func (st *SpeedTest) duration() time.Duration {
+	if st.Duration > 0 {
+		return st.Duration
+	}
+	return DefaultDuration
+}
+
+// payloadSize is the size of each download request and upload block
+func (st *SpeedTest) payloadSize() int64 {
+	if st.PayloadSize > 0 {
+		return st.PayloadSize
+	}
+	return DefaultPayloadSize
+}
+
+// meter measures steady-state throughput from timestamped byte counts. Bytes
+// moved during the warmup after the first sample are left out, and so is the
+// time they took.
+type meter struct {
+	warmup time.Duration
+
+	first  time.Time // First sample
+	steady time.Time // First sample after the warmup
+	last   time.Time // Latest sample
+	bytes  int64     // Bytes moved after steady
+}
+
+// record notes that n bytes had been moved by now
+func (m *meter) record(now time.Time, n int64) {
+	if m.first.IsZero() {
+		m.first = now
+	}
+	if now.Sub(m.first) < m.warmup {
+		return
+	}
+	if m.steady.IsZero() {
+		// These bytes were moved partly during the warmup; the count starts here
+		m.steady = now
+		return
+	}
+	m.bytes += n
+	m.last = now
+}
+
+// mbps returns the steady-state throughput in megabits per second
+func (m *meter) mbps() (float64, error) {
+	elapsed := m.last.Sub(m.steady).Seconds()
+	if elapsed <= 0 || m.bytes == 0 {
+		return 0, fmt.Errorf("insufficient data for measurement")
+	}
+	// Convert bytes/sec to Mbps
+	return float64(m.bytes) * 8 / elapsed / 1_000_000, nil
+}
+
+// measureDownload measures download speed from the target, fetching one
+// payload after another over the same connection until the test time is up
 func (st *SpeedTest) measureDownload(ctx context.Context) (float64, error) {
-	url := fmt.Sprintf("http://%s/speedtest/download", st.targetHost)
+	url := fmt.Sprintf("http://%s/speedtest/download?size=%d", st.targetHost, st.payloadSize())
 
-	bytesRead := int64(0)
+	m := &meter{warmup: Warmup}
+	// Use the same buffer size and hashing as real transfers for accuracy
+	buf := make([]byte, protocol.BufferSizeVeryLarge)
+	hash := sha256.New()
 	start := time.Now()
+	deadline := start.Add(st.duration())
+	m.record(start, 0)
 
-	// Keep downloading until we hit time limit
-	for time.Since(start) < testDuration {
-		select {
-		case <-ctx.Done():
-			return 0, ctx.Err()
-		default:
-		}
-
+	for time.Now().Before(deadline) {
 		req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 		if err != nil {
 			return 0, err
@@ -161,86 +226,88 @@ func (st *SpeedTest) measureDownload(ctx context.Context) (float64, error) {
 			return 0, fmt.Errorf("download request failed with status: %d", resp.StatusCode)
 		}
 
-		// Use the same buffer size and hashing as real transfers for accuracy
-		buf := make([]byte, protocol.BufferSizeVeryLarge)
-		hash := sha256.New()
-		n, err := io.CopyBuffer(hash, resp.Body, buf)
-		resp.Body.Close()
-
-		if err != nil && err != io.EOF {
-			return 0, fmt.Errorf("read failed: %w", err)
+		for {
+			n, err := resp.Body.Read(buf)
+			hash.Write(buf[:n])
+			now := time.Now()
+			m.record(now, int64(n))
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				resp.Body.Close()
+				return 0, fmt.Errorf("read failed: %w", err)
+			}
+			if !now.Before(deadline) {
+				break
+			}
 		}
-
-		bytesRead += n
+		resp.Body.Close()
 	}
 
-	elapsed := time.Since(start).Seconds()
-	if elapsed == 0 || bytesRead == 0 {
-		return 0, fmt.Errorf("insufficient data for measurement")
-	}
+	return m.mbps()
+}
 
-	// Convert bytes/sec to Mbps
-	bytesPerSecond := float64(bytesRead) / elapsed
-	mbps := (bytesPerSecond * 8) / 1_000_000
+// uploadBody is a request body that repeats payload until deadline. Each
+// read reports the bytes of the one before, which the transport has sent by
+// then, to the meter.
+type uploadBody struct {
+	payload  []byte
+	off      int
+	pending  int64
+	deadline time.Time
+	meter    *meter
+}
 
-	return mbps, nil
+func (b *uploadBody) Read(p []byte) (int, error) {
+	now := time.Now()
+	b.meter.record(now, b.pending)
+	if !now.Before(b.deadline) {
+		b.pending = 0
+		return 0, io.EOF
+	}
+	n := copy(p, b.payload[b.off:])
+	b.off = (b.off + n) % len(b.payload)
+	b.pending = int64(n)
+	return n, nil
 }
 
-// measureUpload measures upload speed to the target
+// measureUpload measures upload speed to the target with a single chunked
+// request that streams for the whole test, so connection setup only counts
+// once and falls into the warmup
 func (st *SpeedTest) measureUpload(ctx context.Context) (float64, error) {
 	url := fmt.Sprintf("http://%s/speedtest/upload", st.targetHost)
 
 	// Generate random test data once
-	testData := make([]byte, uploadTestSize)
+	testData := make([]byte, st.payloadSize())
 	if _, err := rand.Read(testData); err != nil {
 		return 0, fmt.Errorf("failed to generate test data: %w", err)
 	}
 
-	bytesWritten := int64(0)
+	m := &meter{warmup: Warmup}
 	start := time.Now()
+	m.record(start, 0)
+	body := &uploadBody{payload: testData, deadline: start.Add(st.duration()), meter: m}
 
-	// Keep uploading until we hit time limit
-	for time.Since(start) < testDuration {
-		select {
-		case <-ctx.Done():
-			return 0, ctx.Err()
-		default:
-		}
-
-		req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(testData))
-		if err != nil {
-			return 0, err
-		}
-		req.Header.Set("Content-Type", "application/octet-stream")
-
-		resp, err := st.client.Do(req)
-		if err != nil {
-			return 0, fmt.Errorf("upload request failed: %w", err)
-		}
-
-		// Read and discard response
-		// Use hashing to simulate real transfer overhead
-		hash := sha256.New()
-		_, _ = io.Copy(hash, resp.Body)
-		resp.Body.Close()
-
-		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
-			bytesWritten += int64(len(testData))
-		} else {
-			return 0, fmt.Errorf("upload request failed with status: %d", resp.StatusCode)
-		}
+	req, err := http.NewRequestWithContext(ctx, "POST", url, body)
+	if err != nil {
+		return 0, err
 	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	// Unknown length: the body is sent chunked until the deadline
+	req.ContentLength = -1
 
-	elapsed := time.Since(start).Seconds()
-	if elapsed == 0 || bytesWritten == 0 {
-		return 0, fmt.Errorf("insufficient data for measurement")
+	resp, err := st.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("upload request failed: %w", err)
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return 0, fmt.Errorf("upload request failed with status: %d", resp.StatusCode)
 	}
 
-	// Convert bytes/sec to Mbps
-	bytesPerSecond := float64(bytesWritten) / elapsed
-	mbps := (bytesPerSecond * 8) / 1_000_000
-
-	return mbps, nil
+	return m.mbps()
 }
 
 // determineQuality determines connection quality based on metrics
@@ -273,12 +340,12 @@ func EstimateTransferTime(fileSizeMB float64, speedMbps float64) time.Duration {
 	return time.Duration(seconds * float64(time.Second))
 }
 
-// FormatSpeed formats speed in appropriate units
+// FormatSpeed formats a link speed in Mbps as a decimal bit rate.
+//
+// Deprecated: use ui.FormatSpeed with the speed in bytes per second, which
+// follows the user's speed_units preference.
 func FormatSpeed(mbps float64) string {
-	if mbps >= 1000 {
-		return fmt.Sprintf("%.1f Gbps", mbps/1000)
-	}
-	return fmt.Sprintf("%.1f Mbps", mbps)
+	return ui.FormatSpeedPref(mbps*1e6/8, ui.SpeedBits)
 }
 
 // FormatDuration formats duration in human-readable format
@@ -2,6 +2,11 @@ package speedtest
 
 import (
 	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -267,6 +272,75 @@ func TestMeasureUpload(t *testing.T) {
 	}
 }
 
+func TestMeterExcludesWarmup(t *testing.T) {
+	t0 := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(ms int) time.Time { return t0.Add(time.Duration(ms) * time.Millisecond) }
+
+	m := &meter{warmup: 500 * time.Millisecond}
+	m.record(at(0), 0)
+	// Slow start: 1 MB in the warmup, which must not count
+	m.record(at(250), 500_000)
+	m.record(at(499), 500_000)
+	// The first sample after the warmup only marks where counting starts
+	m.record(at(500), 125_000)
+	// Steady state: 1.25 MB per 100ms = 100 Mbps
+	for ms := 600; ms <= 1500; ms += 100 {
+		m.record(at(ms), 1_250_000)
+	}
+
+	got, err := m.mbps()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != 100 {
+		t.Errorf("mbps = %v, want 100", got)
+	}
+	if m.steady != at(500) || m.last != at(1500) || m.bytes != 12_500_000 {
+		t.Errorf("steady %v last %v bytes %d, want 500ms, 1500ms, 12500000", m.steady.Sub(t0), m.last.Sub(t0), m.bytes)
+	}
+}
+
+func TestMeterNeedsSteadyState(t *testing.T) {
+	t0 := time.Now()
+	m := &meter{warmup: 500 * time.Millisecond}
+	m.record(t0, 0)
+	m.record(t0.Add(400*time.Millisecond), 1_000_000)
+	m.record(t0.Add(600*time.Millisecond), 1_000_000)
+	if _, err := m.mbps(); err == nil {
+		t.Error("expected an error with nothing measured after the warmup")
+	}
+}
+
+func TestMeasureUploadStreamsOneRequest(t *testing.T) {
+	var requests, received atomic.Int64
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if r.ContentLength != -1 {
+			t.Errorf("ContentLength = %d, want a chunked body", r.ContentLength)
+		}
+		n, _ := io.Copy(io.Discard, r.Body)
+		received.Add(n)
+	}))
+	defer ts.Close()
+
+	st := New(strings.TrimPrefix(ts.URL, "http://"))
+	st.Duration = 700 * time.Millisecond
+	st.PayloadSize = 64 * 1024
+	speed, err := st.measureUpload(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if speed <= 0 {
+		t.Errorf("speed = %v, want > 0", speed)
+	}
+	if requests.Load() != 1 {
+		t.Errorf("requests = %d, want 1", requests.Load())
+	}
+	if received.Load() == 0 {
+		t.Error("server received nothing")
+	}
+}
+
 func TestRun(t *testing.T) {
 	// Test that Run returns a result even on connection failure
 	st := New("invalid-host-that-does-not-exist.local:99999")
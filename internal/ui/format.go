@@ -2,43 +2,175 @@ package ui
 
 import (
 	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
+	"unicode/utf8"
 )
 
-// FormatBytes formats bytes into human-readable string with appropriate units (e.g., "1.5 MB")
-func FormatBytes(bytes int64) string {
-	const unit = 1024
-	if bytes < unit {
-		return fmt.Sprintf("%d B", bytes)
+// binaryUnits and decimalUnits label each step above plain bytes, bitUnits
+// each step above plain bits per second
+var (
+	binaryUnits  = []string{"KiB", "MiB", "GiB", "TiB", "PiB", "EiB"}
+	decimalUnits = []string{"kB", "MB", "GB", "TB", "PB", "EB"}
+	bitUnits     = []string{"kbps", "Mbps", "Gbps", "Tbps", "Pbps", "Ebps"}
+)
+
+// byteFormat is what ByteOptions configure
+type byteFormat struct {
+	base      float64
+	plain     string // Unit below base
+	units     []string
+	precision int
+}
+
+// ByteOption changes how FormatBytes and FormatBytesPerSec print a value
+type ByteOption func(*byteFormat)
+
+// DecimalUnits counts in powers of 1000 (kB, MB, GB) instead of 1024 (KiB,
+// MiB, GiB), e.g. to match a disk vendor's figures
+func DecimalUnits() ByteOption {
+	return func(f *byteFormat) {
+		f.base, f.units = 1000, decimalUnits
 	}
-	div, exp := int64(unit), 0
-	for n := bytes / unit; n >= unit; n /= unit {
-		div *= unit
-		exp++
+}
+
+// Precision sets the digits after the decimal point, 1 by default. Plain
+// byte counts are always whole.
+func Precision(digits int) ByteOption {
+	return func(f *byteFormat) {
+		f.precision = max(digits, 0)
 	}
-	return fmt.Sprintf("%.1f %cB", float64(bytes)/float64(div), "KMGTPE"[exp])
 }
 
-// FormatSpeed formats bytes per second into human-readable string (e.g., "10.5 MB/s")
-func FormatSpeed(bytesPerSec float64) string {
-	const unit = 1024
-	if bytesPerSec < unit {
-		return fmt.Sprintf("%.0f B/s", bytesPerSec)
+// FormatBytes formats a size with binary units (e.g., "1.5 MiB"). Sizes and
+// byte rates use binary units everywhere; bit rates such as --rate-limit and
+// speedtest results are decimal Mbps. Speeds shown to the user go through
+// FormatSpeed, which picks one or the other.
+func FormatBytes(bytes int64, opts ...ByteOption) string {
+	return formatUnits(float64(bytes), "", opts)
+}
+
+// FormatBytesPerSec formats a transfer rate in bytes per second with the same
+// units as FormatBytes (e.g., "10.5 MiB/s")
+func FormatBytesPerSec(bytesPerSec float64, opts ...ByteOption) string {
+	return formatUnits(bytesPerSec, "/s", opts)
+}
+
+// SpeedUnits is how speeds are shown: as bit rates, the networking
+// convention that link speeds and --rate-limit use, or as byte rates that
+// compare directly with file sizes
+type SpeedUnits string
+
+const (
+	// SpeedBits shows decimal bit rates, e.g. "688.0 Mbps"
+	SpeedBits SpeedUnits = "bits"
+	// SpeedBytes shows binary byte rates, e.g. "82.0 MiB/s"
+	SpeedBytes SpeedUnits = "bytes"
+)
+
+// ParseSpeedUnits validates a speed_units value; empty means bits
+func ParseSpeedUnits(s string) (SpeedUnits, error) {
+	switch u := SpeedUnits(s); u {
+	case "":
+		return SpeedBits, nil
+	case SpeedBits, SpeedBytes:
+		return u, nil
 	}
+	return "", fmt.Errorf("invalid speed units %q (want bits or bytes)", s)
+}
 
-	units := []string{"KB/s", "MB/s", "GB/s", "TB/s"}
-	div := bytesPerSec
-	unitIndex := -1
+// speedInBytes is the preference FormatSpeed follows, set once at startup
+var speedInBytes atomic.Bool
 
-	for div >= unit && unitIndex < len(units)-1 {
-		div /= unit
-		unitIndex++
+// SetSpeedUnits sets the units FormatSpeed shows from now on
+func SetSpeedUnits(u SpeedUnits) {
+	speedInBytes.Store(u == SpeedBytes)
+}
+
+// CurrentSpeedUnits returns the units FormatSpeed shows
+func CurrentSpeedUnits() SpeedUnits {
+	if speedInBytes.Load() {
+		return SpeedBytes
 	}
+	return SpeedBits
+}
 
-	if unitIndex >= 0 && unitIndex < len(units) {
-		return fmt.Sprintf("%.1f %s", div, units[unitIndex])
+// FormatSpeed formats a transfer rate in bytes per second in the user's
+// preferred units, SpeedBits unless SetSpeedUnits said otherwise
+func FormatSpeed(bytesPerSec float64) string {
+	return FormatSpeedPref(bytesPerSec, CurrentSpeedUnits())
+}
+
+// FormatSpeedPref formats a transfer rate in bytes per second in units:
+// "688.0 Mbps" as bits, "82.0 MiB/s" as bytes. The unit is always spelled
+// out, so the two can't be mistaken for each other.
+func FormatSpeedPref(bytesPerSec float64, units SpeedUnits) string {
+	if units == SpeedBytes {
+		return FormatBytesPerSec(bytesPerSec)
 	}
-	return fmt.Sprintf("%.1f B/s", bytesPerSec)
+	return formatUnits(bytesPerSec*8, "", []ByteOption{func(f *byteFormat) {
+		f.base, f.plain, f.units = 1000, "bps", bitUnits
+	}})
+}
+
+func formatUnits(v float64, suffix string, opts []ByteOption) string {
+	f := byteFormat{base: 1024, plain: "B", units: binaryUnits, precision: 1}
+	for _, opt := range opts {
+		opt(&f)
+	}
+	if v < f.base {
+		return fmt.Sprintf("%.0f %s%s", v, f.plain, suffix)
+	}
+	exp := -1
+	// Step up while the value would round to a whole next unit, so
+	// 1048575 bytes reads "1.0 MiB" rather than "1024.0 KiB"
+	half := 0.5 / math.Pow(10, float64(f.precision))
+	for v+half >= f.base && exp < len(f.units)-1 {
+		v /= f.base
+		exp++
+	}
+	return fmt.Sprintf("%.*f %s%s", f.precision, v, f.units[exp], suffix)
+}
+
+// ParseBytes reads a size such as "10GB", "1.5 GiB", "500M" or "4096".
+// kB, MB, GB and TB are powers of 1000; KiB, MiB, GiB, TiB and the bare
+// letters K, M, G, T are powers of 1024. Case doesn't matter.
+func ParseBytes(s string) (int64, error) {
+	num := strings.TrimSpace(s)
+	i := strings.IndexFunc(num, func(r rune) bool { return (r < '0' || r > '9') && r != '.' })
+	unit := ""
+	if i >= 0 {
+		num, unit = strings.TrimSpace(num[:i]), strings.ToLower(strings.TrimSpace(num[i:]))
+	}
+	v, err := strconv.ParseFloat(num, 64)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("invalid size %q: want a number with an optional unit, e.g. 10GB", s)
+	}
+	mult := float64(1)
+	switch {
+	case unit == "" || unit == "b":
+	case len(unit) == 1 || (len(unit) == 3 && strings.HasSuffix(unit, "ib")):
+		exp := strings.IndexByte("kmgt", unit[0])
+		if exp < 0 {
+			return 0, fmt.Errorf("invalid size %q: unknown unit %q", s, unit)
+		}
+		mult = math.Pow(1024, float64(exp+1))
+	case len(unit) == 2 && unit[1] == 'b':
+		exp := strings.IndexByte("kmgt", unit[0])
+		if exp < 0 {
+			return 0, fmt.Errorf("invalid size %q: unknown unit %q", s, unit)
+		}
+		mult = math.Pow(1000, float64(exp+1))
+	default:
+		return 0, fmt.Errorf("invalid size %q: unknown unit %q", s, unit)
+	}
+	if v*mult >= math.MaxInt64 {
+		return 0, fmt.Errorf("invalid size %q: too large", s)
+	}
+	return int64(v * mult), nil
 }
 
 // FormatDuration formats a duration into human-readable string (e.g., "2m30s", "1h05m00s")
@@ -57,3 +189,70 @@ func FormatDuration(d time.Duration) string {
 	}
 	return fmt.Sprintf("%ds", s)
 }
+
+// FormatEstimate describes a predicted duration loosely, since it is only a
+// guess (e.g., "under a minute", "~14 minutes", "~2.5 hours")
+func FormatEstimate(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return "under a minute"
+	case d < time.Hour:
+		m := int(math.Round(d.Minutes()))
+		if m == 1 {
+			return "~1 minute"
+		}
+		return fmt.Sprintf("~%d minutes", m)
+	}
+	return fmt.Sprintf("~%.1f hours", d.Hours())
+}
+
+// TruncateName shortens name to at most n characters, ending it with an
+// ellipsis. It cuts between runes, so a multi-byte name never turns into
+// mojibake.
+func TruncateName(name string, n int) string {
+	if utf8.RuneCountInString(name) <= n {
+		return name
+	}
+	if n <= 0 {
+		return ""
+	}
+	runes := []rune(name)
+	return string(runes[:n-1]) + "…"
+}
+
+// RetransmitHintRatio is the share of chunks sent more than once above which
+// summaries suggest a smaller chunk size
+const RetransmitHintRatio = 0.10
+
+// FormatRetransmits describes chunks that crossed the network more than once
+// (e.g., "3 chunks retransmitted, 6.0 MiB wasted")
+func FormatRetransmits(chunks int, wasted int64) string {
+	noun := "chunks"
+	if chunks == 1 {
+		noun = "chunk"
+	}
+	return fmt.Sprintf("%d %s retransmitted, %s wasted", chunks, noun, FormatBytes(wasted))
+}
+
+// SlowStartThreshold is the time to first byte above which, when the first
+// byte also took longer than the rest of the transfer, summaries suggest
+// precomputing the checksum
+const SlowStartThreshold = time.Second
+
+// FormatTiming splits a transfer's duration at its first byte (e.g., "TTFB
+// 4.2s, transfer 18.1s")
+func FormatTiming(ttfb, transfer time.Duration) string {
+	return fmt.Sprintf("TTFB %.1fs, transfer %.1fs", ttfb.Seconds(), transfer.Seconds())
+}
+
+// SlowStart reports whether a transfer waited longer than SlowStartThreshold
+// for its first byte, and longer than its bytes then took
+func SlowStart(ttfb, transfer time.Duration) bool {
+	return ttfb > SlowStartThreshold && ttfb > transfer
+}
+
+// HighRetransmitRatio reports whether more than RetransmitHintRatio of total
+// chunks were retransmitted
+func HighRetransmitRatio(retransmitted, total int) bool {
+	return total > 0 && float64(retransmitted) > RetransmitHintRatio*float64(total)
+}
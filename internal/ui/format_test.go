@@ -0,0 +1,262 @@
+package ui
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestFormatBytes(t *testing.T) {
+	tests := []struct {
+		bytes   int64
+		binary  string
+		decimal string
+	}{
+		{0, "0 B", "0 B"},
+		{999, "999 B", "999 B"},
+		{1000, "1000 B", "1.0 kB"},
+		{1023, "1023 B", "1.0 kB"},
+		{1024, "1.0 KiB", "1.0 kB"},
+		{1536, "1.5 KiB", "1.5 kB"},
+		{999_999, "976.6 KiB", "1.0 MB"},
+		{1<<20 - 1, "1.0 MiB", "1.0 MB"},
+		{1 << 20, "1.0 MiB", "1.0 MB"},
+		{1_000_000, "976.6 KiB", "1.0 MB"},
+		{1 << 30, "1.0 GiB", "1.1 GB"},
+		{1 << 40, "1.0 TiB", "1.1 TB"},
+		{1 << 50, "1.0 PiB", "1.1 PB"},
+		{1<<63 - 1, "8.0 EiB", "9.2 EB"},
+	}
+	for _, tt := range tests {
+		if got := FormatBytes(tt.bytes); got != tt.binary {
+			t.Errorf("FormatBytes(%d) = %q, want %q", tt.bytes, got, tt.binary)
+		}
+		if got := FormatBytes(tt.bytes, DecimalUnits()); got != tt.decimal {
+			t.Errorf("FormatBytes(%d, DecimalUnits()) = %q, want %q", tt.bytes, got, tt.decimal)
+		}
+	}
+}
+
+func TestParseBytes(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int64
+	}{
+		{"4096", 4096},
+		{"0", 0},
+		{"512B", 512},
+		{"10GB", 10_000_000_000},
+		{"10gb", 10_000_000_000},
+		{"1.5 GiB", 3 << 29},
+		{"500M", 500 << 20},
+		{"2k", 2048},
+		{"2kB", 2000},
+		{" 1 TB ", 1_000_000_000_000},
+		{"1TiB", 1 << 40},
+	}
+	for _, tt := range tests {
+		got, err := ParseBytes(tt.in)
+		if err != nil || got != tt.want {
+			t.Errorf("ParseBytes(%q) = %d, %v; want %d", tt.in, got, err, tt.want)
+		}
+	}
+	for _, bad := range []string{"", "GB", "-1GB", "10XB", "10 gigabytes", "1e30", "99999999EB", "10PB"} {
+		if _, err := ParseBytes(bad); err == nil {
+			t.Errorf("ParseBytes(%q) accepted", bad)
+		}
+	}
+}
+
+func TestFormatBytesPrecision(t *testing.T) {
+	tests := []struct {
+		bytes int64
+		opts  []ByteOption
+		want  string
+	}{
+		{1536, []ByteOption{Precision(0)}, "2 KiB"},
+		{1536, []ByteOption{Precision(2)}, "1.50 KiB"},
+		{1023, []ByteOption{Precision(2)}, "1023 B"},
+		{1<<20 - 1, []ByteOption{Precision(3)}, "1023.999 KiB"},
+		{1<<20 - 1, []ByteOption{Precision(2)}, "1.00 MiB"},
+		{1_234_567, []ByteOption{DecimalUnits(), Precision(2)}, "1.23 MB"},
+		{1536, []ByteOption{Precision(-1)}, "2 KiB"},
+	}
+	for _, tt := range tests {
+		if got := FormatBytes(tt.bytes, tt.opts...); got != tt.want {
+			t.Errorf("FormatBytes(%d, ...) = %q, want %q", tt.bytes, got, tt.want)
+		}
+	}
+}
+
+func TestFormatBytesPerSec(t *testing.T) {
+	tests := []struct {
+		rate    float64
+		binary  string
+		decimal string
+	}{
+		{0, "0 B/s", "0 B/s"},
+		{1023, "1023 B/s", "1.0 kB/s"},
+		{1024, "1.0 KiB/s", "1.0 kB/s"},
+		{1536, "1.5 KiB/s", "1.5 kB/s"},
+		{1 << 20, "1.0 MiB/s", "1.0 MB/s"},
+		{12.5e6, "11.9 MiB/s", "12.5 MB/s"},
+		{1 << 30, "1.0 GiB/s", "1.1 GB/s"},
+	}
+	for _, tt := range tests {
+		if got := FormatBytesPerSec(tt.rate); got != tt.binary {
+			t.Errorf("FormatBytesPerSec(%g) = %q, want %q", tt.rate, got, tt.binary)
+		}
+		if got := FormatBytesPerSec(tt.rate, DecimalUnits()); got != tt.decimal {
+			t.Errorf("FormatBytesPerSec(%g, DecimalUnits()) = %q, want %q", tt.rate, got, tt.decimal)
+		}
+	}
+}
+
+func TestFormatSpeedPref(t *testing.T) {
+	tests := []struct {
+		rate        float64 // Bytes per second
+		bits, bytes string
+	}{
+		{0, "0 bps", "0 B/s"},
+		{124.875, "999 bps", "125 B/s"},
+		{125, "1.0 kbps", "125 B/s"},
+		{1023, "8.2 kbps", "1023 B/s"},
+		{1024, "8.2 kbps", "1.0 KiB/s"},
+		{124_995, "1.0 Mbps", "122.1 KiB/s"},
+		{86e6, "688.0 Mbps", "82.0 MiB/s"},
+		{125e6, "1.0 Gbps", "119.2 MiB/s"},
+		{1 << 30, "8.6 Gbps", "1.0 GiB/s"},
+	}
+	for _, tt := range tests {
+		if got := FormatSpeedPref(tt.rate, SpeedBits); got != tt.bits {
+			t.Errorf("FormatSpeedPref(%g, bits) = %q, want %q", tt.rate, got, tt.bits)
+		}
+		if got := FormatSpeedPref(tt.rate, SpeedBytes); got != tt.bytes {
+			t.Errorf("FormatSpeedPref(%g, bytes) = %q, want %q", tt.rate, got, tt.bytes)
+		}
+	}
+}
+
+func TestFormatSpeedFollowsPreference(t *testing.T) {
+	t.Cleanup(func() { SetSpeedUnits(SpeedBits) })
+	if got := FormatSpeed(86e6); got != "688.0 Mbps" {
+		t.Errorf("default FormatSpeed = %q, want bits", got)
+	}
+	for _, tt := range []struct {
+		in   string
+		want string
+	}{{"bytes", "82.0 MiB/s"}, {"bits", "688.0 Mbps"}, {"", "688.0 Mbps"}} {
+		u, err := ParseSpeedUnits(tt.in)
+		if err != nil {
+			t.Fatalf("ParseSpeedUnits(%q): %v", tt.in, err)
+		}
+		SetSpeedUnits(u)
+		if got := FormatSpeed(86e6); got != tt.want {
+			t.Errorf("speed_units %q: FormatSpeed = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+	if _, err := ParseSpeedUnits("Mbps"); err == nil {
+		t.Error("ParseSpeedUnits accepted Mbps")
+	}
+}
+
+// TestSpeedsUseFormatSpeed walks the module for speeds formatted by hand,
+// which would ignore speed_units: a format verb followed by a rate unit, or
+// FormatBytesPerSec called anywhere but FormatSpeedPref
+func TestSpeedsUseFormatSpeed(t *testing.T) {
+	handmade := regexp.MustCompile(`%[-+ #0-9.]*[dfgv]\s*(bps|[kKMGTPE]i?(bps|B/s))`)
+	fset := token.NewFileSet()
+	err := filepath.WalkDir(filepath.Join("..", ".."), func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if name := d.Name(); name == "testdata" || (strings.HasPrefix(name, ".") && name != "." && name != "..") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(path, ".go") || strings.HasSuffix(path, "_test.go") {
+			return nil
+		}
+		f, err := parser.ParseFile(fset, path, nil, 0)
+		if err != nil {
+			return err
+		}
+		inFormat := filepath.ToSlash(path) == "../../internal/ui/format.go"
+		ast.Inspect(f, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.BasicLit:
+				if n.Kind == token.STRING && handmade.MatchString(n.Value) {
+					t.Errorf("%s: speed formatted by hand in %s; use ui.FormatSpeed", fset.Position(n.Pos()), n.Value)
+				}
+			case *ast.CallExpr:
+				name := ""
+				switch fn := n.Fun.(type) {
+				case *ast.Ident:
+					name = fn.Name
+				case *ast.SelectorExpr:
+					name = fn.Sel.Name
+				}
+				if name == "FormatBytesPerSec" && !inFormat {
+					t.Errorf("%s: FormatBytesPerSec ignores speed_units; use ui.FormatSpeed", fset.Position(n.Pos()))
+				}
+			}
+			return true
+		})
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFormatEstimate(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{0, "under a minute"},
+		{59 * time.Second, "under a minute"},
+		{80 * time.Second, "~1 minute"},
+		{14*time.Minute + 10*time.Second, "~14 minutes"},
+		{90 * time.Minute, "~1.5 hours"},
+	}
+	for _, tt := range tests {
+		if got := FormatEstimate(tt.d); got != tt.want {
+			t.Errorf("FormatEstimate(%v) = %q, want %q", tt.d, got, tt.want)
+		}
+	}
+}
+
+func TestTruncateName(t *testing.T) {
+	tests := []struct {
+		name string
+		n    int
+		want string
+	}{
+		{"report.pdf", 35, "report.pdf"},
+		{"abcdef", 6, "abcdef"},
+		{"abcdefg", 6, "abcde…"},
+		{"文件名文件名文件名", 5, "文件名文…"},
+		{"naïve café résumé.txt", 10, "naïve caf…"},
+		{"🎉🎉🎉🎉", 3, "🎉🎉…"},
+		{"anything", 0, ""},
+	}
+	for _, tt := range tests {
+		got := TruncateName(tt.name, tt.n)
+		if got != tt.want {
+			t.Errorf("TruncateName(%q, %d) = %q, want %q", tt.name, tt.n, got, tt.want)
+		}
+		if !utf8.ValidString(got) {
+			t.Errorf("TruncateName(%q, %d) split a rune: %q", tt.name, tt.n, got)
+		}
+	}
+}
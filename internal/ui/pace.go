@@ -0,0 +1,119 @@
+package ui
+
+import (
+	"sync"
+	"time"
+)
+
+// Progress pacing: an update roughly every paceFraction of the transfer, or
+// every MaxInterval on a slow one, but never more often than MinInterval
+const (
+	paceFraction       = 0.01
+	DefaultPaceMin     = 50 * time.Millisecond
+	DefaultPaceMax     = 500 * time.Millisecond
+	paceSpeedSmoothing = 0.3 // Weight of the newest sample in the speed average
+)
+
+// ProgressPacer decides when a transfer's progress is worth reporting, so a
+// fast transfer doesn't jump whole megabytes between updates and a slow one
+// doesn't chatter. It keeps a moving-average speed from the byte counts it is
+// shown and aims for an update every 1% of Total or every MaxInterval,
+// whichever comes first. It is safe for concurrent use.
+type ProgressPacer struct {
+	MinInterval time.Duration // Floor between updates
+	MaxInterval time.Duration // Longest gap between updates while bytes move
+
+	mu        sync.Mutex
+	total     int64
+	now       func() time.Time
+	speed     float64 // bytes per second
+	sampledAt time.Time
+	sampled   int64
+	emittedAt time.Time
+	emitted   int64
+}
+
+// NewProgressPacer paces a transfer of total bytes (0 when unknown) using
+// now as its clock; a nil now means time.Now
+func NewProgressPacer(total int64, now func() time.Time) *ProgressPacer {
+	if now == nil {
+		now = time.Now
+	}
+	return &ProgressPacer{MinInterval: DefaultPaceMin, MaxInterval: DefaultPaceMax, total: total, now: now}
+}
+
+// SetTotal changes the expected size, for transfers whose size grows as
+// files are added
+func (p *ProgressPacer) SetTotal(total int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.total = total
+}
+
+// Ready records that current bytes are done and reports whether an update
+// should be emitted now: 1% of Total has passed since the last one, or as long
+// as 1% takes at the average speed. A true result counts as the emitted
+// update. The first call and the call that reaches Total are always ready.
+func (p *ProgressPacer) Ready(current int64) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := p.now()
+	p.sample(current, now)
+
+	since := now.Sub(p.emittedAt)
+	switch {
+	case p.emittedAt.IsZero(), p.total > 0 && current >= p.total && p.emitted < p.total:
+	case since < p.MinInterval:
+		return false
+	case since >= p.interval():
+	case p.total > 0 && float64(current-p.emitted) >= paceFraction*float64(p.total):
+	default:
+		return false
+	}
+	p.emittedAt, p.emitted = now, current
+	return true
+}
+
+// Interval is the expected time to the next update at the current speed,
+// for callers that poll rather than being called on every write
+func (p *ProgressPacer) Interval() time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.interval()
+}
+
+// interval is the time 1% of the transfer takes at the average speed, kept
+// between MinInterval and MaxInterval
+func (p *ProgressPacer) interval() time.Duration {
+	maxGap := max(p.MaxInterval, p.MinInterval)
+	if p.total <= 0 || p.speed <= 0 {
+		return maxGap
+	}
+	d := time.Duration(paceFraction * float64(p.total) / p.speed * float64(time.Second))
+	return min(max(d, p.MinInterval), maxGap)
+}
+
+// sample folds the rate since the previous sample into the moving-average
+// speed. Samples closer than MinInterval are merged into the next one.
+func (p *ProgressPacer) sample(current int64, now time.Time) {
+	if p.sampledAt.IsZero() {
+		p.sampledAt, p.sampled = now, current
+		return
+	}
+	if current < p.sampled {
+		// Restarted; don't count a negative rate
+		p.sampledAt, p.sampled = now, current
+		return
+	}
+	dt := now.Sub(p.sampledAt)
+	if dt < p.MinInterval {
+		return
+	}
+	rate := float64(current-p.sampled) / dt.Seconds()
+	if p.speed == 0 {
+		p.speed = rate
+	} else {
+		p.speed = paceSpeedSmoothing*rate + (1-paceSpeedSmoothing)*p.speed
+	}
+	p.sampledAt, p.sampled = now, current
+}
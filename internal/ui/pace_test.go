@@ -0,0 +1,115 @@
+package ui
+
+import (
+	"testing"
+	"time"
+)
+
+// fakeClock is a manually advanced clock for pacer tests
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) now() time.Time { return c.t }
+
+// paceTransfer feeds a pacer a transfer of total bytes at a steady speed,
+// one write per millisecond, and returns how many updates it allowed
+func paceTransfer(t *testing.T, total int64, bytesPerSec float64) int {
+	t.Helper()
+	clock := &fakeClock{t: time.Date(2026, 3, 10, 9, 0, 0, 0, time.UTC)}
+	p := NewProgressPacer(total, clock.now)
+	perWrite := int64(bytesPerSec / 1000)
+	updates := 0
+	var current int64
+	for {
+		if p.Ready(current) {
+			updates++
+		}
+		if current >= total {
+			return updates
+		}
+		current = min(current+perWrite, total)
+		clock.t = clock.t.Add(time.Millisecond)
+	}
+}
+
+func TestProgressPacerUpdateCounts(t *testing.T) {
+	const (
+		mbps = 1e6 / 8 // bytes per second in one megabit per second
+		mib  = 1 << 20
+	)
+	tests := []struct {
+		name     string
+		total    int64
+		speed    float64
+		min, max int
+	}{
+		// 40s at 2 Mbps: 1% every 0.4s, so the 1% steps set the pace
+		{"slow link", 10 * mib, 2 * mbps, 95, 105},
+		// Over in 90ms with 1% every 0.9ms: the 50ms floor leaves the first,
+		// one midway and the last instead of a flood
+		{"fast link, small file", 10 * mib, 900 * mbps, 2, 4},
+		// 9s at 900 Mbps: about 100 1% steps, one every 90ms
+		{"fast link, large file", 1024 * mib, 900 * mbps, 95, 105},
+		// 5 min at 900 Mbps: 1% takes 3s, so the 500ms ceiling keeps updates coming
+		{"fast link, huge file", 32 * 1024 * mib, 900 * mbps, 500, 650},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := paceTransfer(t, tt.total, tt.speed); got < tt.min || got > tt.max {
+				t.Errorf("%d updates, want %d-%d", got, tt.min, tt.max)
+			}
+		})
+	}
+}
+
+func TestProgressPacerInterval(t *testing.T) {
+	clock := &fakeClock{t: time.Date(2026, 3, 10, 9, 0, 0, 0, time.UTC)}
+	p := NewProgressPacer(100<<20, clock.now) // 1% is 1 MiB
+	if got := p.Interval(); got != DefaultPaceMax {
+		t.Errorf("before any speed sample: %s, want %s", got, DefaultPaceMax)
+	}
+
+	// 4 MiB/s: 1% every 250ms
+	var current int64
+	for range 20 {
+		p.Ready(current)
+		current += 400 << 10
+		clock.t = clock.t.Add(100 * time.Millisecond)
+	}
+	if got := p.Interval(); got < 240*time.Millisecond || got > 260*time.Millisecond {
+		t.Errorf("at 4 MiB/s: %s, want about 250ms", got)
+	}
+
+	p.MinInterval = time.Second
+	if got := p.Interval(); got != time.Second {
+		t.Errorf("with a 1s floor: %s, want 1s", got)
+	}
+}
+
+func TestProgressPacerEdges(t *testing.T) {
+	clock := &fakeClock{t: time.Date(2026, 3, 10, 9, 0, 0, 0, time.UTC)}
+	p := NewProgressPacer(1000, clock.now)
+	if !p.Ready(0) {
+		t.Error("first update not ready")
+	}
+	if p.Ready(500) {
+		t.Error("ready inside the minimum interval")
+	}
+	if !p.Ready(1000) {
+		t.Error("completion not ready")
+	}
+	if p.Ready(1000) {
+		t.Error("completion ready twice")
+	}
+
+	// Unknown size: time alone paces updates
+	p = NewProgressPacer(0, clock.now)
+	p.Ready(0)
+	clock.t = clock.t.Add(DefaultPaceMax - time.Millisecond)
+	if p.Ready(1 << 30) {
+		t.Error("unknown size ready before the maximum interval")
+	}
+	clock.t = clock.t.Add(time.Millisecond)
+	if !p.Ready(1 << 30) {
+		t.Error("unknown size not ready after the maximum interval")
+	}
+}
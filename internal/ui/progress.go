@@ -1,7 +1,7 @@
 package ui
 
 import (
-	"fmt"
+	"errors"
 	"io"
 	"strings"
 	"time"
@@ -19,66 +19,60 @@ func init() {
 	}
 }
 
+// ProgressReader reports bytes read from R to a Renderer. When Renderer is nil
+// and Out is set, an interactive bar is drawn on Out.
 type ProgressReader struct {
 	R         io.Reader
 	Total     int64
 	Current   int64
 	Out       io.Writer
+	Renderer  Renderer
+	Name      string
 	StartTime time.Time
+
+	pacer    *ProgressPacer // Paces renderer updates
+	complete bool           // R reached EOF; an empty body is 100% done
 }
 
 func (p *ProgressReader) Read(b []byte) (int, error) {
+	if p.Renderer == nil && p.Out != nil {
+		p.Renderer = NewANSIRenderer(p.Out)
+	}
 	// Initialize start time on first read
 	if p.StartTime.IsZero() {
 		p.StartTime = time.Now()
+		if p.Renderer != nil {
+			p.Renderer.Start(p.State())
+		}
 	}
 
 	n, err := p.R.Read(b)
 	p.Current += int64(n)
+	if errors.Is(err, io.EOF) {
+		p.complete = true
+	}
 
-	if p.Total > 0 && p.Out != nil {
-		elapsed := time.Since(p.StartTime)
-		pct := float64(p.Current) / float64(p.Total) * 100.0
-
-		// Calculate ETA
-		var etaStr string
-		if p.Current > 0 && elapsed.Seconds() > 0.5 { // Only show ETA after 500ms
-			rate := float64(p.Current) / elapsed.Seconds() // bytes per second
-			remaining := p.Total - p.Current
-			if rate > 0 {
-				etaSec := float64(remaining) / rate
-				eta := time.Duration(etaSec * float64(time.Second))
-				etaStr = FormatDuration(eta)
-			}
-		}
-
-		// Calculate speed
-		speedStr := ""
-		if elapsed.Seconds() > 0 {
-			bytesPerSec := float64(p.Current) / elapsed.Seconds()
-			speedStr = FormatSpeed(bytesPerSec)
+	if p.Renderer != nil {
+		// Callers may set StartTime themselves, so the pacer can't start with it
+		if p.pacer == nil {
+			p.pacer = NewProgressPacer(p.Total, nil)
 		}
-
-		// Format sizes with smarter units
-		currentSize := formatSize(p.Current)
-		totalSize := formatSize(p.Total)
-		elapsedStr := FormatDuration(elapsed)
-
-		// Format progress bar with detailed information
-		if etaStr != "" && speedStr != "" {
-			_, _ = fmt.Fprintf(p.Out, "\r[%s%-*s%s] %s%3.0f%%%s | %s/%s | %s | Time: %s | ETA: %s",
-				Colors.Green, protocol.ProgressBarWidth, bar(pct), Colors.Reset, Colors.Green, pct, Colors.Reset, currentSize, totalSize, speedStr, elapsedStr, etaStr)
-		} else if speedStr != "" {
-			_, _ = fmt.Fprintf(p.Out, "\r[%s%-*s%s] %s%3.0f%%%s | %s/%s | %s | Time: %s",
-				Colors.Green, protocol.ProgressBarWidth, bar(pct), Colors.Reset, Colors.Green, pct, Colors.Reset, currentSize, totalSize, speedStr, elapsedStr)
-		} else {
-			_, _ = fmt.Fprintf(p.Out, "\r[%s%-*s%s] %s%3.0f%%%s | %s/%s",
-				Colors.Green, protocol.ProgressBarWidth, bar(pct), Colors.Reset, Colors.Green, pct, Colors.Reset, currentSize, totalSize)
+		if p.pacer.Ready(p.Current) || err != nil {
+			p.Renderer.Update(p.State())
 		}
 	}
 	return n, err
 }
 
+// State returns the reader's progress as a TransferState
+func (p *ProgressReader) State() TransferState {
+	var elapsed time.Duration
+	if !p.StartTime.IsZero() {
+		elapsed = time.Since(p.StartTime)
+	}
+	return TransferState{Name: p.Name, Current: p.Current, Total: p.Total, Complete: p.complete, Elapsed: elapsed}
+}
+
 // bar creates a progress bar string more efficiently using strings.Repeat
 func bar(pct float64) string {
 	filled := int(pct / 5)
@@ -90,22 +84,3 @@ func bar(pct float64) string {
 	}
 	return progressBars[filled]
 }
-
-// formatSize formats bytes into a human-readable string with appropriate units
-func formatSize(bytes int64) string {
-	const unit = 1024
-	if bytes < unit {
-		return fmt.Sprintf("%d B", bytes)
-	}
-
-	div := int64(unit)
-	exp := 0
-	units := []string{"KB", "MB", "GB", "TB"}
-
-	for bytes >= div*unit && exp < len(units)-1 {
-		div *= unit
-		exp++
-	}
-
-	return fmt.Sprintf("%.1f %s", float64(bytes)/float64(div), units[exp])
-}
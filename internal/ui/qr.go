@@ -3,65 +3,165 @@ package ui
 import (
 	"bufio"
 	"fmt"
-	"os"
-	"strconv"
+	"io"
 	"strings"
 
 	qrcode "github.com/skip2/go-qrcode"
 )
 
-// PrintQR renders a QR code to the terminal as compact ASCII blocks with a border.
-func PrintQR(s string) error {
-	// Use qrcode.Medium for better scannability (was Low for smallest size)
+// QRMode is how PrintQRTo draws a QR code
+type QRMode int
+
+const (
+	// QRAuto picks the largest mode that fits the terminal
+	QRAuto QRMode = iota
+	// QRFull draws each module as two full blocks side by side
+	QRFull
+	// QRHalf packs two rows of modules into each line with ▀ and ▄
+	QRHalf
+	// QRText prints only the URL, for terminals too narrow for a code
+	QRText
+)
+
+// qrQuietZone is the light margin around the code, in modules. The standard
+// asks for 4; scanners read 2 fine and it saves terminal space.
+const qrQuietZone = 2
+
+// ANSI colors that force the contrast whatever the terminal theme
+const (
+	qrLightOnDark = "\033[97;40m"  // bright white blocks on black
+	qrDarkOnLight = "\033[30;107m" // black blocks on bright white
+	qrColorReset  = "\033[0m"
+)
+
+// QROpts controls PrintQRTo
+type QROpts struct {
+	Mode   QRMode
+	Width  int  // Columns available; 0 asks the terminal behind the writer
+	Height int  // Rows available; 0 asks the terminal, and QRAuto only picks QRFull when it knows
+	Invert bool // Draw the dark modules, for terminals with a light background
+	Color  bool // Set the colors with ANSI codes; off draws pure block characters (NO_COLOR)
+}
+
+// qrSize is the width in columns and height in lines of a code of n modules
+// (quiet zone included) drawn in mode
+func qrSize(mode QRMode, n int) (cols, lines int) {
+	switch mode {
+	case QRFull:
+		return 2 * n, n
+	case QRHalf:
+		return n, (n + 1) / 2
+	}
+	return 0, 0
+}
+
+// chooseQRMode returns the largest mode no larger than want that fits a code
+// of n modules into width columns and, for QRFull, height lines
+func chooseQRMode(want QRMode, n, width, height int) QRMode {
+	if want == QRAuto || want == QRFull {
+		cols, lines := qrSize(QRFull, n)
+		if cols <= width && (want == QRFull && height == 0 || lines <= height) {
+			return QRFull
+		}
+	}
+	if want != QRText {
+		if cols, _ := qrSize(QRHalf, n); cols <= width {
+			return QRHalf
+		}
+	}
+	return QRText
+}
+
+// qrMatrix returns the modules of the code for s, true for dark, surrounded
+// by the quiet zone
+func qrMatrix(s string) ([][]bool, error) {
+	// Medium error correction for better scannability
 	qr, err := qrcode.New(s, qrcode.Medium)
 	if err != nil {
-		return err
+		return nil, err
 	}
-
-	// Remove library border - we'll add our own
 	qr.DisableBorder = true
-
 	bm := qr.Bitmap()
+	n := len(bm) + 2*qrQuietZone
+	m := make([][]bool, n)
+	for y := range m {
+		m[y] = make([]bool, n)
+		if y >= qrQuietZone && y < n-qrQuietZone {
+			copy(m[y][qrQuietZone:], bm[y-qrQuietZone])
+		}
+	}
+	return m, nil
+}
 
-	w := len(bm[0])
-	cols := detectTerminalColumns()
-
-	if cols > 0 && w > cols {
-		_, _ = fmt.Fprintf(os.Stdout, "(QR width %d exceeds terminal columns %d)\n", w, cols)
+// PrintQRTo writes a QR code of url to w in the largest mode that fits the
+// terminal, or just the URL with a note when even half blocks are too wide.
+//
+// Blocks are drawn for the light modules, so that the terminal's light text
+// on a dark background reads as dark modules on white. Invert draws the dark
+// modules instead, for light backgrounds. With Color, ANSI colors make either
+// correct on any background.
+func PrintQRTo(w io.Writer, url string, opts QROpts) error {
+	m, err := qrMatrix(url)
+	if err != nil {
+		return err
+	}
+	width, height := opts.Width, opts.Height
+	if width <= 0 {
+		width = TerminalWidth(w)
+	}
+	if height <= 0 {
+		height = TerminalHeight(w)
 	}
 
-	out := bufio.NewWriter(os.Stdout)
+	out := bufio.NewWriter(w)
 	defer func() { _ = out.Flush() }()
 
-	// Print top border
-	border := strings.Repeat("─", w+2)
-	_, _ = out.WriteString("┌" + border + "┐\n")
-
-	h := len(bm)
-
-	// Render with our custom border (Half-blocks)
-	for y := 0; y < h; y += 2 {
-		var b strings.Builder
-		b.WriteString("│ ") // Left border with padding
-		for x := 0; x < w; x++ {
-			top := bm[y][x]
-			bottom := false
-			if y+1 < h {
-				bottom = bm[y+1][x]
+	mode := chooseQRMode(opts.Mode, len(m), width, height)
+	if mode == QRText {
+		cols, _ := qrSize(QRHalf, len(m))
+		_, _ = fmt.Fprintf(out, "%s\n(terminal too narrow for the QR code: it needs %d columns, %d available)\n", url, cols, width)
+		return nil
+	}
+
+	start, end := "", ""
+	if opts.Color {
+		start, end = qrLightOnDark, qrColorReset
+		if opts.Invert {
+			start = qrDarkOnLight
+		}
+	}
+	// drawn reports whether the module at x, y gets a block
+	drawn := func(x, y int) bool {
+		return y < len(m) && m[y][x] == opts.Invert
+	}
+
+	var b strings.Builder
+	for y := 0; y < len(m); y++ {
+		b.Reset()
+		b.WriteString(start)
+		for x := range m[y] {
+			if mode == QRFull {
+				if drawn(x, y) {
+					b.WriteString("██")
+				} else {
+					b.WriteString("  ")
+				}
+				continue
 			}
-			b.WriteRune(pixel(top, bottom))
+			b.WriteRune(halfBlock(drawn(x, y), drawn(x, y+1)))
 		}
-		b.WriteString(" │\n") // Right border with padding
+		b.WriteString(end)
+		b.WriteByte('\n')
 		_, _ = out.WriteString(b.String())
+		if mode == QRHalf {
+			y++
+		}
 	}
-
-	// Print bottom border
-	_, _ = out.WriteString("└" + border + "┘\n")
-
 	return nil
 }
 
-func pixel(top, bottom bool) rune {
+// halfBlock is the character for a module over another
+func halfBlock(top, bottom bool) rune {
 	switch {
 	case top && bottom:
 		return '█' // full block
@@ -73,16 +173,3 @@ func pixel(top, bottom bool) rune {
 		return ' ' // empty
 	}
 }
-
-// detectTerminalColumns returns terminal columns via COLUMNS env var.
-func detectTerminalColumns() int {
-	s := os.Getenv("COLUMNS")
-	if s == "" {
-		return 0
-	}
-	n, err := strconv.Atoi(s)
-	if err != nil || n <= 0 {
-		return 0
-	}
-	return n
-}
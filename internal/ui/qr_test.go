@@ -0,0 +1,146 @@
+package ui
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+const qrTestURL = "http://192.168.1.100:54321/d/3f9a61c2b8e44d0f9a7c5e21b6d84f03"
+
+// decodeQR reads the modules back out of PrintQRTo output without colors,
+// true where a block was drawn
+func decodeQR(t *testing.T, out string, mode QRMode) [][]bool {
+	t.Helper()
+	var m [][]bool
+	for _, line := range strings.Split(strings.TrimSuffix(out, "\n"), "\n") {
+		runes := []rune(line)
+		switch mode {
+		case QRFull:
+			row := make([]bool, 0, len(runes)/2)
+			for i := 0; i < len(runes); i += 2 {
+				row = append(row, runes[i] == '█')
+			}
+			m = append(m, row)
+		case QRHalf:
+			top, bottom := make([]bool, len(runes)), make([]bool, len(runes))
+			for i, r := range runes {
+				top[i] = r == '█' || r == '▀'
+				bottom[i] = r == '█' || r == '▄'
+			}
+			m = append(m, top, bottom)
+		}
+	}
+	return m
+}
+
+func TestPrintQRToModes(t *testing.T) {
+	want, err := qrMatrix(qrTestURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := len(want)
+
+	tests := []struct {
+		name        string
+		opts        QROpts
+		wantMode    QRMode
+		cols, lines int
+	}{
+		{"full when rows and columns fit", QROpts{Width: 2 * n, Height: n}, QRFull, 2 * n, n},
+		{"half when rows are unknown", QROpts{Width: 200, Height: -1}, QRHalf, n, (n + 1) / 2},
+		{"half when rows are short", QROpts{Width: 200, Height: n - 1}, QRHalf, n, (n + 1) / 2},
+		{"half when full is too wide", QROpts{Width: 2*n - 1, Height: 200}, QRHalf, n, (n + 1) / 2},
+		{"forced half", QROpts{Mode: QRHalf, Width: 200, Height: 200}, QRHalf, n, (n + 1) / 2},
+		{"text when too narrow", QROpts{Width: n - 1, Height: 200}, QRText, 0, 2},
+		{"forced full falls back", QROpts{Mode: QRFull, Width: n, Height: 200}, QRHalf, n, (n + 1) / 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if tt.opts.Height < 0 {
+				t.Setenv("LINES", "")
+				tt.opts.Height = 0
+			}
+			if err := PrintQRTo(&buf, qrTestURL, tt.opts); err != nil {
+				t.Fatal(err)
+			}
+			out := buf.String()
+			lines := strings.Split(strings.TrimSuffix(out, "\n"), "\n")
+			if len(lines) != tt.lines {
+				t.Fatalf("%d lines, want %d:\n%s", len(lines), tt.lines, out)
+			}
+			if tt.wantMode == QRText {
+				if lines[0] != qrTestURL || !strings.Contains(lines[1], "too narrow") {
+					t.Errorf("fallback = %q", out)
+				}
+				return
+			}
+			for i, line := range lines {
+				if cols := utf8.RuneCountInString(line); cols != tt.cols || cols > tt.opts.Width {
+					t.Fatalf("line %d is %d columns, want %d within %d", i, cols, tt.cols, tt.opts.Width)
+				}
+			}
+
+			// Light modules are drawn by default
+			got := decodeQR(t, out, tt.wantMode)
+			for y := range want {
+				for x := range want[y] {
+					if got[y][x] == want[y][x] {
+						t.Fatalf("module %d,%d drawn = %v for dark = %v", x, y, got[y][x], want[y][x])
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestPrintQRToInvert(t *testing.T) {
+	want, err := qrMatrix(qrTestURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := PrintQRTo(&buf, qrTestURL, QROpts{Mode: QRFull, Width: 200, Height: 200, Invert: true}); err != nil {
+		t.Fatal(err)
+	}
+	got := decodeQR(t, buf.String(), QRFull)
+	for y := range want {
+		for x := range want[y] {
+			if got[y][x] != want[y][x] {
+				t.Fatalf("module %d,%d drawn = %v, want the dark modules drawn", x, y, got[y][x])
+			}
+		}
+	}
+}
+
+func TestPrintQRToColor(t *testing.T) {
+	for _, invert := range []bool{false, true} {
+		var plain, colored bytes.Buffer
+		opts := QROpts{Mode: QRHalf, Width: 200, Height: 200, Invert: invert}
+		if err := PrintQRTo(&plain, qrTestURL, opts); err != nil {
+			t.Fatal(err)
+		}
+		opts.Color = true
+		if err := PrintQRTo(&colored, qrTestURL, opts); err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(plain.String(), "\033[") {
+			t.Error("ANSI codes without Color")
+		}
+		start := qrLightOnDark
+		if invert {
+			start = qrDarkOnLight
+		}
+		plainLines := strings.Split(plain.String(), "\n")
+		for i, line := range strings.Split(colored.String(), "\n") {
+			if line == "" {
+				continue
+			}
+			if line != start+plainLines[i]+qrColorReset {
+				t.Fatalf("invert %v, line %d = %q", invert, i, line)
+			}
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package ui
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Renderer displays transfer progress. Transfer code reports state through it
+// and never writes progress escape codes itself, so the same transfer can be
+// shown as an interactive bar, periodic log lines or JSON.
+type Renderer interface {
+	// Start is called once before the first Update
+	Start(TransferState)
+	// Update reports new progress; callers may call it often
+	Update(TransferState)
+	// Finish is called once when the transfer is done
+	Finish(Summary)
+}
+
+// StatusRenderer is implemented by interactive renderers that can keep a
+// one-line status in place, such as a sender's download count. Finish ends
+// the line.
+type StatusRenderer interface {
+	Status(line string)
+}
+
+// TransferState is a point-in-time view of a transfer
+type TransferState struct {
+	Name     string        // File name, or a label for a multi-file transfer
+	Current  int64         // Bytes transferred so far
+	Total    int64         // Bytes expected; 0 when unknown
+	Complete bool          // Every byte has arrived; 100% even when Total is 0
+	Elapsed  time.Duration // Time since the transfer started
+	Detail   string        // Extra status such as chunk counts; may be empty
+	Files    []FileState   // Per-file rows for multi-file transfers; empty for a single file
+	Title    string        // Heading of the per-file block; "Receiving N file(s)" when empty
+}
+
+// FileState is one file's row in a multi-file transfer
+type FileState struct {
+	Name     string
+	Current  int64
+	Total    int64
+	Complete bool
+	Speed    float64       // Bytes per second; the average once Complete
+	ETA      time.Duration // Estimated time left; 0 when unknown or Complete
+	Elapsed  time.Duration // Time spent on this file so far, or in total once Complete
+}
+
+// Summary is shown once a transfer finishes. A Summary with an empty Title
+// only ends the progress display. Title and labels are written in English,
+// as JSON output keeps them; the text renderers translate them with
+// i18n.Label.
+type Summary struct {
+	Title  string
+	Fields []Field
+}
+
+// Field is one labelled line of a Summary
+type Field struct {
+	Label string
+	Value string
+}
+
+// Percent returns completion in the range 0-100
+func (s TransferState) Percent() float64 {
+	if s.Complete {
+		return 100
+	}
+	if s.Total <= 0 {
+		return 0
+	}
+	return clampPercent(float64(s.Current) / float64(s.Total) * 100)
+}
+
+// Speed returns the average rate in bytes per second
+func (s TransferState) Speed() float64 {
+	if s.Elapsed <= 0 {
+		return 0
+	}
+	return float64(s.Current) / s.Elapsed.Seconds()
+}
+
+// ETA estimates the remaining time, or 0 when it can't be estimated yet
+func (s TransferState) ETA() time.Duration {
+	speed := s.Speed()
+	if speed <= 0 || s.Total <= 0 || s.Elapsed < 500*time.Millisecond {
+		return 0
+	}
+	return time.Duration(float64(s.Total-s.Current) / speed * float64(time.Second))
+}
+
+// Percent returns the file's completion in the range 0-100
+func (f FileState) Percent() float64 {
+	if f.Complete {
+		return 100
+	}
+	if f.Total <= 0 {
+		return 0
+	}
+	return clampPercent(float64(f.Current) / float64(f.Total) * 100)
+}
+
+func clampPercent(p float64) float64 {
+	if p < 0 {
+		return 0
+	}
+	if p > 100 {
+		return 100
+	}
+	return p
+}
+
+// ProgressMode is how a command shows progress, set with --progress
+type ProgressMode string
+
+const (
+	ProgressAuto  ProgressMode = "auto"  // Bar on a terminal, plain lines otherwise
+	ProgressBar   ProgressMode = "bar"   // Interactive bar even when not a terminal
+	ProgressPlain ProgressMode = "plain" // A line every DefaultPlainInterval
+	ProgressNone  ProgressMode = "none"  // Only the final summary
+)
+
+// ParseProgressMode validates a --progress value; empty means auto
+func ParseProgressMode(s string) (ProgressMode, error) {
+	switch m := ProgressMode(s); m {
+	case "":
+		return ProgressAuto, nil
+	case ProgressAuto, ProgressBar, ProgressPlain, ProgressNone:
+		return m, nil
+	}
+	return "", fmt.Errorf("unknown progress mode %q (want auto, bar, plain or none)", s)
+}
+
+// NewRenderer picks a renderer for out: JSON lines when jsonOutput is set, the
+// interactive ANSI display for terminals, and periodic plain lines otherwise
+// (pipes, CI logs)
+func NewRenderer(out io.Writer, jsonOutput bool) Renderer {
+	return NewModeRenderer(out, jsonOutput, ProgressAuto)
+}
+
+// NewModeRenderer is NewRenderer with the choice between bar and plain lines
+// overridden by mode. JSON output takes precedence over mode.
+func NewModeRenderer(out io.Writer, jsonOutput bool, mode ProgressMode) Renderer {
+	switch {
+	case jsonOutput:
+		return NewJSONRenderer(out)
+	case mode == ProgressNone:
+		return summaryRenderer{NewPlainRenderer(out, DefaultPlainInterval)}
+	case mode == ProgressBar, mode != ProgressPlain && IsTerminal(out):
+		return NewANSIRenderer(out)
+	default:
+		return NewPlainRenderer(out, DefaultPlainInterval)
+	}
+}
+
+// IsTerminal reports whether w is a character device such as a TTY
+func IsTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return fi.Mode()&os.ModeCharDevice != 0
+}
+
+// DefaultTerminalWidth is assumed when the terminal size can't be determined
+const DefaultTerminalWidth = 80
+
+// envTerminalWidth reads $COLUMNS, falling back to DefaultTerminalWidth
+func envTerminalWidth() int {
+	if n, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && n > 0 {
+		return n
+	}
+	return DefaultTerminalWidth
+}
+
+// envTerminalHeight reads $LINES, or 0 when it is unset
+func envTerminalHeight() int {
+	if n, err := strconv.Atoi(os.Getenv("LINES")); err == nil && n > 0 {
+		return n
+	}
+	return 0
+}
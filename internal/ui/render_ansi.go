@@ -0,0 +1,185 @@
+package ui
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/zulfikawr/warp/internal/i18n"
+	"github.com/zulfikawr/warp/internal/protocol"
+)
+
+// summaryRule frames the summary block printed by the ANSI renderer
+const summaryRule = "━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━"
+
+// Multi-file row layout: name, bar and percentage, then right-aligned speed
+// and ETA columns that are dropped (ETA first) when the terminal is too narrow
+const (
+	fileNameWidth    = 39
+	fileRowBaseWidth = fileNameWidth + len(" [") + protocol.ProgressBarWidth + len("] ") + len("100%")
+	speedColumnWidth = 13 // " 1023.9 MiB/s"
+	etaColumnWidth   = 16 // "  ETA 10h05m00s"
+)
+
+// ANSIRenderer draws an in-place progress bar for a single file, or a redrawn
+// block of per-file bars for multi-file transfers
+type ANSIRenderer struct {
+	mu        sync.Mutex
+	out       io.Writer
+	width     func() int // Terminal columns, queried on every redraw
+	lines     int        // Lines of the last multi-file block, to move back up over
+	inlineBar bool       // A single-file bar is on the current line
+}
+
+// NewANSIRenderer returns an interactive renderer writing to out
+func NewANSIRenderer(out io.Writer) *ANSIRenderer {
+	return &ANSIRenderer{out: out, width: func() int { return TerminalWidth(out) }}
+}
+
+// Start implements Renderer
+func (r *ANSIRenderer) Start(TransferState) {}
+
+// Update implements Renderer
+func (r *ANSIRenderer) Update(s TransferState) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(s.Files) > 0 {
+		r.drawFiles(s)
+		return
+	}
+	r.drawBar(s)
+}
+
+// drawBar rewrites the current line with a single progress bar
+func (r *ANSIRenderer) drawBar(s TransferState) {
+	if s.Total <= 0 && !s.Complete {
+		return
+	}
+	pct := s.Percent()
+	line := fmt.Sprintf("\r[%s%-*s%s] %s%3.0f%%%s | %s/%s",
+		Colors.Green, protocol.ProgressBarWidth, bar(pct), Colors.Reset, Colors.Green, pct, Colors.Reset,
+		FormatBytes(s.Current), FormatBytes(s.Total))
+	if s.Elapsed > 0 {
+		line += fmt.Sprintf(" | %s | Time: %s", FormatSpeed(s.Speed()), FormatDuration(s.Elapsed))
+	}
+	if eta := s.ETA(); eta > 0 {
+		line += " | ETA: " + FormatDuration(eta)
+	}
+	if s.Detail != "" {
+		line += " | " + s.Detail
+	}
+	_, _ = io.WriteString(r.out, line+"\033[K")
+	r.inlineBar = true
+}
+
+// drawFiles redraws the multi-file block in place
+func (r *ANSIRenderer) drawFiles(s TransferState) {
+	var b strings.Builder
+	if r.lines > 0 {
+		fmt.Fprintf(&b, "\033[%dA", r.lines)
+	} else {
+		b.WriteString("\n")
+	}
+
+	width := r.width()
+	if s.Title != "" {
+		fmt.Fprintf(&b, "%s\033[K\n", s.Title)
+	} else {
+		fmt.Fprintf(&b, "Receiving %d file(s) (%s total):\033[K\n", len(s.Files), FormatBytes(s.Total))
+	}
+	for _, f := range s.Files {
+		b.WriteString(fileRow(f, width))
+		b.WriteString("\033[K\n")
+	}
+	b.WriteString("---------------------------------------------------------------------------------\033[K\n")
+
+	pct := s.Percent()
+	fmt.Fprintf(&b, "%sOverall:%s [%s%s%s] %s%3.0f%%%s | %s/%s | %s",
+		Colors.Dim, Colors.Reset,
+		Colors.Green, bar(pct), Colors.Reset,
+		Colors.Green, pct, Colors.Reset,
+		FormatBytes(s.Current), FormatBytes(s.Total),
+		FormatSpeed(s.Speed()))
+	if s.Detail != "" {
+		b.WriteString(" | " + s.Detail)
+	}
+	// Clear what's left of a longer previous block
+	b.WriteString("\033[K\n\033[J")
+
+	_, _ = io.WriteString(r.out, b.String())
+	r.lines = len(s.Files) + 3 // header + files + separator + overall
+}
+
+// Finish implements Renderer
+func (r *ANSIRenderer) Finish(sum Summary) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var b strings.Builder
+	if r.inlineBar {
+		b.WriteString("\n")
+	}
+	r.lines = 0
+	r.inlineBar = false
+	if sum.Title == "" {
+		_, _ = io.WriteString(r.out, b.String())
+		return
+	}
+	fmt.Fprintf(&b, "\n%s%s%s\n", Colors.Dim, summaryRule, Colors.Reset)
+	fmt.Fprintf(&b, "%s✓ %s%s\n\n", Colors.Green, i18n.Label(sum.Title), Colors.Reset)
+	if len(sum.Fields) > 0 {
+		fmt.Fprintf(&b, "%s%s%s\n", Colors.Dim, i18n.T("summary.heading"), Colors.Reset)
+		// Translated labels can be longer than the English ones
+		labels := make([]string, len(sum.Fields))
+		width := 14
+		for i, f := range sum.Fields {
+			labels[i] = i18n.Label(f.Label) + ":"
+			width = max(width, utf8.RuneCountInString(labels[i])+1)
+		}
+		for i, f := range sum.Fields {
+			fmt.Fprintf(&b, "  %s%s%s\n", labels[i], strings.Repeat(" ", width-utf8.RuneCountInString(labels[i])), f.Value)
+		}
+	}
+	fmt.Fprintf(&b, "%s%s%s\n", Colors.Dim, summaryRule, Colors.Reset)
+	_, _ = io.WriteString(r.out, b.String())
+}
+
+// Status implements StatusRenderer by rewriting the current line
+func (r *ANSIRenderer) Status(line string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, _ = io.WriteString(r.out, "\r"+Colors.Dim+line+Colors.Reset+"\033[K")
+	r.inlineBar = true
+}
+
+// fileRow formats one multi-file row to fit in width columns. Active files
+// show their speed and ETA; completed files their average speed and the time
+// they took.
+func fileRow(f FileState, width int) string {
+	name := TruncateName(f.Name, 35)
+	pct := f.Percent()
+	row := fmt.Sprintf("%-*s [%s%s%s] %s%3.0f%%%s",
+		fileNameWidth, name, Colors.Green, bar(pct), Colors.Reset, Colors.Green, pct, Colors.Reset)
+
+	if width < fileRowBaseWidth+speedColumnWidth {
+		return row
+	}
+	speed := "--"
+	if f.Speed > 0 {
+		speed = FormatSpeed(f.Speed)
+	}
+	row += fmt.Sprintf("%*s", speedColumnWidth, speed)
+
+	if width < fileRowBaseWidth+speedColumnWidth+etaColumnWidth {
+		return row
+	}
+	eta := "ETA --"
+	switch {
+	case f.Complete:
+		eta = "took " + FormatDuration(f.Elapsed)
+	case f.ETA > 0:
+		eta = "ETA " + FormatDuration(f.ETA)
+	}
+	return row + fmt.Sprintf("%*s", etaColumnWidth, eta)
+}
@@ -0,0 +1,96 @@
+package ui
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+)
+
+// JSONRenderer writes one JSON object per event, for --json output
+type JSONRenderer struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// jsonEvent is the line format written by JSONRenderer
+type jsonEvent struct {
+	Event       string            `json:"event"` // start, progress or finish
+	Name        string            `json:"name,omitempty"`
+	Current     int64             `json:"current,omitempty"`
+	Total       int64             `json:"total,omitempty"`
+	Percent     float64           `json:"percent,omitempty"`
+	BytesPerSec float64           `json:"bytes_per_sec,omitempty"`
+	ElapsedMs   int64             `json:"elapsed_ms,omitempty"`
+	Detail      string            `json:"detail,omitempty"`
+	Files       []jsonFile        `json:"files,omitempty"`
+	Title       string            `json:"title,omitempty"`
+	Summary     map[string]string `json:"summary,omitempty"`
+}
+
+type jsonFile struct {
+	Name        string  `json:"name"`
+	Current     int64   `json:"current"`
+	Total       int64   `json:"total"`
+	Complete    bool    `json:"complete"`
+	BytesPerSec float64 `json:"bytes_per_sec,omitempty"`
+	EtaMs       int64   `json:"eta_ms,omitempty"`
+	ElapsedMs   int64   `json:"elapsed_ms,omitempty"`
+}
+
+// NewJSONRenderer returns a renderer writing JSON lines to out
+func NewJSONRenderer(out io.Writer) *JSONRenderer {
+	return &JSONRenderer{enc: json.NewEncoder(out)}
+}
+
+// Start implements Renderer
+func (r *JSONRenderer) Start(s TransferState) {
+	r.write(stateEvent("start", s))
+}
+
+// Update implements Renderer
+func (r *JSONRenderer) Update(s TransferState) {
+	r.write(stateEvent("progress", s))
+}
+
+// Finish implements Renderer
+func (r *JSONRenderer) Finish(sum Summary) {
+	ev := jsonEvent{Event: "finish", Title: sum.Title}
+	if len(sum.Fields) > 0 {
+		ev.Summary = make(map[string]string, len(sum.Fields))
+		for _, f := range sum.Fields {
+			ev.Summary[f.Label] = f.Value
+		}
+	}
+	r.write(ev)
+}
+
+func (r *JSONRenderer) write(ev jsonEvent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_ = r.enc.Encode(ev)
+}
+
+func stateEvent(event string, s TransferState) jsonEvent {
+	ev := jsonEvent{
+		Event:       event,
+		Name:        s.Name,
+		Current:     s.Current,
+		Total:       s.Total,
+		Percent:     s.Percent(),
+		BytesPerSec: s.Speed(),
+		ElapsedMs:   s.Elapsed.Milliseconds(),
+		Detail:      s.Detail,
+	}
+	for _, f := range s.Files {
+		ev.Files = append(ev.Files, jsonFile{
+			Name:        f.Name,
+			Current:     f.Current,
+			Total:       f.Total,
+			Complete:    f.Complete,
+			BytesPerSec: f.Speed,
+			EtaMs:       f.ETA.Milliseconds(),
+			ElapsedMs:   f.Elapsed.Milliseconds(),
+		})
+	}
+	return ev
+}
@@ -0,0 +1,116 @@
+package ui
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zulfikawr/warp/internal/i18n"
+)
+
+// DefaultPlainInterval is how often the plain renderer logs progress
+const DefaultPlainInterval = 5 * time.Second
+
+// PlainRenderer writes one progress line every interval and never uses escape
+// codes, for pipes and CI logs
+type PlainRenderer struct {
+	mu       sync.Mutex
+	out      io.Writer
+	interval time.Duration
+	last     time.Time
+	pending  *TransferState   // Latest state skipped by the interval
+	now      func() time.Time // Overridable clock for tests
+}
+
+// NewPlainRenderer returns a renderer that logs at most once per interval
+func NewPlainRenderer(out io.Writer, interval time.Duration) *PlainRenderer {
+	return &PlainRenderer{out: out, interval: interval, now: time.Now}
+}
+
+// Start implements Renderer. The first Update after Start is always logged.
+func (r *PlainRenderer) Start(TransferState) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.last = time.Time{}
+}
+
+// Update implements Renderer
+func (r *PlainRenderer) Update(s TransferState) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := r.now()
+	if !r.last.IsZero() && now.Sub(r.last) < r.interval {
+		r.pending = &s
+		return
+	}
+	r.last = now
+	r.pending = nil
+	_, _ = fmt.Fprintln(r.out, plainLine(s))
+}
+
+// Finish implements Renderer. The last state seen is logged first so the log
+// always ends at 100% even when it fell inside the interval.
+func (r *PlainRenderer) Finish(sum Summary) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.pending != nil {
+		_, _ = fmt.Fprintln(r.out, plainLine(*r.pending))
+		r.pending = nil
+	}
+	if sum.Title == "" {
+		return
+	}
+	_, _ = fmt.Fprintln(r.out, i18n.Label(sum.Title))
+	for _, f := range sum.Fields {
+		_, _ = fmt.Fprintf(r.out, "  %s: %s\n", i18n.Label(f.Label), f.Value)
+	}
+}
+
+// plainLine formats a state as a single log line
+func plainLine(s TransferState) string {
+	parts := []string{fmt.Sprintf("%s: %.0f%%", plainName(s), s.Percent())}
+	if s.Total > 0 || s.Complete {
+		parts = append(parts, FormatBytes(s.Current)+"/"+FormatBytes(s.Total))
+	} else {
+		parts = append(parts, FormatBytes(s.Current))
+	}
+	if s.Elapsed > 0 {
+		parts = append(parts, FormatSpeed(s.Speed()))
+	}
+	if eta := s.ETA(); eta > 0 {
+		parts = append(parts, "ETA "+FormatDuration(eta))
+	}
+	if len(s.Files) > 0 {
+		done := 0
+		for _, f := range s.Files {
+			if f.Complete {
+				done++
+			}
+		}
+		parts = append(parts, fmt.Sprintf("%d/%d files", done, len(s.Files)))
+	}
+	if s.Detail != "" {
+		parts = append(parts, s.Detail)
+	}
+	return strings.Join(parts, " | ")
+}
+
+func plainName(s TransferState) string {
+	if s.Name != "" {
+		return s.Name
+	}
+	return "transfer"
+}
+
+// summaryRenderer shows only a PlainRenderer's final summary
+type summaryRenderer struct {
+	*PlainRenderer
+}
+
+// Start implements Renderer
+func (summaryRenderer) Start(TransferState) {}
+
+// Update implements Renderer
+func (summaryRenderer) Update(TransferState) {}
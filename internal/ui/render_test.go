@@ -0,0 +1,324 @@
+package ui
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zulfikawr/warp/internal/i18n"
+)
+
+func TestPlainRendererThrottlesUpdates(t *testing.T) {
+	out := &bytes.Buffer{}
+	r := NewPlainRenderer(out, 5*time.Second)
+	now := time.Unix(1000, 0)
+	r.now = func() time.Time { return now }
+
+	state := TransferState{Name: "file.bin", Total: 1000, Elapsed: time.Second}
+	r.Start(state)
+	for _, step := range []struct {
+		advance time.Duration
+		current int64
+	}{
+		{0, 100},           // first update is always logged
+		{time.Second, 200}, // within the interval: skipped
+		{5 * time.Second, 600},
+		{time.Second, 1000}, // skipped, but flushed by Finish
+	} {
+		now = now.Add(step.advance)
+		state.Current = step.current
+		r.Update(state)
+	}
+	r.Finish(Summary{Title: "Transfer Complete", Fields: []Field{{Label: "Size", Value: "1000 B"}}})
+
+	got := out.String()
+	if strings.Contains(got, "\033") || strings.Contains(got, "\r") {
+		t.Fatalf("plain output contains control characters: %q", got)
+	}
+	lines := strings.Split(strings.TrimRight(got, "\n"), "\n")
+	want := []string{"file.bin: 10%", "file.bin: 60%", "file.bin: 100%", "Transfer Complete", "  Size: 1000 B"}
+	if len(lines) != len(want) {
+		t.Fatalf("got %d lines, want %d:\n%s", len(lines), len(want), got)
+	}
+	for i, prefix := range want {
+		if !strings.HasPrefix(lines[i], prefix) {
+			t.Errorf("line %d = %q, want prefix %q", i, lines[i], prefix)
+		}
+	}
+}
+
+func TestPlainRendererMultiFile(t *testing.T) {
+	out := &bytes.Buffer{}
+	r := NewPlainRenderer(out, time.Hour)
+	r.Update(TransferState{Name: "2 file(s)", Current: 150, Total: 200, Files: []FileState{
+		{Name: "a", Current: 100, Total: 100, Complete: true},
+		{Name: "b", Current: 50, Total: 100},
+	}})
+	if got := out.String(); !strings.Contains(got, "75%") || !strings.Contains(got, "1/2 files") {
+		t.Fatalf("unexpected line: %q", got)
+	}
+}
+
+func TestJSONRendererEvents(t *testing.T) {
+	out := &bytes.Buffer{}
+	r := NewJSONRenderer(out)
+	r.Start(TransferState{Name: "file.bin", Total: 400})
+	r.Update(TransferState{Name: "file.bin", Current: 100, Total: 400, Elapsed: 2 * time.Second, Detail: "Chunks: 1/4"})
+	r.Update(TransferState{Name: "2 file(s)", Current: 400, Total: 400, Files: []FileState{
+		{Name: "a", Current: 200, Total: 200, Complete: true},
+		{Name: "b", Current: 200, Total: 200, Complete: true},
+	}})
+	r.Finish(Summary{Title: "Upload complete", Fields: []Field{{Label: "Transfer ID", Value: "abc"}}})
+
+	var events []map[string]any
+	sc := bufio.NewScanner(out)
+	for sc.Scan() {
+		var ev map[string]any
+		if err := json.Unmarshal(sc.Bytes(), &ev); err != nil {
+			t.Fatalf("line %q is not JSON: %v", sc.Text(), err)
+		}
+		events = append(events, ev)
+	}
+	if len(events) != 4 {
+		t.Fatalf("got %d events, want 4", len(events))
+	}
+	for i, want := range []string{"start", "progress", "progress", "finish"} {
+		if events[i]["event"] != want {
+			t.Errorf("event %d = %v, want %s", i, events[i]["event"], want)
+		}
+	}
+
+	progress := events[1]
+	if progress["percent"] != 25.0 || progress["bytes_per_sec"] != 50.0 || progress["elapsed_ms"] != 2000.0 {
+		t.Errorf("unexpected progress fields: %v", progress)
+	}
+	if progress["detail"] != "Chunks: 1/4" {
+		t.Errorf("detail = %v", progress["detail"])
+	}
+	if files, _ := events[2]["files"].([]any); len(files) != 2 {
+		t.Errorf("files = %v, want 2 entries", events[2]["files"])
+	}
+	summary, _ := events[3]["summary"].(map[string]any)
+	if events[3]["title"] != "Upload complete" || summary["Transfer ID"] != "abc" {
+		t.Errorf("unexpected finish event: %v", events[3])
+	}
+}
+
+// TestSummaryTranslated checks that the text renderers show a summary in the
+// selected language while JSON keeps the English labels scripts rely on
+func TestSummaryTranslated(t *testing.T) {
+	i18n.SetLocale("id")
+	defer i18n.SetLocale(i18n.DefaultLocale)
+	sum := Summary{Title: "Transfer Complete", Fields: []Field{
+		{Label: "Size", Value: "1000 B"},
+		{Label: "Avg Speed", Value: "1 MB/s"},
+	}}
+
+	var plain bytes.Buffer
+	NewPlainRenderer(&plain, time.Hour).Finish(sum)
+	if want := "Transfer Selesai\n  Ukuran: 1000 B\n  Kecepatan Rata-rata: 1 MB/s\n"; plain.String() != want {
+		t.Errorf("plain summary = %q, want %q", plain.String(), want)
+	}
+
+	var ansi bytes.Buffer
+	NewANSIRenderer(&ansi).Finish(sum)
+	for _, want := range []string{"Ringkasan:", "  Ukuran:              1000 B", "  Kecepatan Rata-rata: 1 MB/s"} {
+		if !strings.Contains(ansi.String(), want) {
+			t.Errorf("ANSI summary lacks %q:\n%s", want, ansi.String())
+		}
+	}
+
+	var js bytes.Buffer
+	NewJSONRenderer(&js).Finish(sum)
+	if !strings.Contains(js.String(), `"title":"Transfer Complete"`) || !strings.Contains(js.String(), `"Avg Speed":"1 MB/s"`) {
+		t.Errorf("JSON summary = %s, want English keys", js.String())
+	}
+}
+
+func TestNewRendererSelection(t *testing.T) {
+	buf := &bytes.Buffer{}
+	if _, ok := NewRenderer(buf, true).(*JSONRenderer); !ok {
+		t.Error("json flag should select the JSON renderer")
+	}
+	if _, ok := NewRenderer(buf, false).(*PlainRenderer); !ok {
+		t.Error("non-terminal output should select the plain renderer")
+	}
+	if _, ok := NewModeRenderer(buf, false, ProgressBar).(*ANSIRenderer); !ok {
+		t.Error("bar mode should select the ANSI renderer even without a terminal")
+	}
+	if _, ok := NewModeRenderer(buf, true, ProgressNone).(*JSONRenderer); !ok {
+		t.Error("json flag should take precedence over the progress mode")
+	}
+}
+
+func TestParseProgressMode(t *testing.T) {
+	for in, want := range map[string]ProgressMode{"": ProgressAuto, "auto": ProgressAuto, "bar": ProgressBar, "plain": ProgressPlain, "none": ProgressNone} {
+		if got, err := ParseProgressMode(in); err != nil || got != want {
+			t.Errorf("ParseProgressMode(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	if _, err := ParseProgressMode("fancy"); err == nil {
+		t.Error("ParseProgressMode accepted an unknown mode")
+	}
+}
+
+// multiFileRun drives r through a multi-file transfer like the host's display
+func multiFileRun(r Renderer) {
+	state := TransferState{Name: "2 file(s)", Total: 200, Files: []FileState{
+		{Name: "a.bin", Total: 100},
+		{Name: "b.bin", Total: 100},
+	}}
+	r.Start(state)
+	for i := int64(1); i <= 10; i++ {
+		state.Current = i * 20
+		state.Elapsed = time.Duration(i) * time.Second
+		state.Files[0].Current = min(i*20, 100)
+		state.Files[0].Complete = i >= 5
+		state.Files[1].Current = max(i*20-100, 0)
+		state.Files[1].Complete = i == 10
+		state.Complete = i == 10
+		r.Update(state)
+	}
+	r.Finish(Summary{Title: "All Downloads Complete", Fields: []Field{{Label: "Files", Value: "2"}}})
+}
+
+func TestNonTerminalOutputHasNoEscapes(t *testing.T) {
+	for _, mode := range []ProgressMode{ProgressAuto, ProgressPlain, ProgressNone} {
+		out := &bytes.Buffer{}
+		multiFileRun(NewModeRenderer(out, false, mode))
+		got := out.String()
+		if strings.ContainsAny(got, "\033\r") {
+			t.Errorf("%s: output contains escape sequences: %q", mode, got)
+		}
+		if !strings.Contains(got, "All Downloads Complete\n  Files: 2\n") {
+			t.Errorf("%s: summary missing from %q", mode, got)
+		}
+		lines := strings.Count(got, "\n")
+		switch mode {
+		case ProgressNone:
+			if lines != 2 {
+				t.Errorf("none: got %d lines, want only the summary:\n%s", lines, got)
+			}
+		default:
+			// The first update and the flushed last one; the rest fall within 5s
+			if !strings.Contains(got, "2 file(s): 100% | 200 B/200 B") || lines > 4 {
+				t.Errorf("%s: want a few plain lines ending at 100%%:\n%s", mode, got)
+			}
+		}
+	}
+
+	// The redrawn ANSI block is only used when asked for
+	out := &bytes.Buffer{}
+	multiFileRun(NewModeRenderer(out, false, ProgressBar))
+	if !strings.Contains(out.String(), "\033[") {
+		t.Error("bar mode didn't draw the interactive display")
+	}
+}
+
+// visible strips ANSI escapes so column widths can be measured
+func visible(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\033' {
+			for i < len(s) && !(s[i] >= 'A' && s[i] <= 'Z' || s[i] >= 'a' && s[i] <= 'z') {
+				i++
+			}
+			continue
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+func TestFileRowColumns(t *testing.T) {
+	active := FileState{Name: "video.mp4", Current: 42, Total: 100, Speed: 11.3 * 1024 * 1024, ETA: 62 * time.Second}
+	done := FileState{Name: "photo.jpg", Current: 100, Total: 100, Complete: true, Speed: 2 * 1024 * 1024, Elapsed: 4 * time.Second}
+
+	tests := []struct {
+		name  string
+		file  FileState
+		width int
+		want  string // expected visible suffix after the percentage
+	}{
+		{"wide shows speed and ETA", active, 120, " 42%    94.8 Mbps       ETA 1m02s"},
+		{"narrow drops ETA first", active, 80, " 42%    94.8 Mbps"},
+		{"too narrow for columns", active, 60, " 42%"},
+		{"completed shows average and time", done, 120, "100%    16.8 Mbps         took 4s"},
+		{"unknown speed", FileState{Name: "a", Total: 10}, 120, "  0%           --          ETA --"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			row := visible(fileRow(tt.file, tt.width))
+			if !strings.HasSuffix(row, tt.want) {
+				t.Errorf("row = %q, want suffix %q", row, tt.want)
+			}
+			if tt.width >= fileRowBaseWidth && len([]rune(row)) > tt.width {
+				t.Errorf("row is %d columns, wider than %d", len([]rune(row)), tt.width)
+			}
+		})
+	}
+}
+
+func TestANSIRendererUsesTerminalWidth(t *testing.T) {
+	out := &bytes.Buffer{}
+	r := NewANSIRenderer(out)
+	r.width = func() int { return 80 }
+	r.Update(TransferState{Total: 100, Current: 42, Files: []FileState{
+		{Name: "video.mp4", Current: 42, Total: 100, Speed: 1024, ETA: time.Minute},
+	}})
+	got := visible(out.String())
+	if !strings.Contains(got, "8.2 kbps") || strings.Contains(got, "ETA") {
+		t.Fatalf("80-column display should show speed but not ETA:\n%s", got)
+	}
+}
+
+func TestANSIRendererStatusLine(t *testing.T) {
+	out := &bytes.Buffer{}
+	var r Renderer = NewANSIRenderer(out)
+	sr, ok := r.(StatusRenderer)
+	if !ok {
+		t.Fatal("ANSIRenderer doesn't implement StatusRenderer")
+	}
+	sr.Status("downloads: 1")
+	sr.Status("downloads: 2")
+	r.Finish(Summary{})
+	got := visible(out.String())
+	if !strings.HasSuffix(got, "\rdownloads: 1\rdownloads: 2\n") {
+		t.Errorf("status output = %q, want each line over the last and a newline at Finish", got)
+	}
+	for _, r := range []Renderer{NewPlainRenderer(out, time.Second), NewJSONRenderer(out)} {
+		if _, ok := r.(StatusRenderer); ok {
+			t.Errorf("%T shows a status line; only interactive renderers should", r)
+		}
+	}
+}
+
+func TestProgressReaderEmptyBodyIsComplete(t *testing.T) {
+	out := &bytes.Buffer{}
+	p := &ProgressReader{R: strings.NewReader(""), Renderer: NewPlainRenderer(out, time.Hour), Name: "empty.txt"}
+	if _, err := io.Copy(io.Discard, p); err != nil {
+		t.Fatal(err)
+	}
+	if got := p.State().Percent(); got != 100 {
+		t.Errorf("Percent() = %v, want 100", got)
+	}
+	if got := out.String(); !strings.Contains(got, "empty.txt: 100%") {
+		t.Errorf("unexpected output: %q", got)
+	}
+}
+
+func TestProgressReaderWithStartTime(t *testing.T) {
+	out := &bytes.Buffer{}
+	p := &ProgressReader{R: strings.NewReader("hello"), Total: 5, Renderer: NewPlainRenderer(out, 0), Name: "resumed.bin",
+		StartTime: time.Now().Add(-time.Second)}
+	if _, err := io.Copy(io.Discard, p); err != nil {
+		t.Fatal(err)
+	}
+	if got := out.String(); !strings.Contains(got, "resumed.bin: 100%") {
+		t.Errorf("unexpected output: %q", got)
+	}
+}
@@ -0,0 +1,15 @@
+//go:build !unix
+
+package ui
+
+import "io"
+
+// TerminalWidth returns $COLUMNS, or DefaultTerminalWidth when it is unset
+func TerminalWidth(io.Writer) int {
+	return envTerminalWidth()
+}
+
+// TerminalHeight returns $LINES, or 0 when it is unset
+func TerminalHeight(io.Writer) int {
+	return envTerminalHeight()
+}
@@ -0,0 +1,32 @@
+//go:build unix
+
+package ui
+
+import (
+	"io"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// TerminalWidth returns the column count of the terminal behind w, falling
+// back to $COLUMNS and then DefaultTerminalWidth
+func TerminalWidth(w io.Writer) int {
+	if f, ok := w.(*os.File); ok {
+		if ws, err := unix.IoctlGetWinsize(int(f.Fd()), unix.TIOCGWINSZ); err == nil && ws.Col > 0 {
+			return int(ws.Col)
+		}
+	}
+	return envTerminalWidth()
+}
+
+// TerminalHeight returns the row count of the terminal behind w, falling back
+// to $LINES, or 0 when it is unknown
+func TerminalHeight(w io.Writer) int {
+	if f, ok := w.(*os.File); ok {
+		if ws, err := unix.IoctlGetWinsize(int(f.Fd()), unix.TIOCGWINSZ); err == nil && ws.Row > 0 {
+			return int(ws.Row)
+		}
+	}
+	return envTerminalHeight()
+}
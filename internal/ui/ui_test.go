@@ -20,3 +20,31 @@ func TestProgressReaderPercentages(t *testing.T) {
 		t.Fatalf("Current=%d want 100", pr.Current)
 	}
 }
+
+func TestFormatRetransmits(t *testing.T) {
+	if got := FormatRetransmits(3, 6<<20); got != "3 chunks retransmitted, 6.0 MiB wasted" {
+		t.Errorf("got %q", got)
+	}
+	if got := FormatRetransmits(1, 512); got != "1 chunk retransmitted, 512 B wasted" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestHighRetransmitRatio(t *testing.T) {
+	tests := []struct {
+		retransmitted, total int
+		want                 bool
+	}{
+		{0, 10, false},
+		{1, 10, false}, // exactly 10% is not above the threshold
+		{2, 10, true},
+		{11, 100, true},
+		{1, 1, true},
+		{3, 0, false},
+	}
+	for _, tt := range tests {
+		if got := HighRetransmitRatio(tt.retransmitted, tt.total); got != tt.want {
+			t.Errorf("HighRetransmitRatio(%d, %d) = %v, want %v", tt.retransmitted, tt.total, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zulfikawr/warp/internal/client"
+	"github.com/zulfikawr/warp/internal/crypto"
+	"github.com/zulfikawr/warp/internal/server"
+	"github.com/zulfikawr/warp/internal/ui"
+)
+
+// proxyServer starts a FaultProxy in front of the server at serverURL and
+// returns it with the URL to reach the server through it
+func proxyServer(t *testing.T, serverURL string) (*FaultProxy, string) {
+	t.Helper()
+	u, err := url.Parse(serverURL)
+	assertNoError(t, err, "Parse server URL")
+	p, err := NewFaultProxy(u.Host)
+	assertNoError(t, err, "Start fault proxy")
+	t.Cleanup(func() { _ = p.Close() })
+	proxied, err := p.Through(serverURL)
+	assertNoError(t, err, "Proxy URL")
+	logInfo(t, "Proxy URL: %s", proxied)
+	return p, proxied
+}
+
+// randomFile writes size random bytes, which the server won't compress, to
+// a file in dir
+func randomFile(t *testing.T, dir, name string, size int) (string, []byte) {
+	t.Helper()
+	data := make([]byte, size)
+	_, err := rand.Read(data)
+	assertNoError(t, err, "Generate test data")
+	path := filepath.Join(dir, name)
+	assertNoError(t, os.WriteFile(path, data, 0o644), "Write test file")
+	return path, data
+}
+
+// uploadedFile reads the single file uploaded into dir
+func uploadedFile(t *testing.T, dir string) []byte {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	assertNoError(t, err, "Read upload directory")
+	if len(entries) != 1 {
+		t.Fatalf("Expected 1 uploaded file, got %d", len(entries))
+	}
+	data, err := os.ReadFile(filepath.Join(dir, entries[0].Name()))
+	assertNoError(t, err, "Read uploaded file")
+	return data
+}
+
+// TestE2E_FaultResumeAfterCut cuts a download mid-stream and checks the next
+// receive picks up where it stopped
+func TestE2E_FaultResumeAfterCut(t *testing.T) {
+	logSection(t, "Fault Injection: Download Cut Mid-Stream")
+
+	const size = 32 << 20
+	src, data := randomFile(t, t.TempDir(), "cut.bin", size)
+
+	tok, _ := crypto.GenerateToken(nil)
+	srv := &server.Server{Token: tok, SrcPath: src}
+	serverURL, err := srv.Start()
+	assertNoError(t, err, "Start server")
+	defer func() { _ = srv.Shutdown() }()
+	proxy, proxied := proxyServer(t, serverURL)
+
+	out := filepath.Join(t.TempDir(), "cut.bin")
+	logTest(t, "Downloading with every connection cut after 20MB")
+	proxy.SetScript(Always(Faults{Down: Fault{DropAfter: 20 << 20}}))
+	if _, err := client.Receive(proxied, out, false, io.Discard, nil); err == nil {
+		t.Fatal("Download succeeded through a cut connection")
+	} else {
+		logInfo(t, "Download failed as expected: %v", err)
+	}
+	fi, err := os.Stat(out)
+	assertNoError(t, err, "Stat partial file")
+	if fi.Size() == 0 || fi.Size() >= size {
+		t.Fatalf("Partial file is %d bytes, want some of %d", fi.Size(), size)
+	}
+	logPass(t, "Kept a partial file of %s", ui.FormatBytes(fi.Size()))
+
+	logTest(t, "Resuming without faults")
+	proxy.SetScript(nil)
+	before := proxy.Stats()
+	_, err = client.Receive(proxied, out, false, io.Discard, nil)
+	assertNoError(t, err, "Resume download")
+
+	got, err := os.ReadFile(out)
+	assertNoError(t, err, "Read downloaded file")
+	if !bytes.Equal(got, data) {
+		t.Fatal("Resumed file does not match the original")
+	}
+	// A restart would have sent the whole file again
+	if sent := proxy.Stats().Down - before.Down; sent >= size {
+		t.Errorf("Resume sent %s, want less than the whole file", ui.FormatBytes(sent))
+	} else {
+		logPass(t, "Resume sent %s of %s", ui.FormatBytes(sent), ui.FormatBytes(size))
+	}
+}
+
+// TestE2E_FaultUploadChunkRetry drops the connection under a chunk of a
+// parallel upload and checks the chunk is sent again
+func TestE2E_FaultUploadChunkRetry(t *testing.T) {
+	logSection(t, "Fault Injection: Chunk Connection Dropped")
+
+	tmpDir := t.TempDir()
+	src, data := randomFile(t, tmpDir, "retry.bin", 10<<20)
+	uploadDir := filepath.Join(tmpDir, "uploads")
+
+	tok, _ := crypto.GenerateToken(nil)
+	srv := &server.Server{Token: tok, HostMode: true, UploadDir: uploadDir}
+	serverURL, err := srv.Start()
+	assertNoError(t, err, "Start server")
+	defer func() { _ = srv.Shutdown() }()
+	proxy, proxied := proxyServer(t, serverURL)
+
+	// The first connection asks for the host's capabilities, then goes back
+	// to the pool and carries a chunk, which it drops halfway
+	proxy.SetScript(func(n int) Faults {
+		if n == 0 {
+			return Faults{Up: Fault{DropAfter: 1 << 20}}
+		}
+		return Faults{}
+	})
+
+	logTest(t, "Uploading 10MB in 2MB chunks with 3 workers")
+	config := &client.UploadConfig{
+		ChunkSize:     2 << 20,
+		MaxConcurrent: 3,
+		RetryAttempts: 2,
+		RetryDelay:    100 * time.Millisecond,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	assertNoError(t, client.ParallelUpload(ctx, proxied, src, config, nil), "Parallel upload")
+
+	assertEqual(t, 1, proxy.Stats().Drops, "Dropped connections")
+	if !bytes.Equal(uploadedFile(t, uploadDir), data) {
+		t.Fatal("Uploaded file does not match the original")
+	}
+	logPass(t, "Dropped chunk was retried and the file arrived intact")
+}
+
+// TestE2E_FaultChecksumMismatch flips a byte on the wire and checks the
+// checksums catch it
+func TestE2E_FaultChecksumMismatch(t *testing.T) {
+	logSection(t, "Fault Injection: Corrupted Byte")
+
+	t.Run("Download", func(t *testing.T) {
+		src, _ := randomFile(t, t.TempDir(), "flip.bin", 4<<20)
+		tok, _ := crypto.GenerateToken(nil)
+		srv := &server.Server{Token: tok, SrcPath: src}
+		serverURL, err := srv.Start()
+		assertNoError(t, err, "Start server")
+		defer func() { _ = srv.Shutdown() }()
+		proxy, proxied := proxyServer(t, serverURL)
+
+		// Well past the response headers, inside the body
+		proxy.SetScript(Always(Faults{Down: Fault{CorruptAt: []int64{2 << 20}}}))
+		out := filepath.Join(t.TempDir(), "flip.bin")
+		logTest(t, "Downloading with one byte flipped")
+		_, err = client.Receive(proxied, out, false, io.Discard, nil)
+		if err == nil || !strings.Contains(err.Error(), "checksum verification failed") {
+			t.Fatalf("Receive = %v, want a checksum mismatch", err)
+		}
+		if _, err := os.Stat(out); !os.IsNotExist(err) {
+			t.Errorf("Corrupted download was kept: %v", err)
+		}
+		logPass(t, "Checksum mismatch detected and the file removed")
+	})
+
+	t.Run("Upload", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		src, _ := randomFile(t, tmpDir, "flip.bin", 4<<20)
+		tok, _ := crypto.GenerateToken(nil)
+		srv := &server.Server{Token: tok, HostMode: true, UploadDir: filepath.Join(tmpDir, "uploads")}
+		serverURL, err := srv.Start()
+		assertNoError(t, err, "Start server")
+		defer func() { _ = srv.Shutdown() }()
+		proxy, proxied := proxyServer(t, serverURL)
+
+		// As in TestE2E_FaultUploadChunkRetry, the first connection goes on to
+		// carry a chunk
+		proxy.SetScript(func(n int) Faults {
+			if n == 0 {
+				return Faults{Up: Fault{CorruptAt: []int64{1 << 20}}}
+			}
+			return Faults{}
+		})
+		logTest(t, "Uploading with one byte of a chunk flipped")
+		config := &client.UploadConfig{
+			ChunkSize:     2 << 20,
+			MaxConcurrent: 2,
+			Verify:        true,
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		err = client.ParallelUpload(ctx, proxied, src, config, nil)
+		if err == nil || !strings.Contains(err.Error(), "checksum verification failed on host") {
+			t.Fatalf("ParallelUpload = %v, want a checksum mismatch", err)
+		}
+		assertEqual(t, 1, proxy.Stats().Corrupted, "Corrupted bytes")
+		logPass(t, "Host caught the corrupted chunk at finalize")
+	})
+}
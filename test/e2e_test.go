@@ -1,24 +1,33 @@
 package test
 
 import (
+	"archive/zip"
+	"bufio"
 	"bytes"
 	"context"
 	"crypto/md5"
 	"crypto/rand"
 	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"mime/multipart"
 	"net/http"
 	"os"
 	"path/filepath"
+	"runtime"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/zulfikawr/warp/cmd/warp/commands"
+	"github.com/zulfikawr/warp/internal/cli"
 	"github.com/zulfikawr/warp/internal/client"
 	"github.com/zulfikawr/warp/internal/crypto"
 	"github.com/zulfikawr/warp/internal/server"
+	"github.com/zulfikawr/warp/internal/ui"
 )
 
 // ANSI color codes for beautiful test output
@@ -61,19 +70,6 @@ func logSection(t *testing.T, title string) {
 	t.Logf("")
 }
 
-func formatBytes(bytes int64) string {
-	const unit = 1024
-	if bytes < unit {
-		return fmt.Sprintf("%d B", bytes)
-	}
-	div, exp := int64(unit), 0
-	for n := bytes / unit; n >= unit; n /= unit {
-		div *= unit
-		exp++
-	}
-	return fmt.Sprintf("%.1f %ciB", float64(bytes)/float64(div), "KMGTPE"[exp])
-}
-
 func assertEqual(t *testing.T, expected, actual interface{}, msg string) {
 	t.Helper()
 	if expected != actual {
@@ -106,7 +102,7 @@ func TestE2E_FileTransfer(t *testing.T) {
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
 			start := time.Now()
-			logTest(t, "Creating test file: %s (%s)", tc.name, formatBytes(int64(tc.size)))
+			logTest(t, "Creating test file: %s (%s)", tc.name, ui.FormatBytes(int64(tc.size)))
 
 			// Prepare source file
 			src, err := os.CreateTemp("", "warp-src-*")
@@ -154,7 +150,7 @@ func TestE2E_FileTransfer(t *testing.T) {
 			mbps := (float64(len(outb)) * 8) / (duration.Seconds() * 1_000_000)
 
 			logPass(t, "Transfer complete: %s in %v (%.1f Mbps)",
-				formatBytes(int64(len(outb))), duration.Round(time.Millisecond), mbps)
+				ui.FormatBytes(int64(len(outb))), duration.Round(time.Millisecond), mbps)
 		})
 	}
 
@@ -342,7 +338,7 @@ func TestE2E_ResumableDownload(t *testing.T) {
 	assertNoError(t, err, "Write test data")
 	_ = src.Close()
 
-	logInfo(t, "Test file: %s", formatBytes(int64(len(data))))
+	logInfo(t, "Test file: %s", ui.FormatBytes(int64(len(data))))
 
 	tok, _ := crypto.GenerateToken(nil)
 	srv := &server.Server{Token: tok, SrcPath: src.Name()}
@@ -368,7 +364,7 @@ func TestE2E_ResumableDownload(t *testing.T) {
 	_ = outPath.Close()
 	assertNoError(t, err, "Write partial data")
 
-	logInfo(t, "Partial download: %s", formatBytes(n))
+	logInfo(t, "Partial download: %s", ui.FormatBytes(n))
 
 	// Verify partial file size
 	fi, err := os.Stat(outName)
@@ -397,7 +393,7 @@ func TestE2E_ResumableDownload(t *testing.T) {
 	outHash := sha256.Sum256(outb)
 	assertEqual(t, srcHash, outHash, "SHA256 checksum")
 
-	logPass(t, "File integrity verified: %s", formatBytes(int64(len(outb))))
+	logPass(t, "File integrity verified: %s", ui.FormatBytes(int64(len(outb))))
 
 	t.Logf("")
 	t.Logf("%s%s✓ Resumable download test passed%s", colorBold, colorGreen, colorReset)
@@ -449,7 +445,7 @@ func TestE2E_DirectoryZipTransfer(t *testing.T) {
 
 	// Verify it's a zip file
 	fi, _ := os.Stat(out)
-	logPass(t, "ZIP downloaded: %s in %v", formatBytes(fi.Size()), duration.Round(time.Millisecond))
+	logPass(t, "ZIP downloaded: %s in %v", ui.FormatBytes(fi.Size()), duration.Round(time.Millisecond))
 
 	if !strings.HasSuffix(out, ".zip") {
 		t.Error("Downloaded file should have .zip extension")
@@ -686,7 +682,7 @@ func TestE2E_ParallelUpload(t *testing.T) {
 		// Calculate throughput
 		mbps := float64(fileSize*8) / (duration.Seconds() * 1_000_000)
 		logPass(t, "Parallel upload complete: %s in %.2fs (%.1f Mbps, %d workers)",
-			formatBytes(fileSize), duration.Seconds(), mbps, config.MaxConcurrent)
+			ui.FormatBytes(fileSize), duration.Seconds(), mbps, config.MaxConcurrent)
 
 		// Verify uploaded file
 		logTest(t, "Verifying uploaded file integrity")
@@ -732,8 +728,8 @@ func TestE2E_Performance(t *testing.T) {
 	}
 
 	for _, size := range sizes {
-		t.Run(fmt.Sprintf("Transfer_%s", formatBytes(size)), func(t *testing.T) {
-			logTest(t, "Performance test: %s", formatBytes(size))
+		t.Run(fmt.Sprintf("Transfer_%s", ui.FormatBytes(size)), func(t *testing.T) {
+			logTest(t, "Performance test: %s", ui.FormatBytes(size))
 
 			src, _ := os.CreateTemp("", "warp-perf-*")
 			defer func() { _ = os.Remove(src.Name()) }()
@@ -759,7 +755,7 @@ func TestE2E_Performance(t *testing.T) {
 			throughput := float64(size) / duration.Seconds() / (1024 * 1024)
 
 			logPass(t, "%s transferred in %v (%.1f Mbps, %.2f MiB/s)",
-				formatBytes(size), duration.Round(time.Millisecond), mbps, throughput)
+				ui.FormatBytes(size), duration.Round(time.Millisecond), mbps, throughput)
 		})
 	}
 
@@ -767,3 +763,559 @@ func TestE2E_Performance(t *testing.T) {
 	t.Logf("%s%s✓ All performance tests passed%s", colorBold, colorGreen, colorReset)
 	t.Logf("")
 }
+
+// TestE2E_PreserveAttributes tests that mtime and mode survive downloads and uploads
+func TestE2E_PreserveAttributes(t *testing.T) {
+	logSection(t, "Preserve Attributes Tests")
+
+	if runtime.GOOS == "windows" {
+		t.Skip("mode bits are not meaningful on windows")
+	}
+
+	tmpDir := t.TempDir()
+	mtime := time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)
+	const mode = os.FileMode(0o751)
+
+	makeFile := func(name string, size int) string {
+		path := filepath.Join(tmpDir, name)
+		data := make([]byte, size)
+		_, _ = rand.Read(data)
+		assertNoError(t, os.WriteFile(path, data, 0o600), "write source file")
+		assertNoError(t, os.Chmod(path, mode), "chmod source file")
+		assertNoError(t, os.Chtimes(path, mtime, mtime), "chtimes source file")
+		return path
+	}
+	checkAttrs := func(t *testing.T, path string) {
+		t.Helper()
+		fi, err := os.Stat(path)
+		assertNoError(t, err, "stat received file")
+		if d := fi.ModTime().Sub(mtime); d > time.Second || d < -time.Second {
+			t.Errorf("mtime = %v, want %v", fi.ModTime().UTC(), mtime)
+		}
+		if fi.Mode().Perm() != mode {
+			t.Errorf("mode = %04o, want %04o", fi.Mode().Perm(), mode)
+		}
+	}
+
+	// 12MB .bin goes through the sendfile path, which writes headers by hand
+	for _, tc := range []struct {
+		name string
+		size int
+	}{{"small.bin", 4 << 10}, {"sendfile.bin", 12 << 20}} {
+		t.Run("Download_"+tc.name, func(t *testing.T) {
+			src := makeFile(tc.name, tc.size)
+			token, _ := crypto.GenerateToken(nil)
+			srv := &server.Server{Token: token, SrcPath: src}
+			url, err := srv.Start()
+			assertNoError(t, err, "start server")
+			defer func() { _ = srv.Shutdown() }()
+
+			d := client.NewDownloader(nil)
+			d.Preserve = true
+			out, err := d.Receive(url, filepath.Join(t.TempDir(), tc.name), true, io.Discard, nil)
+			assertNoError(t, err, "receive")
+			checkAttrs(t, out)
+			logPass(t, "Download kept mtime and mode: %s", tc.name)
+		})
+	}
+
+	t.Run("ParallelUpload", func(t *testing.T) {
+		src := makeFile("upload.bin", 5<<20)
+		uploadDir := t.TempDir()
+		token, _ := crypto.GenerateToken(nil)
+		srv := &server.Server{Token: token, HostMode: true, UploadDir: uploadDir, PreserveAttrs: true}
+		url, err := srv.Start()
+		assertNoError(t, err, "start server")
+		defer func() { _ = srv.Shutdown() }()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		config := &client.UploadConfig{ChunkSize: 1 << 20, MaxConcurrent: 3, RetryAttempts: 2, RetryDelay: 100 * time.Millisecond}
+		assertNoError(t, client.ParallelUpload(ctx, url, src, config, nil), "parallel upload")
+
+		checkAttrs(t, filepath.Join(uploadDir, "upload.bin"))
+		logPass(t, "Upload kept mtime and mode")
+	})
+}
+
+// TestE2E_AsyncUploadVerification tests background checksum verification after parallel uploads
+func TestE2E_AsyncUploadVerification(t *testing.T) {
+	logSection(t, "Async Upload Verification Tests")
+
+	startHost := func(t *testing.T, uploadDir string) (*server.Server, string) {
+		token, _ := crypto.GenerateToken(nil)
+		srv := &server.Server{Token: token, HostMode: true, UploadDir: uploadDir, AsyncVerify: true}
+		url, err := srv.Start()
+		assertNoError(t, err, "start server")
+		t.Cleanup(func() { _ = srv.Shutdown() })
+		return srv, url
+	}
+
+	t.Run("Pass", func(t *testing.T) {
+		uploadDir := t.TempDir()
+		_, url := startHost(t, uploadDir)
+
+		src := filepath.Join(t.TempDir(), "verified.bin")
+		data := make([]byte, 3<<20)
+		_, _ = rand.Read(data)
+		assertNoError(t, os.WriteFile(src, data, 0o644), "write source file")
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		config := &client.UploadConfig{ChunkSize: 1 << 20, MaxConcurrent: 3, RetryAttempts: 1, RetryDelay: 100 * time.Millisecond, Verify: true}
+		assertNoError(t, client.ParallelUpload(ctx, url, src, config, nil), "parallel upload with verification")
+
+		got, err := os.ReadFile(filepath.Join(uploadDir, "verified.bin"))
+		assertNoError(t, err, "read uploaded file")
+		if !bytes.Equal(got, data) {
+			t.Fatal("uploaded file does not match source")
+		}
+		logPass(t, "Async verification passed")
+	})
+
+	t.Run("CorruptionQuarantined", func(t *testing.T) {
+		uploadDir := t.TempDir()
+		_, url := startHost(t, uploadDir)
+
+		data := make([]byte, 64<<10)
+		_, _ = rand.Read(data)
+		sum := sha256.Sum256(data)
+		const sessionID = "corrupt-session-0001"
+
+		req, _ := http.NewRequest(http.MethodPost, url, bytes.NewReader(data))
+		req.Header.Set("X-File-Name", "corrupt.bin")
+		req.Header.Set("X-Upload-Session", sessionID)
+		req.Header.Set("X-Upload-Offset", "0")
+		req.Header.Set("X-Upload-Total", fmt.Sprintf("%d", len(data)))
+		req.Header.Set("X-Chunk-Id", "0")
+		req.Header.Set("X-Chunk-Total", "1")
+		resp, err := http.DefaultClient.Do(req)
+		assertNoError(t, err, "upload chunk")
+		_ = resp.Body.Close()
+		assertEqual(t, http.StatusOK, resp.StatusCode, "chunk status")
+
+		// Flip a byte on disk after the upload completed
+		uploaded := filepath.Join(uploadDir, "corrupt.bin")
+		f, err := os.OpenFile(uploaded, os.O_WRONLY, 0)
+		assertNoError(t, err, "open uploaded file")
+		_, _ = f.WriteAt([]byte{data[100] ^ 0xff}, 100)
+		_ = f.Close()
+
+		req, _ = http.NewRequest(http.MethodPost, url+"/finalize", nil)
+		req.Header.Set("X-Upload-Session", sessionID)
+		req.Header.Set("X-Content-SHA256", hex.EncodeToString(sum[:]))
+		resp, err = http.DefaultClient.Do(req)
+		assertNoError(t, err, "finalize")
+		_ = resp.Body.Close()
+		assertEqual(t, http.StatusAccepted, resp.StatusCode, "finalize status")
+		location := resp.Header.Get("Location")
+		if location == "" {
+			t.Fatal("202 response missing Location")
+		}
+
+		statusURL := url[:strings.Index(url, "/u/")] + location
+		var result struct {
+			Status      string `json:"status"`
+			Quarantined string `json:"quarantined"`
+		}
+		deadline := time.Now().Add(10 * time.Second)
+		for result.Status == "" || result.Status == "pending" {
+			if time.Now().After(deadline) {
+				t.Fatal("verification did not finish")
+			}
+			time.Sleep(50 * time.Millisecond)
+			resp, err := http.Get(statusURL)
+			assertNoError(t, err, "poll verification")
+			err = json.NewDecoder(resp.Body).Decode(&result)
+			_ = resp.Body.Close()
+			assertNoError(t, err, "decode verification status")
+		}
+
+		assertEqual(t, "fail", result.Status, "verification status")
+		if _, err := os.Stat(uploaded); !os.IsNotExist(err) {
+			t.Errorf("corrupted file still in upload dir: %v", err)
+		}
+		if filepath.Dir(filepath.FromSlash(result.Quarantined)) != server.QuarantineDir {
+			t.Errorf("quarantined path = %q, want under %s relative to the upload directory", result.Quarantined, server.QuarantineDir)
+		}
+		if _, err := os.Stat(filepath.Join(uploadDir, filepath.FromSlash(result.Quarantined))); err != nil {
+			t.Errorf("quarantined file missing: %v", err)
+		}
+		logPass(t, "Corrupted upload quarantined: %s", filepath.Base(result.Quarantined))
+	})
+}
+
+// TestE2E_ReturnUpload sends a file with AllowReturn, downloads it, uploads
+// an edited copy back under the same token and checks it lands in ReturnDir
+func TestE2E_ReturnUpload(t *testing.T) {
+	logSection(t, "Return Upload Tests")
+
+	src := filepath.Join(t.TempDir(), "draft.txt")
+	assertNoError(t, os.WriteFile(src, []byte("first draft"), 0o644), "write source file")
+	uploadDir, err := os.MkdirTemp("", "warp-return-*")
+	assertNoError(t, err, "create upload dir")
+	defer func() { _ = os.RemoveAll(uploadDir) }()
+	returnDir := t.TempDir()
+
+	tok, _ := crypto.GenerateToken(nil)
+	srv := &server.Server{Token: tok, SrcPath: src, AllowReturn: true, UploadDir: uploadDir, ReturnDir: returnDir}
+	url, err := srv.Start()
+	assertNoError(t, err, "Start server")
+	defer func() { _ = srv.Shutdown() }()
+
+	logTest(t, "Downloading the original")
+	out := filepath.Join(t.TempDir(), "draft.txt")
+	_, err = client.Receive(url, out, true, io.Discard, nil)
+	assertNoError(t, err, "download")
+	got, _ := os.ReadFile(out)
+	assertEqual(t, "first draft", string(got), "downloaded content")
+
+	logTest(t, "Uploading a reply")
+	returnURL := strings.Replace(url, "/d/", "/u/", 1)
+	req, _ := http.NewRequest(http.MethodPost, returnURL, strings.NewReader("second draft"))
+	req.Header.Set("X-File-Name", "draft.txt")
+	resp, err := http.DefaultClient.Do(req)
+	assertNoError(t, err, "upload reply")
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+	assertEqual(t, http.StatusOK, resp.StatusCode, "upload status")
+
+	assertNoError(t, srv.Shutdown(), "shutdown")
+	returned := srv.Returned()
+	assertEqual(t, 1, len(returned), "returned files")
+	assertEqual(t, filepath.Join(returnDir, "draft.txt"), returned[0], "returned path")
+	got, err = os.ReadFile(returned[0])
+	assertNoError(t, err, "read returned file")
+	assertEqual(t, "second draft", string(got), "returned content")
+	if _, err := os.Stat(uploadDir); !os.IsNotExist(err) {
+		t.Errorf("upload dir still exists after moving everything out: %v", err)
+	}
+	logPass(t, "Reply landed in the return directory")
+}
+
+// TestE2E_EmptyFiles covers zero-byte files and empty directories in both
+// directions
+func TestE2E_EmptyFiles(t *testing.T) {
+	logSection(t, "Empty File Tests")
+
+	t.Run("Send_Receive", func(t *testing.T) {
+		src := filepath.Join(t.TempDir(), "empty.txt")
+		assertNoError(t, os.WriteFile(src, nil, 0o644), "Create empty file")
+
+		tok, _ := crypto.GenerateToken(nil)
+		srv := &server.Server{Token: tok, SrcPath: src}
+		url, err := srv.Start()
+		assertNoError(t, err, "Start server")
+		defer func() { _ = srv.Shutdown() }()
+
+		logTest(t, "Downloading empty file")
+		out, err := client.Receive(url, filepath.Join(t.TempDir(), "empty.txt"), true, io.Discard, nil)
+		assertNoError(t, err, "Download empty file")
+
+		fi, err := os.Stat(out)
+		assertNoError(t, err, "Stat received file")
+		assertEqual(t, int64(0), fi.Size(), "File size")
+		logPass(t, "Empty file received and checksum verified")
+	})
+
+	t.Run("Upload", func(t *testing.T) {
+		src := filepath.Join(t.TempDir(), "empty.txt")
+		assertNoError(t, os.WriteFile(src, nil, 0o644), "Create empty file")
+		uploadDir := t.TempDir()
+
+		tok, _ := crypto.GenerateToken(nil)
+		srv := &server.Server{Token: tok, HostMode: true, UploadDir: uploadDir}
+		url, err := srv.Start()
+		assertNoError(t, err, "Start server")
+		defer func() { _ = srv.Shutdown() }()
+
+		logTest(t, "Uploading empty file")
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		assertNoError(t, client.ParallelUpload(ctx, url, src, nil, nil), "Upload empty file")
+
+		fi, err := os.Stat(filepath.Join(uploadDir, "empty.txt"))
+		assertNoError(t, err, "Stat uploaded file")
+		assertEqual(t, int64(0), fi.Size(), "File size")
+		logPass(t, "Empty file created on the host")
+	})
+
+	t.Run("Directory_Zip", func(t *testing.T) {
+		srcDir := t.TempDir()
+
+		tok, _ := crypto.GenerateToken(nil)
+		srv := &server.Server{Token: tok, SrcPath: srcDir}
+		url, err := srv.Start()
+		assertNoError(t, err, "Start server")
+		defer func() { _ = srv.Shutdown() }()
+
+		logTest(t, "Downloading empty directory as ZIP")
+		out, err := client.Receive(url, filepath.Join(t.TempDir(), "empty.zip"), true, io.Discard, nil)
+		assertNoError(t, err, "Download empty directory")
+
+		zr, err := zip.OpenReader(out)
+		assertNoError(t, err, "Open received zip")
+		defer func() { _ = zr.Close() }()
+		assertEqual(t, 0, len(zr.File), "Zip entries")
+		logPass(t, "Empty directory arrived as a valid empty zip")
+	})
+}
+
+// TestE2E_PushManifest pushes a manifest of three files to a host
+func TestE2E_PushManifest(t *testing.T) {
+	logSection(t, "Manifest Push Tests")
+
+	srcDir := t.TempDir()
+	contents := map[string][]byte{
+		"app.bin":   make([]byte, 3*1024*1024+17),
+		"notes.txt": []byte("release notes\n"),
+		"empty.dat": nil,
+	}
+	_, _ = rand.Read(contents["app.bin"])
+	for name, data := range contents {
+		assertNoError(t, os.WriteFile(filepath.Join(srcDir, name), data, 0o644), "Create "+name)
+	}
+	sum := sha256.Sum256(contents["app.bin"])
+	manifest := filepath.Join(srcDir, "files.yaml")
+	assertNoError(t, os.WriteFile(manifest, []byte(fmt.Sprintf(`files:
+  - path: app.bin
+    name: app-linux
+    sha256: %s
+  - path: notes.txt
+  - path: empty.dat
+`, hex.EncodeToString(sum[:]))), 0o644), "Write manifest")
+
+	uploadDir := t.TempDir()
+	tok, _ := crypto.GenerateToken(nil)
+	srv := &server.Server{Token: tok, HostMode: true, UploadDir: uploadDir}
+	url, err := srv.Start()
+	assertNoError(t, err, "Start server")
+	defer func() { _ = srv.Shutdown() }()
+
+	m, err := client.LoadManifest(manifest)
+	assertNoError(t, err, "Load manifest")
+
+	logTest(t, "Pushing 3 files")
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	p := &client.Pusher{URL: url, Manifest: m, Config: &client.UploadConfig{
+		ChunkSize: 1024 * 1024, MaxConcurrent: 3, RetryAttempts: 2, RetryDelay: 100 * time.Millisecond, Verify: true,
+	}, Parallel: 4}
+	res := p.Run(ctx)
+	assertNoError(t, res.Err(), "Push manifest")
+	assertEqual(t, 3, res.OK, "Files pushed")
+	for _, f := range res.Files {
+		if f.Size > 0 && !f.Verified {
+			t.Errorf("%s was not verified by the host", f.Name)
+		}
+	}
+
+	for name, local := range map[string]string{"app-linux": "app.bin", "notes.txt": "notes.txt", "empty.dat": "empty.dat"} {
+		got, err := os.ReadFile(filepath.Join(uploadDir, name))
+		assertNoError(t, err, "Read uploaded "+name)
+		if !bytes.Equal(got, contents[local]) {
+			t.Errorf("%s: uploaded %d bytes, want %d", name, len(got), len(contents[local]))
+		}
+	}
+
+	out := filepath.Join(t.TempDir(), "result.json")
+	assertNoError(t, res.WriteFile(out), "Write result")
+	var written client.PushResult
+	data, err := os.ReadFile(out)
+	assertNoError(t, err, "Read result")
+	assertNoError(t, json.Unmarshal(data, &written), "Parse result")
+	assertEqual(t, 3, len(written.Files), "Result entries")
+	logPass(t, "3 files pushed, verified and recorded in %s", filepath.Base(out))
+}
+
+// TestE2E_MirrorDirectory mirrors a nested directory share into a destination
+// that already holds one identical and one stale file
+func TestE2E_MirrorDirectory(t *testing.T) {
+	logSection(t, "Directory Mirror Tests")
+
+	srcDir := t.TempDir()
+	structure := map[string]string{
+		"readme.txt":           "top level",
+		"src/main.go":          "package main",
+		"src/util/strings.go":  "package util",
+		"deep/nested/data.bin": strings.Repeat("warp", 4096),
+	}
+	for path, content := range structure {
+		fullPath := filepath.Join(srcDir, filepath.FromSlash(path))
+		assertNoError(t, os.MkdirAll(filepath.Dir(fullPath), 0o755), "Create "+filepath.Dir(path))
+		assertNoError(t, os.WriteFile(fullPath, []byte(content), 0o644), "Write "+path)
+	}
+
+	dest := t.TempDir()
+	same := filepath.Join(dest, "src", "main.go")
+	stale := filepath.Join(dest, "deep", "nested", "data.bin")
+	assertNoError(t, os.MkdirAll(filepath.Dir(same), 0o755), "Create src")
+	assertNoError(t, os.MkdirAll(filepath.Dir(stale), 0o755), "Create deep/nested")
+	assertNoError(t, os.WriteFile(same, []byte(structure["src/main.go"]), 0o644), "Write identical file")
+	assertNoError(t, os.WriteFile(stale, []byte("outdated"), 0o644), "Write stale file")
+	// An mtime in the past shows whether the identical file was rewritten
+	old := time.Now().Add(-time.Hour).Truncate(time.Second)
+	assertNoError(t, os.Chtimes(same, old, old), "Backdate identical file")
+
+	tok, _ := crypto.GenerateToken(nil)
+	srv := &server.Server{Token: tok, SrcPath: srcDir}
+	url, err := srv.Start()
+	assertNoError(t, err, "Start server")
+	defer func() { _ = srv.Shutdown() }()
+
+	logTest(t, "Mirroring %d files with 3 workers", len(structure))
+	results, err := client.NewDownloader(nil).Mirror(url, dest, 3, io.Discard)
+	assertNoError(t, err, "Mirror")
+	assertEqual(t, len(structure), len(results), "Mirrored files")
+	for _, r := range results {
+		assertNoError(t, r.Err, "Mirror "+r.Path)
+		if want := r.Path == "src/main.go"; r.Skipped != want {
+			t.Errorf("%s: skipped = %v, want %v", r.Path, r.Skipped, want)
+		}
+	}
+
+	for path, content := range structure {
+		got, err := os.ReadFile(filepath.Join(dest, filepath.FromSlash(path)))
+		assertNoError(t, err, "Read "+path)
+		if string(got) != content {
+			t.Errorf("%s: got %d bytes, want %d", path, len(got), len(content))
+		}
+	}
+	fi, err := os.Stat(same)
+	assertNoError(t, err, "Stat identical file")
+	if !fi.ModTime().Equal(old) {
+		t.Errorf("Identical file was rewritten: mtime %v, want %v", fi.ModTime(), old)
+	}
+	logPass(t, "Tree mirrored, stale file replaced and identical file left alone")
+}
+
+// TestE2E_SuppliedChecksumMismatch serves a file that isn't the released one.
+// The server's own checksum header matches what it sends, so only the
+// published sums file can catch it.
+func TestE2E_SuppliedChecksumMismatch(t *testing.T) {
+	logSection(t, "Supplied Checksum Tests")
+
+	dir := t.TempDir()
+	released := []byte("the release as published")
+	sum := sha256.Sum256(released)
+	sumsFile := filepath.Join(dir, "SHA256SUMS")
+	assertNoError(t, os.WriteFile(sumsFile, []byte(hex.EncodeToString(sum[:])+"  dist/app.tar.gz\n"), 0o644), "Write sums file")
+
+	src := filepath.Join(dir, "app.tar.gz")
+	assertNoError(t, os.WriteFile(src, []byte("a tampered release"), 0o644), "Write served file")
+	tok, _ := crypto.GenerateToken(nil)
+	srv := &server.Server{Token: tok, SrcPath: src}
+	url, err := srv.Start()
+	assertNoError(t, err, "Start server")
+	defer func() { _ = srv.Shutdown() }()
+
+	sums, err := client.LoadSHA256Sums(sumsFile)
+	assertNoError(t, err, "Load sums file")
+	d := client.NewDownloader(nil)
+	d.SHA256Sums = sums
+	out := filepath.Join(t.TempDir(), "app.tar.gz")
+
+	logTest(t, "Downloading a file that differs from the published checksum")
+	_, err = d.Receive(url, out, false, io.Discard, nil)
+	if !errors.Is(err, client.ErrChecksumMismatch) {
+		t.Fatalf("Receive = %v, want a checksum mismatch", err)
+	}
+	assertEqual(t, commands.ExitChecksumMismatch, commands.ExitCode(err), "Exit status")
+	if _, err := os.Stat(out); !os.IsNotExist(err) {
+		t.Errorf("Mismatched download was kept: %v", err)
+	}
+	logPass(t, "Mismatch detected, file removed, exit status %d", commands.ExitCode(err))
+
+	assertNoError(t, os.WriteFile(src, released, 0o644), "Restore released file")
+	logTest(t, "Downloading the released file")
+	_, err = d.Receive(url, out, false, io.Discard, nil)
+	assertNoError(t, err, "Receive released file")
+	logPass(t, "Released file verified against the sums file")
+}
+
+// TestE2E_HostCompletionFile runs warp host waiting for two uploads, then
+// checks the completion file it leaves behind and that it stopped on its own
+func TestE2E_HostCompletionFile(t *testing.T) {
+	logSection(t, "Host Completion File Tests")
+
+	t.Setenv("HOME", t.TempDir())
+	srcDir, destDir := t.TempDir(), t.TempDir()
+	done := filepath.Join(t.TempDir(), "done.json")
+	contents := map[string][]byte{"a.bin": make([]byte, 256*1024), "b.bin": []byte("second file\n")}
+	_, _ = rand.Read(contents["a.bin"])
+	for name, data := range contents {
+		assertNoError(t, os.WriteFile(filepath.Join(srcDir, name), data, 0o644), "Create "+name)
+	}
+
+	// The host prints its URL on stderr
+	r, w, err := os.Pipe()
+	assertNoError(t, err, "Create pipe")
+	stderr := os.Stderr
+	os.Stderr = w
+	defer func() { os.Stderr = stderr }()
+	urls := make(chan string, 1)
+	go func() {
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			if line := scanner.Text(); strings.HasPrefix(line, "http://") {
+				select {
+				case urls <- line:
+				default:
+				}
+			}
+		}
+	}()
+
+	exited := make(chan error, 1)
+	go func() {
+		exited <- commands.Host(cli.GlobalOptions{}, []string{"-d", destDir, "--no-qr", "--progress", "none",
+			"--expect", "*.bin", "--expect-count", "2", "--completion-file", done, "--exit-when-complete"})
+	}()
+	var url string
+	select {
+	case url = <-urls:
+	case err := <-exited:
+		t.Fatalf("Host exited before serving: %v", err)
+	case <-time.After(10 * time.Second):
+		t.Fatal("Host never printed its URL")
+	}
+	logInfo(t, "Host server URL: %s", url)
+
+	logTest(t, "Uploading the first file")
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	assertNoError(t, client.ParallelUpload(ctx, url, filepath.Join(srcDir, "a.bin"), nil, nil), "Upload a.bin")
+	var report server.CompletionReport
+	deadline := time.Now().Add(5 * time.Second)
+	for len(report.Files) == 0 && time.Now().Before(deadline) {
+		data, _ := os.ReadFile(done)
+		_ = json.Unmarshal(data, &report)
+		time.Sleep(20 * time.Millisecond)
+	}
+	assertEqual(t, 1, len(report.Files), "Files after the first upload")
+	assertEqual(t, false, report.Complete, "Complete after the first upload")
+	logPass(t, "Partial match recorded")
+
+	logTest(t, "Uploading the second file")
+	assertNoError(t, client.ParallelUpload(ctx, url, filepath.Join(srcDir, "b.bin"), nil, nil), "Upload b.bin")
+	select {
+	case err := <-exited:
+		assertNoError(t, err, "Host")
+	case <-time.After(30 * time.Second):
+		t.Fatal("Host still running after both uploads arrived")
+	}
+	_ = w.Close()
+
+	data, err := os.ReadFile(done)
+	assertNoError(t, err, "Read completion file")
+	report = server.CompletionReport{}
+	assertNoError(t, json.Unmarshal(data, &report), "Parse completion file")
+	assertEqual(t, true, report.Complete, "Complete")
+	assertEqual(t, 2, len(report.Files), "Files listed")
+	for _, f := range report.Files {
+		sum := sha256.Sum256(contents[f.Name])
+		assertEqual(t, hex.EncodeToString(sum[:]), f.SHA256, "Checksum of "+f.Name)
+		assertEqual(t, int64(len(contents[f.Name])), f.Size, "Size of "+f.Name)
+	}
+	logPass(t, "Both uploads listed with checksums and the host exited")
+}
@@ -0,0 +1,252 @@
+package test
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Fault is what a FaultProxy does to the bytes flowing one way through a
+// connection. Offsets count from the first byte sent that way.
+type Fault struct {
+	DropAfter   int64         // Close the connection once this many bytes went through; 0 = never
+	CorruptAt   []int64       // Flip every bit of the bytes at these offsets
+	Latency     time.Duration // Hold each read this long before forwarding it
+	BytesPerSec int64         // Bandwidth cap; 0 = unlimited
+}
+
+// Faults are the faults of one connection, client to server (Up) and server
+// to client (Down)
+type Faults struct {
+	Up, Down Fault
+}
+
+// Script picks the faults of the n-th connection a FaultProxy accepts,
+// counting from 0
+type Script func(n int) Faults
+
+// Always is a Script giving every connection the same faults
+func Always(f Faults) Script {
+	return func(int) Faults { return f }
+}
+
+// FaultStats counts what a FaultProxy has done so far
+type FaultStats struct {
+	Conns     int   // Connections accepted
+	Drops     int   // Connections closed by a DropAfter
+	Corrupted int   // Bytes flipped by a CorruptAt
+	Up, Down  int64 // Bytes forwarded each way
+}
+
+// FaultProxy is a TCP proxy for e2e tests. It sits between a client and a
+// server and injects the faults its Script picks for each new connection,
+// so tests can see how transfers survive a cut, a slow link or a bad byte.
+type FaultProxy struct {
+	target string
+	ln     net.Listener
+
+	mu     sync.Mutex
+	script Script
+	stats  FaultStats
+	open   map[net.Conn]struct{}
+	closed bool
+	wg     sync.WaitGroup
+}
+
+// NewFaultProxy starts a proxy on a loopback port that forwards every
+// connection to target (host:port), without faults until SetScript
+func NewFaultProxy(target string) (*FaultProxy, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	p := &FaultProxy{target: target, ln: ln, open: make(map[net.Conn]struct{})}
+	p.wg.Add(1)
+	go p.serve()
+	return p, nil
+}
+
+// Addr is the host:port the proxy listens on
+func (p *FaultProxy) Addr() string {
+	return p.ln.Addr().String()
+}
+
+// Through returns rawURL with its host swapped for the proxy's address
+func (p *FaultProxy) Through(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	u.Host = p.Addr()
+	return u.String(), nil
+}
+
+// SetScript sets the faults of connections accepted from now on; nil
+// forwards them untouched. Open connections keep the faults they started with.
+func (p *FaultProxy) SetScript(s Script) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.script = s
+}
+
+// Stats returns a snapshot of the proxy's counters
+func (p *FaultProxy) Stats() FaultStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.stats
+}
+
+// Close stops accepting, cuts every open connection and waits for them
+func (p *FaultProxy) Close() error {
+	p.mu.Lock()
+	p.closed = true
+	for c := range p.open {
+		_ = c.Close()
+	}
+	p.mu.Unlock()
+	err := p.ln.Close()
+	p.wg.Wait()
+	return err
+}
+
+func (p *FaultProxy) serve() {
+	defer p.wg.Done()
+	for {
+		client, err := p.ln.Accept()
+		if err != nil {
+			return
+		}
+		p.mu.Lock()
+		n := p.stats.Conns
+		p.stats.Conns++
+		var f Faults
+		if p.script != nil {
+			f = p.script(n)
+		}
+		p.mu.Unlock()
+
+		p.wg.Add(1)
+		go p.handle(client, f)
+	}
+}
+
+// track adds c to the open connections, or reports false once Close has run
+func (p *FaultProxy) track(c net.Conn) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return false
+	}
+	p.open[c] = struct{}{}
+	return true
+}
+
+func (p *FaultProxy) untrack(c net.Conn) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.open, c)
+}
+
+// handle forwards one connection both ways until both sides are done or a
+// fault drops it
+func (p *FaultProxy) handle(client net.Conn, f Faults) {
+	defer p.wg.Done()
+	server, err := net.Dial("tcp", p.target)
+	if err != nil {
+		_ = client.Close()
+		return
+	}
+	for _, c := range []net.Conn{client, server} {
+		if !p.track(c) {
+			_ = client.Close()
+			_ = server.Close()
+			return
+		}
+		defer p.untrack(c)
+	}
+
+	var once sync.Once
+	drop := func() {
+		once.Do(func() {
+			_ = client.Close()
+			_ = server.Close()
+		})
+	}
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		p.pipe(server, client, f.Up, &p.stats.Up, drop)
+	}()
+	go func() {
+		defer wg.Done()
+		p.pipe(client, server, f.Down, &p.stats.Down, drop)
+	}()
+	wg.Wait()
+	drop()
+}
+
+// pipe copies src to dst through fault, adding what it forwards to *count.
+// At src's EOF it passes the half-close on; on a drop or an error it closes
+// both sides.
+func (p *FaultProxy) pipe(dst, src net.Conn, fault Fault, count *int64, drop func()) {
+	buf := make([]byte, 32*1024)
+	if fault.BytesPerSec > 0 {
+		// Small reads keep the pace even
+		buf = buf[:min(int64(len(buf)), max(fault.BytesPerSec/20, 1))]
+	}
+	start := time.Now()
+	var off int64
+	for {
+		n, err := src.Read(buf)
+		if n > 0 {
+			if fault.Latency > 0 {
+				time.Sleep(fault.Latency)
+			}
+			chunk := buf[:n]
+			cut := fault.DropAfter > 0 && off+int64(n) >= fault.DropAfter
+			if cut {
+				chunk = chunk[:fault.DropAfter-off]
+			}
+			corrupted := 0
+			for _, at := range fault.CorruptAt {
+				if at >= off && at < off+int64(len(chunk)) {
+					chunk[at-off] ^= 0xff
+					corrupted++
+				}
+			}
+			written, werr := dst.Write(chunk)
+			off += int64(written)
+
+			p.mu.Lock()
+			*count += int64(written)
+			p.stats.Corrupted += corrupted
+			if cut && werr == nil {
+				p.stats.Drops++
+			}
+			p.mu.Unlock()
+
+			if cut || werr != nil {
+				drop()
+				return
+			}
+			if fault.BytesPerSec > 0 {
+				due := time.Duration(float64(off) / float64(fault.BytesPerSec) * float64(time.Second))
+				time.Sleep(due - time.Since(start))
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			if tc, ok := dst.(*net.TCPConn); ok {
+				_ = tc.CloseWrite()
+				return
+			}
+		}
+		if err != nil {
+			drop()
+			return
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package test
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// startFaultProxy proxies to a server that sends payload to every
+// connection, then reads it to the end and hands what it read to received
+func startFaultProxy(t *testing.T, payload []byte) (*FaultProxy, <-chan []byte) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+	received := make(chan []byte, 16)
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer func() { _ = c.Close() }()
+				_, _ = c.Write(payload)
+				_ = c.(*net.TCPConn).CloseWrite()
+				got, _ := io.ReadAll(c)
+				received <- got
+			}()
+		}
+	}()
+
+	p, err := NewFaultProxy(ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = p.Close() })
+	return p, received
+}
+
+// exchange sends up through p and returns what came back down
+func exchange(t *testing.T, p *FaultProxy, up []byte) []byte {
+	t.Helper()
+	c, err := net.Dial("tcp", p.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = c.Close() }()
+	_ = c.SetDeadline(time.Now().Add(10 * time.Second))
+	sent := make(chan struct{})
+	go func() {
+		defer close(sent)
+		_, _ = c.Write(up)
+		_ = c.(*net.TCPConn).CloseWrite()
+	}()
+	down, _ := io.ReadAll(c)
+	<-sent
+	return down
+}
+
+func randomBytes(t *testing.T, n int) []byte {
+	t.Helper()
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestFaultProxyPassThrough(t *testing.T) {
+	payload, up := randomBytes(t, 200_000), randomBytes(t, 150_000)
+	p, received := startFaultProxy(t, payload)
+
+	if down := exchange(t, p, up); !bytes.Equal(down, payload) {
+		t.Errorf("downstream got %d bytes, want the %d sent unchanged", len(down), len(payload))
+	}
+	if got := <-received; !bytes.Equal(got, up) {
+		t.Errorf("upstream got %d bytes, want the %d sent unchanged", len(got), len(up))
+	}
+	st := p.Stats()
+	if st != (FaultStats{Conns: 1, Up: int64(len(up)), Down: int64(len(payload))}) {
+		t.Errorf("stats = %+v", st)
+	}
+}
+
+func TestFaultProxyDropAfter(t *testing.T) {
+	payload := randomBytes(t, 200_000)
+
+	t.Run("down", func(t *testing.T) {
+		p, _ := startFaultProxy(t, payload)
+		p.SetScript(Always(Faults{Down: Fault{DropAfter: 70_001}}))
+		down := exchange(t, p, nil)
+		if !bytes.Equal(down, payload[:70_001]) {
+			t.Errorf("got %d bytes before the drop, want the first 70001", len(down))
+		}
+		if st := p.Stats(); st.Drops != 1 || st.Down != 70_001 {
+			t.Errorf("stats = %+v, want 1 drop after 70001 bytes down", st)
+		}
+	})
+
+	t.Run("up", func(t *testing.T) {
+		p, received := startFaultProxy(t, nil)
+		p.SetScript(Always(Faults{Up: Fault{DropAfter: 1000}}))
+		up := randomBytes(t, 100_000)
+		exchange(t, p, up)
+		if got := <-received; !bytes.Equal(got, up[:1000]) {
+			t.Errorf("server got %d bytes before the drop, want the first 1000", len(got))
+		}
+		if st := p.Stats(); st.Drops != 1 || st.Up != 1000 {
+			t.Errorf("stats = %+v, want 1 drop after 1000 bytes up", st)
+		}
+	})
+
+	t.Run("scripted connection only", func(t *testing.T) {
+		p, _ := startFaultProxy(t, payload)
+		p.SetScript(func(n int) Faults {
+			if n == 1 {
+				return Faults{Down: Fault{DropAfter: 10}}
+			}
+			return Faults{}
+		})
+		for n, want := range []int{len(payload), 10, len(payload)} {
+			if got := len(exchange(t, p, nil)); got != want {
+				t.Errorf("connection %d got %d bytes, want %d", n, got, want)
+			}
+		}
+	})
+}
+
+func TestFaultProxyCorrupt(t *testing.T) {
+	payload := randomBytes(t, 200_000)
+	// The first byte, bytes in different reads and the last byte
+	offsets := []int64{0, 40_000, 150_001, 199_999}
+	p, received := startFaultProxy(t, payload)
+	p.SetScript(Always(Faults{Up: Fault{CorruptAt: []int64{3}}, Down: Fault{CorruptAt: offsets}}))
+
+	up := []byte("hello")
+	down := exchange(t, p, up)
+	if len(down) != len(payload) {
+		t.Fatalf("got %d bytes, want %d", len(down), len(payload))
+	}
+	flipped := make(map[int64]bool)
+	for _, at := range offsets {
+		flipped[at] = true
+	}
+	for i := range down {
+		if want := flipped[int64(i)]; (down[i] != payload[i]) != want {
+			t.Errorf("byte %d: got %#x, sent %#x, want flipped %v", i, down[i], payload[i], want)
+		} else if want && down[i] != ^payload[i] {
+			t.Errorf("byte %d = %#x, want every bit of %#x flipped", i, down[i], payload[i])
+		}
+	}
+	if got := <-received; string(got) != "hel\x93o" {
+		t.Errorf("server got %q, want the fourth byte flipped", got)
+	}
+	if st := p.Stats(); st.Corrupted != len(offsets)+1 || st.Drops != 0 {
+		t.Errorf("stats = %+v, want %d bytes corrupted and no drops", st, len(offsets)+1)
+	}
+}
+
+func TestFaultProxyThrottle(t *testing.T) {
+	payload := randomBytes(t, 40_000)
+	p, _ := startFaultProxy(t, payload)
+	p.SetScript(Always(Faults{Down: Fault{BytesPerSec: 100_000, Latency: 10 * time.Millisecond}}))
+
+	start := time.Now()
+	if down := exchange(t, p, nil); !bytes.Equal(down, payload) {
+		t.Fatalf("got %d bytes, want the %d sent unchanged", len(down), len(payload))
+	}
+	// 40KB at 100KB/s takes at least 400ms, less the first read
+	if took := time.Since(start); took < 300*time.Millisecond {
+		t.Errorf("took %v, want the transfer throttled to about 400ms", took)
+	}
+}